@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/imfs"
+	"math"
+	"strings"
+)
+
+// Copies a file block by block like `dd`, with Filesystem.CopyRange:
+// "dd if=<src> of=<dst> [bs=<size>] [count=<blocks>] [skip=<blocks>] [seek=<blocks>] [conv=notrunc]".
+// The output file is created if it doesn't exist, and truncated after seek unless conv=notrunc.
+func runDdCommand(fs *imfs.Filesystem, params []string) error {
+	operands := map[string]string{"bs": "512", "count": "-1", "skip": "0", "seek": "0"}
+	for _, param := range params {
+		key, value, ok := strings.Cut(param, "=")
+		switch key {
+		case "if", "of", "bs", "count", "skip", "seek", "conv":
+		default:
+			ok = false
+		}
+		if !ok {
+			return fmt.Errorf("Invalid operand %s: only if, of, bs, count, skip, seek and conv are supported", param)
+		}
+		operands[key] = value
+	}
+	if operands["if"] == "" || operands["of"] == "" {
+		return fmt.Errorf("dd needs an input file (if=<path>) and an output file (of=<path>) - run 'help' for guidance")
+	}
+	if conv, ok := operands["conv"]; ok && conv != "notrunc" {
+		return fmt.Errorf("Invalid conversion %s: only notrunc is supported", conv)
+	}
+	bs, err := imfs.ParseSize(operands["bs"])
+	if err != nil || bs == 0 {
+		return fmt.Errorf("Invalid block size %s: must be a positive size", operands["bs"])
+	}
+	blocks := map[string]int{}
+	for _, key := range []string{"count", "skip", "seek"} {
+		if key == "count" && operands[key] == "-1" {
+			blocks[key] = -1
+			continue
+		}
+		if blocks[key], err = imfs.ParseSize(operands[key]); err != nil {
+			return fmt.Errorf("Invalid %s %s: must be a number of blocks", key, operands[key])
+		}
+	}
+
+	src, dst := operands["if"], operands["of"]
+	if _, err := fs.Stat(dst); errors.Is(err, imfs.ErrFileNotFound) {
+		if _, err := fs.MkFile(dst); err != nil {
+			fmt.Fprintln(out, err)
+			return nil
+		}
+	}
+	if _, ok := operands["conv"]; !ok {
+		seek, err := blockOffset("seek", blocks["seek"], bs)
+		if err == nil {
+			err = fs.Truncate(dst, seek)
+		}
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return nil
+		}
+	}
+
+	full, partial, total := 0, 0, 0
+	for i := 0; blocks["count"] < 0 || i < blocks["count"]; i++ {
+		srcOff, err := blockOffset("skip", blocks["skip"]+i, bs)
+		dstOff := 0
+		if err == nil {
+			dstOff, err = blockOffset("seek", blocks["seek"]+i, bs)
+		}
+		if err != nil {
+			fmt.Fprintln(out, err)
+			break
+		}
+		n, err := fs.CopyRange(src, srcOff, dst, dstOff, bs)
+		total += n
+		if n == bs {
+			full++
+		} else if n > 0 {
+			partial++
+		}
+		if err != nil {
+			fmt.Fprintln(out, err)
+			break
+		}
+		if n < bs {
+			break
+		}
+	}
+	fmt.Fprintf(out, "%d+%d records in\n%d+%d records out\n%d bytes copied\n", full, partial, full, partial, total)
+	return nil
+}
+
+// Returns the byte offset of the given block for the skip or seek operand, or an error if it
+// doesn't fit in an int
+func blockOffset(key string, block int, bs int) (int, error) {
+	if block > math.MaxInt/bs {
+		return 0, fmt.Errorf("Invalid %s %d: too far for blocks of %d bytes", key, block, bs)
+	}
+	return block * bs, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+// The tree loaded by the -demo flag, in the fixture format read by Filesystem.LoadFixture
+const DemoFixture string = `# Two users' home directories and some shared files, to try cd/ls/find on
+entries:
+  - path: home/alice/.profile
+    contents: |
+      export EDITOR=vim
+      export PATH=$HOME/bin:$PATH
+    owner: alice
+  - path: home/alice/notes.txt
+    contents: |
+      - ship the parser
+      - review bob's PR
+    owner: alice
+  - path: home/alice/bin/deploy.sh
+    contents: |
+      #!/bin/sh
+      echo "deploying $1"
+    mode: "755"
+    owner: alice
+  - path: home/alice/projects/website/index.html
+    contents: |
+      <html><body><h1>Hello</h1></body></html>
+  - path: home/alice/projects/website/style.css
+    contents: |
+      body { font-family: sans-serif; }
+  - path: home/alice/projects/website/README.md
+    contents: |
+      # Website
+      Run deploy.sh to publish.
+  - path: home/alice/projects/parser/main.go
+    contents: |
+      package main
+
+      func main() {}
+  - path: home/alice/projects/parser/go.mod
+    contents: |
+      module example.com/parser
+  - path: home/alice/projects/parser/README.md
+    contents: |
+      # Parser
+      A tiny parser.
+  - path: home/alice/current
+    target: projects/parser
+  - path: home/bob/.profile
+    contents: |
+      export EDITOR=nano
+    owner: bob
+  - path: home/bob/todo.txt
+    contents: |
+      - answer alice
+    owner: bob
+  - path: home/bob/downloads
+    type: dir
+    owner: bob
+  - path: shared/docs/handbook.md
+    contents: |
+      # Handbook
+      Welcome aboard!
+  - path: shared/docs/faq.md
+    contents: |
+      # FAQ
+      Ask in the chat.
+  - path: shared/handbook
+    target: docs/handbook.md
+  - path: tmp
+    type: dir
+    mode: "777"
+  - path: dev/null
+    type: "null"
+  - path: dev/zero
+    type: zero
+  - path: dev/random
+    type: random
+`
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bwent/in-memory-fs/imfs"
+	"strconv"
+	"strings"
+)
+
+// Prints a file's bytes like `hexdump -C`, reading them through a handle so nothing is
+// truncated. -n limits how many bytes are dumped and -s skips bytes from the start.
+func runHexdumpCommand(fs *imfs.Filesystem, params []string) error {
+	length, offset := -1, 0
+	for len(params) > 1 {
+		value, err := strconv.Atoi(params[1])
+		if err != nil || value < 0 {
+			return fmt.Errorf("Invalid value %s for %s: must be a non-negative number", params[1], params[0])
+		}
+		switch params[0] {
+		case "-n":
+			length = value
+		case "-s":
+			offset = value
+		default:
+			return fmt.Errorf("Invalid flag %s: only -n and -s are supported", params[0])
+		}
+		params = params[2:]
+	}
+	if len(params) != 1 {
+		return fmt.Errorf("hexdump takes optional -n <length> and -s <offset> flags and a path - run 'help' for guidance")
+	}
+
+	entry, err := fs.Stat(params[0])
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return nil
+	}
+	if entry.Type != imfs.EntryFile {
+		fmt.Fprintf(out, "File %s is not a regular file\n", params[0])
+		return nil
+	}
+	size := entry.Size - offset
+	if size < 0 {
+		size = 0
+	}
+	if length >= 0 && length < size {
+		size = length
+	}
+	h, err := fs.Open(params[0])
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return nil
+	}
+	defer h.Close()
+	data := make([]byte, size)
+	n, err := h.ReadAt(data, int64(offset))
+	if n < size && err != nil {
+		fmt.Fprintln(out, err)
+		return nil
+	}
+	fmt.Fprintln(out, hexDump(data[:n], offset))
+	return nil
+}
+
+// Formats bytes like `hexdump -C`: 16 bytes per line after their offset, then the printable
+// ones, runs of identical lines collapsed into "*", and the offset after the last byte
+func hexDump(data []byte, offset int) string {
+	var b strings.Builder
+	var previous []byte
+	collapsed := false
+	for start := 0; start < len(data); start += 16 {
+		line := data[start:min(start+16, len(data))]
+		if len(line) == 16 && bytes.Equal(line, previous) {
+			if !collapsed {
+				b.WriteString("*\n")
+				collapsed = true
+			}
+			continue
+		}
+		previous, collapsed = line, false
+
+		fmt.Fprintf(&b, "%08x  ", offset+start)
+		for i := 0; i < 16; i++ {
+			if i < len(line) {
+				fmt.Fprintf(&b, "%02x ", line[i])
+			} else {
+				b.WriteString("   ")
+			}
+			if i == 7 {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(" |")
+		for _, c := range line {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			b.WriteByte(c)
+		}
+		b.WriteString("|\n")
+	}
+	fmt.Fprintf(&b, "%08x", offset+len(data))
+	return b.String()
+}
@@ -0,0 +1,947 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bwent/in-memory-fs/imfs"
+	"github.com/bwent/in-memory-fs/imfstest"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+// Maps a valid method to its acceptable number of inputs
+var ValidInputMap = map[string][]int{
+	"pwd":   {0},
+	"df":    {0},
+	"gc":    {0},
+	"mkdir": {1},
+	"cd":    {1},
+	"pushd": {1},
+	"popd":  {0},
+	"dirs":  {0},
+	// "-R" is optional
+	"ls": {0, 1, 2},
+	// "-L <depth>" is optional
+	"tree": {0, 1, 2, 3},
+	"rm":   {1, 2},
+	// "-p" is optional
+	"mkfile":    {1, 2},
+	"mkfifo":    {1},
+	"mkspecial": {2},
+	"symlink":   {2},
+	"readlink":  {1},
+	"links":     {1},
+	// -1 indicates we have no bounds on the input size
+	"writefile": {-1},
+	// "-raw" is optional
+	"readfile": {1, 2},
+	"render":   {0, 2},
+	"truncate": {2},
+	// "-n <length>" and "-s <offset>" are optional
+	"hexdump": {1, 3, 5},
+	"dd":      {-1},
+	"extents": {1},
+	"mvfile":  {2},
+	"rename":  {2},
+	// "-n" is optional
+	"rename-all": {2, 3},
+	// "-i", "-contains", "-from <path>", "-size <size>" and "-printf <format>" are optional
+	"find":     {-1},
+	"search":   {-1},
+	"basename": {1},
+	"dirname":  {1},
+	"realpath": {1},
+	// "-R" is optional
+	"chmod":   {2, 3},
+	"chown":   {2, 3},
+	"top":     {0, 1},
+	"analyze": {0, 1},
+	"longest": {0},
+	// "--share" is optional
+	"dupes": {0, 1, 2},
+	// "checkpoint list" takes no name; create/restore/delete take one
+	"checkpoint": {1, 2},
+	// "assert content" takes a path and text that may contain spaces
+	"assert": {-1},
+	// "time" takes any other command
+	"time": {-1},
+	// "fixture dump" takes an optional format; "fixture load" a host file and optional template data
+	"fixture": {1, 2, 3},
+}
+
+// Maps the names accepted by mkspecial to the kind of node they create
+var SpecialKinds = map[string]imfs.SpecialKind{
+	"null":   imfs.SpecialNull,
+	"zero":   imfs.SpecialZero,
+	"random": imfs.SpecialRandom,
+}
+
+const HelpText string = `Commands:
+pwd              	Prints the current working directory.
+df                  	Reports how many bytes are used and free.
+gc                  	Shares identical file contents and trims unused space, reporting the bytes reclaimed.
+mkdir <path>        	Creates a new directory within the current working directory.
+cd <path>           	Changes the current working directory to the specified path. "cd -" goes back to the previous one.
+pushd <path>        	Saves the current directory on the directory stack and changes to the specified path.
+popd                	Changes to the directory on top of the directory stack and removes it from the stack.
+dirs                	Prints the current directory followed by the directory stack.
+ls [-R] [path]      	Lists the contents (files and subdirectories) of the specified path, a page at a time for large directories. -R lists everything below it too, following symbolic links.
+tree [-L <depth>] [path]	Draws the specified path and everything below it, following symbolic links to directories (up to depth levels with -L).
+rm <path> <useRecursion>    	Removes a file (not a directory). Set useRecursion to true to remove directories recursively.
+mkfile [-p] <path>  	Creates a new empty file at the path (creating missing parent directories with -p).
+mkfifo <path>       	Creates a named pipe; reading from it consumes what was written.
+mkspecial <path> <null|zero|random>	Creates a device-like node that behaves like /dev/null, /dev/zero or /dev/urandom.
+symlink <target> <path>	Creates a symbolic link at path pointing at target.
+readlink <path>     	Prints the target of a symbolic link.
+links <path>        	Prints the inode of the path and every path leading to it.
+writeFile <path>    	Appends contents to the specified file, following symbolic links.
+readFile [-raw] <path>	Reads the contents of the specified file, following symbolic links. JSON is indented, CSV lined up and binary contents hex-dumped unless -raw is given.
+truncate <path> <size>	Shrinks the file to size bytes (like 512 or 4K), or extends it with zero bytes.
+hexdump [-n <length>] [-s <offset>] <path>	Prints the bytes of a file in hex and ASCII like hexdump -C, up to length bytes starting at offset.
+dd if=<src> of=<dst> [bs=<size>] [count=<n>] [skip=<n>] [seek=<n>] [conv=notrunc]	Copies count blocks of bs bytes (default 512) from src, skipping skip blocks, into dst after seek blocks.
+extents <path>	Lists the data and hole ranges of a file as kind, offset and length, holes being 4096-byte blocks never written to.
+render [<.ext> <json|csv|hex|text>]	Lists how readfile displays each extension, or sets how it displays one.
+mvfile <name> <target>  	Moves the specified file to the given target directory.
+rename <path> <name>	Renames the entry at path within its directory, e.g. to change the case of its name.
+rename-all [-n] <glob> <template>	Renames the entries matching glob (e.g. '*.log') using template (e.g. '{name}.old.log'), with {1}, {2}... for what each wildcard matched. -n only previews the renames.
+basename <path>     	Prints the last element of the path.
+dirname <path>      	Prints the path without its last element.
+realpath <path>     	Prints the absolute path with "..", "." and symbolic links resolved.
+chmod [-R] <mode> <path>	Sets the octal permission bits of a file or directory (and everything inside it with -R).
+chown [-R] <owner> <path>	Sets the owner of a file or directory (and everything inside it with -R).
+find [-i] [-contains] <name> <useRecursion> [-from <path>] [-size [+-]<size>] [-printf <format>]	Finds files or directories with the specified name ("*" for any) in the current directory (or path), listed relative to it. Set useRecursion to true to search subdirectories. -i ignores case, -contains matches names containing the given one, -size only matches files larger (+) or smaller (-) than a size like 10M, and -printf prints each match on its own line using a format with find-like directives for the path, name, size and time (see the README).
+search <words...>   	Lists the files containing all of the words, best matches first.
+checkpoint <create|restore|delete> <name>	Saves, restores or deletes a named checkpoint of the filesystem.
+checkpoint list     	Lists all saved checkpoints.
+fixture dump [yaml|json]	Prints the whole tree as a fixture spec (YAML by default).
+fixture load <file> [data.json]	Creates the entries of a YAML or JSON fixture spec read from a file on the host, expanding text file contents as Go templates with the keys of an optional JSON data file.
+assert exists <path>	Fails unless something exists at path.
+assert content <path> <text>	Fails unless the file at path contains exactly text (Go-quoted text may use escapes like \n).
+assert count <path> <n>	Fails unless the directory at path has exactly n entries.
+time <command>      	Runs the command, then reports how long it took, how many nodes it visited and each operation it ran.
+analyze [path]      	Reports file counts and sizes per extension, the largest files, the deepest path and the average file size.
+longest	Reports the deepest path, the longest path and name, and how path lengths are distributed, to check the tree fits a platform's limits.
+dupes [path] [--share]	Lists groups of files with identical contents; --share makes each group share one copy to save memory.
+top [count]         	Shows the most frequently read/written files (10 by default).
+help                	Displays this help menu.
+exit                	Exits the program.`
+
+// The default -prompt template, e.g. "alice@imfs:/home/alice$ "
+const DefaultPrompt string = "{{.User}}@imfs:{{.Cwd}}$ "
+
+// The values available to -prompt templates
+type PromptData struct {
+	// The name given with -user
+	User string
+	// The current working directory
+	Cwd string
+}
+
+// Where commands print their output: stdout, or the connection of the session running the
+// command in -serve-repl mode
+var out io.Writer = os.Stdout
+
+func main() {
+	metricsAddr := flag.String("metrics", "", "serve Prometheus metrics on this address, e.g. :9090")
+	logLevel := flag.String("log", "", "log filesystem operations to stderr at this level (debug, info, warn or error)")
+	demo := flag.Bool("demo", false, "start with an example tree of home directories, projects and links to explore")
+	user := flag.String("user", os.Getenv("USER"), "the user name shown in the prompt")
+	prompt := flag.String("prompt", DefaultPrompt, "the prompt, as a Go template using {{.User}} and {{.Cwd}}")
+	batch := flag.Bool("batch", false, "run commands from stdin without prompting, exiting with status 1 if an assertion failed")
+	pageSize := flag.Int("page-size", DefaultPageSize, "list directories with more entries than this a page at a time, one entry per line (0 disables paging)")
+	autosave := flag.String("autosave", "", "save the tree to this file on the host periodically and on exit, restoring it on startup if the file exists")
+	autosaveInterval := flag.Duration("autosave-interval", 30*time.Second, "how often to save the tree with -autosave")
+	serveAddr := flag.String("serve-repl", "", "serve REPL sessions sharing the tree to clients (e.g. nc) connecting to this address instead of reading stdin: a Unix socket path, or a TCP address like localhost:7070")
+	serveReadOnly := flag.Bool("serve-readonly", false, "make -serve-repl sessions read-only")
+	serveCommands := flag.String("serve-commands", "", "only allow these comma-separated commands in -serve-repl sessions, e.g. ls,cd,pwd,readfile")
+	serveOpsRate := flag.Float64("serve-ops-rate", 0, "limit each -serve-repl session to this many operations per second (0 for no limit)")
+	serveBytesRate := flag.Float64("serve-bytes-rate", 0, "limit each -serve-repl session to writing this many bytes per second (0 for no limit)")
+	serveHostFiles := flag.Bool("serve-host-files", false, "let -serve-repl and -serve-admin sessions run fixture load, which reads files on the host")
+	serveAdmin := flag.String("serve-admin", "", "also serve sessions without the -serve-readonly, -serve-commands and rate limit restrictions on this address")
+	serve9PAddr := flag.String("serve-9p", "", "serve the tree over 9P2000 on this address too, so it can be mounted with mount -t 9p: a Unix socket path, or a TCP address like localhost:5640")
+	createOnWrite := flag.Bool("create-on-write", false, "make writefile create files that don't exist, rather than failing")
+	repointLinks := flag.Bool("repoint-links", false, "make mvfile update the symbolic links pointing at a moved file")
+	readThrough := flag.String("read-through", "", "load paths missing from the tree from this directory on the host on first use, without ever writing to it")
+	writeBack := flag.Bool("write-back", false, "also write changes back to the -read-through directory, from the next command on and on exit")
+	indexContents := flag.Bool("index-contents", false, "keep an index of file contents for search, rather than reading every file on each search")
+	atime := flag.String("atime", "never", "when reading a file records its access time, shown by find -printf %a: never, relatime or always")
+	dirModTimes := flag.Bool("dir-mtimes", false, "make creating, removing or moving an entry update its directory's modification time, as POSIX does")
+	listingDelay := flag.Duration("listing-delay", 0, "make ls and find only show entries created or removed this long ago, like an eventually consistent object store")
+	flag.Parse()
+
+	opts := imfs.Options{CreateOnWrite: *createOnWrite, RepointLinks: *repointLinks, ListingDelay: *listingDelay, IndexContents: *indexContents, DirModTimes: *dirModTimes}
+	atimeModes := map[string]imfs.AtimeMode{"never": imfs.AtimeNever, "relatime": imfs.AtimeRelatime, "always": imfs.AtimeAlways}
+	mode, ok := atimeModes[*atime]
+	if !ok {
+		fmt.Println("Invalid atime mode: must be never, relatime or always")
+		return
+	}
+	opts.Atime = mode
+	if *readThrough != "" {
+		opts.Backing = os.DirFS(*readThrough)
+	}
+	if *readThrough != "" && *writeBack {
+		opts.Backing = imfs.WritableDirFS(*readThrough)
+		opts.WriteBack = true
+	}
+	if *logLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+			fmt.Println("Invalid log level: ", err)
+			return
+		}
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	}
+	promptTemplate, err := template.New("prompt").Parse(*prompt)
+	if err != nil {
+		fmt.Println("Invalid prompt: ", err)
+		return
+	}
+	if *user == "" {
+		*user = "user"
+	}
+	fs := imfs.NewFileSystemWithOptions(opts)
+	if *demo {
+		if err := fs.LoadFixture(strings.NewReader(DemoFixture)); err != nil {
+			fmt.Println("Error loading the demo tree: ", err)
+			return
+		}
+		fs.Cd("~/home/alice")
+		fmt.Println("Loaded the demo tree; you're in /home/alice. Try ls, cd projects/website, readlink current or find faq.md true -from ~.")
+	}
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", fs.Metrics())
+		go func() {
+			fmt.Println(http.ListenAndServe(*metricsAddr, mux))
+		}()
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	if !*batch {
+		pager.PageSize = *pageSize
+		pager.In = reader
+	}
+	failedAssertions := 0
+	defer func() {
+		if *batch && failedAssertions > 0 {
+			os.Exit(1)
+		}
+	}()
+	if *writeBack {
+		// Deferred after the exit status, so pending changes are written back before exiting
+		defer func() {
+			if err := fs.SyncBacking(); err != nil {
+				fmt.Println("Error writing changes back: ", err)
+			}
+		}()
+	}
+	if *autosave != "" {
+		// Deferred after the exit status, so the last save happens before exiting
+		if err := startAutosave(fs, *autosave, *autosaveInterval); err != nil {
+			fmt.Println("Error setting up autosave: ", err)
+			return
+		}
+		defer func() {
+			if err := fs.DisableAutosave(); err != nil {
+				fmt.Println("Error saving the tree: ", err)
+			}
+		}()
+	}
+	// Held while a command or 9P request uses the filesystem
+	var mu sync.Mutex
+	if *serve9PAddr != "" {
+		if err := serve9P(fs, *serve9PAddr, &mu); err != nil {
+			fmt.Println("Error serving 9P: ", err)
+			return
+		}
+	}
+	if *serveAddr != "" {
+		commands, err := parseCommandAllowlist(*serveCommands)
+		if err != nil {
+			fmt.Println("Invalid -serve-commands: ", err)
+			return
+		}
+		endpoints := []replEndpoint{{address: *serveAddr, policy: sessionPolicy{
+			readOnly:  *serveReadOnly,
+			commands:  commands,
+			rateLimit: imfs.RateLimit{OpsPerSecond: *serveOpsRate, BytesPerSecond: *serveBytesRate},
+			hostFiles: *serveHostFiles,
+		}}}
+		if *serveAdmin != "" {
+			endpoints = append(endpoints, replEndpoint{address: *serveAdmin, policy: sessionPolicy{hostFiles: *serveHostFiles}})
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := serveREPL(ctx, fs, &mu, endpoints, *user, promptTemplate); err != nil {
+			fmt.Println("Error serving REPL sessions: ", err)
+		}
+		return
+	}
+	for {
+		if !*batch {
+			// Rendered before every command, so the prompt follows cd
+			if err := promptTemplate.Execute(os.Stdout, PromptData{User: *user, Cwd: fs.Pwd()}); err != nil {
+				fmt.Println("Error rendering the prompt: ", err)
+				return
+			}
+		}
+		input, err := reader.ReadString('\n')
+		if err == io.EOF && *batch {
+			if strings.TrimSpace(input) == "" {
+				return
+			}
+		} else if err != nil {
+			fmt.Println("Error parsing input: ", err)
+			return
+		}
+
+		keyword := strings.TrimSpace(input)
+
+		switch keyword {
+		case "exit":
+			fmt.Println("Exiting")
+			return
+		case "help":
+			fmt.Println(HelpText)
+			return
+		default:
+			mu.Lock()
+			err := parseUserInputs(fs, strings.Split(input, " "))
+			mu.Unlock()
+			if errors.As(err, &assertionError{}) {
+				failedAssertions++
+			}
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+		}
+	}
+}
+
+// Restores the tree saved at path, if there is one, then saves it there every interval
+func startAutosave(fs *imfs.Filesystem, path string, interval time.Duration) error {
+	f, err := os.Open(path)
+	if err == nil {
+		err = fs.LoadSnapshot(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Restored the tree saved at %s\n", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return fs.EnableAutosave(path, interval)
+}
+
+func validateInputs(method string, inputs []string) error {
+	validInputSizes := ValidInputMap[method]
+	if validInputSizes == nil {
+		return fmt.Errorf("Invalid method %s- run 'help' for guidance", method)
+	}
+	if !contains(validInputSizes, len(inputs)) && validInputSizes[0] != -1 {
+		validSizesStr := strings.Trim(strings.Join(strings.Fields(fmt.Sprint(validInputSizes)), ", "), "[]")
+		return fmt.Errorf("Invalid input length (saw=%d, expected=%s). Run 'help' for guidance", len(inputs), validSizesStr)
+	}
+	return nil
+}
+
+func parseUserInputs(fs *imfs.Filesystem, inputs []string) error {
+	method := inputs[0]
+	method = strings.ToLower(method)
+	method = strings.TrimSpace(method)
+
+	params := inputs[1:]
+
+	err := validateInputs(method, params)
+	if err != nil {
+		return err
+	}
+	for i := range params {
+		params[i] = strings.TrimSpace(params[i])
+	}
+
+	switch method {
+	case "pwd":
+		fmt.Fprintln(out, fs.Pwd())
+	case "df":
+		usage := fs.DiskUsage()
+		if usage.Capacity == 0 {
+			fmt.Fprintf(out, "used=%d capacity=unlimited\n", usage.Used)
+		} else {
+			fmt.Fprintf(out, "used=%d free=%d capacity=%d\n", usage.Used, usage.Free, usage.Capacity)
+		}
+	case "gc":
+		stats := fs.GC()
+		fmt.Fprintf(out, "reclaimed=%d bytes (%d -> %d bytes, %d -> %d blocks, %d files)\n", stats.Reclaimed,
+			stats.BytesBefore, stats.BytesAfter, stats.BlocksBefore, stats.BlocksAfter, stats.Files)
+	case "mkdir":
+		printResults(fs.MkDir(params[0]))
+	case "cd":
+		printResults(fs.Cd(params[0]))
+	case "pushd":
+		printResults(fs.PushDir(params[0]))
+	case "popd":
+		printResults(fs.PopDir())
+	case "dirs":
+		fmt.Fprintln(out, strings.Join(fs.Dirs(), " "))
+	case "ls":
+		return runLsCommand(fs, params)
+	case "tree":
+		return runTreeCommand(fs, params)
+	case "rm":
+		useRecursion := false
+		var err error
+		if len(params) == 2 {
+			useRecursion, err = strconv.ParseBool(params[1])
+			if err != nil {
+				fmt.Fprintln(out, "Invalid second parameter: must be among {true, false, T, F, 0, 1}")
+			}
+		}
+		printResults(fs.Rm(params[0], useRecursion))
+	case "mkfile":
+		if len(params) == 2 {
+			if params[0] != "-p" {
+				return fmt.Errorf("Invalid flag %s: only -p is supported", params[0])
+			}
+			printResults(fs.MkFileAll(params[1]))
+		} else {
+			printResults(fs.MkFile(params[0]))
+		}
+	case "mkfifo":
+		printResults(fs.MkFifo(params[0]))
+	case "mkspecial":
+		kind, ok := SpecialKinds[strings.ToLower(params[1])]
+		if !ok {
+			return fmt.Errorf("Invalid special kind %s: must be among {null, zero, random}", params[1])
+		}
+		printResults(fs.MkSpecial(params[0], kind))
+	case "symlink":
+		printResults(fs.Symlink(params[0], params[1]))
+	case "readlink":
+		printResults(fs.Readlink(params[0]))
+	case "links":
+		inode, err := fs.Inode(params[0])
+		if err != nil {
+			fmt.Fprintln(out, err)
+			break
+		}
+		fmt.Fprintf(out, "inode %d\n", inode)
+		for _, path := range fs.PathsForInode(inode) {
+			fmt.Fprintln(out, path)
+		}
+	case "writefile":
+		printResults(fs.WriteFile(params[0], params[1:]...))
+	case "readfile":
+		if len(params) == 2 && params[0] != "-raw" {
+			return fmt.Errorf("Invalid flag %s: only -raw is supported", params[0])
+		}
+		res, err := fs.ReadFile(params[len(params)-1])
+		if err == nil && len(params) == 1 {
+			res = renderContents(params[0], res)
+		}
+		printResults(res, err)
+	case "render":
+		return runRenderCommand(params)
+	case "hexdump":
+		return runHexdumpCommand(fs, params)
+	case "dd":
+		return runDdCommand(fs, params)
+	case "extents":
+		extents, err := fs.Extents(params[0])
+		if err != nil {
+			fmt.Fprintln(out, err)
+			break
+		}
+		for _, extent := range extents {
+			kind := "data"
+			if extent.Hole {
+				kind = "hole"
+			}
+			fmt.Fprintf(out, "%s\t%d\t%d\n", kind, extent.Offset, extent.Length)
+		}
+	case "truncate":
+		size, err := imfs.ParseSize(params[1])
+		if err != nil {
+			return err
+		}
+		if err := fs.Truncate(params[0], size); err != nil {
+			fmt.Fprintln(out, err)
+			break
+		}
+		fmt.Fprintln(out, params[0])
+	case "mvfile":
+		printResults(fs.MvFile(params[0], params[1]))
+	case "rename":
+		printResults(fs.Rename(params[0], params[1]))
+	case "rename-all":
+		return runRenameAllCommand(fs, params)
+	case "basename":
+		fmt.Fprintln(out, imfs.Basename(params[0]))
+	case "dirname":
+		fmt.Fprintln(out, imfs.Dirname(params[0]))
+	case "realpath":
+		printResults(fs.Realpath(params[0]))
+	case "find":
+		return runFindCommand(fs, params)
+	case "search":
+		if len(params) == 0 {
+			fmt.Fprintln(out, "Must provide words to search for")
+			break
+		}
+		for _, result := range fs.Search(strings.Join(params, " ")) {
+			fmt.Fprintln(out, result.Path)
+		}
+	case "checkpoint":
+		return runCheckpointCommand(fs, params)
+	case "assert":
+		return runAssertCommand(fs, params)
+	case "time":
+		return runTimeCommand(fs, params)
+	case "dupes":
+		return runDupesCommand(fs, params)
+	case "analyze":
+		path := "."
+		if len(params) == 1 {
+			path = params[0]
+		}
+		analysis, err := fs.Analyze(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "files=%d dirs=%d bytes=%d average=%.1f\n", analysis.Files, analysis.Directories, analysis.Bytes, analysis.AverageSize)
+		fmt.Fprintf(out, "deepest=%s (%d levels)\n", analysis.DeepestPath, analysis.DeepestLevel)
+		fmt.Fprintln(out, "By extension:")
+		for _, ext := range analysis.ByExtension {
+			name := ext.Extension
+			if name == "" {
+				name = "(none)"
+			}
+			fmt.Fprintf(out, "  %s files=%d bytes=%d\n", name, ext.Files, ext.Bytes)
+		}
+		fmt.Fprintln(out, "Largest files:")
+		for _, file := range analysis.Largest {
+			fmt.Fprintf(out, "  %d %s\n", file.Size, file.Path)
+		}
+	case "longest":
+		report := fs.Longest()
+		fmt.Fprintf(out, "entries=%d\n", report.Entries)
+		fmt.Fprintf(out, "deepest=%s (%d levels)\n", report.DeepestPath, report.Depth)
+		fmt.Fprintf(out, "longest path=%s (%d bytes)\n", report.LongestPath, len(report.LongestPath))
+		fmt.Fprintf(out, "longest name=%s (%d bytes)\n", report.LongestNamePath, report.LongestName)
+		fmt.Fprintln(out, "Path lengths:")
+		for _, bucket := range report.Distribution {
+			fmt.Fprintf(out, "  %d-%d bytes: %d\n", bucket.Min, bucket.Max, bucket.Count)
+		}
+	case "fixture":
+		return runFixtureCommand(fs, params)
+	case "chmod", "chown":
+		return runAttributeCommand(fs, method, params)
+	case "top":
+		count := 10
+		if len(params) == 1 {
+			count, err = strconv.Atoi(params[0])
+			if err != nil || count < 1 {
+				return fmt.Errorf("Invalid count %s: must be a positive number", params[0])
+			}
+		}
+		stats := fs.AccessStats()
+		if len(stats) > count {
+			stats = stats[:count]
+		}
+		for _, stat := range stats {
+			fmt.Fprintf(out, "reads=%d writes=%d bytesRead=%d bytesWritten=%d %s\n",
+				stat.Reads, stat.Writes, stat.BytesRead, stat.BytesWritten, stat.Path)
+		}
+	default:
+		return fmt.Errorf("Invalid method call %s - please run 'help' for more details", method)
+	}
+	return nil
+}
+
+func runCheckpointCommand(fs *imfs.Filesystem, params []string) error {
+	subcommand := strings.ToLower(params[0])
+	switch subcommand {
+	case "list":
+		fmt.Fprintln(out, strings.Join(fs.ListCheckpoints(), " "))
+		return nil
+	case "create", "restore", "delete":
+		if len(params) != 2 {
+			return fmt.Errorf("checkpoint %s requires a name - run 'help' for guidance", subcommand)
+		}
+	default:
+		return fmt.Errorf("Invalid checkpoint subcommand %s - run 'help' for guidance", subcommand)
+	}
+
+	switch subcommand {
+	case "create":
+		printResults(fs.Checkpoint(params[1]))
+	case "restore":
+		printResults(fs.Restore(params[1]))
+	case "delete":
+		printResults(fs.DeleteCheckpoint(params[1]))
+	}
+	return nil
+}
+
+func runDupesCommand(fs *imfs.Filesystem, params []string) error {
+	path, share := ".", false
+	for _, param := range params {
+		if param == "--share" {
+			share = true
+		} else if path == "." {
+			path = param
+		} else {
+			return fmt.Errorf("dupes takes a single path - run 'help' for guidance")
+		}
+	}
+
+	groups, err := fs.FindDuplicates(path)
+	if err != nil {
+		return err
+	}
+	wasted := 0
+	for _, group := range groups {
+		fmt.Fprintf(out, "%d bytes x %d: %s\n", group.Size, len(group.Paths), strings.Join(group.Paths, " "))
+		wasted += group.Wasted()
+	}
+	fmt.Fprintf(out, "groups=%d wasted=%d bytes\n", len(groups), wasted)
+	if share {
+		reclaimed, err := fs.ShareDuplicates(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "reclaimed=%d bytes\n", reclaimed)
+	}
+	return nil
+}
+
+func runTimeCommand(fs *imfs.Filesystem, params []string) error {
+	if len(params) == 0 || params[0] == "" {
+		return fmt.Errorf("time requires a command - run 'help' for guidance")
+	}
+	var err error
+	profile := fs.Profile(func() {
+		err = parseUserInputs(fs, params)
+	})
+	fmt.Fprintf(out, "real=%s nodes=%d ops=%d\n", profile.Elapsed, profile.NodesVisited, len(profile.Operations))
+	for _, op := range profile.Operations {
+		status := "ok"
+		if op.Err != nil {
+			status = op.Err.Error()
+		}
+		fmt.Fprintf(out, "  %s %s %s (%s)\n", op.Op, op.Path, op.Elapsed, status)
+	}
+	// Returned rather than printed so failed assertions still count in batch mode
+	return err
+}
+
+// Returned by assert commands whose condition doesn't hold
+type assertionError struct {
+	failures []string
+}
+
+func (e assertionError) Error() string {
+	return "Assertion failed: " + strings.Join(e.failures, "; ")
+}
+
+// Collects the failures reported by the imfstest assertions
+type assertionRecorder struct {
+	failures []string
+}
+
+func (r *assertionRecorder) Helper() {}
+
+func (r *assertionRecorder) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *assertionRecorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+}
+
+func runAssertCommand(fs *imfs.Filesystem, params []string) error {
+	if len(params) < 2 {
+		return fmt.Errorf("assert requires a condition and a path - run 'help' for guidance")
+	}
+	condition, path := strings.ToLower(params[0]), params[1]
+	recorder := &assertionRecorder{}
+	switch condition {
+	case "exists":
+		if len(params) != 2 {
+			return fmt.Errorf("assert exists takes only a path - run 'help' for guidance")
+		}
+		imfstest.RequireExists(recorder, fs, path)
+	case "content":
+		if len(params) < 3 {
+			return fmt.Errorf("assert content requires a path and text - run 'help' for guidance")
+		}
+		text := strings.Join(params[2:], " ")
+		if strings.HasPrefix(text, "\"") {
+			unquoted, err := strconv.Unquote(text)
+			if err != nil {
+				return fmt.Errorf("Invalid quoted text %s", text)
+			}
+			text = unquoted
+		}
+		imfstest.AssertFileContent(recorder, fs, path, text)
+	case "count":
+		if len(params) != 3 {
+			return fmt.Errorf("assert count requires a path and a number - run 'help' for guidance")
+		}
+		want, err := strconv.Atoi(params[2])
+		if err != nil || want < 0 {
+			return fmt.Errorf("Invalid count %s: must be a non-negative number", params[2])
+		}
+		resolved, err := fs.Realpath(path)
+		if err != nil {
+			recorder.Errorf("Expected %s to have %d entries, but it does not exist: %s", path, want, err)
+			break
+		}
+		entries, err := fs.LsEntries("~" + resolved)
+		if err != nil {
+			recorder.Errorf("Expected %s to have %d entries: %s", path, want, err)
+		} else if len(entries) != want {
+			recorder.Errorf("Expected %s to have %d entries, got %d", path, want, len(entries))
+		}
+	default:
+		return fmt.Errorf("Invalid assert condition %s - run 'help' for guidance", condition)
+	}
+
+	if len(recorder.failures) > 0 {
+		return assertionError{failures: recorder.failures}
+	}
+	fmt.Fprintln(out, "ok")
+	return nil
+}
+
+func runFixtureCommand(fs *imfs.Filesystem, params []string) error {
+	switch strings.ToLower(params[0]) {
+	case "dump":
+		format := imfs.FixtureYAML
+		if len(params) == 3 {
+			return fmt.Errorf("fixture dump takes at most a format - run 'help' for guidance")
+		}
+		if len(params) == 2 {
+			format = imfs.FixtureFormat(strings.ToLower(params[1]))
+		}
+		return fs.DumpFixture(out, format)
+	case "load":
+		if len(params) < 2 {
+			return fmt.Errorf("fixture load requires a file - run 'help' for guidance")
+		}
+		file, err := os.Open(params[1])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if len(params) == 2 {
+			return fs.LoadFixture(file)
+		}
+		raw, err := os.ReadFile(params[2])
+		if err != nil {
+			return err
+		}
+		var data map[string]any
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return fmt.Errorf("Invalid template data: %s", err)
+		}
+		return fs.LoadFixtureWithTemplate(file, imfs.FixtureTemplate{Data: data})
+	}
+	return fmt.Errorf("Invalid fixture subcommand %s - run 'help' for guidance", params[0])
+}
+
+func runFindCommand(fs *imfs.Filesystem, params []string) error {
+	var match imfs.NameMatch
+	for len(params) > 0 && strings.HasPrefix(params[0], "-") {
+		switch params[0] {
+		case "-i":
+			match.IgnoreCase = true
+		case "-contains":
+			match.Substring = true
+		default:
+			return fmt.Errorf("Invalid flag %s: only -i and -contains can come before the name", params[0])
+		}
+		params = params[1:]
+	}
+	if len(params) < 2 {
+		return fmt.Errorf("find takes a name and useRecursion - run 'help' for guidance")
+	}
+	target := params[0]
+	if target == "*" {
+		target = ""
+	}
+	recursive, err := strconv.ParseBool(params[1])
+	if err != nil {
+		return fmt.Errorf("Invalid second parameter: must be among {true, false, T, F, 0, 1}")
+	}
+
+	from, format := "", ""
+	var size *imfs.SizeFilter
+	for options := params[2:]; len(options) > 0; options = options[2:] {
+		if options[0] == "-printf" {
+			// The format takes the rest of the line, so it may contain spaces
+			format = strings.Join(options[1:], " ")
+			if strings.HasPrefix(format, "\"") {
+				if format, err = strconv.Unquote(format); err != nil {
+					return fmt.Errorf("Invalid quoted format %s", strings.Join(options[1:], " "))
+				}
+			}
+			break
+		}
+		if len(options) < 2 {
+			return fmt.Errorf("%s requires a value - run 'help' for guidance", options[0])
+		}
+		switch options[0] {
+		case "-from":
+			from = options[1]
+		case "-size":
+			if size, err = imfs.ParseSizeFilter(options[1]); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("Invalid flag %s: only -from, -size and -printf can come after useRecursion", options[0])
+		}
+	}
+
+	results, err := fs.FindFrom(from, target, recursive, match, size)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return nil
+	}
+	if format == "" {
+		paths := make([]string, 0, len(results))
+		for _, result := range results {
+			paths = append(paths, result.Path)
+		}
+		fmt.Fprintln(out, strings.Join(paths, ","))
+		return nil
+	}
+	for _, result := range results {
+		fmt.Fprintln(out, formatFindResult(format, result))
+	}
+	return nil
+}
+
+// Formats a find result like find's -printf: %p is the path relative to the directory searched,
+// %f the name, %s the size in bytes, %h the size for people (see imfs.FormatSize), %t the
+// modification time, %a the access time, %y the type and %% a percent sign
+func formatFindResult(format string, result imfs.FindResult) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'p':
+			b.WriteString(result.Path)
+		case 'f':
+			b.WriteString(result.Entry.Name)
+		case 's':
+			b.WriteString(strconv.Itoa(result.Entry.Size))
+		case 'h':
+			b.WriteString(imfs.FormatSize(result.Entry.Size))
+		case 't':
+			b.WriteString(result.Entry.ModTime.Format(time.DateTime))
+		case 'a':
+			b.WriteString(result.Entry.AccessTime.Format(time.DateTime))
+		case 'y':
+			b.WriteString(string(result.Entry.Type))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
+
+// Renames entries with "rename-all [-n] <glob> <template>", printing each rename. With -n the
+// renames are only previewed. Quotes around the glob and template, as in a shell, are dropped.
+func runRenameAllCommand(fs *imfs.Filesystem, params []string) error {
+	dryRun := len(params) == 3
+	if dryRun && params[0] != "-n" {
+		return fmt.Errorf("Invalid flag %s: only -n is supported", params[0])
+	}
+	glob, template := unquote(params[len(params)-2]), unquote(params[len(params)-1])
+	rename := fs.BatchRename
+	if dryRun {
+		rename = fs.PreviewBatchRename
+	}
+	renames, err := rename(glob, template)
+	for _, r := range renames {
+		fmt.Fprintf(out, "%s -> %s\n", r.From, r.To)
+	}
+	if err != nil {
+		fmt.Fprintln(out, err)
+	}
+	return nil
+}
+
+// Drops the single or double quotes around an argument, if any
+func unquote(arg string) string {
+	if len(arg) >= 2 && (arg[0] == '\'' || arg[0] == '"') && arg[len(arg)-1] == arg[0] {
+		return arg[1 : len(arg)-1]
+	}
+	return arg
+}
+
+func runAttributeCommand(fs *imfs.Filesystem, method string, params []string) error {
+	recursive := len(params) == 3
+	if recursive {
+		if params[0] != "-R" {
+			return fmt.Errorf("Invalid flag %s: only -R is supported", params[0])
+		}
+		params = params[1:]
+	}
+
+	var err error
+	if method == "chmod" {
+		mode, parseErr := imfs.ParseMode(params[0])
+		if parseErr != nil {
+			return parseErr
+		}
+		err = fs.Chmod(params[1], mode, recursive)
+	} else {
+		err = fs.Chown(params[1], params[0], recursive)
+	}
+	if err != nil {
+		fmt.Fprintln(out, err)
+	}
+	return nil
+}
+
+func printResults(res string, err error) {
+	if err != nil {
+		fmt.Fprintln(out, err)
+	} else {
+		fmt.Fprintln(out, res)
+	}
+}
+
+func contains(slice []int, val int) bool {
+	elementsMap := make(map[int]bool)
+	for _, num := range slice {
+		elementsMap[num] = true
+	}
+
+	return elementsMap[val]
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/bwent/in-memory-fs/imfs"
+	"io"
+	"os"
+	"strings"
+)
+
+// The default -page-size
+const DefaultPageSize int = 50
+
+// Paginates long listings in the REPL
+type Pager struct {
+	// How many entries to show per page. Directories with no more entries than this are listed on
+	// one line as before; 0 disables paging
+	PageSize int
+	// Where answers to the "more" prompt are read from, shared with the REPL's commands
+	In  *bufio.Reader
+	Out io.Writer
+}
+
+// The pager used by ls, set up by main from the -page-size flag. Disabled in batch mode, where
+// there is nobody to answer the prompt.
+var pager = Pager{Out: os.Stdout}
+
+// Lists a directory, a page at a time once it has more entries than fit on a page. Pages are
+// fetched with LsPage, so only the entries shown are ever described.
+func runLsCommand(fs *imfs.Filesystem, params []string) error {
+	if len(params) > 0 && params[0] == "-R" {
+		if len(params) == 2 {
+			return runRecursiveLs(fs, params[1])
+		}
+		return runRecursiveLs(fs, "")
+	}
+	if len(params) > 1 {
+		return fmt.Errorf("Invalid flag %s: only -R is supported", params[0])
+	}
+	path := ""
+	if len(params) == 1 {
+		path = params[0]
+	}
+	if pager.PageSize <= 0 {
+		printResults(fs.Ls(params...))
+		return nil
+	}
+	page, err := fs.LsPage(path, "", pager.PageSize+1)
+	if err != nil {
+		return err
+	}
+	if len(page) <= pager.PageSize {
+		printResults(fs.Ls(params...))
+		return nil
+	}
+
+	for {
+		more := len(page) > pager.PageSize
+		if more {
+			page = page[:pager.PageSize]
+		}
+		for _, entry := range page {
+			fmt.Fprintln(pager.Out, entry.Name)
+		}
+		if !more || !pager.more() {
+			return nil
+		}
+		if page, err = fs.LsPage(path, page[len(page)-1].Name, pager.PageSize+1); err != nil {
+			return err
+		}
+	}
+}
+
+// Asks whether to show the next page. Anything but "q" (e.g. just Enter, or space and Enter)
+// shows it; the terminal is line-buffered, so the answer needs Enter.
+func (p *Pager) more() bool {
+	fmt.Fprint(p.Out, "-- More (Enter for the next page, q to quit) -- ")
+	answer, err := p.In.ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(p.Out)
+		return false
+	}
+	return strings.TrimSpace(answer) != "q"
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// Formats file contents for display by readfile, or fails if the contents aren't in its format
+type renderer func(contents string) (string, error)
+
+// The renderers the render command can choose from, by name. "text" prints contents as stored
+var renderersByName = map[string]renderer{
+	"json": renderJSON,
+	"csv":  renderCSV,
+	"hex":  renderHex,
+	"text": func(contents string) (string, error) { return contents, nil },
+}
+
+// The renderer readfile uses for each extension (lowercase, with the dot), changed with the
+// render command. Files with other extensions are printed as stored, or hex-dumped if they
+// aren't text.
+var renderers = map[string]string{
+	".json": "json",
+	".csv":  "csv",
+}
+
+// Lists the renderer of each extension, or sets one with "render <.ext> <json|csv|hex|text>"
+func runRenderCommand(params []string) error {
+	if len(params) == 0 {
+		extensions := make([]string, 0, len(renderers))
+		for ext := range renderers {
+			extensions = append(extensions, ext)
+		}
+		sort.Strings(extensions)
+		for _, ext := range extensions {
+			fmt.Fprintf(out, "%s\t%s\n", ext, renderers[ext])
+		}
+		return nil
+	}
+	ext, name := strings.ToLower(params[0]), params[1]
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	if _, ok := renderersByName[name]; !ok {
+		return fmt.Errorf("Invalid renderer %s: must be among {json, csv, hex, text}", name)
+	}
+	renderers[ext] = name
+	return nil
+}
+
+// Formats the contents of the file at path for display, based on its extension. Contents a
+// renderer can't parse, like invalid JSON, are printed as stored.
+func renderContents(filePath string, contents string) string {
+	render := renderersByName[renderers[strings.ToLower(path.Ext(filePath))]]
+	if render == nil {
+		if isText(contents) {
+			return contents
+		}
+		render = renderHex
+	}
+	rendered, err := render(contents)
+	if err != nil {
+		return contents
+	}
+	return rendered
+}
+
+// Returns true if the contents are valid UTF-8 without NUL bytes
+func isText(contents string) bool {
+	return utf8.ValidString(contents) && !strings.ContainsRune(contents, 0)
+}
+
+// Indents JSON
+func renderJSON(contents string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(contents), "", "  "); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Lines up the columns of CSV records
+func renderCSV(contents string) (string, error) {
+	reader := csv.NewReader(strings.NewReader(contents))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	for _, record := range records {
+		fmt.Fprintln(w, strings.Join(record, "\t"))
+	}
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// Dumps bytes like `hexdump -C`
+func renderHex(contents string) (string, error) {
+	return hexDump([]byte(contents), 0), nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/bwent/in-memory-fs/imfs"
+	"net"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// What the sessions of a listener may do
+type sessionPolicy struct {
+	// Sessions can browse the tree but not change it (see Filesystem.ReadOnlyView)
+	readOnly bool
+	// If set, the only commands sessions may run, besides help and exit
+	commands map[string]bool
+	// Limits each session on its own, if a rate is set
+	rateLimit imfs.RateLimit
+	// Sessions may run the commands reading files on the host, e.g. fixture load. Off unless
+	// -serve-host-files is set, since anyone who can connect could otherwise read them
+	hostFiles bool
+}
+
+// An address to serve sessions on, and what they may do
+type replEndpoint struct {
+	address string
+	policy  sessionPolicy
+}
+
+// Parses a -serve-commands list, e.g. "ls,cd,pwd,readfile". Returns nil for an empty list.
+func parseCommandAllowlist(list string) (map[string]bool, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	commands := map[string]bool{}
+	for _, command := range strings.Split(list, ",") {
+		command = strings.ToLower(strings.TrimSpace(command))
+		if _, ok := ValidInputMap[command]; !ok {
+			return nil, fmt.Errorf("Unknown command %q", command)
+		}
+		commands[command] = true
+	}
+	return commands, nil
+}
+
+// Returns an error unless the policy allows the command, including the one run by time
+func (p sessionPolicy) check(inputs []string) error {
+	for len(inputs) > 0 {
+		method := strings.ToLower(strings.TrimSpace(inputs[0]))
+		if p.commands != nil && !p.commands[method] {
+			return fmt.Errorf("Command %s is not allowed in this session", method)
+		}
+		if !p.hostFiles && readsHostFiles(method, inputs[1:]) {
+			return fmt.Errorf("Command %s reads files on the host, which sessions may only do with -serve-host-files", method)
+		}
+		if method != "time" {
+			break
+		}
+		inputs = inputs[1:]
+	}
+	return nil
+}
+
+// Returns true if the command reads files on the host rather than in the tree
+func readsHostFiles(method string, params []string) bool {
+	return method == "fixture" && len(params) > 0 && strings.ToLower(strings.TrimSpace(params[0])) == "load"
+}
+
+// Listens on the address and serves the filesystem over 9P2000 in the background (see -serve-9p).
+// Addresses are parsed like -serve-repl's. Requests hold mu, like commands do.
+func serve9P(fs *imfs.Filesystem, address string, mu *sync.Mutex) error {
+	network := "tcp"
+	if strings.Contains(address, "/") {
+		network = "unix"
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Serving 9P on %s %s\n", network, listener.Addr())
+	go func() {
+		if err := fs.Serve9P(listener, mu); err != nil {
+			fmt.Println("Error serving 9P: ", err)
+		}
+	}()
+	return nil
+}
+
+// Serves REPL sessions to any number of clients sharing one filesystem (see -serve-repl)
+type replServer struct {
+	// Held while a command runs, since the filesystem isn't safe for concurrent use and commands
+	// print through the shared out and pager. Shared with the 9P server, if there is one
+	mu     *sync.Mutex
+	fs     *imfs.Filesystem
+	user   string
+	prompt *template.Template
+
+	// The open connections, closed when the server stops
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+}
+
+// Listens on every endpoint and serves a REPL session on each connection until ctx is cancelled
+// or a listener fails. Addresses containing a "/" are Unix socket paths; anything else is a TCP
+// address, e.g. "localhost:7070". Each session has its own current directory and directory stack,
+// but they all share the tree, so changes made in one are visible in the others right away.
+func serveREPL(ctx context.Context, fs *imfs.Filesystem, mu *sync.Mutex, endpoints []replEndpoint, user string, prompt *template.Template) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	listeners := make([]net.Listener, 0, len(endpoints))
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+	for _, endpoint := range endpoints {
+		network := "tcp"
+		if strings.Contains(endpoint.address, "/") {
+			network = "unix"
+		}
+		listener, err := net.Listen(network, endpoint.address)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, listener)
+		access := "full access"
+		if endpoint.policy.readOnly {
+			access = "read-only"
+		}
+		if endpoint.policy.commands != nil {
+			access += fmt.Sprintf(", %d commands", len(endpoint.policy.commands))
+		}
+		if limit := endpoint.policy.rateLimit; limit.OpsPerSecond > 0 || limit.BytesPerSecond > 0 {
+			access += fmt.Sprintf(", rate limited to %g ops/s and %g bytes/s", limit.OpsPerSecond, limit.BytesPerSecond)
+		}
+		fmt.Printf("Serving REPL sessions on %s %s (%s)\n", network, listener.Addr(), access)
+	}
+
+	server := &replServer{mu: mu, fs: fs, user: user, prompt: prompt, conns: map[net.Conn]struct{}{}}
+	var wg sync.WaitGroup
+	errs := make(chan error, len(listeners))
+	for i, listener := range listeners {
+		policy := endpoints[i].policy
+		wg.Add(1)
+		go func(listener net.Listener) {
+			defer wg.Done()
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					if ctx.Err() == nil {
+						errs <- err
+						cancel()
+					}
+					return
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					server.serve(conn, policy)
+				}()
+			}
+		}(listener)
+	}
+
+	<-ctx.Done()
+	for _, listener := range listeners {
+		listener.Close()
+	}
+	server.connsMu.Lock()
+	for conn := range server.conns {
+		conn.Close()
+	}
+	server.connsMu.Unlock()
+	wg.Wait()
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// Runs a session on the connection until the client exits or disconnects
+func (s *replServer) serve(conn net.Conn, policy sessionPolicy) {
+	s.connsMu.Lock()
+	s.conns[conn] = struct{}{}
+	s.connsMu.Unlock()
+	defer func() {
+		s.connsMu.Lock()
+		delete(s.conns, conn)
+		s.connsMu.Unlock()
+		conn.Close()
+	}()
+
+	// Sessions start where the server's filesystem is, e.g. in the -demo home directory
+	var session *imfs.Filesystem
+	s.locked(func() {
+		if policy.readOnly {
+			session = s.fs.ReadOnlyView()
+		} else {
+			session = s.fs.View()
+		}
+		session.Cd("~" + s.fs.Pwd())
+		if limit := policy.rateLimit; limit.OpsPerSecond > 0 || limit.BytesPerSecond > 0 {
+			session.Use(imfs.NewRateLimiter(limit))
+		}
+	})
+
+	reader := bufio.NewReader(conn)
+	for {
+		var cwd string
+		s.locked(func() { cwd = session.Pwd() })
+		if err := s.prompt.Execute(conn, PromptData{User: s.user, Cwd: cwd}); err != nil {
+			return
+		}
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		switch strings.TrimSpace(input) {
+		case "":
+			continue
+		case "exit":
+			fmt.Fprintln(conn, "Exiting")
+			return
+		case "help":
+			fmt.Fprintln(conn, HelpText)
+			continue
+		}
+		inputs := strings.Split(input, " ")
+		if err := policy.check(inputs); err != nil {
+			fmt.Fprintln(conn, err)
+			continue
+		}
+		if _, err := conn.Write(s.run(session, inputs)); err != nil {
+			return
+		}
+	}
+}
+
+// Runs a command in the session, returning its output. The output is buffered, so a slow client
+// doesn't hold up the others while the lock is held.
+func (s *replServer) run(session *imfs.Filesystem, inputs []string) []byte {
+	var buf bytes.Buffer
+	s.locked(func() {
+		// Listings aren't paged: the pager would wait for an answer while holding the lock
+		prevOut, prevPager := out, pager
+		out, pager = &buf, Pager{Out: &buf}
+		defer func() {
+			out, pager = prevOut, prevPager
+		}()
+		if err := parseUserInputs(session, inputs); err != nil {
+			fmt.Fprintln(&buf, err)
+		}
+	})
+	return buf.Bytes()
+}
+
+// Runs f while holding the lock
+func (s *replServer) locked(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f()
+}
@@ -0,0 +1,94 @@
+// serve_test.go
+package main
+
+import (
+	"bufio"
+	"context"
+	"github.com/bwent/in-memory-fs/imfs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// Serves REPL sessions on a Unix socket with the given policy, returning a client connected to it
+func startTestREPL(fs *imfs.Filesystem, policy sessionPolicy, t *testing.T) net.Conn {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	address := filepath.Join(t.TempDir(), "imfs.sock")
+	prompt := template.Must(template.New("prompt").Parse("> "))
+	done := make(chan error, 1)
+	go func() {
+		done <- serveREPL(ctx, fs, &sync.Mutex{}, []replEndpoint{{address: address, policy: policy}}, "test", prompt)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	var conn net.Conn
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if conn, err = net.Dial("unix", address); err == nil {
+			return conn
+		}
+	}
+	t.Fatalf("Expected to connect to the REPL but got %s", err)
+	return nil
+}
+
+// Sends a command to the session and returns its output, up to the next prompt. An empty command
+// only waits for the prompt.
+func runRemote(conn net.Conn, reader *bufio.Reader, command string, t *testing.T) string {
+	t.Helper()
+	if command != "" {
+		if _, err := conn.Write([]byte(command + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	output := ""
+	for !strings.HasSuffix(output, "> ") {
+		b, err := reader.ReadByte()
+		if err != nil {
+			t.Fatalf("Expected the output of %s but got %s", command, err)
+		}
+		output += string(b)
+	}
+	return strings.TrimSuffix(output, "> ")
+}
+
+func TestRemoteSessionsCannotReadHostFiles(t *testing.T) {
+	// A fixture on the host that would copy its contents into the tree
+	secret := filepath.Join(t.TempDir(), "secret.yaml")
+	if err := os.WriteFile(secret, []byte("entries:\n  - path: stolen\n    contents: secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := imfs.NewFileSystem()
+	conn := startTestREPL(fs, sessionPolicy{}, t)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	runRemote(conn, reader, "", t)
+
+	for _, command := range []string{"fixture load " + secret, "time fixture load " + secret, "FIXTURE LOAD " + secret} {
+		if output := runRemote(conn, reader, command, t); !strings.Contains(output, "-serve-host-files") {
+			t.Errorf("Expected %s to be refused but got %q", command, output)
+		}
+	}
+	if output := runRemote(conn, reader, "ls", t); strings.Contains(output, "stolen") {
+		t.Errorf("Expected nothing to be loaded from the host but got %q", output)
+	}
+	// Commands staying within the tree still work
+	if output := runRemote(conn, reader, "fixture dump", t); !strings.Contains(output, "entries") {
+		t.Errorf("Expected fixture dump to work but got %q", output)
+	}
+
+	// Unless the server allows it
+	if err := (sessionPolicy{hostFiles: true}).check([]string{"fixture", "load", secret}); err != nil {
+		t.Errorf("Expected fixture load to be allowed with -serve-host-files but got %s", err)
+	}
+}
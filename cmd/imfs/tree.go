@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/imfs"
+	"strconv"
+	"strings"
+)
+
+// Prints a directory and everything below it like `tree`, following symbolic links to
+// directories. Links leading back to a directory above them are marked rather than followed.
+func runTreeCommand(fs *imfs.Filesystem, params []string) error {
+	opts := imfs.TreeOptions{}
+	if len(params) >= 2 && params[0] == "-L" {
+		depth, err := strconv.Atoi(params[1])
+		if err != nil || depth < 1 {
+			return fmt.Errorf("Invalid depth %s: must be a positive number", params[1])
+		}
+		opts.MaxDepth = depth
+		params = params[2:]
+	}
+	if len(params) > 1 || (len(params) == 1 && strings.HasPrefix(params[0], "-")) {
+		return fmt.Errorf("tree takes an optional -L <depth> and path - run 'help' for guidance")
+	}
+	root := "."
+	if len(params) == 1 {
+		root = params[0]
+	}
+	entries, err := fs.Tree(root, opts)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return nil
+	}
+
+	fmt.Fprintln(out, root)
+	dirs, files := 0, 0
+	for i, entry := range entries {
+		// Draw the branches of the entry's ancestors that have siblings still to come, then its own
+		var line strings.Builder
+		for depth := 1; depth < entry.Depth; depth++ {
+			if hasLaterSibling(entries, i, depth) {
+				line.WriteString("│   ")
+			} else {
+				line.WriteString("    ")
+			}
+		}
+		if hasLaterSibling(entries, i, entry.Depth) {
+			line.WriteString("├── ")
+		} else {
+			line.WriteString("└── ")
+		}
+		line.WriteString(treeLabel(entry))
+		fmt.Fprintln(out, line.String())
+		if entry.IsDir {
+			dirs++
+		} else {
+			files++
+		}
+	}
+	fmt.Fprintf(out, "\n%d directories, %d files\n", dirs, files)
+	return nil
+}
+
+// Lists a directory and everything below it like `ls -R`: the directory's names, then a section
+// for each directory below it
+func runRecursiveLs(fs *imfs.Filesystem, root string) error {
+	entries, err := fs.Tree(root, imfs.TreeOptions{})
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return nil
+	}
+	if root == "" {
+		root = "."
+	}
+
+	// Sections are printed in the order their directories were listed
+	sections := []string{root}
+	names := map[string][]string{}
+	for _, entry := range entries {
+		parent := root
+		if dir := imfs.Dirname(entry.Path); dir != "." {
+			parent = root + "/" + dir
+		}
+		names[parent] = append(names[parent], treeLabel(entry))
+		if entry.IsDir && entry.Loop == "" {
+			path := root + "/" + entry.Path
+			sections = append(sections, path)
+			names[path] = []string{}
+		}
+	}
+	for i, section := range sections {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "%s:\n%s\n", section, strings.Join(names[section], " "))
+	}
+	return nil
+}
+
+// Describes an entry: its name, with the target of symbolic links and a marker for loops
+func treeLabel(entry imfs.TreeEntry) string {
+	label := entry.Entry.Name
+	if entry.Entry.Type == imfs.EntrySymlink {
+		label += " -> " + entry.Entry.Target
+	}
+	if entry.Loop != "" {
+		label += " [loop to " + entry.Loop + ", not followed]"
+	}
+	return label
+}
+
+// Returns true if an entry at the given depth follows entries[i] before the listing leaves the
+// directory containing it
+func hasLaterSibling(entries []imfs.TreeEntry, i int, depth int) bool {
+	for _, entry := range entries[i+1:] {
+		if entry.Depth < depth {
+			return false
+		}
+		if entry.Depth == depth {
+			return true
+		}
+	}
+	return false
+}
@@ -1,3 +1,3 @@
-module in-memory-fs
+module github.com/bwent/in-memory-fs
 
-go 1.20
+go 1.21
@@ -0,0 +1,56 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+	"sort"
+)
+
+// How often a single path was read from and written to
+type AccessStat struct {
+	Path         string
+	Reads        int
+	Writes       int
+	BytesRead    int
+	BytesWritten int
+}
+
+// Returns read/write counts and byte volumes for every path that has been accessed, hottest first
+// (by total number of reads and writes, then by path). Counts are kept per path, so a file that
+// is moved starts over under its new name.
+func (fs *Filesystem) AccessStats() []AccessStat {
+	stats := make([]AccessStat, 0, len(fs.accessStats))
+	for _, stat := range fs.accessStats {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i].Reads+stats[i].Writes, stats[j].Reads+stats[j].Writes
+		if a != b {
+			return a > b
+		}
+		return stats[i].Path < stats[j].Path
+	})
+	return stats
+}
+
+// Forgets all access statistics collected so far
+func (fs *Filesystem) ResetAccessStats() {
+	fs.accessStats = make(map[string]*AccessStat)
+}
+
+// Counts a read or write of n bytes on the file
+func (fs *Filesystem) countAccess(file *util.File, op Operation, n int) {
+	path := file.GetFullPathName(fs.root)
+	stat := fs.accessStats[path]
+	if stat == nil {
+		stat = &AccessStat{Path: path}
+		fs.accessStats[path] = stat
+	}
+	if op == OperationRead {
+		fs.recordAccess(file)
+		stat.Reads++
+		stat.BytesRead += n
+	} else {
+		stat.Writes++
+		stat.BytesWritten += n
+	}
+}
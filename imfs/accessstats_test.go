@@ -0,0 +1,52 @@
+// accessstats_test.go
+package imfs
+
+import (
+	"io"
+	"testing"
+)
+
+func TestAccessStats(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkFile("file1")
+	fs.MkFile("file2")
+
+	fs.WriteFile("file1", "hello")
+	fs.ReadFile("file1")
+	fs.ReadFile("file1")
+	fs.WriteFile("file2", "hi")
+
+	h, _ := fs.Open("file2")
+	h.Write([]byte("!!"))
+	io.ReadAll(h)
+	h.Close()
+
+	stats := fs.AccessStats()
+	expected := []AccessStat{
+		// ReadAll reads until EOF, which counts as a second read of 0 bytes
+		{Path: "/file2", Reads: 2, Writes: 2, BytesRead: 4, BytesWritten: 4},
+		{Path: "/file1", Reads: 2, Writes: 1, BytesRead: 10, BytesWritten: 5},
+	}
+	if len(stats) != len(expected) {
+		t.Fatalf("Expected %d entries but got %+v", len(expected), stats)
+	}
+	for i := range expected {
+		if stats[i] != expected[i] {
+			t.Errorf("Expected %+v but got %+v", expected[i], stats[i])
+		}
+	}
+
+	// Hotter files come first
+	for i := 0; i < 3; i++ {
+		fs.ReadFile("file1")
+	}
+	if stats = fs.AccessStats(); stats[0].Path != "/file1" {
+		t.Errorf("Expected /file1 to be the hottest file but got %+v", stats)
+	}
+
+	fs.ResetAccessStats()
+	if stats = fs.AccessStats(); len(stats) != 0 {
+		t.Errorf("Expected no stats after a reset but got %+v", stats)
+	}
+}
@@ -0,0 +1,131 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+	"path"
+	"sort"
+	"strings"
+)
+
+// How many of the largest files an Analysis lists
+const AnalyzeLargestCount int = 10
+
+// The files with one extension in an Analysis
+type ExtensionStats struct {
+	// Including the dot, e.g. ".go", or "" for files without one
+	Extension string
+	Files     int
+	Bytes     int
+}
+
+// A file and its size in an Analysis
+type FileSize struct {
+	Path string
+	Size int
+}
+
+// Statistics about the files in a subtree, as returned by Analyze. Only regular files are counted
+// as files; pipes, special nodes, symbolic links and virtual files are left out.
+type Analysis struct {
+	Files       int
+	Directories int
+	Bytes       int
+	// The mean size of the files, 0 if there are none
+	AverageSize float64
+	// Sorted by total size, largest first, then by extension
+	ByExtension []ExtensionStats
+	// The AnalyzeLargestCount largest files, largest first, then by path
+	Largest []FileSize
+	// The full path of the entry nested most deeply below the analyzed directory (the first one
+	// in name order if there are several), and how many levels below it that entry is
+	DeepestPath  string
+	DeepestLevel int
+}
+
+// Reports statistics about a subtree: how many files there are per extension and how large they
+// are, the largest files, the deepest path and the average file size. Useful for sanity-checking
+// large imported fixture sets. Symbolic links along the path are followed, but not those inside
+// the subtree.
+//
+// Parameters:
+//
+//	path (string) - the directory to analyze, relative to the current one or absolute (with "~")
+//
+// Returns:
+//
+//	Analysis - the statistics
+//	error - an error if the path doesn't exist
+func (fs *Filesystem) Analyze(path string) (Analysis, error) {
+	dir, err := fs.follow(path)
+	if err != nil {
+		return Analysis{}, err
+	}
+
+	analysis := Analysis{DeepestPath: fullPath(dir, fs.root)}
+	extensions := map[string]*ExtensionStats{}
+	largest := []FileSize{}
+	var visit func(f *util.File, level int)
+	visit = func(f *util.File, level int) {
+		if f.IsVirtual() {
+			return
+		}
+		if level > analysis.DeepestLevel {
+			analysis.DeepestPath, analysis.DeepestLevel = fullPath(f, fs.root), level
+		}
+		if f.IsDirectory() {
+			if f != dir {
+				analysis.Directories++
+			}
+			for _, child := range f.Children() {
+				visit(child, level+1)
+			}
+			return
+		}
+		if f.GetKind() != util.KindRegular {
+			return
+		}
+
+		size := len(f.GetContents())
+		analysis.Files++
+		analysis.Bytes += size
+		ext := extension(f.GetName())
+		if extensions[ext] == nil {
+			extensions[ext] = &ExtensionStats{Extension: ext}
+		}
+		extensions[ext].Files++
+		extensions[ext].Bytes += size
+		largest = append(largest, FileSize{Path: fullPath(f, fs.root), Size: size})
+	}
+	visit(dir, 0)
+
+	if analysis.Files > 0 {
+		analysis.AverageSize = float64(analysis.Bytes) / float64(analysis.Files)
+	}
+	for _, stats := range extensions {
+		analysis.ByExtension = append(analysis.ByExtension, *stats)
+	}
+	sort.Slice(analysis.ByExtension, func(i, j int) bool {
+		a, b := analysis.ByExtension[i], analysis.ByExtension[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Extension < b.Extension
+	})
+	sort.SliceStable(largest, func(i, j int) bool {
+		return largest[i].Size > largest[j].Size
+	})
+	if len(largest) > AnalyzeLargestCount {
+		largest = largest[:AnalyzeLargestCount]
+	}
+	analysis.Largest = largest
+	return analysis, nil
+}
+
+// Returns the extension of a file name, treating names like ".profile" as having none
+func extension(name string) string {
+	ext := path.Ext(name)
+	if ext == name || !strings.Contains(strings.TrimPrefix(name, "."), ".") {
+		return ""
+	}
+	return ext
+}
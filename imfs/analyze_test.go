@@ -0,0 +1,85 @@
+// analyze_test.go
+package imfs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	fs := NewFileSystem()
+	err := fs.LoadFixture(strings.NewReader(`entries:
+  - path: src/main.go
+    contents: "package main"
+  - path: src/util/util.go
+    contents: "package util"
+  - path: src/util/deep/nested/x.txt
+    contents: "x"
+  - path: docs/README.md
+    contents: "readme"
+  - path: docs/.profile
+    contents: "abc"
+  - path: docs/latest
+    target: README.md
+  - path: dev/null
+    type: "null"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.Symlink("~/src", "code")
+
+	analysis, err := fs.Analyze("code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Analysis{
+		Files:       3,
+		Directories: 3,
+		Bytes:       25,
+		AverageSize: 25.0 / 3,
+		ByExtension: []ExtensionStats{{".go", 2, 24}, {".txt", 1, 1}},
+		Largest: []FileSize{
+			{"/src/main.go", 12},
+			{"/src/util/util.go", 12},
+			{"/src/util/deep/nested/x.txt", 1},
+		},
+		DeepestPath:  "/src/util/deep/nested/x.txt",
+		DeepestLevel: 4,
+	}
+	if !reflect.DeepEqual(analysis, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, analysis)
+	}
+
+	analysis, _ = fs.Analyze("~/docs")
+	if analysis.Files != 2 || !reflect.DeepEqual(analysis.ByExtension, []ExtensionStats{{".md", 1, 6}, {"", 1, 3}}) {
+		t.Errorf("Expected dotfiles to have no extension and links to be skipped, got %+v", analysis)
+	}
+
+	analysis, _ = fs.Analyze("~/dev")
+	if analysis.Files != 0 || analysis.AverageSize != 0 || analysis.DeepestPath != "/dev/null" {
+		t.Errorf("Expected special nodes not to count as files, got %+v", analysis)
+	}
+
+	_, err = fs.Analyze("missing")
+	if err == nil {
+		t.Errorf("Expected an error for a missing path")
+	}
+}
+
+func TestAnalyzeLargestLimit(t *testing.T) {
+	fs := NewFileSystem()
+	for i := 0; i < AnalyzeLargestCount+5; i++ {
+		name := string(rune('a' + i))
+		fs.MkFile(name)
+		fs.WriteFile(name, strings.Repeat("x", i))
+	}
+	analysis, _ := fs.Analyze("~")
+	if len(analysis.Largest) != AnalyzeLargestCount || analysis.Largest[0].Path != "/o" || analysis.Largest[0].Size != 14 {
+		t.Errorf("Expected the %d largest files, got %+v", AnalyzeLargestCount, analysis.Largest)
+	}
+	if analysis.ByExtension[0].Extension != "" || analysis.DeepestLevel != 1 {
+		t.Errorf("Unexpected analysis %+v", analysis)
+	}
+}
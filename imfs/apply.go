@@ -0,0 +1,159 @@
+package imfs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+)
+
+// A single change for Apply, e.g. decoded from the JSON body of a request:
+//
+//	{"op": "write", "path": "/docs/a.txt", "data": "hello"}
+type Op struct {
+	// One of OperationMkDir, OperationMkFile, OperationWrite, OperationRm, OperationMv or
+	// OperationSymlink
+	Op Operation `json:"op"`
+	// The path to change, relative to the current directory or absolute
+	Path string `json:"path"`
+	// For OperationMv, the directory to move into; for OperationSymlink, the link's target
+	Target string `json:"target,omitempty"`
+	// For OperationWrite, the new contents, replacing any. The file is created if it doesn't exist
+	Data string `json:"data,omitempty"`
+	// For OperationRm, whether to remove directories along with everything in them
+	Recursive bool `json:"recursive,omitempty"`
+}
+
+// Applies a list of changes in order, all or nothing: they are first applied to a scratch copy of
+// the tree (see Validate), and only if every one succeeds are they applied to the filesystem.
+// Should one fail there anyway, e.g. because a Hook vetoes it, the tree is rolled back to how it
+// was before, the way Restore does, which closes open handles.
+//
+// Parameters:
+//
+//	ops ([]Op) - the changes to apply
+//
+// Returns:
+//
+//	error - an error naming the first change that failed, in which case nothing was changed.
+//	        ErrChrootView from a view, since views can't roll back
+func (fs *Filesystem) Apply(ops []Op) error {
+	defer fs.enter(OperationWrite, "")()
+	if fs.replica {
+		return ErrReadOnly
+	}
+	if fs.chrootParent != nil {
+		return ErrChrootView
+	}
+	if err := fs.Validate(ops); err != nil {
+		return err
+	}
+	saved := fs.root.Clone(nil)
+	if err := fs.applyOps(ops); err != nil {
+		fs.restoreTree(saved)
+		return err
+	}
+	return nil
+}
+
+// Checks a list of changes would apply, without changing anything: they are applied in order to a
+// scratch copy of the tree, which sees the effects of the earlier ones. Hooks aren't run.
+//
+// Parameters:
+//
+//	ops ([]Op) - the changes to check
+//
+// Returns:
+//
+//	error - an error naming the first change that would fail
+func (fs *Filesystem) Validate(ops []Op) error {
+	if fs.replica {
+		return ErrReadOnly
+	}
+	return fs.scratchCopy().applyOps(ops)
+}
+
+// Returns a filesystem with a copy of the tree and the same current directory, for trying out
+// changes. Options with side effects outside the tree are left out.
+func (fs *Filesystem) scratchCopy() *Filesystem {
+	opts := fs.opts
+	opts.Introspection = false
+	opts.WriteBack = false
+	opts.WriteBehind = false
+	opts.Strict = false
+	opts.Tracer = nil
+	opts.Logger = nil
+	scratch := NewFileSystemWithOptions(opts)
+	scratch.root = fs.root.Clone(nil)
+	scratch.currentDirectory = scratch.root
+	if cwd := util.LookupPath(scratch.root, fullPath(fs.currentDirectory, fs.root)); cwd != nil {
+		scratch.currentDirectory = cwd
+	}
+	return scratch
+}
+
+// Applies the changes in order, stopping at the first failure
+func (fs *Filesystem) applyOps(ops []Op) error {
+	for i, op := range ops {
+		if err := fs.applyOp(op); err != nil {
+			return fmt.Errorf("Operation %d (%s %s) failed: %w", i+1, op.Op, op.Path, err)
+		}
+	}
+	return nil
+}
+
+// Applies a single change
+func (fs *Filesystem) applyOp(op Op) error {
+	var err error
+	switch op.Op {
+	case OperationMkDir:
+		_, err = fs.MkDir(op.Path)
+	case OperationMkFile:
+		_, err = fs.MkFile(op.Path)
+	case OperationSymlink:
+		_, err = fs.Symlink(op.Target, op.Path)
+	case OperationWrite:
+		if _, statErr := fs.Stat(op.Path); errors.Is(statErr, ErrFileNotFound) {
+			if _, err = fs.MkFile(op.Path); err != nil {
+				return err
+			}
+		}
+		if err = fs.Truncate(op.Path, 0); err == nil && op.Data != "" {
+			_, err = fs.WriteFile(op.Path, op.Data)
+		}
+	case OperationRm:
+		err = fs.inParent(op.Path, func(name string) error {
+			_, err := fs.Rm(name, op.Recursive)
+			return err
+		})
+	case OperationMv:
+		target, targetErr := fs.follow(op.Target)
+		if targetErr != nil {
+			return targetErr
+		}
+		err = fs.inParent(op.Path, func(name string) error {
+			_, err := fs.MvFile(name, "~"+fullPath(target, fs.root))
+			return err
+		})
+	default:
+		err = fmt.Errorf("Unsupported operation: %s", op.Op)
+	}
+	return err
+}
+
+// Runs f from the directory containing path, with the name of its last element, for the
+// operations that only accept names within the current directory
+func (fs *Filesystem) inParent(path string, f func(name string) error) error {
+	parent, name, err := fs.resolveParent(path)
+	if err != nil {
+		return err
+	}
+	cwd := fs.currentDirectory
+	fs.currentDirectory = parent
+	err = f(name)
+	// Back to the root if the current directory was removed, as when removing it from anywhere else
+	fs.currentDirectory = fs.root
+	if fs.attached(cwd) {
+		fs.currentDirectory = cwd
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+// apply_test.go
+package imfs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("old")
+	fs.MkFile("~/old/a.txt")
+
+	// Changes apply in order, each seeing the earlier ones
+	err := fs.Apply([]Op{
+		{Op: OperationMkDir, Path: "docs"},
+		{Op: OperationWrite, Path: "~/docs/readme.md", Data: "hello"},
+		{Op: OperationMv, Path: "~/old/a.txt", Target: "docs"},
+		{Op: OperationSymlink, Path: "latest", Target: "docs/readme.md"},
+		{Op: OperationRm, Path: "old"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	res, err := fs.ReadFile("latest")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+	res, err = fs.Ls("~/docs")
+	assertMatchesAndNoErrors(res, err, "a.txt readme.md", t)
+
+	// Writes replace the contents
+	if err := fs.Apply([]Op{{Op: OperationWrite, Path: "~/docs/readme.md", Data: "bye"}}); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	res, err = fs.ReadFile("~/docs/readme.md")
+	assertMatchesAndNoErrors(res, err, "bye", t)
+
+	// Nothing is applied if any change fails, and Validate never changes anything
+	before := string(snapshotBytes(fs))
+	failing := []Op{
+		{Op: OperationMkDir, Path: "new"},
+		{Op: OperationRm, Path: "missing"},
+	}
+	if err := fs.Validate(failing); err == nil {
+		t.Errorf("Expected an error validating")
+	}
+	if err := fs.Apply(failing); err == nil {
+		t.Errorf("Expected an error applying")
+	}
+	if err := fs.Validate([]Op{{Op: OperationMkDir, Path: "new"}}); err != nil {
+		t.Errorf("Expected no errors but got %s", err)
+	}
+	assertMatchesAndNoErrors(string(snapshotBytes(fs)), nil, before, t)
+}
+
+func TestApplyRollsBack(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkFile("a.txt")
+	fs.Use(HookFuncs{BeforeFunc: func(event *OperationEvent) error {
+		if event.Op == OperationWrite && event.Path == "b.txt" {
+			return errors.New("vetoed")
+		}
+		return nil
+	}})
+
+	// A change failing despite validation undoes the earlier ones
+	err := fs.Apply([]Op{
+		{Op: OperationWrite, Path: "a.txt", Data: "changed"},
+		{Op: OperationWrite, Path: "b.txt", Data: "vetoed"},
+	})
+	if err == nil || err.Error() != "Operation 2 (write b.txt) failed: vetoed" {
+		t.Errorf("Expected the veto but got %v", err)
+	}
+	res, err := fs.ReadFile("a.txt")
+	assertMatchesAndNoErrors(res, err, "", t)
+	if _, err := fs.Stat("b.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected b.txt to be rolled back but got %v", err)
+	}
+}
@@ -0,0 +1,341 @@
+package imfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// An entry of an archive being mounted
+type archiveEntry struct {
+	// The cleaned path within the archive, e.g. "docs/readme.md"
+	name   string
+	isDir  bool
+	mode   os.FileMode
+	target string
+	// Opens the contents of a file (nil for directories and links)
+	open func() (io.ReadCloser, error)
+}
+
+// Mounts a zip or uncompressed tar archive as a new read-only directory at path, without
+// extracting it. Only the archive's index is read up front: each file's contents are read (and
+// decompressed) from r on its first read, then cached, so mounting a huge archive costs almost
+// nothing until its files are used. Writes to the files fail, but the directories can still be
+// changed like any other.
+//
+// The files are virtual (see RegisterVirtualFile), so they are left out of snapshots and don't
+// count against `Options.Capacity`, even once cached. A file that can't be read from the archive
+// (e.g. because it is corrupt) reads as empty. r must stay readable for as long as the mount is
+// used.
+//
+// Parameters:
+//
+//	path (string) - the directory to create; its parent must exist
+//	r (io.ReaderAt) - the archive
+//	size (int64) - the size of the archive in bytes
+//
+// Returns:
+//
+//	string - the name of the new directory
+//	error - an error if the path is taken, or the archive is malformed, compressed (for tar) or
+//	        has entries outside of its root
+func (fs *Filesystem) MountArchive(path string, r io.ReaderAt, size int64) (string, error) {
+	return fs.runHooks(&OperationEvent{Op: OperationMkDir, Path: path}, func() (string, error) {
+		if fs.replica {
+			return "", ErrReadOnly
+		}
+		parent, name, err := fs.resolveParent(path)
+		if err != nil {
+			return "", err
+		}
+		if name == "~" || name == ".." {
+			return "", fmt.Errorf("Invalid path: %s", path)
+		}
+		if parent.GetChildByName(name) != nil {
+			return "", fmt.Errorf("File %s already exists", path)
+		}
+
+		entries, err := readArchive(r, size)
+		if err != nil {
+			return "", err
+		}
+		// Build the tree detached, so nothing is added if an entry conflicts with another
+		mount := util.NewFile(name, true, parent)
+		for _, entry := range entries {
+			if err := addArchiveEntry(mount, entry, nil); err != nil {
+				return "", err
+			}
+		}
+
+		if fs.spaceLeft() < treeSize(mount) {
+			return "", ErrNoSpace
+		}
+		parent.UpsertChild(name, mount)
+		fs.recordArchiveTree(mount)
+		return name, nil
+	})
+}
+
+// Returns the estimated size of a detached tree, including its metadata overhead
+func treeSize(root *util.File) int {
+	size := 0
+	util.WalkTree(root, func(f *util.File) {
+		size += nodeSize(f)
+	})
+	return size
+}
+
+// Touches and journals every entry of a tree built from an archive, once it is attached
+func (fs *Filesystem) recordArchiveTree(root *util.File) {
+	util.WalkTree(root, func(f *util.File) {
+		fs.touch(f)
+		entry := JournalEntry{Op: OpMkFile, Path: f.GetFullPathName(fs.root)}
+		switch {
+		case f.IsDirectory():
+			entry.Op = OpMkDir
+		case f.GetKind() == util.KindSymlink:
+			entry.Op, entry.Target = OpSymlink, string(f.GetContents())
+		case !f.IsVirtual():
+			entry.Op, entry.Data = OpPut, f.GetContents()
+		}
+		fs.record(entry)
+	})
+}
+
+// Adds an entry below the mount's directory, creating the directories leading to it. Files read
+// their contents lazily unless room is set, in which case they are read right away into regular
+// files. Room holds how many more bytes may be extracted (-1 for no limit), and is decreased by
+// the contents read; an entry that doesn't fit fails with ErrNoSpace.
+func addArchiveEntry(mount *util.File, entry archiveEntry, room *int) error {
+	parts := strings.Split(entry.name, "/")
+	dir := mount
+	for i, part := range parts[:len(parts)-1] {
+		child := dir.GetChildByName(part)
+		if child == nil {
+			child = util.NewFile(part, true, dir)
+			dir.UpsertChild(part, child)
+		} else if !child.IsDirectory() {
+			return fmt.Errorf("Invalid archive: %s is both a file and a directory", strings.Join(parts[:i+1], "/"))
+		}
+		dir = child
+	}
+
+	name := parts[len(parts)-1]
+	existing := dir.GetChildByName(name)
+	if entry.isDir {
+		if existing == nil {
+			existing = util.NewFile(name, true, dir)
+			dir.UpsertChild(name, existing)
+		} else if !existing.IsDirectory() {
+			return fmt.Errorf("Invalid archive: %s is both a file and a directory", entry.name)
+		}
+		if perm := entry.mode.Perm(); perm != 0 {
+			existing.SetMode(perm)
+		}
+		return nil
+	}
+	if existing != nil {
+		return fmt.Errorf("Invalid archive: more than one entry at %s", entry.name)
+	}
+
+	file := util.NewFile(name, false, dir)
+	if perm := entry.mode.Perm(); perm != 0 {
+		file.SetMode(perm)
+	}
+	switch {
+	case entry.open == nil:
+		file.SetKind(util.KindSymlink)
+		file.SetContents([]byte(entry.target))
+	case room != nil:
+		data, err := readArchiveEntry(entry.open, *room)
+		if errors.Is(err, ErrNoSpace) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid archive: %s: %s", entry.name, err)
+		}
+		if *room >= 0 {
+			*room -= len(data)
+		}
+		if err := file.SetContents(data); err != nil {
+			return err
+		}
+	default:
+		file.SetVirtual(lazyArchiveContents(entry.open), nil)
+	}
+	dir.UpsertChild(name, file)
+	return nil
+}
+
+// Returns a generator reading the contents on its first call and returning the cached copy after
+func lazyArchiveContents(open func() (io.ReadCloser, error)) func() []byte {
+	var once sync.Once
+	var contents []byte
+	return func() []byte {
+		once.Do(func() {
+			if data, err := readArchiveEntry(open, -1); err == nil {
+				contents = data
+			}
+		})
+		return contents
+	}
+}
+
+// Reads the whole contents of an archive entry, failing with ErrNoSpace as soon as they turn out
+// to be longer than limit, unless limit is negative. Compressed entries are only decompressed up
+// to the limit, whatever size the archive claims.
+func readArchiveEntry(open func() (io.ReadCloser, error), limit int) ([]byte, error) {
+	rc, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if limit < 0 {
+		return io.ReadAll(rc)
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, int64(limit)+1))
+	if err == nil && len(data) > limit {
+		return nil, ErrNoSpace
+	}
+	return data, err
+}
+
+// Reads the index of a zip or tar archive, sorted by name
+func readArchive(r io.ReaderAt, size int64) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	zr, err := zip.NewReader(r, size)
+	switch {
+	case err == nil:
+		entries, err = zipEntries(zr)
+	case errors.Is(err, zip.ErrFormat):
+		entries, err = tarEntries(r, size)
+	default:
+		err = fmt.Errorf("Invalid archive: %s", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
+
+// Lists the entries of a zip archive
+func zipEntries(zr *zip.Reader) ([]archiveEntry, error) {
+	entries := []archiveEntry{}
+	for _, f := range zr.File {
+		name, err := archivePath(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			continue
+		}
+		entry := archiveEntry{name: name, mode: f.Mode(), isDir: f.FileInfo().IsDir()}
+		switch {
+		case entry.isDir:
+		case f.Mode()&os.ModeSymlink != 0:
+			// Links are tiny, so their targets are read right away
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("Invalid archive: %s: %s", f.Name, err)
+			}
+			target, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("Invalid archive: %s: %s", f.Name, err)
+			}
+			entry.target = string(target)
+		default:
+			entry.open = f.Open
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Lists the entries of an uncompressed tar archive. Only the headers are read: the contents are
+// skipped by seeking, and each file remembers where its contents start.
+func tarEntries(r io.ReaderAt, size int64) ([]archiveEntry, error) {
+	magic := make([]byte, 2)
+	if n, _ := r.ReadAt(magic, 0); n == 2 && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return nil, errors.New("Compressed tar archives can't be mounted, since they can't be read at random; decompress it first")
+	}
+
+	section := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(section)
+	entries := []archiveEntry{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if len(entries) == 0 {
+				return nil, errors.New("Invalid archive: not a zip or tar archive")
+			}
+			return nil, fmt.Errorf("Invalid archive: %s", err)
+		}
+		name, err := archivePath(header.Name)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			continue
+		}
+		entry := archiveEntry{name: name, mode: header.FileInfo().Mode()}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			entry.isDir = true
+		case tar.TypeSymlink:
+			entry.target = header.Linkname
+		case tar.TypeReg, tar.TypeGNUSparse:
+			if isSparse(header) {
+				return nil, fmt.Errorf("Invalid archive: sparse file %s is not supported", header.Name)
+			}
+			offset, _ := section.Seek(0, io.SeekCurrent)
+			length := header.Size
+			entry.open = func() (io.ReadCloser, error) {
+				return io.NopCloser(io.NewSectionReader(r, offset, length)), nil
+			}
+		default:
+			// Hard links, devices and the like have no equivalent
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Returns true if the tar entry is a sparse file, whose contents aren't stored in one piece
+func isSparse(header *tar.Header) bool {
+	if header.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range header.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// Cleans the path of an archive entry, rejecting paths that escape the archive's root. Returns ""
+// for the root itself.
+func archivePath(name string) (string, error) {
+	slashed := strings.ReplaceAll(name, "\\", "/")
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("Invalid archive: entry %s is outside of the archive", name)
+		}
+	}
+	return strings.TrimPrefix(path.Clean("/"+slashed), "/"), nil
+}
@@ -0,0 +1,123 @@
+// archive_test.go
+package imfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Counts the bytes read through it, to tell whether contents were read
+type countingReaderAt struct {
+	r    io.ReaderAt
+	read int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.read += n
+	return n, err
+}
+
+func TestMountZipArchive(t *testing.T) {
+	// Set up test subject
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.Create("docs/")
+	w, _ := zw.Create("docs/guide/intro.md")
+	w.Write([]byte("# Intro"))
+	w, _ = zw.Create("big.txt")
+	w.Write([]byte(strings.Repeat("all work and no play ", 100000)))
+	zw.Close()
+	fs := NewFileSystem()
+
+	archive := &countingReaderAt{r: bytes.NewReader(buf.Bytes())}
+	res, err := fs.MountArchive("mnt", archive, int64(buf.Len()))
+	assertMatchesAndNoErrors(res, err, "mnt", t)
+
+	// Only the index is read until a file is
+	if archive.read >= buf.Len() {
+		t.Errorf("Expected mounting to read less than the whole archive, read %d of %d bytes", archive.read, buf.Len())
+	}
+	res, err = fs.Ls("mnt/docs/guide")
+	assertMatchesAndNoErrors(res, err, "intro.md", t)
+	fs.Cd("mnt/docs/guide")
+	res, err = fs.ReadFile("intro.md")
+	assertMatchesAndNoErrors(res, err, "# Intro", t)
+
+	// Contents are cached after the first read
+	fs.Cd("~/mnt")
+	fs.ReadFile("big.txt")
+	read := archive.read
+	contents, err := fs.Bytes("big.txt")
+	if err != nil || len(contents) != 2100000 || archive.read != read {
+		t.Errorf("Expected the cached contents without reading the archive again")
+	}
+
+	// Files are read-only, and the mount path can't be reused
+	if _, err := fs.WriteFile("big.txt", "more"); err == nil || err.Error() != "Virtual file big.txt is read-only" {
+		t.Errorf("Expected a read-only error but got %v", err)
+	}
+	res, err = fs.MountArchive("~/mnt", archive, int64(buf.Len()))
+	assertErrorAndEmptyResult(res, err, "File ~/mnt already exists", t)
+}
+
+func TestMountTarArchive(t *testing.T) {
+	// Set up test subject
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "src/", Typeflag: tar.TypeDir, Mode: 0700})
+	tw.WriteHeader(&tar.Header{Name: "src/main.go", Typeflag: tar.TypeReg, Mode: 0644, Size: 12})
+	tw.Write([]byte("package main"))
+	tw.WriteHeader(&tar.Header{Name: "main", Typeflag: tar.TypeSymlink, Linkname: "src/main.go"})
+	tw.Close()
+	fs := NewFileSystem()
+
+	res, err := fs.MountArchive("mnt", bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assertMatchesAndNoErrors(res, err, "mnt", t)
+	fs.Cd("mnt")
+	contents, err := fs.Bytes("main")
+	assertMatchesAndNoErrors(string(contents), err, "package main", t)
+	res, err = fs.Readlink("main")
+	assertMatchesAndNoErrors(res, err, "src/main.go", t)
+	if mode := fs.root.GetChildByName("mnt").GetChildByName("src").GetMode(); mode != 0700 {
+		t.Errorf("Expected the directory mode from the archive but got %o", mode)
+	}
+}
+
+func TestMountArchiveErrors(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	mount := func(data []byte) error {
+		_, err := fs.MountArchive("mnt", bytes.NewReader(data), int64(len(data)))
+		return err
+	}
+
+	// Compressed tars can't be mounted, and neither can anything else
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tar.NewWriter(gz).Close()
+	gz.Close()
+	if err := mount(buf.Bytes()); err == nil || !strings.HasPrefix(err.Error(), "Compressed tar archives can't be mounted") {
+		t.Errorf("Expected a compressed tar error but got %v", err)
+	}
+	if err := mount([]byte("not an archive")); err == nil || err.Error() != "Invalid archive: not a zip or tar archive" {
+		t.Errorf("Expected an invalid archive error but got %v", err)
+	}
+
+	// Entries escaping the archive are rejected, and nothing is mounted
+	buf.Reset()
+	zw := zip.NewWriter(&buf)
+	zw.Create("ok.txt")
+	zw.Create("../escape.txt")
+	zw.Close()
+	if err := mount(buf.Bytes()); err == nil || err.Error() != "Invalid archive: entry ../escape.txt is outside of the archive" {
+		t.Errorf("Expected an escaping entry error but got %v", err)
+	}
+	res, err := fs.Ls()
+	assertMatchesAndNoErrors(res, err, "", t)
+}
@@ -0,0 +1,44 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+	"time"
+)
+
+// When reading a file records its access time (see Options.Atime)
+type AtimeMode int
+
+const (
+	// Reads never record the access time, like mounting with noatime, so they cost nothing extra
+	AtimeNever AtimeMode = iota
+	// Reads record the access time only if it isn't after the modification time, or is a day old,
+	// like Linux's default relatime: enough to tell whether a file was read since it last changed
+	AtimeRelatime
+	// Every read records the access time, like mounting with strictatime
+	AtimeAlways
+)
+
+// How stale an access time gets before a read records it anew with AtimeRelatime
+const relatimeInterval = 24 * time.Hour
+
+// Records that the file's contents were just read, according to Options.Atime. Access times
+// aren't journaled, and don't start a new generation of the file. Nothing is recorded on a frozen
+// filesystem, whose nodes are shared by views read from other goroutines.
+func (fs *Filesystem) recordAccess(file *util.File) {
+	if fs.frozen {
+		return
+	}
+	switch fs.opts.Atime {
+	case AtimeNever:
+		return
+	case AtimeRelatime:
+		now := fs.now()
+		accessed := file.GetAccessTime()
+		if accessed.After(file.GetModTime()) && now.Sub(accessed) < relatimeInterval {
+			return
+		}
+		file.SetAccessTime(now)
+	case AtimeAlways:
+		file.SetAccessTime(fs.now())
+	}
+}
@@ -0,0 +1,103 @@
+// atime_test.go
+package imfs
+
+import (
+	"testing"
+	"time"
+)
+
+// Returns a filesystem with the given atime mode on a fake clock, and a file written at the start
+func newAtimeFilesystem(mode AtimeMode, now *time.Time) *Filesystem {
+	fs := NewFileSystemWithOptions(Options{Atime: mode, Now: func() time.Time { return *now }})
+	fs.MkFile("file")
+	fs.WriteFile("file", "hello")
+	return fs
+}
+
+// Returns the access time of a file, failing the test if it can't be read
+func accessTime(fs *Filesystem, path string, t *testing.T) time.Time {
+	entry, err := fs.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry.AccessTime
+}
+
+func TestAtimeNever(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := start
+	fs := newAtimeFilesystem(AtimeNever, &now)
+
+	now = now.Add(time.Hour)
+	fs.ReadFile("file")
+	if accessed := accessTime(fs, "file", t); !accessed.Equal(start) {
+		t.Errorf("Expected the access time to stay at %v, got %v", start, accessed)
+	}
+}
+
+func TestAtimeAlways(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fs := newAtimeFilesystem(AtimeAlways, &now)
+
+	// Every kind of read records it
+	for _, read := range []func(){
+		func() { fs.ReadFile("file") },
+		func() { fs.Bytes("file") },
+		func() {
+			h, _ := fs.Open("file")
+			h.Read(make([]byte, 2))
+			h.Close()
+		},
+	} {
+		now = now.Add(time.Minute)
+		read()
+		if accessed := accessTime(fs, "file", t); !accessed.Equal(now) {
+			t.Errorf("Expected the access time %v, got %v", now, accessed)
+		}
+	}
+
+	// Writes and Stat don't
+	written := now
+	now = now.Add(time.Minute)
+	fs.WriteFile("file", "!")
+	fs.Stat("file")
+	if accessed := accessTime(fs, "file", t); !accessed.Equal(written) {
+		t.Errorf("Expected the access time to stay at %v, got %v", written, accessed)
+	}
+}
+
+func TestAtimeRelatime(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := start
+	fs := newAtimeFilesystem(AtimeRelatime, &now)
+
+	// The first read after a change records it
+	now = now.Add(time.Minute)
+	first := now
+	fs.ReadFile("file")
+	if accessed := accessTime(fs, "file", t); !accessed.Equal(first) {
+		t.Errorf("Expected the access time %v, got %v", first, accessed)
+	}
+
+	// Later reads don't, until the file changes again
+	now = now.Add(time.Hour)
+	fs.ReadFile("file")
+	if accessed := accessTime(fs, "file", t); !accessed.Equal(first) {
+		t.Errorf("Expected the access time to stay at %v, got %v", first, accessed)
+	}
+	now = now.Add(time.Minute)
+	fs.WriteFile("file", "!")
+	now = now.Add(time.Minute)
+	fs.ReadFile("file")
+	if accessed := accessTime(fs, "file", t); !accessed.Equal(now) {
+		t.Errorf("Expected the access time %v after a change, got %v", now, accessed)
+	}
+
+	// Or the access time is a day old
+	changed := now
+	now = now.Add(relatimeInterval)
+	fs.ReadFile("file")
+	if accessed := accessTime(fs, "file", t); !accessed.Equal(now) || accessed.Equal(changed) {
+		t.Errorf("Expected the access time %v after a day, got %v", now, accessed)
+	}
+}
@@ -0,0 +1,187 @@
+package imfs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Periodically saves the tree to a file on the real disk (see EnableAutosave)
+type autosaver struct {
+	// Held by every operation while autosave is enabled, and by the background goroutine while it
+	// takes a snapshot, since the filesystem isn't otherwise safe for concurrent use
+	mu sync.Mutex
+	// How deeply operations are nested on the goroutine using the filesystem, so nested
+	// operations don't lock mu again. Only ever touched by that goroutine
+	depth int
+
+	path string
+	// The generation saved last, so an unchanged tree isn't written again
+	saved    uint64
+	hasSaved bool
+	// The first error saving since the last call to AutosaveErr
+	err  error
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Starts saving a snapshot of the filesystem to a file on the real disk every interval, so the
+// tree survives a crash of the process: restore it with LoadSnapshot. A snapshot is only written
+// if something changed since the last one. Each snapshot is written to a temporary file next to
+// path and then renamed over it, so the file always holds a complete snapshot, even if the process
+// dies while saving.
+//
+// Saving runs on a background goroutine, which waits for any running operation to finish before
+// taking the snapshot. The filesystem must still only be used by one goroutine at a time. Writes
+// not yet applied in write-behind mode, or not yet flushed from a handle, aren't saved.
+//
+// A first snapshot is saved right away. Enabling autosave again replaces the previous path and
+// interval.
+//
+// Parameters:
+//
+//	path (string) - the file to save to on the real disk
+//	interval (time.Duration) - how often to save
+//
+// Returns:
+//
+//	error - an error if the interval isn't positive or the first snapshot can't be saved
+func (fs *Filesystem) EnableAutosave(path string, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("Autosave interval must be positive")
+	}
+	storage := fs.storage()
+	storage.DisableAutosave()
+
+	a := &autosaver{path: path, stop: make(chan struct{}), done: make(chan struct{})}
+	if err := storage.autosaveOnce(a); err != nil {
+		return err
+	}
+	storage.autosave = a
+	go func() {
+		defer close(a.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := storage.autosaveOnce(a); err != nil {
+					a.mu.Lock()
+					if a.err == nil {
+						a.err = err
+					}
+					a.mu.Unlock()
+				}
+			case <-a.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stops autosaving, saving a last snapshot if anything changed since the previous one. Does
+// nothing if autosave isn't enabled.
+//
+// Returns:
+//
+//	error - an error if the last snapshot can't be saved, or else the first error saving in the
+//	        background since AutosaveErr was last called
+func (fs *Filesystem) DisableAutosave() error {
+	storage := fs.storage()
+	a := storage.autosave
+	if a == nil {
+		return nil
+	}
+	close(a.stop)
+	<-a.done
+	storage.autosave = nil
+	err := storage.autosaveOnce(a)
+	if a.err != nil {
+		err = a.err
+	}
+	return err
+}
+
+// Returns the first error saving in the background since the last call, and clears it. Returns
+// nil if autosave isn't enabled.
+func (fs *Filesystem) AutosaveErr() error {
+	a := fs.storage().autosave
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err := a.err
+	a.err = nil
+	return err
+}
+
+// Saves a snapshot if the tree changed since the last one. The snapshot is taken while holding
+// the lock, but written to disk after releasing it, so operations only wait for the encoding.
+func (fs *Filesystem) autosaveOnce(a *autosaver) error {
+	a.mu.Lock()
+	if a.hasSaved && a.saved == fs.generation {
+		a.mu.Unlock()
+		return nil
+	}
+	var buf bytes.Buffer
+	err := fs.SaveSnapshot(&buf, FormatBinaryGzip)
+	generation := fs.generation
+	a.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomically(a.path, buf.Bytes()); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.saved, a.hasSaved = generation, true
+	a.mu.Unlock()
+	return nil
+}
+
+// Holds the autosave lock for the duration of an operation, if autosave is enabled. Returns the
+// function releasing it.
+func (fs *Filesystem) lockAutosave() func() {
+	a := fs.storage().autosave
+	if a == nil {
+		return func() {}
+	}
+	if a.depth > 0 {
+		a.depth++
+		return func() { a.depth-- }
+	}
+	a.mu.Lock()
+	a.depth = 1
+	return func() {
+		a.depth = 0
+		a.mu.Unlock()
+	}
+}
+
+// Writes data to a temporary file in the same directory as path, then renames it over path, so
+// path never holds a partial write
+func writeFileAtomically(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
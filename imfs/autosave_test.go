@@ -0,0 +1,138 @@
+// autosave_test.go
+package imfs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAutosave(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkFile("file1")
+	path := filepath.Join(t.TempDir(), "fs.snapshot")
+
+	if err := fs.EnableAutosave(path, 0); err == nil {
+		t.Errorf("Expected an error for a zero interval")
+	}
+
+	// A first snapshot is saved right away
+	if err := fs.EnableAutosave(path, 10*time.Millisecond); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	loaded := loadAutosave(path, t)
+	res, err := loaded.Ls()
+	assertMatchesAndNoErrors(res, err, "file1", t)
+
+	// Changes are saved in the background
+	fs.MkFile("file2")
+	fs.WriteFile("file2", "hello")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		if bytes.Equal(snapshotBytes(loadAutosave(path, t)), snapshotBytes(fs)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the change to be saved within 5s, got a %d byte snapshot", len(data))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Disabling saves the last changes, and leaves no temporary files behind
+	fs.MkDir("dir1")
+	if err := fs.DisableAutosave(); err != nil {
+		t.Errorf("Expected no errors but got %s", err)
+	}
+	if !bytes.Equal(snapshotBytes(loadAutosave(path, t)), snapshotBytes(fs)) {
+		t.Errorf("Expected the last changes to be saved when disabling autosave")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected only the snapshot in the directory but got %d entries", len(entries))
+	}
+	if err := fs.DisableAutosave(); err != nil {
+		t.Errorf("Expected disabling twice to do nothing but got %s", err)
+	}
+
+	// Unwritable paths are reported
+	if err := fs.EnableAutosave(filepath.Join(path, "nested"), time.Second); err == nil {
+		t.Errorf("Expected an error saving under a file")
+	}
+}
+
+// Loads the snapshot saved at path into a new filesystem
+func loadAutosave(path string, t *testing.T) *Filesystem {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Expected no errors opening the snapshot but got %s", err)
+	}
+	defer f.Close()
+	fs := NewFileSystem()
+	if err := fs.LoadSnapshot(f); err != nil {
+		t.Fatalf("Expected no errors loading the snapshot but got %s", err)
+	}
+	return fs
+}
+
+// Run with -race: replacing the tree through Restore or LoadFixture while snapshots are saved in
+// the background must wait for the save, like any other operation
+func TestAutosaveWhileRestoring(t *testing.T) {
+	fs := NewFileSystemWithOptions(Options{Strict: true})
+	fs.MkFile("file1")
+	fs.Checkpoint("start")
+	path := filepath.Join(t.TempDir(), "fs.snapshot")
+	if err := fs.EnableAutosave(path, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		fs.MkFile("file2")
+		if err := fs.LoadFixture(strings.NewReader("entries:\n  - path: dir/file3\n    contents: hello\n")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fs.Restore("start"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond / 10)
+	}
+	if err := fs.DisableAutosave(); err != nil {
+		t.Fatal(err)
+	}
+	res, err := loadAutosave(path, t).Ls()
+	assertMatchesAndNoErrors(res, err, "file1", t)
+}
+
+// Flushing handles changes the tree too, so it holds off the background save like other writes
+func TestAutosaveWhileFlushing(t *testing.T) {
+	fs := NewFileSystemWithOptions(Options{BufferedWrites: true})
+	fs.MkFile("file1")
+	path := filepath.Join(t.TempDir(), "fs.snapshot")
+	if err := fs.EnableAutosave(path, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// Many handles with buffered writes flushed one after the other, so flushes aren't ordered with
+	// the save by other operations taking the lock in between
+	handles := []*FileHandle{}
+	for i := 0; i < 1000; i++ {
+		h, _ := fs.Open("file1")
+		h.Write([]byte("a"))
+		handles = append(handles, h)
+	}
+	for _, h := range handles {
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Microsecond)
+	}
+	if err := fs.DisableAutosave(); err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := fs.ReadFile("file1")
+	res, err := loadAutosave(path, t).ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, expected, t)
+}
@@ -0,0 +1,62 @@
+package imfs
+
+import (
+	"errors"
+	"github.com/bwent/in-memory-fs/internal/util"
+	iofs "io/fs"
+	"path"
+)
+
+// Loads the entry called name in dir from `Options.Backing` when the tree doesn't have it, adding
+// it to the tree so later lookups find it there. Directories are added empty and fill up as
+// their entries are looked up; files are added with their contents.
+//
+// Returns nil, without an error, if there is no backing store or it has no such entry either.
+func (fs *Filesystem) loadFromBacking(dir *util.File, name string) (*util.File, error) {
+	backing := fs.opts.Backing
+	if backing == nil || fs.replica || name == "" {
+		return nil, nil
+	}
+	// Views look up the same paths in the backing store as the filesystem they are a view of
+	backingPath := path.Join(fullPath(dir, fs.storage().root)[1:], name)
+	if !iofs.ValidPath(backingPath) {
+		return nil, nil
+	}
+	info, err := iofs.Stat(backing, backingPath)
+	if errors.Is(err, iofs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.reserveNode(name); err != nil {
+		return nil, err
+	}
+
+	// What is loaded is already in the backing store, so it isn't written back
+	storage := fs.storage()
+	storage.loadingBacking = true
+	defer func() { storage.loadingBacking = false }()
+
+	file := util.NewFile(name, info.IsDir(), dir)
+	if info.IsDir() {
+		dir.UpsertChild(name, file)
+		fs.touch(file)
+		file.SetModTime(info.ModTime())
+		fs.record(JournalEntry{Op: OpMkDir, Path: fullPath(file, fs.root)})
+		return file, nil
+	}
+	data, err := iofs.ReadFile(backing, backingPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.SetContents(data); err != nil {
+		return nil, err
+	}
+	dir.UpsertChild(name, file)
+	fs.touch(file)
+	file.SetModTime(info.ModTime())
+	storage.rememberBacking(fullPath(file, storage.root), data)
+	fs.record(JournalEntry{Op: OpPut, Path: fullPath(file, fs.root), Data: data})
+	return file, nil
+}
@@ -0,0 +1,59 @@
+// backing_test.go
+package imfs
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestBacking(t *testing.T) {
+	// Set up test subject
+	backing := fstest.MapFS{
+		"docs/a.txt":  {Data: []byte("hello")},
+		"docs/b.txt":  {Data: []byte("world")},
+		"other/c.txt": {Data: []byte("!")},
+	}
+	fs := NewFileSystemWithOptions(Options{Backing: backing})
+
+	// Misses are loaded from the backing store, and only what was looked up is in the tree
+	res, err := fs.ReadFile("~/docs/a.txt")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+	res, err = fs.Ls("~")
+	assertMatchesAndNoErrors(res, err, "docs", t)
+	res, err = fs.Ls("~/docs")
+	assertMatchesAndNoErrors(res, err, "a.txt", t)
+
+	// Later reads hit the tree, and writes never reach the backing store
+	backing["docs/a.txt"] = &fstest.MapFile{Data: []byte("changed")}
+	res, err = fs.ReadFile("~/docs/a.txt")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+	fs.WriteFile("~/docs/b.txt", "!")
+	res, err = fs.ReadFile("~/docs/b.txt")
+	assertMatchesAndNoErrors(res, err, "world!", t)
+	if string(backing["docs/b.txt"].Data) != "world" {
+		t.Errorf("Expected the backing store to be left alone but got %q", backing["docs/b.txt"].Data)
+	}
+
+	// Removing a node evicts it, so it is loaded again
+	fs.Cd("~/docs")
+	fs.Rm("a.txt", false)
+	res, err = fs.ReadFile("a.txt")
+	assertMatchesAndNoErrors(res, err, "changed", t)
+
+	// Paths missing from both still fail
+	res, err = fs.ReadFile("~/docs/missing.txt")
+	if !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound but got %v", err)
+	}
+	assertMatchesAndNoErrors(res, nil, "", t)
+
+	// Loaded nodes are journaled, so replicas see them
+	replica := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertMatchesAndNoErrors(string(snapshotBytes(replica)), nil, string(snapshotBytes(fs)), t)
+}
@@ -0,0 +1,161 @@
+package imfs
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+)
+
+// Builds a tree fluently, e.g. for test fixtures:
+//
+//	b := imfs.NewBuilder(imfs.Options{})
+//	b.Dir("src").File("main.go", "package main").File("go.mod", "module example")
+//	b.Dir("docs/img").Symlink("latest", "v2")
+//	fs, err := b.Freeze()
+//
+// Dir returns a builder for the new directory, so calls can be chained to fill it in, while File
+// and Symlink return the same builder to add siblings. Names may contain "/" to create nested
+// directories on the way. The first error (e.g. a file where a directory is needed) is reported
+// by Freeze.
+type Builder struct {
+	state *builderState
+	dir   *util.File
+}
+
+// Shared by a builder and the builders of every directory in its tree
+type builderState struct {
+	root *util.File
+	opts Options
+	err  error
+}
+
+// Creates a builder for an empty tree
+//
+// Parameters:
+//
+//	opts (Options) - the options of the filesystems returned by Freeze
+func NewBuilder(opts Options) *Builder {
+	root := newRoot(opts)
+	return &Builder{state: &builderState{root: root, opts: opts}, dir: root}
+}
+
+// Adds a directory (and any missing parents) and returns a builder for it. Adding a directory
+// that already exists returns a builder for the existing one.
+func (b *Builder) Dir(name string) *Builder {
+	dir := b.mkdirs(util.SplitPath(name))
+	if dir == nil {
+		return b
+	}
+	return &Builder{state: b.state, dir: dir}
+}
+
+// Adds a file with the given contents, replacing any file with that name
+func (b *Builder) File(name string, contents string) *Builder {
+	parent, leaf := b.parentOf(name)
+	if parent == nil {
+		return b
+	}
+	file := util.NewFile(leaf, false, parent)
+	if err := file.SetContents([]byte(contents)); err != nil {
+		b.fail(err)
+		return b
+	}
+	b.add(parent, leaf, file)
+	return b
+}
+
+// Adds a symbolic link pointing at target, replacing any file with that name
+func (b *Builder) Symlink(name string, target string) *Builder {
+	parent, leaf := b.parentOf(name)
+	if parent == nil {
+		return b
+	}
+	b.add(parent, leaf, util.NewSymlink(leaf, target, parent).File())
+	return b
+}
+
+// Returns an immutable filesystem containing the tree built so far. The builder can still be
+// used afterwards, e.g. to freeze variations of a fixture; the filesystems it already returned
+// don't change.
+//
+// Every modification of a frozen filesystem fails with ErrReadOnly, and its tree is never written
+// to, not even by reads (identical contents are shared, content types are detected up front and
+// access times aren't recorded, whatever Options.Atime says).
+// It can therefore be shared between goroutines, e.g. parallel tests, without any locking: each
+// goroutine should read through its own View, which keeps its own current directory, handles and
+// statistics.
+//
+// Returns:
+//
+//	*Filesystem - the frozen filesystem
+//	error - the first error that occurred while building
+func (b *Builder) Freeze() (*Filesystem, error) {
+	if b.state.err != nil {
+		return nil, b.state.err
+	}
+
+	fs := NewFileSystemWithOptions(b.state.opts)
+	fs.root = b.state.root.Clone(nil)
+	fs.currentDirectory = fs.root
+	if fs.opts.Introspection {
+		fs.mountIntrospection()
+	}
+	util.WalkTree(fs.root, fs.touch)
+
+	fs.GC()
+	util.WalkTree(fs.root, func(f *util.File) {
+		if _, ok := f.AsRegularFile(); ok && !f.IsVirtual() {
+			contentType(f)
+		}
+	})
+
+	fs.replica = true
+	fs.frozen = true
+	return fs, nil
+}
+
+// Returns the directory at the end of the path below this builder's directory, creating any
+// missing ones, or nil if the build failed
+func (b *Builder) mkdirs(names []string) *util.File {
+	curr := b.dir
+	for _, name := range names {
+		if b.state.err != nil {
+			return nil
+		}
+		child := curr.GetChildByName(name)
+		if child == nil {
+			child = util.NewFile(name, true, curr)
+			curr.UpsertChild(name, child)
+		} else if !child.IsDirectory() {
+			b.fail(fmt.Errorf("%s is not a directory", child.GetFullPathName(b.state.root)))
+			return nil
+		}
+		curr = child
+	}
+	return curr
+}
+
+// Returns the directory that should contain the named entry, creating it if needed, and the
+// entry's own name
+func (b *Builder) parentOf(name string) (*util.File, string) {
+	names := util.SplitPath(name)
+	if len(names) == 0 {
+		b.fail(fmt.Errorf("Invalid name %q", name))
+		return nil, ""
+	}
+	return b.mkdirs(names[:len(names)-1]), names[len(names)-1]
+}
+
+func (b *Builder) add(parent *util.File, name string, file *util.File) {
+	if existing := parent.GetChildByName(name); existing != nil && existing.IsDirectory() {
+		b.fail(fmt.Errorf("%s is a directory", existing.GetFullPathName(b.state.root)))
+		return
+	}
+	parent.UpsertChild(name, file)
+}
+
+// Records the first error
+func (b *Builder) fail(err error) {
+	if b.state.err == nil {
+		b.state.err = err
+	}
+}
@@ -0,0 +1,119 @@
+// builder_test.go
+package imfs
+
+import (
+	"sync"
+	"testing"
+)
+
+func newFixtureBuilder() *Builder {
+	return newFixtureBuilderWithOptions(Options{})
+}
+
+func newFixtureBuilderWithOptions(opts Options) *Builder {
+	b := NewBuilder(opts)
+	b.Dir("src").File("main.go", "package main").File("README", "hello")
+	b.Dir("docs/img").Symlink("latest", "../../src/README")
+	b.File("top.txt", "hello")
+	return b
+}
+
+func TestBuilder(t *testing.T) {
+	fs, err := newFixtureBuilder().Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := fs.Ls()
+	assertMatchesAndNoErrors(res, err, "docs src top.txt", t)
+	res, err = fs.Ls("~/docs/img")
+	assertMatchesAndNoErrors(res, err, "latest", t)
+	res, err = fs.Realpath("~/docs/img/latest")
+	assertMatchesAndNoErrors(res, err, "/src/README", t)
+	fs.Cd("src")
+	res, err = fs.ReadFile("main.go")
+	assertMatchesAndNoErrors(res, err, "package main", t)
+
+	// Identical contents are shared: one block each for main.go, both "hello" files and the link
+	if stats := fs.GC(); stats.BlocksAfter != 3 {
+		t.Errorf("Expected the identical files to share a block, got %+v", stats)
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	b := NewBuilder(Options{})
+	b.File("a", "file")
+	b.Dir("a/b").File("c", "unreachable")
+	_, err := b.Freeze()
+	assertErrorAndEmptyResult("", err, "/a is not a directory", t)
+
+	b = NewBuilder(Options{})
+	b.Dir("a")
+	b.File("a", "file")
+	_, err = b.Freeze()
+	assertErrorAndEmptyResult("", err, "/a is a directory", t)
+}
+
+func TestFrozenIsReadOnly(t *testing.T) {
+	b := newFixtureBuilder()
+	fs, _ := b.Freeze()
+
+	_, err := fs.MkDir("new")
+	assertErrorAndEmptyResult("", err, ErrReadOnly.Error(), t)
+	fs.Cd("src")
+	_, err = fs.WriteFile("main.go", "changed")
+	assertErrorAndEmptyResult("", err, ErrReadOnly.Error(), t)
+	if err := fs.ApplyJournalEntry(JournalEntry{Seq: 1, Op: OpMkDir, Path: "/new"}); err != ErrReadOnly {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+
+	// The builder can keep going without changing what it already froze
+	b.File("later.txt", "")
+	again, _ := b.Freeze()
+	res, err := again.Ls()
+	assertMatchesAndNoErrors(res, err, "docs later.txt src top.txt", t)
+	fs.Cd("~")
+	res, err = fs.Ls()
+	assertMatchesAndNoErrors(res, err, "docs src top.txt", t)
+}
+
+func TestFrozenConcurrentReads(t *testing.T) {
+	// Reads don't record access times on the shared nodes, even when asked to
+	for _, opts := range []Options{{}, {Atime: AtimeAlways}, {Atime: AtimeRelatime}} {
+		fs, _ := newFixtureBuilderWithOptions(opts).Freeze()
+		readConcurrently(fs, t)
+	}
+}
+
+// Reads the frozen filesystem from several goroutines at once, each through its own view
+func readConcurrently(fs *Filesystem, t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			view := fs.View()
+			for j := 0; j < 50; j++ {
+				view.Cd("~/src")
+				if res, err := view.ReadFile("main.go"); err != nil || res != "package main" {
+					t.Errorf("Expected to read main.go, got %s, %v", res, err)
+					return
+				}
+				view.DetectContentType("README")
+				view.Realpath("~/docs/img/latest")
+				view.LsEntries("~")
+				h, _ := view.Open("README")
+				h.Read(make([]byte, 10))
+				h.Close()
+			}
+			if stats := view.AccessStats(); len(stats) != 2 {
+				t.Errorf("Expected each view to keep its own stats, got %v", stats)
+			}
+			_, err := view.MkFile("new.txt")
+			if err != ErrReadOnly {
+				t.Errorf("Expected views to be read-only, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
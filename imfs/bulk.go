@@ -0,0 +1,77 @@
+package imfs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The failure of a single entry within a bulk operation, or of resolving a path
+type PathError struct {
+	Op   Operation
+	Path string
+	Err  error
+	// When resolving the path failed: the element that couldn't be resolved, e.g. "dir2" in
+	// "dir1/dir2/file", and the absolute path of the directory resolution started from (the root
+	// for paths starting with "~" or "/", otherwise the current directory). Empty otherwise.
+	Segment string
+	From    string
+}
+
+func (e *PathError) Error() string {
+	if e.Segment != "" {
+		return fmt.Sprintf("%s: %s (resolving %s from %s)", e.Err, e.Segment, e.Path, e.From)
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// Returned by bulk operations (recursive chmod/chown, ApplyChanges) that carry on past failing
+// entries, listing every failure in the order it happened. errors.Is and errors.As look through
+// all of the failures.
+type BulkError struct {
+	Failures []*PathError
+}
+
+func (e *BulkError) Error() string {
+	return errors.Join(e.Unwrap()...).Error()
+}
+
+func (e *BulkError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		errs = append(errs, failure)
+	}
+	return errs
+}
+
+// Returns the paths that failed, in order
+func (e *BulkError) Paths() []string {
+	paths := make([]string, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		paths = append(paths, failure.Path)
+	}
+	return paths
+}
+
+// Collects failures during a bulk operation
+type bulkErrors struct {
+	failures []*PathError
+}
+
+// Records the error for the path, if there is one
+func (b *bulkErrors) add(op Operation, path string, err error) {
+	if err != nil {
+		b.failures = append(b.failures, &PathError{Op: op, Path: path, Err: err})
+	}
+}
+
+// Returns a *BulkError listing every failure, or nil if there were none
+func (b *bulkErrors) err() error {
+	if len(b.failures) == 0 {
+		return nil
+	}
+	return &BulkError{Failures: b.failures}
+}
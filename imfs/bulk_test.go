@@ -0,0 +1,74 @@
+// bulk_test.go
+package imfs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBulkErrorFromApplyChanges(t *testing.T) {
+	// Set up test subject. The second and fourth changes can't be applied since their parent
+	// directories don't exist
+	fs := NewFileSystem()
+	stream := strings.Join([]string{
+		`{"version":1,"since":"base"}`,
+		`{"path":"/dir1","isDir":true}`,
+		`{"path":"/missing/file1"}`,
+		`{"path":"/dir1/file2","contents":"aGk="}`,
+		`{"path":"/missing/dir2","isDir":true}`,
+	}, "\n")
+
+	err := fs.ApplyChanges(strings.NewReader(stream))
+	var bulk *BulkError
+	if !errors.As(err, &bulk) {
+		t.Fatalf("Expected a *BulkError but got %v", err)
+	}
+	if !stringSliceEqual(bulk.Paths(), []string{"/missing/file1", "/missing/dir2"}) {
+		t.Errorf("Unexpected failed paths: %v", bulk.Paths())
+	}
+	if bulk.Failures[0].Op != OperationWrite || bulk.Failures[1].Op != OperationMkDir {
+		t.Errorf("Unexpected failed operations: %+v", bulk.Failures)
+	}
+	expected := "/missing/file1: Directory not found: /missing\n/missing/dir2: Directory not found: /missing"
+	if err.Error() != expected {
+		t.Errorf("Expected error:\n%s\nbut got:\n%s", expected, err)
+	}
+
+	// The changes that could be applied still were
+	fs.Cd("dir1")
+	res, err := fs.ReadFile("file2")
+	assertMatchesAndNoErrors(res, err, "hi", t)
+}
+
+func TestBulkErrorUnwrapping(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkFile("file1")
+	fs.MkFile("file2")
+	fs.Use(HookFuncs{BeforeFunc: func(event *OperationEvent) error {
+		if event.Op == OperationChmod && event.Path != "/" {
+			return ErrReadOnly
+		}
+		return nil
+	}})
+
+	err := fs.Chmod("~", 0700, true)
+	var bulk *BulkError
+	if !errors.As(err, &bulk) || len(bulk.Failures) != 2 {
+		t.Fatalf("Expected two failures but got %v", err)
+	}
+	// Every failure can be matched
+	if !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected the failures to wrap %s", ErrReadOnly)
+	}
+	var pathErr *PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "/file1" {
+		t.Errorf("Expected the first failure to be for /file1 but got %v", pathErr)
+	}
+
+	// Operations without failures don't return an error at all
+	if err := fs.Chown("~", "root", true); err != nil {
+		t.Errorf("Expected no errors but got %v", err)
+	}
+}
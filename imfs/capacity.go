@@ -0,0 +1,142 @@
+package imfs
+
+import (
+	"errors"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"math"
+)
+
+// Returned when a write or new entry doesn't fit within `Options.Capacity`
+var ErrNoSpace = errors.New("No space left on device")
+
+// The estimated metadata overhead of every file or directory, in bytes, on top of its name and
+// contents. Only used when simulating a fixed-size volume.
+const NodeOverhead int = 64
+
+// How much of the simulated volume is in use
+type Usage struct {
+	// The configured capacity in bytes, or 0 if unlimited
+	Capacity int
+	// Bytes used by contents and metadata
+	Used int
+	// Bytes still available, or -1 if unlimited
+	Free int
+}
+
+// Reports how much space is used, like `df`. Usage is always computed, even when no capacity is
+// configured. The first call walks the tree; after that, the usage is kept up to date as the tree
+// changes, so checking it costs nothing. Views share the capacity of the filesystem they were
+// created from, so they report the usage of all of it, like `df` on a bind mount.
+func (fs *Filesystem) DiskUsage() Usage {
+	storage := fs.storage()
+	used := storage.usedBytes()
+	usage := Usage{Capacity: storage.opts.Capacity, Used: used, Free: -1}
+	if storage.opts.Capacity > 0 {
+		usage.Free = storage.opts.Capacity - used
+		if usage.Free < 0 {
+			usage.Free = 0
+		}
+	}
+	return usage
+}
+
+// Returns the bytes used by the tree of the storage. It counts every node once, then adjusts the
+// total as changes are recorded (see updateUsage) rather than walking the tree again. Frozen
+// filesystems, whose readers mustn't write anything, walk the tree every time.
+func (fs *Filesystem) usedBytes() int {
+	if fs.frozen {
+		return treeSize(fs.root)
+	}
+	if fs.usage == nil {
+		fs.usage = make(map[*util.File]int)
+		fs.used = 0
+		util.WalkTree(fs.root, fs.account)
+	}
+	return fs.used
+}
+
+// Counts a node at its current size, in place of the size it was counted at before
+func (fs *Filesystem) account(f *util.File) {
+	size := nodeSize(f)
+	fs.used += size - fs.usage[f]
+	fs.usage[f] = size
+}
+
+// Updates the usage of the storage for a recorded change, by recounting the entry it names.
+// Removed entries are counted out by teardown, and replacing the whole tree starts the count over.
+func (fs *Filesystem) updateUsage(entry JournalEntry) {
+	if fs.usage == nil {
+		return
+	}
+	path := entry.Path
+	if entry.Op == OpMv {
+		path = entry.Target
+	}
+	if entry.Op != OpRm {
+		if f := util.LookupPath(fs.root, path); f != nil {
+			fs.account(f)
+		}
+	}
+}
+
+// Stops counting a node removed from the tree
+func (fs *Filesystem) unaccount(f *util.File) {
+	if size, ok := fs.usage[f]; ok {
+		fs.used -= size
+		delete(fs.usage, f)
+	}
+}
+
+// Stops counting a subtree (if any) about to be replaced by a new node of the same name, which
+// would otherwise stay counted
+func (fs *Filesystem) unaccountTree(root *util.File) {
+	if fs.usage != nil && root != nil {
+		util.WalkTree(root, fs.unaccount)
+	}
+}
+
+// Returns how many bytes are still available, which is unlimited unless a capacity or a
+// supervisor's memory limit is configured. Views draw on the same space as their storage.
+func (fs *Filesystem) spaceLeft() int {
+	storage := fs.storage()
+	left := math.MaxInt
+	if storage.opts.Capacity > 0 {
+		left = fs.DiskUsage().Free
+	}
+	if s := storage.supervisor; s != nil && s.memoryLimit > 0 {
+		if shared := s.spaceLeft(storage); shared < left {
+			left = shared
+		}
+	}
+	return left
+}
+
+// Returns ErrNoSpace if there's no room for a new entry with the given name
+func (fs *Filesystem) reserveNode(name string) error {
+	if fs.spaceLeft() < NodeOverhead+len(name) {
+		return ErrNoSpace
+	}
+	return nil
+}
+
+// Returns the part of the data that fits within the remaining capacity when written to the file,
+// along with ErrNoSpace if it had to be cut short
+func (fs *Filesystem) fitToCapacity(file *util.File, data []byte) ([]byte, error) {
+	if file.IsVirtual() || file.GetKind().IsSpecial() {
+		// Nothing is stored, so nothing counts against the capacity
+		return data, nil
+	}
+	if left := fs.spaceLeft(); left < len(data) {
+		return data[:left], ErrNoSpace
+	}
+	return data, nil
+}
+
+// Returns the estimated size of the file, including its metadata overhead
+func nodeSize(f *util.File) int {
+	size := NodeOverhead + len(f.GetName())
+	if !f.IsVirtual() && !f.GetKind().IsSpecial() {
+		size += len(f.GetContents())
+	}
+	return size
+}
@@ -0,0 +1,126 @@
+// capacity_test.go
+package imfs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCapacity(t *testing.T) {
+	// Set up test subject. There's room for the file's metadata plus 10 bytes of contents
+	fs := NewFileSystemWithOptions(Options{Capacity: 2*NodeOverhead + len("/") + len("file1") + 10})
+
+	res, err := fs.MkFile("file1")
+	assertMatchesAndNoErrors(res, err, "file1", t)
+
+	// Writes succeed up to the boundary and then fail
+	res, err = fs.WriteFile("file1", "hello world")
+	if res != "file1" || err != ErrNoSpace {
+		t.Errorf("Expected a partial write with error: %s but got %s", ErrNoSpace, err)
+	}
+	res, err = fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "hello worl", t)
+
+	usage := fs.DiskUsage()
+	if usage.Free != 0 || usage.Used != usage.Capacity {
+		t.Errorf("Expected the volume to be full but got %+v", usage)
+	}
+
+	// New entries don't fit either
+	res, err = fs.MkDir("dir1")
+	assertErrorAndEmptyResult(res, err, ErrNoSpace.Error(), t)
+
+	// Handles report short writes
+	fs.Rm("file1", false)
+	fs.MkFile("file1")
+	h, _ := fs.Open("file1")
+	n, err := h.Write([]byte("hello world!"))
+	if n != 10 || err != ErrNoSpace {
+		t.Errorf("Expected to write 10 bytes with error: %s but wrote %d with %s", ErrNoSpace, n, err)
+	}
+
+	// Without a capacity there's no limit
+	usage = NewFileSystem().DiskUsage()
+	if usage.Capacity != 0 || usage.Free != -1 {
+		t.Errorf("Expected unlimited usage but got %+v", usage)
+	}
+}
+
+// A view shares the capacity of its storage, counting what's stored outside it
+func TestCapacityThroughChroot(t *testing.T) {
+	// There's room for the directories plus 10 bytes of contents, which the file outside the view uses
+	capacity := 4*NodeOverhead + len("/") + len("outside") + len("inside") + len("file1") + 10
+	fs := NewFileSystemWithOptions(Options{Capacity: capacity})
+	fs.MkDir("inside")
+	fs.MkFile("outside")
+	fs.WriteFile("outside", "0123456789")
+	view, _ := fs.Chroot("inside")
+
+	res, err := view.MkFile("file1")
+	assertMatchesAndNoErrors(res, err, "file1", t)
+	if _, err := view.WriteFile("file1", "hello"); err != ErrNoSpace {
+		t.Errorf("Expected error: %s but got %v", ErrNoSpace, err)
+	}
+	if usage := view.DiskUsage(); usage != fs.DiskUsage() || usage.Free != 0 || usage.Capacity != capacity {
+		t.Errorf("Expected the view to report the full volume %+v but got %+v", fs.DiskUsage(), usage)
+	}
+
+	// Space freed outside the view can be used through it
+	fs.Rm("outside", false)
+	res, err = view.WriteFile("file1", "hello")
+	assertMatchesAndNoErrors(res, err, "file1", t)
+}
+
+func TestDiskUsageTracked(t *testing.T) {
+	fs := NewFileSystemWithOptions(Options{Capacity: 1 << 20, RepointLinks: true})
+	fs.MkFile("seed")
+	fs.DiskUsage()
+	view, _ := fs.Chroot("~")
+
+	// After every kind of change, the usage kept up to date matches walking the tree
+	for _, change := range []struct {
+		name string
+		run  func()
+	}{
+		{"mkdir", func() { fs.MkDir("dir1") }},
+		{"mkfile", func() { fs.MkFile("~/dir1/a.txt") }},
+		{"write", func() { fs.WriteFile("~/dir1/a.txt", "hello") }},
+		{"overwrite", func() { fs.WriteFile("~/dir1/a.txt", "hi") }},
+		{"truncate", func() { fs.Truncate("~/dir1/a.txt", 100) }},
+		{"copy range", func() { fs.MkFile("b.txt"); fs.CopyRange("~/dir1/a.txt", 0, "b.txt", 10, 50) }},
+		{"handle", func() {
+			h, _ := fs.Open("b.txt")
+			h.Write([]byte("more"))
+			h.Close()
+		}},
+		{"symlink", func() { fs.Symlink("dir1/a.txt", "link") }},
+		{"mv", func() { fs.Cd("dir1"); fs.MvFile("a.txt", "~/"); fs.Cd("~") }},
+		{"rename", func() { fs.Rename("a.txt", "a-much-longer-name.txt") }},
+		{"view", func() { view.MkFile("from-view"); view.WriteFile("from-view", "viewed") }},
+		{"fixture", func() {
+			fs.LoadFixture(strings.NewReader("entries:\n  - path: b.txt\n    contents: replaced\n  - path: deep/x/y.txt\n    contents: new\n"))
+		}},
+		{"rm", func() { fs.Cd("~"); fs.Rm("deep", true) }},
+		{"checkpoint", func() { fs.Checkpoint("cp"); fs.MkFile("later"); fs.Restore("cp") }},
+		{"apply", func() {
+			fs.Apply([]Op{{Op: OperationMkFile, Path: "applied"}, {Op: OperationMkFile, Path: "applied"}})
+		}},
+	} {
+		change.run()
+		if used, walked := fs.DiskUsage().Used, treeSize(fs.root); used != walked {
+			t.Errorf("After %s: expected %d bytes used but got %d", change.name, walked, used)
+		}
+	}
+
+	// So does a replica's, as it applies the journal
+	replica := NewFileSystem()
+	replica.DiskUsage()
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if used, walked := replica.DiskUsage().Used, treeSize(replica.root); used != walked {
+		t.Errorf("Expected the replica to use %d bytes but got %d", walked, used)
+	}
+}
@@ -0,0 +1,270 @@
+package imfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"io"
+	"os"
+)
+
+// Identifies a checkpoint previously saved with Checkpoint, by name
+type CheckpointID string
+
+// The version written into every change stream. Bump this whenever the change stream layout
+// changes.
+//
+// Version 2 added Kind, Mode and Owner.
+const ChangeStreamVersion int = 2
+
+// The first record of an exported change stream
+type changeHeader struct {
+	Version int    `json:"version"`
+	Since   string `json:"since"`
+	// Set if the contents of every entry are encrypted (see encryption.go)
+	Encrypted bool `json:"encrypted,omitempty"`
+}
+
+// A single record of an exported change stream: either a deleted path, or the full state of a
+// file or directory that was created or modified. As in snapshots, the contents of a symbolic
+// link are its target and those of a remote file its URL.
+type changeEntry struct {
+	Path    string `json:"path"`
+	Deleted bool   `json:"deleted,omitempty"`
+	IsDir   bool   `json:"isDir,omitempty"`
+	// The util.FileKind name for anything other than regular files and directories
+	Kind     string `json:"kind,omitempty"`
+	Contents []byte `json:"contents,omitempty"`
+	// Permission bits, omitted when they're the default
+	Mode  uint32 `json:"mode,omitempty"`
+	Owner string `json:"owner,omitempty"`
+}
+
+// Streams every entry that changed since the given checkpoint to w, one JSON record at a time.
+// Deleted (or moved) paths are written first, followed by the created/modified entries with
+// parents before their children. The result can be applied to another filesystem that matches
+// the checkpoint using ApplyChanges.
+//
+// Parameters:
+//
+//	since (CheckpointID) - the checkpoint to compare against
+//	w (io.Writer) - where to write the changes
+//
+// Returns:
+//
+//	error - an error if the checkpoint does not exist or writing fails
+func (fs *Filesystem) ExportChanges(since CheckpointID, w io.Writer) error {
+	cp := fs.checkpoints[string(since)]
+	if cp == nil {
+		return fmt.Errorf("Checkpoint %s does not exist", since)
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(changeHeader{Version: ChangeStreamVersion, Since: string(since), Encrypted: fs.encrypted()}); err != nil {
+		return err
+	}
+
+	var err error
+	encode := func(entry changeEntry) {
+		if err == nil && fs.encrypted() && !entry.Deleted && !entry.IsDir {
+			entry.Contents, err = fs.seal(entry.Contents)
+		}
+		if err == nil {
+			err = enc.Encode(entry)
+		}
+	}
+
+	// Anything in the checkpoint that no longer exists (or changed type) was deleted
+	util.WalkTree(cp.root, func(f *util.File) {
+		if f == cp.root {
+			return
+		}
+		path := f.GetFullPathName(cp.root)
+		current := util.LookupPath(fs.root, path)
+		if current == nil || current.IsDirectory() != f.IsDirectory() {
+			encode(changeEntry{Path: path, Deleted: true})
+		}
+	})
+
+	// Anything modified after the checkpoint was taken was created or changed
+	util.WalkTree(fs.root, func(f *util.File) {
+		// Remote files are virtual, but only their URL is sent, so they can be replicated
+		if f == fs.root || (f.IsVirtual() && f.GetKind() != util.KindRemote) || f.GetGeneration() <= cp.generation {
+			return
+		}
+		contents := f.GetContents()
+		if f.GetKind() == util.KindRemote {
+			contents = []byte(f.RemoteURL())
+		}
+		encode(changeEntry{
+			Path:     f.GetFullPathName(fs.root),
+			IsDir:    f.IsDirectory(),
+			Kind:     kindName(f),
+			Contents: contents,
+			Mode:     snapshotMode(f),
+			Owner:    f.GetOwner(),
+		})
+	})
+
+	return err
+}
+
+// Applies a change stream written by ExportChanges
+//
+// Parameters:
+//
+//	r (io.Reader) - the change stream to apply
+//
+// Returns:
+//
+//	error - an error if the stream is malformed, in which case changes before the malformed
+//	        record remain applied, or a *BulkError listing every change that couldn't be applied
+//	        (the others are still applied)
+func (fs *Filesystem) ApplyChanges(r io.Reader) error {
+	defer fs.enter(OperationWrite, "")()
+	if fs.replica {
+		return ErrReadOnly
+	}
+
+	dec := json.NewDecoder(r)
+
+	header := changeHeader{}
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("Invalid change stream: %s", err)
+	}
+	if header.Version > ChangeStreamVersion {
+		return fmt.Errorf("Change stream version %d is newer than the supported version %d", header.Version, ChangeStreamVersion)
+	}
+
+	failures := bulkErrors{}
+	for {
+		entry := changeEntry{}
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			return failures.err()
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid change stream: %s", err)
+		}
+
+		op := OperationWrite
+		if entry.Deleted {
+			op = OperationRm
+		} else if entry.IsDir {
+			op = OperationMkDir
+		}
+		if header.Encrypted && !entry.Deleted && !entry.IsDir {
+			if entry.Contents, err = fs.unseal(entry.Contents); err != nil {
+				failures.add(op, entry.Path, err)
+				continue
+			}
+		}
+		failures.add(op, entry.Path, fs.applyChange(entry, header.Version >= 2))
+	}
+}
+
+// Applies a single deletion or modification, using a path relative to the root. Streams before
+// version 2 carry no attributes, so those are only applied if withAttributes is set.
+func (fs *Filesystem) applyChange(entry changeEntry, withAttributes bool) error {
+	pathSplit := util.SplitPath(entry.Path)
+	if len(pathSplit) == 0 {
+		return errors.New("Cannot change the root directory")
+	}
+
+	if entry.Deleted {
+		fs.removeAbsolute(entry.Path)
+		fs.record(JournalEntry{Op: OpRm, Path: entry.Path})
+		return nil
+	}
+
+	parentPath := pathSplit[:len(pathSplit)-1]
+	parent := util.LookupPath(fs.root, util.JoinPath(parentPath))
+	if parent == nil || !parent.IsDirectory() {
+		return fmt.Errorf("Directory not found: %s", util.JoinPath(parentPath))
+	}
+
+	kind := util.KindRegular
+	if entry.Kind != "" {
+		var ok bool
+		if kind, ok = util.ParseFileKind(entry.Kind); !ok {
+			return fmt.Errorf("Unknown kind %s", entry.Kind)
+		}
+	}
+
+	name := pathSplit[len(pathSplit)-1]
+	file := parent.GetChildByName(name)
+	// A remote file is recreated when its URL changes, so it fetches from the new one
+	created := file == nil || file.IsDirectory() != entry.IsDir || file.GetKind() != kind ||
+		(kind == util.KindRemote && file.RemoteURL() != string(entry.Contents))
+	if created {
+		fs.removeAbsolute(entry.Path)
+		file = util.NewFile(name, entry.IsDir, parent)
+		file.SetKind(kind)
+		parent.UpsertChild(name, file)
+	}
+	if !entry.IsDir {
+		if err := file.SetContents(entry.Contents); err != nil {
+			return err
+		}
+	}
+	if created && kind == util.KindRemote {
+		fs.attachRemote(file)
+	}
+	oldMode, oldOwner := file.GetMode(), file.GetOwner()
+	if withAttributes {
+		mode := os.FileMode(entry.Mode)
+		if mode == 0 {
+			mode = util.DefaultFileMode
+			if entry.IsDir {
+				mode = util.DefaultDirMode
+			}
+		}
+		file.SetMode(mode)
+		file.SetOwner(entry.Owner)
+	}
+	fs.touch(file)
+
+	switch {
+	case entry.IsDir:
+		if created {
+			fs.record(JournalEntry{Op: OpMkDir, Path: entry.Path})
+		}
+	case kind == util.KindSymlink:
+		if created {
+			fs.record(JournalEntry{Op: OpSymlink, Path: entry.Path, Target: string(entry.Contents)})
+		} else {
+			fs.record(JournalEntry{Op: OpRetarget, Path: entry.Path, Target: string(entry.Contents)})
+		}
+	case kind == util.KindRemote:
+		if created {
+			fs.record(JournalEntry{Op: OpMkRemote, Path: entry.Path, Target: string(entry.Contents)})
+		}
+	case kind.IsSpecial():
+		if created {
+			fs.record(JournalEntry{Op: OpMkSpecial, Path: entry.Path, Data: []byte(entry.Kind)})
+		}
+	default:
+		if created && kind == util.KindFifo {
+			fs.record(JournalEntry{Op: OpMkFifo, Path: entry.Path})
+		}
+		fs.record(JournalEntry{Op: OpPut, Path: entry.Path, Data: entry.Contents})
+	}
+	if file.GetMode() != oldMode {
+		fs.record(JournalEntry{Op: OpChmod, Path: entry.Path, Data: []byte(formatMode(file.GetMode()))})
+	}
+	if file.GetOwner() != oldOwner {
+		fs.record(JournalEntry{Op: OpChown, Path: entry.Path, Target: file.GetOwner()})
+	}
+	return nil
+}
+
+// Removes the file or directory at the given path relative to the root, if it exists. If the
+// current directory is removed, we move back to the root.
+func (fs *Filesystem) removeAbsolute(path string) {
+	file := util.LookupPath(fs.root, path)
+	if file == nil || file == fs.root {
+		return
+	}
+	fs.teardown(file)
+}
@@ -0,0 +1,158 @@
+// changes_test.go
+package imfs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportAndApplyChanges(t *testing.T) {
+	// Set up the leader and a copy of it
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.MkDir("dir2")
+	fs.MkFile("file1")
+	fs.MkFile("file2")
+	fs.WriteFile("file1", "hello")
+	fs.Checkpoint("base")
+
+	var buf bytes.Buffer
+	fs.SaveSnapshot(&buf, FormatBinary)
+	replica := NewFileSystem()
+	replica.LoadSnapshot(&buf)
+
+	// Make changes after the checkpoint
+	fs.WriteFile("file1", " world")
+	fs.MvFile("file2", "dir1")
+	fs.Rm("dir2", false)
+	fs.MkFile("dir2")
+	fs.MkDir("dir3")
+
+	buf.Reset()
+	if err := fs.ExportChanges("base", &buf); err != nil {
+		t.Fatalf("Expected no errors but got %s", err.Error())
+	}
+
+	// Unchanged entries shouldn't be exported
+	if strings.Contains(buf.String(), `"path":"/dir1",`) {
+		t.Errorf("Expected unchanged /dir1 to be left out of the changes: %s", buf.String())
+	}
+
+	if err := replica.ApplyChanges(&buf); err != nil {
+		t.Fatalf("Expected no errors but got %s", err.Error())
+	}
+	if !bytes.Equal(snapshotBytes(fs), snapshotBytes(replica)) {
+		t.Errorf("Expected replica to match after applying changes:\n%s\n%s", snapshotBytes(fs), snapshotBytes(replica))
+	}
+
+	// Exporting from a nonexistent checkpoint should fail
+	err := fs.ExportChanges("missing", &buf)
+	if err == nil || err.Error() != "Checkpoint missing does not exist" {
+		t.Errorf("Expected error: Checkpoint missing does not exist but got %s", err)
+	}
+}
+
+// Renaming a directory sends everything in it at its new path
+func TestExportChangesMovedDirectory(t *testing.T) {
+	// Set up the leader and a copy of it
+	fs := NewFileSystem()
+	fs.MkDir("d")
+	fs.MkDir("~/d/sub")
+	fs.MkFile("~/d/f")
+	fs.WriteFile("~/d/f", "hello")
+	fs.MkFile("~/d/sub/g")
+	fs.Checkpoint("base")
+	replica := NewFileSystem()
+	replica.LoadSnapshot(bytes.NewReader(snapshotBytes(fs)))
+
+	if _, err := fs.Rename("d", "e"); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	var buf bytes.Buffer
+	if err := fs.ExportChanges("base", &buf); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	if err := replica.ApplyChanges(&buf); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	res, err := replica.ReadFile("~/e/f")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+	if _, err := replica.Stat("~/e/sub/g"); err != nil {
+		t.Errorf("Expected the nested file to be moved along but got %s", err)
+	}
+	if !bytes.Equal(snapshotBytes(fs), snapshotBytes(replica)) {
+		t.Errorf("Expected replica to match after applying changes:\n%s\n%s", snapshotBytes(fs), snapshotBytes(replica))
+	}
+}
+
+// Links, special nodes and remote files keep their kind, and chmod and chown are sent along
+func TestExportChangesKindsAndAttributes(t *testing.T) {
+	// Set up the leader and a copy of it
+	fs := NewFileSystem()
+	fs.MkDir("dir")
+	fs.MkFile("file")
+	fs.WriteFile("file", "hello")
+	fs.MkFile("replaced")
+	fs.Checkpoint("base")
+	replica := NewFileSystem()
+	replica.LoadSnapshot(bytes.NewReader(snapshotBytes(fs)))
+	follower := NewFileSystem()
+	follower.LoadSnapshot(bytes.NewReader(snapshotBytes(fs)))
+	journalStart := len(replica.Journal())
+
+	fs.Symlink("file", "link")
+	fs.Rm("replaced", false)
+	fs.Symlink("dir", "replaced")
+	fs.MkSpecial("null", SpecialNull)
+	fs.MkFifo("pipe")
+	fs.MkRemoteFile("remote", "http://example.com/blob")
+	fs.Chmod("file", 0600, false)
+	fs.Chmod("dir", 0700, false)
+	fs.Chown("file", "alice", false)
+
+	var buf bytes.Buffer
+	if err := fs.ExportChanges("base", &buf); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	if err := replica.ApplyChanges(&buf); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+
+	for path, target := range map[string]string{"link": "file", "replaced": "dir"} {
+		res, err := replica.Readlink(path)
+		assertMatchesAndNoErrors(res, err, target, t)
+	}
+	entry, err := replica.Stat("file")
+	if err != nil || entry.Mode != 0600 || entry.Owner != "alice" {
+		t.Errorf("Expected file to have mode 600 and owner alice but got %o, %s, %v", entry.Mode, entry.Owner, err)
+	}
+	if entry, err := replica.Stat("dir"); err != nil || entry.Mode != 0700 {
+		t.Errorf("Expected dir to have mode 700 but got %o, %v", entry.Mode, err)
+	}
+	if !bytes.Equal(snapshotBytes(fs), snapshotBytes(replica)) {
+		t.Errorf("Expected replica to match after applying changes:\n%s\n%s", snapshotBytes(fs), snapshotBytes(replica))
+	}
+
+	// The journal entries recorded while applying replicate the same changes
+	for _, entry := range replica.Journal()[journalStart:] {
+		if err := follower.ApplyJournalEntry(entry); err != nil {
+			t.Fatalf("Expected no errors but got %s", err)
+		}
+	}
+	if !bytes.Equal(snapshotBytes(replica), snapshotBytes(follower)) {
+		t.Errorf("Expected the journal to replicate the changes:\n%s\n%s", snapshotBytes(replica), snapshotBytes(follower))
+	}
+
+	// Changing the mode back to the default is sent too
+	fs.Checkpoint("changed")
+	fs.Chmod("file", 0644, false)
+	buf.Reset()
+	fs.ExportChanges("changed", &buf)
+	if err := replica.ApplyChanges(&buf); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	if entry, err := replica.Stat("file"); err != nil || entry.Mode != 0644 || entry.Owner != "alice" {
+		t.Errorf("Expected file to have mode 644 and owner alice but got %o, %s, %v", entry.Mode, entry.Owner, err)
+	}
+}
@@ -0,0 +1,121 @@
+package imfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"sort"
+)
+
+// A saved copy of the tree along with the generation it was taken at
+type checkpoint struct {
+	root       *util.File
+	generation uint64
+}
+
+// Saves a named checkpoint of the entire filesystem which can later be restored with Restore.
+// Contents are shared copy-on-write with the live tree, so checkpoints are cheap to take.
+//
+// Parameters:
+//
+//	name (string) - the name of the checkpoint
+//
+// Returns:
+//
+//	string - the name of the newly-created checkpoint
+//	error - an error if the name is empty or a checkpoint with the same name already exists
+func (fs *Filesystem) Checkpoint(name string) (string, error) {
+	defer fs.enter(OperationWrite, "")()
+	if name == "" {
+		return "", errors.New("Must provide a checkpoint name")
+	}
+	if fs.checkpoints[name] != nil {
+		return "", fmt.Errorf("Checkpoint %s already exists", name)
+	}
+
+	fs.checkpoints[name] = &checkpoint{root: fs.root.Clone(nil), generation: fs.storage().generation}
+	return name, nil
+}
+
+// Restores the filesystem to the state saved in the named checkpoint. The checkpoint is kept, so
+// it can be restored again later. Open handles refer to the discarded tree and are closed
+// without being flushed. The current directory is preserved if it exists in the checkpoint,
+// otherwise we move back to the root.
+//
+// Parameters:
+//
+//	name (string) - the name of the checkpoint to restore
+//
+// Returns:
+//
+//	string - the name of the restored checkpoint
+//	error - an error if the checkpoint does not exist
+func (fs *Filesystem) Restore(name string) (string, error) {
+	defer fs.enter(OperationWrite, "")()
+	if fs.replica {
+		return "", ErrReadOnly
+	}
+	if fs.chrootParent != nil {
+		return "", ErrChrootView
+	}
+
+	cp := fs.checkpoints[name]
+	if cp == nil {
+		return "", fmt.Errorf("Checkpoint %s does not exist", name)
+	}
+
+	fs.restoreTree(cp.root)
+	return name, nil
+}
+
+// Replaces the tree with a copy of root, the way Restore does
+func (fs *Filesystem) restoreTree(root *util.File) {
+	cwdPath := util.SplitPath(fs.currentDirectory.GetFullPathName(fs.root))
+
+	fs.root = root.Clone(nil)
+	fs.currentDirectory = fs.root
+	fs.usage = nil
+	fs.links = nil
+	if cwd, err := util.WalkToEndOfPath(append([]string{"~"}, cwdPath...), fs.root, fs.root); err == nil {
+		fs.currentDirectory = cwd
+	}
+
+	// Handles point into the old tree, so they can't be used anymore
+	fs.SimulateCrash()
+	// Everything restored counts as a modification relative to any other checkpoint
+	util.WalkTree(fs.root, fs.touch)
+
+	var buf bytes.Buffer
+	fs.SaveSnapshot(&buf, FormatBinary)
+	fs.record(JournalEntry{Op: OpLoad, Data: buf.Bytes()})
+}
+
+// Returns the names of all saved checkpoints in alphabetical order
+func (fs *Filesystem) ListCheckpoints() []string {
+	names := []string{}
+	for name := range fs.checkpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Deletes the named checkpoint
+//
+// Parameters:
+//
+//	name (string) - the name of the checkpoint to delete
+//
+// Returns:
+//
+//	string - the name of the deleted checkpoint
+//	error - an error if the checkpoint does not exist
+func (fs *Filesystem) DeleteCheckpoint(name string) (string, error) {
+	defer fs.enter(OperationWrite, "")()
+	if fs.checkpoints[name] == nil {
+		return "", fmt.Errorf("Checkpoint %s does not exist", name)
+	}
+	delete(fs.checkpoints, name)
+	return name, nil
+}
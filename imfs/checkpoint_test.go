@@ -0,0 +1,71 @@
+// checkpoint_test.go
+package imfs
+
+import (
+	"testing"
+)
+
+func TestCheckpointAndRestore(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.MkFile("file1")
+	fs.WriteFile("file1", "hello")
+
+	res, err := fs.Checkpoint("before")
+	assertMatchesAndNoErrors(res, err, "before", t)
+
+	// Duplicate checkpoints aren't allowed
+	res, err = fs.Checkpoint("before")
+	assertErrorAndEmptyResult(res, err, "Checkpoint before already exists", t)
+
+	// Make some changes after the checkpoint
+	fs.WriteFile("file1", " world")
+	fs.MkFile("file2")
+	fs.Rm("dir1", false)
+	fs.MkDir("dir2")
+	fs.Cd("dir2")
+
+	res, err = fs.Restore("before")
+	assertMatchesAndNoErrors(res, err, "before", t)
+
+	// dir2 doesn't exist in the checkpoint, so we should be back at the root
+	if fs.Pwd() != "/" {
+		t.Errorf("Expected the current working directory to be / but is %s", fs.Pwd())
+	}
+	res, err = fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+	res, err = fs.Ls()
+	if !stringSliceEqual(sortedFields(res), []string{"dir1", "file1"}) {
+		t.Errorf("Expected dir1 and file1 after restoring but got %s", res)
+	}
+
+	// Writing after a restore shouldn't change the checkpoint
+	fs.WriteFile("file1", " again")
+	fs.Restore("before")
+	res, err = fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+
+	res, err = fs.Restore("missing")
+	assertErrorAndEmptyResult(res, err, "Checkpoint missing does not exist", t)
+}
+
+func TestListAndDeleteCheckpoints(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.Checkpoint("b")
+	fs.Checkpoint("a")
+
+	if !stringSliceEqual(fs.ListCheckpoints(), []string{"a", "b"}) {
+		t.Errorf("Invalid results: got: %v, expected: %v", fs.ListCheckpoints(), []string{"a", "b"})
+	}
+
+	res, err := fs.DeleteCheckpoint("a")
+	assertMatchesAndNoErrors(res, err, "a", t)
+	if !stringSliceEqual(fs.ListCheckpoints(), []string{"b"}) {
+		t.Errorf("Invalid results: got: %v, expected: %v", fs.ListCheckpoints(), []string{"b"})
+	}
+
+	res, err = fs.DeleteCheckpoint("a")
+	assertErrorAndEmptyResult(res, err, "Checkpoint a does not exist", t)
+}
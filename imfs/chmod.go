@@ -0,0 +1,114 @@
+package imfs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"os"
+	"strconv"
+)
+
+// Called after each entry visited by Chmod or Chown, with the error for that entry (if any)
+type ProgressFunc func(path string, err error)
+
+// Changes the permission bits of a file or directory, like `chmod`. Permissions are only
+// recorded, not enforced. If the path is a symbolic link, its target is changed.
+//
+// When recursive is set the whole subtree is changed (symbolic links inside it are skipped, as
+// with `chmod -R`). Failing entries, e.g. vetoed by a hook, don't stop the others from being
+// changed; all of the failures are returned together in a *BulkError.
+//
+// Parameters:
+//
+//	path (string) - the file or directory to change
+//	mode (os.FileMode) - the new permission bits
+//	recursive (bool) - whether to change every descendant of a directory too
+//	progress (ProgressFunc) - optionally called after every entry
+//
+// Returns:
+//
+//	error - an error if the path doesn't exist, or a *BulkError listing every entry that failed
+func (fs *Filesystem) Chmod(path string, mode os.FileMode, recursive bool, progress ...ProgressFunc) error {
+	return fs.changeAttributes(path, recursive, progress, func(f *util.File) (*OperationEvent, func(), JournalEntry) {
+		event := &OperationEvent{Op: OperationChmod, Path: fullPath(f, fs.root), Data: []byte(formatMode(mode))}
+		entry := JournalEntry{Op: OpChmod, Path: event.Path, Data: event.Data}
+		return event, func() { f.SetMode(mode) }, entry
+	})
+}
+
+// Changes the owner of a file or directory, like `chown`. Ownership is only recorded, not
+// enforced. Symbolic links, recursion, progress and errors work the same as for Chmod.
+//
+// Parameters:
+//
+//	path (string) - the file or directory to change
+//	owner (string) - the new owner
+//	recursive (bool) - whether to change every descendant of a directory too
+//	progress (ProgressFunc) - optionally called after every entry
+//
+// Returns:
+//
+//	error - an error if the path doesn't exist, or a *BulkError listing every entry that failed
+func (fs *Filesystem) Chown(path string, owner string, recursive bool, progress ...ProgressFunc) error {
+	if owner == "" {
+		return errors.New("Must provide an owner")
+	}
+	return fs.changeAttributes(path, recursive, progress, func(f *util.File) (*OperationEvent, func(), JournalEntry) {
+		event := &OperationEvent{Op: OperationChown, Path: fullPath(f, fs.root), Target: owner}
+		entry := JournalEntry{Op: OpChown, Path: event.Path, Target: owner}
+		return event, func() { f.SetOwner(owner) }, entry
+	})
+}
+
+// Applies a change to the file at path (and its subtree, if recursive). For every entry, change
+// returns the event to run hooks with, the function making the change and its journal entry.
+func (fs *Filesystem) changeAttributes(path string, recursive bool, progress []ProgressFunc,
+	change func(f *util.File) (*OperationEvent, func(), JournalEntry)) error {
+	if fs.replica {
+		return ErrReadOnly
+	}
+	top, err := fs.follow(path)
+	if err != nil {
+		return err
+	}
+
+	failures := bulkErrors{}
+	visit := func(f *util.File) {
+		if f != top && f.IsSymlink() {
+			return
+		}
+		event, apply, entry := change(f)
+		_, err := fs.runHooks(event, func() (string, error) {
+			apply()
+			// Attributes aren't contents, so only the generation changes
+			f.SetGeneration(fs.nextGeneration())
+			fs.record(entry)
+			return event.Path, nil
+		})
+		failures.add(event.Op, event.Path, err)
+		for _, p := range progress {
+			p(event.Path, err)
+		}
+	}
+
+	if recursive {
+		util.WalkTree(top, visit)
+	} else {
+		visit(top)
+	}
+	return failures.err()
+}
+
+// Formats permission bits as octal, e.g. "755"
+func formatMode(mode os.FileMode) string {
+	return strconv.FormatUint(uint64(mode.Perm()), 8)
+}
+
+// Parses octal permission bits, e.g. "755"
+func ParseMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("Invalid mode %s: must be octal permission bits, e.g. 755", s)
+	}
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,96 @@
+// chmod_test.go
+package imfs
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestChmod(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.MkDir("dir1/dir2")
+	fs.Cd("dir1")
+	fs.MkFile("file1")
+	fs.Cd("~")
+	fs.Symlink("/dir1", "link")
+
+	// Non-recursive changes only affect the target of the path, following links
+	if err := fs.Chmod("link", 0700, false); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	entries, _ := fs.LsEntries()
+	if entries[0].Mode != 0700 || entries[1].Mode != 0644 {
+		t.Errorf("Expected only dir1 to change but got %+v", entries)
+	}
+	entries, _ = fs.LsEntries("dir1")
+	if entries[0].Mode != 0755 {
+		t.Errorf("Expected dir1's children to be unchanged but got %+v", entries)
+	}
+
+	// Recursive changes reach every descendant and report progress
+	visited := []string{}
+	err := fs.Chmod("dir1", 0600, true, func(path string, err error) {
+		visited = append(visited, path)
+	})
+	if err != nil || !stringSliceEqual(visited, []string{"/dir1", "/dir1/dir2", "/dir1/file1"}) {
+		t.Errorf("Expected to change all of dir1 but visited %v with error %v", visited, err)
+	}
+
+	res, err := ParseMode("999")
+	if err == nil {
+		t.Errorf("Expected an error parsing an invalid mode but got %v", res)
+	}
+}
+
+func TestChownCollectsFailures(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.Cd("dir1")
+	fs.MkFile("file1")
+	fs.MkFile("file2")
+	fs.Cd("~")
+
+	// Veto one entry; the others should still change
+	denied := errors.New("denied")
+	fs.Use(HookFuncs{BeforeFunc: func(event *OperationEvent) error {
+		if event.Op == OperationChown && event.Path == "/dir1/file1" {
+			return denied
+		}
+		return nil
+	}})
+
+	err := fs.Chown("dir1", "alice", true)
+	if !errors.Is(err, denied) || !strings.Contains(err.Error(), "/dir1/file1: denied") {
+		t.Errorf("Expected the failure for /dir1/file1 to be reported but got %v", err)
+	}
+	entries, _ := fs.LsEntries("dir1")
+	if entries[0].Owner != "" || entries[1].Owner != "alice" {
+		t.Errorf("Expected only file2 to change owner but got %+v", entries)
+	}
+
+	// Attributes survive snapshots and replication
+	var buf bytes.Buffer
+	fs.SaveSnapshot(&buf, FormatJSON)
+	loaded := NewFileSystem()
+	loaded.LoadSnapshot(&buf)
+	entries, _ = loaded.LsEntries("~/dir1")
+	if entries[1].Owner != "alice" {
+		t.Errorf("Expected the owner to be restored but got %+v", entries)
+	}
+
+	replica := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatalf("Expected no errors but got %s", err)
+		}
+	}
+	entries, _ = replica.LsEntries("~/dir1")
+	if entries[1].Owner != "alice" {
+		t.Errorf("Expected the owner to be replicated but got %+v", entries)
+	}
+}
@@ -0,0 +1,106 @@
+package imfs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+)
+
+// Returned by operations that would replace the whole tree (Restore, LoadSnapshot, Follow) when
+// called on a chroot view, since the view's root belongs to the filesystem it was created from
+var ErrChrootView = errors.New("Operation is not supported in a chroot view")
+
+// Returns a view of the filesystem whose root is the directory at path, like `chroot`. The view
+// shares storage with this filesystem, so changes made through either are visible in both, but
+// nothing outside the directory can be reached from the view: ".." stops at its root, and "~",
+// absolute paths and symbolic link targets are resolved from it. Hand it to untrusted code to
+// confine it to a subtree.
+//
+// The view has its own current directory, handles, hooks, checkpoints and journal (with paths
+// relative to its root). Its modifications are also recorded in this filesystem's journal, so
+// replicas stay in sync.
+//
+// Parameters:
+//
+//	path (string) - the directory to use as the root
+//
+// Returns:
+//
+//	*Filesystem - the confined view
+//	error - an error if the path does not exist or isn't a directory
+func (fs *Filesystem) Chroot(path string) (*Filesystem, error) {
+	dir, err := fs.follow(path)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.IsDirectory() {
+		return nil, fmt.Errorf("%s is not a directory", path)
+	}
+	return fs.newView(dir), nil
+}
+
+// Returns a view of the whole filesystem: it shares the tree, but has its own current directory,
+// handles, hooks, checkpoints and journal, like a view returned by Chroot. Give each goroutine
+// reading a frozen filesystem its own view (see Builder.Freeze).
+func (fs *Filesystem) View() *Filesystem {
+	return fs.newView(fs.root)
+}
+
+// Returns a view of the whole filesystem, like View, through which every modification fails with
+// ErrReadOnly. Changes made through the filesystem itself or its other views are still visible in
+// it, so it suits clients that should only browse a tree someone else is changing.
+func (fs *Filesystem) ReadOnlyView() *Filesystem {
+	view := fs.newView(fs.root)
+	view.replica = true
+	return view
+}
+
+// Creates a view rooted at dir
+func (fs *Filesystem) newView(dir *util.File) *Filesystem {
+	opts := fs.opts
+	// The introspection files are mounted at the real root
+	opts.Introspection = false
+	view := NewFileSystemWithOptions(opts)
+	view.root = dir
+	view.currentDirectory = dir
+	view.replica = fs.replica
+	view.frozen = fs.frozen
+	view.chrootParent = fs
+	return view
+}
+
+// Returns the filesystem that owns the tree: the outermost one a chroot view was created from, or
+// fs itself
+func (fs *Filesystem) storage() *Filesystem {
+	for fs.chrootParent != nil {
+		fs = fs.chrootParent
+	}
+	return fs
+}
+
+// Returns the generation for a new modification. Views share their storage's counter, so
+// checkpoints taken outside a view see the changes made through it.
+func (fs *Filesystem) nextGeneration() uint64 {
+	storage := fs.storage()
+	storage.generation++
+	return storage.generation
+}
+
+// Records a modification made through a view in the journal of the filesystem it was created
+// from, with its paths made relative to that filesystem's root
+func (fs *Filesystem) recordInParent(entry JournalEntry) {
+	parent := fs.chrootParent
+	if parent == nil {
+		return
+	}
+	if !util.IsAncestor(parent.root, fs.root) {
+		// The view's root was removed from the parent, so its changes are no longer visible there
+		return
+	}
+	prefix := fs.root.GetFullPathName(parent.root)
+	entry.Path = prefix + entry.Path
+	if entry.Op == OpMv {
+		entry.Target = prefix + entry.Target
+	}
+	parent.record(entry)
+}
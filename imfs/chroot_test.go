@@ -0,0 +1,135 @@
+// chroot_test.go
+package imfs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Builds /secret.txt and /jail/inner, and returns a view rooted at /jail
+func newChrootFixture(t *testing.T) (*Filesystem, *Filesystem) {
+	fs := NewFileSystem()
+	fs.MkFile("secret.txt")
+	fs.WriteFile("secret.txt", "top secret")
+	fs.MkDir("jail")
+	fs.MkDir("jail/inner")
+	view, err := fs.Chroot("jail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs, view
+}
+
+func TestChroot(t *testing.T) {
+	fs, view := newChrootFixture(t)
+
+	assertMatchesAndNoErrors(view.Pwd(), nil, "/", t)
+	res, err := view.Ls()
+	assertMatchesAndNoErrors(res, err, "inner", t)
+
+	// Changes are visible on both sides
+	view.Cd("inner")
+	assertMatchesAndNoErrors(view.Pwd(), nil, "/inner", t)
+	view.MkFile("a.txt")
+	view.WriteFile("a.txt", "hello")
+	fs.Cd("~/jail/inner")
+	res, err = fs.ReadFile("a.txt")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+	fs.MkFile("b.txt")
+	res, err = view.Ls()
+	assertMatchesAndNoErrors(res, err, "a.txt b.txt", t)
+
+	_, err = fs.Chroot("~/jail/inner/a.txt")
+	assertErrorAndEmptyResult("", err, "~/jail/inner/a.txt is not a directory", t)
+}
+
+func TestReadOnlyView(t *testing.T) {
+	fs, _ := newChrootFixture(t)
+	view := fs.ReadOnlyView()
+
+	// The view can browse, and sees changes made elsewhere, but can't change anything
+	view.Cd("jail")
+	res, err := view.Ls()
+	assertMatchesAndNoErrors(res, err, "inner", t)
+	fs.Cd("jail")
+	fs.MkFile("new.txt")
+	res, err = view.Ls()
+	assertMatchesAndNoErrors(res, err, "inner new.txt", t)
+	res, err = view.MkFile("mine.txt")
+	assertErrorAndEmptyResult(res, err, ErrReadOnly.Error(), t)
+	res, err = view.WriteFile("new.txt", "x")
+	assertErrorAndEmptyResult(res, err, ErrReadOnly.Error(), t)
+	if err := view.Chmod("new.txt", 0600, false); err != ErrReadOnly {
+		t.Errorf("Expected %s but got %v", ErrReadOnly, err)
+	}
+
+	// The filesystem itself is still writable
+	res, err = fs.WriteFile("new.txt", "x")
+	assertMatchesAndNoErrors(res, err, "new.txt", t)
+}
+
+func TestChrootCannotEscape(t *testing.T) {
+	_, view := newChrootFixture(t)
+
+	_, err := view.Cd("../../..")
+	assertMatchesAndNoErrors(view.Pwd(), err, "/", t)
+	res, err := view.Ls("..")
+	assertMatchesAndNoErrors(res, err, "inner", t)
+	res, err = view.Realpath("~/../..")
+	assertMatchesAndNoErrors(res, err, "/", t)
+	res, err = view.ReadFile("../secret.txt")
+	assertErrorAndEmptyResult(res, err, "File not found: secret.txt (resolving ../secret.txt from /)", t)
+
+	// Link targets resolve inside the view too
+	view.Symlink("../secret.txt", "relative")
+	view.Symlink("/secret.txt", "absolute")
+	_, err = view.Realpath("relative")
+	assertErrorAndEmptyResult("", err, "File not found: secret.txt (resolving relative from /)", t)
+	_, err = view.Realpath("absolute")
+	assertErrorAndEmptyResult("", err, "File not found: secret.txt (resolving absolute from /)", t)
+
+	// Whole-tree replacements would detach the view from its storage
+	view.Checkpoint("cp")
+	_, err = view.Restore("cp")
+	if err != ErrChrootView {
+		t.Errorf("Expected ErrChrootView, got %v", err)
+	}
+}
+
+func TestChrootJournal(t *testing.T) {
+	fs, view := newChrootFixture(t)
+	replica := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		replica.ApplyJournalEntry(entry)
+	}
+	seen := len(fs.Journal())
+
+	view.Cd("inner")
+	view.MkFile("a.txt")
+	view.WriteFile("a.txt", "hello")
+
+	entries := view.Journal()
+	if len(entries) != 2 || entries[0].Path != "/inner/a.txt" {
+		t.Errorf("Expected the view's journal to use its own paths, got %v", entries)
+	}
+	for _, entry := range fs.Journal()[seen:] {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replica.Cd("~/jail/inner")
+	res, err := replica.ReadFile("a.txt")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+
+	// Checkpoints taken outside the view see changes made through it
+	fs.Checkpoint("before")
+	view.WriteFile("a.txt", " world")
+	buf := &bytes.Buffer{}
+	if err := fs.ExportChanges("before", buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"path":"/jail/inner/a.txt"`) {
+		t.Errorf("Expected the change made through the view to be exported, got %s", buf.String())
+	}
+}
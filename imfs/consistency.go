@@ -0,0 +1,108 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+	"path"
+	"sort"
+	"time"
+)
+
+// Notes when the entries a journal entry created or removed changed, so listings can lag behind
+// them (see `Options.ListingDelay`). Only called on the storage, whose journal sees the changes
+// made through its views too.
+func (fs *Filesystem) trackListing(entry JournalEntry) {
+	if fs.opts.ListingDelay <= 0 || fs.loadingBacking {
+		return
+	}
+	fs.expireListing()
+	now := fs.now()
+	created := ""
+	switch entry.Op {
+	case OpMkDir, OpMkFile, OpMkFifo, OpMkSpecial, OpSymlink, OpMkRemote:
+		created = entry.Path
+	case OpMv:
+		created = entry.Target
+		fs.trackRemoval(entry.Path, now)
+	case OpRm:
+		fs.trackRemoval(entry.Path, now)
+	}
+	if file := util.LookupPath(fs.root, created); created != "" && file != nil {
+		if fs.listingCreated == nil {
+			fs.listingCreated = make(map[*util.File]time.Time)
+		}
+		fs.listingCreated[file] = now
+	}
+}
+
+// Keeps listing the entry removed from p, as a detached stand-in in its old directory
+func (fs *Filesystem) trackRemoval(p string, now time.Time) {
+	dir := util.LookupPath(fs.root, path.Dir(p))
+	if dir == nil {
+		return
+	}
+	fs.listingRemoved = append(fs.listingRemoved, removedEntry{file: util.NewFile(path.Base(p), false, dir), at: now})
+}
+
+// An entry removed recently enough to still be listed
+type removedEntry struct {
+	// A detached node with the entry's name, whose parent is the directory it was removed from
+	file *util.File
+	at   time.Time
+}
+
+// Forgets the changes listings have caught up with. Only done as changes are tracked, so that
+// listing never modifies anything and searches running on their own goroutine (see FindStream)
+// can list too.
+func (fs *Filesystem) expireListing() {
+	cutoff := fs.now().Add(-fs.opts.ListingDelay)
+	for file, at := range fs.listingCreated {
+		if !at.After(cutoff) {
+			delete(fs.listingCreated, file)
+		}
+	}
+	remaining := fs.listingRemoved[:0]
+	for _, removed := range fs.listingRemoved {
+		if removed.at.After(cutoff) {
+			remaining = append(remaining, removed)
+		}
+	}
+	fs.listingRemoved = remaining
+}
+
+// Returns true if the node was created too recently to be listed
+func (fs *Filesystem) unlisted(file *util.File, cutoff time.Time) bool {
+	at, ok := fs.storage().listingCreated[file]
+	return ok && at.After(cutoff)
+}
+
+// Returns the children of a directory as listings see them: without the ones created less than
+// `Options.ListingDelay` ago, and with stand-ins for the ones removed less than that ago, in
+// name order
+func (fs *Filesystem) listedChildren(dir *util.File) []*util.File {
+	children := dir.Children()
+	if fs.opts.ListingDelay <= 0 {
+		return children
+	}
+	listed := fs.listed(children, func(removed *util.File) bool { return removed.GetParent() == dir })
+	sort.SliceStable(listed, func(i, j int) bool { return listed[i].GetName() < listed[j].GetName() })
+	return listed
+}
+
+// Applies `Options.ListingDelay` to the results of a search: drops the nodes created too recently
+// and adds the stand-ins of removed entries selected by include after them
+func (fs *Filesystem) listed(files []*util.File, include func(removed *util.File) bool) []*util.File {
+	storage := fs.storage()
+	cutoff := fs.now().Add(-fs.opts.ListingDelay)
+	listed := []*util.File{}
+	for _, file := range files {
+		if !fs.unlisted(file, cutoff) {
+			listed = append(listed, file)
+		}
+	}
+	for _, removed := range storage.listingRemoved {
+		if removed.at.After(cutoff) && include(removed.file) && util.IsAncestor(fs.root, removed.file) {
+			listed = append(listed, removed.file)
+		}
+	}
+	return listed
+}
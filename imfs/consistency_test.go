@@ -0,0 +1,61 @@
+// consistency_test.go
+package imfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListingDelay(t *testing.T) {
+	// Set up test subject
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fs := NewFileSystemWithOptions(Options{
+		ListingDelay: time.Second,
+		Now:          func() time.Time { return now },
+	})
+	fs.MkFile("old.txt")
+	now = now.Add(time.Second)
+
+	// New entries can be looked up right away, but aren't listed yet
+	fs.MkFile("new.txt")
+	if _, err := fs.Stat("new.txt"); err != nil {
+		t.Errorf("Expected no errors but got %s", err)
+	}
+	res, err := fs.Ls()
+	assertMatchesAndNoErrors(res, err, "old.txt", t)
+	if found := fs.FindFileOrDir("new.txt", true); len(found) != 0 {
+		t.Errorf("Expected no results but got %v", found)
+	}
+
+	// Removed entries are still listed and found, though they are gone
+	fs.Rm("old.txt", false)
+	if _, err := fs.Stat("old.txt"); err == nil {
+		t.Errorf("Expected old.txt to be gone")
+	}
+	res, err = fs.Ls()
+	assertMatchesAndNoErrors(res, err, "old.txt", t)
+	if found := fs.FindFileOrDir("old.txt", true); !stringSliceEqual(found, []string{"old.txt"}) {
+		t.Errorf("Expected [old.txt] but got %v", found)
+	}
+	if found := streamedNames(fs, "*.txt"); !stringSliceEqual(found, []string{"old.txt"}) {
+		t.Errorf("Expected FindStream to send [old.txt] but got %v", found)
+	}
+
+	// Listings catch up once the delay has passed
+	now = now.Add(time.Second)
+	res, err = fs.Ls()
+	assertMatchesAndNoErrors(res, err, "new.txt", t)
+	if found := streamedNames(fs, "*.txt"); !stringSliceEqual(found, []string{"new.txt"}) {
+		t.Errorf("Expected FindStream to send [new.txt] but got %v", found)
+	}
+}
+
+// Returns the names of the entries FindStream sends for the pattern, searching from the root
+func streamedNames(fs *Filesystem, pattern string) []string {
+	matches, _, _ := fs.FindStream(FindOptions{Root: "~", Pattern: pattern})
+	names := []string{}
+	for match := range matches {
+		names = append(names, match.Entry.Name)
+	}
+	return names
+}
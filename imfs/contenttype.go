@@ -0,0 +1,46 @@
+package imfs
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"mime"
+	"net/http"
+	"path/filepath"
+)
+
+// Detects the MIME type of a file, e.g. "text/plain; charset=utf-8". Well-known extensions take
+// priority; otherwise the type is sniffed from the contents using http.DetectContentType. The
+// result is cached on the file until it is next modified.
+//
+// Parameters:
+//
+//	path (string) - the path of the file, relative to the current directory or absolute
+//
+// Returns:
+//
+//	string - the detected content type
+//	error - an error if the file does not exist or is a directory
+func (fs *Filesystem) DetectContentType(path string) (string, error) {
+	file, err := fs.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if file.IsDirectory() {
+		return "", fmt.Errorf("File %s is a directory", path)
+	}
+	return contentType(file), nil
+}
+
+// Implements DetectContentType
+func contentType(file *util.File) string {
+	if contentType, ok := file.GetCachedContentType(); ok {
+		return contentType
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(file.GetName()))
+	if contentType == "" {
+		contentType = http.DetectContentType(file.GetContents())
+	}
+	file.SetCachedContentType(contentType)
+	return contentType
+}
@@ -0,0 +1,34 @@
+// contenttype_test.go
+package imfs
+
+import (
+	"testing"
+)
+
+func TestDetectContentType(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.MkFile("page.html")
+	fs.MkFile("data")
+
+	// Known extensions are used even when the file is empty
+	res, err := fs.DetectContentType("page.html")
+	assertMatchesAndNoErrors(res, err, "text/html; charset=utf-8", t)
+
+	// Otherwise the contents are sniffed
+	fs.WriteFile("data", "hello world")
+	res, err = fs.DetectContentType("~/data")
+	assertMatchesAndNoErrors(res, err, "text/plain; charset=utf-8", t)
+
+	// The cached type is refreshed after a write
+	fs.WriteFile("data", "\x00\x01")
+	res, err = fs.DetectContentType("data")
+	assertMatchesAndNoErrors(res, err, "application/octet-stream", t)
+
+	res, err = fs.DetectContentType("dir1")
+	assertErrorAndEmptyResult(res, err, "File dir1 is a directory", t)
+
+	res, err = fs.DetectContentType("missing")
+	assertErrorAndEmptyResult(res, err, "File not found: missing (resolving missing from /)", t)
+}
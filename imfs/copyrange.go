@@ -0,0 +1,99 @@
+package imfs
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+)
+
+// Copies a range of bytes from one file into another, like `dd conv=notrunc`: up to n bytes are
+// read from src starting at srcOff and written over dst starting at dstOff. Bytes of dst outside
+// the range are kept, and if dstOff is past its end the gap is filled with zeros. Fewer bytes are
+// copied when src ends first. Both may be the same file, in which case the range is read before
+// anything is written. Symbolic links are followed.
+//
+// Parameters:
+//
+//	src (string) - the file to copy from, relative to the current directory or absolute
+//	srcOff (int) - where to start reading in src
+//	dst (string) - the file to copy into, which must exist
+//	dstOff (int) - where to start writing in dst
+//	n (int) - how many bytes to copy, or -1 to copy up to the end of src
+//
+// Returns:
+//
+//	int - the number of bytes copied, 0 once srcOff is at or past the end of src
+//	error - an error if either path doesn't exist or isn't a regular file, an offset is invalid,
+//	        or there isn't enough space to grow dst
+func (fs *Filesystem) CopyRange(src string, srcOff int, dst string, dstOff int, n int) (int, error) {
+	copied := 0
+	_, err := fs.runHooks(&OperationEvent{Op: OperationWrite, Path: dst, Target: src}, func() (string, error) {
+		if fs.replica {
+			return "", ErrReadOnly
+		}
+		if srcOff < 0 || dstOff < 0 {
+			return "", fmt.Errorf("Invalid offset: %d", min(srcOff, dstOff))
+		}
+		if srcOff > util.MaxFileSize || dstOff > util.MaxFileSize {
+			return "", fmt.Errorf("Invalid offset: %d", max(srcOff, dstOff))
+		}
+		from, err := fs.copyRangeFile(src)
+		if err != nil {
+			return "", err
+		}
+		to, err := fs.copyRangeFile(dst)
+		if err != nil {
+			return "", err
+		}
+		copied, err = fs.copyRange(from, srcOff, to, dstOff, n)
+		return "", err
+	})
+	return copied, err
+}
+
+// Returns the regular file at path for CopyRange
+func (fs *Filesystem) copyRangeFile(path string) (*util.File, error) {
+	file, err := fs.follow(path)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsDirectory() || file.IsFifo() || file.GetKind().IsSpecial() || file.IsVirtual() {
+		return nil, fmt.Errorf("File %s is not a regular file; cannot copy a range", path)
+	}
+	return file, nil
+}
+
+// Implements CopyRange, journaling the new contents of dst
+func (fs *Filesystem) copyRange(src *util.File, srcOff int, dst *util.File, dstOff int, n int) (int, error) {
+	data := src.GetContents()
+	if srcOff >= len(data) {
+		return 0, nil
+	}
+	data = data[srcOff:]
+	if n >= 0 && n < len(data) {
+		data = data[:n]
+	}
+
+	// Checked before adding, since dstOff+len(data) could overflow
+	if dstOff > util.MaxFileSize-len(data) {
+		return 0, fmt.Errorf("Invalid offset: %d", dstOff)
+	}
+	contents := dst.GetContents()
+	size := max(len(contents), dstOff+len(data))
+	switch {
+	case size > util.MaxFileSize:
+		return 0, fmt.Errorf("Invalid size: %d", size)
+	case size-len(contents) > fs.spaceLeft():
+		return 0, ErrNoSpace
+	}
+	updated := make([]byte, size)
+	copy(updated, contents)
+	copy(updated[dstOff:], data)
+	if err := setSparseContents(dst, updated, dstOff, len(data)); err != nil {
+		return 0, err
+	}
+	fs.countAccess(src, OperationRead, len(data))
+	fs.countAccess(dst, OperationWrite, len(data))
+	fs.touch(dst)
+	fs.record(JournalEntry{Op: OpPut, Path: dst.GetFullPathName(fs.root), Data: updated})
+	return len(data), nil
+}
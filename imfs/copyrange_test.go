@@ -0,0 +1,86 @@
+// copyrange_test.go
+package imfs
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCopyRange(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkFile("src")
+	fs.WriteFile("src", "0123456789")
+	fs.MkFile("dst")
+	fs.WriteFile("dst", "abcdef")
+
+	// Overwrites in place, keeping the rest of dst
+	n, err := fs.CopyRange("src", 2, "~/dst", 1, 3)
+	if err != nil || n != 3 {
+		t.Fatalf("Expected 3 bytes copied, got %d, %v", n, err)
+	}
+	res, err := fs.ReadFile("dst")
+	assertMatchesAndNoErrors(res, err, "a234ef", t)
+
+	// Stops at the end of src, and pads the gap past the end of dst with zeros
+	n, err = fs.CopyRange("src", 8, "dst", 8, 100)
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 bytes copied, got %d, %v", n, err)
+	}
+	data, err := fs.Bytes("dst")
+	assertMatchesAndNoErrors(string(data), err, "a234ef\x00\x0089", t)
+
+	// -1 copies to the end, and a file can be copied onto itself
+	n, err = fs.CopyRange("src", 5, "src", 0, -1)
+	if err != nil || n != 5 {
+		t.Fatalf("Expected 5 bytes copied, got %d, %v", n, err)
+	}
+	res, err = fs.ReadFile("src")
+	assertMatchesAndNoErrors(res, err, "5678956789", t)
+
+	// Nothing to copy past the end of src
+	if n, err := fs.CopyRange("src", 10, "dst", 0, 4); err != nil || n != 0 {
+		t.Errorf("Expected nothing copied past the end, got %d, %v", n, err)
+	}
+
+	fs.MkDir("dir")
+	if _, err := fs.CopyRange("src", 0, "dir", 0, 1); err == nil {
+		t.Errorf("Expected an error copying into a directory")
+	}
+	if _, err := fs.CopyRange("src", 0, "missing", 0, 1); err == nil {
+		t.Errorf("Expected an error copying into a missing file")
+	}
+	if _, err := fs.CopyRange("src", -1, "dst", 0, 1); err == nil {
+		t.Errorf("Expected an error for a negative offset")
+	}
+
+	// Offsets too large for any file fail instead of overflowing
+	for _, offsets := range [][2]int{{0, math.MaxInt}, {math.MaxInt, 0}} {
+		if _, err := fs.CopyRange("src", offsets[0], "dst", offsets[1], -1); err == nil || err.Error() != "Invalid offset: 9223372036854775807" {
+			t.Errorf("Expected error: Invalid offset: 9223372036854775807 but got %v", err)
+		}
+	}
+
+	// Copies are journaled
+	replica := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err = replica.Bytes("dst")
+	assertMatchesAndNoErrors(string(data), err, "a234ef\x00\x0089", t)
+}
+
+func TestCopyRangeCapacity(t *testing.T) {
+	fs := NewFileSystemWithOptions(Options{Capacity: 4*NodeOverhead + 100})
+	fs.MkFile("src")
+	fs.WriteFile("src", "0123456789")
+	fs.MkFile("dst")
+
+	if _, err := fs.CopyRange("src", 0, "dst", 1000, -1); err != ErrNoSpace {
+		t.Errorf("Expected ErrNoSpace, got %v", err)
+	}
+	if data, _ := fs.Bytes("dst"); len(data) != 0 {
+		t.Errorf("Expected dst unchanged, got %d bytes", len(data))
+	}
+}
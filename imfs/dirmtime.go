@@ -0,0 +1,30 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+	"path"
+)
+
+// With Options.DirModTimes, marks the directories whose entries a journal entry added, removed or
+// renamed as modified now, as POSIX requires. Only called on the storage, whose journal sees the
+// changes made through its views too. A recursive removal only changes the directory it removed
+// from, since the others are gone with it. Paths loaded from the backing store keep the
+// modification times of the store.
+func (fs *Filesystem) updateDirModTimes(entry JournalEntry) {
+	if !fs.opts.DirModTimes || fs.loadingBacking {
+		return
+	}
+	changed := []string{}
+	switch entry.Op {
+	case OpMkDir, OpMkFile, OpMkFifo, OpMkSpecial, OpSymlink, OpMkRemote, OpRm:
+		changed = append(changed, path.Dir(entry.Path))
+	case OpMv:
+		changed = append(changed, path.Dir(entry.Path), path.Dir(entry.Target))
+	}
+	now := fs.now()
+	for _, dirPath := range changed {
+		if dir := util.LookupPath(fs.root, dirPath); dir != nil && dir.IsDirectory() {
+			dir.SetModTime(now)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// dirmtime_test.go
+package imfs
+
+import (
+	"testing"
+	"time"
+)
+
+// Fails the test unless each directory was last modified at the given time
+func assertModTimes(fs *Filesystem, expected map[string]time.Time, t *testing.T) {
+	t.Helper()
+	for path, modTime := range expected {
+		entry, err := fs.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !entry.ModTime.Equal(modTime) {
+			t.Errorf("Expected %s modified at %v, got %v", path, modTime, entry.ModTime)
+		}
+	}
+}
+
+func TestDirModTimes(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := start
+	fs := NewFileSystemWithOptions(Options{DirModTimes: true, Now: func() time.Time { return now }})
+	for _, dir := range []string{"~/a", "~/a/b", "~/a/b/c", "~/d"} {
+		fs.MkDir(dir)
+	}
+	fs.MkFile("~/a/b/c/deep.txt")
+
+	// Creating an entry updates its directory, but not the ones above
+	now = start.Add(time.Minute)
+	created := now
+	fs.MkFile("~/a/new.txt")
+	assertModTimes(fs, map[string]time.Time{"~/a": created, "~/": start, "~/a/b": start}, t)
+
+	// Writing to a file doesn't
+	now = start.Add(2 * time.Minute)
+	fs.WriteFile("~/a/new.txt", "hello")
+	assertModTimes(fs, map[string]time.Time{"~/a": created}, t)
+
+	// Removing a whole subtree only updates the directory it was removed from
+	now = start.Add(3 * time.Minute)
+	removed := now
+	fs.Cd("~/a")
+	if _, err := fs.Rm("b", true); err != nil {
+		t.Fatal(err)
+	}
+	assertModTimes(fs, map[string]time.Time{"~/a": removed, "~/": start}, t)
+
+	// Moving updates both directories
+	now = start.Add(4 * time.Minute)
+	if _, err := fs.MvFile("new.txt", "~/d"); err != nil {
+		t.Fatal(err)
+	}
+	assertModTimes(fs, map[string]time.Time{"~/a": now, "~/d": now, "~/": start}, t)
+
+	// So do links, and changes made through a view
+	now = start.Add(5 * time.Minute)
+	fs.Symlink("new.txt", "~/d/link")
+	assertModTimes(fs, map[string]time.Time{"~/d": now}, t)
+	view, err := fs.Chroot("~/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = start.Add(6 * time.Minute)
+	view.MkDir("e")
+	assertModTimes(fs, map[string]time.Time{"~/d": now, "~/d/e": now}, t)
+}
+
+func TestDirModTimesDisabled(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := start
+	fs := NewFileSystemWithOptions(Options{Now: func() time.Time { return now }})
+	fs.MkDir("a")
+
+	now = start.Add(time.Minute)
+	fs.MkFile("~/a/new.txt")
+	fs.Cd("a")
+	fs.Rm("new.txt", false)
+	assertModTimes(fs, map[string]time.Time{"~/a": start}, t)
+}
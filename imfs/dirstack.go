@@ -0,0 +1,102 @@
+package imfs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"strings"
+)
+
+// Changes back to the directory we were in before the last Cd (or CdPrevious), like `cd -`.
+// Calling it twice toggles between the two directories.
+//
+// Returns:
+//
+//	string - the name of the new current directory
+//	error - an error if there is no previous directory or it has been removed since
+func (fs *Filesystem) CdPrevious() (string, error) {
+	if fs.previousDirectory == nil {
+		return "", errors.New("No previous directory")
+	}
+	if !fs.attached(fs.previousDirectory) {
+		return "", errors.New("Previous directory no longer exists")
+	}
+	fs.changeDirectory(fs.previousDirectory)
+	return fs.currentDirectory.GetName(), nil
+}
+
+// Saves the current directory on the directory stack and changes to the specified path, like
+// `pushd`
+//
+// Parameters:
+//
+//	path (string) - the directory to change to
+//
+// Returns:
+//
+//	string - the directory stack after the change (see Dirs), separated by a space
+//	error - an error if the path is invalid
+func (fs *Filesystem) PushDir(path string) (string, error) {
+	previous := fs.currentDirectory
+	if _, err := fs.Cd(path); err != nil {
+		return "", err
+	}
+	fs.dirStack = append(fs.dirStack, previous)
+	return fs.formatDirs(), nil
+}
+
+// Removes the most recently pushed directory from the directory stack and changes to it, like
+// `popd`
+//
+// Returns:
+//
+//	string - the directory stack after the change (see Dirs), separated by a space
+//	error - an error if the stack is empty or the directory has been removed since it was pushed
+func (fs *Filesystem) PopDir() (string, error) {
+	if len(fs.dirStack) == 0 {
+		return "", errors.New("Directory stack empty")
+	}
+	top := fs.dirStack[len(fs.dirStack)-1]
+	fs.dirStack = fs.dirStack[:len(fs.dirStack)-1]
+	if !fs.attached(top) {
+		return "", fmt.Errorf("Directory %s no longer exists", top.GetName())
+	}
+	fs.changeDirectory(top)
+	return fs.formatDirs(), nil
+}
+
+// Returns the current directory followed by the directory stack, most recently pushed first,
+// like `dirs`. Directories removed since they were pushed are listed by name only.
+func (fs *Filesystem) Dirs() []string {
+	dirs := []string{fs.Pwd()}
+	for i := len(fs.dirStack) - 1; i >= 0; i-- {
+		dir := fs.dirStack[i]
+		if fs.attached(dir) {
+			dirs = append(dirs, fullPath(dir, fs.root))
+		} else {
+			dirs = append(dirs, dir.GetName())
+		}
+	}
+	return dirs
+}
+
+// Returns the directory stack as printed by pushd/popd
+func (fs *Filesystem) formatDirs() string {
+	return strings.Join(fs.Dirs(), " ")
+}
+
+// Makes dir the current directory, remembering the one we left for CdPrevious
+func (fs *Filesystem) changeDirectory(dir *util.File) {
+	if dir != fs.currentDirectory {
+		fs.previousDirectory = fs.currentDirectory
+	}
+	fs.currentDirectory = dir
+}
+
+// Returns the absolute path of the file, which is "/" for the root
+func fullPath(f *util.File, root *util.File) string {
+	if f == root {
+		return "/"
+	}
+	return f.GetFullPathName(root)
+}
@@ -0,0 +1,58 @@
+// dirstack_test.go
+package imfs
+
+import (
+	"testing"
+)
+
+func TestCdPrevious(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.MkDir("dir2")
+
+	res, err := fs.Cd("-")
+	assertErrorAndEmptyResult(res, err, "No previous directory", t)
+
+	// "cd -" toggles between the last two directories
+	fs.Cd("dir1")
+	fs.Cd("~/dir2")
+	res, err = fs.Cd("-")
+	assertMatchesAndNoErrors(res, err, "dir1", t)
+	res, err = fs.CdPrevious()
+	assertMatchesAndNoErrors(res, err, "dir2", t)
+
+	// Removed directories can't be returned to
+	fs.Cd("..")
+	fs.Rm("dir2", false)
+	res, err = fs.Cd("-")
+	assertErrorAndEmptyResult(res, err, "Previous directory no longer exists", t)
+}
+
+func TestDirStack(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.MkDir("dir1/dir2")
+
+	res, err := fs.PushDir("dir1")
+	assertMatchesAndNoErrors(res, err, "/dir1 /", t)
+	res, err = fs.PushDir("dir2")
+	assertMatchesAndNoErrors(res, err, "/dir1/dir2 /dir1 /", t)
+	if dirs := fs.Dirs(); !stringSliceEqual(dirs, []string{"/dir1/dir2", "/dir1", "/"}) {
+		t.Errorf("Unexpected directory stack: %v", dirs)
+	}
+
+	res, err = fs.PopDir()
+	assertMatchesAndNoErrors(res, err, "/dir1 /", t)
+	res, err = fs.PopDir()
+	assertMatchesAndNoErrors(res, err, "/", t)
+	res, err = fs.PopDir()
+	assertErrorAndEmptyResult(res, err, "Directory stack empty", t)
+
+	// Invalid paths aren't pushed
+	res, err = fs.PushDir("missing")
+	if err == nil || len(fs.Dirs()) != 1 {
+		t.Errorf("Expected an error and an unchanged stack but got %s, %v", res, fs.Dirs())
+	}
+}
@@ -0,0 +1,5 @@
+// Package imfs is an in-memory filesystem. Create one with NewFileSystem (or
+// NewFileSystemWithOptions) and use the returned *Filesystem much like a shell: MkDir, Cd, Ls,
+// MkFile, WriteFile, ReadFile, MvFile, Rm and so on, or Open a FileHandle for incremental reads
+// and writes. The tree's nodes are internal; use LsEntries and FindEntries to inspect them.
+package imfs
@@ -0,0 +1,125 @@
+package imfs
+
+import (
+	"crypto/sha256"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"sort"
+)
+
+// Files with identical contents, as returned by FindDuplicates
+type DuplicateGroup struct {
+	// The size of each file
+	Size int
+	// The full paths of the files, in name order
+	Paths []string
+}
+
+// Returns the bytes that would be saved by keeping a single copy of the group's contents
+func (g DuplicateGroup) Wasted() int {
+	return g.Size * (len(g.Paths) - 1)
+}
+
+// Finds regular files with identical contents (compared by SHA-256) in a subtree. Empty files,
+// pipes, special nodes, symbolic links and virtual files are ignored. Symbolic links along the
+// path are followed, but not those inside the subtree.
+//
+// Parameters:
+//
+//	root (string) - the directory to search, relative to the current one or absolute (with "~")
+//
+// Returns:
+//
+//	[]DuplicateGroup - the groups of two or more identical files, most wasted bytes first, then
+//	                   by first path
+//	error - an error if the path doesn't exist
+func (fs *Filesystem) FindDuplicates(root string) ([]DuplicateGroup, error) {
+	groups, err := fs.duplicateFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	duplicates := make([]DuplicateGroup, 0, len(groups))
+	for _, files := range groups {
+		duplicates = append(duplicates, DuplicateGroup{
+			Size:  len(files[0].GetContents()),
+			Paths: util.Map(files, func(f *util.File) string { return fullPath(f, fs.root) }),
+		})
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Wasted() != duplicates[j].Wasted() {
+			return duplicates[i].Wasted() > duplicates[j].Wasted()
+		}
+		return duplicates[i].Paths[0] < duplicates[j].Paths[0]
+	})
+	return duplicates, nil
+}
+
+// Makes the identical files found by FindDuplicates share a single copy of their contents,
+// saving memory. This is the in-memory equivalent of replacing duplicates with hard links, except
+// that the files stay independent: writing to one of them copies the contents first, so the
+// others don't change. Nothing observable changes, so this is allowed on replicas too, but
+// frozen filesystems are left untouched (see GC, which shares contents across the whole tree).
+//
+// Parameters:
+//
+//	root (string) - the directory to search, relative to the current one or absolute (with "~")
+//
+// Returns:
+//
+//	int - the bytes of storage no longer referenced by the files
+//	error - an error if the path doesn't exist
+func (fs *Filesystem) ShareDuplicates(root string) (int, error) {
+	defer fs.enter(OperationWrite, root)()
+	groups, err := fs.duplicateFiles(root)
+	if err != nil || fs.frozen {
+		return 0, err
+	}
+
+	reclaimed := 0
+	for _, files := range groups {
+		blocks := make(map[*byte]int)
+		for _, f := range files {
+			block, size := f.ContentsBlock()
+			blocks[block] = size
+		}
+		shared := files[0].GetContents()
+		if _, size := files[0].ContentsBlock(); size != len(shared) {
+			shared = append([]byte{}, shared...)
+			reclaimed -= len(shared)
+		} else {
+			delete(blocks, &shared[0])
+		}
+		for _, f := range files {
+			f.ShareContents(shared)
+		}
+		for _, size := range blocks {
+			reclaimed += size
+		}
+	}
+	return reclaimed, nil
+}
+
+// Returns the groups of two or more non-empty regular files under root with identical contents,
+// each in name order, keyed by the hash of their contents
+func (fs *Filesystem) duplicateFiles(root string) (map[[sha256.Size]byte][]*util.File, error) {
+	dir, err := fs.follow(root)
+	if err != nil {
+		return nil, err
+	}
+
+	byHash := make(map[[sha256.Size]byte][]*util.File)
+	util.WalkTree(dir, func(f *util.File) {
+		if f.IsDirectory() || f.IsVirtual() || f.GetKind() != util.KindRegular {
+			return
+		}
+		if contents := f.GetContents(); len(contents) > 0 {
+			key := sha256.Sum256(contents)
+			byHash[key] = append(byHash[key], f)
+		}
+	})
+	for key, files := range byHash {
+		if len(files) < 2 {
+			delete(byHash, key)
+		}
+	}
+	return byHash, nil
+}
@@ -0,0 +1,90 @@
+// duplicates_test.go
+package imfs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newDuplicatesFixture(t *testing.T) *Filesystem {
+	fs := NewFileSystem()
+	err := fs.LoadFixture(strings.NewReader(`entries:
+  - path: a.txt
+    contents: hello
+  - path: docs/b.txt
+    contents: hello
+  - path: docs/c.txt
+    contents: hello
+  - path: docs/big1
+    contents: "0123456789A"
+  - path: docs/big2
+    contents: "0123456789A"
+  - path: docs/unique
+    contents: other
+  - path: empty1
+  - path: empty2
+  - path: pipe
+    type: fifo
+    contents: hello
+  - path: link
+    target: a.txt
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestFindDuplicates(t *testing.T) {
+	fs := newDuplicatesFixture(t)
+
+	groups, err := fs.FindDuplicates("~")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []DuplicateGroup{
+		{Size: 11, Paths: []string{"/docs/big1", "/docs/big2"}},
+		{Size: 5, Paths: []string{"/a.txt", "/docs/b.txt", "/docs/c.txt"}},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, groups)
+	}
+
+	groups, _ = fs.FindDuplicates("docs")
+	if len(groups) != 2 || !stringSliceEqual(groups[1].Paths, []string{"/docs/b.txt", "/docs/c.txt"}) {
+		t.Errorf("Expected only the duplicates inside docs, got %+v", groups)
+	}
+
+	if _, err := fs.FindDuplicates("missing"); err == nil {
+		t.Errorf("Expected an error for a missing path")
+	}
+}
+
+func TestShareDuplicates(t *testing.T) {
+	fs := newDuplicatesFixture(t)
+	fs.Cd("docs")
+	fs.WriteFile("b.txt", "")
+
+	// b.txt's contents now have spare capacity, so the group gets a fresh, exact copy
+	reclaimed, err := fs.ShareDuplicates("~")
+	if err != nil || reclaimed <= 10 {
+		t.Errorf("Expected more than 10 bytes reclaimed, got %d (%v)", reclaimed, err)
+	}
+	a, _ := fs.root.GetChildByName("a.txt").ContentsBlock()
+	c, _ := fs.currentDirectory.GetChildByName("c.txt").ContentsBlock()
+	if a != c {
+		t.Errorf("Expected a.txt and docs/c.txt to share their contents")
+	}
+
+	if reclaimed, _ := fs.ShareDuplicates("~"); reclaimed != 0 {
+		t.Errorf("Expected nothing left to reclaim, got %d", reclaimed)
+	}
+
+	fs.WriteFile("c.txt", "!")
+	res, err := fs.ReadFile("c.txt")
+	assertMatchesAndNoErrors(res, err, "hello!", t)
+	fs.Cd("~")
+	res, err = fs.ReadFile("a.txt")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+}
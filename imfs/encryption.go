@@ -0,0 +1,101 @@
+package imfs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Returned when loading encrypted data into a filesystem that doesn't have the right key
+var ErrNoEncryptionKey = errors.New("Data is encrypted but no encryption key was provided")
+
+// Replaces the key used to encrypt file contents that leave the filesystem (snapshots, change
+// streams, SQLite exports and the journal). Anything exported or journaled afterwards is encrypted with the new
+// key; data exported earlier, and the journal entries already kept, still need the old key to
+// load. Passing a nil key disables encryption. The key is copied.
+//
+// Parameters:
+//
+//	newKey ([]byte) - a 16, 24 or 32 byte AES key, or nil
+//
+// Returns:
+//
+//	error - an error if the key is not a valid AES key
+func (fs *Filesystem) Rekey(newKey []byte) error {
+	defer fs.enter(OperationWrite, "")()
+	if newKey != nil {
+		if _, err := newAEAD(newKey); err != nil {
+			return err
+		}
+	}
+	fs.opts.EncryptionKey = copyKey(newKey)
+	return nil
+}
+
+// Returns a copy of a key, so the caller changing its slice doesn't change the filesystem's key
+func copyKey(key []byte) []byte {
+	if key == nil {
+		return nil
+	}
+	return append([]byte{}, key...)
+}
+
+// Returns true if exported contents should be encrypted
+func (fs *Filesystem) encrypted() bool {
+	return fs.opts.EncryptionKey != nil
+}
+
+// Encrypts the data using AES-GCM with the filesystem's key. The random nonce is prepended to the
+// result.
+func (fs *Filesystem) seal(data []byte) ([]byte, error) {
+	aead, err := newAEAD(fs.opts.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// Returns the entry with its Data sealed, for the journal of an encrypted filesystem
+func (fs *Filesystem) sealEntry(entry JournalEntry) JournalEntry {
+	data, err := fs.seal(entry.Data)
+	if err != nil {
+		// Only if the system's random source fails: drop the contents rather than keep them in
+		// plain text, so replicas report the entry as truncated
+		data = nil
+	}
+	entry.Data, entry.Encrypted = data, true
+	return entry
+}
+
+// Decrypts data previously encrypted by seal
+func (fs *Filesystem) unseal(data []byte) ([]byte, error) {
+	if !fs.encrypted() {
+		return nil, ErrNoEncryptionKey
+	}
+	aead, err := newAEAD(fs.opts.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("Encrypted data is truncated")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("Unable to decrypt data; the key may be wrong")
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid encryption key: %s", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,97 @@
+// encryption_test.go
+package imfs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncryptedSnapshots(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+
+	// Set up test subject
+	fs := NewFileSystemWithOptions(Options{EncryptionKey: key})
+	fs.MkFile("secret.env")
+	fs.WriteFile("secret.env", "PASSWORD=hunter2")
+
+	var buf bytes.Buffer
+	if err := fs.SaveSnapshot(&buf, FormatJSON); err != nil {
+		t.Fatalf("Expected no errors but got %s", err.Error())
+	}
+	if bytes.Contains(buf.Bytes(), []byte("hunter2")) || bytes.Contains(buf.Bytes(), []byte("UEFTU1dPUkQ9aHVudGVyMg")) {
+		t.Errorf("Expected the snapshot not to contain the plaintext contents: %s", buf.String())
+	}
+	encrypted := buf.Bytes()
+
+	// Loading without the key should fail
+	err := NewFileSystem().LoadSnapshot(bytes.NewReader(encrypted))
+	if err == nil || err.Error() != "Invalid snapshot: /secret.env: "+ErrNoEncryptionKey.Error() {
+		t.Errorf("Expected a missing key error but got %s", err)
+	}
+
+	// Loading with the key should succeed
+	loaded := NewFileSystemWithOptions(Options{EncryptionKey: key})
+	if err := loaded.LoadSnapshot(bytes.NewReader(encrypted)); err != nil {
+		t.Fatalf("Expected no errors but got %s", err.Error())
+	}
+	res, err := loaded.ReadFile("secret.env")
+	assertMatchesAndNoErrors(res, err, "PASSWORD=hunter2", t)
+
+	// After rotating the key, the old snapshot can no longer be loaded
+	if err := loaded.Rekey(bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatalf("Expected no errors but got %s", err.Error())
+	}
+	err = loaded.LoadSnapshot(bytes.NewReader(encrypted))
+	if err == nil || err.Error() != "Invalid snapshot: /secret.env: Unable to decrypt data; the key may be wrong" {
+		t.Errorf("Expected a decryption error but got %s", err)
+	}
+
+	// Invalid keys are rejected
+	err = loaded.Rekey([]byte("short"))
+	if err == nil || err.Error() != "Invalid encryption key: crypto/aes: invalid key size 5" {
+		t.Errorf("Expected an invalid key error but got %s", err)
+	}
+}
+
+func TestEncryptedJournal(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	fs := NewFileSystemWithOptions(Options{EncryptionKey: key, Introspection: true})
+	// The filesystem keeps its own copy of the key
+	key[0] = 9
+	var stream bytes.Buffer
+	fs.StreamJournal(&stream)
+	fs.MkFile("secret.env")
+	fs.WriteFile("secret.env", "PASSWORD=hunter2")
+
+	// Contents are sealed in the journal, its stream and /.fs
+	introspected, _ := fs.ReadFile("/.fs/journal")
+	for _, entry := range fs.Journal() {
+		if bytes.Contains(entry.Data, []byte("hunter2")) {
+			t.Errorf("Expected the journal not to contain the plaintext contents: %+v", entry)
+		}
+	}
+	if bytes.Contains(stream.Bytes(), []byte("hunter2")) || bytes.Contains(stream.Bytes(), []byte("UEFTU1dPUkQ9aHVudGVyMg")) {
+		t.Errorf("Expected the journal stream not to contain the plaintext contents: %s", stream.String())
+	}
+	if bytes.Contains([]byte(introspected), []byte("hunter2")) {
+		t.Errorf("Expected /.fs/journal not to contain the plaintext contents: %s", introspected)
+	}
+
+	// Replicas need the key to apply them
+	replica := NewFileSystemWithOptions(Options{EncryptionKey: bytes.Repeat([]byte{1}, 32)})
+	if err := replica.Follow(&stream); err != nil {
+		t.Fatal(err)
+	}
+	res, err := replica.ReadFile("secret.env")
+	assertMatchesAndNoErrors(res, err, "PASSWORD=hunter2", t)
+	plain := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		if err = plain.ApplyJournalEntry(entry); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("Expected a missing key error but got %v", err)
+	}
+}
@@ -0,0 +1,387 @@
+package imfs
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	iofs "io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// The type of a DirEntry
+type EntryType string
+
+const (
+	EntryDir  EntryType = "dir"
+	EntryFile EntryType = "file"
+	EntryFifo EntryType = "fifo"
+	// A null, zero or random special node (see MkSpecial)
+	EntryDevice  EntryType = "device"
+	EntrySymlink EntryType = "symlink"
+)
+
+// Describes a file or directory, as returned by LsEntries and FindEntries
+type DirEntry struct {
+	Name string
+	// The full path from the root
+	Path string
+	Type EntryType
+	// The length of the contents in bytes; 0 for directories and special nodes
+	Size    int
+	ModTime time.Time
+	// When the contents were last read, as recorded according to Options.Atime; the modification
+	// time if that was never recorded
+	AccessTime time.Time
+	// For symbolic links, the path the link points to
+	Target string
+	// Permission bits and owner (see Chmod and Chown)
+	Mode  os.FileMode
+	Owner string
+}
+
+// A directory entry as returned by ReadDir and WalkDir, implementing fs.DirEntry. The name and
+// type come straight from the tree; the rest of the description (size, permissions, modification
+// time and so on) is only worked out when Info is called, so listing a big directory or walking a
+// tree only pays for the entries that are looked at. Info describes the entry as it is when it's
+// called, not when it was listed.
+type LazyDirEntry struct {
+	fs   *Filesystem
+	file *util.File
+}
+
+// Returns the name of the entry, implementing fs.DirEntry
+func (e LazyDirEntry) Name() string {
+	return e.file.GetName()
+}
+
+// Returns true if the entry is a directory, implementing fs.DirEntry
+func (e LazyDirEntry) IsDir() bool {
+	return e.file.IsDirectory()
+}
+
+// Returns the type bits of the entry's mode, implementing fs.DirEntry
+func (e LazyDirEntry) Type() iofs.FileMode {
+	return entryTypeBits(fileEntryType(e.file))
+}
+
+// Describes the entry, implementing fs.DirEntry. The fs.FileInfo's Sys method returns the
+// DirEntry.
+//
+// Returns:
+//
+//	fs.FileInfo - the description
+//	error - an error satisfying errors.Is(err, fs.ErrNotExist) if the entry was removed since
+//	        it was listed
+func (e LazyDirEntry) Info() (iofs.FileInfo, error) {
+	if e.file != e.fs.root && !e.fs.attached(e.file) {
+		return nil, &iofs.PathError{Op: "stat", Path: e.Name(), Err: iofs.ErrNotExist}
+	}
+	return entryInfo{name: e.Name(), entry: e.fs.dirEntry(e.file)}, nil
+}
+
+// Describes the entry as a DirEntry, like Info
+func (e LazyDirEntry) Entry() DirEntry {
+	return e.fs.dirEntry(e.file)
+}
+
+// Lists a directory as fs.DirEntry values sorted by name, like os.ReadDir. Each is a LazyDirEntry,
+// so only the entries whose Info is called get described. Symbolic links are followed to the
+// directory, but the entries themselves describe links as links.
+//
+// Parameters:
+//
+//	path (string) - the directory to list, relative to the current directory or absolute
+//
+// Returns:
+//
+//	[]fs.DirEntry - the entries
+//	error - an error if the path doesn't exist or isn't a directory
+func (fs *Filesystem) ReadDir(path string) ([]iofs.DirEntry, error) {
+	dir, err := fs.follow(path)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.IsDirectory() {
+		return nil, fmt.Errorf("%s is not a directory", path)
+	}
+	return util.Map(dir.Children(), func(f *util.File) iofs.DirEntry { return fs.lazyEntry(f) }), nil
+}
+
+// Walks a tree like filepath.WalkDir, calling fn for the root and everything below it in lexical
+// order, with paths joined to root. fn may return fs.SkipDir to skip a directory (or the rest of
+// the directory containing a file), or fs.SkipAll to stop. Symbolic links are reported but not
+// followed, except for the root. Each directory is listed when the walk reaches it, so changes fn
+// makes further ahead in the tree are seen.
+//
+// Parameters:
+//
+//	root (string) - where to start, relative to the current directory or absolute
+//	fn (fs.WalkDirFunc) - called for every entry, with LazyDirEntry values
+//
+// Returns:
+//
+//	error - the first error fn returns other than fs.SkipDir or fs.SkipAll
+func (fs *Filesystem) WalkDir(root string, fn iofs.WalkDirFunc) error {
+	file, err := fs.follow(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = fs.walkDir(root, fs.lazyEntry(file), fn)
+	}
+	if err == iofs.SkipDir || err == iofs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// Implements WalkDir
+func (fs *Filesystem) walkDir(name string, entry LazyDirEntry, fn iofs.WalkDirFunc) error {
+	if err := fn(name, entry, nil); err != nil || !entry.IsDir() {
+		if err == iofs.SkipDir && entry.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	for _, child := range entry.file.Children() {
+		if !fs.attached(child) {
+			// Removed by fn since the directory was listed
+			continue
+		}
+		if err := fs.walkDir(path.Join(name, child.GetName()), fs.lazyEntry(child), fn); err != nil {
+			if err == iofs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *Filesystem) lazyEntry(f *util.File) LazyDirEntry {
+	return LazyDirEntry{fs: fs, file: f}
+}
+
+// Lists the contents of the specified path or current directory as typed entries, sorted by name
+//
+// Parameters:
+//
+//	paths (string) - 0 or 1 paths. If 0 provided, we'll list the contents of the current directory,
+//	                 else we'll list the contents of the specified (valid) path
+//
+// Returns:
+//
+//	[]DirEntry - the children/contents of the directory
+//	error - an error if the specified path is invalid
+func (fs *Filesystem) LsEntries(path ...string) ([]DirEntry, error) {
+	wd, err := fs.lsDir(path...)
+	if err != nil {
+		return nil, err
+	}
+	return util.Map(fs.listedChildren(wd), fs.dirEntry), nil
+}
+
+// Returns the directory Ls and LsEntries list: the one at the path if given, otherwise the
+// current one
+func (fs *Filesystem) lsDir(path ...string) (*util.File, error) {
+	if len(path) == 1 {
+		// Traverse to the end of the path
+		dir, err := util.WalkToEndOfPath(util.SplitPath(path[0]), fs.currentDirectory, fs.root)
+		if err != nil {
+			return nil, fs.pathError(path[0], err)
+		}
+		return dir, nil
+	}
+	return fs.currentDirectory, nil
+}
+
+// Lists a page of a directory's entries, sorted by name, like an object store listing with a
+// start-after marker: pass the name of the last entry of one page to get the next. Only the
+// requested entries are described, and with Options.ShardSize set, only the buckets they're in
+// are sorted, so paging through a directory with millions of entries stays cheap.
+//
+// Parameters:
+//
+//	path (string) - the directory to list, resolved like LsEntries
+//	after (string) - only entries whose names sort after this are listed; "" lists from the start
+//	limit (int) - the maximum number of entries to return, or 0 for all of them
+//
+// Returns:
+//
+//	[]DirEntry - the entries of the page, empty once the listing is exhausted
+//	error - an error if the specified path is invalid
+func (fs *Filesystem) LsPage(path string, after string, limit int) ([]DirEntry, error) {
+	dir, err := util.WalkToEndOfPath(util.SplitPath(path), fs.currentDirectory, fs.root)
+	if err != nil {
+		return nil, fs.pathError(path, err)
+	}
+
+	page := []DirEntry{}
+	dir.RangeChildrenAfter(after, func(child *util.File) bool {
+		page = append(page, fs.dirEntry(child))
+		return limit <= 0 || len(page) < limit
+	})
+	return page, nil
+}
+
+// Finds files or directories with the specified name as typed entries. Without searchSubtrees only
+// the current directory is searched, otherwise everything below it is searched breadth-first.
+//
+// Parameters:
+//
+//	target (string) - the name to look for
+//	searchSubtrees (bool) - whether to search the subdirectories of the current directory
+//
+// Returns:
+//
+//	[]DirEntry - the matching entries
+//	error - currently always nil
+func (fs *Filesystem) FindEntries(target string, searchSubtrees bool) ([]DirEntry, error) {
+	return util.Map(fs.find(fs.currentDirectory, target, searchSubtrees, NameMatch{}), fs.dirEntry), nil
+}
+
+// How names are compared with the one searched for. The zero value matches names exactly.
+type NameMatch struct {
+	// If set, case is ignored (using Unicode case folding)
+	IgnoreCase bool
+	// If set, names containing the target anywhere match, not just those equal to it
+	Substring bool
+}
+
+// Returns true if the name matches the target
+func (m NameMatch) matches(name string, target string) bool {
+	if m.IgnoreCase {
+		if m.Substring {
+			return strings.Contains(strings.ToLower(name), strings.ToLower(target))
+		}
+		return strings.EqualFold(name, target)
+	}
+	if m.Substring {
+		return strings.Contains(name, target)
+	}
+	return name == target
+}
+
+// Returns the files in dir matching target, or anywhere below it with searchSubtrees. An empty
+// target matches every name.
+func (fs *Filesystem) find(dir *util.File, target string, searchSubtrees bool, match NameMatch) []*util.File {
+	matches := fs.findCurrent(dir, target, searchSubtrees, match)
+	if fs.opts.ListingDelay <= 0 {
+		return matches
+	}
+	return fs.listed(matches, func(removed *util.File) bool {
+		parent := removed.GetParent()
+		found := parent == dir || (searchSubtrees && util.IsAncestor(dir, parent))
+		return found && (target == "" || match.matches(removed.GetName(), target))
+	})
+}
+
+// Implements find, without `Options.ListingDelay`
+func (fs *Filesystem) findCurrent(dir *util.File, target string, searchSubtrees bool, match NameMatch) []*util.File {
+	if target == "" {
+		match = NameMatch{Substring: true}
+	}
+	if searchSubtrees {
+		return util.BFS(dir, func(name string) bool { return match.matches(name, target) })
+	}
+	if match == (NameMatch{}) {
+		// Exact names can be looked up directly
+		if child := dir.GetChildByName(target); child != nil {
+			return []*util.File{child}
+		}
+		return nil
+	}
+	matches := []*util.File{}
+	dir.RangeChildren(func(child *util.File) bool {
+		if match.matches(child.GetName(), target) {
+			matches = append(matches, child)
+		}
+		return true
+	})
+	return matches
+}
+
+// Describes a single file or directory, like `stat`. Symbolic links are followed, so the entry
+// describes what the path points to.
+//
+// Parameters:
+//
+//	path (string) - the path to describe, relative to the current directory or absolute
+//
+// Returns:
+//
+//	DirEntry - the entry
+//	error - an error if any element of the path doesn't exist or symbolic links loop
+func (fs *Filesystem) Stat(path string) (DirEntry, error) {
+	file, err := fs.follow(path)
+	if err != nil {
+		return DirEntry{}, err
+	}
+	return fs.dirEntry(file), nil
+}
+
+// Describes the file as a DirEntry
+func (fs *Filesystem) dirEntry(f *util.File) DirEntry {
+	entry := DirEntry{
+		Name:       f.GetName(),
+		Path:       f.GetFullPathName(fs.root),
+		ModTime:    f.GetModTime(),
+		AccessTime: f.GetAccessTime(),
+		Mode:       f.GetMode(),
+		Owner:      f.GetOwner(),
+	}
+	switch node := f.Node().(type) {
+	case util.Dir:
+		entry.Type = EntryDir
+	case util.Symlink:
+		entry.Type = EntrySymlink
+		entry.Target = node.Target()
+	case util.RegularFile:
+		entry.Type, entry.Size = regularEntryType(node)
+	}
+	return entry
+}
+
+// Returns the entry type of a node, without working out anything else
+func fileEntryType(f *util.File) EntryType {
+	switch {
+	case f.IsDirectory():
+		return EntryDir
+	case f.IsSymlink():
+		return EntrySymlink
+	case f.IsFifo():
+		return EntryFifo
+	case f.GetKind().IsSpecial():
+		return EntryDevice
+	default:
+		return EntryFile
+	}
+}
+
+// Returns the fs.FileMode type bits of an entry type
+func entryTypeBits(t EntryType) iofs.FileMode {
+	switch t {
+	case EntryDir:
+		return iofs.ModeDir
+	case EntrySymlink:
+		return iofs.ModeSymlink
+	case EntryFifo:
+		return iofs.ModeNamedPipe
+	case EntryDevice:
+		return iofs.ModeDevice | iofs.ModeCharDevice
+	}
+	return 0
+}
+
+// Returns the entry type and size of a regular file, pipe or special node
+func regularEntryType(f util.RegularFile) (EntryType, int) {
+	switch {
+	case f.Kind() == util.KindFifo:
+		return EntryFifo, len(f.Contents())
+	case f.Kind().IsSpecial():
+		return EntryDevice, 0
+	default:
+		return EntryFile, len(f.Contents())
+	}
+}
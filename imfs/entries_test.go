@@ -0,0 +1,236 @@
+// entries_test.go
+package imfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	iofs "io/fs"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLsEntries(t *testing.T) {
+	// Set up test subject
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fs := NewFileSystemWithOptions(Options{Now: func() time.Time { return now }})
+	fs.MkDir("dir1")
+	fs.MkFile("file1")
+	fs.WriteFile("file1", "hello")
+	fs.MkFifo("pipe")
+	fs.MkSpecial("null", SpecialNull)
+
+	entries, err := fs.LsEntries()
+	if err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	expected := []DirEntry{
+		{Name: "dir1", Path: "/dir1", Type: EntryDir, ModTime: now, AccessTime: now, Mode: 0755},
+		{Name: "file1", Path: "/file1", Type: EntryFile, Size: 5, ModTime: now, AccessTime: now, Mode: 0644},
+		{Name: "null", Path: "/null", Type: EntryDevice, ModTime: now, AccessTime: now, Mode: 0644},
+		{Name: "pipe", Path: "/pipe", Type: EntryFifo, ModTime: now, AccessTime: now, Mode: 0644},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %+v but got %+v", expected, entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("Expected %+v but got %+v", expected[i], entries[i])
+		}
+	}
+
+	// Invalid paths fail
+	_, err = fs.LsEntries("missing")
+	if err == nil {
+		t.Errorf("Expected an error listing a missing directory")
+	}
+}
+
+func TestFindEntries(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.Cd("dir1")
+	fs.MkFile("file1.txt")
+	fs.Cd("..")
+
+	entries, _ := fs.FindEntries("file1.txt", false)
+	if len(entries) != 0 {
+		t.Errorf("Expected no matches in the current directory but got %+v", entries)
+	}
+
+	entries, _ = fs.FindEntries("file1.txt", true)
+	if len(entries) != 1 || entries[0].Path != "/dir1/file1.txt" || entries[0].Type != EntryFile {
+		t.Errorf("Expected to find /dir1/file1.txt but got %+v", entries)
+	}
+}
+
+func TestStat(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.Cd("dir1")
+	fs.MkFile("file1.txt")
+	fs.WriteFile("file1.txt", "hello")
+	fs.Symlink("file1.txt", "link")
+
+	entry, err := fs.Stat("~/dir1/link")
+	if err != nil || entry.Path != "/dir1/file1.txt" || entry.Type != EntryFile || entry.Size != 5 {
+		t.Errorf("Expected the link's target but got %+v (%v)", entry, err)
+	}
+	entry, err = fs.Stat("..")
+	if err != nil || entry.Type != EntryDir {
+		t.Errorf("Expected the root but got %+v (%v)", entry, err)
+	}
+	if _, err := fs.Stat("missing"); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.Cd("dir1")
+	fs.MkFile("b.txt")
+	fs.WriteFile("b.txt", "hello")
+	fs.MkDir("a")
+	fs.Symlink("b.txt", "c")
+	fs.MkFifo("d")
+	fs.Cd("~")
+	fs.Symlink("dir1", "link")
+
+	entries, err := fs.ReadDir("link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, entry := range entries {
+		got = append(got, fmt.Sprintf("%s:%v:%s", entry.Name(), entry.IsDir(), entry.Type()))
+	}
+	assertMatchesAndNoErrors(strings.Join(got, " "), nil, "a:true:d--------- b.txt:false:---------- c:false:L--------- d:false:p---------", t)
+
+	// Info is worked out when called, so it sees later changes
+	fs.Cd("dir1")
+	fs.WriteFile("b.txt", " world")
+	info, err := entries[1].Info()
+	if err != nil || info.Size() != 11 || info.Mode() != 0644 || info.Sys().(DirEntry).Path != "/dir1/b.txt" {
+		t.Errorf("Unexpected info %v (%v)", info, err)
+	}
+	fs.Rm("b.txt", false)
+	if _, err := entries[1].Info(); !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist for a removed entry, got %v", err)
+	}
+
+	if _, err := fs.ReadDir("c"); err == nil {
+		t.Errorf("Expected an error listing a file")
+	}
+	if _, err := fs.ReadDir("missing"); err == nil {
+		t.Errorf("Expected an error listing a missing directory")
+	}
+}
+
+func TestWalkDir(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkDir("a")
+	fs.MkDir("a/skip")
+	fs.MkDir("b")
+	fs.Cd("a/skip")
+	fs.MkFile("hidden.txt")
+	fs.Cd("~/b")
+	fs.MkFile("x.txt")
+	fs.MkFile("y.txt")
+	fs.Symlink("~/a", "link")
+	fs.Cd("~")
+
+	visited := []string{}
+	err := fs.WalkDir("~", func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Name() == "skip" {
+			return iofs.SkipDir
+		}
+		visited = append(visited, path)
+		return nil
+	})
+	assertMatchesAndNoErrors(strings.Join(visited, " "), err, "~ ~/a ~/b ~/b/link ~/b/x.txt ~/b/y.txt", t)
+
+	// SkipDir on a file skips the rest of its directory, and SkipAll stops the walk
+	visited = visited[:0]
+	err = fs.WalkDir("b", func(path string, entry iofs.DirEntry, err error) error {
+		visited = append(visited, path)
+		if entry.Name() == "link" {
+			return iofs.SkipDir
+		}
+		return nil
+	})
+	assertMatchesAndNoErrors(strings.Join(visited, " "), err, "b b/link", t)
+	visited = visited[:0]
+	err = fs.WalkDir("~", func(path string, entry iofs.DirEntry, err error) error {
+		visited = append(visited, path)
+		return iofs.SkipAll
+	})
+	assertMatchesAndNoErrors(strings.Join(visited, " "), err, "~", t)
+
+	// Errors from fn are returned, including the one for a missing root
+	err = fs.WalkDir("missing", func(path string, entry iofs.DirEntry, err error) error {
+		return err
+	})
+	if err == nil {
+		t.Errorf("Expected an error for a missing root")
+	}
+}
+
+func TestLsPage(t *testing.T) {
+	for _, shardSize := range []int{0, 4} {
+		fs := NewFileSystemWithOptions(Options{ShardSize: shardSize})
+		fs.MkDir("bucket")
+		fs.Cd("bucket")
+		for i := 0; i < 30; i++ {
+			fs.MkFile(fmt.Sprintf("object-%02d", i))
+		}
+		fs.Cd("~")
+
+		names := []string{}
+		after := ""
+		for pages := 0; pages < 10; pages++ {
+			page, err := fs.LsPage("bucket", after, 8)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			for _, entry := range page {
+				names = append(names, entry.Name)
+			}
+			after = page[len(page)-1].Name
+		}
+		if len(names) != 30 || names[0] != "object-00" || names[29] != "object-29" || !sort.StringsAreSorted(names) {
+			t.Errorf("Shard size %d: expected to page through all 30 objects in order, got %v", shardSize, names)
+		}
+
+		all, _ := fs.LsPage("bucket", "object-27", 0)
+		if len(all) != 2 || all[0].Name != "object-28" {
+			t.Errorf("Shard size %d: expected the last two objects, got %+v", shardSize, all)
+		}
+		if shards := util.LookupPath(fs.root, "/bucket").NumShards(); (shards > 1) != (shardSize > 0) {
+			t.Errorf("Shard size %d: unexpected number of shards %d", shardSize, shards)
+		}
+
+		// Sharding survives snapshots
+		buf := bytes.Buffer{}
+		fs.SaveSnapshot(&buf, FormatJSON)
+		fs.LoadSnapshot(&buf)
+		if shards := util.LookupPath(fs.root, "/bucket").NumShards(); (shards > 1) != (shardSize > 0) {
+			t.Errorf("Shard size %d: unexpected number of shards %d after loading a snapshot", shardSize, shards)
+		}
+	}
+
+	fs := NewFileSystem()
+	if _, err := fs.LsPage("missing", "", 1); err == nil {
+		t.Errorf("Expected an error for a missing directory")
+	}
+}
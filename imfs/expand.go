@@ -0,0 +1,144 @@
+package imfs
+
+import (
+	"bytes"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"math"
+	"sort"
+)
+
+// How ExpandArchives turns an archive file into a directory
+type ArchiveExpansion int
+
+const (
+	// Extract the entries into regular files, which can be changed and snapshotted like any other.
+	// Archives found inside are expanded too
+	ExpandExtract ArchiveExpansion = iota
+	// Mount the archive (see MountArchive), reading entries lazily from the archive file's
+	// contents. Archives inside a mount stay files
+	ExpandMount
+)
+
+// How many archives deep ExpandArchives goes, so an archive containing itself can't expand forever
+const maxArchiveNesting = 16
+
+// Finds the zip and uncompressed tar archives in a subtree, e.g. a fixture bundle that was just
+// loaded, and replaces each with a directory of the same name holding its entries. Archives are
+// recognized by their contents rather than their names, and virtual files are skipped.
+//
+// Archives that can't be expanded (e.g. because they are corrupt) are left in place, and the
+// search carries on with the others.
+//
+// Parameters:
+//
+//	path (string) - the directory to search (or a single archive), relative to the current one or
+//	                absolute
+//	how (ArchiveExpansion) - whether to extract or mount the archives
+//
+// Returns:
+//
+//	[]string - the full paths of the archives that were expanded, in the order they were expanded
+//	error - an error if the path doesn't exist, or a *BulkError listing the archives that couldn't
+//	        be expanded
+func (fs *Filesystem) ExpandArchives(path string, how ArchiveExpansion) ([]string, error) {
+	expanded := []string{}
+	_, err := fs.runHooks(&OperationEvent{Op: OperationMkDir, Path: path}, func() (string, error) {
+		if fs.replica {
+			return "", ErrReadOnly
+		}
+		root, err := fs.follow(path)
+		if err != nil {
+			return "", err
+		}
+
+		failures := bulkErrors{}
+		type pending struct {
+			file  *util.File
+			depth int
+		}
+		queue := []pending{}
+		enqueue := func(dir *util.File, depth int) {
+			for _, f := range findArchives(dir) {
+				queue = append(queue, pending{file: f, depth: depth})
+			}
+		}
+		enqueue(root, 1)
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			fullPath := next.file.GetFullPathName(fs.root)
+			dir, err := fs.expandArchive(next.file, how)
+			if err != nil {
+				failures.add(OperationMkDir, fullPath, err)
+				continue
+			}
+			expanded = append(expanded, fullPath)
+			if how == ExpandExtract && next.depth < maxArchiveNesting {
+				enqueue(dir, next.depth+1)
+			}
+		}
+		return "", failures.err()
+	})
+	return expanded, err
+}
+
+// Replaces an archive file with a directory holding its entries, returning the directory. When
+// extracting, the entries stop being decompressed as soon as they would take more than the space
+// left, so a small archive expanding to gigabytes fails with ErrNoSpace without using them.
+func (fs *Filesystem) expandArchive(file *util.File, how ArchiveExpansion) (*util.File, error) {
+	data := file.GetContents()
+	entries, err := readArchive(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	parent, name := file.GetParent(), file.GetName()
+	dir := util.NewFile(name, true, parent)
+	var room *int
+	if how == ExpandExtract {
+		left := -1
+		if space := fs.spaceLeft(); space < math.MaxInt {
+			// The archive file itself is replaced, so its space counts as free
+			left = space + nodeSize(file)
+		}
+		room = &left
+	}
+	for _, entry := range entries {
+		if err := addArchiveEntry(dir, entry, room); err != nil {
+			return nil, err
+		}
+	}
+	if treeSize(dir)-nodeSize(file) > fs.spaceLeft() {
+		return nil, ErrNoSpace
+	}
+
+	fullPath := file.GetFullPathName(fs.root)
+	fs.teardown(file)
+	fs.record(JournalEntry{Op: OpRm, Path: fullPath})
+	parent.UpsertChild(name, dir)
+	fs.touch(parent)
+	fs.recordArchiveTree(dir)
+	return dir, nil
+}
+
+// Returns the regular files in a subtree whose contents look like a zip or tar archive, in path
+// order
+func findArchives(root *util.File) []*util.File {
+	archives := []*util.File{}
+	util.WalkTree(root, func(f *util.File) {
+		if !f.IsDirectory() && f.GetKind() == util.KindRegular && !f.IsVirtual() && isArchive(f.GetContents()) {
+			archives = append(archives, f)
+		}
+	})
+	sort.SliceStable(archives, func(i, j int) bool {
+		return archives[i].GetFullPathName(root) < archives[j].GetFullPathName(root)
+	})
+	return archives
+}
+
+// Returns true if the data starts like a zip archive or an uncompressed tar archive
+func isArchive(data []byte) bool {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) || bytes.HasPrefix(data, []byte("PK\x05\x06")) {
+		return true
+	}
+	return len(data) >= 262 && string(data[257:262]) == "ustar"
+}
@@ -0,0 +1,115 @@
+// expand_test.go
+package imfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Returns a zip archive holding the given files
+func zipBytes(files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, _ := zw.Create(name)
+		w.Write(data)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestExpandArchivesExtract(t *testing.T) {
+	// Set up test subject
+	inner := zipBytes(map[string][]byte{"deep.txt": []byte("deep")})
+	outer := zipBytes(map[string][]byte{"a/b.txt": []byte("bee"), "inner.bin": inner})
+	fs := NewFileSystem()
+	fs.MkDir("bundle")
+	fs.Cd("bundle")
+	fs.MkFile("fixtures.zip")
+	fs.WriteFile("fixtures.zip", string(outer))
+	fs.MkFile("notes.txt")
+	fs.WriteFile("notes.txt", "PK is not enough")
+	fs.Cd("~")
+
+	// Archives are found by their contents, including those nested inside others
+	expanded, err := fs.ExpandArchives("bundle", ExpandExtract)
+	if err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	assertMatchesAndNoErrors(strings.Join(expanded, " "), nil, "/bundle/fixtures.zip /bundle/fixtures.zip/inner.bin", t)
+	contents, err := fs.Bytes("bundle/fixtures.zip/inner.bin/deep.txt")
+	assertMatchesAndNoErrors(string(contents), err, "deep", t)
+	contents, err = fs.Bytes("bundle/notes.txt")
+	assertMatchesAndNoErrors(string(contents), err, "PK is not enough", t)
+
+	// Extracted files are regular files, so they are snapshotted and journaled
+	loaded := NewFileSystem()
+	loaded.LoadSnapshot(bytes.NewReader(snapshotBytes(fs)))
+	contents, err = loaded.Bytes("bundle/fixtures.zip/a/b.txt")
+	assertMatchesAndNoErrors(string(contents), err, "bee", t)
+	replica := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatalf("Expected no errors replaying %+v but got %s", entry, err)
+		}
+	}
+	contents, err = replica.Bytes("bundle/fixtures.zip/inner.bin/deep.txt")
+	assertMatchesAndNoErrors(string(contents), err, "deep", t)
+}
+
+func TestExpandArchivesMount(t *testing.T) {
+	// Set up test subject
+	inner := zipBytes(map[string][]byte{"deep.txt": []byte("deep")})
+	fs := NewFileSystem()
+	fs.MkFile("bundle.zip")
+	fs.WriteFile("bundle.zip", string(zipBytes(map[string][]byte{"inner.zip": inner})))
+	fs.MkFile("broken.zip")
+	fs.WriteFile("broken.zip", "PK\x03\x04 truncated")
+
+	// Mounted archives stay lazy and nested archives stay files; broken ones are reported and kept
+	expanded, err := fs.ExpandArchives("~", ExpandMount)
+	assertMatchesAndNoErrors(strings.Join(expanded, " "), nil, "/bundle.zip", t)
+	var bulk *BulkError
+	if !errors.As(err, &bulk) || strings.Join(bulk.Paths(), " ") != "/broken.zip" {
+		t.Errorf("Expected broken.zip to fail but got %v", err)
+	}
+	contents, err := fs.Bytes("bundle.zip/inner.zip")
+	if err != nil || !bytes.Equal(contents, inner) {
+		t.Errorf("Expected the nested archive to stay a file")
+	}
+	if _, err := fs.WriteFile("~/bundle.zip/inner.zip", "x"); err == nil {
+		t.Errorf("Expected mounted files to be read-only")
+	}
+	contents, err = fs.Bytes("broken.zip")
+	assertMatchesAndNoErrors(string(contents), err, "PK\x03\x04 truncated", t)
+}
+
+func TestExpandArchivesBomb(t *testing.T) {
+	// A small archive holding 64 MiB of zeros, way over the capacity
+	bomb := zipBytes(map[string][]byte{"zeros.bin": make([]byte, 64<<20)})
+	fs := NewFileSystemWithOptions(Options{Capacity: 1 << 20})
+	fs.MkFile("bomb.zip")
+	if _, err := fs.WriteFile("bomb.zip", string(bomb)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Extraction stops once the space left is used up, rather than decompressing everything first
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := fs.ExpandArchives("bomb.zip", ExpandExtract)
+	runtime.ReadMemStats(&after)
+	if !errors.Is(err, ErrNoSpace) {
+		t.Errorf("Expected ErrNoSpace but got %v", err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+		t.Errorf("Expected the archive not to be decompressed, but %d bytes were allocated", allocated)
+	}
+	contents, err := fs.Bytes("bomb.zip")
+	if err != nil || !bytes.Equal(contents, bomb) {
+		t.Errorf("Expected the archive to be left in place, got %d bytes, %v", len(contents), err)
+	}
+}
@@ -0,0 +1,106 @@
+package imfs
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+)
+
+// The granularity of holes reported by Extents, like a disk block
+const ExtentBlockSize = 4096
+
+// A range of a file, as reported by Extents
+type Extent struct {
+	// Where the range starts, in bytes from the start of the file
+	Offset int
+	// How many bytes the range spans
+	Length int
+	// Whether the range is a hole: it reads as zeros and, on a real disk, wouldn't be stored
+	Hole bool
+}
+
+// Maps a file into data and holes, like walking it with lseek's SEEK_DATA and SEEK_HOLE, for
+// testing tools that skip the holes of sparse files. Holes are the ranges that were never
+// written: growing a file with Truncate, or writing past its end with CopyRange or over 9P,
+// leaves one between the old end and the new data, while writing zeros doesn't. Like on a disk,
+// only the ExtentBlockSize blocks a hole covers entirely are reported (including a shorter last
+// block), and the rest of the file is data. Symbolic links are followed.
+//
+// Parameters:
+//
+//	path (string) - the file to map, relative to the current directory or absolute
+//
+// Returns:
+//
+//	[]Extent - the data and holes of the file in order, covering it entirely; none for an empty file
+//	error - an error if the path doesn't exist or isn't a regular file
+func (fs *Filesystem) Extents(path string) ([]Extent, error) {
+	file, err := fs.follow(path)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsDirectory() || file.IsFifo() || file.GetKind().IsSpecial() || file.IsVirtual() {
+		return nil, fmt.Errorf("File %s is not a regular file; cannot map extents", path)
+	}
+	return extents(len(file.ContentsView()), file.Holes()), nil
+}
+
+// Splits a file of the given size into data and the whole blocks its holes cover
+func extents(size int, holes []util.Hole) []Extent {
+	result := []Extent{}
+	add := func(offset int, end int, hole bool) {
+		if end <= offset {
+			return
+		}
+		if last := len(result) - 1; last >= 0 && result[last].Hole == hole {
+			result[last].Length = end - result[last].Offset
+			return
+		}
+		result = append(result, Extent{Offset: offset, Length: end - offset, Hole: hole})
+	}
+	offset := 0
+	for _, hole := range holes {
+		start := (hole.Offset + ExtentBlockSize - 1) / ExtentBlockSize * ExtentBlockSize
+		end := hole.Offset + hole.Length
+		if end < size {
+			end = end / ExtentBlockSize * ExtentBlockSize
+		}
+		if end <= start {
+			continue
+		}
+		add(offset, start, false)
+		add(start, end, true)
+		offset = end
+	}
+	add(offset, size, false)
+	return result
+}
+
+// Replaces the contents of a regular file with updated: its old contents with written bytes
+// stored at offset, or cut or grown to a new size (with offset at that size and nothing written).
+// The file's holes are kept outside the written range and within the new size, and if offset was
+// past the old end the gap becomes a hole, like seeking past the end of a file on disk.
+func setSparseContents(file *util.File, updated []byte, offset int, written int) error {
+	size := len(file.ContentsView())
+	holes := []util.Hole{}
+	for _, hole := range file.Holes() {
+		end := min(hole.Offset+hole.Length, len(updated))
+		if before := min(end, offset) - hole.Offset; before > 0 {
+			holes = append(holes, util.Hole{Offset: hole.Offset, Length: before})
+		}
+		if after := max(hole.Offset, offset+written); end > after {
+			holes = append(holes, util.Hole{Offset: after, Length: end - after})
+		}
+	}
+	if gap := min(offset, len(updated)) - size; gap > 0 {
+		if last := len(holes) - 1; last >= 0 && holes[last].Offset+holes[last].Length == size {
+			holes[last].Length += gap
+		} else {
+			holes = append(holes, util.Hole{Offset: size, Length: gap})
+		}
+	}
+	if err := file.SetContents(updated); err != nil {
+		return err
+	}
+	file.SetHoles(holes)
+	return nil
+}
@@ -0,0 +1,75 @@
+// extents_test.go
+package imfs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtents(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkFile("sparse")
+	fs.WriteFile("sparse", "header")
+
+	// Growing the file leaves a hole after the first block
+	if err := fs.Truncate("sparse", 3*ExtentBlockSize); err != nil {
+		t.Fatal(err)
+	}
+	// Data in the middle of the last block makes it data again
+	fs.MkFile("tail")
+	fs.WriteFile("tail", "trailer")
+	if _, err := fs.CopyRange("tail", 0, "sparse", 2*ExtentBlockSize+100, -1); err != nil {
+		t.Fatal(err)
+	}
+	// And growing it again leaves a shorter hole at the end
+	if err := fs.Truncate("sparse", 4*ExtentBlockSize-10); err != nil {
+		t.Fatal(err)
+	}
+
+	extents, err := fs.Extents("~/sparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Extent{
+		{Offset: 0, Length: ExtentBlockSize},
+		{Offset: ExtentBlockSize, Length: ExtentBlockSize, Hole: true},
+		{Offset: 2 * ExtentBlockSize, Length: ExtentBlockSize},
+		{Offset: 3 * ExtentBlockSize, Length: ExtentBlockSize - 10, Hole: true},
+	}
+	if !reflect.DeepEqual(extents, expected) {
+		t.Errorf("Expected %v, got %v", expected, extents)
+	}
+
+	// Zeros that were written are data, including over a hole
+	fs.MkFile("zeros")
+	fs.WriteFile("zeros", strings.Repeat("\x00", 3*ExtentBlockSize))
+	if _, err := fs.CopyRange("zeros", 0, "sparse", ExtentBlockSize, -1); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"zeros", "sparse"} {
+		extents, err = fs.Extents(path)
+		if err != nil || len(extents) != 1 || extents[0].Hole {
+			t.Errorf("Expected %s to be a single data extent, got %v, %v", path, extents, err)
+		}
+	}
+
+	// Appending keeps files single data extents, and empty files have none
+	fs.WriteFile("tail", strings.Repeat("x", ExtentBlockSize))
+	extents, err = fs.Extents("tail")
+	if err != nil || !reflect.DeepEqual(extents, []Extent{{Offset: 0, Length: ExtentBlockSize + 7}}) {
+		t.Errorf("Expected a single data extent, got %v, %v", extents, err)
+	}
+	fs.MkFile("empty")
+	if extents, err := fs.Extents("empty"); err != nil || len(extents) != 0 {
+		t.Errorf("Expected no extents, got %v, %v", extents, err)
+	}
+
+	fs.MkDir("dir")
+	if _, err := fs.Extents("dir"); err == nil {
+		t.Errorf("Expected an error mapping a directory")
+	}
+	if _, err := fs.Extents("missing"); err == nil {
+		t.Errorf("Expected an error mapping a missing file")
+	}
+}
@@ -0,0 +1,44 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+)
+
+// Creates a named pipe (FIFO). Data written to it is buffered until it is read, and reading
+// consumes it, so a producer and a consumer can communicate through the pipe using separate
+// handles (or WriteFile/ReadFile).
+//
+// Parameters:
+//
+//	path (string) - where to create the pipe. Its parent directory must already exist
+//
+// Returns:
+//
+//	string - the name of the new pipe
+//	error - an error if the parent directory doesn't exist or the path is already taken
+func (fs *Filesystem) MkFifo(path string) (string, error) {
+	defer fs.enter(OperationMkFile, path)()
+	if fs.replica {
+		return "", ErrReadOnly
+	}
+
+	fifo, err := fs.createAt(path)
+	if err != nil {
+		return "", err
+	}
+	fifo.SetKind(util.KindFifo)
+	fs.touch(fifo)
+	fs.record(JournalEntry{Op: OpMkFifo, Path: fifo.GetFullPathName(fs.root)})
+
+	return fifo.GetName(), nil
+}
+
+// Removes and returns up to n bytes from the pipe
+func (fs *Filesystem) drainFifo(fifo *util.File, n int) []byte {
+	data := fifo.Drain(n)
+	if len(data) > 0 {
+		fs.touch(fifo)
+		fs.record(JournalEntry{Op: OpPut, Path: fifo.GetFullPathName(fs.root), Data: fifo.GetContents()})
+	}
+	return data
+}
@@ -0,0 +1,52 @@
+// fifo_test.go
+package imfs
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestMkFifo(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystemWithOptions(Options{BufferedWrites: true})
+
+	res, err := fs.MkFifo("pipe")
+	assertMatchesAndNoErrors(res, err, "pipe", t)
+
+	res, err = fs.MkFifo("pipe")
+	assertErrorAndEmptyResult(res, err, "File pipe already exists", t)
+
+	producer, _ := fs.Open("pipe")
+	consumer, _ := fs.Open("pipe")
+
+	// Reading an empty pipe returns EOF
+	buf := make([]byte, 4)
+	if _, err := consumer.Read(buf); err != io.EOF {
+		t.Errorf("Expected error: %s but got %s", io.EOF, err)
+	}
+
+	// Writes to pipes aren't buffered, and reads consume the data
+	producer.Write([]byte("hello world"))
+	n, _ := consumer.Read(buf)
+	assertMatchesAndNoErrors(string(buf[:n]), nil, "hell", t)
+	data, _ := io.ReadAll(consumer)
+	assertMatchesAndNoErrors(string(data), nil, "o world", t)
+
+	// ReadFile drains the pipe too
+	producer.Write([]byte("again"))
+	res, err = fs.ReadFile("pipe")
+	assertMatchesAndNoErrors(res, err, "again", t)
+	res, err = fs.ReadFile("pipe")
+	assertMatchesAndNoErrors(res, err, "", t)
+
+	// Pipes survive snapshots
+	producer.Write([]byte("saved"))
+	var snapshot bytes.Buffer
+	fs.SaveSnapshot(&snapshot, FormatBinary)
+	loaded := NewFileSystem()
+	loaded.LoadSnapshot(&snapshot)
+	loaded.ReadFile("pipe")
+	res, err = loaded.ReadFile("pipe")
+	assertMatchesAndNoErrors(res, err, "", t)
+}
@@ -0,0 +1,988 @@
+package imfs
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	iofs "io/fs"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Filesystem struct {
+	root             *util.File
+	currentDirectory *util.File
+	// The directory we were in before the last change, and the directories saved by PushDir
+	// (see dirstack.go)
+	previousDirectory *util.File
+	dirStack          []*util.File
+	opts              Options
+	// All handles returned by Open that have not yet been closed
+	handles map[*FileHandle]bool
+	// The number of handles ever opened, used to order them
+	handleCount uint64
+	// Saved copies of the tree, keyed by checkpoint name
+	checkpoints map[string]*checkpoint
+	// Incremented on every modification, used to tell which files changed since a checkpoint
+	generation uint64
+	// The most recent modifications (see journal.go) and the functions streaming them
+	journal            []JournalEntry
+	journalSeq         uint64
+	journalSubscribers map[int]func(JournalEntry)
+	nextSubscriberID   int
+	// Set when following another filesystem, in which case only the journal stream may modify it
+	replica    bool
+	appliedSeq uint64
+	// Set for a filesystem returned by Builder.Freeze, whose tree must never change (see builder.go)
+	frozen bool
+	// Content filters run on every read (see filters.go)
+	readFilters []*readFilter
+	// Middleware run around every operation (see hooks.go). Stored by pointer so Use can remove
+	// exactly the hook it added, since hooks aren't necessarily comparable
+	hooks []*Hook
+	// Rules making handle reads/writes short (see shortio.go)
+	shortIORules []*ShortIORule
+	// Read/write counts per path (see accessstats.go)
+	accessStats map[string]*AccessStat
+	// While an operation is running in strict mode, the ID of the goroutine running it, to detect
+	// concurrent use and let that goroutine nest operations (see strict.go). 0 otherwise
+	busy int64
+	// For a chroot view, the filesystem it was created from (see chroot.go)
+	chrootParent *Filesystem
+	// For a namespace, the supervisor that created it (see supervisor.go)
+	supervisor *Supervisor
+	// Set while Profile runs, collecting the timing of every operation (see profile.go)
+	profile *Profile
+	// Writes accepted by WriteFile but not applied yet, and the first error applying one since the
+	// last Sync (see writebehind.go)
+	pendingWrites  []pendingWrite
+	writeBehindErr error
+	// The simulated page cache, created on first use (see pagecache.go)
+	cache *pageCache
+	// The size each node of the tree is counted at, and their total, kept up to date as changes
+	// are recorded once usage is first needed (see capacity.go). Nil until then
+	usage map[*util.File]int
+	used  int
+	// The symbolic links by the path their target leads to, built on the first move with
+	// Options.RepointLinks and kept up to date as changes are recorded (see repoint.go). Nil until then
+	links *linkIndex
+	// The buffers shared by the mappings of each mapped file (see mmap.go)
+	mapped map[*util.File]*sharedBuffer
+	// Set while snapshots are saved to disk in the background (see autosave.go)
+	autosave *autosaver
+	// The fetched contents of remote files, keyed by URL (see remote.go)
+	remoteCache map[string][]byte
+	// The nodes persistent handles were handed out for, both ways, and the epoch making handles
+	// from before InvalidateHandles stale (see nodehandle.go)
+	nodeHandles   map[NodeHandle]*util.File
+	handlesByNode map[*util.File]NodeHandle
+	handleEpoch   uint32
+	handleSeq     uint32
+	// The inodes handed out so far, both ways, and the last one (see inode.go)
+	inodes     map[*util.File]InodeID
+	inodeNodes map[InodeID]*util.File
+	inodeSeq   InodeID
+	// The paths waiting to be written back to the backing store, the first error writing one back
+	// since the last SyncBacking, the SHA-256 of each file as last read from or written to the
+	// backing store, and whether a node is being loaded from it (see writeback.go)
+	pendingWriteBacks []pendingWriteBack
+	writeBackErr      error
+	backingSums       map[string][sha256.Size]byte
+	loadingBacking    bool
+	// When the entries listings don't show yet were created, and the removed entries they still
+	// show (see consistency.go)
+	listingCreated map[*util.File]time.Time
+	listingRemoved []removedEntry
+	// The index of file contents kept for Search with Options.IndexContents, once built (see
+	// search.go)
+	index *contentIndex
+}
+
+// Optional behaviors for a Filesystem. The zero value matches the behavior of NewFileSystem
+type Options struct {
+	// If set, writes made through a FileHandle are held in a per-handle buffer and only become
+	// visible to other handles/readers after Flush, Sync or Close, emulating an OS page cache
+	BufferedWrites bool
+	// Returns the current time, used for modification times. Defaults to time.Now
+	Now func() time.Time
+	// If set, file contents are encrypted with this AES key (16, 24 or 32 bytes) using AES-GCM
+	// whenever they leave the filesystem, i.e. in snapshots, change streams and the journal
+	// (including "/.fs/journal" and StreamJournal). Replicas following an encrypted filesystem
+	// need the same key. The key is copied when the filesystem is created
+	EncryptionKey []byte
+	// If set, the "/.fs" directory exposes live internals (stats, journal, open handles and
+	// checkpoints) as read-only virtual files
+	Introspection bool
+	// The source of data for random special nodes (see MkSpecial). Defaults to a time-seeded source
+	Rand *rand.Rand
+	// If positive, simulates a volume of this many bytes (see capacity.go). Once contents plus
+	// metadata reach it, new entries fail and writes are cut short with ErrNoSpace
+	Capacity int
+	// If set, every handle records the stack trace of the code that opened it, so leaked handles
+	// can be traced back (see AssertNoLeakedHandles). Off by default since capturing stacks is slow
+	TrackHandleStacks bool
+	// If set, misusing the filesystem panics with a *MisuseError describing what went wrong,
+	// rather than returning an error or silently corrupting the tree. Meant for tests. Detects
+	// writing to a directory, using a handle after it was closed or its file was removed, and
+	// concurrent use from multiple goroutines
+	Strict bool
+	// If set, every operation is wrapped in a span carrying its path, bytes transferred and error
+	// (see tracing.go)
+	Tracer Tracer
+	// If set, mutations are logged at Debug and failures at Warn with structured fields (op, path,
+	// bytes, duration). See logging.go
+	Logger *slog.Logger
+	// The minimum level logged for each subsystem, e.g. {SubsystemHandles: slog.LevelWarn} to
+	// only hear about failed handle writes. Subsystems not listed log everything the Logger's
+	// handler accepts
+	LogLevels map[Subsystem]slog.Leveler
+	// If positive, directories with more than this many entries shard them into buckets of at
+	// most this many, keyed by name prefix, so directories with millions of entries (e.g. object
+	// store listings) keep flat insert and lookup latency and can be listed a page at a time
+	// without sorting every name (see LsPage). Around 1024 works well; see the benchmarks in
+	// internal/util
+	ShardSize int
+	// If set, WriteFile returns as soon as it has checked the file can be written, and the write
+	// is applied later, once WriteBehindDelay has passed on the clock from Now. Writes are
+	// applied in the order they were made; until then, reads see the old contents. Sync waits for
+	// every queued write and reports failures applying them. Useful to test code assuming writes
+	// are visible immediately, and to measure it under asynchronous I/O
+	WriteBehind bool
+	// How long after WriteFile returns a write is applied in WriteBehind mode. With the default
+	// of zero, writes are applied at the start of the next operation
+	WriteBehindDelay time.Duration
+	// If positive, handle reads and writes go through a simulated page cache holding this many
+	// pages, which records hits and misses (see PageCacheStats). Sequential reads read ahead up
+	// to ReadAheadPages pages (DefaultReadAheadPages by default). Contents are always read from
+	// the tree; only the statistics are simulated. The views of a frozen filesystem each have
+	// their own cache
+	PageCachePages int
+	// The page size of the simulated page cache. Defaults to DefaultPageSize
+	PageSize int
+	// The most pages read ahead of a sequential read. Defaults to DefaultReadAheadPages
+	ReadAheadPages int
+	// The client fetching the contents of remote files (see MkRemoteFile). Defaults to
+	// http.DefaultClient
+	HTTPClient *http.Client
+	// How long fetching a remote file may take. Defaults to DefaultRemoteTimeout
+	RemoteTimeout time.Duration
+	// If set, WriteFile creates the file when it doesn't exist, like ">>" in a shell, rather than
+	// failing. Off by default, so writes to mistyped names fail
+	CreateOnWrite bool
+	// If set, moving or renaming a node updates the symbolic links that pointed at its old path
+	// (or below it) to point at the new one, so reorganizing a tree doesn't leave them dangling
+	// (see repoint.go). Off by default, like on a real filesystem
+	RepointLinks bool
+	// If set, the tree acts as a read-through cache of this fs.FS, e.g. os.DirFS of a directory on
+	// disk: paths missing from the tree are looked up in it when resolving them for reads and
+	// writes (see follow), and what is found is added to the tree, so each file is read from it
+	// once. Directories fill up as their entries are looked up, so listings only show what was
+	// loaded so far. Removing a loaded node only evicts it from the cache. The backing store is
+	// never written to
+	Backing iofs.FS
+	// If set, and Backing implements WritableFS, changes are written back to the backing store
+	// once WriteBackDelay has passed on the clock from Now, making the tree a write-back cache.
+	// Changes are applied in memory right away; a path changed again before it is written back is
+	// only written once. A file changed in the backing store since the tree last read or wrote it
+	// isn't overwritten: SyncBacking reports the conflict with ErrWriteBackConflict
+	WriteBack bool
+	// How long after a change it is written back. With the default of zero, changes are written
+	// back at the start of the next operation
+	WriteBackDelay time.Duration
+	// How many times writing a change back is retried, WriteBackDelay apart, before SyncBacking
+	// reports the failure. Conflicts aren't retried
+	WriteBackRetries int
+	// If set, the paths it matches (relative to the root) are never written back, e.g. build
+	// output: changes to them stay in memory, and what the backing store has there is left alone
+	WriteBackIgnore *IgnoreMatcher
+	// If positive, Ls, LsEntries and the Find functions lag this long behind changes, on the
+	// clock from Now, like the listings of an eventually consistent object store: entries created
+	// or moved in are left out of them until then, and entries removed or moved away are still
+	// listed (by name, as empty files). Stat, ReadFile and every other lookup see changes right
+	// away. Useful to exercise the retry and poll logic of clients of such stores
+	ListingDelay time.Duration
+	// If set, the index Search builds is kept and updated as files change, rather than built
+	// anew for every search. It costs memory in proportion to the words in the tree, and time
+	// on every write
+	IndexContents bool
+	// When reading a file records its access time (see DirEntry.AccessTime): never (the
+	// default, like mounting with noatime), AtimeRelatime or AtimeAlways. Frozen filesystems
+	// never record it, since their tree is shared by concurrent readers (see Builder.Freeze)
+	Atime AtimeMode
+	// If set, creating, removing or moving an entry updates the modification time of the
+	// directory it was in (or moved to), as POSIX requires, so sync tools and watchers polling
+	// directories notice. Writing to a file doesn't change its directory
+	DirModTimes bool
+	// If set, names are looked up regardless of letter case, like on macOS and Windows: "README.md"
+	// and "readme.md" name the same entry, so only one of them can exist, while entries keep the
+	// name they were created (or last renamed) with. Each directory indexes its entries by their
+	// case-folded name, so lookups cost the same as without it. Listings are ordered by the
+	// folded names
+	CaseInsensitive bool
+}
+
+// Creates a new filesystem and sets the current directory to the root ()
+func NewFileSystem() *Filesystem {
+	return NewFileSystemWithOptions(Options{})
+}
+
+// Creates a new filesystem using the provided options and sets the current directory to the root
+func NewFileSystemWithOptions(opts Options) *Filesystem {
+	opts.EncryptionKey = copyKey(opts.EncryptionKey)
+	rootDir := newRoot(opts)
+	fs := &Filesystem{
+		root:               rootDir,
+		currentDirectory:   rootDir,
+		opts:               opts,
+		handles:            make(map[*FileHandle]bool),
+		checkpoints:        make(map[string]*checkpoint),
+		journalSubscribers: make(map[int]func(JournalEntry)),
+		accessStats:        make(map[string]*AccessStat),
+	}
+	if opts.Introspection {
+		fs.mountIntrospection()
+	}
+	return fs
+}
+
+// Creates an empty root directory configured by the options
+func newRoot(opts Options) *util.File {
+	root := util.NewFile("/", true, nil)
+	root.SetShardSize(opts.ShardSize)
+	root.SetFoldNames(opts.CaseInsensitive)
+	return root
+}
+
+// Returns the current working directory, e.g. "/Users/bwent/home"
+//
+// Parameters: N/A
+// Returns:
+//
+//	string - the current working directory
+func (fs *Filesystem) Pwd() string {
+	if fs.currentDirectory == fs.root {
+		// If we're at the root, simply return "/"
+		return "/"
+	}
+	dirs := []string{}
+	// Recursively iterate from the current directory to the root, adding each parent to a list of strings
+	util.PwdRecursion(&dirs, fs.currentDirectory, fs.root)
+	return strings.Join(dirs, "/")
+}
+
+// Creates a new directory specified by "path" within the current working directory.
+// Does NOT currently support using ".." or "~" to create a new directory using either the
+// parent or the root directory
+//
+// Parameters:
+//
+//	path (string) - can be either a name (e.g. /bwent) or a full path (e.g. /bwent/home/test), as long as each
+//	                path element before the final one is an existing directory
+//
+// Returns:
+//
+//	string - the newly-created directory name
+//	error  - an error if we were unable to successfully create the directory
+func (fs *Filesystem) MkDir(path string) (string, error) {
+	return fs.runHooks(&OperationEvent{Op: OperationMkDir, Path: path}, func() (string, error) {
+		return fs.mkDir(path)
+	})
+}
+
+// Implements MkDir
+func (fs *Filesystem) mkDir(path string) (string, error) {
+	if fs.replica {
+		return "", ErrReadOnly
+	}
+
+	// Get the current working directory
+	wd := fs.currentDirectory
+
+	// Split the path into individual directory names
+	pathSplit := util.SplitPath(path)
+	length := len(pathSplit)
+
+	// The name of the new directory
+	var name string
+
+	if length == 0 {
+		return "", errors.New("Must provide at least one directory name")
+	} else if length == 1 {
+		// If there's only one element, the new dir name is the first element
+		name = pathSplit[0]
+	} else {
+		pathToTraverse := pathSplit[:len(pathSplit)-1]
+		leafNode, err := util.WalkToEndOfPath(pathToTraverse, fs.currentDirectory, fs.root)
+		if err != nil {
+			return "", fs.pathError(path, err)
+		}
+		wd = leafNode
+		// Set the dir name to the last element
+		name = pathSplit[len(pathSplit)-1]
+	}
+
+	if err := fs.reserveNode(name); err != nil {
+		return "", err
+	}
+
+	// Take the last element and add the new directory
+	newDir := util.NewFile(name, true, wd)
+	wd.UpsertChild(name, newDir)
+	fs.touch(newDir)
+	fs.record(JournalEntry{Op: OpMkDir, Path: newDir.GetFullPathName(fs.root)})
+
+	return name, nil
+}
+
+// Changes the current working directory to the specified path
+//
+// Parameters:
+//
+//	   path (string) - the path we want to navigate to. If prefixed with "~" we will
+//						  start from the root. If prefixed with ".." we'll navigate one directory up
+//						  in the tree. If "-", we'll go back to the previous directory (see CdPrevious).
+//
+// Returns:
+//
+//	string - the current working directory name
+//	error  - an error if the path provided is invalid
+func (fs *Filesystem) Cd(path string) (string, error) {
+	if path == "-" {
+		return fs.CdPrevious()
+	}
+
+	// Traverse to the end of the path specified
+	leafNode, err := util.WalkToEndOfPath(util.SplitPath(path), fs.currentDirectory, fs.root)
+	if err != nil {
+		return "", fs.pathError(path, err)
+	}
+	// Set the current working directory to the last node in the tree
+	fs.changeDirectory(leafNode)
+	return leafNode.GetName(), nil
+}
+
+// Lists the contents (files and subdirectories) of the specified path or current directory.
+//
+// Parameters:
+//
+//	paths (string) - 0 or 1 paths. If 0 provided, we'll list the contents of the current directory,
+//	                 else we'll list the contents of the specified (valid) path
+//
+// Returns:
+//
+//	string - the children/contents of the directory, separated by a space
+//	error - an error if the specified path is invalid
+func (fs *Filesystem) Ls(path ...string) (string, error) {
+	wd, err := fs.lsDir(path...)
+	if err != nil {
+		return "", err
+	}
+
+	// Return all the child directory names. Only names are needed, so the entries aren't described
+	entries := util.Map(fs.listedChildren(wd), fs.lazyEntry)
+	return strings.Join(util.Map(entries, LazyDirEntry.Name), " "), nil
+}
+
+// Removes a file or directory from the current directory. If a directory is provided, the removal must be recursive unless
+// the directory has no children.
+// Parameters:
+//
+//	path (string) -  the path of the file/directory to remove
+//	recusrive (bool) - if the removal should be done recursively to remove all sub-directories
+//
+// Returns:
+//
+//	string - the removed path name
+//	error - an error if the removal was unsuccessful
+func (fs *Filesystem) Rm(path string, recursive bool) (string, error) {
+	return fs.runHooks(&OperationEvent{Op: OperationRm, Path: path}, func() (string, error) {
+		name, _, err := fs.rm(path, recursive)
+		return name, err
+	})
+}
+
+// Same as Rm, but returns how many entries were removed: the file or directory itself plus all of
+// its descendants
+//
+// Parameters:
+//
+//	path (string) -  the path of the file/directory to remove
+//	recusrive (bool) - if the removal should be done recursively to remove all sub-directories
+//
+// Returns:
+//
+//	int - the number of entries removed
+//	error - an error if the removal was unsuccessful
+func (fs *Filesystem) RmCount(path string, recursive bool) (int, error) {
+	count := 0
+	_, err := fs.runHooks(&OperationEvent{Op: OperationRm, Path: path}, func() (string, error) {
+		name, n, err := fs.rm(path, recursive)
+		count = n
+		return name, err
+	})
+	return count, err
+}
+
+// Implements Rm and RmCount
+func (fs *Filesystem) rm(path string, recursive bool) (string, int, error) {
+	if fs.replica {
+		return "", 0, ErrReadOnly
+	}
+
+	// Sanitize the string
+	path = strings.Trim(path, "/")
+
+	wd := fs.currentDirectory
+
+	// Get the file or directory to remove
+	toRemove := wd.GetChildByName(path)
+	if toRemove == nil {
+		return "", 0, &PathError{Path: path, Err: ErrDirNotFound, Segment: path, From: fullPath(wd, fs.root)}
+	}
+	fullPath := toRemove.GetFullPathName(fs.root)
+
+	if !recursive {
+		// Can only remove non-recursively if this is a non-empty directory
+		if toRemove.IsDirectory() && toRemove.NumChildren() > 0 {
+			return "", 0, errors.New("Method does not support removing non-empty directories. Use the recursive option")
+		}
+	} else {
+		// Don't try recursion if the path provided is a file, not a directory
+		if !toRemove.IsDirectory() {
+			return "", 0, errors.New("Method does not support removing files recursively")
+		}
+	}
+	// Remove the file, or the directory and all subdirectories recursively
+	count := fs.teardown(toRemove)
+	fs.record(JournalEntry{Op: OpRm, Path: fullPath})
+
+	return toRemove.GetName(), count, nil
+}
+
+// Creates a new empty file. If the filename already exists, we'll simply append a "1" to the end.
+// Parameters:
+//
+//	path (string) - the file to create. If it has several elements, its parent directory is
+//	                resolved like MkDir's: from the root if prefixed with "~", otherwise from the
+//	                current directory. The parent must already exist (see MkFileAll)
+//
+// Returns:
+//
+//	string - the newly created file name
+//	error - an error if the file was not able to be created
+func (fs *Filesystem) MkFile(path string) (string, error) {
+	return fs.runHooks(&OperationEvent{Op: OperationMkFile, Path: path}, func() (string, error) {
+		return fs.mkFile(path, false)
+	})
+}
+
+// Creates a new empty file like MkFile, first creating any missing parent directories, like
+// `mkdir -p`.
+//
+// Parameters:
+//
+//	path (string) - the file to create, resolved like MkFile
+//
+// Returns:
+//
+//	string - the newly created file name
+//	error - an error if an element of the parent path exists but isn't a directory, or the file
+//	        was not able to be created
+func (fs *Filesystem) MkFileAll(path string) (string, error) {
+	return fs.runHooks(&OperationEvent{Op: OperationMkFile, Path: path}, func() (string, error) {
+		return fs.mkFile(path, true)
+	})
+}
+
+// Implements MkFile and MkFileAll
+func (fs *Filesystem) mkFile(path string, parents bool) (string, error) {
+	if fs.replica {
+		return "", ErrReadOnly
+	}
+
+	pathSplit := util.SplitPath(path)
+	if len(pathSplit) == 0 {
+		return "", errors.New("Must provide a file name")
+	}
+	name := pathSplit[len(pathSplit)-1]
+	if name == "~" || name == "." || name == ".." {
+		return "", fmt.Errorf("Invalid file name: %s", name)
+	}
+
+	// Resolve the directory the file goes in
+	wd := fs.currentDirectory
+	if len(pathSplit) > 1 {
+		var err error
+		if parents {
+			wd, err = fs.mkParents(path, pathSplit[:len(pathSplit)-1])
+		} else {
+			wd, err = util.WalkToEndOfPath(pathSplit[:len(pathSplit)-1], fs.currentDirectory, fs.root)
+			err = fs.pathError(path, err)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// If a file with the same name already exists in the directory, modify the name to handle collisions
+	if util.ExistsInCurrentDir(wd, name, false) {
+		name = util.ModifyNameToHandleCollisions(name)
+	}
+
+	if err := fs.reserveNode(name); err != nil {
+		return "", err
+	}
+
+	// Create the new file and set the parent to the directory
+	newFile := util.NewFile(name, false, wd)
+
+	// Add the new file to the children of the directory
+	wd.UpsertChild(name, newFile)
+	fs.touch(newFile)
+	fs.record(JournalEntry{Op: OpMkFile, Path: newFile.GetFullPathName(fs.root)})
+
+	return name, nil
+}
+
+// Walks the directories of a path from the current directory, or the root if the first is "~",
+// creating any that are missing like `mkdir -p`. path is the full path, for errors.
+func (fs *Filesystem) mkParents(path string, dirs []string) (*util.File, error) {
+	wd := fs.currentDirectory
+	if len(dirs) > 0 && dirs[0] == "~" {
+		wd = fs.root
+		dirs = dirs[1:]
+	}
+	start := wd
+
+	for _, name := range dirs {
+		switch name {
+		case ".":
+		case "..":
+			if wd != fs.root && wd.GetParent() != nil {
+				wd = wd.GetParent()
+			}
+		default:
+			child := wd.GetChildByName(name)
+			if child == nil {
+				if err := fs.reserveNode(name); err != nil {
+					return nil, err
+				}
+				child = util.NewFile(name, true, wd)
+				wd.UpsertChild(name, child)
+				fs.touch(child)
+				fs.record(JournalEntry{Op: OpMkDir, Path: child.GetFullPathName(fs.root)})
+			} else if !child.IsDirectory() {
+				return nil, &PathError{Path: path, Err: ErrNotDir, Segment: name, From: fullPath(start, fs.root)}
+			}
+			wd = child
+		}
+	}
+	return wd, nil
+}
+
+// Appends a string of data to the specified file. The max amount of data any file can have is
+// 2000000MB or 2GB.
+// Parameters:
+//
+//	name (string) - the path of the file to write, from the root if prefixed with "/" or "~", otherwise
+//	                from the current directory. Symbolic links are followed
+//	data (...string) - the text to write to the file
+//
+// Returns:
+//
+//	string - the path of the file we just wrote to, as given
+//	error - a *PathError if the file doesn't exist (unless Options.CreateOnWrite is set) or is a
+//	        directory, or an error if we've exceeded the max data size (defined in `file.go`)
+func (fs *Filesystem) WriteFile(name string, data ...string) (string, error) {
+	return fs.runHooks(&OperationEvent{Op: OperationWrite, Path: name, Data: util.StringSliceToByteSlice(data)}, func() (string, error) {
+		return fs.writeFile(name, data...)
+	})
+}
+
+// Implements WriteFile
+func (fs *Filesystem) writeFile(name string, data ...string) (string, error) {
+	if fs.replica {
+		return "", ErrReadOnly
+	}
+
+	file, err := fs.follow(name)
+	if errors.Is(err, ErrFileNotFound) && fs.opts.CreateOnWrite {
+		file, err = fs.createForWrite(name)
+	}
+	if err != nil {
+		return "", err
+	}
+	if file.IsDirectory() {
+		fs.misuse(OperationWrite, name, "cannot write to a directory")
+		return "", &PathError{Op: OperationWrite, Path: name, Err: ErrIsDir}
+	}
+	if _, ok := file.AsRegularFile(); !ok {
+		return "", fmt.Errorf("File %s is not a regular file; cannot write", name)
+	}
+
+	if fs.opts.WriteBehind {
+		fs.queueWrite(file, util.StringSliceToByteSlice(data))
+		return name, nil
+	}
+	return name, fs.applyWrite(file, util.StringSliceToByteSlice(data))
+}
+
+// Creates an empty file for WriteFile to write to, with Options.CreateOnWrite. Its parent
+// directory must exist.
+func (fs *Filesystem) createForWrite(path string) (*util.File, error) {
+	file, err := fs.createAt(path)
+	if err != nil {
+		return nil, err
+	}
+	fs.touch(file)
+	fs.record(JournalEntry{Op: OpMkFile, Path: file.GetFullPathName(fs.root)})
+	return file, nil
+}
+
+// Appends data to a regular file, journaling the write
+func (fs *Filesystem) applyWrite(file *util.File, data []byte) error {
+	// If we're running out of space, write as much as fits and then fail
+	contents, spaceErr := fs.fitToCapacity(file, data)
+	if err := file.WriteFileData(contents); err != nil {
+		return err
+	}
+	fs.countAccess(file, OperationWrite, len(contents))
+	fs.touch(file)
+	fs.record(JournalEntry{Op: OpWrite, Path: file.GetFullPathName(fs.root), Data: contents})
+	return spaceErr
+}
+
+// Changes the size of a file, like `truncate`: data past the new size is dropped, and a file
+// that grows is padded with zeros. Symbolic links are followed.
+//
+// Parameters:
+//
+//	path (string) - the file to truncate, relative to the current directory or absolute
+//	size (int) - the new size in bytes
+//
+// Returns:
+//
+//	error - an error if the path doesn't exist or isn't a regular file, the size is invalid, or
+//	        there isn't enough space to grow the file
+func (fs *Filesystem) Truncate(path string, size int) error {
+	_, err := fs.runHooks(&OperationEvent{Op: OperationWrite, Path: path}, func() (string, error) {
+		if fs.replica {
+			return "", ErrReadOnly
+		}
+		file, err := fs.follow(path)
+		if err != nil {
+			return "", err
+		}
+		if file.IsDirectory() || file.IsFifo() || file.GetKind().IsSpecial() || file.IsVirtual() {
+			return "", fmt.Errorf("File %s is not a regular file; cannot truncate", path)
+		}
+		return "", fs.truncate(file, size)
+	})
+	return err
+}
+
+// Implements Truncate, journaling the new contents
+func (fs *Filesystem) truncate(file *util.File, size int) error {
+	contents := file.GetContents()
+	switch {
+	case size < 0 || size > util.MaxFileSize:
+		return fmt.Errorf("Invalid size: %d", size)
+	case size == len(contents):
+		return nil
+	case size-len(contents) > fs.spaceLeft():
+		return ErrNoSpace
+	}
+	updated := make([]byte, size)
+	copy(updated, contents)
+	if err := setSparseContents(file, updated, size, 0); err != nil {
+		return err
+	}
+	fs.touch(file)
+	fs.record(JournalEntry{Op: OpPut, Path: file.GetFullPathName(fs.root), Data: updated})
+	return nil
+}
+
+// Reads the contents of the file specified
+//
+// Parameters:
+//
+//	name (string) - the path of the file to read in, resolved like WriteFile's
+//
+// Returns:
+//
+//	string - the contents of the file, up to 2000 chars (see limit in `util/file.go`)
+//	error - a *PathError if the file does not exist or is a directory
+func (fs *Filesystem) ReadFile(name string) (string, error) {
+	return fs.runHooks(&OperationEvent{Op: OperationRead, Path: name}, func() (string, error) {
+		return fs.readFile(name)
+	})
+}
+
+// Implements ReadFile
+func (fs *Filesystem) readFile(name string) (string, error) {
+	file, err := fs.follow(name)
+	if err != nil {
+		return "", err
+	}
+	if file.IsDirectory() {
+		return "", &PathError{Op: OperationRead, Path: name, Err: ErrIsDir}
+	}
+	if _, ok := file.AsRegularFile(); !ok {
+		return "", fmt.Errorf("File %s is not a regular file; cannot read", name)
+	}
+
+	var contents []byte
+	if file.GetKind().IsSpecial() {
+		contents = fs.readSpecial(file, util.MaxFileReadSize)
+	} else if file.IsFifo() {
+		// Reading from a pipe consumes everything in it
+		contents = fs.drainFifo(file, len(file.GetContents()))
+	} else {
+		contents = fs.filteredContents(file)
+	}
+	fs.countAccess(file, OperationRead, len(contents))
+
+	return util.FormatFileContents(contents), nil
+}
+
+// Moves the specified file (within the current directory) to the specified target directory.
+// TODO: Support relative/absolute paths for the source file in the future
+//
+// Paramters:
+//
+//	name (string) -   the name of the file to move
+//	target (string) - the name of the target directory
+//
+// Returns:
+//
+//	string - the name of the target directory if the move was successful
+//	error  - an error if the move was unsuccessful
+func (fs *Filesystem) MvFile(name string, target string) (string, error) {
+	return fs.runHooks(&OperationEvent{Op: OperationMv, Path: name, Target: target}, func() (string, error) {
+		return fs.mvFile(name, target)
+	})
+}
+
+// Implements MvFile
+func (fs *Filesystem) mvFile(name string, target string) (string, error) {
+	if fs.replica {
+		return "", ErrReadOnly
+	}
+
+	// Sanitize the strings
+	name = strings.Trim(name, "/")
+	target = strings.Trim(target, "/")
+
+	wd := fs.currentDirectory
+	file := wd.GetChildByName(name)
+
+	splitPath := util.SplitPath(target)
+	if len(splitPath) == 0 {
+		return "", fmt.Errorf("Invalid target path: %s", target)
+	}
+
+	// Walk to the end of the path
+	targetDir, err := util.WalkToEndOfPath(util.SplitPath(target), fs.currentDirectory, fs.root)
+	if err != nil {
+		return "", fs.pathError(target, err)
+	}
+
+	// Validation
+	if file == nil {
+		return "", fmt.Errorf("File %s does not exist", name)
+	}
+
+	if file.IsDirectory() {
+		return "", fmt.Errorf("File %s is a directory; cannot move", name)
+	}
+
+	if targetDir == nil {
+		return "", fmt.Errorf("Target directory %s does not exist", target)
+	}
+
+	if !targetDir.IsDirectory() {
+		return "", fmt.Errorf("Target path %s is not a directory", target)
+	}
+
+	oldPath := file.GetFullPathName(fs.root)
+	wd.RemoveChild(name)
+
+	if util.ExistsInCurrentDir(targetDir, name, false) {
+		// If a file with the same name already exists in the target directory, add a "1" extension
+		name = util.ModifyNameToHandleCollisions(name)
+		// Update the file name too
+		file.SetName(name)
+	}
+
+	targetDir.UpsertChild(name, file)
+	file.SetParent(targetDir)
+	fs.touchMoved(file)
+	fs.record(JournalEntry{Op: OpMv, Path: oldPath, Target: file.GetFullPathName(fs.root)})
+	fs.repointLinks(oldPath, file.GetFullPathName(fs.root))
+
+	return target, nil
+}
+
+// Attempts to find a file or directory within the current working directory (and/or its children)
+//
+// Parameters:
+//
+//	target (string) - the name of the file/directory to find
+//	searchSubtrees (bool) - whether or not we should search the subdirectories of the current directory
+//
+// Returns:
+//
+//	[]string - all matching results, as paths relative to the current directory
+func (fs *Filesystem) FindFileOrDir(target string, searchSubtrees bool) []string {
+	return util.Map(fs.find(fs.currentDirectory, target, searchSubtrees, NameMatch{}), func(f *util.File) string {
+		return relativePath(f, fs.currentDirectory)
+	})
+}
+
+// Attempts to find a file or directory within the given directory (and/or its children), like
+// FindFileOrDir searching from somewhere other than the current directory
+//
+// Parameters:
+//
+//	root (string) - the directory to search, relative to the current one or absolute. Symbolic
+//	                links along the path are followed
+//	target (string) - the name of the file/directory to find
+//	searchSubtrees (bool) - whether or not we should search the subdirectories of root
+//	match (...NameMatch) - optionally, how names are compared with target, e.g. ignoring case.
+//	                       Names must be equal by default
+//
+// Returns:
+//
+//	[]string - all matching results, as paths relative to root
+//	error - an error if root doesn't exist or isn't a directory
+func (fs *Filesystem) FindFileOrDirFrom(root string, target string, searchSubtrees bool, match ...NameMatch) ([]string, error) {
+	var nameMatch NameMatch
+	if len(match) > 0 {
+		nameMatch = match[0]
+	}
+	results, err := fs.FindFrom(root, target, searchSubtrees, nameMatch, nil)
+	return util.Map(results, func(r FindResult) string { return r.Path }), err
+}
+
+// Returns the path of f relative to dir, "." for dir itself
+func relativePath(f *util.File, dir *util.File) string {
+	if f == dir {
+		return "."
+	}
+	return strings.TrimPrefix(f.GetFullPathName(dir), "/")
+}
+
+// Returns the file or directory at the given path, which may be relative to the current directory
+// or absolute (prefixed with "~"), and may use ".." to refer to a parent directory
+func (fs *Filesystem) resolve(path string) (*util.File, error) {
+	wd, name, err := fs.resolveParent(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "~":
+		return fs.root, nil
+	case "..":
+		if wd != fs.root && wd.GetParent() != nil {
+			return wd.GetParent(), nil
+		}
+		return wd, nil
+	default:
+		file := wd.GetChildByName(name)
+		if file == nil {
+			from := fs.currentDirectory
+			if strings.HasPrefix(strings.TrimSpace(path), "~") {
+				from = fs.root
+			}
+			return nil, &PathError{Path: path, Err: ErrFileNotFound, Segment: name, From: fullPath(from, fs.root)}
+		}
+		return file, nil
+	}
+}
+
+// Creates a new empty file at the given path, whose parent directory must already exist
+func (fs *Filesystem) createAt(path string) (*util.File, error) {
+	parent, name, err := fs.resolveParent(path)
+	if err != nil {
+		return nil, err
+	}
+	if name == "~" || name == ".." {
+		return nil, fmt.Errorf("Invalid path: %s", path)
+	}
+	if parent.GetChildByName(name) != nil {
+		return nil, fmt.Errorf("File %s already exists", path)
+	}
+	if err := fs.reserveNode(name); err != nil {
+		return nil, err
+	}
+
+	file := util.NewFile(name, false, parent)
+	parent.UpsertChild(name, file)
+	return file, nil
+}
+
+// Splits the path into the directory containing its last element (resolved the same way as
+// resolve) and the name of the last element
+func (fs *Filesystem) resolveParent(path string) (*util.File, string, error) {
+	pathSplit := util.SplitPath(path)
+	if len(pathSplit) == 0 {
+		return nil, "", fmt.Errorf("Invalid path: %s", path)
+	}
+
+	wd := fs.currentDirectory
+	if len(pathSplit) > 1 {
+		parent, err := util.WalkToEndOfPath(pathSplit[:len(pathSplit)-1], fs.currentDirectory, fs.root)
+		if err != nil {
+			return nil, "", fs.pathError(path, err)
+		}
+		wd = parent
+	} else if pathSplit[0] == "~" {
+		wd = fs.root
+	}
+	return wd, pathSplit[len(pathSplit)-1], nil
+}
+
+// Removes the file and all of its descendants from the tree, dropping everything we keep about
+// them. If the current directory is removed, we move back to the root. Returns the number of
+// entries removed.
+func (fs *Filesystem) teardown(file *util.File) int {
+	if util.IsAncestor(file, fs.currentDirectory) {
+		fs.currentDirectory = fs.root
+	}
+	storage := fs.storage()
+	return util.RmRecursion(file, func(f *util.File) {
+		delete(fs.accessStats, f.GetFullPathName(fs.root))
+		storage.unaccount(f)
+		storage.unindexLink(f)
+	})
+}
+
+// Marks the file as modified now, in a new generation of the filesystem
+func (fs *Filesystem) touch(f *util.File) {
+	f.SetGeneration(fs.nextGeneration())
+	f.SetModTime(fs.now())
+}
+
+// Marks a node that was just moved as modified now, and everything below it as changed in the
+// same generation without changing their modification times, so change streams (see
+// ExportChanges) send the whole subtree at its new path
+func (fs *Filesystem) touchMoved(f *util.File) {
+	fs.touch(f)
+	generation := f.GetGeneration()
+	util.WalkTree(f, func(child *util.File) {
+		child.SetGeneration(generation)
+	})
+}
+
+// Returns the current time according to `Options.Now`
+func (fs *Filesystem) now() time.Time {
+	if fs.opts.Now != nil {
+		return fs.opts.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,567 @@
+// filesystem_test.go
+package imfs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNewFileSystem(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+
+	// Verify that the root directory is created correctly
+	if fs.root.GetName() != "/" {
+		t.Errorf("Expected root directory name to be / but got: %s", fs.root.GetName())
+	}
+
+	// Verify that the current directory is set to the root directory
+	if fs.currentDirectory != fs.root {
+		t.Errorf("Expected current directory to be the root directory")
+	}
+}
+
+func TestPwd(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+
+	// Working directory should be "/"
+	res := fs.Pwd()
+	if res != "/" {
+		t.Errorf("Expected the current working directory to be / but is %s", res)
+	}
+
+	// Create a new directory and navigate to it
+	fs.MkDir("/home")
+	fs.Cd("/home")
+
+	res = fs.Pwd()
+	if res != "/home" {
+		t.Errorf("Expected the current working directory to be /home but is %s", res)
+	}
+
+	// Now add another directory and navigate to it
+	fs.MkDir("/test")
+	fs.Cd("/test")
+
+	res = fs.Pwd()
+	if res != "/home/test" {
+		t.Errorf("Expected the current working directory to be /home/test but is %s", res)
+	}
+}
+
+func TestMkDir(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+
+	// Create a new directory
+	res, err := fs.MkDir("/home")
+
+	// Assert no errors
+	if err != nil {
+		t.Errorf("Expected no errors but got %s", err.Error())
+	}
+
+	// Assert directory was created with the right name
+	if res != "home" {
+		t.Errorf("Expected the new directory to be /home but got %s", res)
+	}
+
+	res, err = fs.MkDir("/home/bwent")
+
+	// Assert no errors
+	if err != nil {
+		t.Errorf("Expected no errors but got %s", err.Error())
+	}
+
+	// Assert directory was created with the right name
+	if res != "bwent" {
+		t.Errorf("Expected the new directory to be /bwent but got %s", res)
+	}
+
+	// Create a new invalid directory should throw error
+	res, err = fs.MkDir("/invalid/path")
+	assertErrorAndEmptyResult(res, err, "Directory not found: invalid (resolving /invalid/path from /)", t)
+
+	// Create a new empty directory should throw error
+	res, err = fs.MkDir(" ")
+	assertErrorAndEmptyResult(res, err, "Must provide at least one directory name", t)
+}
+
+func TestCd(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+
+	// First attempt to CD into a non-existing directory
+	res, err := fs.Cd("/dir1")
+	assertErrorAndEmptyResult(res, err, "Directory not found: dir1 (resolving /dir1 from /)", t)
+
+	fs.MkDir("/dir1")
+	fs.MkDir("/dir1/dir2")
+	fs.MkDir("/dir1/dir2/dir3")
+
+	// Test cases
+	res, err = fs.Cd("/dir1")
+	assertMatchesAndNoErrors(res, err, "dir1", t)
+
+	// Should start from the root and traverse the path
+	res, err = fs.Cd("~/dir1/dir2")
+	assertMatchesAndNoErrors(res, err, "dir2", t)
+
+	// Should navigate one level up to "home"
+	res, err = fs.Cd("../")
+	assertMatchesAndNoErrors(res, err, "dir1", t)
+
+	// Invalid path - should return an error
+	res, err = fs.Cd("/test1")
+	assertErrorAndEmptyResult(res, err, "Directory not found: test1 (resolving /test1 from /dir1)", t)
+}
+
+func TestLs(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+
+	// List the contents of the root directory. Should be empty
+	res, err := fs.Ls()
+	assertMatchesAndNoErrors(res, err, "", t)
+
+	fs.MkDir("/home")
+	fs.MkDir("/home/test")
+	fs.MkDir("/home/test/foo")
+	// List contents of directory by path should return the single directory under that path
+	res, err = fs.Ls("/home/test")
+	assertMatchesAndNoErrors(res, err, "foo", t)
+
+	// Test with absolute path
+	res, err = fs.Ls("~/home")
+	assertMatchesAndNoErrors(res, err, "test", t)
+
+	// Test with ".."
+	fs.Cd("/home/test")
+	res, err = fs.Ls("../")
+	assertMatchesAndNoErrors(res, err, "test", t)
+}
+
+func TestRm(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+
+	fs.MkDir("dir1")
+	fs.MkDir("dir1/dir2")
+	// Shouldn't be able to non-recursively remove a directory
+	res, err := fs.Rm("/dir1", false)
+	assertErrorAndEmptyResult(res, err, "Method does not support removing non-empty directories. Use the recursive option", t)
+
+	// Shouldn't be able to remove a nonexistent directory
+	res, err = fs.Rm("/test", false)
+	assertErrorAndEmptyResult(res, err, "Directory not found: test (resolving test from /)", t)
+
+	// Happy path 1
+	res, err = fs.Rm("/dir1", true)
+	assertMatchesAndNoErrors(res, err, "dir1", t)
+
+	res, err = fs.Ls()
+	if res != "" {
+		t.Errorf("Expected the current directory to be empty after removing dir1 but instead was %s", res)
+	}
+}
+
+func TestRmCount(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.MkDir("dir1/dir2")
+	fs.Cd("dir1")
+	fs.MkFile("file1")
+	fs.WriteFile("file1", "hello")
+	fs.Cd("..")
+
+	// A single file counts as one entry
+	fs.MkFile("file2")
+	count, err := fs.RmCount("file2", false)
+	if count != 1 || err != nil {
+		t.Errorf("Expected to remove 1 entry but removed %d with error %v", count, err)
+	}
+
+	// Directories count all of their descendants too
+	count, err = fs.RmCount("dir1", true)
+	if count != 3 || err != nil {
+		t.Errorf("Expected to remove 3 entries but removed %d with error %v", count, err)
+	}
+
+	// Removed files are forgotten everywhere
+	if stats := fs.AccessStats(); len(stats) != 0 {
+		t.Errorf("Expected the access stats of removed files to be dropped but got %+v", stats)
+	}
+	if usage := fs.DiskUsage(); usage.Used != NodeOverhead+len("/") {
+		t.Errorf("Expected only the root to use space but got %+v", usage)
+	}
+
+	count, err = fs.RmCount("dir1", true)
+	if count != 0 || err == nil {
+		t.Errorf("Expected an error removing a missing directory but removed %d", count)
+	}
+}
+
+func TestMkFile(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+
+	// Test creating a new file
+	res, err := fs.MkFile("test.txt")
+	assertMatchesAndNoErrors(res, err, "test.txt", t)
+
+	// Test collisions
+	res, err = fs.MkFile("test.txt")
+	assertMatchesAndNoErrors(res, err, "test1.txt", t)
+}
+
+func TestMkFileWithPath(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.Cd("dir1")
+	fs.MkDir("dir2")
+
+	// Relative and absolute paths to existing directories
+	res, err := fs.MkFile("dir2/a.txt")
+	assertMatchesAndNoErrors(res, err, "a.txt", t)
+	res, err = fs.MkFile("~/dir1/dir2/a.txt")
+	assertMatchesAndNoErrors(res, err, "a1.txt", t)
+	res, err = fs.MkFile("../b.txt")
+	assertMatchesAndNoErrors(res, err, "b.txt", t)
+	res, err = fs.Ls("dir2")
+	assertMatchesAndNoErrors(res, err, "a.txt a1.txt", t)
+
+	// Parents must exist, unless created with MkFileAll
+	res, err = fs.MkFile("new/c.txt")
+	assertErrorAndEmptyResult(res, err, "Directory not found: new (resolving new/c.txt from /dir1)", t)
+	res, err = fs.MkFileAll("new/deeper/c.txt")
+	assertMatchesAndNoErrors(res, err, "c.txt", t)
+	res, err = fs.Ls("new/deeper")
+	assertMatchesAndNoErrors(res, err, "c.txt", t)
+	res, err = fs.MkFileAll("new/deeper/c.txt/d.txt")
+	assertErrorAndEmptyResult(res, err, "Not a directory: c.txt (resolving new/deeper/c.txt/d.txt from /dir1)", t)
+	res, err = fs.MkFile("dir2/..")
+	assertErrorAndEmptyResult(res, err, "Invalid file name: ..", t)
+
+	// Created directories are journaled too, so replicas see them
+	replica := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertMatchesAndNoErrors(string(snapshotBytes(replica)), nil, string(snapshotBytes(fs)), t)
+}
+
+func TestWriteAndReadFile(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+
+	// Write some data to a non-existent file; should thrown an error
+	res, err := fs.WriteFile("test.txt", "hello world!")
+	assertErrorAndEmptyResult(res, err, "File not found: test.txt (resolving test.txt from /)", t)
+
+	// Create a new file
+	res, err = fs.MkFile("test.txt")
+
+	// Write some data to the file
+	text := "hello world!"
+	res, err = fs.WriteFile("test.txt", text)
+	assertMatchesAndNoErrors(res, err, "test.txt", t)
+
+	// Read the data back
+	res, err = fs.ReadFile("test.txt")
+	assertMatchesAndNoErrors(res, err, text, t)
+
+	moreText := " I am a computer."
+	fs.WriteFile("test.txt", moreText)
+	res, err = fs.ReadFile("test.txt")
+	assertMatchesAndNoErrors(res, err, text+moreText, t)
+
+	fs.MkFile("large-text-test.txt")
+	var builder strings.Builder
+	// Write 1 more than the max allowed char limit
+	for i := 0; i < util.MaxFileReadSize+1; i++ {
+		builder.WriteRune('x')
+	}
+	fs.WriteFile("large-text-test.txt", builder.String())
+	res, err = fs.ReadFile("large-text-test.txt")
+	expected := fmt.Sprintf("%s ...[trunated contents after %d chars]", builder.String()[:util.MaxFileReadSize+1], util.MaxFileReadSize)
+	assertMatchesAndNoErrors(res, err, expected, t)
+}
+
+func TestReadAndWriteFilePaths(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkDir("config")
+	fs.MkDir("notes")
+	fs.MkDir("app")
+	fs.Cd("config")
+	fs.MkFile("app.yaml")
+	fs.Cd("~/notes")
+	fs.MkFile("todo.txt")
+	fs.Symlink("../config", "cfg")
+	fs.Cd("~/app")
+
+	// Relative and absolute paths
+	res, err := fs.WriteFile("~/notes/todo.txt", "foo")
+	assertMatchesAndNoErrors(res, err, "~/notes/todo.txt", t)
+	fs.WriteFile("../config/app.yaml", "debug: true")
+	res, err = fs.ReadFile("/notes/todo.txt")
+	assertMatchesAndNoErrors(res, err, "foo", t)
+	res, err = fs.ReadFile("../config/app.yaml")
+	assertMatchesAndNoErrors(res, err, "debug: true", t)
+
+	// Links are followed anywhere in the path
+	res, err = fs.ReadFile("~/notes/cfg/app.yaml")
+	assertMatchesAndNoErrors(res, err, "debug: true", t)
+
+	res, err = fs.ReadFile("../notes/missing.txt")
+	assertErrorAndEmptyResult(res, err, "File not found: missing.txt (resolving ../notes/missing.txt from /app)", t)
+	_, err = fs.WriteFile("~/notes/cfg", "x")
+	var pathErr *PathError
+	if !errors.As(err, &pathErr) || pathErr.Err != ErrIsDir || pathErr.Op != OperationWrite {
+		t.Errorf("Expected a *PathError with ErrIsDir, got %#v", err)
+	}
+}
+
+func TestWriteFileCreateOnWrite(t *testing.T) {
+	fs := NewFileSystemWithOptions(Options{CreateOnWrite: true})
+	fs.MkDir("dir1")
+
+	// Missing files are created, then appended to like any other
+	res, err := fs.WriteFile("test.txt", "hello")
+	assertMatchesAndNoErrors(res, err, "test.txt", t)
+	fs.WriteFile("test.txt", " world")
+	res, err = fs.ReadFile("test.txt")
+	assertMatchesAndNoErrors(res, err, "hello world", t)
+
+	// Files are created in existing directories only
+	res, err = fs.WriteFile("~/dir1/test.txt", "hi")
+	assertMatchesAndNoErrors(res, err, "~/dir1/test.txt", t)
+	res, err = fs.WriteFile("missing/test.txt", "hello")
+	assertErrorAndEmptyResult(res, err, "Directory not found: missing (resolving missing/test.txt from /)", t)
+	_, err = fs.WriteFile("dir1", "hello")
+	if err == nil {
+		t.Errorf("Expected an error writing to a directory")
+	}
+
+	// The creation is journaled, so replicas see it
+	replica := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertMatchesAndNoErrors(string(snapshotBytes(replica)), nil, string(snapshotBytes(fs)), t)
+}
+
+func TestTruncate(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkFile("test.txt")
+	fs.WriteFile("test.txt", "hello world")
+
+	if err := fs.Truncate("~/test.txt", 5); err != nil {
+		t.Fatal(err)
+	}
+	res, err := fs.ReadFile("test.txt")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+
+	// Growing pads with zeros
+	if err := fs.Truncate("test.txt", 7); err != nil {
+		t.Fatal(err)
+	}
+	data, err := fs.Bytes("test.txt")
+	assertMatchesAndNoErrors(string(data), err, "hello\x00\x00", t)
+
+	fs.MkDir("dir")
+	if err := fs.Truncate("dir", 0); err == nil {
+		t.Errorf("Expected an error truncating a directory")
+	}
+	if err := fs.Truncate("test.txt", -1); err == nil {
+		t.Errorf("Expected an error for a negative size")
+	}
+
+	// Truncation is journaled
+	replica := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err = replica.Bytes("test.txt")
+	assertMatchesAndNoErrors(string(data), err, "hello\x00\x00", t)
+}
+
+func TestMoveFile(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+
+	fs.MkDir("dir1")
+	// Test moving nonexistent file
+	res, err := fs.MvFile("file1", "dir1")
+	assertErrorAndEmptyResult(res, err, "File file1 does not exist", t)
+
+	fs.MkFile("file1")
+	// Test moving file to invalid directory
+	res, err = fs.MvFile("file1", "dir2")
+	assertErrorAndEmptyResult(res, err, "Directory not found: dir2 (resolving dir2 from /)", t)
+
+	fs.MkDir("dir2")
+	// Test moving directory
+	res, err = fs.MvFile("dir1", "dir2")
+	assertErrorAndEmptyResult(res, err, "File dir1 is a directory; cannot move", t)
+
+	fs.MkFile("file2")
+	// Test moving directory
+	res, err = fs.MvFile("file2", "file1")
+	assertErrorAndEmptyResult(res, err, "Directory not found: file1 (resolving file1 from /)", t)
+
+	// Happy path
+	res, err = fs.MvFile("file1", "dir1")
+	assertMatchesAndNoErrors(res, err, "dir1", t)
+	res, err = fs.MvFile("file2", "dir1/")
+	assertMatchesAndNoErrors(res, err, "dir1", t)
+
+	fs.MkDir("dir1/test1")
+	fs.MkFile("file3")
+	res, err = fs.MvFile("file3", "~/dir1/test1")
+	assertMatchesAndNoErrors(res, err, "~/dir1/test1", t)
+}
+
+func TestFind(t *testing.T) {
+	// Set up the test subject
+	fs := NewFileSystem()
+
+	fs.MkDir("dir1")
+	fs.MkDir("dir2")
+	fs.MkFile("file1.txt")
+	fs.MkFile("file2.txt")
+
+	// Test searching in the current directory
+	res := fs.FindFileOrDir("file1.txt", false)
+	expected := []string{"file1.txt"}
+	if !stringSliceEqual(res, expected) {
+		t.Errorf("Invalid results: got: %v, expected: %v", res, expected)
+	}
+
+	fs.MvFile("file1.txt", "dir1")
+	// Test searching in subdirectories
+	res = fs.FindFileOrDir("file1.txt", true)
+	expected = []string{"dir1/file1.txt"}
+	if !stringSliceEqual(res, expected) {
+		t.Errorf("Invalid results: got: %v, expected: %v", res, expected)
+	}
+
+	// Test finding a nonexistent file yields empty results
+	res = fs.FindFileOrDir("file3.txt", true)
+	expected = []string{}
+	if !stringSliceEqual(res, expected) {
+		t.Errorf("Invalid results: got: %v, expected: %v", res, expected)
+	}
+
+	// Searches start from the current directory, and find every match with the name
+	fs.Cd("dir1")
+	fs.MkDir("sub")
+	fs.Cd("sub")
+	fs.MkFile("file1.txt")
+	fs.Cd("..")
+	res = fs.FindFileOrDir("file1.txt", true)
+	expected = []string{"file1.txt", "sub/file1.txt"}
+	if !stringSliceEqual(res, expected) {
+		t.Errorf("Invalid results: got: %v, expected: %v", res, expected)
+	}
+
+	// Or from another directory, relative to it
+	res, err := fs.FindFileOrDirFrom("~", "file1.txt", true)
+	expected = []string{"dir1/file1.txt", "dir1/sub/file1.txt"}
+	if err != nil || !stringSliceEqual(res, expected) {
+		t.Errorf("Invalid results: got: %v (%v), expected: %v", res, err, expected)
+	}
+	res, err = fs.FindFileOrDirFrom("sub", "sub", true)
+	expected = []string{"."}
+	if err != nil || !stringSliceEqual(res, expected) {
+		t.Errorf("Invalid results: got: %v (%v), expected: %v", res, err, expected)
+	}
+	_, err = fs.FindFileOrDirFrom("file1.txt", "file1.txt", true)
+	if !errors.Is(err, ErrNotDir) {
+		t.Errorf("Expected ErrNotDir searching a file, got %v", err)
+	}
+}
+
+func TestFindMatching(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkDir("Docs")
+	fs.Cd("Docs")
+	fs.MkFile("README.md")
+	fs.MkFile("notes.md")
+	fs.Cd("~")
+	fs.MkFile("readme.txt")
+
+	cases := []struct {
+		target   string
+		subtrees bool
+		match    NameMatch
+		expected []string
+	}{
+		{"readme.md", true, NameMatch{}, []string{}},
+		{"readme.md", true, NameMatch{IgnoreCase: true}, []string{"Docs/README.md"}},
+		{".md", true, NameMatch{Substring: true}, []string{"Docs/README.md", "Docs/notes.md"}},
+		{"README", true, NameMatch{Substring: true}, []string{"Docs/README.md"}},
+		{"README", true, NameMatch{IgnoreCase: true, Substring: true}, []string{"readme.txt", "Docs/README.md"}},
+		{"DOC", false, NameMatch{IgnoreCase: true, Substring: true}, []string{"Docs"}},
+	}
+	for _, c := range cases {
+		res, err := fs.FindFileOrDirFrom("~", c.target, c.subtrees, c.match)
+		if err != nil || !stringSliceEqual(res, c.expected) {
+			t.Errorf("%s %+v: got %v (%v), expected %v", c.target, c.match, res, err, c.expected)
+		}
+	}
+}
+
+// HELPER METHODS
+
+func assertMatchesAndNoErrors(res string, err error, expected string, t *testing.T) {
+	if err != nil {
+		t.Errorf("Expected no errors but got %s", err.Error())
+	}
+
+	if res != expected {
+		t.Errorf("Expected path to be %s but was %s", expected, res)
+	}
+}
+
+func assertErrorAndEmptyResult(res string, err error, errTxt string, t *testing.T) {
+	// Assert error is thrown
+	if err == nil || err.Error() != errTxt {
+		t.Errorf("Expected error: %s but got %s", errTxt, err)
+	}
+
+	// Assert result is empty
+	if res != "" {
+		t.Errorf("Expected an empty result but got %s", res)
+	}
+}
+
+func stringSliceEqual(slice1, slice2 []string) bool {
+	if len(slice1) != len(slice2) {
+		return false
+	}
+	for i := range slice1 {
+		if slice1[i] != slice2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Splits a space-separated result (e.g. from Ls) into a sorted slice, since map ordering is random
+func sortedFields(res string) []string {
+	fields := strings.Fields(res)
+	sort.Strings(fields)
+	return fields
+}
@@ -0,0 +1,89 @@
+package imfs
+
+import (
+	"bytes"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"path"
+	"strings"
+)
+
+// Transforms the contents of a file as it is read, e.g. to mask secrets. Filters must not modify
+// the data they're given; return a new slice instead.
+type ReadFilter func(path string, data []byte) []byte
+
+// A registered filter along with the glob selecting which files it applies to
+type readFilter struct {
+	pattern string
+	filter  ReadFilter
+}
+
+// Registers a filter that runs on the contents of every file matching the glob pattern whenever it
+// is read through ReadFile or a FileHandle. The stored contents are never changed. Patterns
+// without a "/" are matched against the file name (e.g. "*.env"), otherwise against the full
+// path (e.g. "/config/*"). When several filters match, they run in the order they were added.
+//
+// Parameters:
+//
+//	pattern (string) - the glob selecting which files to filter, using path.Match syntax
+//	filter (ReadFilter) - the filter to run
+//
+// Returns:
+//
+//	func() - removes the filter
+func (fs *Filesystem) AddReadFilter(pattern string, filter ReadFilter) func() {
+	registered := &readFilter{pattern: pattern, filter: filter}
+	fs.readFilters = append(fs.readFilters, registered)
+
+	return func() {
+		for i, f := range fs.readFilters {
+			if f == registered {
+				fs.readFilters = append(fs.readFilters[:i:i], fs.readFilters[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// A ReadFilter for KEY=VALUE files (like .env files) that replaces every value with "****"
+func MaskValues(_ string, data []byte) []byte {
+	lines := bytes.Split(data, []byte("\n"))
+	masked := make([][]byte, len(lines))
+	for i, line := range lines {
+		key, _, found := bytes.Cut(line, []byte("="))
+		if found && !bytes.HasPrefix(bytes.TrimSpace(line), []byte("#")) {
+			line = append(append([]byte{}, key...), "=****"...)
+		}
+		masked[i] = line
+	}
+	return bytes.Join(masked, []byte("\n"))
+}
+
+// Returns the contents of the file after running all matching read filters
+func (fs *Filesystem) filteredContents(file *util.File) []byte {
+	return fs.applyReadFilters(file, file.GetContents())
+}
+
+// Runs all read filters matching the file on the given contents
+func (fs *Filesystem) applyReadFilters(file *util.File, contents []byte) []byte {
+	if len(fs.readFilters) == 0 {
+		return contents
+	}
+
+	for _, f := range fs.readFilters {
+		if fs.matchesGlob(f.pattern, file) {
+			contents = f.filter(file.GetFullPathName(fs.root), contents)
+		}
+	}
+	return contents
+}
+
+// Returns true if the file matches the glob pattern. Patterns without a "/" are matched against
+// the file name, otherwise against the full path.
+func (fs *Filesystem) matchesGlob(pattern string, file *util.File) bool {
+	target := file.GetName()
+	if strings.ContainsRune(pattern, '/') {
+		target = file.GetFullPathName(fs.root)
+	}
+	matched, _ := path.Match(pattern, target)
+	return matched
+}
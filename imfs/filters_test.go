@@ -0,0 +1,42 @@
+// filters_test.go
+package imfs
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReadFilters(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkFile("app.env")
+	fs.WriteFile("app.env", "# comment\nPASSWORD=hunter2")
+	fs.MkFile("notes.txt")
+	fs.WriteFile("notes.txt", "PASSWORD=hunter2")
+
+	removeMask := fs.AddReadFilter("*.env", MaskValues)
+
+	// Only matching files are filtered
+	res, err := fs.ReadFile("app.env")
+	assertMatchesAndNoErrors(res, err, "# comment\nPASSWORD=****", t)
+	res, err = fs.ReadFile("notes.txt")
+	assertMatchesAndNoErrors(res, err, "PASSWORD=hunter2", t)
+
+	// Handles are filtered too
+	h, _ := fs.Open("app.env")
+	data, _ := io.ReadAll(h)
+	assertMatchesAndNoErrors(string(data), nil, "# comment\nPASSWORD=****", t)
+
+	// Filters compose in the order they were added
+	fs.AddReadFilter("/app.env", func(_ string, data []byte) []byte {
+		return bytes.ToUpper(data)
+	})
+	res, err = fs.ReadFile("app.env")
+	assertMatchesAndNoErrors(res, err, "# COMMENT\nPASSWORD=****", t)
+
+	// Removed filters no longer run, and the stored contents were never changed
+	removeMask()
+	res, err = fs.ReadFile("app.env")
+	assertMatchesAndNoErrors(res, err, "# COMMENT\nPASSWORD=HUNTER2", t)
+}
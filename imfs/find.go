@@ -0,0 +1,170 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+	"path"
+	"strings"
+	"sync"
+)
+
+// What FindStream searches for. The zero value matches every entry below the current directory.
+type FindOptions struct {
+	// The directory to search, relative to the current one or absolute (with "~"). Symbolic links
+	// along the path are followed, but not those inside the subtree. Defaults to the current
+	// directory
+	Root string
+	// If set, only entries with exactly this name match
+	Name string
+	// If set, only entries whose name matches this glob (see path.Match) match
+	Pattern string
+	// If set, only entries whose name contains this match
+	Contains string
+	// If set, Name, Pattern and Contains ignore case
+	IgnoreCase bool
+	// If set, only files whose size passes it match (see ParseSizeFilter)
+	Size *SizeFilter
+	// If positive, the search stops after this many matches
+	Limit int
+	// If set, entries it matches (by their path relative to Root) are skipped, along with
+	// everything inside them
+	Ignore *IgnoreMatcher
+}
+
+// A match found by FindFrom
+type FindResult struct {
+	// The path relative to the directory searched, "." for the directory itself
+	Path  string
+	Entry DirEntry
+}
+
+// Finds files or directories like FindFileOrDirFrom, describing each match and optionally only
+// keeping files of certain sizes, e.g. to hunt down what's using up the space.
+//
+// Parameters:
+//
+//	root (string) - the directory to search, resolved like FindFileOrDirFrom's
+//	target (string) - the name of the file/directory to find, or "" for any name
+//	searchSubtrees (bool) - whether or not we should search the subdirectories of root
+//	match (NameMatch) - how names are compared with target
+//	size (*SizeFilter) - if not nil, only files whose size passes it match
+//
+// Returns:
+//
+//	[]FindResult - the matches, breadth-first
+//	error - an error if root doesn't exist or isn't a directory
+func (fs *Filesystem) FindFrom(root string, target string, searchSubtrees bool, match NameMatch, size *SizeFilter) ([]FindResult, error) {
+	dir, err := fs.follow(root)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.IsDirectory() {
+		return nil, &PathError{Path: root, Err: ErrNotDir}
+	}
+	results := []FindResult{}
+	for _, f := range fs.find(dir, target, searchSubtrees, match) {
+		if entry := fs.dirEntry(f); size.Matches(entry) {
+			results = append(results, FindResult{Path: relativePath(f, dir), Entry: entry})
+		}
+	}
+	return results, nil
+}
+
+// An entry found by FindStream
+type Match struct {
+	Entry DirEntry
+	// How many levels below the searched directory the entry is, 0 for the directory itself
+	Depth int
+}
+
+// Searches a subtree depth-first, in name order, sending each match on the returned channel as
+// soon as it is found. Nothing is collected, so memory stays bounded however many entries match:
+// stop reading early by calling the returned cancel function, or set Limit. The channel is closed
+// once the search ends, whether it finished, hit the limit or was cancelled. Cancel may be called
+// any number of times, and should be called if the channel isn't drained, so the search doesn't
+// wait forever for a reader.
+//
+// The search runs on its own goroutine, so the filesystem must not be modified until the channel
+// is closed.
+//
+// Parameters:
+//
+//	opts (FindOptions) - where to search and what to match
+//
+// Returns:
+//
+//	<-chan Match - the matches, in the order they were found
+//	func() - cancels the search
+//	error - an error if the root doesn't exist or the pattern is malformed, in which case the
+//	        channel is already closed
+func (fs *Filesystem) FindStream(opts FindOptions) (<-chan Match, func(), error) {
+	matches := make(chan Match)
+	done := make(chan struct{})
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() { close(done) })
+	}
+
+	root, err := fs.follow(opts.Root)
+	if err == nil && opts.Pattern != "" {
+		_, err = path.Match(opts.Pattern, "")
+	}
+	if opts.IgnoreCase {
+		opts.Pattern = strings.ToLower(opts.Pattern)
+	}
+	if err != nil {
+		close(matches)
+		return matches, cancel, err
+	}
+
+	go func() {
+		defer close(matches)
+		found := 0
+		var walk func(f *util.File, parts []string) bool
+		walk = func(f *util.File, parts []string) bool {
+			depth := len(parts)
+			if depth > 0 && opts.Ignore.ignores(parts, f.IsDirectory()) {
+				return true
+			}
+			if opts.matches(f.GetName()) {
+				if entry := fs.dirEntry(f); opts.Size.Matches(entry) {
+					select {
+					case matches <- Match{Entry: entry, Depth: depth}:
+					case <-done:
+						return false
+					}
+					found++
+					if opts.Limit > 0 && found >= opts.Limit {
+						return false
+					}
+				}
+			}
+			for _, child := range fs.listedChildren(f) {
+				if !walk(child, append(parts[:depth:depth], child.GetName())) {
+					return false
+				}
+			}
+			return true
+		}
+		walk(root, nil)
+	}()
+	return matches, cancel, nil
+}
+
+// Returns true if an entry with the given name matches the options
+func (opts FindOptions) matches(name string) bool {
+	if opts.Name != "" && !(NameMatch{IgnoreCase: opts.IgnoreCase}).matches(name, opts.Name) {
+		return false
+	}
+	if opts.Contains != "" && !(NameMatch{IgnoreCase: opts.IgnoreCase, Substring: true}).matches(name, opts.Contains) {
+		return false
+	}
+	if opts.Pattern != "" {
+		if opts.IgnoreCase {
+			// The pattern was lowercased when the search started
+			name = strings.ToLower(name)
+		}
+		matched, _ := path.Match(opts.Pattern, name)
+		return matched
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+// find_test.go
+package imfs
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Collects the paths of everything sent on the channel
+func collectMatches(matches <-chan Match) []string {
+	paths := []string{}
+	for match := range matches {
+		paths = append(paths, fmt.Sprintf("%s@%d", match.Entry.Path, match.Depth))
+	}
+	return paths
+}
+
+func TestFindStream(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("a")
+	fs.MkDir("b")
+	fs.MkFile("x.txt")
+	fs.Cd("a")
+	fs.MkFile("x.txt")
+	fs.MkFile("y.go")
+	fs.Cd("~/b")
+	fs.MkFile("x.txt")
+	fs.Cd("~")
+
+	// Matches arrive depth-first in name order, including same-named files in different places
+	matches, cancel, err := fs.FindStream(FindOptions{Name: "x.txt"})
+	if err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	got := collectMatches(matches)
+	cancel()
+	assertMatchesAndNoErrors(fmt.Sprint(got), nil, "[/a/x.txt@2 /b/x.txt@2 /x.txt@1]", t)
+
+	// Patterns, roots and limits
+	matches, _, _ = fs.FindStream(FindOptions{Root: "a", Pattern: "*.go"})
+	assertMatchesAndNoErrors(fmt.Sprint(collectMatches(matches)), nil, "[/a/y.go@1]", t)
+	matches, _, _ = fs.FindStream(FindOptions{Root: "~/a", Limit: 2})
+	assertMatchesAndNoErrors(fmt.Sprint(collectMatches(matches)), nil, "[/a@0 /a/x.txt@1]", t)
+
+	// Substrings, and case-insensitive matches
+	matches, _, _ = fs.FindStream(FindOptions{Root: "a", Contains: "x."})
+	assertMatchesAndNoErrors(fmt.Sprint(collectMatches(matches)), nil, "[/a/x.txt@1]", t)
+	matches, _, _ = fs.FindStream(FindOptions{Root: "a", Pattern: "*.GO", IgnoreCase: true})
+	assertMatchesAndNoErrors(fmt.Sprint(collectMatches(matches)), nil, "[/a/y.go@1]", t)
+	matches, _, _ = fs.FindStream(FindOptions{Name: "X.TXT", IgnoreCase: true, Limit: 1})
+	assertMatchesAndNoErrors(fmt.Sprint(collectMatches(matches)), nil, "[/a/x.txt@2]", t)
+
+	// Ignored entries are skipped along with everything inside them
+	ignore, _ := NewIgnoreMatcher("b/", "*.go")
+	matches, _, _ = fs.FindStream(FindOptions{Ignore: ignore})
+	assertMatchesAndNoErrors(fmt.Sprint(collectMatches(matches)), nil, "[@0 /a@1 /a/x.txt@2 /x.txt@1]", t)
+
+	// Cancelling stops the search and closes the channel
+	matches, cancel, _ = fs.FindStream(FindOptions{})
+	<-matches
+	cancel()
+	cancel()
+	for range matches {
+	}
+
+	// Missing roots and malformed patterns fail up front
+	for _, opts := range []FindOptions{{Root: "missing"}, {Pattern: "["}} {
+		matches, _, err := fs.FindStream(opts)
+		if err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+		if _, open := <-matches; open {
+			t.Errorf("Expected the channel to be closed for %+v", opts)
+		}
+	}
+}
@@ -0,0 +1,753 @@
+package imfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// The encoding of a fixture spec
+type FixtureFormat string
+
+const (
+	FixtureYAML FixtureFormat = "yaml"
+	FixtureJSON FixtureFormat = "json"
+)
+
+// A fixture spec: a declarative description of a tree, read by LoadFixture and written by
+// DumpFixture. In YAML it looks like:
+//
+//	entries:
+//	  - path: docs
+//	    type: dir
+//	    mode: "700"
+//	  - path: docs/a.txt
+//	    contents: |
+//	      first line
+//	      second line
+//	    modTime: 2024-01-02T03:04:05Z
+//	  - path: docs/latest
+//	    target: a.txt
+//	  - path: dev/null
+//	    type: "null"
+//	  - path: data/large.bin
+//	    url: https://example.com/large.bin
+//
+// and in JSON the same, as {"entries": [{"path": "docs", "type": "dir", "mode": "700"}, ...]}.
+type Fixture struct {
+	Entries []FixtureEntry `json:"entries"`
+}
+
+// A single entry of a fixture spec. Only Path is required: the type defaults to "symlink" when a
+// target is given, "remote" when a URL is given and "file" otherwise, and missing parent
+// directories are created.
+type FixtureEntry struct {
+	// Relative to the root; a leading "/" or "~/" is ignored
+	Path string `json:"path"`
+	// "dir", "file", "symlink", "fifo", "null", "zero", "random" or "remote"
+	Type string `json:"type,omitempty"`
+	// The contents of a file or pipe
+	Contents string `json:"contents,omitempty"`
+	// The contents of a file or pipe, base64-encoded (used by DumpFixture for binary contents)
+	Base64 string `json:"base64,omitempty"`
+	// The target of a symbolic link
+	Target string `json:"target,omitempty"`
+	// Where a remote file fetches its contents from (see MkRemoteFile)
+	URL string `json:"url,omitempty"`
+	// The permission bits in octal, e.g. "600"
+	Mode  string `json:"mode,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	// In RFC 3339 format
+	ModTime string `json:"modTime,omitempty"`
+}
+
+// The keys recognized in the YAML subset, which map onto the FixtureEntry fields
+var fixtureKeys = map[string]func(e *FixtureEntry) *string{
+	"path":     func(e *FixtureEntry) *string { return &e.Path },
+	"type":     func(e *FixtureEntry) *string { return &e.Type },
+	"contents": func(e *FixtureEntry) *string { return &e.Contents },
+	"base64":   func(e *FixtureEntry) *string { return &e.Base64 },
+	"target":   func(e *FixtureEntry) *string { return &e.Target },
+	"url":      func(e *FixtureEntry) *string { return &e.URL },
+	"mode":     func(e *FixtureEntry) *string { return &e.Mode },
+	"owner":    func(e *FixtureEntry) *string { return &e.Owner },
+	"modTime":  func(e *FixtureEntry) *string { return &e.ModTime },
+}
+
+// Go template expansion of file contents while loading a fixture (see LoadFixtureWithTemplate)
+type FixtureTemplate struct {
+	// The data templates are executed with, e.g. {{.port}} for Data["port"]
+	Data map[string]any
+	// Globs (see path.Match) selecting the files whose contents are expanded. Patterns with a "/"
+	// match the path relative to the root (e.g. "config/*.yaml"), others the file name (e.g.
+	// "*.conf"). Other files are loaded unchanged, so binary files can be left alone. If empty,
+	// every file whose contents are valid UTF-8 is expanded
+	Files []string
+}
+
+// An entry of a fixture spec after validation
+type fixtureNode struct {
+	names   []string
+	kind    util.FileKind
+	dir     bool
+	data    []byte
+	mode    os.FileMode
+	owner   string
+	modTime time.Time
+}
+
+// Builds the tree described by a fixture spec (see Fixture), in JSON or YAML. This is easier to
+// read than the equivalent imperative setup code for large fixtures. The format is detected from
+// the first character: a "{" means JSON.
+//
+// Only a subset of YAML is understood, which is what DumpFixture writes: a top-level "entries"
+// list whose items are "key: value" pairs with plain, single- or double-quoted values, or block
+// values introduced by "|" (keeping the final line break) or "|-" (dropping it). Comments and
+// blank lines are ignored. Anchors, flow collections and multi-document streams aren't supported.
+//
+// The whole spec is validated before anything is created. Entries are then created in order
+// relative to the root, along with any missing parent directories, replacing existing files (but
+// not directories) and recording each change in the journal. An entry that fails to be created
+// stops the load, leaving the entries before it in place.
+//
+// Parameters:
+//
+//	r (io.Reader) - the fixture spec
+//
+// Returns:
+//
+//	error - an error if the spec is malformed, or an entry can't be created
+func (fs *Filesystem) LoadFixture(r io.Reader) error {
+	return fs.loadFixture(r, nil)
+}
+
+// Same as LoadFixture, but the contents of the files selected by the template's globs are first
+// expanded as Go templates (see text/template) with the template's data, e.g. to give every test
+// its own port or path. Templates are expanded while the spec is validated, so a template that
+// fails (including one using a key missing from the data) stops the load before anything is
+// created.
+//
+// Parameters:
+//
+//	r (io.Reader) - the fixture spec
+//	tmpl (FixtureTemplate) - the data and the files to expand
+//
+// Returns:
+//
+//	error - an error if the spec or a glob is malformed, a template fails or an entry can't be
+//	        created
+func (fs *Filesystem) LoadFixtureWithTemplate(r io.Reader, tmpl FixtureTemplate) error {
+	for _, pattern := range tmpl.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid glob %q: %s", pattern, err)
+		}
+	}
+	return fs.loadFixture(r, &tmpl)
+}
+
+// Implements LoadFixture, expanding templates if tmpl is set
+func (fs *Filesystem) loadFixture(r io.Reader, tmpl *FixtureTemplate) error {
+	if fs.replica {
+		return ErrReadOnly
+	}
+	fixture, err := parseFixture(r)
+	if err != nil {
+		return err
+	}
+	defer fs.enter(OperationWrite, "")()
+
+	nodes := make([]fixtureNode, 0, len(fixture.Entries))
+	for i, entry := range fixture.Entries {
+		node, err := entry.validate()
+		if err == nil && tmpl != nil {
+			err = tmpl.expand(&node)
+		}
+		if err != nil {
+			return fmt.Errorf("Fixture entry %d (%s): %s", i+1, entry.Path, err)
+		}
+		nodes = append(nodes, node)
+	}
+	for _, node := range nodes {
+		if err := fs.createFixtureNode(node); err != nil {
+			return fmt.Errorf("%s: %s", strings.Join(node.names, "/"), err)
+		}
+	}
+	return nil
+}
+
+// Expands the contents of a file or pipe if the globs select it
+func (tmpl *FixtureTemplate) expand(node *fixtureNode) error {
+	if node.dir || !(node.kind == util.KindRegular || node.kind == util.KindFifo) || len(node.data) == 0 {
+		return nil
+	}
+	if !tmpl.selects(node) {
+		return nil
+	}
+	t, err := template.New(strings.Join(node.names, "/")).Option("missingkey=error").Parse(string(node.data))
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, tmpl.Data); err != nil {
+		return err
+	}
+	node.data = buf.Bytes()
+	return nil
+}
+
+// Returns true if the file's contents should be expanded
+func (tmpl *FixtureTemplate) selects(node *fixtureNode) bool {
+	if len(tmpl.Files) == 0 {
+		return utf8.Valid(node.data)
+	}
+	for _, pattern := range tmpl.Files {
+		name := node.names[len(node.names)-1]
+		if strings.Contains(pattern, "/") {
+			name = strings.Join(node.names, "/")
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Reads a spec in either format
+func parseFixture(r io.Reader) (*Fixture, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	fixture := &Fixture{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(fixture); err != nil {
+			return nil, fmt.Errorf("Invalid JSON fixture: %s", err)
+		}
+		return fixture, nil
+	}
+	if err := parseYAMLFixture(data, fixture); err != nil {
+		return nil, err
+	}
+	return fixture, nil
+}
+
+// Parses the YAML subset described in LoadFixture
+func parseYAMLFixture(data []byte, fixture *Fixture) error {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	var entry *FixtureEntry
+	// The indentation of the keys of the current entry
+	keyIndent := -1
+	seenEntries := false
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		lineErr := func(format string, args ...interface{}) error {
+			return fmt.Errorf("Invalid YAML fixture, line %d: %s", i+1, fmt.Sprintf(format, args...))
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if strings.HasPrefix(line[indent:], "\t") {
+			return lineErr("tabs can't be used for indentation")
+		}
+
+		if !seenEntries {
+			key, value, _ := strings.Cut(trimmed, ":")
+			value = strings.TrimSpace(stripYAMLComment(value))
+			if indent != 0 || key != "entries" || (value != "" && value != "[]") {
+				return lineErr("expected \"entries:\"")
+			}
+			seenEntries = true
+			continue
+		}
+
+		rest := line[indent:]
+		if rest == "-" || strings.HasPrefix(rest, "- ") {
+			fixture.Entries = append(fixture.Entries, FixtureEntry{})
+			entry = &fixture.Entries[len(fixture.Entries)-1]
+			rest = strings.TrimLeft(rest[1:], " ")
+			if rest == "" {
+				keyIndent = -1
+				continue
+			}
+			keyIndent = len(line) - len(rest)
+		} else if entry == nil {
+			return lineErr("expected a list item")
+		} else if keyIndent == -1 {
+			keyIndent = indent
+		} else if indent != keyIndent {
+			return lineErr("unexpected indentation")
+		}
+
+		key, value, ok := strings.Cut(rest, ":")
+		if !ok || (value != "" && value[0] != ' ') {
+			return lineErr("expected \"key: value\"")
+		}
+		field, known := fixtureKeys[key]
+		if !known {
+			return lineErr("unknown key %q", key)
+		}
+		value = strings.TrimSpace(value)
+
+		if value == "|" || value == "|-" {
+			var block []string
+			i, block = yamlBlock(lines, i+1, keyIndent)
+			text := strings.Join(block, "\n")
+			if value == "|" && len(block) > 0 {
+				text += "\n"
+			}
+			*field(entry) = text
+			continue
+		}
+		scalar, err := parseYAMLScalar(value)
+		if err != nil {
+			return lineErr("%s", err)
+		}
+		*field(entry) = scalar
+	}
+	if !seenEntries && len(bytes.TrimSpace(data)) > 0 {
+		return fmt.Errorf("Invalid YAML fixture: expected \"entries:\"")
+	}
+	return nil
+}
+
+// Collects the lines of a block value starting at line start, which must be indented further
+// than the key. Returns the index of the block's last line along with the lines, without their
+// common indentation and trailing blank lines.
+func yamlBlock(lines []string, start int, keyIndent int) (int, []string) {
+	block := []string{}
+	indent := -1
+	end := start - 1
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			block = append(block, "")
+			continue
+		}
+		lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent == -1 {
+			indent = lineIndent
+		}
+		if lineIndent <= keyIndent || lineIndent < indent {
+			break
+		}
+		block = append(block, line[indent:])
+		end = i
+	}
+	for len(block) > 0 && block[len(block)-1] == "" {
+		block = block[:len(block)-1]
+	}
+	return end, block
+}
+
+// Parses a plain, single- or double-quoted value
+func parseYAMLScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "\""):
+		end := closingQuote(value)
+		if end == -1 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after string", rest)
+		}
+		s, err := strconv.Unquote(value[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", value[:end+1])
+		}
+		return s, nil
+	case strings.HasPrefix(value, "'"):
+		s := value[1:]
+		out := strings.Builder{}
+		for {
+			quote := strings.Index(s, "'")
+			if quote == -1 {
+				return "", fmt.Errorf("unterminated string")
+			}
+			out.WriteString(s[:quote])
+			if strings.HasPrefix(s[quote:], "''") {
+				out.WriteByte('\'')
+				s = s[quote+2:]
+				continue
+			}
+			if rest := strings.TrimSpace(s[quote+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return "", fmt.Errorf("unexpected %q after string", rest)
+			}
+			return out.String(), nil
+		}
+	case strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{") || strings.HasPrefix(value, "&") ||
+		strings.HasPrefix(value, "*") || strings.HasPrefix(value, ">"):
+		return "", fmt.Errorf("unsupported value %s", value)
+	}
+	return strings.TrimSpace(stripYAMLComment(value)), nil
+}
+
+// Returns the index of the quote ending a double-quoted string, or -1
+func closingQuote(value string) int {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// Removes a trailing " # comment" from a plain value
+func stripYAMLComment(value string) string {
+	if strings.HasPrefix(value, "#") {
+		return ""
+	}
+	if i := strings.Index(value, " #"); i != -1 {
+		return value[:i]
+	}
+	return value
+}
+
+// Checks the entry and converts its fields
+func (e FixtureEntry) validate() (fixtureNode, error) {
+	node := fixtureNode{names: util.SplitPath(strings.TrimPrefix(e.Path, "~"))}
+	if len(node.names) == 0 {
+		return node, fmt.Errorf("Missing path")
+	}
+	for _, name := range node.names {
+		if name == "." || name == ".." {
+			return node, fmt.Errorf("Invalid path")
+		}
+	}
+
+	entryType := e.Type
+	if entryType == "" {
+		entryType = "file"
+		if e.Target != "" {
+			entryType = "symlink"
+		} else if e.URL != "" {
+			entryType = "remote"
+		}
+	}
+	switch entryType {
+	case "dir":
+		node.dir = true
+	case "file":
+		node.kind = util.KindRegular
+	default:
+		kind, ok := util.ParseFileKind(entryType)
+		if !ok || kind == util.KindRegular {
+			return node, fmt.Errorf("Unknown type %q", e.Type)
+		}
+		node.kind = kind
+	}
+
+	if e.Target != "" && node.kind != util.KindSymlink {
+		return node, fmt.Errorf("Only symbolic links have a target")
+	}
+	if node.kind == util.KindSymlink {
+		if e.Target == "" {
+			return node, fmt.Errorf("Symbolic links need a target")
+		}
+		node.data = []byte(e.Target)
+	}
+	if e.URL != "" && node.kind != util.KindRemote {
+		return node, fmt.Errorf("Only remote files have a URL")
+	}
+	if node.kind == util.KindRemote {
+		if err := checkRemoteURL(e.URL); err != nil {
+			return node, err
+		}
+		node.data = []byte(e.URL)
+	}
+
+	if e.Contents != "" || e.Base64 != "" {
+		if node.dir || !(node.kind == util.KindRegular || node.kind == util.KindFifo) {
+			return node, fmt.Errorf("Only files and pipes have contents")
+		}
+		if e.Contents != "" && e.Base64 != "" {
+			return node, fmt.Errorf("Only one of contents and base64 can be set")
+		}
+		node.data = []byte(e.Contents)
+		if e.Base64 != "" {
+			data, err := base64.StdEncoding.DecodeString(e.Base64)
+			if err != nil {
+				return node, fmt.Errorf("Invalid base64 contents: %s", err)
+			}
+			node.data = data
+		}
+	}
+
+	if e.Mode != "" {
+		mode, err := strconv.ParseUint(e.Mode, 8, 32)
+		if err != nil || mode > 0777 {
+			return node, fmt.Errorf("Invalid mode %q", e.Mode)
+		}
+		node.mode = os.FileMode(mode)
+	}
+	node.owner = e.Owner
+	if e.ModTime != "" {
+		modTime, err := time.Parse(time.RFC3339Nano, e.ModTime)
+		if err != nil {
+			return node, fmt.Errorf("Invalid modTime %q", e.ModTime)
+		}
+		node.modTime = modTime
+	}
+	return node, nil
+}
+
+// Creates a validated entry, along with any missing parent directories
+func (fs *Filesystem) createFixtureNode(node fixtureNode) error {
+	parent := fs.root
+	for _, name := range node.names[:len(node.names)-1] {
+		child := parent.GetChildByName(name)
+		if child == nil {
+			if err := fs.reserveNode(name); err != nil {
+				return err
+			}
+			child = util.NewFile(name, true, parent)
+			parent.UpsertChild(name, child)
+			fs.touch(child)
+			fs.record(JournalEntry{Op: OpMkDir, Path: child.GetFullPathName(fs.root)})
+		} else if !child.IsDirectory() {
+			return fmt.Errorf("%s is not a directory", child.GetFullPathName(fs.root))
+		}
+		parent = child
+	}
+
+	name := node.names[len(node.names)-1]
+	file := parent.GetChildByName(name)
+	if file != nil && file.IsVirtual() {
+		return fmt.Errorf("%s is a virtual file", file.GetFullPathName(fs.root))
+	}
+	if file != nil && file.IsDirectory() != node.dir {
+		if file.IsDirectory() {
+			return fmt.Errorf("%s is a directory", file.GetFullPathName(fs.root))
+		}
+		removed := file.GetFullPathName(fs.root)
+		fs.teardown(file)
+		fs.touch(parent)
+		fs.record(JournalEntry{Op: OpRm, Path: removed})
+		file = nil
+	}
+
+	if file == nil || !node.dir {
+		size := len(node.data)
+		if file != nil {
+			size -= len(file.GetContents())
+		} else {
+			size += NodeOverhead + len(name)
+		}
+		if size > fs.spaceLeft() {
+			return ErrNoSpace
+		}
+	}
+
+	if !node.dir {
+		// Replaced by a new node below
+		fs.storage().unaccountTree(file)
+	}
+	switch {
+	case node.dir:
+		if file == nil {
+			file = util.NewFile(name, true, parent)
+			parent.UpsertChild(name, file)
+			fs.touch(file)
+			fs.record(JournalEntry{Op: OpMkDir, Path: file.GetFullPathName(fs.root)})
+		}
+	case node.kind == util.KindSymlink:
+		file = util.NewSymlink(name, string(node.data), parent).File()
+		parent.UpsertChild(name, file)
+		fs.touch(file)
+		fs.record(JournalEntry{Op: OpSymlink, Path: file.GetFullPathName(fs.root), Target: string(node.data)})
+	case node.kind == util.KindRemote:
+		file = util.NewFile(name, false, parent)
+		file.SetKind(util.KindRemote)
+		file.SetContents(node.data)
+		fs.attachRemote(file)
+		parent.UpsertChild(name, file)
+		fs.touch(file)
+		fs.record(JournalEntry{Op: OpMkRemote, Path: file.GetFullPathName(fs.root), Target: string(node.data)})
+	case node.kind == util.KindRegular:
+		file = util.NewFile(name, false, parent)
+		if err := file.SetContents(node.data); err != nil {
+			return err
+		}
+		parent.UpsertChild(name, file)
+		fs.touch(file)
+		fs.record(JournalEntry{Op: OpPut, Path: file.GetFullPathName(fs.root), Data: node.data})
+	default:
+		file = util.NewFile(name, false, parent)
+		file.SetKind(node.kind)
+		parent.UpsertChild(name, file)
+		fs.touch(file)
+		path := file.GetFullPathName(fs.root)
+		if node.kind == util.KindFifo {
+			fs.record(JournalEntry{Op: OpMkFifo, Path: path})
+			if len(node.data) > 0 {
+				if err := file.WriteFileData(node.data); err != nil {
+					return err
+				}
+				fs.record(JournalEntry{Op: OpWrite, Path: path, Data: node.data})
+			}
+		} else {
+			fs.record(JournalEntry{Op: OpMkSpecial, Path: path, Data: []byte(node.kind.String())})
+		}
+	}
+
+	path := file.GetFullPathName(fs.root)
+	if node.mode != 0 {
+		file.SetMode(node.mode)
+		fs.record(JournalEntry{Op: OpChmod, Path: path, Data: []byte(formatMode(node.mode))})
+	}
+	if node.owner != "" {
+		file.SetOwner(node.owner)
+		fs.record(JournalEntry{Op: OpChown, Path: path, Target: node.owner})
+	}
+	if !node.modTime.IsZero() {
+		file.SetModTime(node.modTime)
+	}
+	return nil
+}
+
+// Writes the whole tree as a fixture spec that LoadFixture turns back into the same tree.
+// Directories come before their contents, and siblings are sorted by name. Modes and owners are
+// only included when they differ from the defaults, and contents that aren't valid UTF-8 are
+// base64-encoded. Virtual files are left out, except remote files, which keep their URL.
+//
+// Parameters:
+//
+//	w (io.Writer) - where to write the spec
+//	format (FixtureFormat) - FixtureYAML or FixtureJSON
+//
+// Returns:
+//
+//	error - an error if the format is unknown or writing fails
+func (fs *Filesystem) DumpFixture(w io.Writer, format FixtureFormat) error {
+	fixture := fs.fixture()
+	switch format {
+	case FixtureJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(fixture)
+	case FixtureYAML:
+		return writeYAMLFixture(w, fixture)
+	}
+	return fmt.Errorf("Unknown fixture format: %s", format)
+}
+
+// Describes every entry of the tree
+func (fs *Filesystem) fixture() *Fixture {
+	fixture := &Fixture{Entries: []FixtureEntry{}}
+	util.WalkTree(fs.root, func(f *util.File) {
+		if f == fs.root || (f.IsVirtual() && f.GetKind() != util.KindRemote) {
+			return
+		}
+		entry := FixtureEntry{Path: f.GetFullPathName(fs.root)[1:], Owner: f.GetOwner()}
+		defaultMode := util.DefaultFileMode
+		switch {
+		case f.IsDirectory():
+			entry.Type = "dir"
+			defaultMode = util.DefaultDirMode
+		case f.IsSymlink():
+			entry.Target = string(f.GetContents())
+		case f.GetKind() == util.KindRemote:
+			entry.URL = f.RemoteURL()
+		case f.GetKind().IsSpecial():
+			entry.Type = f.GetKind().String()
+		default:
+			if f.IsFifo() {
+				entry.Type = f.GetKind().String()
+			}
+			if data := f.GetContents(); utf8.Valid(data) {
+				entry.Contents = string(data)
+			} else {
+				entry.Base64 = base64.StdEncoding.EncodeToString(data)
+			}
+		}
+		if f.GetMode() != defaultMode {
+			entry.Mode = formatMode(f.GetMode())
+		}
+		if !f.GetModTime().IsZero() {
+			entry.ModTime = f.GetModTime().UTC().Format(time.RFC3339Nano)
+		}
+		fixture.Entries = append(fixture.Entries, entry)
+	})
+	return fixture
+}
+
+// Writes the fixture in the YAML subset read by LoadFixture. Every value is double-quoted, except
+// multi-line contents which are written as blocks.
+func writeYAMLFixture(w io.Writer, fixture *Fixture) error {
+	bw := bufio.NewWriter(w)
+	if len(fixture.Entries) == 0 {
+		bw.WriteString("entries: []\n")
+		return bw.Flush()
+	}
+	bw.WriteString("entries:\n")
+	for _, e := range fixture.Entries {
+		prefix := "  - "
+		for _, key := range []string{"path", "type", "target", "url", "mode", "owner", "modTime", "contents", "base64"} {
+			value := *fixtureKeys[key](&e)
+			if value == "" {
+				continue
+			}
+			bw.WriteString(prefix + key + ":")
+			prefix = "    "
+			if key == "contents" && isYAMLBlock(value) {
+				indicator := "|-"
+				if strings.HasSuffix(value, "\n") {
+					indicator = "|"
+				}
+				bw.WriteString(" " + indicator + "\n")
+				for _, line := range strings.Split(strings.TrimSuffix(value, "\n"), "\n") {
+					if line == "" {
+						bw.WriteString("\n")
+					} else {
+						bw.WriteString("      " + line + "\n")
+					}
+				}
+				continue
+			}
+			bw.WriteString(" " + strconv.Quote(value) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// Reports whether contents can be written as a block and read back unchanged: it must span
+// several lines, have no leading indentation (which would be taken as the block's own), no
+// trailing blank lines (which blocks drop) and only printable characters
+func isYAMLBlock(value string) bool {
+	body := strings.TrimSuffix(value, "\n")
+	if !strings.Contains(body, "\n") || strings.HasSuffix(body, "\n") {
+		return false
+	}
+	if strings.HasPrefix(body, " ") || strings.HasPrefix(body, "\n") {
+		return false
+	}
+	for _, r := range body {
+		if r != '\n' && !strconv.IsPrint(r) {
+			return false
+		}
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.TrimSpace(line) == "" && line != "" {
+			return false
+		}
+	}
+	return true
+}
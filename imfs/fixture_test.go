@@ -0,0 +1,267 @@
+// fixture_test.go
+package imfs
+
+import (
+	"bytes"
+	iofs "io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+const testYAMLFixture = `# A small project
+entries:
+  - path: docs
+    type: dir
+    mode: "700"
+  - path: docs/a.txt
+    contents: |
+      first line
+
+      third line
+    modTime: 2024-01-02T03:04:05Z   # UTC
+  - path: /docs/latest
+    target: a.txt
+  -
+    path: bin/run.sh
+    contents: 'echo ''hi'''
+    mode: 0755
+    owner: alice
+  - path: dev/null
+    type: "null"
+  - path: dev/pipe
+    type: fifo
+    contents: "queued\n"
+  - path: empty
+    type: dir
+`
+
+func TestLoadFixtureYAML(t *testing.T) {
+	fs := NewFileSystem()
+	if err := fs.LoadFixture(strings.NewReader(testYAMLFixture)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := fstest.MapFS{
+		"docs/a.txt":  {Data: []byte("first line\n\nthird line\n")},
+		"docs/latest": {Mode: iofs.ModeSymlink, Data: []byte("a.txt")},
+		"bin/run.sh":  {Mode: 0755, Data: []byte("echo 'hi'")},
+		"dev/null":    {Mode: iofs.ModeDevice | iofs.ModeCharDevice, Data: []byte("null")},
+		"dev/pipe":    {Mode: iofs.ModeNamedPipe, Data: []byte("queued\n")},
+		"empty":       {Mode: iofs.ModeDir},
+	}
+	if got := fs.ToMapFS(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	entries, _ := fs.LsEntries("~")
+	if entries[2].Name != "docs" || entries[2].Mode != 0700 {
+		t.Errorf("Expected docs to have mode 700, got %+v", entries[2])
+	}
+	entries, _ = fs.LsEntries("~/docs")
+	if modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !entries[0].ModTime.Equal(modTime) {
+		t.Errorf("Expected a.txt to be modified at %s, got %s", modTime, entries[0].ModTime)
+	}
+	entries, _ = fs.LsEntries("~/bin")
+	if entries[0].Owner != "alice" {
+		t.Errorf("Expected run.sh to be owned by alice, got %q", entries[0].Owner)
+	}
+}
+
+func TestLoadFixtureJSON(t *testing.T) {
+	fs := NewFileSystem()
+	spec := `{"entries": [
+		{"path": "a/b.txt", "contents": "hello"},
+		{"path": "a/bin", "base64": "AP8="},
+		{"path": "link", "target": "a/b.txt"}
+	]}`
+	if err := fs.LoadFixture(strings.NewReader(spec)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := fstest.MapFS{
+		"a/b.txt": {Data: []byte("hello")},
+		"a/bin":   {Data: []byte{0, 0xff}},
+		"link":    {Mode: iofs.ModeSymlink, Data: []byte("a/b.txt")},
+	}
+	if got := fs.ToMapFS(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if journal := fs.Journal(); len(journal) != 4 || journal[0].Op != OpMkDir || journal[3].Op != OpSymlink {
+		t.Errorf("Expected every entry to be journaled, got %+v", journal)
+	}
+}
+
+func TestLoadFixtureReplacesFiles(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkFile("a")
+	fs.WriteFile("a", "old")
+	fs.MkDir("d")
+
+	err := fs.LoadFixture(strings.NewReader("entries:\n  - path: a\n    target: b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := fs.Readlink("~/a")
+	assertMatchesAndNoErrors(res, err, "b", t)
+
+	err = fs.LoadFixture(strings.NewReader("entries:\n  - path: d\n    contents: x\n"))
+	if err == nil || err.Error() != "d: /d is a directory" {
+		t.Errorf("Expected directories not to be replaced, got %v", err)
+	}
+}
+
+func TestLoadFixtureErrors(t *testing.T) {
+	cases := map[string]string{
+		"files:\n":                                        "Invalid YAML fixture, line 1: expected \"entries:\"",
+		"entries:\n  - path: a\n    size: 3\n":            "Invalid YAML fixture, line 3: unknown key \"size\"",
+		"entries:\n  - path: a\n      mode: 600\n":        "Invalid YAML fixture, line 3: unexpected indentation",
+		"entries:\n  - path: \"a\n":                       "Invalid YAML fixture, line 2: unterminated string",
+		"entries:\n  - path: [a, b]\n":                    "Invalid YAML fixture, line 2: unsupported value [a, b]",
+		"entries:\n  - path: a\n    mode: 999\n":          "Fixture entry 1 (a): Invalid mode \"999\"",
+		"entries:\n  - path: a\n    type: socket\n":       "Fixture entry 1 (a): Unknown type \"socket\"",
+		"entries:\n  - path: a\n    type: symlink\n":      "Fixture entry 1 (a): Symbolic links need a target",
+		"entries:\n  - path: a\n  - path: a/b\n":          "a/b: /a is not a directory",
+		"entries:\n  - path: a\n    modTime: yesterday\n": "Fixture entry 1 (a): Invalid modTime \"yesterday\"",
+		"{\"entries\": [{\"name\": \"a\"}]}":              "Invalid JSON fixture: json: unknown field \"name\"",
+	}
+	for spec, errTxt := range cases {
+		fs := NewFileSystem()
+		err := fs.LoadFixture(strings.NewReader(spec))
+		if err == nil || err.Error() != errTxt {
+			t.Errorf("Expected %q for %q, got %v", errTxt, spec, err)
+		}
+	}
+
+	fs := NewFileSystem()
+	if err := fs.LoadFixture(strings.NewReader("entries:\n  - path: a\n  - path: b\n    mode: x\n")); err == nil {
+		t.Fatal("Expected an invalid spec to be rejected")
+	}
+	if len(fs.ToMapFS()) != 0 {
+		t.Errorf("Expected nothing to be created from an invalid spec, got %v", fs.ToMapFS())
+	}
+}
+
+func TestDumpFixtureRoundTrip(t *testing.T) {
+	for _, format := range []FixtureFormat{FixtureYAML, FixtureJSON} {
+		fs := NewFileSystem()
+		if err := fs.LoadFixture(strings.NewReader(testYAMLFixture)); err != nil {
+			t.Fatal(err)
+		}
+		fs.MkFile("binary")
+		fs.WriteFile("binary", "\xff\x00")
+		fs.MkFile("indented")
+		fs.WriteFile("indented", "  a\nb\n")
+		fs.MkFile("tabs")
+		fs.WriteFile("tabs", "a\tb\nc")
+
+		buf := bytes.Buffer{}
+		if err := fs.DumpFixture(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+		copy := NewFileSystem()
+		if err := copy.LoadFixture(&buf); err != nil {
+			t.Fatalf("Expected the %s dump to load, got %v:\n%s", format, err, buf.String())
+		}
+
+		if got, want := copy.ToMapFS(), fs.ToMapFS(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected the %s dump to recreate %v, got %v", format, want, got)
+		}
+		if got, want := copy.fixture(), fs.fixture(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected the %s dump to keep owners and times, got %+v instead of %+v", format, got, want)
+		}
+	}
+}
+
+func TestDumpFixtureYAML(t *testing.T) {
+	fs := NewFileSystem()
+	fs.LoadFixture(strings.NewReader(`entries:
+  - path: a.txt
+    contents: "one\ntwo\n"
+    modTime: 2024-01-02T03:04:05Z
+  - path: d
+    type: dir
+    mode: "700"
+    modTime: 2024-01-02T03:04:05Z
+`))
+
+	buf := bytes.Buffer{}
+	if err := fs.DumpFixture(&buf, FixtureYAML); err != nil {
+		t.Fatal(err)
+	}
+	expected := `entries:
+  - path: "a.txt"
+    modTime: "2024-01-02T03:04:05Z"
+    contents: |
+      one
+      two
+  - path: "d"
+    type: "dir"
+    mode: "700"
+    modTime: "2024-01-02T03:04:05Z"
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := NewFileSystem().DumpFixture(&buf, FixtureYAML); err != nil || buf.String() != "entries: []\n" {
+		t.Errorf("Expected an empty list for an empty tree, got %q (%v)", buf.String(), err)
+	}
+	if err := fs.DumpFixture(&buf, "toml"); err == nil || err.Error() != "Unknown fixture format: toml" {
+		t.Errorf("Expected an unknown format to be rejected, got %v", err)
+	}
+}
+
+func TestLoadFixtureWithTemplate(t *testing.T) {
+	spec := `entries:
+  - path: conf/app.conf
+    contents: "port={{.port}} root={{.root}}"
+  - path: conf/keep.txt
+    contents: "{{.port}}"
+  - path: logo.png
+    base64: "e3sucG9ydH19/w=="
+`
+	data := map[string]any{"port": 8080, "root": "/srv"}
+
+	// Only files matching the globs are expanded
+	fs := NewFileSystem()
+	err := fs.LoadFixtureWithTemplate(strings.NewReader(spec), FixtureTemplate{Data: data, Files: []string{"*.conf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fstest.MapFS{
+		"conf/app.conf": {Data: []byte("port=8080 root=/srv")},
+		"conf/keep.txt": {Data: []byte("{{.port}}")},
+		"logo.png":      {Data: []byte("{{.port}}\xff")},
+	}
+	if got := fs.ToMapFS(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Without globs every text file is expanded, but binary files are left alone
+	fs = NewFileSystem()
+	if err := fs.LoadFixtureWithTemplate(strings.NewReader(spec), FixtureTemplate{Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	want["conf/keep.txt"] = &fstest.MapFile{Data: []byte("8080")}
+	if got := fs.ToMapFS(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Missing keys and bad globs are errors, and nothing is created
+	fs = NewFileSystem()
+	err = fs.LoadFixtureWithTemplate(strings.NewReader(spec), FixtureTemplate{Data: map[string]any{"port": 1}})
+	if err == nil || !strings.HasPrefix(err.Error(), "Fixture entry 1 (conf/app.conf): template: conf/app.conf") {
+		t.Errorf("Expected a missing key error, got %v", err)
+	}
+	if len(fs.ToMapFS()) != 0 {
+		t.Errorf("Expected nothing to be created, got %v", fs.ToMapFS())
+	}
+	err = fs.LoadFixtureWithTemplate(strings.NewReader(spec), FixtureTemplate{Files: []string{"["}})
+	if err == nil || err.Error() != "Invalid glob \"[\": syntax error in pattern" {
+		t.Errorf("Expected an invalid glob error, got %v", err)
+	}
+}
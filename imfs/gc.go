@@ -0,0 +1,104 @@
+package imfs
+
+import (
+	"crypto/sha256"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"sort"
+)
+
+// What a garbage collection found and reclaimed (see GC)
+type GCStats struct {
+	// Files whose contents were examined, in the tree and in checkpoints
+	Files int
+	// Distinct blocks of content before and after the collection
+	BlocksBefore int
+	BlocksAfter  int
+	// Bytes held by those blocks before and after the collection
+	BytesBefore int
+	BytesAfter  int
+	// BytesBefore - BytesAfter
+	Reclaimed int
+}
+
+// Reclaims memory held by file contents, like a mark-and-sweep collector over content blocks.
+// Every block reachable from the tree or a checkpoint is marked, then files with identical
+// contents are made to share a single block of exactly the right size. This reclaims the
+// duplicate copies left by restoring checkpoints or loading snapshots, the spare capacity left by
+// appends, and the already-read part of pipes. Contents, generations and modification times are
+// unchanged, so nothing observable changes. Frozen filesystems are only measured.
+//
+// Blocks no longer referenced by anything are freed by the Go runtime on its next collection.
+// Bytes before the start of a file's contents (e.g. the part of a pipe already read) aren't
+// counted, though the runtime frees them too.
+//
+// Returns:
+//
+//	GCStats - how many blocks and bytes were in use before and after, and how many were reclaimed
+func (fs *Filesystem) GC() GCStats {
+	defer fs.enter(OperationWrite, "")()
+	roots := []*util.File{fs.root}
+	names := fs.ListCheckpoints()
+	sort.Strings(names)
+	for _, name := range names {
+		roots = append(roots, fs.checkpoints[name].root)
+	}
+
+	stats := GCStats{}
+	stats.Files, stats.BlocksBefore, stats.BytesBefore = markBlocks(roots)
+	if fs.frozen {
+		// Other goroutines may be reading the tree, and it was already collected when frozen
+		stats.BlocksAfter, stats.BytesAfter = stats.BlocksBefore, stats.BytesBefore
+		return stats
+	}
+
+	canonical := make(map[[sha256.Size]byte][]byte)
+	for _, root := range roots {
+		util.WalkTree(root, func(f *util.File) {
+			block, size := f.ContentsBlock()
+			if block == nil {
+				return
+			}
+			contents := f.GetContents()
+			key := sha256.Sum256(contents)
+			shared, ok := canonical[key]
+			if !ok {
+				if size == len(contents) {
+					// Already exactly the right size, so it can be shared as is
+					shared = contents
+				} else {
+					shared = make([]byte, len(contents))
+					copy(shared, contents)
+				}
+				canonical[key] = shared
+			}
+			f.ShareContents(shared)
+		})
+	}
+
+	_, stats.BlocksAfter, stats.BytesAfter = markBlocks(roots)
+	stats.Reclaimed = stats.BytesBefore - stats.BytesAfter
+	return stats
+}
+
+// Returns how many files store contents under the roots, and the number and total size of the
+// distinct blocks backing them
+func markBlocks(roots []*util.File) (int, int, int) {
+	files := 0
+	blocks := make(map[*byte]int)
+	for _, root := range roots {
+		util.WalkTree(root, func(f *util.File) {
+			if f.IsDirectory() || f.IsVirtual() || f.GetKind().IsSpecial() {
+				return
+			}
+			files++
+			if block, size := f.ContentsBlock(); block != nil {
+				blocks[block] = size
+			}
+		})
+	}
+	bytes := 0
+	for _, size := range blocks {
+		bytes += size
+	}
+	return files, len(blocks), bytes
+}
@@ -0,0 +1,55 @@
+// gc_test.go
+package imfs
+
+import (
+	"testing"
+)
+
+func TestGC(t *testing.T) {
+	fs := NewFileSystem()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		fs.MkFile(name)
+		fs.WriteFile(name, "hello")
+	}
+	fs.WriteFile("c.txt", " world")
+
+	// Restoring a checkpoint copies every file, leaving two copies of each
+	fs.Checkpoint("cp")
+	fs.Restore("cp")
+
+	stats := fs.GC()
+	if stats.Files != 6 || stats.BlocksAfter != 2 {
+		t.Errorf("Expected 6 files sharing 2 blocks, got %+v", stats)
+	}
+	if stats.BytesAfter != len("hello")+len("hello world") || stats.Reclaimed != stats.BytesBefore-stats.BytesAfter || stats.Reclaimed <= 0 {
+		t.Errorf("Expected the duplicates to be reclaimed, got %+v", stats)
+	}
+
+	// Nothing observable changes, and a second collection has nothing left to reclaim
+	res, err := fs.ReadFile("c.txt")
+	assertMatchesAndNoErrors(res, err, "hello world", t)
+	if again := fs.GC(); again.Reclaimed != 0 || again.BlocksAfter != 2 {
+		t.Errorf("Expected nothing to reclaim, got %+v", again)
+	}
+
+	// Shared contents are still copied on write
+	fs.WriteFile("a.txt", "!")
+	res, err = fs.ReadFile("b.txt")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+	res, err = fs.ReadFile("a.txt")
+	assertMatchesAndNoErrors(res, err, "hello!", t)
+}
+
+func TestGCDrainedPipe(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkFifo("pipe")
+	fs.WriteFile("pipe", string(make([]byte, 1000)))
+	h, _ := fs.Open("pipe")
+	defer h.Close()
+	h.Read(make([]byte, 1000))
+
+	stats := fs.GC()
+	if stats.BlocksAfter != 0 || stats.BytesAfter != 0 || stats.Reclaimed <= 0 {
+		t.Errorf("Expected the drained pipe to hold no memory, got %+v", stats)
+	}
+}
@@ -0,0 +1,220 @@
+package imfs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"io"
+	"runtime/debug"
+	"time"
+)
+
+// Returned when reading from or writing to a handle that has already been closed
+var ErrClosed = errors.New("File handle already closed")
+
+// An open file within the filesystem, used to read and write its contents incrementally.
+// When the filesystem was created with `Options.BufferedWrites`, writes are held in the handle's
+// dirty buffer until Flush, Sync or Close is called.
+type FileHandle struct {
+	fs     *Filesystem
+	file   *util.File
+	dirty  []byte
+	offset int
+	closed bool
+	// Where the last read ended, to tell sequential reads from random ones (see pagecache.go)
+	lastReadEnd int
+	// The order the handle was opened in, and where, if `Options.TrackHandleStacks` is set
+	id    uint64
+	stack string
+}
+
+// Opens the specified file in the current directory for reading and writing
+//
+// Parameters:
+//
+//	name (string) - the name of the file to open
+//
+// Returns:
+//
+//	*FileHandle - a handle to the open file
+//	error - an error if the file does not exist or is a directory
+func (fs *Filesystem) Open(name string) (*FileHandle, error) {
+	file := fs.currentDirectory.GetChildByName(name)
+	if file == nil {
+		return nil, fmt.Errorf("File %s does not exist", name)
+	}
+	if file.IsDirectory() {
+		return nil, fmt.Errorf("File %s is a directory; cannot open", name)
+	}
+	if file.IsSymlink() {
+		return nil, fmt.Errorf("File %s is a symbolic link; cannot open", name)
+	}
+
+	return fs.newHandle(file), nil
+}
+
+// Opens a handle to the file, tracking it for OpenHandles
+func (fs *Filesystem) newHandle(file *util.File) *FileHandle {
+	fs.handleCount++
+	h := &FileHandle{fs: fs, file: file, id: fs.handleCount}
+	if fs.opts.TrackHandleStacks {
+		h.stack = string(debug.Stack())
+	}
+	fs.handles[h] = true
+	return h
+}
+
+// Returns the name of the underlying file
+func (h *FileHandle) Name() string {
+	return h.file.GetName()
+}
+
+// Appends data to the file. In buffered mode the data is only visible through this handle until
+// it is flushed.
+func (h *FileHandle) Write(data []byte) (int, error) {
+	event := &OperationEvent{Op: OperationWrite, Path: h.file.GetFullPathName(h.fs.root), Data: data}
+	started := time.Now()
+	end := h.fs.startSpan(event)
+	if err := h.fs.beforeHooks(event); err != nil {
+		end(0, err)
+		h.fs.logOperation(SubsystemHandles, event, 0, started, err)
+		return 0, err
+	}
+	h.checkUsable(OperationWrite)
+	n, err := h.guarded(OperationWrite, func() (int, error) { return h.write(data) })
+	if err != ErrClosed && err != ErrReadOnly {
+		h.fs.countAccess(h.file, OperationWrite, n)
+	}
+	h.fs.afterHooks(event, err)
+	end(n, err)
+	h.fs.logOperation(SubsystemHandles, event, n, started, err)
+	return n, err
+}
+
+// Implements Write
+func (h *FileHandle) write(data []byte) (int, error) {
+	if h.closed {
+		return 0, ErrClosed
+	}
+	if h.fs.replica {
+		return 0, ErrReadOnly
+	}
+	if limit := h.fs.shortIOLimit(h.file, OperationWrite, len(data)); limit < len(data) {
+		n, err := h.write(data[:limit])
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+		return n, err
+	}
+	// Pipes have no page cache, so writes to them are never buffered
+	if !h.fs.opts.BufferedWrites || h.file.IsFifo() {
+		// If we're running out of space, write as much as fits and then fail
+		data, spaceErr := h.fs.fitToCapacity(h.file, data)
+		offset := len(h.file.GetContents())
+		if err := h.file.WriteFileData(data); err != nil {
+			return 0, err
+		}
+		h.cacheWrite(offset, len(data))
+		h.fs.touch(h.file)
+		h.fs.record(JournalEntry{Op: OpWrite, Path: h.file.GetFullPathName(h.fs.root), Data: data})
+		return len(data), spaceErr
+	}
+	h.dirty = append(h.dirty, data...)
+	return len(data), nil
+}
+
+// Reads the next chunk of the file into p. The handle always sees its own unflushed writes.
+// Returns io.EOF once all the contents have been read. Reading from a FIFO consumes the data, and
+// returns io.EOF whenever the pipe is empty.
+func (h *FileHandle) Read(p []byte) (int, error) {
+	h.checkUsable(OperationRead)
+	if h.closed {
+		return 0, ErrClosed
+	}
+	end := h.fs.startSpan(&OperationEvent{Op: OperationRead, Path: h.file.GetFullPathName(h.fs.root)})
+	n, err := h.guarded(OperationRead, func() (int, error) { return h.read(p) })
+	h.fs.countAccess(h.file, OperationRead, n)
+	end(n, err)
+	return n, err
+}
+
+// Implements Read
+func (h *FileHandle) read(p []byte) (int, error) {
+	p = p[:h.fs.shortIOLimit(h.file, OperationRead, len(p))]
+	if h.file.GetKind().IsSpecial() {
+		data := h.fs.readSpecial(h.file, len(p))
+		if len(data) == 0 {
+			return 0, io.EOF
+		}
+		return copy(p, data), nil
+	}
+	if h.file.IsFifo() {
+		data := h.fs.drainFifo(h.file, len(p))
+		if len(data) == 0 {
+			return 0, io.EOF
+		}
+		return copy(p, data), nil
+	}
+	contents := h.contents()
+	if h.offset >= len(contents) {
+		return 0, io.EOF
+	}
+	n := copy(p, contents[h.offset:])
+	h.cacheRead(h.offset, n)
+	h.offset += n
+	return n, nil
+}
+
+// Publishes any buffered writes to the file so other handles and readers can see them
+func (h *FileHandle) Flush() error {
+	if h.closed {
+		return ErrClosed
+	}
+	if len(h.dirty) == 0 {
+		return nil
+	}
+	defer h.fs.enter(OperationWrite, h.file.GetFullPathName(h.fs.root))()
+	// If we're running out of space, publish as much as fits and keep the rest buffered
+	data, spaceErr := h.fs.fitToCapacity(h.file, h.dirty)
+	offset := len(h.file.GetContents())
+	if err := h.file.WriteFileData(data); err != nil {
+		return err
+	}
+	h.cacheWrite(offset, len(data))
+	h.fs.touch(h.file)
+	h.fs.record(JournalEntry{Op: OpWrite, Path: h.file.GetFullPathName(h.fs.root), Data: data})
+	h.dirty = h.dirty[len(data):]
+	if len(h.dirty) == 0 {
+		h.dirty = nil
+	}
+	return spaceErr
+}
+
+// Commits buffered writes. There is no backing disk, so this is equivalent to Flush.
+func (h *FileHandle) Sync() error {
+	return h.Flush()
+}
+
+// Flushes any buffered writes and releases the handle. Further operations return ErrClosed.
+func (h *FileHandle) Close() error {
+	if h.closed {
+		return ErrClosed
+	}
+	err := h.Flush()
+	h.closed = true
+	delete(h.fs.handles, h)
+	return err
+}
+
+// Simulates a crash by discarding every open handle and mapping (see Map) along with any writes
+// that were never flushed or synced, including those queued in write-behind mode. Discarded
+// handles behave as if they were closed, and discarded mappings as if they were unmapped.
+func (fs *Filesystem) SimulateCrash() {
+	fs.discardMappings()
+	fs.pendingWrites = nil
+	for h := range fs.handles {
+		h.dirty = nil
+		h.closed = true
+	}
+	fs.handles = make(map[*FileHandle]bool)
+}
@@ -0,0 +1,97 @@
+// handle_test.go
+package imfs
+
+import (
+	"io"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+
+	// Opening a nonexistent file should throw an error
+	_, err := fs.Open("file1")
+	if err == nil || err.Error() != "File file1 does not exist" {
+		t.Errorf("Expected error: File file1 does not exist but got %s", err)
+	}
+
+	// Opening a directory should throw an error
+	_, err = fs.Open("dir1")
+	if err == nil || err.Error() != "File dir1 is a directory; cannot open" {
+		t.Errorf("Expected error: File dir1 is a directory; cannot open but got %s", err)
+	}
+
+	// Unbuffered writes are visible immediately
+	fs.MkFile("file1")
+	h, err := fs.Open("file1")
+	if err != nil {
+		t.Fatalf("Expected no errors but got %s", err.Error())
+	}
+	h.Write([]byte("hello"))
+	res, err := fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+
+	// Closed handles can no longer be used
+	h.Close()
+	if _, err = h.Write([]byte("world")); err != ErrClosed {
+		t.Errorf("Expected error: %s but got %s", ErrClosed, err)
+	}
+}
+
+func TestBufferedWrites(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystemWithOptions(Options{BufferedWrites: true})
+	fs.MkFile("file1")
+
+	writer, _ := fs.Open("file1")
+	reader, _ := fs.Open("file1")
+
+	writer.Write([]byte("hello"))
+
+	// Other readers shouldn't see the write before it's flushed
+	res, err := fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "", t)
+	data, _ := io.ReadAll(reader)
+	assertMatchesAndNoErrors(string(data), nil, "", t)
+
+	// The writing handle sees its own writes
+	data, _ = io.ReadAll(writer)
+	assertMatchesAndNoErrors(string(data), nil, "hello", t)
+
+	// Flushing publishes the write
+	writer.Flush()
+	res, err = fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+	data, _ = io.ReadAll(reader)
+	assertMatchesAndNoErrors(string(data), nil, "hello", t)
+
+	// Closing also publishes the write
+	writer.Write([]byte(" world"))
+	writer.Close()
+	res, err = fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "hello world", t)
+}
+
+func TestSimulateCrash(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystemWithOptions(Options{BufferedWrites: true})
+	fs.MkFile("file1")
+
+	h, _ := fs.Open("file1")
+	h.Write([]byte("synced"))
+	h.Sync()
+	h.Write([]byte(" unsynced"))
+
+	fs.SimulateCrash()
+
+	// Only the synced data should survive
+	res, err := fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "synced", t)
+
+	// The handle should have been discarded
+	if err = h.Close(); err != ErrClosed {
+		t.Errorf("Expected error: %s but got %s", ErrClosed, err)
+	}
+}
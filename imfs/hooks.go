@@ -0,0 +1,129 @@
+package imfs
+
+import (
+	"time"
+)
+
+// The kind of operation described by an OperationEvent
+type Operation string
+
+const (
+	OperationMkDir  Operation = "mkdir"
+	OperationMkFile Operation = "mkfile"
+	OperationWrite  Operation = "write"
+	OperationRead   Operation = "read"
+	OperationRm     Operation = "rm"
+	OperationMv     Operation = "mv"
+	OperationChmod  Operation = "chmod"
+	OperationChown  Operation = "chown"
+	// Symbolic links aren't reported to hooks; this names them in Apply
+	OperationSymlink Operation = "symlink"
+)
+
+// Describes an operation on the filesystem, passed to every Hook
+type OperationEvent struct {
+	Op Operation
+	// The path as provided by the caller (for handle writes, the full path of the file)
+	Path string
+	// For moves, the target directory. For chown, the new owner
+	Target string
+	// For writes, the data being written. For chmod, the new permission bits in octal
+	Data []byte
+	// Only set for After: the error the operation returned, if any
+	Err error
+}
+
+// Middleware that can observe or veto operations, e.g. for auditing, quotas, validation or
+// mocking failures
+type Hook interface {
+	// Called before the operation runs. Returning an error vetoes the operation, which then fails
+	// with that error; After is not called for vetoed operations.
+	Before(event *OperationEvent) error
+	// Called after the operation runs, with event.Err set to its result
+	After(event *OperationEvent)
+}
+
+// Adapts a pair of functions to the Hook interface. Either function may be nil.
+type HookFuncs struct {
+	BeforeFunc func(event *OperationEvent) error
+	AfterFunc  func(event *OperationEvent)
+}
+
+func (h HookFuncs) Before(event *OperationEvent) error {
+	if h.BeforeFunc == nil {
+		return nil
+	}
+	return h.BeforeFunc(event)
+}
+
+func (h HookFuncs) After(event *OperationEvent) {
+	if h.AfterFunc != nil {
+		h.AfterFunc(event)
+	}
+}
+
+// Registers a hook that runs around every operation. Hooks run in the order they were added.
+//
+// Parameters:
+//
+//	hook (Hook) - the hook to register
+//
+// Returns:
+//
+//	func() - removes the hook
+func (fs *Filesystem) Use(hook Hook) func() {
+	registered := &hook
+	fs.hooks = append(fs.hooks, registered)
+
+	return func() {
+		for i, h := range fs.hooks {
+			if h == registered {
+				fs.hooks = append(fs.hooks[:i:i], fs.hooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Runs the operation, surrounded by all registered hooks
+func (fs *Filesystem) runHooks(event *OperationEvent, op func() (string, error)) (string, error) {
+	started := time.Now()
+	end := fs.startSpan(event)
+	if err := fs.beforeHooks(event); err != nil {
+		end(0, err)
+		fs.logOperation(SubsystemOps, event, 0, started, err)
+		fs.profileOperation(event, started, err)
+		return "", err
+	}
+	res, err := func() (string, error) {
+		defer fs.enter(event.Op, event.Path)()
+		fs.applyDueWrites()
+		fs.storage().applyDueWriteBacks()
+		return op()
+	}()
+	fs.afterHooks(event, err)
+	bytes := len(event.Data)
+	if event.Op == OperationRead {
+		bytes = len(res)
+	}
+	end(bytes, err)
+	fs.logOperation(SubsystemOps, event, bytes, started, err)
+	fs.profileOperation(event, started, err)
+	return res, err
+}
+
+func (fs *Filesystem) beforeHooks(event *OperationEvent) error {
+	for _, h := range fs.hooks {
+		if err := (*h).Before(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *Filesystem) afterHooks(event *OperationEvent, err error) {
+	event.Err = err
+	for _, h := range fs.hooks {
+		(*h).After(event)
+	}
+}
@@ -0,0 +1,48 @@
+// hooks_test.go
+package imfs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+
+	// Record every operation that completes
+	seen := []string{}
+	removeAudit := fs.Use(HookFuncs{AfterFunc: func(event *OperationEvent) {
+		result := "ok"
+		if event.Err != nil {
+			result = event.Err.Error()
+		}
+		seen = append(seen, string(event.Op)+" "+event.Path+" "+result)
+	}})
+
+	// Veto writes to read-only files
+	fs.Use(HookFuncs{BeforeFunc: func(event *OperationEvent) error {
+		if event.Op == OperationWrite && event.Path == "readonly.txt" {
+			return errors.New("readonly.txt is read-only")
+		}
+		return nil
+	}})
+
+	fs.MkDir("dir1")
+	fs.MkFile("readonly.txt")
+	res, err := fs.WriteFile("readonly.txt", "hello")
+	assertErrorAndEmptyResult(res, err, "readonly.txt is read-only", t)
+	fs.ReadFile("missing")
+
+	expected := []string{"mkdir dir1 ok", "mkfile readonly.txt ok", "read missing File not found: missing (resolving missing from /)"}
+	if !stringSliceEqual(seen, expected) {
+		t.Errorf("Invalid results: got: %v, expected: %v", seen, expected)
+	}
+
+	// Removed hooks no longer run
+	removeAudit()
+	fs.MkDir("dir2")
+	if len(seen) != len(expected) {
+		t.Errorf("Expected no more events after removing the hook but got %v", seen)
+	}
+}
@@ -0,0 +1,187 @@
+package imfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Decides which paths to leave out of bulk operations (FindOptions.Ignore, WithMaterialized and
+// Options.WriteBackIgnore), using the syntax of .gitignore files:
+//
+//   - blank lines and lines starting with "#" are skipped
+//   - "*", "?" and "[...]" match within a single name, and "**" matches any number of directories
+//   - a pattern ending in "/" only matches directories
+//   - a pattern with a "/" anywhere else is relative to the root, others match at any depth
+//   - a pattern starting with "!" re-includes what an earlier pattern excluded, unless a parent
+//     directory is excluded
+//
+// Paths are relative to the directory the operation starts at. The zero value ignores nothing.
+type IgnoreMatcher struct {
+	rules []ignoreRule
+}
+
+// A parsed ignore pattern
+type ignoreRule struct {
+	// The pattern split at "/", with a leading "**" if it isn't anchored to the root
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// Creates a matcher from patterns in .gitignore syntax, one per element
+//
+// Parameters:
+//
+//	patterns (...string) - the patterns, in the order they'd appear in a .gitignore file
+//
+// Returns:
+//
+//	*IgnoreMatcher - the matcher
+//	error - an error if a pattern is malformed
+func NewIgnoreMatcher(patterns ...string) (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{}
+	for _, pattern := range patterns {
+		if err := m.add(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Creates a matcher from the contents of a .gitignore file
+//
+// Parameters:
+//
+//	r (io.Reader) - the file's contents
+//
+// Returns:
+//
+//	*IgnoreMatcher - the matcher
+//	error - an error if reading fails or a pattern is malformed
+func ParseIgnore(r io.Reader) (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if err := m.add(scanner.Text()); err != nil {
+			return nil, fmt.Errorf("Line %d: %s", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Returns true if the path is ignored, either itself or because one of its parent directories is
+//
+// Parameters:
+//
+//	name (string) - the path, relative to the directory the patterns apply to
+//	isDir (bool) - whether the path is a directory
+//
+// Returns:
+//
+//	bool - true if the path is ignored
+func (m *IgnoreMatcher) Match(name string, isDir bool) bool {
+	name = strings.Trim(path.Clean("/"+strings.TrimPrefix(name, "~")), "/")
+	if m == nil || name == "" {
+		return false
+	}
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.ignores(parts[:i], true) {
+			return true
+		}
+	}
+	return m.ignores(parts, isDir)
+}
+
+// Returns true if the last pattern matching the path excludes it, without checking its parents
+func (m *IgnoreMatcher) ignores(parts []string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(rule.segments, parts) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// Parses a pattern and adds it, skipping blank lines and comments
+func (m *IgnoreMatcher) add(pattern string) error {
+	pattern = strings.TrimSuffix(pattern, "\r")
+	if !strings.HasSuffix(pattern, "\\ ") {
+		pattern = strings.TrimRight(pattern, " \t")
+	}
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return nil
+	}
+
+	rule := ignoreRule{}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, "\\!") || strings.HasPrefix(pattern, "\\#") {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return nil
+	}
+
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		// .gitignore negates character classes with "!", path.Match with "^"
+		segment = strings.ReplaceAll(segment, "[!", "[^")
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("Invalid pattern %q: %s", pattern, err)
+		}
+		segments[i] = segment
+	}
+	if !anchored {
+		segments = append([]string{"**"}, segments...)
+	}
+	rule.segments = segments
+	m.rules = append(m.rules, rule)
+	return nil
+}
+
+// Returns true if the names match the pattern's segments, "**" matching any number of names. A
+// trailing "**" only matches what's inside a directory, not the directory itself.
+func matchSegments(segments []string, parts []string) bool {
+	if len(segments) == 0 {
+		return len(parts) == 0
+	}
+	if segments[0] == "**" {
+		if len(segments) == 1 {
+			return len(parts) > 0
+		}
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(segments[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(segments[0], parts[0]); !matched {
+		return false
+	}
+	return matchSegments(segments[1:], parts[1:])
+}
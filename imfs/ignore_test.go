@@ -0,0 +1,73 @@
+// ignore_test.go
+package imfs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	// Set up test subject
+	m, err := ParseIgnore(strings.NewReader(`# dependencies
+node_modules/
+/build
+*.log
+!keep.log
+docs/**/*.tmp
+\#notes
+trailing\ 
+`))
+	if err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+
+	cases := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"node_modules", true, true},
+		{"web/node_modules", true, true},
+		{"web/node_modules/react/index.js", false, true},
+		{"node_modules", false, false},
+		{"build", true, true},
+		{"build/out.o", false, true},
+		{"src/build", true, false},
+		{"debug.log", false, true},
+		{"logs/app.log", false, true},
+		{"keep.log", false, false},
+		{"node_modules/keep.log", false, true},
+		{"docs/a.tmp", false, true},
+		{"docs/a/b/c.tmp", false, true},
+		{"a.tmp", false, false},
+		{"#notes", false, true},
+		{"trailing ", false, true},
+		{"~/build", true, true},
+		{"main.go", false, false},
+	}
+	for _, c := range cases {
+		if got := m.Match(c.path, c.isDir); got != c.ignored {
+			t.Errorf("Expected Match(%q, %t) to be %t", c.path, c.isDir, c.ignored)
+		}
+	}
+
+	// A trailing "**" matches the contents of a directory, not the directory
+	m, _ = NewIgnoreMatcher("vendor/**", "[!a-m]*.txt")
+	if m.Match("vendor", true) || !m.Match("vendor/lib", true) {
+		t.Errorf("Expected vendor/** to match only inside vendor")
+	}
+	if m.Match("a.txt", false) || !m.Match("z.txt", false) {
+		t.Errorf("Expected [!a-m] to negate the class")
+	}
+
+	// Nil and empty matchers ignore nothing
+	var none *IgnoreMatcher
+	if none.Match("a", false) || (&IgnoreMatcher{}).Match("a", false) {
+		t.Errorf("Expected an empty matcher to ignore nothing")
+	}
+
+	// Malformed patterns are reported with their line
+	if _, err := ParseIgnore(strings.NewReader("ok\n[\n")); err == nil || err.Error() != "Line 2: Invalid pattern \"[\": syntax error in pattern" {
+		t.Errorf("Expected an invalid pattern error but got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+)
+
+// Identifies the content behind a path, like an inode number. Numbers are handed out lazily,
+// start at 1 and are never reused by the same filesystem.
+type InodeID uint64
+
+// Returns the inode of a node, the same one every time for the same node, wherever it is moved.
+// Symbolic links at the end of the path aren't followed, so a link has its own inode. Inodes are
+// kept by the filesystem and shared with its views.
+//
+// Parameters:
+//
+//	path (string) - the path of the node, relative to the current directory or absolute
+//
+// Returns:
+//
+//	InodeID - the node's inode
+//	error - an error if the path does not exist
+func (fs *Filesystem) Inode(path string) (InodeID, error) {
+	file, err := fs.resolve(path)
+	if err != nil {
+		return 0, err
+	}
+	storage := fs.storage()
+	if inode, ok := storage.inodes[file]; ok {
+		return inode, nil
+	}
+	if storage.inodes == nil {
+		storage.inodes = make(map[*util.File]InodeID)
+		storage.inodeNodes = make(map[InodeID]*util.File)
+	}
+	storage.inodeSeq++
+	storage.inodes[file] = storage.inodeSeq
+	storage.inodeNodes[storage.inodeSeq] = file
+	return storage.inodeSeq, nil
+}
+
+// Returns every path leading to an inode, in name order. Nodes have a single parent, since the
+// tree has no hard links yet, so this is at most one path; once hard links exist each of them
+// will be listed here.
+//
+// Parameters:
+//
+//	inode (InodeID) - an inode returned by Inode
+//
+// Returns:
+//
+//	[]string - the absolute paths of the inode, empty if it was removed, was never handed out by
+//	           this filesystem or, from a chroot view, lies outside the view
+func (fs *Filesystem) PathsForInode(inode InodeID) []string {
+	storage := fs.storage()
+	file, ok := storage.inodeNodes[inode]
+	if !ok {
+		return []string{}
+	}
+	if !storage.attached(file) {
+		delete(storage.inodeNodes, inode)
+		delete(storage.inodes, file)
+		return []string{}
+	}
+	if !util.IsAncestor(fs.root, file) {
+		return []string{}
+	}
+	return []string{fullPath(file, fs.root)}
+}
@@ -0,0 +1,52 @@
+// inode_test.go
+package imfs
+
+import (
+	"testing"
+)
+
+func TestInodes(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("a")
+	fs.MkDir("b")
+	fs.MkFile("~/a/file.txt")
+	fs.Symlink("a/file.txt", "link")
+
+	// Inodes are stable, follow the node when it moves, and links have their own
+	inode, err := fs.Inode("a/file.txt")
+	if err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	if again, _ := fs.Inode("~/a/file.txt"); again != inode {
+		t.Errorf("Expected the same inode for the same node but got %d and %d", inode, again)
+	}
+	if link, _ := fs.Inode("link"); link == inode {
+		t.Errorf("Expected the link to have its own inode")
+	}
+	fs.Cd("a")
+	fs.MvFile("file.txt", "~/b")
+	fs.Cd("~")
+	if paths := fs.PathsForInode(inode); !stringSliceEqual(paths, []string{"/b/file.txt"}) {
+		t.Errorf("Expected [/b/file.txt] but got %v", paths)
+	}
+
+	// Views only see the paths inside them
+	view, _ := fs.Chroot("a")
+	if paths := view.PathsForInode(inode); len(paths) != 0 {
+		t.Errorf("Expected no paths outside the view but got %v", paths)
+	}
+
+	// Removed nodes and unknown inodes have no paths
+	fs.Cd("b")
+	fs.Rm("file.txt", false)
+	if paths := fs.PathsForInode(inode); len(paths) != 0 {
+		t.Errorf("Expected no paths for a removed node but got %v", paths)
+	}
+	if paths := fs.PathsForInode(1000); len(paths) != 0 {
+		t.Errorf("Expected no paths for an unknown inode but got %v", paths)
+	}
+	if _, err := fs.Inode("missing"); err == nil {
+		t.Errorf("Expected an error for a missing path")
+	}
+}
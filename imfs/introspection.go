@@ -0,0 +1,95 @@
+package imfs
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"strings"
+)
+
+// The directory (under the root) containing the introspection files when
+// `Options.Introspection` is set
+const IntrospectionDir string = ".fs"
+
+// The number of journal entries shown in the introspection journal file
+const introspectionJournalTail int = 50
+
+// Creates the introspection directory and its virtual files, replacing any regular files with the
+// same names
+func (fs *Filesystem) mountIntrospection() {
+	dir := fs.root.GetChildByName(IntrospectionDir)
+	if dir == nil || !dir.IsDirectory() {
+		dir = util.NewFile(IntrospectionDir, true, fs.root)
+		fs.root.UpsertChild(IntrospectionDir, dir)
+		fs.touch(dir)
+	}
+
+	files := map[string]func() []byte{
+		"stats":       fs.introspectStats,
+		"journal":     fs.introspectJournal,
+		"handles":     fs.introspectHandles,
+		"checkpoints": fs.introspectCheckpoints,
+	}
+	for name, generator := range files {
+		file := util.NewFile(name, false, dir)
+		file.SetVirtual(generator, nil)
+		dir.UpsertChild(name, file)
+		fs.touch(file)
+	}
+}
+
+// Lists the number of files, directories and bytes stored, along with the current generation
+func (fs *Filesystem) introspectStats() []byte {
+	files, dirs, size := 0, 0, 0
+	util.WalkTree(fs.root, func(f *util.File) {
+		if f == fs.root || f.IsVirtual() {
+			return
+		}
+		if f.IsDirectory() {
+			dirs++
+		} else {
+			files++
+			size += len(f.GetContents())
+		}
+	})
+	return []byte(fmt.Sprintf("files: %d\ndirectories: %d\nbytes: %d\ngeneration: %d\njournal: %d\n",
+		files, dirs, size, fs.storage().generation, fs.journalSeq))
+}
+
+// Lists the most recent journal entries, one per line
+func (fs *Filesystem) introspectJournal() []byte {
+	entries := fs.journal
+	if len(entries) > introspectionJournalTail {
+		entries = entries[len(entries)-introspectionJournalTail:]
+	}
+
+	var builder strings.Builder
+	for _, entry := range entries {
+		fmt.Fprintf(&builder, "%d %s %s", entry.Seq, entry.Op, entry.Path)
+		if entry.Target != "" {
+			fmt.Fprintf(&builder, " -> %s", entry.Target)
+		}
+		if len(entry.Data) > 0 {
+			fmt.Fprintf(&builder, " (%d bytes)", len(entry.Data))
+		}
+		builder.WriteString("\n")
+	}
+	return []byte(builder.String())
+}
+
+// Lists the path of every open handle, along with how many bytes it hasn't flushed yet
+func (fs *Filesystem) introspectHandles() []byte {
+	var builder strings.Builder
+	for _, h := range fs.OpenHandles() {
+		fmt.Fprintf(&builder, "%s (%d unflushed bytes)\n", h.Path, h.Unflushed)
+	}
+	return []byte(builder.String())
+}
+
+// Lists the names of all saved checkpoints, one per line
+func (fs *Filesystem) introspectCheckpoints() []byte {
+	var builder strings.Builder
+	for _, name := range fs.ListCheckpoints() {
+		builder.WriteString(name + "\n")
+	}
+	return []byte(builder.String())
+}
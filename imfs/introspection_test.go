@@ -0,0 +1,44 @@
+// introspection_test.go
+package imfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIntrospection(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystemWithOptions(Options{Introspection: true})
+	fs.MkDir("dir1")
+	fs.MkFile("file1")
+	fs.WriteFile("file1", "hello")
+	fs.Checkpoint("c1")
+	fs.Open("file1")
+
+	fs.Cd("~/.fs")
+	res, err := fs.ReadFile("stats")
+	assertMatchesAndNoErrors(res, err, "files: 1\ndirectories: 2\nbytes: 5\ngeneration: 8\njournal: 3\n", t)
+
+	res, err = fs.ReadFile("journal")
+	assertMatchesAndNoErrors(res, err, "1 mkdir /dir1\n2 mkfile /file1\n3 write /file1 (5 bytes)\n", t)
+
+	res, err = fs.ReadFile("handles")
+	assertMatchesAndNoErrors(res, err, "/file1 (0 unflushed bytes)\n", t)
+
+	res, err = fs.ReadFile("checkpoints")
+	assertMatchesAndNoErrors(res, err, "c1\n", t)
+
+	// The introspection files are read-only
+	res, err = fs.WriteFile("stats", "hello")
+	if err == nil || err.Error() != "Virtual file stats is read-only" {
+		t.Errorf("Expected error: Virtual file stats is read-only but got %s", err)
+	}
+
+	// And are recreated after loading a snapshot
+	var buf bytes.Buffer
+	fs.SaveSnapshot(&buf, FormatJSON)
+	fs.LoadSnapshot(&buf)
+	fs.Cd("~/.fs")
+	res, err = fs.ReadFile("checkpoints")
+	assertMatchesAndNoErrors(res, err, "c1\n", t)
+}
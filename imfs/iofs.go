@@ -0,0 +1,201 @@
+package imfs
+
+import (
+	"errors"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"io"
+	iofs "io/fs"
+	"path"
+	"time"
+)
+
+// A live io/fs view of the filesystem, for code written against fs.FS (fs.WalkDir, fs.Glob,
+// template.ParseFS, http.FS and so on). Unlike ToMapFS, it reads the tree as it is when each call
+// is made, so changes show up right away.
+//
+// Names follow the fs.FS rules: slash-separated paths relative to the view's directory, without
+// "." or ".." elements, where "." is the directory itself. Symbolic links are followed. Opened
+// directories implement fs.ReadDirFile, and the view implements fs.SubFS and fs.ReadDirFS, listing
+// LazyDirEntry values.
+//
+// Like the filesystem, the view isn't safe for concurrent use, and opened files hold handles (see
+// OpenHandles) until they're closed.
+type IOFS struct {
+	fs *Filesystem
+	// The directory names are resolved from, as a path from the root; "" for the root
+	dir string
+}
+
+// Returns an io/fs view of the whole tree. See IOFS.
+func (fs *Filesystem) IOFS() *IOFS {
+	return &IOFS{fs: fs}
+}
+
+// Opens a file or directory, implementing fs.FS
+func (f *IOFS) Open(name string) (iofs.File, error) {
+	file, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsDirectory() {
+		return &ioDir{fs: f.fs, name: name, dir: file}, nil
+	}
+	return &ioFile{name: name, handle: f.fs.newHandle(file)}, nil
+}
+
+// Returns a view of a subdirectory, implementing fs.SubFS
+func (f *IOFS) Sub(dir string) (iofs.FS, error) {
+	file, err := f.lookup("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	if !file.IsDirectory() {
+		return nil, &iofs.PathError{Op: "sub", Path: dir, Err: errors.New("not a directory")}
+	}
+	return &IOFS{fs: f.fs, dir: path.Join(f.dir, dir)}, nil
+}
+
+// Lists a directory sorted by name, implementing fs.ReadDirFS
+func (f *IOFS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	dir, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.IsDirectory() {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return util.Map(dir.Children(), func(child *util.File) iofs.DirEntry { return f.fs.lazyEntry(child) }), nil
+}
+
+// Resolves a name from the view's directory, following symbolic links
+func (f *IOFS) lookup(op string, name string) (*util.File, error) {
+	if !iofs.ValidPath(name) {
+		return nil, &iofs.PathError{Op: op, Path: name, Err: iofs.ErrInvalid}
+	}
+	hops := 0
+	file, err := f.fs.walkFollowing(f.fs.root, "/"+path.Join(f.dir, name), &hops)
+	if err != nil {
+		return nil, &iofs.PathError{Op: op, Path: name, Err: iofs.ErrNotExist}
+	}
+	return file, nil
+}
+
+// An opened file, reading through a FileHandle
+type ioFile struct {
+	name   string
+	handle *FileHandle
+}
+
+func (f *ioFile) Read(p []byte) (int, error) {
+	n, err := f.handle.Read(p)
+	if err != nil && err != io.EOF {
+		err = &iofs.PathError{Op: "read", Path: f.name, Err: ioError(err)}
+	}
+	return n, err
+}
+
+func (f *ioFile) Stat() (iofs.FileInfo, error) {
+	if f.handle.closed {
+		return nil, &iofs.PathError{Op: "stat", Path: f.name, Err: iofs.ErrClosed}
+	}
+	return entryInfo{name: path.Base(f.name), entry: f.handle.fs.dirEntry(f.handle.file)}, nil
+}
+
+func (f *ioFile) Close() error {
+	if err := f.handle.Close(); err != nil {
+		return &iofs.PathError{Op: "close", Path: f.name, Err: ioError(err)}
+	}
+	return nil
+}
+
+// An opened directory. Entries are read in name order, picking up after the last one returned, so
+// entries added behind the cursor are skipped and those added ahead of it are seen, like with a
+// real directory.
+type ioDir struct {
+	fs     *Filesystem
+	name   string
+	dir    *util.File
+	after  string
+	closed bool
+}
+
+func (d *ioDir) Read(p []byte) (int, error) {
+	return 0, &iofs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *ioDir) Stat() (iofs.FileInfo, error) {
+	if d.closed {
+		return nil, &iofs.PathError{Op: "stat", Path: d.name, Err: iofs.ErrClosed}
+	}
+	return entryInfo{name: path.Base(d.name), entry: d.fs.dirEntry(d.dir)}, nil
+}
+
+func (d *ioDir) Close() error {
+	if d.closed {
+		return &iofs.PathError{Op: "close", Path: d.name, Err: iofs.ErrClosed}
+	}
+	d.closed = true
+	return nil
+}
+
+// Reads the next n entries, implementing fs.ReadDirFile. With n > 0, at most n entries are
+// returned, and io.EOF once there are none left. With n <= 0, all the remaining entries are
+// returned with a nil error.
+func (d *ioDir) ReadDir(n int) ([]iofs.DirEntry, error) {
+	if d.closed {
+		return nil, &iofs.PathError{Op: "readdir", Path: d.name, Err: iofs.ErrClosed}
+	}
+	if !d.fs.attached(d.dir) && d.dir != d.fs.root {
+		return nil, &iofs.PathError{Op: "readdir", Path: d.name, Err: iofs.ErrNotExist}
+	}
+	entries := []iofs.DirEntry{}
+	d.dir.RangeChildrenAfter(d.after, func(child *util.File) bool {
+		entries = append(entries, d.fs.lazyEntry(child))
+		return n <= 0 || len(entries) < n
+	})
+	if len(entries) > 0 {
+		d.after = entries[len(entries)-1].Name()
+	} else if n > 0 {
+		return entries, io.EOF
+	}
+	return entries, nil
+}
+
+// Describes a DirEntry as an fs.FileInfo
+type entryInfo struct {
+	name  string
+	entry DirEntry
+}
+
+func (i entryInfo) Name() string {
+	return i.name
+}
+
+func (i entryInfo) Size() int64 {
+	return int64(i.entry.Size)
+}
+
+func (i entryInfo) Mode() iofs.FileMode {
+	return i.entry.Mode.Perm() | entryTypeBits(i.entry.Type)
+}
+
+func (i entryInfo) ModTime() time.Time {
+	return i.entry.ModTime
+}
+
+func (i entryInfo) IsDir() bool {
+	return i.entry.Type == EntryDir
+}
+
+// Returns the DirEntry describing the file
+func (i entryInfo) Sys() any {
+	return i.entry
+}
+
+// Maps the filesystem's errors to their io/fs equivalents where there is one
+func ioError(err error) error {
+	if errors.Is(err, ErrClosed) {
+		return iofs.ErrClosed
+	}
+	return err
+}
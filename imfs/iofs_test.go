@@ -0,0 +1,131 @@
+// iofs_test.go
+package imfs
+
+import (
+	"errors"
+	"io"
+	iofs "io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func newIOFSFixture(t *testing.T) *Filesystem {
+	fs, err := FromMapFS(fstest.MapFS{
+		"docs/a.txt":        {Data: []byte("hello")},
+		"docs/b.txt":        {Data: []byte("world")},
+		"docs/nested/c.txt": {Data: []byte("!")},
+		"empty":             {Mode: iofs.ModeDir},
+		"top.txt":           {Data: []byte("top")},
+	}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestIOFS(t *testing.T) {
+	fs := newIOFSFixture(t)
+	if err := fstest.TestFS(fs.IOFS(), "docs/a.txt", "docs/b.txt", "docs/nested/c.txt", "empty", "top.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := iofs.ReadFile(fs.IOFS(), "docs/a.txt")
+	assertMatchesAndNoErrors(string(data), err, "hello", t)
+	if _, err := fs.IOFS().Open("../top.txt"); !errors.Is(err, iofs.ErrInvalid) {
+		t.Errorf("Expected ErrInvalid for a path with .., got %v", err)
+	}
+	if _, err := fs.IOFS().Open("missing"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist, got %v", err)
+	}
+
+	// Changes show up right away
+	fs.Cd("docs")
+	fs.WriteFile("a.txt", " again")
+	data, err = iofs.ReadFile(fs.IOFS(), "docs/a.txt")
+	assertMatchesAndNoErrors(string(data), err, "hello again", t)
+	fs.AssertNoLeakedHandles(t)
+}
+
+func TestIOFSSub(t *testing.T) {
+	fs := newIOFSFixture(t)
+	sub, err := iofs.Sub(fs.IOFS(), "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sub.(*IOFS); !ok {
+		t.Errorf("Expected Sub to return an *IOFS, got %T", sub)
+	}
+	if err := fstest.TestFS(sub, "a.txt", "b.txt", "nested/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	nested, err := iofs.Sub(sub, "nested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := iofs.ReadFile(nested, "c.txt")
+	assertMatchesAndNoErrors(string(data), err, "!", t)
+
+	if _, err := iofs.Sub(fs.IOFS(), "top.txt"); err == nil {
+		t.Errorf("Expected an error for a file")
+	}
+	if _, err := iofs.Sub(fs.IOFS(), "missing"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist, got %v", err)
+	}
+}
+
+func TestIOFSReadDir(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkDir("big")
+	fs.Cd("big")
+	for _, name := range strings.Fields("a b c d e") {
+		fs.MkFile(name)
+	}
+
+	f, err := fs.IOFS().Open("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := f.(iofs.ReadDirFile)
+
+	// Batches of at most n entries, then io.EOF with no entries
+	names := func(entries []iofs.DirEntry) string {
+		out := []string{}
+		for _, entry := range entries {
+			out = append(out, entry.Name())
+		}
+		return strings.Join(out, " ")
+	}
+	entries, err := dir.ReadDir(2)
+	assertMatchesAndNoErrors(names(entries), err, "a b", t)
+
+	// Entries added ahead of the cursor are seen, those behind it aren't
+	fs.MkFile("aa")
+	fs.MkFile("cc")
+	entries, err = dir.ReadDir(2)
+	assertMatchesAndNoErrors(names(entries), err, "c cc", t)
+	entries, err = dir.ReadDir(5)
+	assertMatchesAndNoErrors(names(entries), err, "d e", t)
+	entries, err = dir.ReadDir(1)
+	if len(entries) != 0 || err != io.EOF {
+		t.Errorf("Expected no entries and io.EOF at the end, got %q, %v", names(entries), err)
+	}
+
+	// n <= 0 returns everything left, with a nil error even when nothing is
+	entries, err = dir.ReadDir(-1)
+	if len(entries) != 0 || err != nil {
+		t.Errorf("Expected no entries and no error, got %q, %v", names(entries), err)
+	}
+	f.Close()
+	f, _ = fs.IOFS().Open("big")
+	entries, err = f.(iofs.ReadDirFile).ReadDir(0)
+	assertMatchesAndNoErrors(names(entries), err, "a aa b c cc d e", t)
+
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Expected an error reading a directory")
+	}
+	f.Close()
+	if _, err := f.(iofs.ReadDirFile).ReadDir(1); !errors.Is(err, iofs.ErrClosed) {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package imfs
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// The maximum number of entries kept in memory by Journal. Older entries are dropped.
+const JournalRetention int = 1000
+
+// The version of the journal stream written by StreamJournal, announced in a header line before
+// the first entry. Bump this whenever JournalEntry changes incompatibly.
+//
+// Version 2 added Encrypted, and version 3 OpRetarget.
+const JournalVersion int = 3
+
+// The first line of a journal stream
+type journalHeader struct {
+	JournalVersion int `json:"journalVersion"`
+}
+
+// The kind of modification recorded by a JournalEntry
+type JournalOp string
+
+const (
+	// A directory was created at Path
+	OpMkDir JournalOp = "mkdir"
+	// An empty file was created at Path
+	OpMkFile JournalOp = "mkfile"
+	// An empty named pipe was created at Path
+	OpMkFifo JournalOp = "mkfifo"
+	// A special node was created at Path, with the name of its util.FileKind in Data
+	OpMkSpecial JournalOp = "mkspecial"
+	// A symbolic link was created at Path, pointing at Target
+	OpSymlink JournalOp = "symlink"
+	// The existing symbolic link at Path was changed to point at Target, after a move with
+	// Options.RepointLinks. Unlike OpSymlink, the link isn't a new entry of its directory
+	OpRetarget JournalOp = "retarget"
+	// A remote file was created at Path, fetching its contents from the URL in Target
+	OpMkRemote JournalOp = "mkremote"
+	// Data was appended to the file at Path
+	OpWrite JournalOp = "write"
+	// The file at Path was created if needed and its contents replaced with Data
+	OpPut JournalOp = "put"
+	// The file or directory at Path was removed, along with all of its children
+	OpRm JournalOp = "rm"
+	// The file at Path was moved to Target
+	OpMv JournalOp = "mv"
+	// The permission bits of Path were set to Data, in octal
+	OpChmod JournalOp = "chmod"
+	// The owner of Path was set to Target
+	OpChown JournalOp = "chown"
+	// The whole tree was replaced by the JSON snapshot in Data
+	OpLoad JournalOp = "load"
+)
+
+// A single modification to the filesystem. Paths are always relative to the root.
+type JournalEntry struct {
+	Seq    uint64    `json:"seq"`
+	Op     JournalOp `json:"op"`
+	Path   string    `json:"path,omitempty"`
+	Target string    `json:"target,omitempty"`
+	Data   []byte    `json:"data,omitempty"`
+	// Set if Data holds file contents sealed with `Options.EncryptionKey`, as OpWrite and OpPut
+	// entries do on an encrypted filesystem. ApplyJournalEntry unseals them with its own key.
+	Encrypted bool `json:"encrypted,omitempty"`
+}
+
+// Returns the most recent journal entries (up to `JournalRetention`), oldest first. With
+// `Options.EncryptionKey` set, the file contents they hold are encrypted.
+func (fs *Filesystem) Journal() []JournalEntry {
+	return append([]JournalEntry{}, fs.journal...)
+}
+
+// Writes every future journal entry to w as a line of JSON, e.g. to feed a replica over a
+// network connection (see Follow), after a header line with the JournalVersion. Entries are
+// written synchronously as each modification happens, with file contents encrypted as in Journal. Writing stops after the first error or
+// once the returned function is called.
+//
+// Parameters:
+//
+//	w (io.Writer) - where to stream the journal
+//
+// Returns:
+//
+//	func() - stops streaming
+func (fs *Filesystem) StreamJournal(w io.Writer) func() {
+	enc := json.NewEncoder(w)
+	id := fs.nextSubscriberID
+	fs.nextSubscriberID++
+	if enc.Encode(journalHeader{JournalVersion: JournalVersion}) != nil {
+		return func() {}
+	}
+
+	fs.journalSubscribers[id] = func(entry JournalEntry) {
+		if enc.Encode(entry) != nil {
+			delete(fs.journalSubscribers, id)
+		}
+	}
+	return func() {
+		delete(fs.journalSubscribers, id)
+	}
+}
+
+// Assigns the next sequence number to the entry, appends it to the journal and sends it to any
+// subscribers. File contents are sealed first on an encrypted filesystem, so they never sit in the
+// journal in plain text; the rest of the filesystem still gets the entry as it was.
+func (fs *Filesystem) record(entry JournalEntry) {
+	fs.journalSeq++
+	entry.Seq = fs.journalSeq
+
+	kept := entry
+	if fs.encrypted() && (entry.Op == OpWrite || entry.Op == OpPut) {
+		kept = fs.sealEntry(entry)
+	}
+	fs.journal = append(fs.journal, kept)
+	if len(fs.journal) > JournalRetention {
+		fs.journal = fs.journal[len(fs.journal)-JournalRetention:]
+	}
+
+	for _, subscriber := range fs.journalSubscribers {
+		subscriber(kept)
+	}
+	fs.recordInParent(entry)
+	if fs.chrootParent == nil {
+		fs.queueWriteBack(entry)
+		fs.trackListing(entry)
+		fs.updateIndex(entry)
+		fs.updateDirModTimes(entry)
+		fs.updateUsage(entry)
+		fs.updateLinkIndex(entry)
+	}
+	if fs.supervisor != nil {
+		fs.supervisor.report(fs)
+	}
+}
@@ -0,0 +1,75 @@
+package imfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Describes a handle that has been opened but not yet closed
+type HandleInfo struct {
+	// The full path of the open file
+	Path string
+	// How many written bytes haven't been flushed yet
+	Unflushed int
+	// Where the handle was opened, if `Options.TrackHandleStacks` is set
+	Stack string
+}
+
+// The subset of testing.TB used by AssertNoLeakedHandles, so this package doesn't depend on the
+// testing package
+type TestReporter interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Returns every handle that has been opened but not closed, ordered by path and then by when it
+// was opened
+func (fs *Filesystem) OpenHandles() []HandleInfo {
+	handles := make([]*FileHandle, 0, len(fs.handles))
+	for h := range fs.handles {
+		handles = append(handles, h)
+	}
+	paths := make(map[*FileHandle]string, len(handles))
+	for _, h := range handles {
+		paths[h] = h.file.GetFullPathName(fs.root)
+	}
+	sort.Slice(handles, func(i, j int) bool {
+		if paths[handles[i]] != paths[handles[j]] {
+			return paths[handles[i]] < paths[handles[j]]
+		}
+		return handles[i].id < handles[j].id
+	})
+
+	infos := make([]HandleInfo, 0, len(handles))
+	for _, h := range handles {
+		infos = append(infos, HandleInfo{Path: paths[h], Unflushed: len(h.dirty), Stack: h.stack})
+	}
+	return infos
+}
+
+// Fails the test if any handles are still open, listing each leaked handle (and where it was
+// opened, if `Options.TrackHandleStacks` is set). Typically deferred or registered with
+// t.Cleanup at the start of a test.
+//
+// Parameters:
+//
+//	t (TestReporter) - the test to fail, usually a *testing.T
+func (fs *Filesystem) AssertNoLeakedHandles(t TestReporter) {
+	t.Helper()
+
+	leaked := fs.OpenHandles()
+	if len(leaked) == 0 {
+		return
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%d file handle(s) were never closed:", len(leaked))
+	for _, h := range leaked {
+		fmt.Fprintf(&builder, "\n  %s", h.Path)
+		if h.Stack != "" {
+			fmt.Fprintf(&builder, ", opened at:\n%s", h.Stack)
+		}
+	}
+	t.Errorf("%s", builder.String())
+}
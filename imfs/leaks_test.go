@@ -0,0 +1,65 @@
+// leaks_test.go
+package imfs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Records failures instead of failing the real test
+type fakeReporter struct {
+	failures []string
+}
+
+func (r *fakeReporter) Helper() {}
+
+func (r *fakeReporter) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestLeakedHandles(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystemWithOptions(Options{TrackHandleStacks: true})
+	fs.MkFile("file1")
+	fs.MkFile("file2")
+
+	h1, _ := fs.Open("file1")
+	h2, _ := fs.Open("file2")
+	h2.Write([]byte("hi"))
+	defer fs.AssertNoLeakedHandles(t)
+
+	// Not exactly how the helper is meant to be used, but lets us check what it reports
+	reporter := &fakeReporter{}
+	fs.AssertNoLeakedHandles(reporter)
+	if len(reporter.failures) != 1 {
+		t.Fatalf("Expected one failure but got %v", reporter.failures)
+	}
+	failure := reporter.failures[0]
+	if !strings.Contains(failure, "2 file handle(s)") || !strings.Contains(failure, "/file1") ||
+		!strings.Contains(failure, "TestLeakedHandles") {
+		t.Errorf("Expected the failure to list both handles with stacks but got: %s", failure)
+	}
+
+	handles := fs.OpenHandles()
+	if len(handles) != 2 || handles[0].Path != "/file1" || handles[1].Path != "/file2" || handles[1].Unflushed != 0 {
+		t.Errorf("Expected two open handles but got %+v", handles)
+	}
+
+	// Nothing is reported once everything is closed
+	h1.Close()
+	h2.Close()
+	reporter = &fakeReporter{}
+	fs.AssertNoLeakedHandles(reporter)
+	if len(reporter.failures) != 0 {
+		t.Errorf("Expected no failures but got %v", reporter.failures)
+	}
+
+	// Stacks are only captured when asked for
+	fs = NewFileSystem()
+	fs.MkFile("file1")
+	fs.Open("file1")
+	if handles = fs.OpenHandles(); len(handles) != 1 || handles[0].Stack != "" {
+		t.Errorf("Expected one handle without a stack but got %+v", handles)
+	}
+}
@@ -0,0 +1,54 @@
+package imfs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// A part of the filesystem whose logging can be tuned separately (see Options.LogLevels)
+type Subsystem string
+
+const (
+	// Operations on the filesystem, e.g. MkDir, WriteFile, Chmod
+	SubsystemOps Subsystem = "ops"
+	// Reads and writes through a FileHandle
+	SubsystemHandles Subsystem = "handles"
+	// Journal entries applied to a replica
+	SubsystemReplica Subsystem = "replica"
+)
+
+// Logs a message if a logger is set and the level is enabled for the subsystem. Every record
+// carries a "subsystem" attribute.
+func (fs *Filesystem) log(subsystem Subsystem, level slog.Level, msg string, attrs ...slog.Attr) {
+	if fs.opts.Logger == nil {
+		return
+	}
+	if min, ok := fs.opts.LogLevels[subsystem]; ok && level < min.Level() {
+		return
+	}
+	attrs = append([]slog.Attr{slog.String("subsystem", string(subsystem))}, attrs...)
+	fs.opts.Logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// Logs a finished operation: failures at Warn, mutations at Debug. Successful reads aren't logged
+func (fs *Filesystem) logOperation(subsystem Subsystem, event *OperationEvent, bytes int, started time.Time, err error) {
+	if fs.opts.Logger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("op", string(event.Op)),
+		slog.String("path", event.Path),
+		slog.Int("bytes", bytes),
+		slog.Duration("duration", time.Since(started)),
+	}
+	if event.Target != "" {
+		attrs = append(attrs, slog.String("target", event.Target))
+	}
+	switch {
+	case err != nil:
+		fs.log(subsystem, slog.LevelWarn, "operation failed", append(attrs, slog.String("error", err.Error()))...)
+	case event.Op != OperationRead:
+		fs.log(subsystem, slog.LevelDebug, "operation", attrs...)
+	}
+}
@@ -0,0 +1,79 @@
+// logging_test.go
+package imfs
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// Returns a logger writing every level to buf, without timestamps or durations so records can be
+// compared exactly
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "duration" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+func TestLogging(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fs := NewFileSystemWithOptions(Options{Logger: newTestLogger(buf)})
+
+	fs.MkFile("a.txt")
+	fs.WriteFile("a.txt", "hello")
+	fs.ReadFile("a.txt")
+	fs.ReadFile("missing.txt")
+
+	expected := []string{
+		`level=DEBUG msg=operation subsystem=ops op=mkfile path=a.txt bytes=0`,
+		`level=DEBUG msg=operation subsystem=ops op=write path=a.txt bytes=5`,
+		`level=WARN msg="operation failed" subsystem=ops op=read path=missing.txt bytes=0 error="File not found: missing.txt (resolving missing.txt from /)"`,
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !stringSliceEqual(lines, expected) {
+		t.Errorf("Expected log lines\n%s\ngot\n%s", strings.Join(expected, "\n"), buf.String())
+	}
+}
+
+func TestLoggingLevelsPerSubsystem(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fs := NewFileSystemWithOptions(Options{
+		Logger:    newTestLogger(buf),
+		LogLevels: map[Subsystem]slog.Leveler{SubsystemOps: slog.LevelWarn},
+	})
+
+	fs.MkFile("a.txt")
+	h, _ := fs.Open("a.txt")
+	defer h.Close()
+	h.Write([]byte("abc"))
+
+	expected := []string{`level=DEBUG msg=operation subsystem=handles op=write path=/a.txt bytes=3`}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !stringSliceEqual(lines, expected) {
+		t.Errorf("Expected log lines\n%s\ngot\n%s", strings.Join(expected, "\n"), buf.String())
+	}
+}
+
+func TestLoggingReplica(t *testing.T) {
+	buf := &bytes.Buffer{}
+	replica := NewFileSystemWithOptions(Options{Logger: newTestLogger(buf)})
+
+	replica.ApplyJournalEntry(JournalEntry{Seq: 1, Op: OpMkDir, Path: "/docs"})
+	replica.ApplyJournalEntry(JournalEntry{Seq: 3, Op: OpMkDir, Path: "/other"})
+
+	expected := []string{
+		`level=DEBUG msg="journal entry applied" subsystem=replica seq=1 op=mkdir path=/docs bytes=0`,
+		`level=WARN msg="journal entry rejected" subsystem=replica seq=3 error="Journal gap: expected entry 2 but got 3"`,
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !stringSliceEqual(lines, expected) {
+		t.Errorf("Expected log lines\n%s\ngot\n%s", strings.Join(expected, "\n"), buf.String())
+	}
+}
@@ -0,0 +1,163 @@
+package imfs
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	iofs "io/fs"
+	"sort"
+	"testing/fstest"
+)
+
+// Returns the whole tree as an fstest.MapFS, so tests can compare it against a literal map in a
+// single reflect.DeepEqual call:
+//
+//	want := fstest.MapFS{
+//		"docs/a.txt": {Data: []byte("hello")},
+//		"empty":      {Mode: fs.ModeDir},
+//	}
+//
+// To keep literals short, only what differs from a plain file is set: Data holds the contents,
+// and Mode is 0 unless the permissions differ from the defaults (0644 for files, 0755 for
+// directories) or the entry isn't a regular file. Directories are only listed when empty, since
+// MapFS infers the others from the paths. Symbolic links have fs.ModeSymlink and their target as
+// Data, pipes fs.ModeNamedPipe, and special nodes fs.ModeDevice|fs.ModeCharDevice and their kind
+// ("null", "zero" or "random") as Data. Modification times are left out, and so are virtual files.
+func (fs *Filesystem) ToMapFS() fstest.MapFS {
+	m := fstest.MapFS{}
+	util.WalkTree(fs.root, func(f *util.File) {
+		if f == fs.root || f.IsVirtual() || (f.IsDirectory() && f.NumChildren() > 0) {
+			return
+		}
+		m[f.GetFullPathName(fs.root)[1:]] = mapFile(f)
+	})
+	return m
+}
+
+func mapFile(f *util.File) *fstest.MapFile {
+	file := &fstest.MapFile{}
+	defaultMode := util.DefaultFileMode
+	switch {
+	case f.IsDirectory():
+		file.Mode = iofs.ModeDir
+		defaultMode = util.DefaultDirMode
+	case f.IsSymlink():
+		file.Mode = iofs.ModeSymlink
+		file.Data = f.GetContents()
+	case f.IsFifo():
+		file.Mode = iofs.ModeNamedPipe
+		file.Data = f.GetContents()
+	case f.GetKind().IsSpecial():
+		file.Mode = iofs.ModeDevice | iofs.ModeCharDevice
+		file.Data = []byte(f.GetKind().String())
+	default:
+		file.Data = f.GetContents()
+	}
+	if f.GetMode() != defaultMode {
+		file.Mode |= f.GetMode()
+	}
+	if len(file.Data) == 0 {
+		// So that empty files compare equal to literals without Data
+		file.Data = nil
+	} else {
+		file.Data = append([]byte{}, file.Data...)
+	}
+	return file
+}
+
+// Creates a filesystem containing the entries of an fstest.MapFS, the reverse of ToMapFS. Parent
+// directories are created as needed. A Mode without permission bits gets the default permissions,
+// and a zero ModTime the current time.
+//
+// Parameters:
+//
+//	m (fstest.MapFS) - the entries to create
+//	opts (Options) - the options of the new filesystem
+//
+// Returns:
+//
+//	*Filesystem - the new filesystem
+//	error - an error if a path is used as both a file and a directory, or an entry is invalid
+func FromMapFS(m fstest.MapFS, opts Options) (*Filesystem, error) {
+	fs := NewFileSystemWithOptions(opts)
+	paths := make([]string, 0, len(m))
+	for path := range m {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := fs.addMapFile(path, m[path]); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	return fs, nil
+}
+
+// Creates a single MapFS entry, along with any missing parent directories
+func (fs *Filesystem) addMapFile(path string, mapFile *fstest.MapFile) error {
+	if !iofs.ValidPath(path) || path == "." {
+		return fmt.Errorf("Invalid path")
+	}
+	names := util.SplitPath(path)
+
+	parent := fs.root
+	for _, name := range names[:len(names)-1] {
+		child := parent.GetChildByName(name)
+		if child == nil {
+			child = util.NewFile(name, true, parent)
+			parent.UpsertChild(name, child)
+			fs.touch(child)
+		} else if !child.IsDirectory() {
+			return fmt.Errorf("%s is not a directory", child.GetFullPathName(fs.root))
+		}
+		parent = child
+	}
+
+	name := names[len(names)-1]
+	mode := mapFile.Mode
+	existing := parent.GetChildByName(name)
+	if existing != nil && !(existing.IsDirectory() && mode.IsDir()) {
+		return fmt.Errorf("%s already exists", existing.GetFullPathName(fs.root))
+	}
+
+	var file *util.File
+	switch {
+	case mode.IsDir():
+		file = existing
+		if file == nil {
+			file = util.NewFile(name, true, parent)
+		}
+	case mode&iofs.ModeSymlink != 0:
+		file = util.NewSymlink(name, string(mapFile.Data), parent).File()
+	case mode&iofs.ModeNamedPipe != 0:
+		file = util.NewFile(name, false, parent)
+		file.SetKind(util.KindFifo)
+		if err := file.SetContents(mapFile.Data); err != nil {
+			return err
+		}
+	case mode&iofs.ModeDevice != 0:
+		kind, ok := util.ParseFileKind(string(mapFile.Data))
+		if !ok || !kind.IsSpecial() {
+			return fmt.Errorf("Unknown special node %q", mapFile.Data)
+		}
+		file = util.NewFile(name, false, parent)
+		file.SetKind(kind)
+	case mode.IsRegular():
+		file = util.NewFile(name, false, parent)
+		if err := file.SetContents(mapFile.Data); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unsupported mode %s", mode)
+	}
+
+	if mode.Perm() != 0 {
+		file.SetMode(mode.Perm())
+	}
+	parent.UpsertChild(name, file)
+	fs.touch(file)
+	if !mapFile.ModTime.IsZero() {
+		file.SetModTime(mapFile.ModTime)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// mapfs_test.go
+package imfs
+
+import (
+	iofs "io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestToMapFS(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkDir("docs")
+	fs.MkDir("empty")
+	fs.Cd("docs")
+	fs.MkFile("a.txt")
+	fs.WriteFile("a.txt", "hello")
+	fs.MkFile("blank")
+	fs.MkFile("run.sh")
+	fs.Chmod("run.sh", 0755, false)
+	fs.Symlink("a.txt", "link")
+	fs.MkFifo("pipe")
+	fs.MkSpecial("null", SpecialNull)
+
+	want := fstest.MapFS{
+		"docs/a.txt":  {Data: []byte("hello")},
+		"docs/blank":  {},
+		"docs/run.sh": {Mode: 0755},
+		"docs/link":   {Mode: iofs.ModeSymlink, Data: []byte("a.txt")},
+		"docs/pipe":   {Mode: iofs.ModeNamedPipe},
+		"docs/null":   {Mode: iofs.ModeDevice | iofs.ModeCharDevice, Data: []byte("null")},
+		"empty":       {Mode: iofs.ModeDir},
+	}
+	if got := fs.ToMapFS(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestFromMapFS(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := fstest.MapFS{
+		"docs/a.txt":   {Data: []byte("hello"), ModTime: modTime},
+		"docs/run.sh":  {Data: []byte("echo"), Mode: 0700},
+		"docs/link":    {Mode: iofs.ModeSymlink, Data: []byte("a.txt")},
+		"empty":        {Mode: iofs.ModeDir},
+		"deep/er/file": {},
+	}
+	fs, err := FromMapFS(m, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := fs.Readlink("~/docs/link")
+	assertMatchesAndNoErrors(res, err, "a.txt", t)
+	entries, err := fs.LsEntries("~/docs")
+	if err != nil || len(entries) != 3 || !entries[0].ModTime.Equal(modTime) || entries[2].Mode != 0700 {
+		t.Errorf("Expected a.txt's time and run.sh's mode to be kept, got %+v (%v)", entries, err)
+	}
+
+	// Round trips, apart from the modification time, which ToMapFS leaves out
+	m["docs/a.txt"].ModTime = time.Time{}
+	if got := fs.ToMapFS(); !reflect.DeepEqual(got, m) {
+		t.Errorf("Expected %v, got %v", m, got)
+	}
+
+	_, err = FromMapFS(fstest.MapFS{"a": {}, "a/b": {}}, Options{})
+	assertErrorAndEmptyResult("", err, "a/b: /a is not a directory", t)
+	_, err = FromMapFS(fstest.MapFS{"../escape": {}}, Options{})
+	assertErrorAndEmptyResult("", err, "../escape: Invalid path", t)
+	_, err = FromMapFS(fstest.MapFS{"dev": {Mode: iofs.ModeDevice, Data: []byte("disk")}}, Options{})
+	assertErrorAndEmptyResult("", err, `dev: Unknown special node "disk"`, t)
+}
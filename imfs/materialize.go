@@ -0,0 +1,199 @@
+package imfs
+
+import (
+	"crypto/sha256"
+	"github.com/bwent/in-memory-fs/internal/util"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// What WithMaterialized wrote for an entry, to tell what the callback changed
+type materialized struct {
+	kind iofs.FileMode
+	// The SHA-256 of a file's contents
+	sum [sha256.Size]byte
+	// A symbolic link's target, as it is in the tree
+	target string
+}
+
+// Writes the tree to a temporary directory on the real disk, runs fn on it, and brings what fn
+// changed back into the tree before removing the directory, for tools that only work on real
+// paths, like compilers or git. Directories, regular files (with their permission bits) and
+// symbolic links are written; links starting with "/" or "~" are written relative to the
+// directory, so they stay inside it. Pipes, special, remote and virtual files are left out.
+//
+// Afterwards, files fn created or changed are written to the tree, directories and links it
+// created are added, and whatever it removed is removed, all at once with Apply (in a view,
+// in order, stopping at the first failure). Permission changes aren't brought back.
+//
+// The paths ignore matches (relative to the root) are neither written nor brought back, so e.g.
+// dependencies can be left out, and build output fn writes there doesn't end up in the tree.
+//
+// Parameters:
+//
+//	ignore (*IgnoreMatcher) - the paths to leave out, or nil to write everything
+//	fn (func(tmpDir string) error) - called with the path of the temporary directory
+//
+// Returns:
+//
+//	error - the error from fn, in which case its changes are discarded, or an error writing the
+//	        tree out or bringing the changes back
+func (fs *Filesystem) WithMaterialized(ignore *IgnoreMatcher, fn func(tmpDir string) error) error {
+	if fs.replica {
+		return ErrReadOnly
+	}
+	tmpDir, err := os.MkdirTemp("", "imfs-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	written, err := fs.materialize(tmpDir, ignore)
+	if err != nil {
+		return err
+	}
+	if err := fn(tmpDir); err != nil {
+		return err
+	}
+	ops, err := materializedChanges(tmpDir, written, ignore)
+	if err != nil {
+		return err
+	}
+	if fs.chrootParent != nil {
+		return fs.applyOps(ops)
+	}
+	return fs.Apply(ops)
+}
+
+// Writes the tree below dir, except what ignore matches, returning what was written by slash
+// separated relative path
+func (fs *Filesystem) materialize(dir string, ignore *IgnoreMatcher) (map[string]materialized, error) {
+	written := map[string]materialized{}
+	var err error
+	util.WalkTree(fs.root, func(f *util.File) {
+		if err != nil || f == fs.root || f.IsVirtual() {
+			return
+		}
+		rel := fullPath(f, fs.root)[1:]
+		if ignore.Match(rel, f.IsDirectory()) {
+			return
+		}
+		hostPath := filepath.Join(dir, filepath.FromSlash(rel))
+		switch {
+		case f.IsDirectory():
+			err = os.Mkdir(hostPath, util.DefaultDirMode)
+			written[rel] = materialized{kind: iofs.ModeDir}
+		case f.IsSymlink():
+			target := string(f.GetContents())
+			err = os.Symlink(hostLinkTarget(fullPath(f.GetParent(), fs.root), target), hostPath)
+			written[rel] = materialized{kind: iofs.ModeSymlink, target: target}
+		case f.GetKind() == util.KindRegular:
+			data := f.GetContents()
+			err = os.WriteFile(hostPath, data, f.GetMode().Perm())
+			written[rel] = materialized{sum: sha256.Sum256(data)}
+		}
+	})
+	return written, err
+}
+
+// Returns the target of a link in the directory dir of the tree as written to the real disk:
+// absolute targets are made relative, so they don't leave the materialized tree
+func hostLinkTarget(dir string, target string) string {
+	if !strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "~") {
+		return target
+	}
+	return relativeTarget(dir, lexicalTarget(dir, target))
+}
+
+// Compares the directory with what was written to it, returning the changes to bring back:
+// removals first, then new directories, then new and changed files and links. What ignore
+// matches is skipped.
+func materializedChanges(dir string, written map[string]materialized, ignore *IgnoreMatcher) ([]Op, error) {
+	removals, creations := []Op{}, []Op{}
+	// Everything found, and the directories that were written and are still directories
+	seen, keptDirs := map[string]bool{}, map[string]bool{"/": true}
+	err := filepath.WalkDir(dir, func(hostPath string, entry iofs.DirEntry, err error) error {
+		if err != nil || hostPath == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, hostPath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ignore.Match(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		path := "~/" + rel
+		seen[rel] = true
+		before, existed := written[rel]
+
+		switch kind := entry.Type() & (iofs.ModeDir | iofs.ModeSymlink); {
+		case kind == iofs.ModeSymlink:
+			target, err := os.Readlink(hostPath)
+			if err != nil {
+				return err
+			}
+			if existed && before.kind == kind && hostLinkTarget(parentOf(rel), before.target) == target {
+				return nil
+			}
+			if existed {
+				removals = append(removals, Op{Op: OperationRm, Path: path, Recursive: before.kind == iofs.ModeDir})
+			}
+			creations = append(creations, Op{Op: OperationSymlink, Path: path, Target: target})
+		case kind == iofs.ModeDir:
+			if existed && before.kind == kind {
+				keptDirs["/"+rel] = true
+				return nil
+			}
+			if existed {
+				removals = append(removals, Op{Op: OperationRm, Path: path})
+			}
+			creations = append(creations, Op{Op: OperationMkDir, Path: path})
+		case entry.Type().IsRegular():
+			data, err := os.ReadFile(hostPath)
+			if err != nil {
+				return err
+			}
+			if existed && before.kind == 0 && before.sum == sha256.Sum256(data) {
+				return nil
+			}
+			if existed && before.kind != 0 {
+				removals = append(removals, Op{Op: OperationRm, Path: path, Recursive: before.kind == iofs.ModeDir})
+			}
+			creations = append(creations, Op{Op: OperationWrite, Path: path, Data: string(data)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries that are gone, skipping those inside a directory that is gone or replaced, since
+	// removing it removes them
+	gone := []string{}
+	for rel := range written {
+		if !seen[rel] && keptDirs[parentOf(rel)] {
+			gone = append(gone, rel)
+		}
+	}
+	sort.Strings(gone)
+	for _, rel := range gone {
+		removals = append(removals, Op{Op: OperationRm, Path: "~/" + rel, Recursive: written[rel].kind == iofs.ModeDir})
+	}
+	return append(removals, creations...), nil
+}
+
+// Returns the absolute path in the tree of the directory containing a relative path
+func parentOf(rel string) string {
+	if i := strings.LastIndex(rel, "/"); i >= 0 {
+		return "/" + rel[:i]
+	}
+	return "/"
+}
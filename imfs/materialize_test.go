@@ -0,0 +1,102 @@
+// materialize_test.go
+package imfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithMaterialized(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("docs")
+	fs.MkDir("old")
+	fs.MkFile("~/docs/a.txt")
+	fs.WriteFile("~/docs/a.txt", "hello")
+	fs.MkFile("~/docs/b.txt")
+	fs.MkFile("~/old/c.txt")
+	fs.Symlink("/docs/a.txt", "link")
+
+	// The tree is on disk, with absolute links kept inside it, and changes come back
+	err := fs.WithMaterialized(nil, func(dir string) error {
+		data, err := os.ReadFile(filepath.Join(dir, "link"))
+		if err != nil || string(data) != "hello" {
+			t.Errorf("Expected to read hello through the link but got %q, %v", data, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "docs", "a.txt"), []byte("changed"), 0644); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(dir, "new"), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "new", "d.txt"), []byte("new"), 0644); err != nil {
+			return err
+		}
+		if err := os.Remove(filepath.Join(dir, "docs", "b.txt")); err != nil {
+			return err
+		}
+		return os.RemoveAll(filepath.Join(dir, "old"))
+	})
+	if err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	res, err := fs.ReadFile("~/docs/a.txt")
+	assertMatchesAndNoErrors(res, err, "changed", t)
+	res, err = fs.ReadFile("~/new/d.txt")
+	assertMatchesAndNoErrors(res, err, "new", t)
+	res, err = fs.Ls("~")
+	assertMatchesAndNoErrors(res, err, "docs link new", t)
+	res, err = fs.Ls("~/docs")
+	assertMatchesAndNoErrors(res, err, "a.txt", t)
+	res, err = fs.Readlink("link")
+	assertMatchesAndNoErrors(res, err, "/docs/a.txt", t)
+
+	// Changes are discarded when the callback fails, and the directory is removed either way
+	var materializedDir string
+	failure := errors.New("build failed")
+	err = fs.WithMaterialized(nil, func(dir string) error {
+		materializedDir = dir
+		os.WriteFile(filepath.Join(dir, "docs", "a.txt"), []byte("discarded"), 0644)
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the callback's error but got %v", err)
+	}
+	res, err = fs.ReadFile("~/docs/a.txt")
+	assertMatchesAndNoErrors(res, err, "changed", t)
+	if _, err := os.Stat(materializedDir); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed but got %v", materializedDir, err)
+	}
+}
+
+func TestWithMaterializedIgnore(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("node_modules")
+	fs.MkFile("~/node_modules/dep.js")
+	fs.MkFile("main.js")
+	ignore, _ := NewIgnoreMatcher("node_modules/", "/out")
+
+	// Ignored paths aren't written, and what the callback does there isn't brought back
+	err := fs.WithMaterialized(ignore, func(dir string) error {
+		if _, err := os.Stat(filepath.Join(dir, "node_modules")); !os.IsNotExist(err) {
+			t.Errorf("Expected node_modules to be left out but got %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "out"), []byte("built"), 0644); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, "main.js"), []byte("changed"), 0644)
+	})
+	if err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	res, err := fs.Ls("~")
+	assertMatchesAndNoErrors(res, err, "main.js node_modules", t)
+	res, err = fs.ReadFile("main.js")
+	assertMatchesAndNoErrors(res, err, "changed", t)
+	if _, err := fs.Stat("~/node_modules/dep.js"); err != nil {
+		t.Errorf("Expected the ignored file to be kept but got %s", err)
+	}
+}
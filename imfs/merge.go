@@ -0,0 +1,126 @@
+package imfs
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+)
+
+// Decides which side wins when both filesystems have different entries at the same path
+type MergeStrategy int
+
+const (
+	// Keep our entry and ignore theirs
+	MergeOurs MergeStrategy = iota
+	// Replace our entry with theirs
+	MergeTheirs
+	// Keep whichever entry was modified most recently, preferring ours on ties
+	MergeNewer
+	// Keep our entry and add theirs next to it under a new name
+	MergeRenameConflicts
+)
+
+// Describes a path that existed in both filesystems with different contents or types
+type MergeConflict struct {
+	Path string
+	// One of "kept ours", "took theirs" or "renamed"
+	Resolution string
+	// For renamed conflicts, where their entry was added
+	RenamedTo string
+}
+
+// The result of a merge
+type MergeReport struct {
+	// Paths that only existed in the other filesystem and were copied over
+	Added     []string
+	Conflicts []MergeConflict
+}
+
+// Merges another filesystem into this one. Entries that only exist in the other filesystem are
+// copied over, directories that exist in both are merged recursively, and conflicting entries
+// are resolved using the given strategy. The other filesystem is not modified.
+//
+// Parameters:
+//
+//	other (*Filesystem) - the filesystem to merge into this one
+//	strategy (MergeStrategy) - how to resolve conflicts
+//
+// Returns:
+//
+//	*MergeReport - the paths that were added and the conflicts that were resolved
+//	error - an error if the merge was unsuccessful
+func (fs *Filesystem) Merge(other *Filesystem, strategy MergeStrategy) (*MergeReport, error) {
+	defer fs.enter(OperationWrite, "")()
+	if fs.replica {
+		return nil, ErrReadOnly
+	}
+	if strategy < MergeOurs || strategy > MergeRenameConflicts {
+		return nil, fmt.Errorf("Unknown merge strategy: %d", strategy)
+	}
+
+	report := &MergeReport{Added: []string{}, Conflicts: []MergeConflict{}}
+	fs.mergeDir(fs.root, other.root, strategy, report)
+	return report, nil
+}
+
+// Merges the children of "theirs" into "ours"
+func (fs *Filesystem) mergeDir(ours *util.File, theirs *util.File, strategy MergeStrategy, report *MergeReport) {
+	for _, name := range theirs.GetChildrenNames() {
+		theirChild := theirs.GetChildByName(name)
+		ourChild := ours.GetChildByName(name)
+
+		if ourChild == nil {
+			added := fs.copyInto(ours, name, theirChild)
+			report.Added = append(report.Added, added.GetFullPathName(fs.root))
+			continue
+		}
+
+		if ourChild.IsDirectory() && theirChild.IsDirectory() {
+			fs.mergeDir(ourChild, theirChild, strategy, report)
+			continue
+		}
+
+		if !ourChild.IsDirectory() && !theirChild.IsDirectory() && bytes.Equal(ourChild.GetContents(), theirChild.GetContents()) {
+			// Identical files aren't a conflict
+			continue
+		}
+
+		conflict := MergeConflict{Path: ourChild.GetFullPathName(fs.root), Resolution: "kept ours"}
+		takeTheirs := strategy == MergeTheirs ||
+			(strategy == MergeNewer && theirChild.GetModTime().After(ourChild.GetModTime()))
+
+		if takeTheirs {
+			conflict.Resolution = "took theirs"
+			fs.removeAbsolute(conflict.Path)
+			fs.record(JournalEntry{Op: OpRm, Path: conflict.Path})
+			fs.copyInto(ours, name, theirChild)
+		} else if strategy == MergeRenameConflicts {
+			newName := name
+			for ours.GetChildByName(newName) != nil || theirs.GetChildByName(newName) != nil {
+				newName = util.ModifyNameToHandleCollisions(newName)
+			}
+			conflict.Resolution = "renamed"
+			conflict.RenamedTo = fs.copyInto(ours, newName, theirChild).GetFullPathName(fs.root)
+		}
+		report.Conflicts = append(report.Conflicts, conflict)
+	}
+}
+
+// Copies "source" (and all of its children) into "dir" under the given name and returns the copy
+func (fs *Filesystem) copyInto(dir *util.File, name string, source *util.File) *util.File {
+	copied := source.Clone(dir)
+	copied.SetName(name)
+	dir.UpsertChild(name, copied)
+
+	util.WalkTree(copied, func(f *util.File) {
+		// Bump the generation but keep their modification time, so the copy still looks as old
+		// as the original
+		f.SetGeneration(fs.nextGeneration())
+		if f.IsDirectory() {
+			fs.record(JournalEntry{Op: OpMkDir, Path: f.GetFullPathName(fs.root)})
+		} else {
+			fs.record(JournalEntry{Op: OpPut, Path: f.GetFullPathName(fs.root), Data: f.GetContents()})
+		}
+	})
+	return copied
+}
@@ -0,0 +1,61 @@
+// merge_test.go
+package imfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	for _, tc := range []struct {
+		strategy   MergeStrategy
+		resolution string
+		expected   string
+	}{
+		{MergeOurs, "kept ours", "ours"},
+		{MergeTheirs, "took theirs", "theirs"},
+		{MergeNewer, "took theirs", "theirs"},
+		{MergeRenameConflicts, "renamed", "ours"},
+	} {
+		// Set up test subjects. Their file is written later, so it's newer
+		clock := time.Unix(0, 0)
+		now := func() time.Time {
+			clock = clock.Add(time.Second)
+			return clock
+		}
+		ours := NewFileSystemWithOptions(Options{Now: now})
+		theirs := NewFileSystemWithOptions(Options{Now: now})
+
+		ours.MkDir("shared")
+		ours.MkFile("same.txt")
+		ours.MkFile("conflict.txt")
+		ours.WriteFile("conflict.txt", "ours")
+
+		theirs.MkDir("shared")
+		theirs.MkDir("shared/new")
+		// Identical files aren't conflicts
+		theirs.MkFile("same.txt")
+		theirs.MkFile("conflict.txt")
+		theirs.WriteFile("conflict.txt", "theirs")
+
+		report, err := ours.Merge(theirs, tc.strategy)
+		if err != nil {
+			t.Fatalf("Expected no errors but got %s", err.Error())
+		}
+
+		if !stringSliceEqual(report.Added, []string{"/shared/new"}) {
+			t.Errorf("Invalid results: got: %v, expected: %v", report.Added, []string{"/shared/new"})
+		}
+		if len(report.Conflicts) != 1 || report.Conflicts[0].Path != "/conflict.txt" || report.Conflicts[0].Resolution != tc.resolution {
+			t.Errorf("Expected a single conflict on /conflict.txt resolved with %s but got %v", tc.resolution, report.Conflicts)
+		}
+
+		res, err := ours.ReadFile("conflict.txt")
+		assertMatchesAndNoErrors(res, err, tc.expected, t)
+
+		if tc.strategy == MergeRenameConflicts {
+			res, err = ours.ReadFile("conflict1.txt")
+			assertMatchesAndNoErrors(res, err, "theirs", t)
+		}
+	}
+}
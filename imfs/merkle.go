@@ -0,0 +1,431 @@
+package imfs
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The type of a content-addressed object, as in Git
+type ObjectType string
+
+const (
+	// The contents of a file, or the target of a symbolic link
+	ObjectBlob ObjectType = "blob"
+	// A directory listing: the mode, name and object ID of each child
+	ObjectTree ObjectType = "tree"
+)
+
+// Git's modes for tree entries
+const (
+	treeModeDir        = "40000"
+	treeModeFile       = "100644"
+	treeModeExecutable = "100755"
+	treeModeSymlink    = "120000"
+)
+
+// A content-addressed object. Its ID is the hex SHA-1 of its header and data, encoded exactly
+// like Git's objects, so IDs match `git hash-object` and `git write-tree`.
+type Object struct {
+	Type ObjectType
+	Data []byte
+}
+
+// Returns the ID of the object
+func (o Object) ID() string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", o.Type, len(o.Data))
+	h.Write(o.Data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Objects keyed by ID. Identical files and directories are stored once, however many times they
+// appear, and a store can hold the trees of several states at once (see DiffTrees).
+type ObjectStore map[string]Object
+
+// Adds the object to the store and returns its ID
+func (s ObjectStore) add(o Object) string {
+	id := o.ID()
+	s[id] = o
+	return id
+}
+
+// A single entry of a tree object
+type treeEntry struct {
+	mode string
+	name string
+	id   string
+}
+
+// Git sorts tree entries by name, comparing directories as if their name ended in "/"
+func (e treeEntry) sortKey() string {
+	if e.mode == treeModeDir {
+		return e.name + "/"
+	}
+	return e.name
+}
+
+func encodeTree(entries []treeEntry) Object {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].sortKey() < entries[j].sortKey() })
+	buf := bytes.Buffer{}
+	for _, e := range entries {
+		raw, _ := hex.DecodeString(e.id)
+		fmt.Fprintf(&buf, "%s %s\x00", e.mode, e.name)
+		buf.Write(raw)
+	}
+	return Object{Type: ObjectTree, Data: buf.Bytes()}
+}
+
+func decodeTree(o Object) ([]treeEntry, error) {
+	if o.Type != ObjectTree {
+		return nil, fmt.Errorf("Object %s is a %s, not a tree", o.ID(), o.Type)
+	}
+	entries := []treeEntry{}
+	data := o.Data
+	for len(data) > 0 {
+		nul := bytes.IndexByte(data, 0)
+		if nul < 0 || len(data) < nul+1+sha1.Size {
+			return nil, fmt.Errorf("Tree %s is malformed", o.ID())
+		}
+		header := strings.SplitN(string(data[:nul]), " ", 2)
+		if len(header) != 2 {
+			return nil, fmt.Errorf("Tree %s is malformed", o.ID())
+		}
+		entries = append(entries, treeEntry{
+			mode: header[0],
+			name: header[1],
+			id:   hex.EncodeToString(data[nul+1 : nul+1+sha1.Size]),
+		})
+		data = data[nul+1+sha1.Size:]
+	}
+	return entries, nil
+}
+
+// Computes the Merkle tree of the directory at path: a blob for every file and symbolic link and
+// a tree for every directory, each identified by the hash of its contents like in Git. Two
+// directories have the same ID exactly when everything inside them is identical. Pipes, special
+// nodes and virtual files have no equivalent in Git and are left out.
+//
+// Parameters:
+//
+//	path (string) - the directory to hash, e.g. "/" for the whole filesystem
+//	store (ObjectStore) - if not nil, every object in the tree is added to it
+//
+// Returns:
+//
+//	string - the ID of the tree object of the directory
+//	error - an error if the path does not exist or isn't a directory
+func (fs *Filesystem) HashTree(path string, store ObjectStore) (string, error) {
+	dir, err := fs.follow(path)
+	if err != nil {
+		return "", err
+	}
+	if !dir.IsDirectory() {
+		return "", fmt.Errorf("%s is not a directory", path)
+	}
+	if store == nil {
+		store = ObjectStore{}
+	}
+	return hashDir(dir, store), nil
+}
+
+func hashDir(dir *util.File, store ObjectStore) string {
+	entries := []treeEntry{}
+	dir.RangeChildren(func(child *util.File) bool {
+		switch {
+		case child.IsVirtual():
+		case child.IsDirectory():
+			entries = append(entries, treeEntry{treeModeDir, child.GetName(), hashDir(child, store)})
+		case child.IsSymlink():
+			target, _ := child.AsSymlink()
+			entries = append(entries, treeEntry{treeModeSymlink, child.GetName(), store.add(Object{ObjectBlob, []byte(target.Target())})})
+		case child.GetKind() == util.KindRegular:
+			mode := treeModeFile
+			if child.GetMode()&0111 != 0 {
+				mode = treeModeExecutable
+			}
+			entries = append(entries, treeEntry{mode, child.GetName(), store.add(Object{ObjectBlob, child.GetContents()})})
+		}
+		return true
+	})
+	return store.add(encodeTree(entries))
+}
+
+// The version written into every tree export. Bump this whenever the export layout changes.
+const TreeExportVersion int = 1
+
+// The first record of an exported tree
+type treeHeader struct {
+	Version int    `json:"version"`
+	Root    string `json:"root"`
+}
+
+// A single record of an exported tree
+type treeRecord struct {
+	ID   string     `json:"id"`
+	Type ObjectType `json:"type"`
+	Data []byte     `json:"data"`
+}
+
+// Writes the Merkle tree of the directory at path (see HashTree) to w: a header naming the root
+// tree, followed by every object once, one JSON record at a time. It can be recreated elsewhere
+// with ImportTree.
+//
+// Parameters:
+//
+//	path (string) - the directory to export
+//	w (io.Writer) - where to write the objects
+//
+// Returns:
+//
+//	string - the ID of the root tree
+//	error - an error if the path isn't a directory or writing fails
+func (fs *Filesystem) ExportTree(path string, w io.Writer) (string, error) {
+	store := ObjectStore{}
+	root, err := fs.HashTree(path, store)
+	if err != nil {
+		return "", err
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(treeHeader{Version: TreeExportVersion, Root: root}); err != nil {
+		return "", err
+	}
+	ids := make([]string, 0, len(store))
+	for id := range store {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := enc.Encode(treeRecord{ID: id, Type: store[id].Type, Data: store[id].Data}); err != nil {
+			return "", err
+		}
+	}
+	return root, nil
+}
+
+// Recreates a tree written by ExportTree as a new directory at path. Every object is checked
+// against its ID, so corrupted or tampered exports are rejected before anything is created.
+//
+// Parameters:
+//
+//	r (io.Reader) - the exported tree
+//	path (string) - the directory to create; its parent must exist
+//
+// Returns:
+//
+//	string - the ID of the imported root tree
+//	error - an error if the export is malformed, corrupt or incomplete, or the path already exists
+func (fs *Filesystem) ImportTree(r io.Reader, path string) (string, error) {
+	if fs.replica {
+		return "", ErrReadOnly
+	}
+
+	dec := json.NewDecoder(r)
+	header := treeHeader{}
+	if err := dec.Decode(&header); err != nil {
+		return "", fmt.Errorf("Invalid tree export: %s", err)
+	}
+	if header.Version > TreeExportVersion {
+		return "", fmt.Errorf("Tree export version %d is newer than the supported version %d", header.Version, TreeExportVersion)
+	}
+	store := ObjectStore{}
+	for {
+		record := treeRecord{}
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("Invalid tree export: %s", err)
+		}
+		if id := store.add(Object{record.Type, record.Data}); id != record.ID {
+			return "", fmt.Errorf("Object %s is corrupt: its contents hash to %s", record.ID, id)
+		}
+	}
+	if err := checkTree(store, header.Root); err != nil {
+		return "", err
+	}
+	defer fs.enter(OperationMkDir, path)()
+
+	parent, err := fs.follow(Dirname(path))
+	if err != nil {
+		return "", err
+	}
+	name := Basename(path)
+	if !parent.IsDirectory() {
+		return "", fmt.Errorf("%s is not a directory", Dirname(path))
+	}
+	if name == "" || name == "/" || name == "." || name == ".." {
+		return "", fmt.Errorf("Invalid directory name %s", path)
+	}
+	if parent.GetChildByName(name) != nil {
+		return "", fmt.Errorf("File %s already exists", path)
+	}
+
+	dir := util.NewFile(name, true, parent)
+	parent.UpsertChild(name, dir)
+	fs.buildFromTree(dir, store, header.Root)
+	return header.Root, nil
+}
+
+// Checks that the tree and everything it references is in the store and well formed
+func checkTree(store ObjectStore, id string) error {
+	o, ok := store[id]
+	if !ok {
+		return fmt.Errorf("Object %s is missing", id)
+	}
+	entries, err := decodeTree(o)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		switch e.mode {
+		case treeModeDir:
+			if err := checkTree(store, e.id); err != nil {
+				return err
+			}
+		case treeModeFile, treeModeExecutable, treeModeSymlink:
+			if blob, ok := store[e.id]; !ok {
+				return fmt.Errorf("Object %s is missing", e.id)
+			} else if blob.Type != ObjectBlob {
+				return fmt.Errorf("Object %s is a %s, not a blob", e.id, blob.Type)
+			}
+		default:
+			return fmt.Errorf("Unsupported mode %s for %s in tree %s", e.mode, e.name, id)
+		}
+		if e.name == "" || e.name == "." || e.name == ".." || strings.Contains(e.name, "/") {
+			return fmt.Errorf("Invalid name %q in tree %s", e.name, id)
+		}
+	}
+	return nil
+}
+
+// Fills the new directory with the contents of a tree already validated by checkTree, recording
+// every entry in the journal
+func (fs *Filesystem) buildFromTree(dir *util.File, store ObjectStore, id string) {
+	fs.touch(dir)
+	fs.record(JournalEntry{Op: OpMkDir, Path: dir.GetFullPathName(fs.root)})
+
+	entries, _ := decodeTree(store[id])
+	for _, e := range entries {
+		data := store[e.id].Data
+		var child *util.File
+		switch e.mode {
+		case treeModeDir:
+			child = util.NewFile(e.name, true, dir)
+			dir.UpsertChild(e.name, child)
+			fs.buildFromTree(child, store, e.id)
+			continue
+		case treeModeSymlink:
+			child = util.NewSymlink(e.name, string(data), dir).File()
+			dir.UpsertChild(e.name, child)
+			fs.touch(child)
+			fs.record(JournalEntry{Op: OpSymlink, Path: child.GetFullPathName(fs.root), Target: string(data)})
+			continue
+		}
+
+		child = util.NewFile(e.name, false, dir)
+		dir.UpsertChild(e.name, child)
+		child.SetContents(data)
+		fs.touch(child)
+		path := child.GetFullPathName(fs.root)
+		fs.record(JournalEntry{Op: OpPut, Path: path, Data: data})
+		if e.mode == treeModeExecutable {
+			child.SetMode(0755)
+			fs.record(JournalEntry{Op: OpChmod, Path: path, Data: []byte(formatMode(0755))})
+		}
+	}
+}
+
+// How a path differs between two trees
+type TreeChangeType string
+
+const (
+	TreeAdded    TreeChangeType = "added"
+	TreeRemoved  TreeChangeType = "removed"
+	TreeModified TreeChangeType = "modified"
+)
+
+// A path that differs between two trees
+type TreeChange struct {
+	// The path relative to the trees' roots, e.g. "/docs/a.txt"
+	Path string
+	Type TreeChangeType
+}
+
+// Compares two trees in the store, e.g. the states before and after a transformation, to verify
+// it only touched the files it should have. Subtrees with the same ID are identical, so they are
+// skipped without looking inside. Added and removed directories are reported as a whole, and a
+// file replaced by a directory (or the other way round) is reported as modified.
+//
+// Parameters:
+//
+//	store (ObjectStore) - holds both trees (see HashTree)
+//	from (string) - the ID of the original tree
+//	to (string) - the ID of the new tree
+//
+// Returns:
+//
+//	[]TreeChange - the differences, sorted by path
+//	error - an error if either tree is missing from the store or malformed
+func DiffTrees(store ObjectStore, from string, to string) ([]TreeChange, error) {
+	changes := []TreeChange{}
+	if err := diffTrees(store, from, to, "", &changes); err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+func diffTrees(store ObjectStore, from string, to string, prefix string, changes *[]TreeChange) error {
+	if from == to {
+		return nil
+	}
+	fromEntries, err := lookupTree(store, from)
+	if err != nil {
+		return err
+	}
+	toEntries, err := lookupTree(store, to)
+	if err != nil {
+		return err
+	}
+
+	before := make(map[string]treeEntry, len(fromEntries))
+	for _, e := range fromEntries {
+		before[e.name] = e
+	}
+	for _, e := range toEntries {
+		path := prefix + "/" + e.name
+		old, ok := before[e.name]
+		delete(before, e.name)
+		switch {
+		case !ok:
+			*changes = append(*changes, TreeChange{path, TreeAdded})
+		case old.mode == treeModeDir && e.mode == treeModeDir:
+			if err := diffTrees(store, old.id, e.id, path, changes); err != nil {
+				return err
+			}
+		case old.id != e.id || old.mode != e.mode:
+			*changes = append(*changes, TreeChange{path, TreeModified})
+		}
+	}
+	for name := range before {
+		*changes = append(*changes, TreeChange{prefix + "/" + name, TreeRemoved})
+	}
+	return nil
+}
+
+func lookupTree(store ObjectStore, id string) ([]treeEntry, error) {
+	o, ok := store[id]
+	if !ok {
+		return nil, fmt.Errorf("Object %s is missing", id)
+	}
+	return decodeTree(o)
+}
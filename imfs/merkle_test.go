@@ -0,0 +1,171 @@
+// merkle_test.go
+package imfs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Builds /docs/a.txt, /docs/b.txt (identical to a.txt), /src/run.sh (executable) and /link
+func newMerkleFixture(t *testing.T) *Filesystem {
+	fs := NewFileSystem()
+	fs.MkDir("docs")
+	fs.MkDir("src")
+	fs.Cd("docs")
+	fs.MkFile("a.txt")
+	fs.WriteFile("a.txt", "hello\n")
+	fs.MkFile("b.txt")
+	fs.WriteFile("b.txt", "hello\n")
+	fs.Cd("~/src")
+	fs.MkFile("run.sh")
+	fs.WriteFile("run.sh", "echo hi\n")
+	fs.Cd("~")
+	if err := fs.Chmod("/src/run.sh", 0755, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Symlink("docs/a.txt", "/link"); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestHashTreeMatchesGit(t *testing.T) {
+	// The IDs Git gives an empty tree and a blob containing "hello\n"
+	fs := NewFileSystem()
+	id, err := fs.HashTree("/", nil)
+	assertMatchesAndNoErrors(id, err, "4b825dc642cb6eb9a060e54bf8d69288fbee4904", t)
+
+	if got := (Object{ObjectBlob, []byte("hello\n")}).ID(); got != "ce013625030ba8dba906f756967f9e9ca394464a" {
+		t.Errorf("Expected the blob ID Git uses, got %s", got)
+	}
+	// `git write-tree` on the same files, including the executable bit and the symbolic link
+	id, err = newMerkleFixture(t).HashTree("/", nil)
+	assertMatchesAndNoErrors(id, err, "0ad8be58126ed4b5d7750be882571a8965b6b316", t)
+}
+
+func TestHashTreeDedup(t *testing.T) {
+	fs := newMerkleFixture(t)
+	store := ObjectStore{}
+	if _, err := fs.HashTree("/", store); err != nil {
+		t.Fatal(err)
+	}
+	// Root, docs and src trees plus 3 blobs: both text files share one
+	if len(store) != 6 {
+		t.Errorf("Expected 6 objects, got %d", len(store))
+	}
+
+	fs.MkDir("copy")
+	fs.Cd("copy")
+	fs.MkFile("a.txt")
+	fs.WriteFile("a.txt", "hello\n")
+	fs.MkFile("b.txt")
+	fs.WriteFile("b.txt", "hello\n")
+	docs, _ := fs.HashTree("/docs", nil)
+	copied, _ := fs.HashTree("/copy", nil)
+	assertMatchesAndNoErrors(copied, nil, docs, t)
+
+	id, err := fs.HashTree("/docs/a.txt", nil)
+	assertErrorAndEmptyResult(id, err, "/docs/a.txt is not a directory", t)
+}
+
+func TestExportImportTree(t *testing.T) {
+	fs := newMerkleFixture(t)
+	buf := &bytes.Buffer{}
+	root, err := fs.ExportTree("/", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := NewFileSystem()
+	imported, err := other.ImportTree(bytes.NewReader(buf.Bytes()), "/restored")
+	assertMatchesAndNoErrors(imported, err, root, t)
+
+	rehashed, err := other.HashTree("/restored", nil)
+	assertMatchesAndNoErrors(rehashed, err, root, t)
+	other.Cd("~/restored/src")
+	contents, err := other.ReadFile("run.sh")
+	assertMatchesAndNoErrors(contents, err, "echo hi\n", t)
+	target, err := other.Readlink("~/restored/link")
+	assertMatchesAndNoErrors(target, err, "docs/a.txt", t)
+
+	// The journal replays the import on a replica
+	replica := NewFileSystem()
+	for _, entry := range other.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replicated, err := replica.HashTree("/restored", nil)
+	assertMatchesAndNoErrors(replicated, err, root, t)
+
+	imported, err = other.ImportTree(bytes.NewReader(buf.Bytes()), "/restored")
+	assertErrorAndEmptyResult(imported, err, "File /restored already exists", t)
+}
+
+func TestImportTreeRejectsCorruption(t *testing.T) {
+	fs := newMerkleFixture(t)
+	buf := &bytes.Buffer{}
+	fs.ExportTree("/", buf)
+
+	// "hello\n" base64-encoded, replaced by "jello\n"
+	corrupted := strings.Replace(buf.String(), "aGVsbG8K", "amVsbG8K", 1)
+	other := NewFileSystem()
+	_, err := other.ImportTree(strings.NewReader(corrupted), "/restored")
+	if err == nil || !strings.Contains(err.Error(), "is corrupt") {
+		t.Errorf("Expected a corruption error, got %v", err)
+	}
+
+	// Drop the last object, leaving the tree incomplete
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	truncated := strings.Join(lines[:len(lines)-1], "\n")
+	_, err = other.ImportTree(strings.NewReader(truncated), "/restored")
+	if err == nil || !strings.Contains(err.Error(), "is missing") {
+		t.Errorf("Expected a missing object error, got %v", err)
+	}
+	if listing, _ := other.Ls(); listing != "" {
+		t.Errorf("Expected nothing to be imported")
+	}
+}
+
+func TestDiffTrees(t *testing.T) {
+	fs := newMerkleFixture(t)
+	store := ObjectStore{}
+	before, _ := fs.HashTree("/", store)
+
+	fs.Cd("~/docs")
+	fs.WriteFile("a.txt", "more\n")
+	fs.Cd("~")
+	fs.Rm("/src", true)
+	fs.MkDir("new")
+	fs.Chmod("/docs/b.txt", 0755, false)
+	after, _ := fs.HashTree("/", store)
+
+	changes, err := DiffTrees(store, before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []TreeChange{
+		{"/docs/a.txt", TreeModified},
+		{"/docs/b.txt", TreeModified},
+		{"/new", TreeAdded},
+		{"/src", TreeRemoved},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, changes)
+	}
+	for i := range changes {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], changes[i])
+		}
+	}
+
+	unchanged, err := DiffTrees(store, after, after)
+	if err != nil || len(unchanged) != 0 {
+		t.Errorf("Expected no changes, got %v (%v)", unchanged, err)
+	}
+	_, err = DiffTrees(store, before, "missing")
+	if err == nil {
+		t.Errorf("Expected an error for a missing tree")
+	}
+}
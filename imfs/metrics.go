@@ -0,0 +1,180 @@
+package imfs
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The upper bounds (in seconds) of the operation latency histogram buckets
+var metricsLatencyBuckets = []float64{0.00001, 0.0001, 0.001, 0.01, 0.1, 1}
+
+// Collects operation counts, latencies and errors along with the size of the tree, and serves
+// them in the Prometheus text format so load tests can observe the filesystem like a real
+// service. Safe to scrape while the filesystem is in use.
+type Metrics struct {
+	fs *Filesystem
+	mu sync.Mutex
+	// When each running operation started
+	started map[*OperationEvent]time.Time
+	ops     map[Operation]*opMetrics
+	// The size of the tree after the last modification
+	files, dirs, bytes int
+}
+
+// Counters for a single kind of operation
+type opMetrics struct {
+	count, errors int
+	// Cumulative counts for each of metricsLatencyBuckets
+	buckets []int
+	seconds float64
+}
+
+// Starts collecting metrics for the filesystem. The tree size is measured after every
+// modification, which walks the whole tree.
+//
+// Returns:
+//
+//	*Metrics - the collected metrics, which can be served over HTTP, e.g. on "/metrics"
+func (fs *Filesystem) Metrics() *Metrics {
+	m := &Metrics{fs: fs, started: make(map[*OperationEvent]time.Time), ops: make(map[Operation]*opMetrics)}
+	m.measureTree()
+	fs.Use(m)
+	return m
+}
+
+// Implements Hook
+func (m *Metrics) Before(event *OperationEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.started[event] = time.Now()
+	return nil
+}
+
+// Implements Hook
+func (m *Metrics) After(event *OperationEvent) {
+	if event.Op != OperationRead {
+		m.measureTree()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elapsed := time.Since(m.started[event]).Seconds()
+	delete(m.started, event)
+
+	op := m.ops[event.Op]
+	if op == nil {
+		op = &opMetrics{buckets: make([]int, len(metricsLatencyBuckets))}
+		m.ops[event.Op] = op
+	}
+	op.count++
+	if event.Err != nil {
+		op.errors++
+	}
+	op.seconds += elapsed
+	for i, bound := range metricsLatencyBuckets {
+		if elapsed <= bound {
+			op.buckets[i]++
+		}
+	}
+}
+
+// Counts the files, directories and bytes in the tree
+func (m *Metrics) measureTree() {
+	files, dirs, bytes := 0, 0, 0
+	util.WalkTree(m.fs.root, func(f *util.File) {
+		if f == m.fs.root || f.IsVirtual() {
+			return
+		}
+		if f.IsDirectory() {
+			dirs++
+		} else {
+			files++
+			bytes += len(f.GetContents())
+		}
+	})
+
+	m.mu.Lock()
+	m.files, m.dirs, m.bytes = files, dirs, bytes
+	m.mu.Unlock()
+}
+
+// Serves the metrics in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// Writes the metrics to w in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := []string{}
+	for op := range m.ops {
+		names = append(names, string(op))
+	}
+	sort.Strings(names)
+
+	cw := &countingWriter{w: w}
+	fmt.Fprintln(cw, "# HELP imfs_operations_total Operations run, by operation.")
+	fmt.Fprintln(cw, "# TYPE imfs_operations_total counter")
+	for _, name := range names {
+		fmt.Fprintf(cw, "imfs_operations_total{op=%q} %d\n", name, m.ops[Operation(name)].count)
+	}
+	fmt.Fprintln(cw, "# HELP imfs_operation_errors_total Operations that returned an error, by operation.")
+	fmt.Fprintln(cw, "# TYPE imfs_operation_errors_total counter")
+	for _, name := range names {
+		fmt.Fprintf(cw, "imfs_operation_errors_total{op=%q} %d\n", name, m.ops[Operation(name)].errors)
+	}
+	fmt.Fprintln(cw, "# HELP imfs_operation_duration_seconds How long operations took, by operation.")
+	fmt.Fprintln(cw, "# TYPE imfs_operation_duration_seconds histogram")
+	for _, name := range names {
+		op := m.ops[Operation(name)]
+		for i, bound := range metricsLatencyBuckets {
+			fmt.Fprintf(cw, "imfs_operation_duration_seconds_bucket{op=%q,le=\"%g\"} %d\n", name, bound, op.buckets[i])
+		}
+		fmt.Fprintf(cw, "imfs_operation_duration_seconds_bucket{op=%q,le=\"+Inf\"} %d\n", name, op.count)
+		fmt.Fprintf(cw, "imfs_operation_duration_seconds_sum{op=%q} %g\n", name, op.seconds)
+		fmt.Fprintf(cw, "imfs_operation_duration_seconds_count{op=%q} %d\n", name, op.count)
+	}
+	gauges := []struct {
+		name, help string
+		value      uint64
+	}{
+		{"imfs_tree_files", "Files in the tree.", uint64(m.files)},
+		{"imfs_tree_directories", "Directories in the tree, excluding the root.", uint64(m.dirs)},
+		{"imfs_tree_bytes", "Bytes of file contents in the tree.", uint64(m.bytes)},
+		{"imfs_memory_heap_bytes", "Bytes of heap memory in use by the process.", mem.HeapAlloc},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", g.name, g.help, g.name, g.name, g.value)
+	}
+	return cw.n, cw.err
+}
+
+// Counts the bytes written through it and remembers the first error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
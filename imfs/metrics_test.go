@@ -0,0 +1,46 @@
+// metrics_test.go
+package imfs
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	fs := NewFileSystem()
+	metrics := fs.Metrics()
+
+	fs.MkDir("docs")
+	fs.Cd("docs")
+	fs.MkFile("a.txt")
+	fs.WriteFile("a.txt", "hello")
+	fs.ReadFile("a.txt")
+	fs.ReadFile("missing.txt")
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+
+	expected := []string{
+		`imfs_operations_total{op="mkdir"} 1`,
+		`imfs_operations_total{op="read"} 2`,
+		`imfs_operation_errors_total{op="read"} 1`,
+		`imfs_operation_errors_total{op="write"} 0`,
+		`imfs_operation_duration_seconds_bucket{op="read",le="+Inf"} 2`,
+		`imfs_operation_duration_seconds_count{op="write"} 1`,
+		"# TYPE imfs_operation_duration_seconds histogram",
+		"imfs_tree_files 1\n",
+		"imfs_tree_directories 1\n",
+		"imfs_tree_bytes 5\n",
+		"imfs_memory_heap_bytes ",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("Expected a text/plain content type, got %s", contentType)
+	}
+}
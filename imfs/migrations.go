@@ -0,0 +1,47 @@
+package imfs
+
+import (
+	"fmt"
+)
+
+// Upgrades a decoded snapshot from one version to the next, in place
+type snapshotMigration func(snap *snapshot) error
+
+// The migrations from each snapshot version to the one after it. When the File model changes in
+// a way snapshots must record (e.g. new metadata), bump SnapshotVersion and add a migration here
+// filling in what older snapshots lack, plus a fixture of the old version in testdata.
+var snapshotMigrations = map[int]snapshotMigration{
+	1: migrateSnapshotV1,
+}
+
+// Brings a snapshot of any older version up to SnapshotVersion, one version at a time. Snapshots
+// without a version predate it and are treated as version 1.
+func migrateSnapshot(snap *snapshot) error {
+	if snap.Version == 0 {
+		snap.Version = 1
+	}
+	for snap.Version < SnapshotVersion {
+		migrate := snapshotMigrations[snap.Version]
+		if migrate == nil {
+			return fmt.Errorf("Snapshot version %d can't be migrated to version %d", snap.Version, SnapshotVersion)
+		}
+		if err := migrate(snap); err != nil {
+			return fmt.Errorf("Migrating snapshot version %d: %s", snap.Version, err)
+		}
+		snap.Version++
+	}
+	return nil
+}
+
+// Version 2 requires content hashes and a checksum. Version 1 snapshots written before they were
+// added are hashed as loaded; those that already have them are left alone, so they're verified.
+func migrateSnapshotV1(snap *snapshot) error {
+	if snap.Checksum != "" {
+		return nil
+	}
+	for i, entry := range snap.Entries {
+		snap.Entries[i].Hash = contentHash(entry.IsDir, entry.Contents)
+	}
+	snap.Checksum = snapshotChecksum(snap.Entries)
+	return nil
+}
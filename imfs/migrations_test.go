@@ -0,0 +1,71 @@
+// migrations_test.go
+package imfs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Every snapshot version ever written must keep loading into the same tree. Add a fixture to
+// testdata whenever SnapshotVersion is bumped.
+func TestLoadHistoricalSnapshots(t *testing.T) {
+	fixtures, _ := filepath.Glob("testdata/snapshot_v*")
+	if len(fixtures) == 0 {
+		t.Fatalf("Expected snapshot fixtures in testdata")
+	}
+	var expected []byte
+	for _, fixture := range fixtures {
+		data, err := os.ReadFile(fixture)
+		if err != nil {
+			t.Fatalf("Expected no errors but got %s", err)
+		}
+		fs := NewFileSystem()
+		if err := fs.LoadSnapshot(bytes.NewReader(data)); err != nil {
+			t.Errorf("Expected %s to load but got %s", fixture, err)
+			continue
+		}
+		res, err := fs.ReadFile("file1")
+		assertMatchesAndNoErrors(res, err, "hello world", t)
+		if expected == nil {
+			expected = snapshotBytes(fs)
+		} else if loaded := snapshotBytes(fs); !bytes.Equal(loaded, expected) {
+			t.Errorf("Expected %s to load the same tree as %s:\n%s\n%s", fixture, fixtures[0], loaded, expected)
+		}
+	}
+
+	// Versions nothing migrates from are rejected
+	snap := &snapshot{Version: -1}
+	if err := migrateSnapshot(snap); err == nil || !strings.Contains(err.Error(), "can't be migrated") {
+		t.Errorf("Expected a migration error but got %v", err)
+	}
+}
+
+// Version 1 snapshots that already carry checksums are still verified
+func TestMigratedSnapshotVerified(t *testing.T) {
+	data, _ := os.ReadFile("testdata/snapshot_v1_checksum.json")
+	data = bytes.Replace(data, []byte(`"aGVsbG8gd29ybGQ="`), []byte(`"aGVsbG8gd29ybGE="`), 1)
+	if err := NewFileSystem().LoadSnapshot(bytes.NewReader(data)); err == nil {
+		t.Errorf("Expected the corrupted snapshot to be rejected")
+	}
+}
+
+// Journal streams with and without a version header can be followed
+func TestFollowHistoricalJournals(t *testing.T) {
+	for _, fixture := range []string{"testdata/journal_v0.jsonl", "testdata/journal_v1.jsonl", "testdata/journal_v2.jsonl", "testdata/journal_v3.jsonl"} {
+		data, _ := os.ReadFile(fixture)
+		fs := NewFileSystem()
+		if err := fs.Follow(bytes.NewReader(data)); err != nil {
+			t.Errorf("Expected %s to apply but got %s", fixture, err)
+		}
+		res, err := fs.ReadFile("file1")
+		assertMatchesAndNoErrors(res, err, "hello world", t)
+	}
+
+	err := NewFileSystem().Follow(strings.NewReader(`{"journalVersion":99}`))
+	if err == nil || err.Error() != "Journal stream version 99 is newer than the supported version 3" {
+		t.Errorf("Expected a version error but got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package imfs
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+)
+
+// A region of a file mapped into memory by FileHandle.Map, simulating a shared (MAP_SHARED) mmap.
+// Every mapping of a file works on one shared buffer, so a change made through one mapping's
+// Bytes is seen at once by every other mapping of the same bytes. Readers of the file (ReadFile,
+// handles, Bytes) only see the changes once they are published by Flush or Unmap, like dirty
+// pages written back by msync.
+//
+// The shared buffer is a copy of the file taken when its first mapping is made, and is dropped
+// once its last mapping is unmapped. Writes to the file through other means while it is mapped
+// don't show up in the buffer, and are overwritten by the mapped bytes on the next Flush.
+type Mapping struct {
+	fs     *Filesystem
+	file   *util.File
+	shared *sharedBuffer
+	offset int
+	data   []byte
+	closed bool
+}
+
+// The buffer shared by the mappings of one file
+type sharedBuffer struct {
+	data     []byte
+	mappings map[*Mapping]bool
+}
+
+// Maps length bytes of the file starting at offset. As with mmap, the region must lie within the
+// file: grow the file first to map past its end. Pipes and special files can't be mapped.
+//
+// Parameters:
+//
+//	offset (int) - where the region starts
+//	length (int) - how many bytes to map
+//
+// Returns:
+//
+//	*Mapping - the mapped region
+//	error - an error if the handle is closed or the region isn't within the file
+func (h *FileHandle) Map(offset, length int) (*Mapping, error) {
+	h.checkUsable(OperationRead)
+	if h.closed {
+		return nil, ErrClosed
+	}
+	if h.file.IsFifo() || h.file.GetKind().IsSpecial() || h.file.IsVirtual() {
+		return nil, fmt.Errorf("File %s is not a regular file; cannot map", h.file.GetName())
+	}
+	size := len(h.file.GetContents())
+	if offset < 0 || length <= 0 || offset+length > size {
+		return nil, fmt.Errorf("Invalid region %d+%d of file %s (size %d)", offset, length, h.file.GetName(), size)
+	}
+
+	storage := h.fs.storage()
+	if storage.mapped == nil {
+		storage.mapped = make(map[*util.File]*sharedBuffer)
+	}
+	shared := storage.mapped[h.file]
+	if shared == nil {
+		shared = &sharedBuffer{data: append([]byte{}, h.file.GetContents()...), mappings: make(map[*Mapping]bool)}
+		storage.mapped[h.file] = shared
+	}
+	if offset+length > len(shared.data) {
+		return nil, fmt.Errorf("File %s grew since it was mapped; unmap every mapping of it to map past %d bytes", h.file.GetName(), len(shared.data))
+	}
+	m := &Mapping{
+		fs:     h.fs,
+		file:   h.file,
+		shared: shared,
+		offset: offset,
+		data:   shared.data[offset : offset+length : offset+length],
+	}
+	shared.mappings[m] = true
+	return m, nil
+}
+
+// Returns the mapped bytes. Modify them in place to change the file: the slice is shared with
+// every other mapping of the same bytes. Returns nil once the mapping is unmapped.
+func (m *Mapping) Bytes() []byte {
+	if m.closed {
+		return nil
+	}
+	return m.data
+}
+
+// Returns where the mapped region starts in the file
+func (m *Mapping) Offset() int {
+	return m.offset
+}
+
+// Publishes the mapped region to the file, so reads and handles see the changes made through
+// any mapping of it
+func (m *Mapping) Flush() error {
+	if m.closed {
+		return ErrClosed
+	}
+	if m.fs.replica {
+		return ErrReadOnly
+	}
+	path := m.file.GetFullPathName(m.fs.root)
+	_, err := m.fs.runHooks(&OperationEvent{Op: OperationWrite, Path: path, Data: m.data}, func() (string, error) {
+		contents := append([]byte{}, m.file.GetContents()...)
+		if m.offset+len(m.data) > len(contents) {
+			return "", fmt.Errorf("File %s was truncated below the mapped region; cannot flush", m.file.GetName())
+		}
+		copy(contents[m.offset:], m.data)
+		if err := m.file.SetContents(contents); err != nil {
+			return "", err
+		}
+		m.fs.countAccess(m.file, OperationWrite, len(m.data))
+		m.fs.touch(m.file)
+		m.fs.record(JournalEntry{Op: OpPut, Path: path, Data: contents})
+		return "", nil
+	})
+	return err
+}
+
+// Flushes the mapping and releases it. Further calls return ErrClosed.
+func (m *Mapping) Unmap() error {
+	if m.closed {
+		return ErrClosed
+	}
+	err := m.Flush()
+	m.release()
+	return err
+}
+
+// Marks the mapping as closed, dropping the shared buffer with the last mapping of the file
+func (m *Mapping) release() {
+	m.closed = true
+	delete(m.shared.mappings, m)
+	storage := m.fs.storage()
+	if len(m.shared.mappings) == 0 && storage.mapped[m.file] == m.shared {
+		delete(storage.mapped, m.file)
+	}
+}
+
+// Discards every shared buffer, losing the changes that were never flushed. The mappings behave as
+// if they were unmapped.
+func (fs *Filesystem) discardMappings() {
+	storage := fs.storage()
+	for _, shared := range storage.mapped {
+		for m := range shared.mappings {
+			m.closed = true
+		}
+	}
+	storage.mapped = nil
+}
@@ -0,0 +1,92 @@
+// mmap_test.go
+package imfs
+
+import (
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkFile("file1")
+	fs.WriteFile("file1", "hello world")
+	h1, _ := fs.Open("file1")
+	h2, _ := fs.Open("file1")
+
+	// Regions must lie within the file
+	for _, region := range [][2]int{{-1, 2}, {0, 0}, {6, 6}} {
+		if _, err := h1.Map(region[0], region[1]); err == nil {
+			t.Errorf("Expected an error mapping %d+%d", region[0], region[1])
+		}
+	}
+
+	// Changes through one mapping are seen at once by other mappings of the same bytes
+	m1, err := h1.Map(0, 11)
+	if err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	m2, _ := h2.Map(6, 5)
+	copy(m1.Bytes()[6:], "WORLD")
+	if string(m2.Bytes()) != "WORLD" || m2.Offset() != 6 {
+		t.Errorf("Expected the second mapping to see WORLD, got %q", m2.Bytes())
+	}
+
+	// Readers only see them once flushed
+	res, err := fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "hello world", t)
+	if err := m2.Flush(); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	res, err = fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "hello WORLD", t)
+	if last := fs.Journal()[len(fs.Journal())-1]; last.Op != OpPut || string(last.Data) != "hello WORLD" {
+		t.Errorf("Expected the flush to be journaled, got %+v", last)
+	}
+
+	// Unmapping flushes, and unmapped mappings can't be used
+	m1.Bytes()[0] = 'H'
+	if err := m1.Unmap(); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	res, err = fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "Hello WORLD", t)
+	if m1.Bytes() != nil || m1.Flush() != ErrClosed || m1.Unmap() != ErrClosed {
+		t.Errorf("Expected the unmapped mapping to be closed")
+	}
+
+	// Once every mapping is gone, a new one starts from the current contents
+	m2.Unmap()
+	fs.WriteFile("file1", "!")
+	m3, err := h1.Map(11, 1)
+	if err != nil || string(m3.Bytes()) != "!" {
+		t.Errorf("Expected to map the appended byte, got %q (%v)", m3.Bytes(), err)
+	}
+	if _, err := h1.Map(0, 12); err != nil {
+		t.Errorf("Expected no errors but got %s", err)
+	}
+}
+
+func TestMapCrash(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkFile("file1")
+	fs.WriteFile("file1", "abc")
+	h, _ := fs.Open("file1")
+	m, _ := h.Map(0, 3)
+
+	// Unflushed changes are lost in a crash
+	copy(m.Bytes(), "xyz")
+	fs.SimulateCrash()
+	res, err := fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "abc", t)
+	if m.Flush() != ErrClosed {
+		t.Errorf("Expected the mapping to be discarded")
+	}
+
+	// Pipes can't be mapped
+	fs.MkFifo("pipe")
+	p, _ := fs.Open("pipe")
+	if _, err := p.Map(0, 1); err == nil {
+		t.Errorf("Expected an error mapping a pipe")
+	}
+}
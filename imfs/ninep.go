@@ -0,0 +1,912 @@
+package imfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The 9P2000 message types
+const (
+	msgTversion = 100 + iota
+	msgRversion
+	msgTauth
+	msgRauth
+	msgTattach
+	msgRattach
+	msgTerror
+	msgRerror
+	msgTflush
+	msgRflush
+	msgTwalk
+	msgRwalk
+	msgTopen
+	msgRopen
+	msgTcreate
+	msgRcreate
+	msgTread
+	msgRread
+	msgTwrite
+	msgRwrite
+	msgTclunk
+	msgRclunk
+	msgTremove
+	msgRremove
+	msgTstat
+	msgRstat
+	msgTwstat
+	msgRwstat
+)
+
+const (
+	ninepVersion = "9P2000"
+	// The largest message we accept, whatever the client asks for
+	ninepMaxMsize = 1 << 20
+	// The size of a Tread/Rwrite header, subtracted from msize for the iounit
+	ninepIOHeader = 24
+	ninepNoFid    = ^uint32(0)
+
+	// Open modes
+	ninepOWrite  = 1
+	ninepORdwr   = 2
+	ninepOTrunc  = 0x10
+	ninepORclose = 0x40
+
+	ninepDMDir = 0x80000000
+	ninepQTDir = 0x80
+)
+
+// Error strings clients such as the Linux kernel map to errno values
+var (
+	errNinepNotFound   = errors.New("No such file or directory")
+	errNinepExists     = errors.New("File exists")
+	errNinepNotDir     = errors.New("Not a directory")
+	errNinepIsDir      = errors.New("Is a directory")
+	errNinepNotEmpty   = errors.New("Directory not empty")
+	errNinepBadFid     = errors.New("Bad file descriptor")
+	errNinepInvalid    = errors.New("Invalid argument")
+	errNinepNotAllowed = errors.New("Operation not permitted")
+)
+
+// Serves the filesystem over the 9P2000 protocol to every client connecting to l, so it can be
+// mounted without FUSE, e.g. with
+//
+//	mount -t 9p -o trans=tcp,port=5640,version=9p2000 127.0.0.1 /mnt/imfs
+//
+// on Linux, or with 9pfuse/9p from plan9port. Clients see the tree below the filesystem's root
+// (serve a Chroot or ReadOnlyView to expose less). Symbolic links are followed when walking, since
+// 9P2000 has no links, and pipes and special files behave as they do through a FileHandle.
+// Changes run hooks and are journaled like any other operation. No authentication is done, and
+// ownership and permissions are only recorded, not enforced, so only listen on addresses you trust.
+//
+// Requests are handled one at a time while holding mu. Pass the same lock to everything else using
+// the filesystem while it is served, since the filesystem isn't safe for concurrent use; pass nil
+// if the server is its only user.
+//
+// Parameters:
+//
+//	l (net.Listener) - where to accept clients
+//	mu (sync.Locker) - held while a request uses the filesystem, or nil
+//
+// Returns:
+//
+//	error - the error that stopped accepting clients, or nil once l is closed
+func (fs *Filesystem) Serve9P(l net.Listener, mu sync.Locker) error {
+	server := newNinepServer(fs, mu)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			server.serve(conn)
+		}()
+	}
+}
+
+// Serves a single 9P2000 client, e.g. over a pipe, until it disconnects. See Serve9P.
+//
+// Parameters:
+//
+//	rw (io.ReadWriter) - the connection to the client
+//	mu (sync.Locker) - held while a request uses the filesystem, or nil
+//
+// Returns:
+//
+//	error - the error reading from or writing to the connection, or nil once the client
+//	        disconnects
+func (fs *Filesystem) Serve9PConn(rw io.ReadWriter, mu sync.Locker) error {
+	return newNinepServer(fs, mu).serve(rw)
+}
+
+// The state shared by the clients of a 9P server
+type ninepServer struct {
+	fs *Filesystem
+	mu sync.Locker
+	// The qid paths handed out, so every node keeps a unique one for as long as it's served
+	qidPaths map[*util.File]uint64
+}
+
+// A fid of one client: a node, and how it was opened
+type ninepFid struct {
+	file   *util.File
+	opened bool
+	mode   uint8
+	// For directories being read, the stat entries of the listing taken at offset 0, and where
+	// the last read ended
+	dirData []byte
+	dirEnd  uint64
+}
+
+// The state of one client
+type ninepConn struct {
+	*ninepServer
+	msize uint32
+	fids  map[uint32]*ninepFid
+}
+
+func newNinepServer(fs *Filesystem, mu sync.Locker) *ninepServer {
+	if mu == nil {
+		mu = &sync.Mutex{}
+	}
+	return &ninepServer{fs: fs, mu: mu, qidPaths: map[*util.File]uint64{}}
+}
+
+// Handles requests from the client until it disconnects
+func (s *ninepServer) serve(rw io.ReadWriter) error {
+	c := &ninepConn{ninepServer: s, msize: ninepMaxMsize, fids: map[uint32]*ninepFid{}}
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(rw, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		size := binary.LittleEndian.Uint32(header)
+		if size < 7 || size > c.msize {
+			return fmt.Errorf("Invalid 9P message size %d", size)
+		}
+		msg := make([]byte, size-4)
+		if _, err := io.ReadFull(rw, msg); err != nil {
+			return err
+		}
+
+		reply := c.handleLocked(msg[0], &ninepReader{data: msg[3:]})
+
+		tag := binary.LittleEndian.Uint16(msg[1:3])
+		if _, err := rw.Write(reply.encode(tag)); err != nil {
+			return err
+		}
+	}
+}
+
+// Handles one request while holding the server's lock. A request that panics is answered with an
+// error, rather than taking the whole server down with the lock held.
+func (c *ninepConn) handleLocked(msgType uint8, r *ninepReader) (reply *ninepMsg) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer func() {
+		if p := recover(); p != nil {
+			reply = &ninepMsg{msgType: msgRerror}
+			reply.str(fmt.Sprintf("Internal error: %v", p))
+		}
+	}()
+	return c.handle(msgType, r)
+}
+
+// Handles one request, returning the reply
+func (c *ninepConn) handle(msgType uint8, r *ninepReader) *ninepMsg {
+	reply, err := c.dispatch(msgType, r)
+	if err == nil && r.err != nil {
+		err = errNinepInvalid
+	}
+	if err != nil {
+		reply = &ninepMsg{msgType: msgRerror}
+		reply.str(ninepErrorString(err))
+	}
+	return reply
+}
+
+func (c *ninepConn) dispatch(msgType uint8, r *ninepReader) (*ninepMsg, error) {
+	switch msgType {
+	case msgTversion:
+		return c.version(r.u32(), r.str())
+	case msgTauth:
+		return nil, errors.New("Authentication not required")
+	case msgTattach:
+		fid, _ := r.u32(), r.u32()
+		return c.attach(fid)
+	case msgTflush:
+		// Requests are handled in order, so the flushed one has already been answered
+		return &ninepMsg{msgType: msgRflush}, nil
+	case msgTwalk:
+		fid, newfid, n := r.u32(), r.u32(), r.u16()
+		names := make([]string, 0, n)
+		for i := 0; i < int(n) && r.err == nil; i++ {
+			names = append(names, r.str())
+		}
+		return c.walk(fid, newfid, names)
+	case msgTopen:
+		fid, mode := r.u32(), r.u8()
+		// Opening with OTRUNC changes the file, so a truncated request must not be acted on
+		if r.err != nil {
+			return nil, errNinepInvalid
+		}
+		return c.open(fid, mode)
+	case msgTcreate:
+		fid, name, perm, mode := r.u32(), r.str(), r.u32(), r.u8()
+		if r.err != nil {
+			return nil, errNinepInvalid
+		}
+		return c.create(fid, name, perm, mode)
+	case msgTread:
+		return c.read(r.u32(), r.u64(), r.u32())
+	case msgTwrite:
+		fid, offset, count := r.u32(), r.u64(), r.u32()
+		data := r.bytes(int(count))
+		if r.err != nil {
+			return nil, errNinepInvalid
+		}
+		return c.write(fid, offset, data)
+	case msgTclunk:
+		return c.clunk(r.u32())
+	case msgTremove:
+		fid := r.u32()
+		if r.err != nil {
+			return nil, errNinepInvalid
+		}
+		return c.remove(fid)
+	case msgTstat:
+		return c.stat(r.u32())
+	case msgTwstat:
+		fid := r.u32()
+		r.u16()
+		return c.wstat(fid, r)
+	}
+	return nil, fmt.Errorf("Unsupported 9P message type %d", msgType)
+}
+
+func (c *ninepConn) version(msize uint32, version string) (*ninepMsg, error) {
+	c.fids = map[uint32]*ninepFid{}
+	if msize < c.msize {
+		c.msize = msize
+	}
+	if !strings.HasPrefix(version, ninepVersion) {
+		version = "unknown"
+	} else {
+		version = ninepVersion
+	}
+	reply := &ninepMsg{msgType: msgRversion}
+	reply.u32(c.msize)
+	reply.str(version)
+	return reply, nil
+}
+
+func (c *ninepConn) attach(fid uint32) (*ninepMsg, error) {
+	if _, ok := c.fids[fid]; ok {
+		return nil, errNinepBadFid
+	}
+	c.fids[fid] = &ninepFid{file: c.fs.root}
+	reply := &ninepMsg{msgType: msgRattach}
+	reply.qid(c.qid(c.fs.root))
+	return reply, nil
+}
+
+func (c *ninepConn) walk(fid uint32, newfid uint32, names []string) (*ninepMsg, error) {
+	f, err := c.fid(fid)
+	if err != nil {
+		return nil, err
+	}
+	if f.opened {
+		return nil, errNinepInvalid
+	}
+	if _, ok := c.fids[newfid]; ok && newfid != fid {
+		return nil, errNinepBadFid
+	}
+
+	reply := &ninepMsg{msgType: msgRwalk}
+	reply.u16(uint16(len(names)))
+	curr := f.file
+	for i, name := range names {
+		next, err := c.walkName(curr, name)
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			// Only the qids of the names walked so far are returned, and newfid isn't set
+			binary.LittleEndian.PutUint16(reply.data, uint16(i))
+			return reply, nil
+		}
+		reply.qid(c.qid(next))
+		curr = next
+	}
+	c.fids[newfid] = &ninepFid{file: curr}
+	return reply, nil
+}
+
+// Returns the node a name in dir leads to, following symbolic links
+func (c *ninepConn) walkName(dir *util.File, name string) (*util.File, error) {
+	if !dir.IsDirectory() {
+		return nil, errNinepNotDir
+	}
+	switch {
+	case name == "..":
+		if dir == c.fs.root {
+			return dir, nil
+		}
+		return dir.GetParent(), nil
+	case name == "" || name == "." || name == "~" || strings.Contains(name, "/"):
+		return nil, errNinepNotFound
+	}
+	hops := 0
+	next, err := c.fs.walkFollowing(dir, name, &hops)
+	if err != nil {
+		return nil, errNinepNotFound
+	}
+	return next, nil
+}
+
+func (c *ninepConn) open(fid uint32, mode uint8) (*ninepMsg, error) {
+	f, err := c.fid(fid)
+	if err != nil {
+		return nil, err
+	}
+	if f.opened {
+		return nil, errNinepInvalid
+	}
+	writing := mode&3 == ninepOWrite || mode&3 == ninepORdwr
+	if f.file.IsDirectory() && (writing || mode&ninepOTrunc != 0) {
+		return nil, errNinepIsDir
+	}
+	if mode&ninepOTrunc != 0 {
+		if err := c.truncate(f.file, 0); err != nil {
+			return nil, err
+		}
+	}
+	f.opened, f.mode = true, mode
+	return c.opened(msgRopen, f.file), nil
+}
+
+func (c *ninepConn) create(fid uint32, name string, perm uint32, mode uint8) (*ninepMsg, error) {
+	f, err := c.fid(fid)
+	if err != nil {
+		return nil, err
+	}
+	if f.opened {
+		return nil, errNinepInvalid
+	}
+	dir := f.file
+	if !dir.IsDirectory() {
+		return nil, errNinepNotDir
+	}
+	if name == "" || name == "." || name == ".." || name == "~" || strings.Contains(name, "/") {
+		return nil, errNinepInvalid
+	}
+
+	isDir := perm&ninepDMDir != 0
+	op, journalOp := OperationMkFile, OpMkFile
+	if isDir {
+		op, journalOp = OperationMkDir, OpMkDir
+	}
+	var file *util.File
+	_, err = c.fs.runHooks(&OperationEvent{Op: op, Path: joinFullPath(dir, name, c.fs.root)}, func() (string, error) {
+		if c.fs.replica {
+			return "", ErrReadOnly
+		}
+		if dir.GetChildByName(name) != nil {
+			return "", errNinepExists
+		}
+		if err := c.fs.reserveNode(name); err != nil {
+			return "", err
+		}
+		file = util.NewFile(name, isDir, dir)
+		dir.UpsertChild(name, file)
+		c.fs.touch(file)
+		path := file.GetFullPathName(c.fs.root)
+		c.fs.record(JournalEntry{Op: journalOp, Path: path})
+		if mode := os.FileMode(perm & 0777); mode != file.GetMode() {
+			file.SetMode(mode)
+			c.fs.record(JournalEntry{Op: OpChmod, Path: path, Data: []byte(formatMode(mode))})
+		}
+		return name, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.file, f.opened, f.mode = file, true, mode
+	return c.opened(msgRcreate, file), nil
+}
+
+// Returns the reply to an open or create
+func (c *ninepConn) opened(msgType uint8, file *util.File) *ninepMsg {
+	reply := &ninepMsg{msgType: msgType}
+	reply.qid(c.qid(file))
+	reply.u32(c.msize - ninepIOHeader)
+	return reply
+}
+
+func (c *ninepConn) read(fid uint32, offset uint64, count uint32) (*ninepMsg, error) {
+	f, err := c.openFid(fid)
+	if err != nil {
+		return nil, err
+	}
+	if f.mode&3 == ninepOWrite {
+		return nil, errNinepBadFid
+	}
+	if count > c.msize-ninepIOHeader {
+		count = c.msize - ninepIOHeader
+	}
+
+	var data []byte
+	if f.file.IsDirectory() {
+		data, err = c.readDir(f, offset, count)
+	} else {
+		data, err = c.readFile(f.file, offset, count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	reply := &ninepMsg{msgType: msgRread}
+	reply.u32(uint32(len(data)))
+	reply.data = append(reply.data, data...)
+	return reply, nil
+}
+
+// Returns the stat entries of a directory starting at offset, which must be 0 or where the last
+// read ended. Only whole entries are returned.
+func (c *ninepConn) readDir(f *ninepFid, offset uint64, count uint32) ([]byte, error) {
+	if offset == 0 {
+		listing := &ninepMsg{}
+		for _, child := range f.file.Children() {
+			c.appendStat(listing, child)
+		}
+		f.dirData, f.dirEnd = listing.data, 0
+	} else if offset != f.dirEnd {
+		return nil, errors.New("Bad offset in directory read")
+	}
+
+	rest := f.dirData[min(offset, uint64(len(f.dirData))):]
+	n := 0
+	for n+2 <= len(rest) {
+		size := 2 + int(binary.LittleEndian.Uint16(rest[n:]))
+		if n+size > int(count) {
+			break
+		}
+		n += size
+	}
+	f.dirEnd = offset + uint64(n)
+	return rest[:n], nil
+}
+
+// Reads count bytes at offset from a file, consuming them from pipes
+func (c *ninepConn) readFile(file *util.File, offset uint64, count uint32) ([]byte, error) {
+	var data []byte
+	_, err := c.fs.runHooks(&OperationEvent{Op: OperationRead, Path: fullPath(file, c.fs.root)}, func() (string, error) {
+		switch {
+		case file.GetKind().IsSpecial():
+			data = c.fs.readSpecial(file, int(count))
+		case file.IsFifo():
+			data = c.fs.drainFifo(file, int(count))
+		default:
+			contents := c.fs.applyReadFilters(file, file.ContentsView())
+			if offset < uint64(len(contents)) {
+				data = contents[offset:min(offset+uint64(count), uint64(len(contents)))]
+			}
+		}
+		c.fs.countAccess(file, OperationRead, len(data))
+		return string(data), nil
+	})
+	return data, err
+}
+
+func (c *ninepConn) write(fid uint32, offset uint64, data []byte) (*ninepMsg, error) {
+	f, err := c.openFid(fid)
+	if err != nil {
+		return nil, err
+	}
+	if mode := f.mode & 3; mode != ninepOWrite && mode != ninepORdwr {
+		return nil, errNinepBadFid
+	}
+	file := f.file
+	_, err = c.fs.runHooks(&OperationEvent{Op: OperationWrite, Path: fullPath(file, c.fs.root), Data: data}, func() (string, error) {
+		if c.fs.replica {
+			return "", ErrReadOnly
+		}
+		return "", c.writeAt(file, offset, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	reply := &ninepMsg{msgType: msgRwrite}
+	reply.u32(uint32(len(data)))
+	return reply, nil
+}
+
+// Writes data at offset, growing the file with zeros if the offset is past its end. Pipes,
+// special and virtual files take the data as if it was written through a FileHandle.
+func (c *ninepConn) writeAt(file *util.File, offset uint64, data []byte) error {
+	path := file.GetFullPathName(c.fs.root)
+	contents := file.GetContents()
+	switch {
+	case file.GetKind().IsSpecial():
+		return nil
+	case file.IsVirtual():
+		return file.SetContents(data)
+	case file.IsFifo() || offset == uint64(len(contents)):
+		fitted, spaceErr := c.fs.fitToCapacity(file, data)
+		if spaceErr != nil {
+			return spaceErr
+		}
+		if err := file.WriteFileData(fitted); err != nil {
+			return err
+		}
+		c.fs.record(JournalEntry{Op: OpWrite, Path: path, Data: fitted})
+	default:
+		// Checked before adding them up, since an offset near 2^64 would overflow
+		if offset > uint64(util.MaxFileSize) || uint64(len(data)) > uint64(util.MaxFileSize)-offset {
+			return fmt.Errorf("Exceeded max file size: offset=%d, count=%d, max=%d", offset, len(data), util.MaxFileSize)
+		}
+		end := max(uint64(len(contents)), offset+uint64(len(data)))
+		if growth := int(end) - len(contents); growth > c.fs.spaceLeft() {
+			return ErrNoSpace
+		}
+		updated := make([]byte, end)
+		copy(updated, contents)
+		copy(updated[offset:], data)
+		if err := setSparseContents(file, updated, int(offset), len(data)); err != nil {
+			return err
+		}
+		c.fs.record(JournalEntry{Op: OpPut, Path: path, Data: updated})
+	}
+	c.fs.countAccess(file, OperationWrite, len(data))
+	c.fs.touch(file)
+	return nil
+}
+
+// Cuts a regular file to size, or grows it with zeros
+func (c *ninepConn) truncate(file *util.File, size uint64) error {
+	if file.IsFifo() || file.GetKind().IsSpecial() || file.IsVirtual() {
+		return nil
+	}
+	_, err := c.fs.runHooks(&OperationEvent{Op: OperationWrite, Path: fullPath(file, c.fs.root)}, func() (string, error) {
+		if c.fs.replica {
+			return "", ErrReadOnly
+		}
+		if size > uint64(util.MaxFileSize) {
+			return "", fmt.Errorf("Exceeded max file size: size=%d, max=%d", size, util.MaxFileSize)
+		}
+		return "", c.fs.truncate(file, int(size))
+	})
+	return err
+}
+
+func (c *ninepConn) clunk(fid uint32) (*ninepMsg, error) {
+	f, err := c.fid(fid)
+	if err != nil {
+		return nil, err
+	}
+	delete(c.fids, fid)
+	if f.opened && f.mode&ninepORclose != 0 {
+		if err := c.removeFile(f.file); err != nil {
+			return nil, err
+		}
+	}
+	return &ninepMsg{msgType: msgRclunk}, nil
+}
+
+func (c *ninepConn) remove(fid uint32) (*ninepMsg, error) {
+	f, err := c.fid(fid)
+	if err != nil {
+		return nil, err
+	}
+	// The fid is clunked even if the removal fails
+	delete(c.fids, fid)
+	if err := c.removeFile(f.file); err != nil {
+		return nil, err
+	}
+	return &ninepMsg{msgType: msgRremove}, nil
+}
+
+// Removes a file or empty directory
+func (c *ninepConn) removeFile(file *util.File) error {
+	path := file.GetFullPathName(c.fs.root)
+	_, err := c.fs.runHooks(&OperationEvent{Op: OperationRm, Path: path}, func() (string, error) {
+		switch {
+		case c.fs.replica:
+			return "", ErrReadOnly
+		case file == c.fs.root:
+			return "", errNinepNotAllowed
+		case file.IsDirectory() && file.NumChildren() > 0:
+			return "", errNinepNotEmpty
+		}
+		c.fs.teardown(file)
+		c.fs.record(JournalEntry{Op: OpRm, Path: path})
+		return file.GetName(), nil
+	})
+	return err
+}
+
+func (c *ninepConn) stat(fid uint32) (*ninepMsg, error) {
+	f, err := c.fid(fid)
+	if err != nil {
+		return nil, err
+	}
+	entry := &ninepMsg{}
+	c.appendStat(entry, f.file)
+	reply := &ninepMsg{msgType: msgRstat}
+	reply.u16(uint16(len(entry.data)))
+	reply.data = append(reply.data, entry.data...)
+	return reply, nil
+}
+
+// Changes the name, mode, length, modification time or owner of a node. Fields set to their
+// "don't touch" values (all ones, or empty strings) are left alone.
+func (c *ninepConn) wstat(fid uint32, r *ninepReader) (*ninepMsg, error) {
+	f, err := c.fid(fid)
+	if err != nil {
+		return nil, err
+	}
+	r.u16()           // size
+	r.u16()           // type
+	r.u32()           // dev
+	r.bytes(13)       // qid
+	mode := r.u32()   // mode
+	r.u32()           // atime
+	mtime := r.u32()  // mtime
+	length := r.u64() // length
+	name := r.str()   // name
+	owner := r.str()  // uid
+	r.str()           // gid
+	r.str()           // muid
+	if r.err != nil {
+		return nil, errNinepInvalid
+	}
+
+	file := f.file
+	path := fullPath(file, c.fs.root)
+	if mode != ^uint32(0) {
+		if (mode&ninepDMDir != 0) != file.IsDirectory() {
+			return nil, errNinepInvalid
+		}
+		if err := c.fs.Chmod(path, os.FileMode(mode&0777), false); err != nil {
+			return nil, err
+		}
+	}
+	if owner != "" && owner != file.GetOwner() {
+		if err := c.fs.Chown(path, owner, false); err != nil {
+			return nil, err
+		}
+	}
+	if length != ^uint64(0) {
+		if file.IsDirectory() {
+			return nil, errNinepIsDir
+		}
+		if err := c.truncate(file, length); err != nil {
+			return nil, err
+		}
+	}
+	if name != "" && name != file.GetName() {
+		if err := c.rename(file, name); err != nil {
+			return nil, err
+		}
+	}
+	if mtime != ^uint32(0) {
+		file.SetModTime(time.Unix(int64(mtime), 0))
+	}
+	return &ninepMsg{msgType: msgRwstat}, nil
+}
+
+// Renames a node within its directory
+func (c *ninepConn) rename(file *util.File, name string) error {
+	if file == c.fs.root {
+		return errNinepNotAllowed
+	}
+	if name == "." || name == ".." || name == "~" || strings.Contains(name, "/") {
+		return errNinepInvalid
+	}
+	parent := file.GetParent()
+	oldPath := file.GetFullPathName(c.fs.root)
+	newPath := joinFullPath(parent, name, c.fs.root)
+	_, err := c.fs.runHooks(&OperationEvent{Op: OperationMv, Path: oldPath, Target: newPath}, func() (string, error) {
+		if c.fs.replica {
+			return "", ErrReadOnly
+		}
+		if parent.GetChildByName(name) != nil {
+			return "", errNinepExists
+		}
+		c.fs.rename(file, name)
+		return name, nil
+	})
+	return err
+}
+
+// Returns the fid, or an error if the client never set it
+func (c *ninepConn) fid(fid uint32) (*ninepFid, error) {
+	f, ok := c.fids[fid]
+	if !ok {
+		return nil, errNinepBadFid
+	}
+	if f.file != c.fs.root && !c.fs.attached(f.file) {
+		return nil, errNinepNotFound
+	}
+	return f, nil
+}
+
+// Returns the fid, or an error unless it was opened
+func (c *ninepConn) openFid(fid uint32) (*ninepFid, error) {
+	f, err := c.fid(fid)
+	if err == nil && !f.opened {
+		err = errNinepBadFid
+	}
+	return f, err
+}
+
+// Returns the qid of a node: its type, its generation as the version, and a unique path
+type ninepQid struct {
+	qtype   uint8
+	version uint32
+	path    uint64
+}
+
+func (s *ninepServer) qid(file *util.File) ninepQid {
+	path, ok := s.qidPaths[file]
+	if !ok {
+		path = uint64(len(s.qidPaths) + 1)
+		s.qidPaths[file] = path
+	}
+	qid := ninepQid{version: uint32(file.GetGeneration()), path: path}
+	if file.IsDirectory() {
+		qid.qtype = ninepQTDir
+	}
+	return qid
+}
+
+// Appends the stat entry of a node
+func (s *ninepServer) appendStat(m *ninepMsg, file *util.File) {
+	entry := s.fs.dirEntry(file)
+	name := entry.Name
+	if file == s.fs.root {
+		name = "/"
+	}
+	owner := entry.Owner
+	if owner == "" {
+		owner = "none"
+	}
+	mode := uint32(entry.Mode.Perm())
+	if file.IsDirectory() {
+		mode |= ninepDMDir
+	}
+	mtime := uint32(entry.ModTime.Unix())
+
+	stat := &ninepMsg{}
+	stat.u16(0) // type
+	stat.u32(0) // dev
+	stat.qid(s.qid(file))
+	stat.u32(mode)
+	stat.u32(uint32(entry.AccessTime.Unix()))
+	stat.u32(mtime)
+	stat.u64(uint64(entry.Size))
+	stat.str(name)
+	stat.str(owner) // uid
+	stat.str(owner) // gid
+	stat.str(owner) // muid
+	m.u16(uint16(len(stat.data)))
+	m.data = append(m.data, stat.data...)
+}
+
+// Returns the full path a new child of dir would have
+func joinFullPath(dir *util.File, name string, root *util.File) string {
+	return strings.TrimSuffix(fullPath(dir, root), "/") + "/" + name
+}
+
+// Returns the string sent in an Rerror for the error
+func ninepErrorString(err error) string {
+	switch {
+	case errors.Is(err, ErrReadOnly):
+		return "Read-only file system"
+	case errors.Is(err, ErrNoSpace):
+		return ErrNoSpace.Error()
+	}
+	return err.Error()
+}
+
+// A 9P message being encoded
+type ninepMsg struct {
+	msgType uint8
+	data    []byte
+}
+
+func (m *ninepMsg) u8(v uint8) {
+	m.data = append(m.data, v)
+}
+
+func (m *ninepMsg) u16(v uint16) {
+	m.data = binary.LittleEndian.AppendUint16(m.data, v)
+}
+
+func (m *ninepMsg) u32(v uint32) {
+	m.data = binary.LittleEndian.AppendUint32(m.data, v)
+}
+
+func (m *ninepMsg) u64(v uint64) {
+	m.data = binary.LittleEndian.AppendUint64(m.data, v)
+}
+
+func (m *ninepMsg) str(s string) {
+	m.u16(uint16(len(s)))
+	m.data = append(m.data, s...)
+}
+
+func (m *ninepMsg) qid(q ninepQid) {
+	m.u8(q.qtype)
+	m.u32(q.version)
+	m.u64(q.path)
+}
+
+// Returns the message with its size, type and tag
+func (m *ninepMsg) encode(tag uint16) []byte {
+	out := binary.LittleEndian.AppendUint32(nil, uint32(7+len(m.data)))
+	out = append(out, m.msgType)
+	out = binary.LittleEndian.AppendUint16(out, tag)
+	return append(out, m.data...)
+}
+
+// Decodes the fields of a 9P message. Reading past the end sets err and returns zero values.
+type ninepReader struct {
+	data []byte
+	err  error
+}
+
+func (r *ninepReader) bytes(n int) []byte {
+	if r.err != nil || n > len(r.data) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *ninepReader) u8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *ninepReader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *ninepReader) u32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *ninepReader) u64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *ninepReader) str() string {
+	return string(r.bytes(int(r.u16())))
+}
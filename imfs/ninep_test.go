@@ -0,0 +1,325 @@
+// ninep_test.go
+package imfs
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// A minimal 9P2000 client talking to Serve9PConn over a pipe
+type ninepTestClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func newNinepTestClient(t *testing.T, fs *Filesystem) *ninepTestClient {
+	client, server := net.Pipe()
+	go fs.Serve9PConn(server, nil)
+	t.Cleanup(func() { client.Close() })
+	return &ninepTestClient{t: t, conn: client}
+}
+
+// Sends a request and returns the reply's type and body
+func (c *ninepTestClient) rpc(msgType uint8, req *ninepMsg) (uint8, *ninepReader) {
+	req.msgType = msgType
+	if _, err := c.conn.Write(req.encode(1)); err != nil {
+		c.t.Fatal(err)
+	}
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		c.t.Fatal(err)
+	}
+	body := make([]byte, binary.LittleEndian.Uint32(header)-7)
+	if _, err := io.ReadFull(c.conn, body); err != nil {
+		c.t.Fatal(err)
+	}
+	return header[4], &ninepReader{data: body}
+}
+
+// Sends a request, failing the test unless it succeeds
+func (c *ninepTestClient) call(msgType uint8, req *ninepMsg) *ninepReader {
+	replyType, r := c.rpc(msgType, req)
+	if replyType == msgRerror {
+		c.t.Fatalf("Request %d failed: %s", msgType, r.str())
+	}
+	if replyType != msgType+1 {
+		c.t.Fatalf("Expected reply %d, got %d", msgType+1, replyType)
+	}
+	return r
+}
+
+// Sends a request, failing the test unless it fails with the error
+func (c *ninepTestClient) callErr(msgType uint8, req *ninepMsg, errTxt string) {
+	replyType, r := c.rpc(msgType, req)
+	if replyType != msgRerror {
+		c.t.Fatalf("Expected request %d to fail with %q", msgType, errTxt)
+	}
+	if msg := r.str(); msg != errTxt {
+		c.t.Fatalf("Expected error %q, got %q", errTxt, msg)
+	}
+}
+
+func (c *ninepTestClient) walk(fid uint32, newfid uint32, names ...string) *ninepReader {
+	req := &ninepMsg{}
+	req.u32(fid)
+	req.u32(newfid)
+	req.u16(uint16(len(names)))
+	for _, name := range names {
+		req.str(name)
+	}
+	return c.call(msgTwalk, req)
+}
+
+func ninepFidMsg(fid uint32) *ninepMsg {
+	req := &ninepMsg{}
+	req.u32(fid)
+	return req
+}
+
+// Reads the name and length from a stat entry
+func readNinepStat(r *ninepReader) (string, uint64, uint32) {
+	r.u16() // size
+	r.u16() // type
+	r.u32() // dev
+	r.bytes(13)
+	mode := r.u32()
+	r.u32() // atime
+	r.u32() // mtime
+	length := r.u64()
+	name := r.str()
+	r.str() // uid
+	r.str() // gid
+	r.str() // muid
+	return name, length, mode
+}
+
+func TestServe9P(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkDir("docs")
+	fs.Cd("docs")
+	fs.MkFile("a.txt")
+	fs.WriteFile("a.txt", "hello")
+	fs.Cd("~")
+	c := newNinepTestClient(t, fs)
+
+	req := &ninepMsg{}
+	req.u32(8192)
+	req.str("9P2000.L")
+	r := c.call(msgTversion, req)
+	if msize, version := r.u32(), r.str(); msize != 8192 || version != "9P2000" {
+		t.Fatalf("Unexpected version reply: %d %s", msize, version)
+	}
+
+	req = ninepFidMsg(0)
+	req.u32(ninepNoFid)
+	req.str("user")
+	req.str("")
+	c.call(msgTattach, req)
+
+	// Walking to a missing name stops early
+	r = c.walk(0, 1, "docs", "missing")
+	if n := r.u16(); n != 1 {
+		t.Fatalf("Expected 1 qid from a partial walk, got %d", n)
+	}
+	c.callErr(msgTstat, ninepFidMsg(1), "Bad file descriptor")
+
+	// Read an existing file
+	c.walk(0, 1, "docs", "a.txt")
+	req = ninepFidMsg(1)
+	req.u8(0)
+	c.call(msgTopen, req)
+	req = ninepFidMsg(1)
+	req.u64(1)
+	req.u32(100)
+	r = c.call(msgTread, req)
+	assertMatchesAndNoErrors(string(r.bytes(int(r.u32()))), nil, "ello", t)
+	c.call(msgTclunk, ninepFidMsg(1))
+
+	// Create and write a file
+	c.walk(0, 2, "docs")
+	req = ninepFidMsg(2)
+	req.str("b.txt")
+	req.u32(0600)
+	req.u8(ninepORdwr)
+	c.call(msgTcreate, req)
+	req = ninepFidMsg(2)
+	req.u64(0)
+	req.u32(5)
+	req.data = append(req.data, "world"...)
+	if n := c.call(msgTwrite, req).u32(); n != 5 {
+		t.Fatalf("Expected 5 bytes written, got %d", n)
+	}
+	req = ninepFidMsg(2)
+	req.u64(3)
+	req.u32(3)
+	req.data = append(req.data, "LD!"...)
+	c.call(msgTwrite, req)
+	c.call(msgTclunk, ninepFidMsg(2))
+	fs.Cd("docs")
+	res, err := fs.ReadFile("b.txt")
+	assertMatchesAndNoErrors(res, err, "worLD!", t)
+	fs.Cd("~")
+	entries, err := fs.LsEntries("docs")
+	if err != nil || entries[1].Mode.Perm() != 0600 {
+		t.Fatalf("Expected mode 0600, got %v (%v)", entries, err)
+	}
+
+	// Creating a name that exists fails
+	c.walk(0, 2, "docs")
+	req = ninepFidMsg(2)
+	req.str("a.txt")
+	req.u32(0644)
+	req.u8(0)
+	c.callErr(msgTcreate, req, "File exists")
+	c.call(msgTclunk, ninepFidMsg(2))
+
+	// List the directory
+	c.walk(0, 3, "docs")
+	req = ninepFidMsg(3)
+	req.u8(0)
+	c.call(msgTopen, req)
+	req = ninepFidMsg(3)
+	req.u64(0)
+	req.u32(4096)
+	r = c.call(msgTread, req)
+	listing := &ninepReader{data: r.bytes(int(r.u32()))}
+	names := []string{}
+	for len(listing.data) > 0 {
+		name, _, _ := readNinepStat(listing)
+		names = append(names, name)
+	}
+	if len(names) != 2 || names[0] != "a.txt" || names[1] != "b.txt" {
+		t.Fatalf("Unexpected listing: %v", names)
+	}
+	c.call(msgTclunk, ninepFidMsg(3))
+
+	// Rename with wstat, and check the result with stat
+	c.walk(0, 4, "docs", "b.txt")
+	wstat := &ninepMsg{}
+	wstat.u16(0)
+	wstat.u16(^uint16(0))
+	wstat.u32(^uint32(0))
+	wstat.qid(ninepQid{qtype: ^uint8(0), version: ^uint32(0), path: ^uint64(0)})
+	wstat.u32(^uint32(0))
+	wstat.u32(^uint32(0))
+	wstat.u32(^uint32(0))
+	wstat.u64(^uint64(0))
+	wstat.str("c.txt")
+	wstat.str("")
+	wstat.str("")
+	wstat.str("")
+	req = ninepFidMsg(4)
+	req.u16(uint16(len(wstat.data)))
+	req.data = append(req.data, wstat.data...)
+	c.call(msgTwstat, req)
+	r = c.call(msgTstat, ninepFidMsg(4))
+	r.u16()
+	name, length, mode := readNinepStat(r)
+	if name != "c.txt" || length != 6 || mode != 0600 {
+		t.Fatalf("Unexpected stat after rename: %s %d %o", name, length, mode)
+	}
+	fs.Cd("docs")
+	res, err = fs.ReadFile("c.txt")
+	assertMatchesAndNoErrors(res, err, "worLD!", t)
+	fs.Cd("~")
+
+	// Remove the file and the now-empty directory
+	c.call(msgTremove, ninepFidMsg(4))
+	c.walk(0, 5, "docs")
+	c.callErr(msgTremove, ninepFidMsg(5), "Directory not empty")
+	c.walk(0, 6, "docs", "a.txt")
+	c.call(msgTremove, ninepFidMsg(6))
+	c.walk(0, 5, "docs")
+	c.call(msgTremove, ninepFidMsg(5))
+	res, err = fs.Ls()
+	assertMatchesAndNoErrors(res, err, "", t)
+
+	// Changes are journaled, so they replicate
+	replica := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertMatchesAndNoErrors(string(snapshotBytes(replica)), nil, string(snapshotBytes(fs)), t)
+}
+
+func TestServe9PReadOnly(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkFile("a.txt")
+	c := newNinepTestClient(t, fs.ReadOnlyView())
+
+	req := &ninepMsg{}
+	req.u32(8192)
+	req.str("9P2000")
+	c.call(msgTversion, req)
+	req = ninepFidMsg(0)
+	req.u32(ninepNoFid)
+	req.str("user")
+	req.str("")
+	c.call(msgTattach, req)
+
+	req = ninepFidMsg(0)
+	req.str("b.txt")
+	req.u32(0644)
+	req.u8(ninepOWrite)
+	c.callErr(msgTcreate, req, "Read-only file system")
+	c.walk(0, 1, "a.txt")
+	c.callErr(msgTremove, ninepFidMsg(1), "Read-only file system")
+}
+
+// Attaches and opens the file at name for reading and writing as fid 1
+func (c *ninepTestClient) openFile(name string) {
+	req := &ninepMsg{}
+	req.u32(8192)
+	req.str("9P2000")
+	c.call(msgTversion, req)
+	req = ninepFidMsg(0)
+	req.u32(ninepNoFid)
+	req.str("user")
+	req.str("")
+	c.call(msgTattach, req)
+	c.walk(0, 1, name)
+	req = ninepFidMsg(1)
+	req.u8(ninepORdwr)
+	c.call(msgTopen, req)
+}
+
+func TestServe9PInvalidWrites(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkFile("a.txt")
+	fs.WriteFile("a.txt", "hello")
+	c := newNinepTestClient(t, fs)
+	c.openFile("a.txt")
+
+	// An offset so large it would overflow fails instead of crashing the server
+	req := ninepFidMsg(1)
+	req.u64(^uint64(0))
+	req.u32(1)
+	req.data = append(req.data, "x"...)
+	if replyType, _ := c.rpc(msgTwrite, req); replyType != msgRerror {
+		t.Errorf("Expected an error writing at offset 2^64-1")
+	}
+
+	// A write with less data than it announces changes nothing
+	req = ninepFidMsg(1)
+	req.u64(10)
+	req.u32(100)
+	req.data = append(req.data, "short"...)
+	if replyType, _ := c.rpc(msgTwrite, req); replyType != msgRerror {
+		t.Errorf("Expected an error for a truncated write")
+	}
+	res, err := fs.ReadFile("a.txt")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+
+	// A request that panics is answered with an error, and the server keeps going
+	fs.Use(HookFuncs{BeforeFunc: func(event *OperationEvent) error { panic("boom") }})
+	req = ninepFidMsg(1)
+	req.u64(0)
+	req.u32(1)
+	req.data = append(req.data, "x"...)
+	c.callErr(msgTwrite, req, "Internal error: boom")
+	c.call(msgTstat, ninepFidMsg(1))
+}
@@ -0,0 +1,103 @@
+package imfs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"math/rand"
+)
+
+// Returned when resolving a handle whose node was removed or whose handle was invalidated, like
+// ESTALE from an NFS server
+var ErrStaleHandle = errors.New("Stale file handle")
+
+// An opaque, persistent reference to a node, like an NFS file handle. It keeps referring to the
+// same node when it is renamed or moved, and becomes stale once the node is removed.
+type NodeHandle string
+
+// Returns the persistent handle of a node, the same one every time for the same node. Symbolic
+// links at the end of the path aren't followed. Handles are kept by the filesystem, and shared
+// with its views, until they turn out to be stale or are invalidated. Restoring a checkpoint or
+// loading a snapshot replaces the nodes, so handles from before then are stale.
+//
+// Parameters:
+//
+//	path (string) - the path of the node, relative to the current directory or absolute
+//
+// Returns:
+//
+//	NodeHandle - the node's handle
+//	error - an error if the path does not exist
+func (fs *Filesystem) HandleFor(path string) (NodeHandle, error) {
+	file, err := fs.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	storage := fs.storage()
+	if handle, ok := storage.handlesByNode[file]; ok {
+		return handle, nil
+	}
+	if storage.nodeHandles == nil {
+		storage.nodeHandles = make(map[NodeHandle]*util.File)
+		storage.handlesByNode = make(map[*util.File]NodeHandle)
+		storage.handleEpoch = rand.Uint32()
+	}
+	storage.handleSeq++
+	handle := NodeHandle(fmt.Sprintf("%08x%08x", storage.handleEpoch, storage.handleSeq))
+	storage.nodeHandles[handle] = file
+	storage.handlesByNode[file] = handle
+	return handle, nil
+}
+
+// Returns the current path of the node a handle refers to, wherever it was moved
+//
+// Parameters:
+//
+//	handle (NodeHandle) - a handle returned by HandleFor
+//
+// Returns:
+//
+//	string - the node's absolute path, e.g. "/docs/readme.md"
+//	error - ErrStaleHandle if the node was removed, the handle was invalidated or it was never
+//	        handed out by this filesystem. From a chroot view, nodes outside the view are stale too
+func (fs *Filesystem) Resolve(handle NodeHandle) (string, error) {
+	storage := fs.storage()
+	file, ok := storage.nodeHandles[handle]
+	if !ok {
+		return "", ErrStaleHandle
+	}
+	if !storage.attached(file) {
+		storage.forgetHandle(handle)
+		return "", ErrStaleHandle
+	}
+	if !util.IsAncestor(fs.root, file) {
+		return "", ErrStaleHandle
+	}
+	return file.GetFullPathName(fs.root), nil
+}
+
+// Makes a handle stale even though its node still exists, e.g. to test a client's recovery from
+// stale handles. HandleFor hands out a new handle for the node afterwards.
+//
+// Parameters:
+//
+//	handle (NodeHandle) - the handle to invalidate
+func (fs *Filesystem) InvalidateHandle(handle NodeHandle) {
+	fs.storage().forgetHandle(handle)
+}
+
+// Makes every handle handed out so far stale, like an NFS server that lost its handles in a
+// restart
+func (fs *Filesystem) InvalidateHandles() {
+	storage := fs.storage()
+	storage.nodeHandles = nil
+	storage.handlesByNode = nil
+}
+
+// Forgets a handle and its node
+func (fs *Filesystem) forgetHandle(handle NodeHandle) {
+	if file, ok := fs.nodeHandles[handle]; ok {
+		delete(fs.nodeHandles, handle)
+		delete(fs.handlesByNode, file)
+	}
+}
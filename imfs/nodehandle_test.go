@@ -0,0 +1,66 @@
+// nodehandle_test.go
+package imfs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNodeHandles(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("a")
+	fs.MkDir("b")
+	fs.Cd("a")
+	fs.MkFile("file.txt")
+
+	// Handles are stable, and follow the node when it moves
+	handle, err := fs.HandleFor("file.txt")
+	if err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	if again, _ := fs.HandleFor("~/a/file.txt"); again != handle {
+		t.Errorf("Expected the same handle for the same node but got %s and %s", handle, again)
+	}
+	fs.MvFile("file.txt", "~/b")
+	res, err := fs.Resolve(handle)
+	assertMatchesAndNoErrors(res, err, "/b/file.txt", t)
+
+	// Removing the node, or replacing it with another at the same path, makes the handle stale
+	fs.Cd("~/b")
+	fs.Rm("file.txt", false)
+	fs.MkFile("file.txt")
+	if _, err := fs.Resolve(handle); !errors.Is(err, ErrStaleHandle) {
+		t.Errorf("Expected a stale handle but got %v", err)
+	}
+	if recreated, _ := fs.HandleFor("file.txt"); recreated == handle {
+		t.Errorf("Expected a new handle for a new node")
+	}
+
+	// Handles can be invalidated one at a time or all at once
+	dir, _ := fs.HandleFor("~/a")
+	fs.InvalidateHandle(dir)
+	if _, err := fs.Resolve(dir); err != ErrStaleHandle {
+		t.Errorf("Expected an invalidated handle to be stale but got %v", err)
+	}
+	dir, _ = fs.HandleFor("~/a")
+	res, err = fs.Resolve(dir)
+	assertMatchesAndNoErrors(res, err, "/a", t)
+	fs.InvalidateHandles()
+	if _, err := fs.Resolve(dir); err != ErrStaleHandle {
+		t.Errorf("Expected every handle to be stale but got %v", err)
+	}
+	if _, err := fs.Resolve("not a handle"); err != ErrStaleHandle {
+		t.Errorf("Expected an unknown handle to be stale but got %v", err)
+	}
+
+	// Views share the handles, but can't reach nodes outside of their root
+	handle, _ = fs.HandleFor("~/b/file.txt")
+	view, _ := fs.Chroot("~/b")
+	res, err = view.Resolve(handle)
+	assertMatchesAndNoErrors(res, err, "/file.txt", t)
+	outside, _ := fs.HandleFor("~/a")
+	if _, err := view.Resolve(outside); err != ErrStaleHandle {
+		t.Errorf("Expected a node outside the view to be stale but got %v", err)
+	}
+}
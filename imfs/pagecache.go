@@ -0,0 +1,191 @@
+package imfs
+
+import (
+	"container/list"
+	"github.com/bwent/in-memory-fs/internal/util"
+)
+
+// The page size used by the simulated page cache unless `Options.PageSize` is set
+const DefaultPageSize int = 4096
+
+// The most pages read ahead of a sequential read unless `Options.ReadAheadPages` is set
+const DefaultReadAheadPages int = 8
+
+// Counters collected by the simulated page cache (see `Options.PageCachePages`). Every page a
+// handle read touches is either a hit, if the page was cached, or a miss, which loads it.
+type PageCacheStats struct {
+	Hits   int
+	Misses int
+	// Pages loaded by read-ahead, and how many of those were then read (the rest were wasted)
+	ReadAheadPages int
+	ReadAheadHits  int
+	// Pages dropped to make room for others
+	Evictions int
+	// Handle reads starting where the handle's previous read ended, and all others
+	SequentialReads int
+	RandomReads     int
+}
+
+// Returns the fraction of page accesses that were hits, or 0 if there were none
+func (s PageCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// A simulated page cache: an LRU list of pages, which only tracks which pages would be cached
+// (the contents always come from the tree)
+type pageCache struct {
+	pages    map[pageKey]*list.Element
+	lru      *list.List
+	capacity int
+	stats    PageCacheStats
+}
+
+type pageKey struct {
+	file  *util.File
+	index int
+}
+
+// A cached page, kept in the LRU list
+type cachedPage struct {
+	key pageKey
+	// Set while a page loaded by read-ahead hasn't been read yet
+	readAhead bool
+}
+
+// Returns the page cache shared by the filesystem and its views, creating it on first use, or
+// nil if it is disabled. Each view of a frozen filesystem has its own instead, since views are
+// read from different goroutines.
+func (fs *Filesystem) pageCache() *pageCache {
+	owner := fs.storage()
+	if owner.opts.PageCachePages <= 0 {
+		return nil
+	}
+	if fs.frozen {
+		owner = fs
+	}
+	if owner.cache == nil {
+		owner.cache = &pageCache{
+			pages:    make(map[pageKey]*list.Element),
+			lru:      list.New(),
+			capacity: owner.opts.PageCachePages,
+		}
+	}
+	return owner.cache
+}
+
+// Returns the page size of the simulated page cache
+func (fs *Filesystem) pageSize() int {
+	if size := fs.storage().opts.PageSize; size > 0 {
+		return size
+	}
+	return DefaultPageSize
+}
+
+// Returns the statistics of the simulated page cache, which are all zero unless
+// `Options.PageCachePages` is set
+func (fs *Filesystem) PageCacheStats() PageCacheStats {
+	if cache := fs.pageCache(); cache != nil {
+		return cache.stats
+	}
+	return PageCacheStats{}
+}
+
+// Empties the simulated page cache and resets its statistics, so the next reads start cold
+func (fs *Filesystem) DropPageCache() {
+	if fs.frozen {
+		fs.cache = nil
+		return
+	}
+	fs.storage().cache = nil
+}
+
+// Records a handle read of n bytes at offset in the simulated page cache, reading ahead after
+// sequential reads
+func (h *FileHandle) cacheRead(offset, n int) {
+	cache := h.fs.pageCache()
+	if cache == nil || n <= 0 {
+		return
+	}
+	sequential := offset == h.lastReadEnd
+	h.lastReadEnd = offset + n
+	if sequential {
+		cache.stats.SequentialReads++
+	} else {
+		cache.stats.RandomReads++
+	}
+
+	pageSize := h.fs.pageSize()
+	first, last := offset/pageSize, (offset+n-1)/pageSize
+	for index := first; index <= last; index++ {
+		cache.access(pageKey{h.file, index})
+	}
+	if !sequential {
+		return
+	}
+	readAhead := h.fs.storage().opts.ReadAheadPages
+	if readAhead <= 0 {
+		readAhead = DefaultReadAheadPages
+	}
+	pages := (len(h.file.GetContents()) + pageSize - 1) / pageSize
+	for index := last + 1; index <= last+readAhead && index < pages; index++ {
+		cache.prefetch(pageKey{h.file, index})
+	}
+}
+
+// Records a handle write of n bytes at offset: the written pages end up cached, as they would
+// once written to the page cache
+func (h *FileHandle) cacheWrite(offset, n int) {
+	cache := h.fs.pageCache()
+	if cache == nil || n <= 0 || h.file.IsFifo() || h.file.GetKind().IsSpecial() {
+		return
+	}
+	pageSize := h.fs.pageSize()
+	for index := offset / pageSize; index <= (offset+n-1)/pageSize; index++ {
+		key := pageKey{h.file, index}
+		if elem, ok := cache.pages[key]; ok {
+			cache.lru.MoveToFront(elem)
+		} else {
+			cache.add(key, false)
+		}
+	}
+}
+
+// Reads a page, counting a hit or a miss
+func (c *pageCache) access(key pageKey) {
+	elem, ok := c.pages[key]
+	if !ok {
+		c.stats.Misses++
+		c.add(key, false)
+		return
+	}
+	c.stats.Hits++
+	page := elem.Value.(*cachedPage)
+	if page.readAhead {
+		page.readAhead = false
+		c.stats.ReadAheadHits++
+	}
+	c.lru.MoveToFront(elem)
+}
+
+// Loads a page ahead of a read, unless it is already cached
+func (c *pageCache) prefetch(key pageKey) {
+	if _, ok := c.pages[key]; ok {
+		return
+	}
+	c.stats.ReadAheadPages++
+	c.add(key, true)
+}
+
+// Caches a page, evicting the least recently used one if the cache is full
+func (c *pageCache) add(key pageKey, readAhead bool) {
+	if c.lru.Len() >= c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.pages, oldest.Value.(*cachedPage).key)
+		c.stats.Evictions++
+	}
+	c.pages[key] = c.lru.PushFront(&cachedPage{key: key, readAhead: readAhead})
+}
@@ -0,0 +1,90 @@
+// pagecache_test.go
+package imfs
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPageCache(t *testing.T) {
+	// Set up test subject: a file of 16 pages of 10 bytes each
+	fs := NewFileSystemWithOptions(Options{PageCachePages: 8, PageSize: 10, ReadAheadPages: 2})
+	fs.MkFile("file1")
+	fs.WriteFile("file1", strings.Repeat("x", 160))
+
+	// Sequential reads miss the first page, then hit the pages read ahead
+	h, _ := fs.Open("file1")
+	p := make([]byte, 10)
+	for i := 0; i < 4; i++ {
+		h.Read(p)
+	}
+	stats := fs.PageCacheStats()
+	expected := PageCacheStats{Hits: 3, Misses: 1, ReadAheadPages: 5, ReadAheadHits: 3, SequentialReads: 4}
+	if stats != expected {
+		t.Errorf("Expected %+v but got %+v", expected, stats)
+	}
+	if stats.HitRate() != 0.75 {
+		t.Errorf("Expected a hit rate of 0.75 but got %f", stats.HitRate())
+	}
+
+	// Random reads don't read ahead, and evict the least recently used pages once the cache is full
+	fs.DropPageCache()
+	for _, off := range []int64{150, 0, 70, 30, 110, 90, 130, 50, 10, 150} {
+		h.ReadAt(p, off)
+	}
+	stats = fs.PageCacheStats()
+	expected = PageCacheStats{Hits: 0, Misses: 10, Evictions: 2, RandomReads: 10}
+	if stats != expected {
+		t.Errorf("Expected %+v but got %+v", expected, stats)
+	}
+
+	// Writes through handles leave the written pages cached
+	fs.DropPageCache()
+	h.Write([]byte("y"))
+	h.ReadAt(p[:1], 160)
+	if stats := fs.PageCacheStats(); stats.Hits != 1 || stats.Misses != 0 {
+		t.Errorf("Expected reading the written page to hit, got %+v", stats)
+	}
+
+	// Without the option nothing is recorded
+	plain := NewFileSystem()
+	plain.MkFile("file1")
+	plain.WriteFile("file1", "hello")
+	h, _ = plain.Open("file1")
+	h.Read(p)
+	if stats := plain.PageCacheStats(); stats != (PageCacheStats{}) {
+		t.Errorf("Expected no statistics but got %+v", stats)
+	}
+}
+
+func TestPageCacheFrozenViews(t *testing.T) {
+	b := NewBuilder(Options{PageCachePages: 8, PageSize: 10, ReadAheadPages: 2})
+	b.File("file1", strings.Repeat("x", 160))
+	fs, err := b.Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run with -race: each view reads through its own cache, so views on different goroutines
+	// don't share one, and each sees the statistics of its own reads only
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			view := fs.View()
+			h, _ := view.Open("file1")
+			p := make([]byte, 10)
+			for j := 0; j < 4; j++ {
+				h.Read(p)
+			}
+			h.Close()
+			expected := PageCacheStats{Hits: 3, Misses: 1, ReadAheadPages: 5, ReadAheadHits: 3, SequentialReads: 4}
+			if stats := view.PageCacheStats(); stats != expected {
+				t.Errorf("Expected %+v but got %+v", expected, stats)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,78 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+	"math/bits"
+	"strings"
+)
+
+// How many paths of a PathLengths report have a length within a range
+type PathLengthBucket struct {
+	// The shortest and longest lengths in the bucket, in bytes
+	Min   int
+	Max   int
+	Count int
+}
+
+// How long the paths of a tree are, as returned by Longest, to check a tree fits the limits of
+// the platform it will be exported to, e.g. 255 bytes per name and 4096 per path on Linux, or 260
+// per path on Windows. Lengths are in bytes, of absolute paths such as "/docs/a.txt". Virtual
+// files are left out.
+type PathLengths struct {
+	// How many entries there are, not counting the root
+	Entries int
+	// The path of the entry nested most deeply (the first by path if there are several), and how
+	// many levels below the root it is
+	DeepestPath string
+	Depth       int
+	// The longest path, the first by path if there are several
+	LongestPath string
+	// The path of the entry with the longest name, and the length of its name
+	LongestNamePath string
+	LongestName     int
+	// How many paths have each length, in buckets doubling in size (2-3, 4-7, 8-15...) from
+	// the shortest path to the longest one, including empty buckets in between
+	Distribution []PathLengthBucket
+}
+
+// Reports the deepest path, the longest path and the longest name in the tree, and how the
+// lengths of all the paths are distributed. Symbolic links are counted as entries, not followed.
+//
+// Returns:
+//
+//	PathLengths - the report; without entries, the paths are "/" and the lengths 0
+func (fs *Filesystem) Longest() PathLengths {
+	report := PathLengths{DeepestPath: "/", LongestPath: "/", LongestNamePath: "/"}
+	// How many paths fall in the bucket of each power of two
+	counts := map[int]int{}
+	util.WalkTree(fs.root, func(f *util.File) {
+		if f == fs.root || f.IsVirtual() {
+			return
+		}
+		p := fullPath(f, fs.root)
+		report.Entries++
+		if depth := strings.Count(p, "/"); depth > report.Depth || depth == report.Depth && p < report.DeepestPath {
+			report.DeepestPath, report.Depth = p, depth
+		}
+		if len(p) > len(report.LongestPath) || len(p) == len(report.LongestPath) && p < report.LongestPath {
+			report.LongestPath = p
+		}
+		if name := f.GetName(); len(name) > report.LongestName || len(name) == report.LongestName && p < report.LongestNamePath {
+			report.LongestNamePath, report.LongestName = p, len(name)
+		}
+		counts[bits.Len(uint(len(p)))-1]++
+	})
+
+	report.Distribution = []PathLengthBucket{}
+	if report.Entries == 0 {
+		return report
+	}
+	first, last := bits.Len(uint(len(report.LongestPath))), 0
+	for bucket := range counts {
+		first, last = min(first, bucket), max(last, bucket)
+	}
+	for bucket := first; bucket <= last; bucket++ {
+		report.Distribution = append(report.Distribution, PathLengthBucket{Min: 1 << bucket, Max: 1<<(bucket+1) - 1, Count: counts[bucket]})
+	}
+	return report
+}
@@ -0,0 +1,54 @@
+// pathlengths_test.go
+package imfs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLongest(t *testing.T) {
+	fs := NewFileSystem()
+	if report := fs.Longest(); report.Entries != 0 || report.DeepestPath != "/" || len(report.Distribution) != 0 {
+		t.Errorf("Expected an empty report, got %+v", report)
+	}
+
+	longName := strings.Repeat("n", 40)
+	fs.MkDir("a")
+	fs.MkDir("~/a/b")
+	fs.MkDir("~/a/b/c")
+	fs.MkFile("~/a/b/c/d")
+	fs.MkFile("~/" + longName)
+	fs.Symlink("a", "link")
+
+	report := fs.Longest()
+	if report.Entries != 6 {
+		t.Errorf("Expected 6 entries, got %d", report.Entries)
+	}
+	if report.DeepestPath != "/a/b/c/d" || report.Depth != 4 {
+		t.Errorf("Expected /a/b/c/d 4 levels deep, got %s at %d", report.DeepestPath, report.Depth)
+	}
+	if report.LongestPath != "/"+longName || report.LongestNamePath != "/"+longName || report.LongestName != 40 {
+		t.Errorf("Expected the longest path and name to be %s, got %+v", longName, report)
+	}
+	// Lengths 2 (/a), 4 (/a/b), 5 (/link), 6 (/a/b/c), 8 (/a/b/c/d) and 41
+	expected := []PathLengthBucket{
+		{Min: 2, Max: 3, Count: 1},
+		{Min: 4, Max: 7, Count: 3},
+		{Min: 8, Max: 15, Count: 1},
+		{Min: 16, Max: 31, Count: 0},
+		{Min: 32, Max: 63, Count: 1},
+	}
+	if !reflect.DeepEqual(report.Distribution, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, report.Distribution)
+	}
+
+	// Views report their own paths
+	view, err := fs.Chroot("~/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := view.Longest(); report.DeepestPath != "/c/d" || report.Depth != 2 || report.Entries != 2 {
+		t.Errorf("Expected /c/d 2 levels deep in the view, got %+v", report)
+	}
+}
@@ -0,0 +1,132 @@
+package imfs
+
+import (
+	"errors"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"path"
+	"strings"
+)
+
+// The most symbolic links followed while resolving a single path, to stop loops
+const MaxSymlinkHops int = 40
+
+// Why an element of a path couldn't be resolved or used, in the Err of the *PathError describing it
+var (
+	ErrDirNotFound  = util.ErrDirNotFound
+	ErrFileNotFound = errors.New("File not found")
+	ErrNotDir       = errors.New("Not a directory")
+	ErrIsDir        = errors.New("Is a directory")
+	ErrSymlinkLoop  = errors.New("Too many levels of symbolic links")
+)
+
+// Returns the last element of the path, ignoring trailing slashes, like `basename`. Returns "/"
+// for the root and "." for an empty path.
+func Basename(p string) string {
+	return path.Base(p)
+}
+
+// Returns everything but the last element of the path, ignoring trailing slashes, like `dirname`.
+// Returns "." for a path with a single element.
+func Dirname(p string) string {
+	trimmed := strings.TrimRight(p, "/")
+	if trimmed == "" && p != "" {
+		return "/"
+	}
+	return path.Dir(trimmed)
+}
+
+// Returns the canonical absolute path of an existing file or directory, like `realpath`: "~",
+// "." and ".." are resolved and symbolic links are followed. Paths starting with "/" or "~" are
+// resolved from the root, anything else from the current directory.
+//
+// Parameters:
+//
+//	path (string) - the path to resolve
+//
+// Returns:
+//
+//	string - the absolute path from the root, e.g. "/dir1/file1"
+//	error - an error if any element of the path doesn't exist or symbolic links loop
+func (fs *Filesystem) Realpath(path string) (string, error) {
+	file, err := fs.follow(path)
+	if err != nil {
+		return "", err
+	}
+	return fullPath(file, fs.root), nil
+}
+
+// Resolves the path, following symbolic links in every element (including the last)
+func (fs *Filesystem) follow(path string) (*util.File, error) {
+	hops := 0
+	file, err := fs.walkFollowing(fs.currentDirectory, path, &hops)
+	if err != nil {
+		return nil, fs.pathError(path, err)
+	}
+	return file, nil
+}
+
+// Describes a failure to resolve an element of the path as a *PathError, adding the full path that
+// was requested and the directory resolution started from. Other errors are returned as they are.
+func (fs *Filesystem) pathError(path string, err error) error {
+	var resolveErr *util.ResolveError
+	if !errors.As(err, &resolveErr) {
+		return err
+	}
+	return &PathError{Path: path, Err: resolveErr.Err, Segment: resolveErr.Segment, From: fullPath(resolveErr.Start, fs.root)}
+}
+
+// Walks the path from start, following symbolic links. Link targets starting with "/" or "~" are
+// resolved from the root, anything else from the directory containing the link. hops counts the
+// links followed so far. Fails with a *util.ResolveError naming the element that couldn't be
+// resolved.
+func (fs *Filesystem) walkFollowing(start *util.File, path string, hops *int) (*util.File, error) {
+	pathSplit := util.SplitPath(path)
+	if strings.HasPrefix(path, "/") || (len(pathSplit) > 0 && pathSplit[0] == "~") {
+		start = fs.root
+	}
+
+	curr := start
+	for i, name := range pathSplit {
+		switch {
+		case name == "~" && i == 0:
+		case name == ".":
+		case name == "..":
+			if curr != fs.root && curr.GetParent() != nil {
+				curr = curr.GetParent()
+			}
+		default:
+			if !curr.IsDirectory() {
+				return nil, &util.ResolveError{Err: ErrNotDir, Segment: curr.GetName(), Start: start}
+			}
+			child := curr.GetChildByName(name)
+			if child == nil {
+				loaded, err := fs.loadFromBacking(curr, name)
+				if err != nil {
+					return nil, err
+				}
+				child = loaded
+			}
+			if child == nil {
+				return nil, &util.ResolveError{Err: ErrFileNotFound, Segment: name, Start: start}
+			}
+			if link, ok := child.AsSymlink(); ok {
+				*hops++
+				if *hops > MaxSymlinkHops {
+					return nil, &util.ResolveError{Err: ErrSymlinkLoop, Segment: name, Start: start}
+				}
+				target, err := fs.walkFollowing(curr, link.Target(), hops)
+				if err != nil {
+					// Report where this path started from rather than the link's directory
+					var resolveErr *util.ResolveError
+					if errors.As(err, &resolveErr) {
+						resolveErr.Start = start
+					}
+					return nil, err
+				}
+				child = target
+			}
+			curr = child
+		}
+	}
+	return curr, nil
+}
@@ -0,0 +1,93 @@
+// paths_test.go
+package imfs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBasenameAndDirname(t *testing.T) {
+	cases := map[string][2]string{
+		"/dir1/file1": {"file1", "/dir1"},
+		"dir1/dir2/":  {"dir2", "dir1"},
+		"file1":       {"file1", "."},
+		"/":           {"/", "/"},
+	}
+	for path, expected := range cases {
+		if res := Basename(path); res != expected[0] {
+			t.Errorf("Expected the basename of %s to be %s but got %s", path, expected[0], res)
+		}
+		if res := Dirname(path); res != expected[1] {
+			t.Errorf("Expected the dirname of %s to be %s but got %s", path, expected[1], res)
+		}
+	}
+}
+
+func TestRealpath(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.MkDir("dir1/dir2")
+	fs.Cd("dir1/dir2")
+	fs.MkFile("file1")
+	fs.Cd("~")
+	fs.Symlink("dir1/dir2", "link")
+	fs.Symlink("../link/file1", "dir1/relative")
+	fs.Symlink("/loop2", "loop1")
+	fs.Symlink("/loop1", "loop2")
+
+	res, err := fs.Realpath("dir1/./dir2/../dir2/file1")
+	assertMatchesAndNoErrors(res, err, "/dir1/dir2/file1", t)
+	res, err = fs.Realpath("~")
+	assertMatchesAndNoErrors(res, err, "/", t)
+
+	// Links are followed anywhere in the path, relative to the directory containing them
+	res, err = fs.Realpath("link/file1")
+	assertMatchesAndNoErrors(res, err, "/dir1/dir2/file1", t)
+	res, err = fs.Realpath("dir1/relative")
+	assertMatchesAndNoErrors(res, err, "/dir1/dir2/file1", t)
+
+	// Relative paths start from the current directory
+	fs.Cd("dir1")
+	res, err = fs.Realpath("../link")
+	assertMatchesAndNoErrors(res, err, "/dir1/dir2", t)
+
+	res, err = fs.Realpath("missing")
+	assertErrorAndEmptyResult(res, err, "File not found: missing (resolving missing from /dir1)", t)
+	res, err = fs.Realpath("~/loop1")
+	assertErrorAndEmptyResult(res, err, "Too many levels of symbolic links: loop1 (resolving ~/loop1 from /)", t)
+}
+
+func TestPathErrors(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.Cd("dir1")
+	fs.MkDir("dir2")
+	fs.MkFile("file1")
+
+	// The failing element, the whole path and where resolution started are all reported
+	cases := map[string]func() error{
+		"cd":      func() error { _, err := fs.Cd("dir2/missing/dir3"); return err },
+		"mkdir":   func() error { _, err := fs.MkDir("~/dir1/missing/new"); return err },
+		"ls":      func() error { _, err := fs.Ls("../dir1/missing"); return err },
+		"symlink": func() error { _, err := fs.Readlink("dir2/missing/link"); return err },
+	}
+	expected := map[string]PathError{
+		"cd":      {Path: "dir2/missing/dir3", Err: ErrDirNotFound, Segment: "missing", From: "/dir1"},
+		"mkdir":   {Path: "~/dir1/missing/new", Err: ErrDirNotFound, Segment: "missing", From: "/"},
+		"ls":      {Path: "../dir1/missing", Err: ErrDirNotFound, Segment: "missing", From: "/dir1"},
+		"symlink": {Path: "dir2/missing/link", Err: ErrDirNotFound, Segment: "missing", From: "/dir1"},
+	}
+	for name, run := range cases {
+		var pathErr *PathError
+		if err := run(); !errors.As(err, &pathErr) || *pathErr != expected[name] {
+			t.Errorf("%s: expected %+v, got %#v", name, expected[name], err)
+		}
+	}
+
+	res, err := fs.Realpath("/dir1/file1/dir3")
+	assertErrorAndEmptyResult(res, err, "Not a directory: file1 (resolving /dir1/file1/dir3 from /)", t)
+	if !errors.Is(err, ErrNotDir) {
+		t.Errorf("Expected ErrNotDir, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+	"sync"
+	"time"
+)
+
+// How long a single operation took, as recorded by Profile
+type OperationTiming struct {
+	Op      Operation
+	Path    string
+	Elapsed time.Duration
+	// The error the operation returned, if any
+	Err error
+}
+
+// The cost of the work done by a function passed to Profile
+type Profile struct {
+	// The wall-clock time the function took
+	Elapsed time.Duration
+	// How many nodes of the tree were visited, e.g. while resolving paths or searching. Only the
+	// tree of this filesystem is counted, including the work done on it through other views
+	NodesVisited uint64
+	// The operations (as seen by hooks) the function ran, in the order they finished
+	Operations []OperationTiming
+}
+
+// Runs fn and measures its cost: how long it took, how many nodes it visited and how long each
+// operation it ran took. This helps understand what commands such as a recursive find cost on
+// large trees. Profiles may be nested, in which case the outer one includes the inner one's
+// operations.
+//
+// Parameters:
+//
+//	fn (func()) - the work to measure
+//
+// Returns:
+//
+//	Profile - the cost of fn
+func (fs *Filesystem) Profile(fn func()) Profile {
+	outer := fs.profile
+	profile := &Profile{}
+	fs.profile = profile
+	// Stopped once fn returns, or by the deferred call if it panics
+	stopCounting := sync.OnceValue(util.CountVisits(fs.storage().root))
+	started := time.Now()
+	defer func() {
+		stopCounting()
+		fs.profile = outer
+		if outer != nil {
+			outer.Operations = append(outer.Operations, profile.Operations...)
+		}
+	}()
+
+	fn()
+	profile.Elapsed = time.Since(started)
+	profile.NodesVisited = stopCounting()
+	return *profile
+}
+
+// Records the timing of an operation if a profile is being collected
+func (fs *Filesystem) profileOperation(event *OperationEvent, started time.Time, err error) {
+	if fs.profile != nil {
+		fs.profile.Operations = append(fs.profile.Operations,
+			OperationTiming{Op: event.Op, Path: event.Path, Elapsed: time.Since(started), Err: err})
+	}
+}
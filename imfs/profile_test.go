@@ -0,0 +1,62 @@
+// profile_test.go
+package imfs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkDir("a")
+	fs.Cd("a")
+	for _, name := range []string{"x", "y", "z"} {
+		fs.MkFile(name)
+	}
+	fs.Cd("~")
+
+	profile := fs.Profile(func() {
+		fs.FindFileOrDir("z", true)
+	})
+	// The root's child a, then a's three children
+	if profile.NodesVisited != 4 || len(profile.Operations) != 0 || profile.Elapsed <= 0 {
+		t.Errorf("Expected a search visiting 4 nodes and running no operations, got %+v", profile)
+	}
+
+	// Work on other filesystems meanwhile isn't counted
+	other := NewFileSystem()
+	other.MkDir("a")
+	profile = fs.Profile(func() {
+		fs.FindFileOrDir("z", true)
+		other.FindFileOrDir("a", true)
+		other.Cd("a")
+	})
+	if profile.NodesVisited != 4 {
+		t.Errorf("Expected only the 4 nodes of this filesystem to be counted, got %d", profile.NodesVisited)
+	}
+
+	fs.Use(HookFuncs{BeforeFunc: func(event *OperationEvent) error {
+		if event.Op == OperationRm {
+			return errors.New("Denied")
+		}
+		return nil
+	}})
+	var inner Profile
+	profile = fs.Profile(func() {
+		fs.MkDir("b")
+		inner = fs.Profile(func() {
+			fs.Rm("b", true)
+		})
+	})
+	if len(inner.Operations) != 1 || inner.Operations[0].Op != OperationRm || inner.Operations[0].Err == nil {
+		t.Errorf("Expected the vetoed rm to be recorded with its error, got %+v", inner.Operations)
+	}
+	if len(profile.Operations) != 2 || profile.Operations[0].Op != OperationMkDir || profile.Operations[0].Path != "b" {
+		t.Errorf("Expected the outer profile to include both operations, got %+v", profile.Operations)
+	}
+
+	fs.MkDir("c")
+	if fs.profile != nil {
+		t.Errorf("Expected profiling to stop after Profile returns")
+	}
+}
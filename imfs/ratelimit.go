@@ -0,0 +1,146 @@
+package imfs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Matches every *RateLimitError with errors.Is
+var ErrRateLimited = errors.New("Rate limit exceeded")
+
+// Returned by operations vetoed by a RateLimiter
+type RateLimitError struct {
+	// What ran out: "operations" or "bytes written"
+	Limit string
+	// How long until the operation would be allowed, for clients to back off
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("Rate limit exceeded for %s: retry after %s", e.Limit, e.RetryAfter)
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// The limits of a RateLimiter. A zero rate disables that limit.
+type RateLimit struct {
+	// How many operations may run per second on average
+	OpsPerSecond float64
+	// How many operations may run at once after a quiet period. Defaults to one second's worth
+	OpsBurst int
+	// How many bytes may be written per second on average
+	BytesPerSecond float64
+	// How many bytes may be written at once after a quiet period. Defaults to one second's worth.
+	// A single write larger than this is allowed once the bucket is full, and empties it
+	BytesBurst int
+	// Returns the current time. Defaults to time.Now; set it to test backoff without sleeping
+	Now func() time.Time
+}
+
+// A Hook limiting the rate of operations and of bytes written with token buckets, e.g. to test a
+// client's backoff against a throttling storage backend. Operations over the limit fail with a
+// *RateLimitError saying when to retry; they don't wait. Register a separate limiter on each
+// client's View to limit clients independently.
+type RateLimiter struct {
+	now   func() time.Time
+	ops   tokenBucket
+	bytes tokenBucket
+}
+
+// A bucket refilling at rate tokens per second up to burst
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// Creates a rate limiter; register it with Use
+//
+// Parameters:
+//
+//	limit (RateLimit) - the limits
+//
+// Returns:
+//
+//	*RateLimiter - the limiter, with full buckets
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	now := limit.Now
+	if now == nil {
+		now = time.Now
+	}
+	started := now()
+	return &RateLimiter{
+		now:   now,
+		ops:   newTokenBucket(limit.OpsPerSecond, limit.OpsBurst, started),
+		bytes: newTokenBucket(limit.BytesPerSecond, limit.BytesBurst, started),
+	}
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) tokenBucket {
+	b := tokenBucket{rate: rate, burst: float64(burst), last: now}
+	if b.burst <= 0 {
+		b.burst = math.Max(1, math.Ceil(rate))
+	}
+	b.tokens = b.burst
+	return b
+}
+
+// Vetoes the operation if either bucket doesn't have enough tokens for it; otherwise takes them
+func (l *RateLimiter) Before(event *OperationEvent) error {
+	now := l.now()
+	l.ops.refill(now)
+	l.bytes.refill(now)
+
+	if wait := l.ops.wait(1); wait > 0 {
+		return &RateLimitError{Limit: "operations", RetryAfter: wait}
+	}
+	written := 0
+	if event.Op == OperationWrite {
+		written = len(event.Data)
+	}
+	if wait := l.bytes.wait(float64(written)); wait > 0 {
+		return &RateLimitError{Limit: "bytes written", RetryAfter: wait}
+	}
+	l.ops.take(1)
+	l.bytes.take(float64(written))
+	return nil
+}
+
+func (l *RateLimiter) After(event *OperationEvent) {}
+
+// Adds the tokens earned since the last refill
+func (b *tokenBucket) refill(now time.Time) {
+	if b.rate <= 0 {
+		return
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+}
+
+// Returns how long until n tokens can be taken, rounded up to the millisecond, or 0 if they can be
+// now. Requests larger than the burst only need a full bucket.
+func (b *tokenBucket) wait(n float64) time.Duration {
+	if b.rate <= 0 || n == 0 {
+		return 0
+	}
+	n = math.Min(n, b.burst)
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration(math.Ceil((n-b.tokens)/b.rate*1000)) * time.Millisecond
+}
+
+// Takes n tokens, emptying the bucket for requests larger than the burst
+func (b *tokenBucket) take(n float64) {
+	if b.rate <= 0 {
+		return
+	}
+	b.tokens = math.Max(0, b.tokens-n)
+}
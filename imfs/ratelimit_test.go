@@ -0,0 +1,62 @@
+// ratelimit_test.go
+package imfs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterOps(t *testing.T) {
+	// Set up test subject
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fs := NewFileSystem()
+	fs.Use(NewRateLimiter(RateLimit{OpsPerSecond: 2, OpsBurst: 3, Now: func() time.Time { return now }}))
+
+	// The burst goes through, then operations fail until tokens are earned back
+	for _, name := range []string{"a", "b", "c"} {
+		res, err := fs.MkFile(name)
+		assertMatchesAndNoErrors(res, err, name, t)
+	}
+	res, err := fs.MkFile("d")
+	assertErrorAndEmptyResult(res, err, "Rate limit exceeded for operations: retry after 500ms", t)
+	var limited *RateLimitError
+	if !errors.As(err, &limited) || limited.RetryAfter != 500*time.Millisecond || !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected a *RateLimitError but got %#v", err)
+	}
+
+	// Vetoed operations don't use up tokens
+	now = now.Add(500 * time.Millisecond)
+	res, err = fs.MkFile("d")
+	assertMatchesAndNoErrors(res, err, "d", t)
+	now = now.Add(10 * time.Second)
+	res, err = fs.Ls()
+	assertMatchesAndNoErrors(res, err, "a b c d", t)
+}
+
+func TestRateLimiterBytes(t *testing.T) {
+	// Set up test subject
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fs := NewFileSystem()
+	fs.MkFile("a")
+	fs.Use(NewRateLimiter(RateLimit{BytesPerSecond: 10, Now: func() time.Time { return now }}))
+
+	// The burst defaults to one second's worth
+	res, err := fs.WriteFile("a", "12345678")
+	assertMatchesAndNoErrors(res, err, "a", t)
+	res, err = fs.WriteFile("a", "12345")
+	assertErrorAndEmptyResult(res, err, "Rate limit exceeded for bytes written: retry after 300ms", t)
+
+	// Writes larger than the burst only need a full bucket, and empty it
+	now = now.Add(time.Second)
+	res, err = fs.WriteFile("a", "a write larger than the burst")
+	assertMatchesAndNoErrors(res, err, "a", t)
+	if _, err := fs.WriteFile("a", "x"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected the bucket to be empty but got %v", err)
+	}
+
+	// Other operations aren't limited by bytes
+	if _, err := fs.ReadFile("a"); err != nil {
+		t.Errorf("Expected reads not to be limited but got %s", err)
+	}
+}
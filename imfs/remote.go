@@ -0,0 +1,152 @@
+package imfs
+
+import (
+	"context"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// How long fetching a remote file may take unless `Options.RemoteTimeout` is set
+const DefaultRemoteTimeout = 30 * time.Second
+
+// Creates a read-only file whose contents are fetched from a URL with an HTTP GET on its first
+// read, then cached (see DropRemoteCache), so large blobs can be part of a tree without being
+// held in memory until they are used. Snapshots, checkpoints and fixtures only store the URL.
+//
+// Reads can't report errors from the fetch: a file that can't be fetched (after
+// `Options.RemoteTimeout`, or because the server returned an error) reads as empty, and is fetched
+// again on the next read. Use FetchRemote to fetch a file ahead of time and see why it failed.
+//
+// Parameters:
+//
+//	path (string) - where to create the file. Its parent directory must already exist
+//	rawURL (string) - the http or https URL to fetch the contents from
+//
+// Returns:
+//
+//	string - the name of the new file
+//	error - an error if the URL isn't an http or https URL, the parent directory doesn't exist or
+//	        the path is already taken
+func (fs *Filesystem) MkRemoteFile(path string, rawURL string) (string, error) {
+	return fs.runHooks(&OperationEvent{Op: OperationMkFile, Path: path}, func() (string, error) {
+		if fs.replica {
+			return "", ErrReadOnly
+		}
+		if err := checkRemoteURL(rawURL); err != nil {
+			return "", err
+		}
+		file, err := fs.createAt(path)
+		if err != nil {
+			return "", err
+		}
+		file.SetKind(util.KindRemote)
+		file.SetContents([]byte(rawURL))
+		fs.attachRemote(file)
+		fs.touch(file)
+		fs.record(JournalEntry{Op: OpMkRemote, Path: file.GetFullPathName(fs.root), Target: rawURL})
+		return file.GetName(), nil
+	})
+}
+
+// Fetches a remote file now, unless it is already cached, so later reads don't wait for it
+//
+// Parameters:
+//
+//	ctx (context.Context) - cancels the fetch; `Options.RemoteTimeout` still applies
+//	path (string) - the remote file
+//
+// Returns:
+//
+//	error - an error if the path isn't a remote file or fetching it fails
+func (fs *Filesystem) FetchRemote(ctx context.Context, path string) error {
+	file, err := fs.follow(path)
+	if err != nil {
+		return err
+	}
+	if file.GetKind() != util.KindRemote {
+		return fmt.Errorf("File %s is not a remote file", path)
+	}
+	_, err = fs.storage().fetchRemote(ctx, file.RemoteURL())
+	return err
+}
+
+// Forgets the fetched contents of every remote file, so each is fetched again on its next read
+func (fs *Filesystem) DropRemoteCache() {
+	fs.storage().remoteCache = nil
+}
+
+// Returns an error unless the URL can be fetched by a remote file
+func checkRemoteURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("Invalid URL %s: only http and https URLs are supported", rawURL)
+	}
+	return nil
+}
+
+// Makes reads of a remote file fetch its URL
+func (fs *Filesystem) attachRemote(file *util.File) {
+	storage := fs.storage()
+	rawURL := file.RemoteURL()
+	file.SetVirtual(func() []byte {
+		data, _ := storage.fetchRemote(context.Background(), rawURL)
+		return data
+	}, nil)
+}
+
+// Attaches every remote file in a tree that was just built, e.g. from a snapshot
+func (fs *Filesystem) attachRemoteFiles(root *util.File) {
+	util.WalkTree(root, func(f *util.File) {
+		if f.GetKind() == util.KindRemote {
+			fs.attachRemote(f)
+		}
+	})
+}
+
+// Returns the contents at a URL, from the cache if they were fetched before. Failures aren't
+// cached.
+func (fs *Filesystem) fetchRemote(ctx context.Context, rawURL string) ([]byte, error) {
+	if data, ok := fs.remoteCache[rawURL]; ok {
+		return data, nil
+	}
+
+	timeout := fs.opts.RemoteTimeout
+	if timeout <= 0 {
+		timeout = DefaultRemoteTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := fs.opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Fetching %s failed: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Fetching %s failed: %s", rawURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(util.MaxFileSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("Fetching %s failed: %w", rawURL, err)
+	}
+	if len(data) > util.MaxFileSize {
+		return nil, fmt.Errorf("Fetching %s failed: exceeded max file size %d", rawURL, util.MaxFileSize)
+	}
+
+	if fs.remoteCache == nil {
+		fs.remoteCache = make(map[string][]byte)
+	}
+	fs.remoteCache[rawURL] = data
+	return data, nil
+}
@@ -0,0 +1,88 @@
+// remote_test.go
+package imfs
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRemoteFile(t *testing.T) {
+	// Set up test subject
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/blob":
+			fetches++
+			w.Write([]byte("remote contents"))
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	fs := NewFileSystemWithOptions(Options{RemoteTimeout: 50 * time.Millisecond})
+
+	// Nothing is fetched until the first read, which is then cached
+	res, err := fs.MkRemoteFile("blob", server.URL+"/blob")
+	assertMatchesAndNoErrors(res, err, "blob", t)
+	if fetches != 0 {
+		t.Errorf("Expected no fetch before the first read but got %d", fetches)
+	}
+	res, err = fs.ReadFile("blob")
+	assertMatchesAndNoErrors(res, err, "remote contents", t)
+	fs.ReadFile("blob")
+	if fetches != 1 {
+		t.Errorf("Expected one fetch but got %d", fetches)
+	}
+	fs.DropRemoteCache()
+	fs.ReadFile("blob")
+	if fetches != 2 {
+		t.Errorf("Expected dropping the cache to fetch again but got %d fetches", fetches)
+	}
+
+	// Remote files are read-only
+	if _, err := fs.WriteFile("blob", "local"); err == nil {
+		t.Errorf("Expected writing to a remote file to fail")
+	}
+
+	// Snapshots and fixtures keep the URL, not the contents
+	snapshot := snapshotBytes(fs)
+	if bytes.Contains(snapshot, []byte("remote contents")) {
+		t.Errorf("Expected the snapshot not to embed the contents")
+	}
+	loaded := NewFileSystem()
+	loaded.LoadSnapshot(bytes.NewReader(snapshot))
+	res, err = loaded.ReadFile("blob")
+	assertMatchesAndNoErrors(res, err, "remote contents", t)
+	var fixture bytes.Buffer
+	fs.DumpFixture(&fixture, FixtureYAML)
+	if !strings.Contains(fixture.String(), "url: \""+server.URL+"/blob\"") {
+		t.Errorf("Expected the fixture to have the URL but got %s", fixture.String())
+	}
+
+	// Failures are reported by FetchRemote, and read as empty
+	fs.MkRemoteFile("missing", server.URL+"/missing")
+	err = fs.FetchRemote(context.Background(), "missing")
+	if err == nil || !strings.HasSuffix(err.Error(), "404 Not Found") {
+		t.Errorf("Expected a 404 error but got %v", err)
+	}
+	res, err = fs.ReadFile("missing")
+	assertMatchesAndNoErrors(res, err, "", t)
+	fs.MkRemoteFile("slow", server.URL+"/slow")
+	if err := fs.FetchRemote(context.Background(), "slow"); err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("Expected a timeout but got %v", err)
+	}
+	if err := fs.FetchRemote(context.Background(), "~"); err == nil || err.Error() != "File ~ is not a remote file" {
+		t.Errorf("Expected a not remote error but got %v", err)
+	}
+
+	// Only http and https URLs are accepted
+	res, err = fs.MkRemoteFile("local", "file:///etc/passwd")
+	assertErrorAndEmptyResult(res, err, "Invalid URL file:///etc/passwd: only http and https URLs are supported", t)
+}
@@ -0,0 +1,262 @@
+package imfs
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A rename made, or previewed, by BatchRename
+type Rename struct {
+	// The absolute path of the entry before and after the rename
+	From string
+	To   string
+}
+
+// Matches the placeholders of a BatchRename template
+var renamePlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// Renames a file, directory or link within its directory. The new name may differ from the old one
+// in letter case only, e.g. "readme.md" to "README.md", including with `Options.CaseInsensitive`,
+// where both names lead to the entry: it is never mistaken for a different one already holding
+// the name. Links pointing at the entry are updated with `Options.RepointLinks`.
+//
+// Parameters:
+//
+//	path (string) - the entry to rename, relative to the current directory or absolute. A link
+//	                at the end of the path is renamed itself, not followed
+//	name (string) - the new name, without any "/"
+//
+// Returns:
+//
+//	string - the new absolute path of the entry
+//	error - an error if the path doesn't exist or is the root, the name is invalid, or another
+//	        entry already has the name
+func (fs *Filesystem) Rename(path string, name string) (string, error) {
+	return fs.runHooks(&OperationEvent{Op: OperationMv, Path: path, Target: name}, func() (string, error) {
+		if fs.replica {
+			return "", ErrReadOnly
+		}
+		if fs.opts.Backing != nil {
+			// Loads the path from the backing store if the tree doesn't have it yet
+			fs.follow(path)
+		}
+		file, err := fs.resolve(path)
+		if err != nil {
+			return "", err
+		}
+		if file == fs.root {
+			return "", fmt.Errorf("Cannot rename the root directory")
+		}
+		if !validName(name) {
+			return "", fmt.Errorf("Invalid name %q", name)
+		}
+		if name == file.GetName() {
+			return fullPath(file, fs.root), nil
+		}
+		// With names that only differ in case, this may find the entry itself
+		existing := file.GetParent().GetChildByName(name)
+		if existing == nil {
+			if existing, err = fs.loadFromBacking(file.GetParent(), name); err != nil {
+				return "", err
+			}
+		}
+		if existing != nil && existing != file {
+			return "", fmt.Errorf("File %s already exists", name)
+		}
+		fs.rename(file, name)
+		return fullPath(file, fs.root), nil
+	})
+}
+
+// Renames every entry of a directory whose name matches a glob, like mmv: the new names are made
+// from a template, in which {1}, {2}... are replaced with what the glob's first, second...
+// wildcard (`*`, `?` or `[...]`) matched, {name} with the old name without its extension and
+// {ext} with its extension, e.g. ("*.log", "{name}.old.log") or ("img_*_*.png", "{2}-{1}.png").
+// Files, directories and links are all renamed in place; links pointing at them are updated with
+// `Options.RepointLinks`. Entries whose name doesn't change are left alone.
+//
+// Nothing is renamed unless every rename can be made: new names must be valid, distinct, and not
+// already taken in the directory.
+//
+// Parameters:
+//
+//	glob (string) - the names to rename (see path.Match), optionally in a directory other than the
+//	                current one, e.g. "logs/*.log". Only the last element may have wildcards
+//	template (string) - the new name of each matching entry
+//
+// Returns:
+//
+//	[]Rename - the renames made, ordered by old name
+//	error - an error if the directory doesn't exist, the glob or template is invalid, or a rename
+//	        would fail, in which case nothing was renamed. If a Hook vetoes a rename, its error,
+//	        with the renames made before it
+func (fs *Filesystem) BatchRename(glob string, template string) ([]Rename, error) {
+	if fs.replica {
+		return nil, ErrReadOnly
+	}
+	renames, files, err := fs.planBatchRename(glob, template)
+	if err != nil {
+		return nil, err
+	}
+	for i, rename := range renames {
+		_, err := fs.runHooks(&OperationEvent{Op: OperationMv, Path: rename.From, Target: rename.To}, func() (string, error) {
+			fs.rename(files[i], path.Base(rename.To))
+			return rename.To, nil
+		})
+		if err != nil {
+			return renames[:i], err
+		}
+	}
+	return renames, nil
+}
+
+// Returns the renames BatchRename would make, without making them, as a dry run
+//
+// Parameters:
+//
+//	glob (string) - the names to rename, as for BatchRename
+//	template (string) - the new name of each matching entry, as for BatchRename
+//
+// Returns:
+//
+//	[]Rename - the renames that would be made, ordered by old name
+//	error - the error BatchRename would fail with before renaming anything
+func (fs *Filesystem) PreviewBatchRename(glob string, template string) ([]Rename, error) {
+	renames, _, err := fs.planBatchRename(glob, template)
+	return renames, err
+}
+
+// Works out and checks the renames of a BatchRename, returning them along with the entries to rename
+func (fs *Filesystem) planBatchRename(glob string, template string) ([]Rename, []*util.File, error) {
+	dirPath, pattern := path.Split(glob)
+	if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+		return nil, nil, fmt.Errorf("Invalid glob %s", glob)
+	}
+	matcher, err := globCaptures(pattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid glob %s", glob)
+	}
+	dir := fs.currentDirectory
+	if dirPath != "" {
+		if dir, err = fs.follow(dirPath); err != nil {
+			return nil, nil, err
+		}
+		if !dir.IsDirectory() {
+			return nil, nil, fmt.Errorf("Target path %s is not a directory", dirPath)
+		}
+	}
+
+	names := []string{}
+	for _, name := range dir.GetChildrenNames() {
+		if matcher.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+
+	renames, files := []Rename{}, []*util.File{}
+	taken := map[string]string{}
+	for _, name := range names {
+		newName, err := expandRenameTemplate(template, name, matcher.FindStringSubmatch(name)[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		if newName == name {
+			continue
+		}
+		if !validName(newName) {
+			return nil, nil, fmt.Errorf("Invalid name %q for %s", newName, name)
+		}
+		if other, ok := taken[dir.ChildKey(newName)]; ok {
+			return nil, nil, fmt.Errorf("Both %s and %s would be renamed to %s", other, name, newName)
+		}
+		// With Options.CaseInsensitive, a rename changing only the case finds the entry itself
+		file := dir.GetChildByName(name)
+		if existing := dir.GetChildByName(newName); existing != nil && existing != file {
+			return nil, nil, fmt.Errorf("Cannot rename %s to %s: File %s already exists", name, newName, newName)
+		}
+		taken[dir.ChildKey(newName)] = name
+		files = append(files, file)
+		renames = append(renames, Rename{From: joinFullPath(dir, name, fs.root), To: joinFullPath(dir, newName, fs.root)})
+	}
+	return renames, files, nil
+}
+
+// Translates a glob (see path.Match) to a regular expression matching the same names, with a
+// group capturing what each wildcard matched
+func globCaptures(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString("(.*)")
+		case '?':
+			b.WriteString("(.)")
+		case '[':
+			end := i + 1
+			for end < len(pattern) && pattern[end] != ']' {
+				if pattern[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(pattern) {
+				return nil, path.ErrBadPattern
+			}
+			b.WriteString("([" + pattern[i+1:end] + "])")
+			i = end
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// Fills in the placeholders of a BatchRename template for an entry
+func expandRenameTemplate(template string, name string, captures []string) (string, error) {
+	var err error
+	expanded := renamePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		key := placeholder[1 : len(placeholder)-1]
+		switch key {
+		case "name":
+			return strings.TrimSuffix(name, path.Ext(name))
+		case "ext":
+			return path.Ext(name)
+		}
+		n, convErr := strconv.Atoi(key)
+		if convErr != nil || n < 1 || n > len(captures) {
+			err = fmt.Errorf("Invalid placeholder %s: must be {name}, {ext} or {1} to {%d}", placeholder, len(captures))
+			return placeholder
+		}
+		return captures[n-1]
+	})
+	return expanded, err
+}
+
+// Returns true if name can name an entry
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && name != "~" && !strings.Contains(name, "/")
+}
+
+// Renames a node within its directory, journaling the move. The name must be free.
+func (fs *Filesystem) rename(file *util.File, name string) {
+	parent := file.GetParent()
+	oldPath := file.GetFullPathName(fs.root)
+	newPath := joinFullPath(parent, name, fs.root)
+	parent.RemoveChild(file.GetName())
+	file.SetName(name)
+	parent.UpsertChild(name, file)
+	fs.touchMoved(file)
+	fs.record(JournalEntry{Op: OpMv, Path: oldPath, Target: newPath})
+	fs.repointLinks(oldPath, newPath)
+}
@@ -0,0 +1,215 @@
+// rename_test.go
+package imfs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBatchRename(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("logs")
+	for _, name := range []string{"~/logs/app.log", "~/logs/db.log", "~/logs/notes.txt", "~/img_01_a.png", "~/img_02_b.png"} {
+		fs.MkFile(name)
+	}
+	fs.WriteFile("~/logs/app.log", "started")
+
+	// A preview changes nothing
+	expected := []Rename{
+		{From: "/logs/app.log", To: "/logs/app.old.log"},
+		{From: "/logs/db.log", To: "/logs/db.old.log"},
+	}
+	renames, err := fs.PreviewBatchRename("logs/*.log", "{name}.old.log")
+	if err != nil || !reflect.DeepEqual(renames, expected) {
+		t.Errorf("Expected %v but got %v, %v", expected, renames, err)
+	}
+	res, err := fs.Ls("~/logs")
+	assertMatchesAndNoErrors(res, err, "app.log db.log notes.txt", t)
+
+	renames, err = fs.BatchRename("logs/*.log", "{name}.old.log")
+	if err != nil || !reflect.DeepEqual(renames, expected) {
+		t.Errorf("Expected %v but got %v, %v", expected, renames, err)
+	}
+	res, err = fs.Ls("~/logs")
+	assertMatchesAndNoErrors(res, err, "app.old.log db.old.log notes.txt", t)
+	res, err = fs.ReadFile("~/logs/app.old.log")
+	assertMatchesAndNoErrors(res, err, "started", t)
+
+	// Captures are numbered in the order of the wildcards
+	if _, err := fs.BatchRename("img_*_?.png", "{2}-{1}{ext}"); err != nil {
+		t.Fatal(err)
+	}
+	res, err = fs.Ls()
+	assertMatchesAndNoErrors(res, err, "a-01.png b-02.png logs", t)
+
+	// Renames are journaled
+	replica := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err = replica.Ls()
+	assertMatchesAndNoErrors(res, err, "a-01.png b-02.png logs", t)
+}
+
+func TestBatchRenameConflicts(t *testing.T) {
+	fs := NewFileSystem()
+	for _, name := range []string{"a.txt", "b.txt", "c.md"} {
+		fs.MkFile(name)
+	}
+
+	for _, test := range []struct {
+		glob, template string
+	}{
+		// Two entries would get the same name
+		{"*.txt", "same.txt"},
+		// The name is taken by an entry that isn't renamed
+		{"a.*", "c.md"},
+		// Invalid names, placeholders and globs
+		{"*.txt", "{name}/x"},
+		{"*.txt", "{2}"},
+		{"*.txt", "{stem}"},
+		{"[a-", "x"},
+	} {
+		if _, err := fs.BatchRename(test.glob, test.template); err == nil {
+			t.Errorf("Expected an error renaming %s to %s", test.glob, test.template)
+		}
+	}
+	// Nothing was renamed
+	res, err := fs.Ls()
+	assertMatchesAndNoErrors(res, err, "a.txt b.txt c.md", t)
+
+	// A hook vetoing a rename stops the batch there
+	veto := errors.New("vetoed")
+	fs.Use(HookFuncs{BeforeFunc: func(event *OperationEvent) error {
+		if event.Path == "/b.txt" {
+			return veto
+		}
+		return nil
+	}})
+	renames, err := fs.BatchRename("*.txt", "{name}.bak")
+	if !errors.Is(err, veto) || !reflect.DeepEqual(renames, []Rename{{From: "/a.txt", To: "/a.bak"}}) {
+		t.Errorf("Expected the first rename and the veto, got %v, %v", renames, err)
+	}
+}
+
+func TestRename(t *testing.T) {
+	fs := NewFileSystemWithOptions(Options{RepointLinks: true})
+	fs.MkDir("docs")
+	fs.MkFile("~/docs/readme.md")
+	fs.WriteFile("~/docs/readme.md", "hello")
+	fs.Symlink("docs/readme.md", "link")
+
+	// Only the letter case changes
+	res, err := fs.Rename("docs/readme.md", "README.md")
+	assertMatchesAndNoErrors(res, err, "/docs/README.md", t)
+	res, err = fs.Ls("docs")
+	assertMatchesAndNoErrors(res, err, "README.md", t)
+	if _, err := fs.Stat("docs/readme.md"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected the old name to be gone, got %v", err)
+	}
+	res, err = fs.ReadFile("link")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+
+	// Directories too, including the current one
+	fs.Cd("docs")
+	res, err = fs.Rename("~/docs", "Docs")
+	assertMatchesAndNoErrors(res, err, "/Docs", t)
+	if pwd := fs.Pwd(); pwd != "/Docs" {
+		t.Errorf("Expected to be in /Docs, got %s", pwd)
+	}
+	fs.Cd("~")
+
+	// Renaming to the same name changes nothing, and names can't be taken or invalid
+	res, err = fs.Rename("Docs", "Docs")
+	assertMatchesAndNoErrors(res, err, "/Docs", t)
+	fs.MkFile("other")
+	if _, err := fs.Rename("other", "Docs"); err == nil {
+		t.Errorf("Expected an error renaming to a taken name")
+	}
+	if _, err := fs.Rename("other", "a/b"); err == nil {
+		t.Errorf("Expected an error renaming to an invalid name")
+	}
+	if _, err := fs.Rename("~", "root"); err == nil {
+		t.Errorf("Expected an error renaming the root")
+	}
+
+	// Case-only renames replay on replicas
+	replica := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err = replica.ReadFile("~/Docs/README.md")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+}
+
+func TestBatchRenameCaseOnly(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkFile("a.TXT")
+	fs.MkFile("b.TXT")
+
+	if _, err := fs.BatchRename("*.TXT", "{1}.txt"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := fs.Ls()
+	assertMatchesAndNoErrors(res, err, "a.txt b.txt", t)
+}
+
+func TestRenameCaseInsensitive(t *testing.T) {
+	fs := NewFileSystemWithOptions(Options{CaseInsensitive: true})
+	fs.MkDir("docs")
+	fs.MkFile("~/docs/readme.md")
+	fs.WriteFile("~/docs/readme.md", "hello")
+
+	// Any case finds the entry, and no other entry can take its name
+	res, err := fs.ReadFile("DOCS/ReadMe.MD")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+	res, err = fs.MkFile("~/docs/README.md")
+	assertMatchesAndNoErrors(res, err, "README1.md", t)
+	fs.Cd("docs")
+	fs.Rm("README1.md", false)
+	fs.Cd("~")
+
+	// Only the letter case changes, though both names already lead to the entry
+	res, err = fs.Rename("docs/readme.md", "README.md")
+	assertMatchesAndNoErrors(res, err, "/docs/README.md", t)
+	res, err = fs.Ls("docs")
+	assertMatchesAndNoErrors(res, err, "README.md", t)
+	res, err = fs.ReadFile("docs/readme.md")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+
+	// Renaming to another entry's name in a different case is still refused
+	fs.MkFile("~/docs/other")
+	if _, err := fs.Rename("docs/other", "readme.MD"); err == nil {
+		t.Errorf("Expected an error renaming to a taken name")
+	}
+
+	// Batch renames too, but not to names only differing in case from each other
+	fs.MkFile("~/docs/a.TXT")
+	fs.MkFile("~/docs/B.TXT")
+	if _, err := fs.BatchRename("docs/*.TXT", "{1}.txt"); err != nil {
+		t.Fatal(err)
+	}
+	res, err = fs.Ls("docs")
+	assertMatchesAndNoErrors(res, err, "a.txt B.txt other README.md", t)
+	fs.MkFile("~/docs/A.log")
+	_, err = fs.BatchRename("docs/?.*", "{1}.md")
+	if err == nil || err.Error() != "Both A.log and a.txt would be renamed to a.md" {
+		t.Errorf("Expected error: Both A.log and a.txt would be renamed to a.md but got %v", err)
+	}
+
+	// Replicas with the same option follow
+	replica := NewFileSystemWithOptions(Options{CaseInsensitive: true})
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err = replica.Ls("docs")
+	assertMatchesAndNoErrors(res, err, "A.log a.txt B.txt other README.md", t)
+}
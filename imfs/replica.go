@@ -0,0 +1,222 @@
+package imfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"io"
+	"log/slog"
+)
+
+// Returned when attempting to modify a read-only filesystem: one following another, or a frozen
+// one (see Builder.Freeze)
+var ErrReadOnly = errors.New("Filesystem is read-only")
+
+// Turns the filesystem into a read-only replica and applies a journal stream written by
+// StreamJournal until r is exhausted. Only the replication stream can modify a replica; all other
+// modifications fail with ErrReadOnly. The replica should start from the same state as the
+// leader did when streaming began (e.g. by loading a snapshot).
+//
+// Parameters:
+//
+//	r (io.Reader) - the journal stream to apply, e.g. a network connection
+//
+// Returns:
+//
+//	error - an error if the stream is malformed, skips entries, or can't be applied
+func (fs *Filesystem) Follow(r io.Reader) error {
+	if fs.chrootParent != nil {
+		return ErrChrootView
+	}
+	if fs.frozen {
+		return ErrReadOnly
+	}
+	fs.replica = true
+
+	dec := json.NewDecoder(r)
+	for {
+		// Header lines (see StreamJournal) decode into the same struct, since streams written
+		// before they were added start with an entry
+		line := struct {
+			JournalEntry
+			journalHeader
+		}{}
+		err := dec.Decode(&line)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid journal stream: %s", err)
+		}
+		if version := line.JournalVersion; version != 0 {
+			if version > JournalVersion {
+				return fmt.Errorf("Journal stream version %d is newer than the supported version %d", version, JournalVersion)
+			}
+			continue
+		}
+		if err := fs.ApplyJournalEntry(line.JournalEntry); err != nil {
+			return err
+		}
+	}
+}
+
+// Applies a single journal entry from a leader. Entries must be applied in sequence order.
+//
+// Parameters:
+//
+//	entry (JournalEntry) - the entry to apply
+//
+// Returns:
+//
+//	error - an error if the entry is out of order or can't be applied, or is encrypted with a
+//	        key the filesystem doesn't have
+func (fs *Filesystem) ApplyJournalEntry(entry JournalEntry) error {
+	defer fs.enter(OperationWrite, entry.Path)()
+	if fs.chrootParent != nil {
+		return ErrChrootView
+	}
+	if fs.frozen {
+		return ErrReadOnly
+	}
+	if fs.appliedSeq != 0 && entry.Seq != fs.appliedSeq+1 {
+		err := fmt.Errorf("Journal gap: expected entry %d but got %d", fs.appliedSeq+1, entry.Seq)
+		fs.log(SubsystemReplica, slog.LevelWarn, "journal entry rejected", slog.Uint64("seq", entry.Seq), slog.String("error", err.Error()))
+		return err
+	}
+	if entry.Encrypted {
+		data, err := fs.unseal(entry.Data)
+		if err != nil {
+			return fmt.Errorf("Journal entry %d: %w", entry.Seq, err)
+		}
+		entry.Data, entry.Encrypted = data, false
+	}
+	if err := fs.applyJournalOp(entry); err != nil {
+		fs.log(SubsystemReplica, slog.LevelWarn, "journal entry failed", slog.Uint64("seq", entry.Seq),
+			slog.String("op", string(entry.Op)), slog.String("path", entry.Path), slog.String("error", err.Error()))
+		return err
+	}
+	fs.log(SubsystemReplica, slog.LevelDebug, "journal entry applied", slog.Uint64("seq", entry.Seq),
+		slog.String("op", string(entry.Op)), slog.String("path", entry.Path), slog.Int("bytes", len(entry.Data)))
+	fs.appliedSeq = entry.Seq
+	// Keep our own journal too, so replicas can be chained
+	fs.record(entry)
+	return nil
+}
+
+func (fs *Filesystem) applyJournalOp(entry JournalEntry) error {
+	switch entry.Op {
+	case OpLoad:
+		return fs.loadSnapshot(bytes.NewReader(entry.Data))
+	case OpRm:
+		fs.removeAbsolute(entry.Path)
+		return nil
+	case OpChmod, OpChown:
+		// These may also change the root, so they're looked up separately
+		return fs.applyAttributeChange(entry)
+	}
+
+	pathSplit := util.SplitPath(entry.Path)
+	if len(pathSplit) == 0 {
+		return errors.New("Cannot change the root directory")
+	}
+	parentPath := util.JoinPath(pathSplit[:len(pathSplit)-1])
+	parent := util.LookupPath(fs.root, parentPath)
+	if parent == nil || !parent.IsDirectory() {
+		return fmt.Errorf("Directory not found: %s", parentPath)
+	}
+	name := pathSplit[len(pathSplit)-1]
+	file := parent.GetChildByName(name)
+
+	switch entry.Op {
+	case OpMkDir, OpMkFile, OpMkFifo, OpMkSpecial:
+		fs.unaccountTree(file)
+		file = util.NewFile(name, entry.Op == OpMkDir, parent)
+		if entry.Op == OpMkFifo {
+			file.SetKind(util.KindFifo)
+		}
+		if entry.Op == OpMkSpecial {
+			kind, ok := util.ParseFileKind(string(entry.Data))
+			if !ok || !kind.IsSpecial() {
+				return fmt.Errorf("Unknown special kind: %s", entry.Data)
+			}
+			file.SetKind(kind)
+		}
+		parent.UpsertChild(name, file)
+	case OpSymlink:
+		fs.unaccountTree(file)
+		file = util.NewSymlink(name, entry.Target, parent).File()
+		parent.UpsertChild(name, file)
+	case OpRetarget:
+		if file == nil || !file.IsSymlink() {
+			return fmt.Errorf("Symbolic link %s does not exist", entry.Path)
+		}
+		file.SetContents([]byte(entry.Target))
+	case OpMkRemote:
+		fs.unaccountTree(file)
+		file = util.NewFile(name, false, parent)
+		file.SetKind(util.KindRemote)
+		file.SetContents([]byte(entry.Target))
+		fs.attachRemote(file)
+		parent.UpsertChild(name, file)
+	case OpWrite, OpPut:
+		if file == nil && entry.Op == OpPut {
+			file = util.NewFile(name, false, parent)
+			parent.UpsertChild(name, file)
+		}
+		if file == nil || file.IsDirectory() {
+			return fmt.Errorf("File %s does not exist", entry.Path)
+		}
+		var err error
+		if entry.Op == OpWrite {
+			err = file.WriteFileData(entry.Data)
+		} else {
+			err = file.SetContents(entry.Data)
+		}
+		if err != nil {
+			return err
+		}
+	case OpMv:
+		if file == nil {
+			return fmt.Errorf("File %s does not exist", entry.Path)
+		}
+		targetSplit := util.SplitPath(entry.Target)
+		if len(targetSplit) == 0 {
+			return fmt.Errorf("Invalid target path: %s", entry.Target)
+		}
+		targetDir := util.LookupPath(fs.root, util.JoinPath(targetSplit[:len(targetSplit)-1]))
+		if targetDir == nil || !targetDir.IsDirectory() {
+			return fmt.Errorf("Target directory %s does not exist", entry.Target)
+		}
+		parent.RemoveChild(name)
+		file.SetName(targetSplit[len(targetSplit)-1])
+		file.SetParent(targetDir)
+		targetDir.UpsertChild(file.GetName(), file)
+		fs.touchMoved(file)
+	default:
+		return fmt.Errorf("Unknown journal op: %s", entry.Op)
+	}
+
+	fs.touch(file)
+	return nil
+}
+
+// Applies a chmod or chown entry
+func (fs *Filesystem) applyAttributeChange(entry JournalEntry) error {
+	file := util.LookupPath(fs.root, entry.Path)
+	if file == nil {
+		return fmt.Errorf("File %s does not exist", entry.Path)
+	}
+	if entry.Op == OpChown {
+		file.SetOwner(entry.Target)
+	} else {
+		mode, err := ParseMode(string(entry.Data))
+		if err != nil {
+			return err
+		}
+		file.SetMode(mode)
+	}
+	file.SetGeneration(fs.nextGeneration())
+	return nil
+}
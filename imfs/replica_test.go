@@ -0,0 +1,64 @@
+// replica_test.go
+package imfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFollow(t *testing.T) {
+	// Set up the leader and stream its journal
+	leader := NewFileSystem()
+	var stream bytes.Buffer
+	stop := leader.StreamJournal(&stream)
+
+	leader.MkDir("dir1")
+	leader.MkFile("file1")
+	leader.WriteFile("file1", "hello")
+	leader.MkFile("file2")
+	leader.MvFile("file2", "dir1")
+	leader.MkDir("dir2")
+	leader.Rm("dir2", false)
+	h, _ := leader.Open("file1")
+	h.Write([]byte(" world"))
+	h.Close()
+
+	replica := NewFileSystem()
+	if err := replica.Follow(&stream); err != nil {
+		t.Fatalf("Expected no errors but got %s", err.Error())
+	}
+	if !bytes.Equal(snapshotBytes(leader), snapshotBytes(replica)) {
+		t.Errorf("Expected replica to match the leader:\n%s\n%s", snapshotBytes(leader), snapshotBytes(replica))
+	}
+
+	// Replicas are read-only
+	res, err := replica.MkDir("dir3")
+	assertErrorAndEmptyResult(res, err, ErrReadOnly.Error(), t)
+
+	// Checkpoint restores are replicated too
+	leader.Checkpoint("c1")
+	leader.MkDir("dir3")
+	leader.Restore("c1")
+	replica.Follow(&stream)
+	if !bytes.Equal(snapshotBytes(leader), snapshotBytes(replica)) {
+		t.Errorf("Expected replica to match the leader:\n%s\n%s", snapshotBytes(leader), snapshotBytes(replica))
+	}
+
+	// Nothing is streamed after stopping
+	stop()
+	leader.MkDir("dir4")
+	if stream.Len() != 0 {
+		t.Errorf("Expected no entries after stopping the stream but got %s", stream.String())
+	}
+}
+
+func TestApplyJournalEntryGap(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.ApplyJournalEntry(JournalEntry{Seq: 1, Op: OpMkDir, Path: "/dir1"})
+
+	err := fs.ApplyJournalEntry(JournalEntry{Seq: 3, Op: OpMkDir, Path: "/dir2"})
+	if err == nil || err.Error() != "Journal gap: expected entry 2 but got 3" {
+		t.Errorf("Expected a journal gap error but got %s", err)
+	}
+}
@@ -0,0 +1,187 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+	"sort"
+	"strings"
+)
+
+// Updates the symbolic links pointing at oldPath, or below it, to point at newPath instead, when
+// Options.RepointLinks is set. Links are matched by the text of their target, resolved against the
+// link's directory without following other links, so links reaching the node through another link
+// are left alone. Absolute targets stay absolute and relative ones stay relative. Only links
+// inside this filesystem (or view) are updated, and each change is journaled as an OpRetarget.
+//
+// Parameters:
+//
+//	oldPath (string) - the absolute path the node was moved from
+//	newPath (string) - the absolute path it was moved to
+func (fs *Filesystem) repointLinks(oldPath string, newPath string) {
+	if !fs.opts.RepointLinks {
+		return
+	}
+	for _, file := range fs.linksTo(oldPath) {
+		link, _ := file.AsSymlink()
+		target := link.Target()
+		dir := fullPath(file.GetParent(), fs.root)
+		moved := newPath + strings.TrimPrefix(lexicalTarget(dir, target), oldPath)
+		switch {
+		case strings.HasPrefix(target, "/"):
+			target = moved
+		case strings.HasPrefix(target, "~"):
+			target = "~" + moved
+		default:
+			target = relativeTarget(dir, moved)
+		}
+		file.SetContents([]byte(target))
+		fs.touch(file)
+		fs.record(JournalEntry{Op: OpRetarget, Path: fullPath(file, fs.root), Target: target})
+	}
+}
+
+// The symbolic links of the storage, keyed by the absolute path their target leads to from the
+// root (see lexicalTarget), so moves find the links to update without walking the tree
+type linkIndex struct {
+	byTarget map[string]map[*util.File]bool
+	// The key each link is filed under
+	targets map[*util.File]string
+}
+
+// Returns the links whose target leads to p or below it, sorted by path. The storage looks them
+// up in its index, which is built on first use. Views walk their tree instead, since they resolve
+// absolute targets from their own root.
+func (fs *Filesystem) linksTo(p string) []*util.File {
+	matches := func(target string) bool {
+		return target == p || strings.HasPrefix(target, p+"/")
+	}
+	found := []*util.File{}
+	if fs.chrootParent != nil {
+		util.WalkTree(fs.root, func(file *util.File) {
+			if file.IsSymlink() && matches(fs.linkTarget(file)) {
+				found = append(found, file)
+			}
+		})
+		return found
+	}
+
+	if fs.links == nil {
+		fs.links = &linkIndex{byTarget: make(map[string]map[*util.File]bool), targets: make(map[*util.File]string)}
+		util.WalkTree(fs.root, fs.indexLink)
+	}
+	for target, links := range fs.links.byTarget {
+		if !matches(target) {
+			continue
+		}
+		for file := range links {
+			// Nodes the fixture loader or a replica replaced in place aren't torn down
+			if !fs.attached(file) {
+				fs.unindexLink(file)
+				continue
+			}
+			found = append(found, file)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return fullPath(found[i], fs.root) < fullPath(found[j], fs.root)
+	})
+	return found
+}
+
+// Returns the absolute path the target of a link leads to
+func (fs *Filesystem) linkTarget(file *util.File) string {
+	link, _ := file.AsSymlink()
+	return lexicalTarget(fullPath(file.GetParent(), fs.root), link.Target())
+}
+
+// Files a node under the path its target leads to now, if it is a link, in place of the one it
+// was filed under before
+func (fs *Filesystem) indexLink(file *util.File) {
+	fs.unindexLink(file)
+	if !file.IsSymlink() {
+		return
+	}
+	target := fs.linkTarget(file)
+	if fs.links.byTarget[target] == nil {
+		fs.links.byTarget[target] = make(map[*util.File]bool)
+	}
+	fs.links.byTarget[target][file] = true
+	fs.links.targets[file] = target
+}
+
+// Drops a node from the index, if it is in it
+func (fs *Filesystem) unindexLink(file *util.File) {
+	if fs.links == nil {
+		return
+	}
+	target, ok := fs.links.targets[file]
+	if !ok {
+		return
+	}
+	delete(fs.links.targets, file)
+	delete(fs.links.byTarget[target], file)
+	if len(fs.links.byTarget[target]) == 0 {
+		delete(fs.links.byTarget, target)
+	}
+}
+
+// Keeps the index of the storage up to date with a recorded change. A moved subtree is filed
+// again, since the relative targets of the links inside it now lead elsewhere. Removed links are
+// dropped by teardown, and replacing the whole tree builds the index again on the next move.
+func (fs *Filesystem) updateLinkIndex(entry JournalEntry) {
+	if fs.links == nil {
+		return
+	}
+	switch entry.Op {
+	case OpLoad:
+		fs.links = nil
+	case OpSymlink, OpRetarget:
+		if file := util.LookupPath(fs.root, entry.Path); file != nil {
+			fs.indexLink(file)
+		}
+	case OpMv:
+		if file := util.LookupPath(fs.root, entry.Target); file != nil {
+			util.WalkTree(file, fs.indexLink)
+		}
+	}
+}
+
+// Returns the absolute path a link target leads to from dir, handling "." and ".." by name
+func lexicalTarget(dir string, target string) string {
+	segments := util.SplitPath(target)
+	resolved := util.SplitPath(dir)
+	if strings.HasPrefix(target, "/") || (len(segments) > 0 && segments[0] == "~") {
+		resolved = []string{}
+	}
+	for i, name := range segments {
+		switch {
+		case name == "~" && i == 0:
+		case name == ".":
+		case name == "..":
+			if len(resolved) > 0 {
+				resolved = resolved[:len(resolved)-1]
+			}
+		default:
+			resolved = append(resolved, name)
+		}
+	}
+	return util.JoinPath(resolved)
+}
+
+// Returns a relative link target leading from dir to the absolute path target
+func relativeTarget(dir string, target string) string {
+	from := util.SplitPath(dir)
+	to := util.SplitPath(target)
+	common := 0
+	for common < len(from) && common < len(to) && from[common] == to[common] {
+		common++
+	}
+	segments := []string{}
+	for range from[common:] {
+		segments = append(segments, "..")
+	}
+	segments = append(segments, to[common:]...)
+	if len(segments) == 0 {
+		return "."
+	}
+	return strings.Join(segments, "/")
+}
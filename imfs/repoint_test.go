@@ -0,0 +1,125 @@
+// repoint_test.go
+package imfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRepointLinks(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystemWithOptions(Options{RepointLinks: true})
+	fs.MkDir("docs")
+	fs.MkDir("archive")
+	fs.MkDir("links")
+	fs.MkFile("~/docs/a.txt")
+	fs.Symlink("/docs/a.txt", "~/links/absolute")
+	fs.Symlink("~/docs/a.txt", "~/links/home")
+	fs.Symlink("../docs/./a.txt", "~/links/relative")
+	fs.Symlink("a.txt", "~/docs/sibling")
+	fs.Symlink("/docs/b.txt", "~/links/other")
+
+	// Links to the moved file follow it, keeping their style
+	fs.Cd("docs")
+	if _, err := fs.MvFile("a.txt", "~/archive"); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	for link, expected := range map[string]string{
+		"~/links/absolute": "/archive/a.txt",
+		"~/links/home":     "~/archive/a.txt",
+		"~/links/relative": "../archive/a.txt",
+		"~/docs/sibling":   "../archive/a.txt",
+		"~/links/other":    "/docs/b.txt",
+	} {
+		res, err := fs.Readlink(link)
+		assertMatchesAndNoErrors(res, err, expected, t)
+	}
+	res, err := fs.ReadFile("~/links/relative")
+	assertMatchesAndNoErrors(res, err, "", t)
+
+	// The updates are journaled, so replicas see them
+	replica := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertMatchesAndNoErrors(string(snapshotBytes(replica)), nil, string(snapshotBytes(fs)), t)
+
+	// Off by default, links are left dangling
+	plain := NewFileSystem()
+	plain.MkDir("archive")
+	plain.MkFile("a.txt")
+	plain.Symlink("a.txt", "link")
+	plain.MvFile("a.txt", "archive")
+	res, err = plain.Readlink("link")
+	assertMatchesAndNoErrors(res, err, "a.txt", t)
+}
+
+// Retargeted links aren't new entries: they stay listed, and their directory isn't modified
+func TestRepointLinksKeepsEntries(t *testing.T) {
+	// Set up test subject
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	created := now
+	fs := NewFileSystemWithOptions(Options{
+		RepointLinks: true,
+		ListingDelay: time.Second,
+		DirModTimes:  true,
+		Now:          func() time.Time { return now },
+	})
+	fs.MkDir("links")
+	fs.MkFile("a.txt")
+	fs.Symlink("/a.txt", "~/links/a")
+	now = now.Add(time.Minute)
+
+	if _, err := fs.Rename("a.txt", "b.txt"); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	res, err := fs.Readlink("~/links/a")
+	assertMatchesAndNoErrors(res, err, "/b.txt", t)
+	res, err = fs.Ls("links")
+	assertMatchesAndNoErrors(res, err, "a", t)
+	assertModTimes(fs, map[string]time.Time{"links": created}, t)
+
+	journal := fs.Journal()
+	last := journal[len(journal)-1]
+	if last.Op != OpRetarget || last.Path != "/links/a" || last.Target != "/b.txt" {
+		t.Errorf("Expected the link to be journaled as retargeted, got %+v", last)
+	}
+}
+
+// Links that were moved, replaced or removed since the index was built are found where they are now
+func TestRepointLinksIndex(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystemWithOptions(Options{RepointLinks: true})
+	fs.MkDir("src")
+	fs.MkDir("dst")
+	fs.MkFile("a.txt")
+	fs.MkFile("b.txt")
+	fs.Symlink("../a.txt", "~/src/relative")
+	fs.Symlink("/b.txt", "~/src/gone")
+	// The first move builds the index
+	fs.Rename("b.txt", "c.txt")
+
+	// Moving a relative link changes what it leads to
+	fs.Cd("src")
+	fs.MvFile("relative", "~/dst")
+	fs.Rm("gone", false)
+	removed := len(fs.Journal())
+	fs.Cd("~")
+	fs.Symlink("/c.txt", "~/src/new")
+	fs.Rename("a.txt", "d.txt")
+	fs.Rename("c.txt", "e.txt")
+	for link, expected := range map[string]string{
+		"~/dst/relative": "../d.txt",
+		"~/src/new":      "/e.txt",
+	} {
+		res, err := fs.Readlink(link)
+		assertMatchesAndNoErrors(res, err, expected, t)
+	}
+	for _, entry := range fs.Journal()[removed:] {
+		if entry.Op == OpRetarget && entry.Path == "/src/gone" {
+			t.Errorf("Expected the removed link to be left alone, got %+v", entry)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package imfs
+
+import (
+	"errors"
+	"sync"
+)
+
+// Returned when submitting to a scheduler that has been closed
+var ErrSchedulerClosed = errors.New("Scheduler is closed")
+
+// The priority class of an operation submitted to a Scheduler, like `ionice` classes
+type Priority int
+
+const (
+	// Short, latency-sensitive calls such as stat or readdir
+	PriorityInteractive Priority = iota
+	// Everything else
+	PriorityNormal
+	// Long-running work such as imports, which should only use spare capacity
+	PriorityBulk
+)
+
+// How many operations of each class run per scheduling round. Every class gets a turn each
+// round, so lower classes are slowed down but never starved.
+var priorityWeights = [...]int{
+	PriorityInteractive: 8,
+	PriorityNormal:      4,
+	PriorityBulk:        1,
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityInteractive:
+		return "interactive"
+	case PriorityNormal:
+		return "normal"
+	case PriorityBulk:
+		return "bulk"
+	default:
+		return "unknown"
+	}
+}
+
+// Queue metrics for a single priority class
+type QueueStats struct {
+	// Operations waiting to run
+	Depth int
+	// The most operations that have been waiting at once
+	MaxDepth int
+	// Operations that have finished running
+	Completed int
+}
+
+// Runs operations against a filesystem one at a time, in priority order, so that many clients
+// (e.g. connections to a server) can share it safely. Interactive operations are preferred, but
+// each round also runs some normal and bulk operations, so bulk imports can't starve interactive
+// calls and vice versa.
+type Scheduler struct {
+	fs     *Filesystem
+	mu     sync.Mutex
+	ready  *sync.Cond
+	queues [len(priorityWeights)][]*scheduledOp
+	stats  [len(priorityWeights)]QueueStats
+	closed bool
+	done   chan struct{}
+}
+
+type scheduledOp struct {
+	priority Priority
+	op       func(fs *Filesystem) error
+	err      error
+	done     chan struct{}
+}
+
+// Starts a scheduler for the filesystem. Once it is in use, the filesystem should only be
+// accessed through Submit. Call Close to stop it.
+func NewScheduler(fs *Filesystem) *Scheduler {
+	s := &Scheduler{fs: fs, done: make(chan struct{})}
+	s.ready = sync.NewCond(&s.mu)
+	go s.run()
+	return s
+}
+
+// Queues the operation at the given priority and waits for it to run
+//
+// Parameters:
+//
+//	priority (Priority) - the priority class of the operation
+//	op (func(*Filesystem) error) - the operation to run
+//
+// Returns:
+//
+//	error - the error returned by the operation, or ErrSchedulerClosed if the scheduler was closed
+//	        before it could run
+func (s *Scheduler) Submit(priority Priority, op func(fs *Filesystem) error) error {
+	if priority < PriorityInteractive || priority > PriorityBulk {
+		priority = PriorityNormal
+	}
+	scheduled := &scheduledOp{priority: priority, op: op, done: make(chan struct{})}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrSchedulerClosed
+	}
+	s.queues[priority] = append(s.queues[priority], scheduled)
+	stats := &s.stats[priority]
+	stats.Depth++
+	if stats.Depth > stats.MaxDepth {
+		stats.MaxDepth = stats.Depth
+	}
+	s.ready.Signal()
+	s.mu.Unlock()
+
+	<-scheduled.done
+	return scheduled.err
+}
+
+// Returns the queue metrics of every priority class
+func (s *Scheduler) Stats() map[Priority]QueueStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[Priority]QueueStats, len(s.stats))
+	for p, st := range s.stats {
+		stats[Priority(p)] = st
+	}
+	return stats
+}
+
+// Stops the scheduler once the operation currently running finishes. Operations still queued
+// fail with ErrSchedulerClosed.
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.ready.Signal()
+	s.mu.Unlock()
+	<-s.done
+}
+
+// Runs queued operations in weighted rounds until the scheduler is closed
+func (s *Scheduler) run() {
+	defer close(s.done)
+	for {
+		batch, ok := s.nextRound()
+		if !ok {
+			return
+		}
+		for _, scheduled := range batch {
+			scheduled.err = scheduled.op(s.fs)
+			s.mu.Lock()
+			s.stats[scheduled.priority].Completed++
+			s.mu.Unlock()
+			close(scheduled.done)
+		}
+	}
+}
+
+// Waits for work and takes the operations to run in the next round, up to each class's weight.
+// Returns false once the scheduler is closed.
+func (s *Scheduler) nextRound() ([]*scheduledOp, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for !s.closed && s.pending() == 0 {
+		s.ready.Wait()
+	}
+	if s.closed {
+		for p := range s.queues {
+			for _, scheduled := range s.queues[p] {
+				scheduled.err = ErrSchedulerClosed
+				close(scheduled.done)
+			}
+			s.queues[p] = nil
+			s.stats[p].Depth = 0
+		}
+		return nil, false
+	}
+
+	batch := []*scheduledOp{}
+	for p, weight := range priorityWeights {
+		n := weight
+		if n > len(s.queues[p]) {
+			n = len(s.queues[p])
+		}
+		batch = append(batch, s.queues[p][:n]...)
+		s.queues[p] = s.queues[p][n:]
+		s.stats[p].Depth -= n
+	}
+	return batch, true
+}
+
+// Returns how many operations are waiting in total
+func (s *Scheduler) pending() int {
+	total := 0
+	for _, queue := range s.queues {
+		total += len(queue)
+	}
+	return total
+}
@@ -0,0 +1,99 @@
+// scheduler_test.go
+package imfs
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	s := NewScheduler(fs)
+	defer s.Close()
+
+	// Hold the worker so we can queue up work behind it
+	started, release := make(chan struct{}), make(chan struct{})
+	go s.Submit(PriorityNormal, func(fs *Filesystem) error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	var mu sync.Mutex
+	order := []Priority{}
+	var wg sync.WaitGroup
+	submit := func(p Priority, count int) {
+		for i := 0; i < count; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.Submit(p, func(fs *Filesystem) error {
+					mu.Lock()
+					order = append(order, p)
+					mu.Unlock()
+					_, err := fs.MkDir("dir")
+					return err
+				})
+			}()
+		}
+	}
+	submit(PriorityBulk, 3)
+	submit(PriorityInteractive, 10)
+	waitForDepth(t, s, PriorityBulk, 3)
+	waitForDepth(t, s, PriorityInteractive, 10)
+
+	close(release)
+	wg.Wait()
+
+	// Interactive operations go first, but bulk operations still get a turn every round
+	expected := []Priority{}
+	for _, round := range [][2]int{{8, 1}, {2, 1}, {0, 1}} {
+		for i := 0; i < round[0]; i++ {
+			expected = append(expected, PriorityInteractive)
+		}
+		for i := 0; i < round[1]; i++ {
+			expected = append(expected, PriorityBulk)
+		}
+	}
+	if len(order) != len(expected) {
+		t.Fatalf("Expected %v but got %v", expected, order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("Expected %v but got %v", expected, order)
+		}
+	}
+
+	stats := s.Stats()
+	if stats[PriorityInteractive].Completed != 10 || stats[PriorityInteractive].MaxDepth != 10 ||
+		stats[PriorityBulk].Completed != 3 || stats[PriorityNormal].Completed != 1 {
+		t.Errorf("Unexpected queue stats: %+v", stats)
+	}
+
+	// Errors are passed back, and nothing runs once closed
+	err := s.Submit(PriorityInteractive, func(fs *Filesystem) error {
+		_, err := fs.Cd("missing")
+		return err
+	})
+	if err == nil {
+		t.Errorf("Expected the operation's error to be returned")
+	}
+	s.Close()
+	if err := s.Submit(PriorityNormal, func(fs *Filesystem) error { return nil }); err != ErrSchedulerClosed {
+		t.Errorf("Expected error: %s but got %v", ErrSchedulerClosed, err)
+	}
+}
+
+// Waits until the given number of operations are queued at the priority
+func waitForDepth(t *testing.T, s *Scheduler, p Priority, depth int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Stats()[p].Depth != depth {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d queued %s operations", depth, p)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,180 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// A file matched by Search
+type SearchResult struct {
+	// The absolute path of the file
+	Path string
+	// How well the file matches, for ranking: higher is better. Scores are only comparable
+	// within the results of one search
+	Score float64
+}
+
+// An inverted index of the words in file contents
+type contentIndex struct {
+	// How many times each word occurs in each file
+	postings map[string]map[*util.File]int
+	// The distinct words of each file, to take it out of postings when it changes
+	words map[*util.File][]string
+	// How many files were removed since detached files were last dropped
+	removals int
+}
+
+// Searches file contents for words, returning the files containing all of them, best matches
+// first. Words are runs of letters and digits, matched case-insensitively; files are ranked by
+// TF-IDF, so files using the words often, and rare words, rank higher. Ties are broken by path.
+// Pipes, special, remote and virtual files aren't searched.
+//
+// With `Options.IndexContents`, the index is built on the first search and kept up to date as
+// files change, so later searches don't read every file. Otherwise each search builds it anew.
+//
+// Parameters:
+//
+//	query (string) - the words to search for, e.g. "connection refused"
+//
+// Returns:
+//
+//	[]SearchResult - the matching files, or none if the query has no words
+func (fs *Filesystem) Search(query string) []SearchResult {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []SearchResult{}
+	}
+	storage := fs.storage()
+	index := storage.index
+	if index == nil {
+		index = newContentIndex(storage.root)
+		if fs.opts.IndexContents {
+			storage.index = index
+		}
+	}
+
+	// Files containing every term, starting from the rarest one
+	sort.Slice(terms, func(i, j int) bool { return len(index.postings[terms[i]]) < len(index.postings[terms[j]]) })
+	results := []SearchResult{}
+	for file := range index.postings[terms[0]] {
+		if !storage.attached(file) {
+			index.remove(file)
+			continue
+		}
+		if !util.IsAncestor(fs.root, file) {
+			continue
+		}
+		score := 0.0
+		for _, term := range terms {
+			count := index.postings[term][file]
+			if count == 0 {
+				score = 0
+				break
+			}
+			idf := math.Log(1 + float64(len(index.words))/float64(len(index.postings[term])))
+			score += float64(count) * idf
+		}
+		if score > 0 {
+			results = append(results, SearchResult{Path: fullPath(file, fs.root), Score: score})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Path < results[j].Path
+	})
+	return results
+}
+
+// Returns the distinct lowercase words of a query
+func searchTerms(query string) []string {
+	terms := []string{}
+	seen := map[string]bool{}
+	for _, term := range words(query) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// Splits text into lowercase runs of letters and digits
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Indexes every searchable file below root
+func newContentIndex(root *util.File) *contentIndex {
+	index := &contentIndex{postings: map[string]map[*util.File]int{}, words: map[*util.File][]string{}}
+	util.WalkTree(root, index.add)
+	return index
+}
+
+// Indexes the contents of a file, replacing what was indexed for it before
+func (index *contentIndex) add(file *util.File) {
+	index.remove(file)
+	if file.IsDirectory() || file.GetKind() != util.KindRegular || file.IsVirtual() {
+		return
+	}
+	counts := map[string]int{}
+	for _, word := range words(string(file.GetContents())) {
+		counts[word]++
+	}
+	distinct := make([]string, 0, len(counts))
+	for word, count := range counts {
+		if index.postings[word] == nil {
+			index.postings[word] = map[*util.File]int{}
+		}
+		index.postings[word][file] = count
+		distinct = append(distinct, word)
+	}
+	index.words[file] = distinct
+}
+
+// Takes a file out of the index
+func (index *contentIndex) remove(file *util.File) {
+	for _, word := range index.words[file] {
+		delete(index.postings[word], file)
+		if len(index.postings[word]) == 0 {
+			delete(index.postings, word)
+		}
+	}
+	delete(index.words, file)
+}
+
+// Keeps the index, once built, up to date with a journal entry. Only called on the storage,
+// whose journal sees the changes made through its views too. Moves need nothing, since files are
+// indexed by node; removed files are dropped by Search as it comes across them, and all at once
+// after many removals.
+func (fs *Filesystem) updateIndex(entry JournalEntry) {
+	index := fs.index
+	if index == nil {
+		return
+	}
+	switch entry.Op {
+	case OpLoad:
+		// The whole tree was replaced, so it is indexed again on the next search
+		fs.index = nil
+	case OpMkFile, OpWrite, OpPut:
+		if file := util.LookupPath(fs.root, entry.Path); file != nil {
+			index.add(file)
+		}
+	case OpRm:
+		index.removals++
+		if index.removals > len(index.words)/4 {
+			for file := range index.words {
+				if !fs.attached(file) {
+					index.remove(file)
+				}
+			}
+			index.removals = 0
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// search_test.go
+package imfs
+
+import (
+	"testing"
+)
+
+// Returns the paths of search results, in order
+func searchPaths(results []SearchResult) []string {
+	paths := []string{}
+	for _, result := range results {
+		paths = append(paths, result.Path)
+	}
+	return paths
+}
+
+func TestSearch(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		// Set up test subject
+		fs := NewFileSystemWithOptions(Options{IndexContents: indexed})
+		fs.MkDir("logs")
+		fs.Cd("logs")
+		fs.MkFile("a.log")
+		fs.WriteFile("a.log", "Connection refused, connection reset")
+		fs.MkFile("b.log")
+		fs.WriteFile("b.log", "connection ok")
+		fs.MkFile("c.log")
+		fs.WriteFile("c.log", "disk full")
+
+		// Files must contain every word, and those using them more often rank first
+		if paths := searchPaths(fs.Search("CONNECTION")); !stringSliceEqual(paths, []string{"/logs/a.log", "/logs/b.log"}) {
+			t.Errorf("Expected [/logs/a.log /logs/b.log] but got %v", paths)
+		}
+		if paths := searchPaths(fs.Search("connection refused")); !stringSliceEqual(paths, []string{"/logs/a.log"}) {
+			t.Errorf("Expected [/logs/a.log] but got %v", paths)
+		}
+		if results := fs.Search(" ,. "); len(results) != 0 {
+			t.Errorf("Expected no results for a query without words but got %v", results)
+		}
+
+		// Results follow writes, moves and removals
+		fs.WriteFile("c.log", ", connection lost")
+		fs.MkDir("~/archive")
+		fs.MvFile("b.log", "~/archive")
+		fs.Rm("a.log", false)
+		if paths := searchPaths(fs.Search("connection")); !stringSliceEqual(paths, []string{"/archive/b.log", "/logs/c.log"}) {
+			t.Errorf("Expected [/archive/b.log /logs/c.log] but got %v", paths)
+		}
+
+		// Views only find their own files
+		view, _ := fs.Chroot("~/archive")
+		if paths := searchPaths(view.Search("connection")); !stringSliceEqual(paths, []string{"/b.log"}) {
+			t.Errorf("Expected [/b.log] but got %v", paths)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+)
+
+// Makes handle reads and/or writes on matching files transfer fewer bytes than requested, so
+// callers' retry loops get exercised. Short reads return a nil error (as io.Reader allows), while
+// short writes return io.ErrShortWrite (as io.Writer requires).
+type ShortIORule struct {
+	// The glob selecting which files the rule applies to, matched like read filters
+	Pattern string
+	// OperationRead or OperationWrite; empty applies to both
+	Op Operation
+	// The most bytes transferred by a single Read or Write call. Must be positive
+	MaxBytes int
+	// The chance (between 0 and 1) that any given call is cut short, drawn from `Options.Rand`.
+	// 0 means every call is cut short
+	Probability float64
+}
+
+// Registers a rule making handle reads/writes short. When several rules match, the smallest
+// limit wins.
+//
+// Parameters:
+//
+//	rule (ShortIORule) - the rule to add
+//
+// Returns:
+//
+//	func() - removes the rule
+func (fs *Filesystem) AddShortIORule(rule ShortIORule) func() {
+	registered := &rule
+	fs.shortIORules = append(fs.shortIORules, registered)
+
+	return func() {
+		for i, r := range fs.shortIORules {
+			if r == registered {
+				fs.shortIORules = append(fs.shortIORules[:i:i], fs.shortIORules[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Returns how many of the requested bytes a single read or write on the file should transfer
+func (fs *Filesystem) shortIOLimit(file *util.File, op Operation, requested int) int {
+	limit := requested
+	for _, rule := range fs.shortIORules {
+		if rule.Op != "" && rule.Op != op {
+			continue
+		}
+		if !fs.matchesGlob(rule.Pattern, file) {
+			continue
+		}
+		if rule.Probability > 0 && fs.random().Float64() >= rule.Probability {
+			continue
+		}
+		if rule.MaxBytes > 0 && rule.MaxBytes < limit {
+			limit = rule.MaxBytes
+		}
+	}
+	return limit
+}
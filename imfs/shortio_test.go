@@ -0,0 +1,78 @@
+// shortio_test.go
+package imfs
+
+import (
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestShortIO(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkFile("file1")
+	fs.MkFile("file2")
+	remove := fs.AddShortIORule(ShortIORule{Pattern: "file1", MaxBytes: 3})
+
+	// Writes are cut short and report it
+	h, _ := fs.Open("file1")
+	n, err := h.Write([]byte("hello world"))
+	if n != 3 || err != io.ErrShortWrite {
+		t.Errorf("Expected to write 3 bytes with error: %s but wrote %d with %s", io.ErrShortWrite, n, err)
+	}
+
+	// A retry loop still gets everything through
+	data := []byte("lo world")
+	for len(data) > 0 {
+		n, _ := h.Write(data)
+		data = data[n:]
+	}
+	h.Close()
+	res, err := fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "hello world", t)
+
+	// Reads are cut short without an error
+	h, _ = fs.Open("file1")
+	buf := make([]byte, 100)
+	n, err = h.Read(buf)
+	if n != 3 || err != nil || string(buf[:n]) != "hel" {
+		t.Errorf("Expected a short read of \"hel\" but got %q with %v", buf[:n], err)
+	}
+	all, _ := io.ReadAll(h)
+	if string(all) != "lo world" {
+		t.Errorf("Expected to read the rest of the file but got %q", all)
+	}
+
+	// Other files aren't affected
+	h, _ = fs.Open("file2")
+	n, err = h.Write([]byte("hello world"))
+	if n != 11 || err != nil {
+		t.Errorf("Expected a full write but wrote %d with %v", n, err)
+	}
+
+	// Rules can be limited to one operation
+	remove()
+	fs.AddShortIORule(ShortIORule{Pattern: "file*", Op: OperationRead, MaxBytes: 1})
+	h, _ = fs.Open("file1")
+	if n, err = h.Write([]byte("!")); n != 1 || err != nil {
+		t.Errorf("Expected writes to be unaffected but wrote %d with %v", n, err)
+	}
+	if n, _ = h.Read(buf); n != 1 {
+		t.Errorf("Expected a 1 byte read but got %d", n)
+	}
+
+	// Random rules only cut some calls short
+	fs = NewFileSystemWithOptions(Options{Rand: rand.New(rand.NewSource(1))})
+	fs.MkFile("file1")
+	fs.AddShortIORule(ShortIORule{Pattern: "*", Op: OperationWrite, MaxBytes: 1, Probability: 0.5})
+	h, _ = fs.Open("file1")
+	short := 0
+	for i := 0; i < 100; i++ {
+		if n, _ := h.Write([]byte("ab")); n == 1 {
+			short++
+		}
+	}
+	if short == 0 || short == 100 {
+		t.Errorf("Expected some but not all writes to be short but got %d", short)
+	}
+}
@@ -0,0 +1,115 @@
+package imfs
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The units understood by ParseSize and used by FormatSize, in powers of 1024 like `ls -h`
+var sizeUnits = []string{"", "K", "M", "G", "T"}
+
+// Parses a size like "512", "4K", "10M" or "1.5G" into bytes. Units are powers of 1024 and may
+// be lowercase, with an optional trailing "B" ("10MB").
+//
+// Parameters:
+//
+//	s (string) - the size
+//
+// Returns:
+//
+//	int - the size in bytes, rounded down
+//	error - an error if the size is malformed, negative or too large for an int
+func ParseSize(s string) (int, error) {
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	multiplier := 1
+	for i := len(sizeUnits) - 1; i > 0; i-- {
+		if strings.HasSuffix(number, sizeUnits[i]) {
+			number = strings.TrimSuffix(number, sizeUnits[i])
+			multiplier = 1 << (10 * i)
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("Invalid size %s: expected a number with an optional K, M, G or T suffix", s)
+	}
+	// float64(math.MaxInt) rounds up to 2^63, which no longer fits
+	if value*float64(multiplier) >= float64(math.MaxInt) {
+		return 0, fmt.Errorf("Invalid size %s: too large", s)
+	}
+	return int(value * float64(multiplier)), nil
+}
+
+// Formats a size in bytes for people, like `ls -h`: "512", "4.0K", "10M" or "1.5G". Sizes below
+// 10 units keep one decimal place.
+func FormatSize(bytes int) string {
+	value := float64(bytes)
+	unit := 0
+	for value >= 1024 && unit < len(sizeUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	switch {
+	case unit == 0:
+		return strconv.Itoa(bytes)
+	case value < 10:
+		return fmt.Sprintf("%.1f%s", value, sizeUnits[unit])
+	default:
+		return fmt.Sprintf("%.0f%s", value, sizeUnits[unit])
+	}
+}
+
+// Limits matches to files of a given size, like find's -size (see FindOptions.Size). Directories
+// never match. A nil filter matches everything.
+type SizeFilter struct {
+	// 1 to match sizes above bytes, -1 below it, and 0 exactly it
+	cmp   int
+	bytes int
+}
+
+// Parses a size filter in find's -size syntax: "+10M" matches files larger than 10MiB, "-1K"
+// files smaller than 1KiB and "0" empty files. Sizes are parsed with ParseSize.
+//
+// Parameters:
+//
+//	s (string) - the filter
+//
+// Returns:
+//
+//	*SizeFilter - the filter
+//	error - an error if the size is malformed
+func ParseSizeFilter(s string) (*SizeFilter, error) {
+	filter := &SizeFilter{}
+	switch {
+	case strings.HasPrefix(s, "+"):
+		filter.cmp = 1
+	case strings.HasPrefix(s, "-"):
+		filter.cmp = -1
+	}
+	bytes, err := ParseSize(strings.TrimLeft(s, "+-"))
+	if err != nil {
+		return nil, err
+	}
+	filter.bytes = bytes
+	return filter, nil
+}
+
+// Returns true if the entry passes the filter
+func (f *SizeFilter) Matches(entry DirEntry) bool {
+	if f == nil {
+		return true
+	}
+	if entry.Type == EntryDir {
+		return false
+	}
+	switch f.cmp {
+	case 1:
+		return entry.Size > f.bytes
+	case -1:
+		return entry.Size < f.bytes
+	default:
+		return entry.Size == f.bytes
+	}
+}
@@ -0,0 +1,70 @@
+// sizes_test.go
+package imfs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseAndFormatSize(t *testing.T) {
+	parsed := map[string]int{"512": 512, "4K": 4096, "10m": 10 << 20, "1.5G": 3 << 29, "2KB": 2048, "0": 0}
+	for s, expected := range parsed {
+		size, err := ParseSize(s)
+		if err != nil || size != expected {
+			t.Errorf("Expected %s to parse as %d, got %d (%v)", s, expected, size, err)
+		}
+	}
+	for _, s := range []string{"", "M", "-1K", "10Q", "9223372036854775807", "1e30T"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("Expected an error parsing %q", s)
+		}
+	}
+
+	formatted := map[int]string{0: "0", 1023: "1023", 1024: "1.0K", 1536: "1.5K", 10 << 20: "10M", 3 << 29: "1.5G"}
+	for size, expected := range formatted {
+		assertMatchesAndNoErrors(FormatSize(size), nil, expected, t)
+	}
+}
+
+func TestSizeFilter(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.Cd("dir1")
+	for name, size := range map[string]int{"empty": 0, "small": 100, "big": 2048} {
+		fs.MkFile(name)
+		fs.WriteFile(name, strings.Repeat("x", size))
+	}
+	fs.Cd("~")
+
+	find := func(filter string) string {
+		size, err := ParseSizeFilter(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := fs.FindFrom("~", "", true, NameMatch{}, size)
+		paths := []string{}
+		for _, result := range results {
+			paths = append(paths, fmt.Sprintf("%s=%d", result.Path, result.Entry.Size))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(paths, " ")
+	}
+	// Directories never match a size
+	assertMatchesAndNoErrors(find("+1K"), nil, "dir1/big=2048", t)
+	assertMatchesAndNoErrors(find("-1K"), nil, "dir1/empty=0 dir1/small=100", t)
+	assertMatchesAndNoErrors(find("0"), nil, "dir1/empty=0", t)
+
+	// Without a filter, every name matches an empty target
+	results, err := fs.FindFrom("dir1", "", false, NameMatch{}, nil)
+	if err != nil || len(results) != 3 {
+		t.Errorf("Expected all 3 files, got %+v (%v)", results, err)
+	}
+
+	// FindStream takes the same filter
+	size, _ := ParseSizeFilter("+100")
+	matches, _, _ := fs.FindStream(FindOptions{Size: size})
+	assertMatchesAndNoErrors(fmt.Sprint(collectMatches(matches)), nil, "[/dir1/big@2]", t)
+}
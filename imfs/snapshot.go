@@ -0,0 +1,363 @@
+package imfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"io"
+	"os"
+)
+
+// Returned (wrapped, with details) when loading a snapshot that was corrupted or truncated, i.e.
+// whose checksums don't match its contents
+var ErrSnapshotIntegrity = errors.New("Snapshot failed its integrity check")
+
+// The version written into every snapshot. Bump this whenever the snapshot layout changes, and
+// register a migration from the previous version (see migrations.go).
+const SnapshotVersion int = 2
+
+// Prefix of every binary snapshot, followed by a version byte and a compression byte
+const binarySnapshotMagic string = "IMFS"
+
+// The encoding used when saving a snapshot
+type SnapshotFormat int
+
+const (
+	// Human-readable JSON
+	FormatJSON SnapshotFormat = iota
+	// Compact gob encoding behind a versioned header
+	FormatBinary
+	// Same as FormatBinary, but gzip-compressed
+	FormatBinaryGzip
+)
+
+// Compression flags stored in the binary snapshot header
+const (
+	compressionNone byte = 0
+	compressionGzip byte = 1
+)
+
+// The serialized form of a filesystem
+type snapshot struct {
+	Version int `json:"version"`
+	// Set if the contents of every entry are encrypted (see encryption.go)
+	Encrypted bool            `json:"encrypted,omitempty"`
+	Entries   []snapshotEntry `json:"entries"`
+	// The SHA-256 of every entry's metadata and content hash, in order (see snapshotChecksum).
+	// Required since version 2
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// A single file or directory within a snapshot. Parents always come before their children.
+type snapshotEntry struct {
+	Path  string `json:"path"`
+	IsDir bool   `json:"isDir"`
+	// The util.FileKind name for anything other than regular files and directories
+	Kind     string `json:"kind,omitempty"`
+	Contents []byte `json:"contents,omitempty"`
+	// Permission bits, omitted when they're the default
+	Mode  uint32 `json:"mode,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	// The SHA-256 of Contents as stored (i.e. after encryption), in hex; empty for directories
+	Hash string `json:"hash,omitempty"`
+}
+
+// Writes the entire filesystem to w in the given format. Open handles are not included, so any
+// unflushed writes are left out.
+//
+// Parameters:
+//
+//	w (io.Writer) - where to write the snapshot
+//	format (SnapshotFormat) - the encoding to use
+//
+// Returns:
+//
+//	error - an error if the format is unknown, encryption fails or writing fails
+func (fs *Filesystem) SaveSnapshot(w io.Writer, format SnapshotFormat) error {
+	snap := snapshot{Version: SnapshotVersion, Encrypted: fs.encrypted(), Entries: []snapshotEntry{}}
+	var err error
+	util.WalkTree(fs.root, func(f *util.File) {
+		// Remote files are virtual, but only their URL is stored, so they can be kept
+		if f == fs.root || (f.IsVirtual() && f.GetKind() != util.KindRemote) || err != nil {
+			return
+		}
+		contents := f.GetContents()
+		if f.GetKind() == util.KindRemote {
+			contents = []byte(f.RemoteURL())
+		}
+		if snap.Encrypted && !f.IsDirectory() {
+			contents, err = fs.seal(contents)
+		}
+		snap.Entries = append(snap.Entries, snapshotEntry{
+			Path:     f.GetFullPathName(fs.root),
+			IsDir:    f.IsDirectory(),
+			Kind:     kindName(f),
+			Contents: contents,
+			Mode:     snapshotMode(f),
+			Owner:    f.GetOwner(),
+			Hash:     contentHash(f.IsDirectory(), contents),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	snap.Checksum = snapshotChecksum(snap.Entries)
+
+	switch format {
+	case FormatJSON:
+		return json.NewEncoder(w).Encode(snap)
+	case FormatBinary, FormatBinaryGzip:
+		compression := compressionNone
+		if format == FormatBinaryGzip {
+			compression = compressionGzip
+		}
+		header := append([]byte(binarySnapshotMagic), byte(SnapshotVersion), compression)
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if compression == compressionNone {
+			return gob.NewEncoder(w).Encode(snap)
+		}
+		gz := gzip.NewWriter(w)
+		if err := gob.NewEncoder(gz).Encode(snap); err != nil {
+			return err
+		}
+		return gz.Close()
+	default:
+		return fmt.Errorf("Unknown snapshot format: %d", format)
+	}
+}
+
+// Replaces the contents of the filesystem with a snapshot previously written by SaveSnapshot.
+// The format is detected automatically. The current directory is reset to the root and open
+// handles are discarded.
+//
+// Parameters:
+//
+//	r (io.Reader) - the snapshot to load
+//
+// Returns:
+//
+//	error - an error if the snapshot is malformed, was written by a newer version, or is
+//	        encrypted with a different key
+func (fs *Filesystem) LoadSnapshot(r io.Reader) error {
+	if fs.replica {
+		return ErrReadOnly
+	}
+	if fs.chrootParent != nil {
+		return ErrChrootView
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	defer fs.enter(OperationWrite, "")()
+	if err := fs.loadSnapshot(bytes.NewReader(data)); err != nil {
+		return err
+	}
+	fs.record(JournalEntry{Op: OpLoad, Data: data})
+	return nil
+}
+
+// Replaces the tree with the given snapshot, without recording it in the journal
+func (fs *Filesystem) loadSnapshot(r io.Reader) error {
+	snap, err := decodeSnapshot(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	if snap.Version > SnapshotVersion {
+		return fmt.Errorf("Snapshot version %d is newer than the supported version %d", snap.Version, SnapshotVersion)
+	}
+	if err := migrateSnapshot(snap); err != nil {
+		return err
+	}
+	if err := verifySnapshot(snap); err != nil {
+		return err
+	}
+	if snap.Encrypted {
+		for i, entry := range snap.Entries {
+			if entry.IsDir {
+				continue
+			}
+			if snap.Entries[i].Contents, err = fs.unseal(entry.Contents); err != nil {
+				return fmt.Errorf("Invalid snapshot: %s: %s", entry.Path, err)
+			}
+		}
+	}
+
+	root, err := buildTree(newRoot(fs.opts), snap.Entries)
+	if err != nil {
+		return err
+	}
+
+	fs.attachRemoteFiles(root)
+
+	fs.SimulateCrash()
+	fs.root = root
+	fs.currentDirectory = root
+	fs.usage = nil
+	fs.links = nil
+	// Everything loaded counts as a modification
+	util.WalkTree(root, fs.touch)
+	if fs.opts.Introspection {
+		fs.mountIntrospection()
+	}
+	return nil
+}
+
+// Decodes a JSON or binary snapshot, depending on how it starts
+func decodeSnapshot(r *bufio.Reader) (*snapshot, error) {
+	snap := &snapshot{}
+
+	prefix, err := r.Peek(len(binarySnapshotMagic))
+	if err != nil || string(prefix) != binarySnapshotMagic {
+		// Not a binary snapshot, so it must be JSON
+		if err := json.NewDecoder(r).Decode(snap); err != nil {
+			return nil, snapshotDecodeError(err)
+		}
+		return snap, nil
+	}
+
+	header := make([]byte, len(binarySnapshotMagic)+2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w: truncated header", ErrSnapshotIntegrity)
+	}
+	version := int(header[len(binarySnapshotMagic)])
+	if version > SnapshotVersion {
+		return nil, fmt.Errorf("Snapshot version %d is newer than the supported version %d", version, SnapshotVersion)
+	}
+
+	var body io.Reader = r
+	switch header[len(binarySnapshotMagic)+1] {
+	case compressionNone:
+	case compressionGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, snapshotDecodeError(err)
+		}
+		defer gz.Close()
+		body = gz
+	default:
+		return nil, fmt.Errorf("Invalid snapshot: unknown compression %d", header[len(binarySnapshotMagic)+1])
+	}
+
+	if err := gob.NewDecoder(body).Decode(snap); err != nil {
+		return nil, snapshotDecodeError(err)
+	}
+	// Read to the end of the gzip stream, so its checksum and length are verified too
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return nil, snapshotDecodeError(err)
+	}
+	return snap, nil
+}
+
+// Describes an error decoding a snapshot, reporting truncated input as an integrity failure
+func snapshotDecodeError(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) || errors.Is(err, gzip.ErrChecksum) {
+		return fmt.Errorf("%w: truncated or corrupted data (%s)", ErrSnapshotIntegrity, err)
+	}
+	return fmt.Errorf("Invalid snapshot: %s", err)
+}
+
+// Returns the hex SHA-256 of stored contents, or "" for directories
+func contentHash(isDir bool, contents []byte) string {
+	if isDir {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(contents))
+}
+
+// Returns the hex SHA-256 of the entries' metadata and content hashes. Every field is length
+// prefixed, so no two different lists of entries hash the same input.
+func snapshotChecksum(entries []snapshotEntry) string {
+	h := sha256.New()
+	for _, entry := range entries {
+		for _, field := range []string{entry.Path, fmt.Sprint(entry.IsDir), entry.Kind, fmt.Sprint(entry.Mode), entry.Owner, entry.Hash} {
+			binary.Write(h, binary.BigEndian, uint64(len(field)))
+			io.WriteString(h, field)
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// Checks every entry's contents against its hash, and the entries against the snapshot's
+// checksum
+func verifySnapshot(snap *snapshot) error {
+	if snap.Checksum == "" {
+		return fmt.Errorf("%w: missing checksum", ErrSnapshotIntegrity)
+	}
+	for _, entry := range snap.Entries {
+		if entry.Hash != contentHash(entry.IsDir, entry.Contents) {
+			return fmt.Errorf("%w: contents of %s don't match their hash", ErrSnapshotIntegrity, entry.Path)
+		}
+	}
+	if snap.Checksum != snapshotChecksum(snap.Entries) {
+		return fmt.Errorf("%w: entries don't match the snapshot checksum", ErrSnapshotIntegrity)
+	}
+	return nil
+}
+
+// Returns the name of the file's kind for snapshots, which is empty for regular files and
+// directories
+func kindName(f *util.File) string {
+	if f.IsDirectory() || f.GetKind() == util.KindRegular {
+		return ""
+	}
+	return f.GetKind().String()
+}
+
+// Returns the file's permission bits for snapshots, which are 0 if they're the default
+func snapshotMode(f *util.File) uint32 {
+	defaultMode := util.DefaultFileMode
+	if f.IsDirectory() {
+		defaultMode = util.DefaultDirMode
+	}
+	if f.GetMode() == defaultMode {
+		return 0
+	}
+	return uint32(f.GetMode())
+}
+
+// Builds a new tree from a list of snapshot entries under the given empty root, returning it
+func buildTree(root *util.File, entries []snapshotEntry) (*util.File, error) {
+	for _, entry := range entries {
+		pathSplit := util.SplitPath(entry.Path)
+		if len(pathSplit) == 0 {
+			return nil, errors.New("Invalid snapshot: empty path")
+		}
+
+		parent, err := util.WalkToEndOfPath(append([]string{"~"}, pathSplit[:len(pathSplit)-1]...), root, root)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid snapshot: %s", err)
+		}
+
+		name := pathSplit[len(pathSplit)-1]
+		file := util.NewFile(name, entry.IsDir, parent)
+		if entry.Kind != "" {
+			kind, ok := util.ParseFileKind(entry.Kind)
+			if !ok {
+				return nil, fmt.Errorf("Invalid snapshot: unknown kind %s for %s", entry.Kind, entry.Path)
+			}
+			file.SetKind(kind)
+		}
+		if !entry.IsDir {
+			if err := file.SetContents(entry.Contents); err != nil {
+				return nil, err
+			}
+		}
+		if entry.Mode != 0 {
+			file.SetMode(os.FileMode(entry.Mode))
+		}
+		file.SetOwner(entry.Owner)
+		parent.UpsertChild(name, file)
+	}
+	return root, nil
+}
@@ -0,0 +1,104 @@
+// snapshot_test.go
+package imfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSaveAndLoadSnapshot(t *testing.T) {
+	for _, format := range []SnapshotFormat{FormatJSON, FormatBinary, FormatBinaryGzip} {
+		// Set up test subject
+		fs := NewFileSystem()
+		fs.MkDir("dir1")
+		fs.MkDir("dir1/dir2")
+		fs.MkFile("file1")
+		fs.WriteFile("file1", "hello world")
+		fs.Cd("dir1")
+		fs.MkFile("file2")
+
+		var buf bytes.Buffer
+		if err := fs.SaveSnapshot(&buf, format); err != nil {
+			t.Fatalf("Expected no errors but got %s", err.Error())
+		}
+
+		loaded := NewFileSystem()
+		if err := loaded.LoadSnapshot(&buf); err != nil {
+			t.Fatalf("Expected no errors but got %s", err.Error())
+		}
+
+		if !bytes.Equal(snapshotBytes(fs), snapshotBytes(loaded)) {
+			t.Errorf("Expected loaded filesystem to match the original (format=%d)", format)
+		}
+		res, err := loaded.ReadFile("file1")
+		assertMatchesAndNoErrors(res, err, "hello world", t)
+	}
+}
+
+func TestLoadSnapshotErrors(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+
+	// Snapshots from a newer version should be rejected
+	err := fs.LoadSnapshot(bytes.NewReader([]byte("IMFS\x63\x00")))
+	if err == nil || err.Error() != "Snapshot version 99 is newer than the supported version 2" {
+		t.Errorf("Expected a version error but got %s", err)
+	}
+	err = fs.LoadSnapshot(bytes.NewReader([]byte(`{"version": 99}`)))
+	if err == nil || err.Error() != "Snapshot version 99 is newer than the supported version 2" {
+		t.Errorf("Expected a version error but got %s", err)
+	}
+
+	// Entries whose parents are missing should be rejected
+	err = fs.LoadSnapshot(bytes.NewReader([]byte(`{"version": 1, "entries": [{"path": "/a/b"}]}`)))
+	if err == nil || err.Error() != "Invalid snapshot: Directory not found: a" {
+		t.Errorf("Expected an invalid snapshot error but got %s", err)
+	}
+}
+
+func TestSnapshotIntegrity(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.MkFile("file1")
+	fs.WriteFile("file1", "hello world")
+	saved := snapshotBytes(fs)
+
+	// Changed contents, changed metadata and truncated snapshots are all detected
+	corrupted := map[string][]byte{
+		"contents": bytes.Replace(saved, []byte(`"aGVsbG8gd29ybGQ="`), []byte(`"aGVsbG8gd29ybGE="`), 1),
+		"metadata": bytes.Replace(saved, []byte(`"path":"/dir1"`), []byte(`"path":"/dir2"`), 1),
+		"json":     saved[:len(saved)/2],
+	}
+	for _, format := range []SnapshotFormat{FormatBinary, FormatBinaryGzip} {
+		var buf bytes.Buffer
+		fs.SaveSnapshot(&buf, format)
+		corrupted[fmt.Sprintf("format %d", format)] = buf.Bytes()[:buf.Len()-10]
+	}
+	for name, data := range corrupted {
+		if bytes.Equal(data, saved) {
+			t.Fatalf("Expected the %s to be corrupted", name)
+		}
+		loaded := NewFileSystem()
+		if err := loaded.LoadSnapshot(bytes.NewReader(data)); !errors.Is(err, ErrSnapshotIntegrity) {
+			t.Errorf("Expected an integrity error for the corrupted %s but got %v", name, err)
+		}
+	}
+
+	// Snapshots without checksums still load
+	legacy := []byte(`{"version": 1, "entries": [{"path": "/a", "contents": "aGk="}]}`)
+	if err := fs.LoadSnapshot(bytes.NewReader(legacy)); err != nil {
+		t.Errorf("Expected no errors but got %s", err)
+	}
+	res, err := fs.ReadFile("a")
+	assertMatchesAndNoErrors(res, err, "hi", t)
+}
+
+// Returns a JSON snapshot of the filesystem for comparisons
+func snapshotBytes(fs *Filesystem) []byte {
+	var buf bytes.Buffer
+	fs.SaveSnapshot(&buf, FormatJSON)
+	return buf.Bytes()
+}
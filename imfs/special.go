@@ -0,0 +1,85 @@
+package imfs
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"math/rand"
+	"time"
+)
+
+// The kind of device-like node created by MkSpecial
+type SpecialKind int
+
+const (
+	// Like /dev/null: reads return nothing and writes are discarded
+	SpecialNull SpecialKind = iota
+	// Like /dev/zero: reads return an endless stream of zeros and writes are discarded
+	SpecialZero
+	// Like /dev/urandom: reads return endless pseudo-random data (from `Options.Rand`) and writes
+	// are discarded
+	SpecialRandom
+)
+
+var specialFileKinds = map[SpecialKind]util.FileKind{
+	SpecialNull:   util.KindNull,
+	SpecialZero:   util.KindZero,
+	SpecialRandom: util.KindRandom,
+}
+
+// Creates a device-like special node, e.g. to make "/dev/null" work for programs that expect it.
+// Since zero and random nodes never run out of data, ReadFile returns `util.MaxFileReadSize` bytes
+// from them; use a FileHandle to read exactly as much as you need.
+//
+// Parameters:
+//
+//	path (string) - where to create the node. Its parent directory must already exist
+//	kind (SpecialKind) - the kind of node to create
+//
+// Returns:
+//
+//	string - the name of the new node
+//	error - an error if the kind is unknown, the parent directory doesn't exist or the path is
+//	        already taken
+func (fs *Filesystem) MkSpecial(path string, kind SpecialKind) (string, error) {
+	defer fs.enter(OperationMkFile, path)()
+	if fs.replica {
+		return "", ErrReadOnly
+	}
+	fileKind, ok := specialFileKinds[kind]
+	if !ok {
+		return "", fmt.Errorf("Unknown special kind: %d", kind)
+	}
+
+	file, err := fs.createAt(path)
+	if err != nil {
+		return "", err
+	}
+	file.SetKind(fileKind)
+	fs.touch(file)
+	fs.record(JournalEntry{Op: OpMkSpecial, Path: file.GetFullPathName(fs.root), Data: []byte(fileKind.String())})
+
+	return file.GetName(), nil
+}
+
+// Returns the next n bytes read from a special node
+func (fs *Filesystem) readSpecial(file *util.File, n int) []byte {
+	switch file.GetKind() {
+	case util.KindZero:
+		return make([]byte, n)
+	case util.KindRandom:
+		data := make([]byte, n)
+		fs.random().Read(data)
+		return data
+	default:
+		return []byte{}
+	}
+}
+
+// Returns the source of random data for random nodes, creating one on first use if none was
+// provided in the options
+func (fs *Filesystem) random() *rand.Rand {
+	if fs.opts.Rand == nil {
+		fs.opts.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return fs.opts.Rand
+}
@@ -0,0 +1,53 @@
+// special_test.go
+package imfs
+
+import (
+	"bytes"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"math/rand"
+	"testing"
+)
+
+func TestMkSpecial(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystemWithOptions(Options{Rand: rand.New(rand.NewSource(1))})
+	fs.MkDir("dev")
+
+	res, err := fs.MkSpecial("dev/null", SpecialNull)
+	assertMatchesAndNoErrors(res, err, "null", t)
+	fs.MkSpecial("dev/zero", SpecialZero)
+	fs.MkSpecial("dev/urandom", SpecialRandom)
+
+	res, err = fs.MkSpecial("dev/other", SpecialKind(42))
+	assertErrorAndEmptyResult(res, err, "Unknown special kind: 42", t)
+
+	fs.Cd("dev")
+
+	// Writes are discarded
+	fs.WriteFile("null", "hello")
+	res, err = fs.ReadFile("null")
+	assertMatchesAndNoErrors(res, err, "", t)
+
+	// Zero reads fill the buffer with zeros, endlessly
+	h, _ := fs.Open("zero")
+	buf := []byte("xxxx")
+	for i := 0; i < 3; i++ {
+		n, err := h.Read(buf)
+		if n != 4 || err != nil || !bytes.Equal(buf, make([]byte, 4)) {
+			t.Errorf("Expected 4 zero bytes but got %v (n=%d, err=%s)", buf, n, err)
+		}
+	}
+	res, _ = fs.ReadFile("zero")
+	if len(res) != util.MaxFileReadSize {
+		t.Errorf("Expected %d bytes from ReadFile but got %d", util.MaxFileReadSize, len(res))
+	}
+
+	// Random reads come from the injected source
+	h, _ = fs.Open("urandom")
+	h.Read(buf)
+	expected := make([]byte, 4)
+	rand.New(rand.NewSource(1)).Read(expected)
+	if !bytes.Equal(buf, expected) {
+		t.Errorf("Expected random bytes %v but got %v", expected, buf)
+	}
+}
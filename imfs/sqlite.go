@@ -0,0 +1,313 @@
+package imfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The tables of a SQLite export. Every node has a row in nodes, the root included (with no
+// parent); files with contents also have a row in contents, and symbolic links one in links.
+// Contents sealed with `Options.EncryptionKey` are marked encrypted; exports written before that
+// column was added have no encrypted contents.
+var sqliteSchema = map[string]string{
+	"nodes": `CREATE TABLE nodes (
+	id INTEGER PRIMARY KEY,
+	parent INTEGER REFERENCES nodes(id),
+	name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	mode INTEGER NOT NULL,
+	owner TEXT,
+	modified TEXT
+)`,
+	"contents": `CREATE TABLE contents (
+	node INTEGER PRIMARY KEY REFERENCES nodes(id),
+	data BLOB NOT NULL,
+	encrypted INTEGER NOT NULL DEFAULT 0
+)`,
+	"links": `CREATE TABLE links (
+	node INTEGER PRIMARY KEY REFERENCES nodes(id),
+	target TEXT NOT NULL
+)`,
+}
+
+// Values of nodes.type besides the util.FileKind names of special files
+const (
+	sqliteTypeDir  = "dir"
+	sqliteTypeFile = "file"
+)
+
+// Writes the entire filesystem to w as a SQLite database, with nodes, contents and links tables
+// (see sqliteSchema), so it can be queried with any SQLite client:
+//
+//	SELECT name, length(data) FROM nodes JOIN contents ON contents.node = nodes.id
+//
+// Modification times are exported as RFC 3339 text for querying, but aren't restored by
+// ImportSQLite (as with snapshots, everything loaded counts as modified). When
+// `Options.EncryptionKey` is set, contents are stored encrypted, while names, link targets and
+// the other attributes stay readable. Open handles are not included, so any unflushed writes are
+// left out.
+//
+// Parameters:
+//
+//	w (io.Writer) - where to write the database
+//
+// Returns:
+//
+//	error - an error if encryption or writing fails
+func (fs *Filesystem) ExportSQLite(w io.Writer) error {
+	nodes := &util.SQLiteTable{Name: "nodes", Schema: sqliteSchema["nodes"]}
+	contents := &util.SQLiteTable{Name: "contents", Schema: sqliteSchema["contents"]}
+	links := &util.SQLiteTable{Name: "links", Schema: sqliteSchema["links"]}
+
+	ids := make(map[*util.File]int64)
+	var err error
+	util.WalkTree(fs.root, func(f *util.File) {
+		var parent any
+		if f != fs.root {
+			id, ok := ids[f.GetParent()]
+			if !ok {
+				return
+			}
+			parent = id
+		}
+		if f.IsVirtual() {
+			return
+		}
+		id := int64(len(ids) + 1)
+		ids[f] = id
+		var owner any
+		if f.GetOwner() != "" {
+			owner = f.GetOwner()
+		}
+		nodes.Rows = append(nodes.Rows, util.SQLiteRow{ID: id, Values: []any{
+			nil, parent, f.GetName(), sqliteType(f), int64(f.GetMode()), owner,
+			f.GetModTime().UTC().Format(time.RFC3339Nano),
+		}})
+
+		switch {
+		case f.IsDirectory():
+		case f.GetKind() == util.KindSymlink:
+			links.Rows = append(links.Rows, util.SQLiteRow{ID: id, Values: []any{nil, string(f.GetContents())}})
+		case len(f.GetContents()) > 0 && err == nil:
+			data, encrypted := f.GetContents(), int64(0)
+			if fs.encrypted() {
+				data, err = fs.seal(data)
+				encrypted = 1
+			}
+			contents.Rows = append(contents.Rows, util.SQLiteRow{ID: id, Values: []any{nil, data, encrypted}})
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return util.WriteSQLite(w, []*util.SQLiteTable{nodes, contents, links})
+}
+
+// Replaces the contents of the filesystem with a SQLite database previously written by
+// ExportSQLite, possibly modified since with a SQLite client. The root's mode and owner are
+// ignored. The current directory is reset to the root and open handles are discarded, as with
+// LoadSnapshot.
+//
+// Parameters:
+//
+//	r (io.Reader) - the database to load
+//
+// Returns:
+//
+//	error - an error if the database is malformed, its tables don't describe a valid tree, or it
+//	        has encrypted contents and the filesystem doesn't have the key they were sealed with
+func (fs *Filesystem) ImportSQLite(r io.Reader) error {
+	if fs.replica {
+		return ErrReadOnly
+	}
+	if fs.chrootParent != nil {
+		return ErrChrootView
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	tables, err := util.ReadSQLite(data)
+	if err != nil {
+		return fmt.Errorf("Invalid SQLite export: %s", err)
+	}
+	entries, err := sqliteEntries(tables, fs.unseal)
+	if err != nil {
+		return fmt.Errorf("Invalid SQLite export: %w", err)
+	}
+
+	// Load it as a snapshot, so the journal can replay it like any other load
+	snap := snapshot{Version: SnapshotVersion, Entries: entries, Checksum: snapshotChecksum(entries)}
+	encoded, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return fs.LoadSnapshot(bytes.NewReader(encoded))
+}
+
+// Returns the nodes.type of a file
+func sqliteType(f *util.File) string {
+	if f.IsDirectory() {
+		return sqliteTypeDir
+	}
+	if f.GetKind() == util.KindRegular {
+		return sqliteTypeFile
+	}
+	return f.GetKind().String()
+}
+
+// A row of the nodes table
+type sqliteNode struct {
+	parent    int64
+	hasParent bool
+	name      string
+	kind      string
+	mode      int64
+	owner     string
+}
+
+// Converts the tables of a SQLite export into snapshot entries, parents first, decrypting
+// encrypted contents with unseal
+func sqliteEntries(tables map[string]*util.SQLiteTable, unseal func([]byte) ([]byte, error)) ([]snapshotEntry, error) {
+	for name := range sqliteSchema {
+		if tables[name] == nil {
+			return nil, fmt.Errorf("missing table %s", name)
+		}
+	}
+
+	nodes := make(map[int64]*sqliteNode)
+	var root int64
+	roots := 0
+	for _, row := range tables["nodes"].Rows {
+		if len(row.Values) < 6 {
+			return nil, fmt.Errorf("node %d has too few columns", row.ID)
+		}
+		node := &sqliteNode{}
+		var ok bool
+		node.parent, node.hasParent = row.Values[1].(int64)
+		if node.name, ok = row.Values[2].(string); !ok {
+			return nil, fmt.Errorf("node %d has no name", row.ID)
+		}
+		if node.kind, ok = row.Values[3].(string); !ok {
+			return nil, fmt.Errorf("node %d has no type", row.ID)
+		}
+		if node.mode, ok = row.Values[4].(int64); !ok {
+			return nil, fmt.Errorf("node %d has no mode", row.ID)
+		}
+		node.owner, _ = row.Values[5].(string)
+		if !node.hasParent {
+			root = row.ID
+			roots++
+		} else if node.name == "" || node.name == "." || node.name == ".." || strings.Contains(node.name, "/") {
+			return nil, fmt.Errorf("node %d has invalid name %q", row.ID, node.name)
+		}
+		nodes[row.ID] = node
+	}
+	if roots != 1 {
+		return nil, fmt.Errorf("expected exactly one root node, found %d", roots)
+	}
+	if nodes[root].kind != sqliteTypeDir {
+		return nil, errors.New("the root node is not a directory")
+	}
+
+	// Resolve every node's path by walking up to the root, rejecting dangling parents and cycles
+	paths := map[int64]string{root: ""}
+	var resolve func(id int64, depth int) (string, error)
+	resolve = func(id int64, depth int) (string, error) {
+		if path, ok := paths[id]; ok {
+			return path, nil
+		}
+		node := nodes[id]
+		if node == nil {
+			return "", fmt.Errorf("missing parent node %d", id)
+		}
+		if depth > len(nodes) {
+			return "", fmt.Errorf("node %d is its own ancestor", id)
+		}
+		parent := nodes[node.parent]
+		if parent != nil && parent.kind != sqliteTypeDir {
+			return "", fmt.Errorf("the parent of node %d is not a directory", id)
+		}
+		parentPath, err := resolve(node.parent, depth+1)
+		if err != nil {
+			return "", err
+		}
+		paths[id] = parentPath + "/" + node.name
+		return paths[id], nil
+	}
+
+	fileContents := make(map[int64][]byte)
+	for _, row := range tables["contents"].Rows {
+		if len(row.Values) < 2 {
+			return nil, fmt.Errorf("contents of node %d have too few columns", row.ID)
+		}
+		switch data := row.Values[1].(type) {
+		case []byte:
+			fileContents[row.ID] = data
+		case string:
+			fileContents[row.ID] = []byte(data)
+		}
+		if len(row.Values) > 2 && row.Values[2] != nil && row.Values[2] != int64(0) {
+			data, err := unseal(fileContents[row.ID])
+			if err != nil {
+				return nil, fmt.Errorf("contents of node %d: %w", row.ID, err)
+			}
+			fileContents[row.ID] = data
+		}
+	}
+	for _, row := range tables["links"].Rows {
+		if len(row.Values) < 2 {
+			return nil, fmt.Errorf("link of node %d has too few columns", row.ID)
+		}
+		target, _ := row.Values[1].(string)
+		fileContents[row.ID] = []byte(target)
+	}
+
+	entries := []snapshotEntry{}
+	seen := make(map[string]bool)
+	for id, node := range nodes {
+		if id == root {
+			continue
+		}
+		path, err := resolve(id, 0)
+		if err != nil {
+			return nil, err
+		}
+		if seen[path] {
+			return nil, fmt.Errorf("more than one node at %s", path)
+		}
+		seen[path] = true
+		entry := snapshotEntry{Path: path, IsDir: node.kind == sqliteTypeDir, Owner: node.owner}
+		switch node.kind {
+		case sqliteTypeDir:
+		case sqliteTypeFile:
+			entry.Contents = fileContents[id]
+		default:
+			if _, ok := util.ParseFileKind(node.kind); !ok || node.kind == util.KindRegular.String() {
+				return nil, fmt.Errorf("node %d has unknown type %s", id, node.kind)
+			}
+			entry.Kind = node.kind
+			entry.Contents = fileContents[id]
+		}
+		defaultMode := util.DefaultFileMode
+		if entry.IsDir {
+			defaultMode = util.DefaultDirMode
+		}
+		if uint32(node.mode) != uint32(defaultMode) {
+			entry.Mode = uint32(node.mode)
+		}
+		entry.Hash = contentHash(entry.IsDir, entry.Contents)
+		entries = append(entries, entry)
+	}
+	// Parents come before their children, since a path sorts after its prefixes
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
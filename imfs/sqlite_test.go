@@ -0,0 +1,130 @@
+// sqlite_test.go
+package imfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"strings"
+	"testing"
+)
+
+func TestExportAndImportSQLite(t *testing.T) {
+	// Set up test subject: enough entries and a large enough file to need interior and overflow
+	// pages
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.MkFile("big")
+	fs.WriteFile("big", strings.Repeat("0123456789", 10000))
+	fs.Symlink("big", "link")
+	fs.Cd("dir1")
+	for i := 0; i < 500; i++ {
+		fs.MkFile(fmt.Sprintf("file-%03d", i))
+	}
+	fs.WriteFile("file-007", "hello world")
+	fs.Chmod("file-007", 0600, false)
+
+	var buf bytes.Buffer
+	if err := fs.ExportSQLite(&buf); err != nil {
+		t.Fatalf("Expected no errors but got %s", err.Error())
+	}
+	if !strings.HasPrefix(buf.String(), "SQLite format 3\x00") || buf.Len()%4096 != 0 {
+		t.Fatalf("Expected a SQLite database made of 4096 byte pages")
+	}
+
+	// The tables hold one row per node, and contents and link targets by node
+	tables, err := util.ReadSQLite(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Expected no errors but got %s", err.Error())
+	}
+	if nodes := len(tables["nodes"].Rows); nodes != 504 {
+		t.Errorf("Expected 504 nodes but got %d", nodes)
+	}
+	if links := tables["links"].Rows; len(links) != 1 || links[0].Values[1] != "big" {
+		t.Errorf("Expected one link to big but got %v", links)
+	}
+
+	loaded := NewFileSystem()
+	if err := loaded.ImportSQLite(&buf); err != nil {
+		t.Fatalf("Expected no errors but got %s", err.Error())
+	}
+	if !bytes.Equal(snapshotBytes(fs), snapshotBytes(loaded)) {
+		t.Errorf("Expected the imported filesystem to match the original")
+	}
+	loaded.Cd("dir1")
+	res, err := loaded.ReadFile("file-007")
+	assertMatchesAndNoErrors(res, err, "hello world", t)
+}
+
+func TestExportSQLiteEncrypted(t *testing.T) {
+	// Set up test subject
+	key := bytes.Repeat([]byte{7}, 32)
+	fs := NewFileSystemWithOptions(Options{EncryptionKey: key})
+	fs.MkFile("secret.env")
+	fs.WriteFile("secret.env", "PASSWORD=hunter2")
+
+	var buf bytes.Buffer
+	if err := fs.ExportSQLite(&buf); err != nil {
+		t.Fatalf("Expected no errors but got %s", err.Error())
+	}
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("Expected the contents to be encrypted")
+	}
+	tables, _ := util.ReadSQLite(buf.Bytes())
+	if rows := tables["contents"].Rows; len(rows) != 1 || rows[0].Values[2] != int64(1) {
+		t.Errorf("Expected one row marked encrypted but got %v", rows)
+	}
+
+	// Importing needs the key
+	err := NewFileSystem().ImportSQLite(bytes.NewReader(buf.Bytes()))
+	if !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("Expected error: %s but got %v", ErrNoEncryptionKey, err)
+	}
+	loaded := NewFileSystemWithOptions(Options{EncryptionKey: key})
+	if err := loaded.ImportSQLite(&buf); err != nil {
+		t.Fatalf("Expected no errors but got %s", err.Error())
+	}
+	res, err := loaded.ReadFile("secret.env")
+	assertMatchesAndNoErrors(res, err, "PASSWORD=hunter2", t)
+}
+
+func TestImportSQLiteErrors(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkFile("file1")
+	nodeSchema, contentsSchema, linksSchema := sqliteSchema["nodes"], sqliteSchema["contents"], sqliteSchema["links"]
+	export := func(nodes ...util.SQLiteRow) *bytes.Buffer {
+		var buf bytes.Buffer
+		util.WriteSQLite(&buf, []*util.SQLiteTable{
+			{Name: "nodes", Schema: nodeSchema, Rows: nodes},
+			{Name: "contents", Schema: contentsSchema},
+			{Name: "links", Schema: linksSchema},
+		})
+		return &buf
+	}
+	node := func(id int64, parent any, name string, kind string) util.SQLiteRow {
+		return util.SQLiteRow{ID: id, Values: []any{nil, parent, name, kind, int64(0755), nil, nil}}
+	}
+
+	tests := []struct {
+		data     *bytes.Buffer
+		expected string
+	}{
+		{bytes.NewBufferString("not a database"), "Invalid SQLite export: Not a SQLite database"},
+		{export(node(1, nil, "/", "dir"), node(2, nil, "/", "dir")), "Invalid SQLite export: expected exactly one root node, found 2"},
+		{export(node(1, nil, "/", "dir"), node(2, int64(3), "a", "dir")), "Invalid SQLite export: missing parent node 3"},
+		{export(node(1, nil, "/", "dir"), node(2, int64(1), "a", "dir"), node(3, int64(1), "a", "file")), "Invalid SQLite export: more than one node at /a"},
+		{export(node(1, nil, "/", "dir"), node(2, int64(1), "a", "socket")), "Invalid SQLite export: node 2 has unknown type socket"},
+	}
+	for _, test := range tests {
+		err := fs.ImportSQLite(test.data)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("Expected %q but got %v", test.expected, err)
+		}
+	}
+
+	// Failed imports leave the filesystem alone
+	res, err := fs.Ls()
+	assertMatchesAndNoErrors(res, err, "file1", t)
+}
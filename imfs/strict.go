@@ -0,0 +1,111 @@
+package imfs
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+)
+
+// The value panicked with when `Options.Strict` is set and the filesystem is misused
+type MisuseError struct {
+	Op   Operation
+	Path string
+	// What was wrong
+	Reason string
+	// The current directory and generation when the misuse was detected
+	Cwd        string
+	Generation uint64
+}
+
+func (e *MisuseError) Error() string {
+	return fmt.Sprintf("Filesystem misuse during %s of %s: %s (cwd=%s, generation=%d)",
+		e.Op, e.Path, e.Reason, e.Cwd, e.Generation)
+}
+
+// Panics with a MisuseError in strict mode, and does nothing otherwise
+func (fs *Filesystem) misuse(op Operation, path string, format string, args ...any) {
+	if !fs.opts.Strict {
+		return
+	}
+	panic(&MisuseError{
+		Op:         op,
+		Path:       path,
+		Reason:     fmt.Sprintf(format, args...),
+		Cwd:        fs.Pwd(),
+		Generation: fs.storage().generation,
+	})
+}
+
+// Marks the filesystem as busy for the duration of an operation, so that in strict mode an
+// operation starting on another goroutine before it finishes is detected. Returns the function
+// ending the operation. While autosave is enabled, the operation also holds off the background
+// save (see autosave.go), so every public method changing the tree must go through here, either
+// directly or through runHooks. Operations may be nested on the goroutine running them, e.g.
+// Apply running each change: the filesystem is marked with that goroutine, and only the outermost
+// operation clears the mark.
+func (fs *Filesystem) enter(op Operation, path string) func() {
+	if !fs.opts.Strict {
+		return fs.lockAutosave()
+	}
+	id := goroutineID()
+	if atomic.LoadInt64(&fs.busy) == id {
+		return fs.lockAutosave()
+	}
+	if !atomic.CompareAndSwapInt64(&fs.busy, 0, id) {
+		fs.misuse(op, path, "concurrent use detected; the filesystem is not safe for concurrent use")
+	}
+	unlock := fs.lockAutosave()
+	return func() {
+		unlock()
+		atomic.StoreInt64(&fs.busy, 0)
+	}
+}
+
+// Returns the ID of the calling goroutine, as printed at the top of its stack trace. Go doesn't
+// expose it otherwise; this is only used in strict mode, where the cost doesn't matter.
+func goroutineID() int64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	fields := bytes.Fields(bytes.TrimPrefix(buf, []byte("goroutine ")))
+	id, _ := strconv.ParseInt(string(fields[0]), 10, 64)
+	return id
+}
+
+// Runs a read or write through the handle, marking the filesystem as busy while it runs. Writes
+// queued in write-behind mode and changes to write back that are due are applied first.
+func (h *FileHandle) guarded(op Operation, f func() (int, error)) (int, error) {
+	defer h.fs.enter(op, h.file.GetFullPathName(h.fs.root))()
+	h.fs.applyDueWrites()
+	h.fs.storage().applyDueWriteBacks()
+	return f()
+}
+
+// Returns true if the file is still part of the tree. Removed files keep their parent pointer, so
+// we also check every parent still has them as a child.
+func (fs *Filesystem) attached(file *util.File) bool {
+	for file != fs.root {
+		parent := file.GetParent()
+		if parent == nil || parent.GetChildByName(file.GetName()) != file {
+			return false
+		}
+		file = parent
+	}
+	return true
+}
+
+// Checks a handle is still usable before reading or writing through it
+func (h *FileHandle) checkUsable(op Operation) {
+	if !h.fs.opts.Strict {
+		return
+	}
+	path := h.file.GetFullPathName(h.fs.root)
+	if h.closed {
+		h.fs.misuse(op, path, "handle used after it was closed")
+	}
+	if !h.fs.attached(h.file) {
+		h.fs.misuse(op, path, "file was removed while a handle to it was still in use")
+	}
+}
@@ -0,0 +1,114 @@
+// strict_test.go
+package imfs
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Runs f and returns the MisuseError it panicked with, if any
+func recoverMisuse(f func()) (misuse *MisuseError) {
+	defer func() {
+		if r := recover(); r != nil {
+			misuse = r.(*MisuseError)
+		}
+	}()
+	f()
+	return nil
+}
+
+func TestStrictMode(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystemWithOptions(Options{Strict: true})
+	fs.MkDir("dir1")
+	fs.MkFile("file1")
+
+	// Writing to a directory
+	misuse := recoverMisuse(func() { fs.WriteFile("dir1", "hello") })
+	if misuse == nil || misuse.Op != OperationWrite || misuse.Path != "dir1" || misuse.Cwd != "/" {
+		t.Errorf("Expected a misuse panic writing to a directory but got %v", misuse)
+	}
+
+	// Using a handle after its file was removed
+	h, _ := fs.Open("file1")
+	fs.Rm("file1", false)
+	misuse = recoverMisuse(func() { h.Write([]byte("hello")) })
+	if misuse == nil || !strings.Contains(misuse.Error(), "removed") {
+		t.Errorf("Expected a misuse panic writing to a removed file but got %v", misuse)
+	}
+
+	// Using a handle after it was closed
+	fs.MkFile("file1")
+	h, _ = fs.Open("file1")
+	h.Close()
+	misuse = recoverMisuse(func() { h.Read(make([]byte, 1)) })
+	if misuse == nil || !strings.Contains(misuse.Error(), "closed") {
+		t.Errorf("Expected a misuse panic reading from a closed handle but got %v", misuse)
+	}
+
+	// An operation starting while another is running. Simulated by marking the filesystem busy
+	// with a goroutine that doesn't exist (see TestStrictConcurrentOperation for a real one)
+	atomic.StoreInt64(&fs.busy, -1)
+	misuse = recoverMisuse(func() { fs.MkFile("file2") })
+	if misuse == nil || !strings.Contains(misuse.Error(), "concurrent") {
+		t.Errorf("Expected a misuse panic for concurrent use but got %v", misuse)
+	}
+	atomic.StoreInt64(&fs.busy, 0)
+
+	// Correct use doesn't panic
+	misuse = recoverMisuse(func() {
+		h, _ = fs.Open("file1")
+		h.Write([]byte("hello"))
+		h.Close()
+		fs.ReadFile("file1")
+	})
+	if misuse != nil {
+		t.Errorf("Expected no panic but got %v", misuse)
+	}
+
+	// Without strict mode misuse doesn't panic
+	fs = NewFileSystem()
+	fs.MkFile("file1")
+	h, _ = fs.Open("file1")
+	h.Close()
+	if _, err := h.Write([]byte("hello")); err != ErrClosed {
+		t.Errorf("Expected error: %s but got %v", ErrClosed, err)
+	}
+}
+
+// An operation started on another goroutine while one is blocked running is detected, while the
+// operations Apply runs itself are not
+func TestStrictConcurrentOperation(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystemWithOptions(Options{Strict: true})
+	started, release, done := make(chan bool), make(chan bool), make(chan bool)
+	fs.RegisterVirtualFile("slow", func() []byte {
+		started <- true
+		<-release
+		return []byte("done")
+	})
+
+	go func() {
+		fs.ReadFile("slow")
+		done <- true
+	}()
+	<-started
+	misuse := recoverMisuse(func() { fs.MkFile("file1") })
+	if misuse == nil || !strings.Contains(misuse.Error(), "concurrent") {
+		t.Errorf("Expected a misuse panic for concurrent use but got %v", misuse)
+	}
+	close(release)
+	<-done
+
+	misuse = recoverMisuse(func() {
+		if err := fs.Apply([]Op{{Op: OperationMkDir, Path: "dir1"}, {Op: OperationWrite, Path: "~/dir1/a.txt", Data: "hello"}}); err != nil {
+			t.Errorf("Expected no errors but got %s", err)
+		}
+	})
+	if misuse != nil {
+		t.Errorf("Expected no panic applying changes but got %v", misuse)
+	}
+	res, err := fs.ReadFile("~/dir1/a.txt")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+}
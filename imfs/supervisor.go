@@ -0,0 +1,194 @@
+package imfs
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Creates and keeps track of namespaces: independent filesystems that share nothing with each
+// other, e.g. one per parallel test in a test binary. Namespaces can be used from different
+// goroutines at the same time (each from one goroutine at a time), and the supervisor can be used
+// from any goroutine.
+type Supervisor struct {
+	mu sync.Mutex
+	// The most bytes all namespaces together may use (see DiskUsage), or 0 for unlimited
+	memoryLimit int
+	namespaces  map[string]*namespace
+}
+
+type namespace struct {
+	fs *Filesystem
+	// The bytes used by the namespace as of its last modification
+	used int
+}
+
+// The usage of a single namespace
+type NamespaceStats struct {
+	Name string
+	// Bytes used by contents and metadata (see DiskUsage)
+	Used int
+}
+
+// Creates a supervisor with no namespaces
+//
+// Parameters:
+//
+//	memoryLimit (int) - the most bytes all namespaces together may use, or 0 for unlimited. Once
+//	                    it is reached, new entries and writes in any namespace fail with ErrNoSpace
+func NewSupervisor(memoryLimit int) *Supervisor {
+	return &Supervisor{memoryLimit: memoryLimit, namespaces: make(map[string]*namespace)}
+}
+
+// Creates a new, empty namespace
+//
+// Parameters:
+//
+//	name (string) - the name of the namespace
+//	opts (Options) - the options of its filesystem. Options.Capacity still applies on top of the
+//	                 supervisor's memory limit
+//
+// Returns:
+//
+//	*Filesystem - the namespace
+//	error - an error if a namespace with that name already exists
+func (s *Supervisor) Create(name string, opts Options) (*Filesystem, error) {
+	return s.add(name, NewFileSystemWithOptions(opts))
+}
+
+// Creates a new namespace with a copy of everything in an existing one. The copy shares nothing
+// with the original. The original must not be in use by another goroutine while it is copied.
+//
+// Parameters:
+//
+//	source (string) - the name of the namespace to copy
+//	name (string) - the name of the new namespace
+//
+// Returns:
+//
+//	*Filesystem - the new namespace
+//	error - an error if the source doesn't exist, the name is taken or the copy doesn't fit
+//	        within the memory limit
+func (s *Supervisor) Clone(source string, name string) (*Filesystem, error) {
+	original := s.Get(source)
+	if original == nil {
+		return nil, fmt.Errorf("Namespace %s does not exist", source)
+	}
+
+	var buf bytes.Buffer
+	if err := original.SaveSnapshot(&buf, FormatBinary); err != nil {
+		return nil, err
+	}
+	copied := NewFileSystemWithOptions(original.opts)
+	if err := copied.loadSnapshot(&buf); err != nil {
+		return nil, err
+	}
+	if s.memoryLimit > 0 && s.TotalUsed()+copied.DiskUsage().Used > s.memoryLimit {
+		return nil, ErrNoSpace
+	}
+	return s.add(name, copied)
+}
+
+func (s *Supervisor) add(name string, fs *Filesystem) (*Filesystem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.namespaces[name] != nil {
+		return nil, fmt.Errorf("Namespace %s already exists", name)
+	}
+	fs.supervisor = s
+	s.namespaces[name] = &namespace{fs: fs, used: fs.DiskUsage().Used}
+	return fs, nil
+}
+
+// Returns the namespace with the given name, or nil if there is none
+func (s *Supervisor) Get(name string) *Filesystem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ns := s.namespaces[name]; ns != nil {
+		return ns.fs
+	}
+	return nil
+}
+
+// Returns the name and usage of every namespace, sorted by name
+func (s *Supervisor) Namespaces() []NamespaceStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]NamespaceStats, 0, len(s.namespaces))
+	for name, ns := range s.namespaces {
+		stats = append(stats, NamespaceStats{Name: name, Used: ns.used})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// Returns the bytes used by all namespaces together
+func (s *Supervisor) TotalUsed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	for _, ns := range s.namespaces {
+		total += ns.used
+	}
+	return total
+}
+
+// Destroys a namespace, freeing its share of the memory limit. Its open handles are closed
+// without being flushed, so it must no longer be in use, and it should not be used afterwards.
+//
+// Parameters:
+//
+//	name (string) - the name of the namespace to destroy
+//
+// Returns:
+//
+//	error - an error if the namespace doesn't exist
+func (s *Supervisor) Destroy(name string) error {
+	s.mu.Lock()
+	ns := s.namespaces[name]
+	delete(s.namespaces, name)
+	s.mu.Unlock()
+
+	if ns == nil {
+		return fmt.Errorf("Namespace %s does not exist", name)
+	}
+	ns.fs.SimulateCrash()
+	return nil
+}
+
+// Records how many bytes the namespace uses now. Called by the namespace after every
+// modification, from the goroutine using it.
+func (s *Supervisor) report(fs *Filesystem) {
+	used := fs.DiskUsage().Used
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ns := range s.namespaces {
+		if ns.fs == fs {
+			ns.used = used
+		}
+	}
+}
+
+// Returns how many more bytes the namespace may use within the memory limit
+func (s *Supervisor) spaceLeft(fs *Filesystem) int {
+	used := fs.DiskUsage().Used
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	others := 0
+	for _, ns := range s.namespaces {
+		if ns.fs != fs {
+			others += ns.used
+		}
+	}
+	if left := s.memoryLimit - others - used; left > 0 {
+		return left
+	}
+	return 0
+}
@@ -0,0 +1,118 @@
+// supervisor_test.go
+package imfs
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSupervisor(t *testing.T) {
+	s := NewSupervisor(0)
+	a, err := s.Create("a", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Create("b", Options{})
+	_, err = s.Create("a", Options{})
+	assertErrorAndEmptyResult("", err, "Namespace a already exists", t)
+
+	a.MkFile("x.txt")
+	a.WriteFile("x.txt", "hello")
+	if s.Get("a") != a || s.Get("missing") != nil {
+		t.Errorf("Expected Get to return the namespace by name")
+	}
+
+	stats := s.Namespaces()
+	expected := []NamespaceStats{{"a", a.DiskUsage().Used}, {"b", s.Get("b").DiskUsage().Used}}
+	if len(stats) != 2 || stats[0] != expected[0] || stats[1] != expected[1] {
+		t.Errorf("Expected %v, got %v", expected, stats)
+	}
+	if s.TotalUsed() != expected[0].Used+expected[1].Used {
+		t.Errorf("Expected the total to add up, got %d", s.TotalUsed())
+	}
+
+	assertMatchesAndNoErrors("", s.Destroy("b"), "", t)
+	assertErrorAndEmptyResult("", s.Destroy("b"), "Namespace b does not exist", t)
+	if len(s.Namespaces()) != 1 {
+		t.Errorf("Expected one namespace left, got %v", s.Namespaces())
+	}
+}
+
+func TestSupervisorClone(t *testing.T) {
+	s := NewSupervisor(0)
+	a, _ := s.Create("a", Options{})
+	a.MkFile("x.txt")
+	a.WriteFile("x.txt", "hello")
+
+	b, err := s.Clone("a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := b.ReadFile("x.txt")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+
+	// The copy is independent of the original
+	b.WriteFile("x.txt", " world")
+	res, err = a.ReadFile("x.txt")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+
+	_, err = s.Clone("missing", "c")
+	assertErrorAndEmptyResult("", err, "Namespace missing does not exist", t)
+	_, err = s.Clone("a", "b")
+	assertErrorAndEmptyResult("", err, "Namespace b already exists", t)
+}
+
+func TestSupervisorMemoryLimit(t *testing.T) {
+	s := NewSupervisor(600)
+	a, _ := s.Create("a", Options{})
+	b, _ := s.Create("b", Options{})
+
+	a.MkFile("x.txt")
+	a.WriteFile("x.txt", string(make([]byte, 200)))
+	b.MkFile("y.txt")
+	// Only what's left of the shared limit fits
+	res, err := b.WriteFile("y.txt", string(make([]byte, 200)))
+	if err != ErrNoSpace {
+		t.Errorf("Expected ErrNoSpace, got %s, %v", res, err)
+	}
+	if s.TotalUsed() != 600 {
+		t.Errorf("Expected all 600 bytes to be used, got %d", s.TotalUsed())
+	}
+	_, err = s.Clone("a", "c")
+	if err != ErrNoSpace {
+		t.Errorf("Expected ErrNoSpace, got %v", err)
+	}
+
+	// Destroying a namespace frees its share
+	s.Destroy("a")
+	b.Rm("y.txt", false)
+	b.MkFile("y.txt")
+	_, err = b.WriteFile("y.txt", string(make([]byte, 200)))
+	assertMatchesAndNoErrors("", err, "", t)
+}
+
+func TestSupervisorParallel(t *testing.T) {
+	s := NewSupervisor(1 << 20)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fs, err := s.Create(fmt.Sprintf("ns%d", i), Options{})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for j := 0; j < 20; j++ {
+				fs.MkFile(fmt.Sprintf("f%d", j))
+				fs.WriteFile(fmt.Sprintf("f%d", j), "data")
+			}
+			s.Namespaces()
+		}(i)
+	}
+	wg.Wait()
+	if len(s.Namespaces()) != 8 {
+		t.Errorf("Expected 8 namespaces, got %v", s.Namespaces())
+	}
+}
@@ -0,0 +1,64 @@
+package imfs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwent/in-memory-fs/internal/util"
+)
+
+// Creates a symbolic link at path pointing at target. The target is stored as given and doesn't
+// have to exist. Links are listed by Ls/LsEntries but aren't followed yet: reading, writing or
+// opening one fails.
+//
+// Parameters:
+//
+//	target (string) - the path the link points to
+//	path (string) - where to create the link. Its parent directory must already exist
+//
+// Returns:
+//
+//	string - the name of the new link
+//	error - an error if the target is empty, the parent directory doesn't exist or the path is
+//	        already taken
+func (fs *Filesystem) Symlink(target string, path string) (string, error) {
+	defer fs.enter(OperationSymlink, path)()
+	if fs.replica {
+		return "", ErrReadOnly
+	}
+	if target == "" {
+		return "", errors.New("Must provide a link target")
+	}
+
+	link, err := fs.createAt(path)
+	if err != nil {
+		return "", err
+	}
+	link.SetKind(util.KindSymlink)
+	link.SetContents([]byte(target))
+	fs.touch(link)
+	fs.record(JournalEntry{Op: OpSymlink, Path: link.GetFullPathName(fs.root), Target: target})
+
+	return link.GetName(), nil
+}
+
+// Returns the target of the symbolic link at path
+//
+// Parameters:
+//
+//	path (string) - the path of the link
+//
+// Returns:
+//
+//	string - the path the link points to
+//	error - an error if the path doesn't exist or isn't a symbolic link
+func (fs *Filesystem) Readlink(path string) (string, error) {
+	file, err := fs.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	link, ok := file.AsSymlink()
+	if !ok {
+		return "", fmt.Errorf("File %s is not a symbolic link", path)
+	}
+	return link.Target(), nil
+}
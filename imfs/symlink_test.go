@@ -0,0 +1,76 @@
+// symlink_test.go
+package imfs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSymlink(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.MkFile("file1")
+
+	res, err := fs.Symlink("/file1", "dir1/link")
+	assertMatchesAndNoErrors(res, err, "link", t)
+	res, err = fs.Readlink("dir1/link")
+	assertMatchesAndNoErrors(res, err, "/file1", t)
+
+	// Links are listed with their targets
+	entries, _ := fs.LsEntries("dir1")
+	if len(entries) != 1 || entries[0].Type != EntrySymlink || entries[0].Target != "/file1" {
+		t.Errorf("Expected a symlink entry but got %+v", entries)
+	}
+
+	// Reads and writes go through to the target
+	fs.Cd("dir1")
+	res, err = fs.WriteFile("link", "hello")
+	assertMatchesAndNoErrors(res, err, "link", t)
+	res, err = fs.ReadFile("link")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+	fs.Cd("..")
+	res, err = fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+
+	// Only links can be read with Readlink
+	res, err = fs.Readlink("file1")
+	assertErrorAndEmptyResult(res, err, "File file1 is not a symbolic link", t)
+	res, err = fs.Symlink("", "link2")
+	assertErrorAndEmptyResult(res, err, "Must provide a link target", t)
+
+	// Links survive snapshots and replication
+	var buf bytes.Buffer
+	fs.SaveSnapshot(&buf, FormatBinary)
+	loaded := NewFileSystem()
+	if err := loaded.LoadSnapshot(&buf); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	res, err = loaded.Readlink("dir1/link")
+	assertMatchesAndNoErrors(res, err, "/file1", t)
+
+	replica := NewFileSystem()
+	for _, entry := range fs.Journal() {
+		if err := replica.ApplyJournalEntry(entry); err != nil {
+			t.Fatalf("Expected no errors but got %s", err)
+		}
+	}
+	res, err = replica.Readlink("dir1/link")
+	assertMatchesAndNoErrors(res, err, "/file1", t)
+}
+
+func TestWriteToDirectoryFails(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+
+	// Directories can't have contents
+	res, err := fs.WriteFile("dir1", "hello")
+	assertErrorAndEmptyResult(res, err, "dir1: Is a directory", t)
+	res, err = fs.ReadFile("dir1")
+	assertErrorAndEmptyResult(res, err, "dir1: Is a directory", t)
+	if !errors.Is(err, ErrIsDir) {
+		t.Errorf("Expected ErrIsDir, got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package imfs
+
+import (
+	"io"
+)
+
+// A key/value pair describing a span, e.g. {"imfs.path", "/docs/a.txt"}
+type SpanAttribute struct {
+	Key   string
+	Value interface{}
+}
+
+// A single traced operation. Mirrors the subset of OpenTelemetry's trace.Span that the filesystem
+// uses, so an OpenTelemetry span can be adapted in a few lines.
+type Span interface {
+	SetAttributes(attrs ...SpanAttribute)
+	// Records that the operation failed
+	RecordError(err error)
+	End()
+}
+
+// Starts spans for filesystem operations. Set Options.Tracer to an adapter around an
+// OpenTelemetry tracer (or any other) to see the filesystem in traces like a real storage
+// dependency. Since operations don't take a context, an adapter that wants spans parented should
+// start them from a context it holds itself.
+type Tracer interface {
+	// Starts a span named after the operation, e.g. "imfs.write"
+	Start(name string) Span
+}
+
+// Starts a span for the operation if a tracer is set. The returned function ends it, recording
+// how many bytes were transferred and the error, if any.
+func (fs *Filesystem) startSpan(event *OperationEvent) func(bytes int, err error) {
+	if fs.opts.Tracer == nil {
+		return func(int, error) {}
+	}
+	span := fs.opts.Tracer.Start("imfs." + string(event.Op))
+	span.SetAttributes(SpanAttribute{"imfs.op", string(event.Op)}, SpanAttribute{"imfs.path", event.Path})
+	if event.Target != "" {
+		span.SetAttributes(SpanAttribute{"imfs.target", event.Target})
+	}
+	return func(bytes int, err error) {
+		span.SetAttributes(SpanAttribute{"imfs.bytes", bytes})
+		// Reaching the end of a file isn't a failure
+		if err != nil && err != io.EOF {
+			span.RecordError(err)
+		}
+		span.End()
+	}
+}
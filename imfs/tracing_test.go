@@ -0,0 +1,93 @@
+// tracing_test.go
+package imfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	name  string
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+func (t *recordingTracer) Start(name string) Span {
+	span := &recordingSpan{name: name, attrs: make(map[string]interface{})}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...SpanAttribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error) { s.err = err }
+func (s *recordingSpan) End()                  { s.ended = true }
+
+func TestTracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	fs := NewFileSystemWithOptions(Options{Tracer: tracer})
+
+	fs.MkFile("a.txt")
+	fs.WriteFile("a.txt", "hello")
+	fs.ReadFile("a.txt")
+	fs.ReadFile("missing.txt")
+
+	expected := []string{
+		"imfs.mkfile a.txt 0 <nil>",
+		"imfs.write a.txt 5 <nil>",
+		"imfs.read a.txt 5 <nil>",
+		"imfs.read missing.txt 0 File not found: missing.txt (resolving missing.txt from /)",
+	}
+	if len(tracer.spans) != len(expected) {
+		t.Fatalf("Expected %d spans, got %d", len(expected), len(tracer.spans))
+	}
+	for i, span := range tracer.spans {
+		got := fmt.Sprintf("%s %v %v %v", span.name, span.attrs["imfs.path"], span.attrs["imfs.bytes"], span.err)
+		if got != expected[i] || !span.ended {
+			t.Errorf("Expected span %q (ended), got %q (ended: %v)", expected[i], got, span.ended)
+		}
+	}
+}
+
+func TestTracingHandles(t *testing.T) {
+	tracer := &recordingTracer{}
+	fs := NewFileSystemWithOptions(Options{Tracer: tracer})
+	fs.MkFile("a.txt")
+	tracer.spans = nil
+
+	h, _ := fs.Open("a.txt")
+	defer h.Close()
+	h.Write([]byte("abc"))
+	buf := make([]byte, 10)
+	h.Read(buf)
+	_, err := h.Read(buf)
+	if err != io.EOF {
+		t.Fatalf("Expected io.EOF, got %v", err)
+	}
+
+	vetoed := errors.New("vetoed")
+	fs.Use(HookFuncs{BeforeFunc: func(event *OperationEvent) error { return vetoed }})
+	h.Write([]byte("abc"))
+
+	expected := []string{"imfs.write 3 <nil>", "imfs.read 3 <nil>", "imfs.read 0 <nil>", "imfs.write 0 vetoed"}
+	if len(tracer.spans) != len(expected) {
+		t.Fatalf("Expected %d spans, got %d", len(expected), len(tracer.spans))
+	}
+	for i, span := range tracer.spans {
+		got := fmt.Sprintf("%s %v %v", span.name, span.attrs["imfs.bytes"], span.err)
+		if got != expected[i] {
+			t.Errorf("Expected span %q, got %q", expected[i], got)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+	"path"
+)
+
+// How Tree lists a directory
+type TreeOptions struct {
+	// If positive, only entries this many levels below the directory are listed, like tree's -L
+	MaxDepth int
+}
+
+// An entry listed by Tree
+type TreeEntry struct {
+	// The path relative to the listed directory, through any symbolic links followed to get here
+	Path string
+	// How many levels below the listed directory the entry is, 1 for its children
+	Depth int
+	// Describes the entry itself; for symbolic links, the link rather than what it points to
+	Entry DirEntry
+	// True for directories and symbolic links leading to one
+	IsDir bool
+	// For symbolic links leading back to a directory that contains them, the absolute path of
+	// that directory. They aren't followed, since the listing would never end
+	Loop string
+}
+
+// Lists everything below a directory depth-first in name order, like `tree` or `ls -R`. Unlike
+// WalkDir, symbolic links to directories are followed, so their contents are listed under the
+// link. Links leading back to a directory above them (by node, so however the path is spelled)
+// are reported with Loop set rather than followed, and links that don't resolve are listed like
+// files.
+//
+// Parameters:
+//
+//	path (string) - the directory to list, relative to the current directory or absolute
+//	opts (TreeOptions) - how deep to list
+//
+// Returns:
+//
+//	[]TreeEntry - the entries, each directory followed by its contents
+//	error - an error if the path doesn't exist or isn't a directory
+func (fs *Filesystem) Tree(path string, opts TreeOptions) ([]TreeEntry, error) {
+	dir, err := fs.follow(path)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.IsDirectory() {
+		return nil, &PathError{Path: path, Err: ErrNotDir}
+	}
+	entries := []TreeEntry{}
+	fs.tree(dir, "", 1, map[*util.File]bool{dir: true}, opts, &entries)
+	return entries, nil
+}
+
+// Implements Tree. ancestors holds the directories being listed, to catch links leading back.
+func (fs *Filesystem) tree(dir *util.File, prefix string, depth int, ancestors map[*util.File]bool, opts TreeOptions, entries *[]TreeEntry) {
+	for _, child := range dir.Children() {
+		entry := TreeEntry{Path: path.Join(prefix, child.GetName()), Depth: depth, Entry: fs.dirEntry(child)}
+		target := child
+		if link, ok := child.AsSymlink(); ok {
+			hops := 0
+			if resolved, err := fs.walkFollowing(dir, link.Target(), &hops); err == nil {
+				target = resolved
+			}
+		}
+		entry.IsDir = target.IsDirectory()
+		if entry.IsDir && ancestors[target] {
+			entry.Loop = fullPath(target, fs.root)
+		}
+		*entries = append(*entries, entry)
+
+		if !entry.IsDir || entry.Loop != "" || (opts.MaxDepth > 0 && depth >= opts.MaxDepth) {
+			continue
+		}
+		ancestors[target] = true
+		fs.tree(target, entry.Path, depth+1, ancestors, opts, entries)
+		delete(ancestors, target)
+	}
+}
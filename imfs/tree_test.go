@@ -0,0 +1,64 @@
+// tree_test.go
+package imfs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Describes each entry as path@depth, with "/" after directories and the loop target if any
+func describeTree(entries []TreeEntry) string {
+	out := []string{}
+	for _, entry := range entries {
+		s := fmt.Sprintf("%s@%d", entry.Path, entry.Depth)
+		if entry.IsDir {
+			s += "/"
+		}
+		if entry.Loop != "" {
+			s += "(loop " + entry.Loop + ")"
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestTree(t *testing.T) {
+	fs := NewFileSystem()
+	fs.MkDir("a")
+	fs.MkDir("b")
+	fs.Cd("a")
+	fs.MkFile("x.txt")
+	fs.Symlink("~/b", "to-b")
+	fs.Symlink("..", "up")
+	fs.Symlink("missing", "dangling")
+	fs.Cd("~/b")
+	fs.MkFile("y.txt")
+	fs.Symlink("/a", "to-a")
+	fs.Cd("~")
+
+	// Links to directories are followed, and stop at a directory already being listed
+	entries, err := fs.Tree("a", TreeOptions{})
+	expected := "dangling@1 " +
+		"to-b@1/ to-b/to-a@2/(loop /a) to-b/y.txt@2 " +
+		"up@1/ up/a@2/(loop /a) up/b@2/ up/b/to-a@3/(loop /a) up/b/y.txt@3 " +
+		"x.txt@1"
+	assertMatchesAndNoErrors(describeTree(entries), err, expected, t)
+	if entries[0].Entry.Type != EntrySymlink || entries[0].Entry.Target != "missing" {
+		t.Errorf("Expected the dangling link to be described as a link, got %+v", entries[0].Entry)
+	}
+
+	// Listing from the root catches the cycle through both links
+	entries, err = fs.Tree("~", TreeOptions{})
+	expected = "a@1/ a/dangling@2 a/to-b@2/ a/to-b/to-a@3/(loop /a) a/to-b/y.txt@3 a/up@2/(loop /) a/x.txt@2 " +
+		"b@1/ b/to-a@2/ b/to-a/dangling@3 b/to-a/to-b@3/(loop /b) b/to-a/up@3/(loop /) b/to-a/x.txt@3 b/y.txt@2"
+	assertMatchesAndNoErrors(describeTree(entries), err, expected, t)
+
+	// Depth limits
+	entries, err = fs.Tree("a", TreeOptions{MaxDepth: 1})
+	assertMatchesAndNoErrors(describeTree(entries), err, "dangling@1 to-b@1/ up@1/ x.txt@1", t)
+
+	if _, err := fs.Tree("a/x.txt", TreeOptions{}); err == nil {
+		t.Errorf("Expected an error listing a file")
+	}
+}
@@ -0,0 +1,106 @@
+package imfs
+
+import (
+	"fmt"
+	"io"
+)
+
+// Zero-copy access to file contents. Contents are never modified in place: every write either
+// replaces them with a copy or appends past their end. So a view of the contents taken before a
+// write keeps holding exactly the bytes it held, while the file moves on, which makes views
+// copy-on-write without copying anything up front.
+//
+// The aliasing rules for views returned by Bytes and FileHandle.Bytes:
+//   - A view may be shared with the file (and with other files sharing its contents, see GC and
+//     ShareDuplicates), so it must never be modified. Copy it first if you need to.
+//   - Appending to a view is safe: it has no spare capacity, so append always copies.
+//   - A view is a snapshot. Later writes to the file don't show up in it; take a new view instead.
+//   - Read filters, virtual files and unflushed buffered writes produce new data, in which case
+//     the view is a fresh copy rather than the stored contents.
+
+// Returns the contents of a file without copying them, unlike ReadFile, which converts them to a
+// string. See the aliasing rules above. Symbolic links are followed.
+//
+// Parameters:
+//
+//	path (string) - the file to read, relative to the current directory or absolute (with "~")
+//
+// Returns:
+//
+//	[]byte - a read-only view of the contents
+//	error - an error if the path doesn't exist, or isn't a regular file
+func (fs *Filesystem) Bytes(path string) ([]byte, error) {
+	file, err := fs.follow(path)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsDirectory() || file.IsFifo() || file.GetKind().IsSpecial() {
+		return nil, fmt.Errorf("File %s is not a regular file; cannot view", path)
+	}
+	contents := fs.applyReadFilters(file, file.ContentsView())
+	fs.countAccess(file, OperationRead, len(contents))
+	return contents, nil
+}
+
+// Returns the contents as seen through the handle without copying them, unless the handle holds
+// unflushed writes. See the aliasing rules above. Doesn't move the handle's offset.
+func (h *FileHandle) Bytes() ([]byte, error) {
+	h.checkUsable(OperationRead)
+	if h.closed {
+		return nil, ErrClosed
+	}
+	if h.file.IsFifo() || h.file.GetKind().IsSpecial() {
+		return nil, fmt.Errorf("File %s is not a regular file; cannot view", h.file.GetName())
+	}
+	contents := h.contents()
+	h.fs.countAccess(h.file, OperationRead, len(contents))
+	return contents, nil
+}
+
+// Reads len(p) bytes starting at off into p, implementing io.ReaderAt. Only the requested range
+// is copied, and the handle's offset doesn't move. Returns io.EOF if fewer than len(p) bytes are
+// left. Pipes and special files can't be read at an offset.
+func (h *FileHandle) ReadAt(p []byte, off int64) (int, error) {
+	h.checkUsable(OperationRead)
+	if h.closed {
+		return 0, ErrClosed
+	}
+	end := h.fs.startSpan(&OperationEvent{Op: OperationRead, Path: h.file.GetFullPathName(h.fs.root)})
+	n, err := h.guarded(OperationRead, func() (int, error) { return h.readAt(p, off) })
+	h.fs.countAccess(h.file, OperationRead, n)
+	end(n, err)
+	return n, err
+}
+
+// Implements ReadAt
+func (h *FileHandle) readAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("Negative offset %d", off)
+	}
+	if h.file.IsFifo() || h.file.GetKind().IsSpecial() {
+		return 0, fmt.Errorf("File %s is not a regular file; cannot read at an offset", h.file.GetName())
+	}
+	contents := h.contents()
+	if off >= int64(len(contents)) {
+		return 0, io.EOF
+	}
+	n := copy(p, contents[off:])
+	h.cacheRead(int(off), n)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Returns the contents as seen through the handle, including its unflushed writes, with read
+// filters applied
+func (h *FileHandle) contents() []byte {
+	contents := h.file.ContentsView()
+	if len(h.dirty) > 0 {
+		// Appending to the view copies, so this never writes into the file's own storage
+		contents = append(contents, h.dirty...)
+	}
+	return h.fs.applyReadFilters(h.file, contents)
+}
+
+var _ io.ReaderAt = (*FileHandle)(nil)
@@ -0,0 +1,90 @@
+// views_test.go
+package imfs
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestBytes(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("dir1")
+	fs.MkFile("file1")
+	fs.WriteFile("file1", "hello")
+	fs.Symlink("file1", "link")
+	fs.MkFifo("pipe")
+
+	// Views share the stored contents, and links are followed
+	view, err := fs.Bytes("link")
+	if err != nil || string(view) != "hello" {
+		t.Fatalf("Expected hello but got %q (%v)", view, err)
+	}
+	again, _ := fs.Bytes("~/file1")
+	if &view[0] != &again[0] {
+		t.Errorf("Expected views to share the contents rather than copy them")
+	}
+
+	// Writes to the file leave earlier views alone, and appending to a view copies
+	fs.WriteFile("file1", " world")
+	appended := append(view, '!')
+	if string(view) != "hello" || string(appended) != "hello!" {
+		t.Errorf("Expected the view to stay hello, got %q and %q", view, appended)
+	}
+	if res, _ := fs.ReadFile("file1"); res != "hello world" {
+		t.Errorf("Expected appending to a view to leave the file alone, got %q", res)
+	}
+
+	// Only regular files can be viewed
+	for _, path := range []string{"dir1", "pipe", "missing"} {
+		if _, err := fs.Bytes(path); err == nil {
+			t.Errorf("Expected an error viewing %s", path)
+		}
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystemWithOptions(Options{BufferedWrites: true})
+	fs.MkFile("file1")
+	fs.WriteFile("file1", "hello world")
+	h, _ := fs.Open("file1")
+
+	// Reads the requested range without moving the offset
+	p := make([]byte, 5)
+	if n, err := h.ReadAt(p, 6); n != 5 || err != nil || string(p) != "world" {
+		t.Errorf("Expected world but got %q (%d, %v)", p[:n], n, err)
+	}
+	if n, err := h.ReadAt(p, 8); n != 3 || err != io.EOF || string(p[:n]) != "rld" {
+		t.Errorf("Expected rld and EOF but got %q (%d, %v)", p[:n], n, err)
+	}
+	if _, err := h.ReadAt(p, 11); err != io.EOF {
+		t.Errorf("Expected EOF reading past the end but got %v", err)
+	}
+	if _, err := h.ReadAt(p, -1); err == nil {
+		t.Errorf("Expected an error reading at a negative offset")
+	}
+	if n, _ := h.Read(p); string(p[:n]) != "hello" {
+		t.Errorf("Expected ReadAt to leave the offset alone, got %q", p[:n])
+	}
+
+	// The handle sees its unflushed writes, copied into a new slice
+	view, _ := h.Bytes()
+	h.Write([]byte("!"))
+	buffered, err := h.Bytes()
+	if err != nil || string(buffered) != "hello world!" || string(view) != "hello world" {
+		t.Errorf("Expected the buffered write in a new view only, got %q and %q", buffered, view)
+	}
+	if stored, _ := fs.Bytes("file1"); !bytes.Equal(stored, view) {
+		t.Errorf("Expected the file to be unchanged until flushed, got %q", stored)
+	}
+
+	h.Close()
+	if _, err := h.ReadAt(p, 0); err != ErrClosed {
+		t.Errorf("Expected error: %s but got %v", ErrClosed, err)
+	}
+	if _, err := h.Bytes(); err != ErrClosed {
+		t.Errorf("Expected error: %s but got %v", ErrClosed, err)
+	}
+}
@@ -0,0 +1,37 @@
+package imfs
+
+// Creates a virtual file whose contents are generated on demand, like the files under /proc. Every
+// read (ReadFile, handles...) calls the generator. Writes are passed to the optional setter;
+// without one, the file is read-only. Virtual files are left out of snapshots and change streams,
+// and replicas only see an empty placeholder file.
+//
+// Parameters:
+//
+//	path (string) - where to create the file. Its parent directory must already exist
+//	generator (func() []byte) - returns the current contents of the file
+//	setter (...func([]byte) error) - 0 or 1 functions that receive any data written to the file
+//
+// Returns:
+//
+//	string - the name of the new virtual file
+//	error - an error if the parent directory doesn't exist or the path is already taken
+func (fs *Filesystem) RegisterVirtualFile(path string, generator func() []byte, setter ...func([]byte) error) (string, error) {
+	defer fs.enter(OperationMkFile, path)()
+	if fs.replica {
+		return "", ErrReadOnly
+	}
+
+	file, err := fs.createAt(path)
+	if err != nil {
+		return "", err
+	}
+	if len(setter) == 1 {
+		file.SetVirtual(generator, setter[0])
+	} else {
+		file.SetVirtual(generator, nil)
+	}
+	fs.touch(file)
+	fs.record(JournalEntry{Op: OpMkFile, Path: file.GetFullPathName(fs.root)})
+
+	return file.GetName(), nil
+}
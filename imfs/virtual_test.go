@@ -0,0 +1,51 @@
+// virtual_test.go
+package imfs
+
+import (
+	"io"
+	"strconv"
+	"testing"
+)
+
+func TestRegisterVirtualFile(t *testing.T) {
+	// Set up test subject
+	fs := NewFileSystem()
+	fs.MkDir("proc")
+
+	reads := 0
+	res, err := fs.RegisterVirtualFile("proc/reads", func() []byte {
+		reads++
+		return []byte(strconv.Itoa(reads))
+	})
+	assertMatchesAndNoErrors(res, err, "reads", t)
+
+	// Every read regenerates the contents
+	fs.Cd("proc")
+	res, err = fs.ReadFile("reads")
+	assertMatchesAndNoErrors(res, err, "1", t)
+	h, _ := fs.Open("reads")
+	data, _ := io.ReadAll(h)
+	assertMatchesAndNoErrors(string(data), nil, "2", t)
+
+	// Without a setter the file is read-only
+	res, err = fs.WriteFile("reads", "hello")
+	if err == nil || err.Error() != "Virtual file reads is read-only" {
+		t.Errorf("Expected error: Virtual file reads is read-only but got %s", err)
+	}
+
+	// Writes are routed to the setter
+	value := "initial"
+	fs.RegisterVirtualFile("~/proc/value", func() []byte {
+		return []byte(value)
+	}, func(data []byte) error {
+		value = string(data)
+		return nil
+	})
+	fs.WriteFile("value", "updated")
+	res, err = fs.ReadFile("value")
+	assertMatchesAndNoErrors(res, err, "updated", t)
+
+	// Existing paths can't be registered again
+	res, err = fs.RegisterVirtualFile("value", func() []byte { return nil })
+	assertErrorAndEmptyResult(res, err, "File value already exists", t)
+}
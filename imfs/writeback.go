@@ -0,0 +1,359 @@
+package imfs
+
+import (
+	"crypto/sha256"
+	"errors"
+	"github.com/bwent/in-memory-fs/internal/util"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Returned by SyncBacking when a change wasn't written back because the backing store changed
+// since the tree last read or wrote that path. The tree keeps its version; the backing store is
+// left alone
+var ErrWriteBackConflict = errors.New("Backing store changed since it was last read")
+
+// A backing store changes can be written back to (see `Options.WriteBack`). Names are slash
+// separated and relative to the root of the store, as for fs.FS.
+type WritableFS interface {
+	iofs.FS
+	// Replaces the contents of a file, creating it if needed. Its directory already exists
+	WriteFile(name string, data []byte) error
+	// Creates a directory along with any missing parents
+	MkdirAll(name string) error
+	// Removes a file or a directory and everything below it. Removing a missing name succeeds
+	RemoveAll(name string) error
+	// Moves a file or a directory, along with everything below it, to a name that doesn't exist
+	// yet. Its new directory already exists
+	Rename(oldname string, newname string) error
+}
+
+// Returns a WritableFS for a directory on the real disk, e.g. for `Options.Backing` with
+// `Options.WriteBack`
+//
+// Parameters:
+//
+//	dir (string) - the directory on the real disk
+//
+// Returns:
+//
+//	WritableFS - the directory as a backing store
+func WritableDirFS(dir string) WritableFS {
+	return writableDir{FS: os.DirFS(dir), dir: dir}
+}
+
+type writableDir struct {
+	iofs.FS
+	dir string
+}
+
+func (d writableDir) WriteFile(name string, data []byte) error {
+	return os.WriteFile(d.path(name), data, util.DefaultFileMode)
+}
+
+func (d writableDir) MkdirAll(name string) error {
+	return os.MkdirAll(d.path(name), util.DefaultDirMode)
+}
+
+func (d writableDir) RemoveAll(name string) error {
+	return os.RemoveAll(d.path(name))
+}
+
+func (d writableDir) Rename(oldname string, newname string) error {
+	return os.Rename(d.path(oldname), d.path(newname))
+}
+
+func (d writableDir) path(name string) string {
+	return filepath.Join(d.dir, filepath.FromSlash(name))
+}
+
+// A path changed in the tree that hasn't been written back yet
+type pendingWriteBack struct {
+	path string
+	// For a move, where the entry was in the backing store, so it is moved there along with
+	// whatever the tree never loaded from it, rather than removed and written anew
+	from string
+	// When it may be written back, according to `Options.Now`
+	due time.Time
+	// How many times writing it back failed so far
+	failures int
+}
+
+// Returns the backing store changes are written back to, or nil if write-back is off
+func (fs *Filesystem) writeBackStore() WritableFS {
+	if !fs.opts.WriteBack {
+		return nil
+	}
+	store, _ := fs.opts.Backing.(WritableFS)
+	return store
+}
+
+// Queues the paths a journal entry changed to be written back, unless they already are. Only
+// called on the storage, whose journal sees the changes made through its views too.
+func (fs *Filesystem) queueWriteBack(entry JournalEntry) {
+	if fs.writeBackStore() == nil || fs.loadingBacking {
+		return
+	}
+	due := fs.now().Add(fs.opts.WriteBackDelay)
+	if ignore := fs.opts.WriteBackIgnore; entry.Op == OpMv && ignore != nil {
+		file := util.LookupPath(fs.root, entry.Target)
+		isDir := file != nil && file.IsDirectory()
+		switch {
+		case ignore.Match(entry.Path, isDir):
+			// Moved out of the ignored paths, so there's nothing to move in the backing store
+			entry = JournalEntry{Op: OpPut, Path: entry.Target}
+		case ignore.Match(entry.Target, isDir):
+			// Moved into them, so it is only removed from where it was
+			entry = JournalEntry{Op: OpRm, Path: entry.Path}
+		}
+	}
+	if entry.Op == OpMv {
+		// A move of an entry that is still waiting to be moved just moves it further
+		for i, pending := range fs.pendingWriteBacks {
+			if pending.from != "" && pending.path == entry.Path && pending.failures == 0 {
+				fs.pendingWriteBacks[i].path = entry.Target
+				return
+			}
+		}
+		fs.pendingWriteBacks = append(fs.pendingWriteBacks, pendingWriteBack{path: entry.Target, from: entry.Path, due: due})
+		return
+	}
+	if entry.Path == "" || fs.writeBackQueued(entry.Path) {
+		return
+	}
+	fs.pendingWriteBacks = append(fs.pendingWriteBacks, pendingWriteBack{path: entry.Path, due: due})
+}
+
+// Returns true if the path is queued and not being retried, so a new change will be picked up
+// when it is written back
+func (fs *Filesystem) writeBackQueued(p string) bool {
+	for _, pending := range fs.pendingWriteBacks {
+		if pending.path == p && pending.failures == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Writes back the queued paths that are due. Called at the start of every operation, so the
+// filesystem behaves as if a background worker persisted changes as they fell due, without
+// another goroutine ever touching the tree. Failures are retried up to
+// `Options.WriteBackRetries` times, WriteBackDelay apart, and then kept for SyncBacking to report.
+func (fs *Filesystem) applyDueWriteBacks() {
+	if len(fs.pendingWriteBacks) == 0 {
+		return
+	}
+	now := fs.now()
+	remaining := fs.pendingWriteBacks[:0]
+	for _, pending := range fs.pendingWriteBacks {
+		if pending.due.After(now) {
+			remaining = append(remaining, pending)
+			continue
+		}
+		if retry, ok := fs.writeBackPending(pending); ok {
+			retry.due = now.Add(fs.opts.WriteBackDelay)
+			remaining = append(remaining, retry)
+		}
+	}
+	fs.pendingWriteBacks = remaining
+	if len(fs.pendingWriteBacks) == 0 {
+		fs.pendingWriteBacks = nil
+	}
+}
+
+// Writes back a queued path, returning it with true if it failed and should be retried. Errors
+// that aren't retried are kept for SyncBacking.
+func (fs *Filesystem) writeBackPending(pending pendingWriteBack) (pendingWriteBack, bool) {
+	var err error
+	if pending.from != "" {
+		err = fs.writeBackMove(pending.from, pending.path)
+	} else {
+		err = fs.writeBack(pending.path)
+	}
+	if err == nil {
+		return pending, false
+	}
+	pending.failures++
+	if !errors.Is(err, ErrWriteBackConflict) && pending.failures <= fs.opts.WriteBackRetries {
+		return pending, true
+	}
+	if fs.writeBackErr == nil {
+		fs.writeBackErr = err
+	}
+	return pending, false
+}
+
+// Makes the backing store match the tree at the path: files are written, directories created
+// along with everything in them, and paths missing from the tree removed, unless the backing store
+// has files there the tree didn't load or that changed since, which would be lost. Symbolic links, pipes,
+// special, remote and virtual files are skipped, since a WritableFS can't represent them, and so
+// are the paths matched by Options.WriteBackIgnore.
+func (fs *Filesystem) writeBack(p string) error {
+	store := fs.writeBackStore()
+	name := strings.TrimPrefix(path.Clean(p), "/")
+	if name == "" {
+		name = "."
+	}
+	file := util.LookupPath(fs.root, p)
+	if ignore := fs.opts.WriteBackIgnore; ignore != nil {
+		isDir := file != nil && file.IsDirectory()
+		if info, err := iofs.Stat(store, name); file == nil && err == nil {
+			isDir = info.IsDir()
+		}
+		if ignore.Match(p, isDir) {
+			return nil
+		}
+	}
+	switch {
+	case file == nil:
+		if _, err := iofs.Stat(store, name); err == nil {
+			// Already removed from the backing store otherwise, which is no conflict
+			if err := fs.checkBackingTree(store, name, p); err != nil {
+				return err
+			}
+			if err := store.RemoveAll(name); err != nil {
+				return &PathError{Op: OperationRm, Path: p, Err: err}
+			}
+		}
+		for known := range fs.backingSums {
+			if known == p || strings.HasPrefix(known, p+"/") {
+				delete(fs.backingSums, known)
+			}
+		}
+	case file.IsDirectory():
+		if err := store.MkdirAll(name); err != nil {
+			return &PathError{Op: OperationMkDir, Path: p, Err: err}
+		}
+		for _, child := range file.Children() {
+			if err := fs.writeBack(fullPath(child, fs.root)); err != nil {
+				return err
+			}
+		}
+	case file.GetKind() == util.KindRegular && !file.IsVirtual():
+		data := file.GetContents()
+		if sum, ok := fs.backingSums[p]; ok && sum == sha256.Sum256(data) {
+			return nil
+		}
+		if err := fs.checkBacking(store, name, p); err != nil {
+			return err
+		}
+		if err := store.MkdirAll(path.Dir(name)); err != nil {
+			return &PathError{Op: OperationMkDir, Path: p, Err: err}
+		}
+		if err := store.WriteFile(name, data); err != nil {
+			return &PathError{Op: OperationWrite, Path: p, Err: err}
+		}
+		fs.rememberBacking(p, data)
+	}
+	return nil
+}
+
+// Moves an entry in the backing store the way it was moved in the tree, then writes back what
+// changed in it. Whatever the tree never loaded from below it moves along, untouched. An entry
+// that isn't in the backing store yet is just written back.
+func (fs *Filesystem) writeBackMove(from string, to string) error {
+	store := fs.writeBackStore()
+	fromName, toName := strings.TrimPrefix(path.Clean(from), "/"), strings.TrimPrefix(path.Clean(to), "/")
+	if _, err := iofs.Stat(store, fromName); err != nil {
+		return fs.writeBack(to)
+	}
+	// The tree only moves entries to free names, so anything there was created behind its back
+	if _, err := iofs.Stat(store, toName); err == nil {
+		return &PathError{Op: OperationMv, Path: to, Err: ErrWriteBackConflict}
+	}
+	if err := store.MkdirAll(path.Dir(toName)); err != nil {
+		return &PathError{Op: OperationMkDir, Path: to, Err: err}
+	}
+	if err := store.Rename(fromName, toName); err != nil {
+		return &PathError{Op: OperationMv, Path: from, Err: err}
+	}
+	for known, sum := range fs.backingSums {
+		if known == from || strings.HasPrefix(known, from+"/") {
+			delete(fs.backingSums, known)
+			fs.backingSums[to+strings.TrimPrefix(known, from)] = sum
+		}
+	}
+	return fs.writeBack(to)
+}
+
+// Fails with ErrWriteBackConflict unless every file at or below name in the backing store is
+// what the tree last read from or wrote to it, so removing them loses nothing: files the tree
+// never loaded, or that changed behind its back, are conflicts.
+func (fs *Filesystem) checkBackingTree(store WritableFS, name string, p string) error {
+	return iofs.WalkDir(store, name, func(current string, entry iofs.DirEntry, err error) error {
+		if err != nil {
+			return &PathError{Op: OperationRead, Path: p, Err: err}
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		treePath := p + strings.TrimPrefix(current, name)
+		if _, known := fs.backingSums[treePath]; !known {
+			return &PathError{Op: OperationRm, Path: treePath, Err: ErrWriteBackConflict}
+		}
+		return fs.checkBacking(store, current, treePath)
+	})
+}
+
+// Fails with ErrWriteBackConflict if the file at name in the backing store isn't what the tree
+// last read from or wrote to it: changed, created or removed behind its back. Directories
+// themselves are never in conflict; checkBackingTree checks what is in them.
+func (fs *Filesystem) checkBacking(store WritableFS, name string, p string) error {
+	known, wasKnown := fs.backingSums[p]
+	data, err := iofs.ReadFile(store, name)
+	switch {
+	case errors.Is(err, iofs.ErrNotExist):
+		if !wasKnown {
+			return nil
+		}
+	case err != nil:
+		if info, statErr := iofs.Stat(store, name); statErr == nil && info.IsDir() {
+			return nil
+		}
+		return &PathError{Op: OperationRead, Path: p, Err: err}
+	case wasKnown && sha256.Sum256(data) == known:
+		return nil
+	}
+	return &PathError{Op: OperationWrite, Path: p, Err: ErrWriteBackConflict}
+}
+
+// Records the contents of a file as the tree last saw them in the backing store
+func (fs *Filesystem) rememberBacking(p string, data []byte) {
+	if fs.backingSums == nil {
+		fs.backingSums = make(map[string][sha256.Size]byte)
+	}
+	fs.backingSums[p] = sha256.Sum256(data)
+}
+
+// Writes back every queued change right away, whether or not it is due, retrying failures up
+// to `Options.WriteBackRetries` times (see `Options.WriteBack`). Does nothing when write-back is
+// off.
+//
+// Returns:
+//
+//	error - the first error writing back a change since the last call, if any, e.g. a *PathError
+//	        wrapping ErrWriteBackConflict
+func (fs *Filesystem) SyncBacking() error {
+	defer fs.enter(OperationWrite, "")()
+	storage := fs.storage()
+	for len(storage.pendingWriteBacks) > 0 {
+		pending := storage.pendingWriteBacks[0]
+		storage.pendingWriteBacks = storage.pendingWriteBacks[1:]
+		if retry, ok := storage.writeBackPending(pending); ok {
+			storage.pendingWriteBacks = append(storage.pendingWriteBacks, retry)
+		}
+	}
+	storage.pendingWriteBacks = nil
+	err := storage.writeBackErr
+	storage.writeBackErr = nil
+	return err
+}
+
+// Returns how many changed paths are waiting to be written back to the backing store
+func (fs *Filesystem) PendingWriteBacks() int {
+	return len(fs.storage().pendingWriteBacks)
+}
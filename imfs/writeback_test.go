@@ -0,0 +1,223 @@
+// writeback_test.go
+package imfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// A WritableFS keeping its files in an fstest.MapFS, failing the next failures writes
+type mapBacking struct {
+	fstest.MapFS
+	failures int
+}
+
+func (m *mapBacking) WriteFile(name string, data []byte) error {
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("disk unavailable")
+	}
+	m.MapFS[name] = &fstest.MapFile{Data: data}
+	return nil
+}
+
+func (m *mapBacking) MkdirAll(name string) error {
+	return nil
+}
+
+func (m *mapBacking) RemoveAll(name string) error {
+	for path := range m.MapFS {
+		if path == name || strings.HasPrefix(path, name+"/") {
+			delete(m.MapFS, path)
+		}
+	}
+	return nil
+}
+
+func (m *mapBacking) Rename(oldname string, newname string) error {
+	for path, file := range m.MapFS {
+		if path == oldname || strings.HasPrefix(path, oldname+"/") {
+			delete(m.MapFS, path)
+			m.MapFS[newname+strings.TrimPrefix(path, oldname)] = file
+		}
+	}
+	return nil
+}
+
+func TestWriteBack(t *testing.T) {
+	// Set up test subject
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	backing := &mapBacking{MapFS: fstest.MapFS{"docs/a.txt": {Data: []byte("hello")}}}
+	fs := NewFileSystemWithOptions(Options{
+		Backing:          backing,
+		WriteBack:        true,
+		WriteBackDelay:   time.Second,
+		WriteBackRetries: 1,
+		Now:              func() time.Time { return now },
+	})
+
+	// Loading from the backing store writes nothing back
+	res, err := fs.ReadFile("~/docs/a.txt")
+	assertMatchesAndNoErrors(res, err, "hello", t)
+	if fs.PendingWriteBacks() != 0 {
+		t.Errorf("Expected nothing to write back but got %d", fs.PendingWriteBacks())
+	}
+
+	// Changes apply in memory at once, and reach the backing store once due, written once
+	fs.WriteFile("~/docs/a.txt", " world")
+	fs.WriteFile("~/docs/a.txt", "!")
+	fs.MkFile("~/docs/b.txt")
+	if string(backing.MapFS["docs/a.txt"].Data) != "hello" || fs.PendingWriteBacks() != 2 {
+		t.Errorf("Expected 2 changes waiting but got %d", fs.PendingWriteBacks())
+	}
+	now = now.Add(time.Second)
+	fs.ReadFile("~/docs/a.txt")
+	if string(backing.MapFS["docs/a.txt"].Data) != "hello world!" || backing.MapFS["docs/b.txt"] == nil {
+		t.Errorf("Expected the changes to be written back but got %v", backing.MapFS)
+	}
+
+	// Failed writes are retried
+	backing.failures = 1
+	fs.WriteFile("~/docs/b.txt", "retried")
+	if err := fs.SyncBacking(); err != nil {
+		t.Errorf("Expected no errors but got %s", err)
+	}
+	if string(backing.MapFS["docs/b.txt"].Data) != "retried" {
+		t.Errorf("Expected the write to be retried but got %q", backing.MapFS["docs/b.txt"].Data)
+	}
+
+	// Files changed behind the tree's back aren't overwritten
+	backing.MapFS["docs/a.txt"] = &fstest.MapFile{Data: []byte("theirs")}
+	fs.WriteFile("~/docs/a.txt", "ours")
+	if err := fs.SyncBacking(); !errors.Is(err, ErrWriteBackConflict) {
+		t.Errorf("Expected a conflict but got %v", err)
+	}
+	if string(backing.MapFS["docs/a.txt"].Data) != "theirs" {
+		t.Errorf("Expected the backing store to be left alone but got %q", backing.MapFS["docs/a.txt"].Data)
+	}
+
+	// Removals are written back too
+	fs.Cd("~/docs")
+	fs.Rm("b.txt", false)
+	if err := fs.SyncBacking(); err != nil {
+		t.Errorf("Expected no errors but got %s", err)
+	}
+	if _, ok := backing.MapFS["docs/b.txt"]; ok {
+		t.Errorf("Expected docs/b.txt to be removed from the backing store")
+	}
+}
+
+func TestWritableDirFS(t *testing.T) {
+	// Set up test subject
+	dir := t.TempDir()
+	fs := NewFileSystemWithOptions(Options{Backing: WritableDirFS(dir), WriteBack: true})
+
+	// Changes are written to the directory on the real disk
+	fs.MkDir("docs")
+	fs.MkFile("~/docs/a.txt")
+	fs.WriteFile("~/docs/a.txt", "hello")
+	if err := fs.SyncBacking(); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "docs", "a.txt"))
+	assertMatchesAndNoErrors(string(data), err, "hello", t)
+}
+
+func TestWriteBackKeepsUnloadedEntries(t *testing.T) {
+	// Set up test subject: the tree only ever loads the directories, not the files in them
+	dir := t.TempDir()
+	for _, name := range []string{"d/a.txt", "d/sub/b.txt", "gone/c.txt"} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755)
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+	}
+	fs := NewFileSystemWithOptions(Options{Backing: WritableDirFS(dir), WriteBack: true})
+
+	// A renamed directory is renamed on disk, along with what the tree never loaded
+	if _, err := fs.Rename("d", "d2"); err != nil {
+		t.Fatal(err)
+	}
+	fs.WriteFile("~/d2/a.txt", "!")
+	if err := fs.SyncBacking(); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "d2", "a.txt"))
+	assertMatchesAndNoErrors(string(data), err, "d/a.txt!", t)
+	data, err = os.ReadFile(filepath.Join(dir, "d2", "sub", "b.txt"))
+	assertMatchesAndNoErrors(string(data), err, "d/sub/b.txt", t)
+	res, err := fs.ReadFile("~/d2/sub/b.txt")
+	assertMatchesAndNoErrors(res, err, "d/sub/b.txt", t)
+	if _, err := os.Stat(filepath.Join(dir, "d")); !os.IsNotExist(err) {
+		t.Errorf("Expected d to be gone from the disk, got %v", err)
+	}
+
+	// Moving it again before it is written back moves it once
+	fs.Rename("d2", "d3")
+	fs.Rename("d3", "d4")
+	if err := fs.SyncBacking(); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "d4", "sub", "b.txt")); err != nil {
+		t.Errorf("Expected d4/sub/b.txt on the disk, got %v", err)
+	}
+
+	// Removing a directory with files the tree never loaded is a conflict, not a loss
+	fs.Stat("gone")
+	fs.Rm("gone", true)
+	if err := fs.SyncBacking(); !errors.Is(err, ErrWriteBackConflict) {
+		t.Errorf("Expected a conflict but got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gone", "c.txt")); err != nil {
+		t.Errorf("Expected gone/c.txt to be kept on the disk, got %v", err)
+	}
+
+	// Once every file was loaded, the removal goes through
+	fs2 := NewFileSystemWithOptions(Options{Backing: WritableDirFS(dir), WriteBack: true})
+	fs2.ReadFile("~/gone/c.txt")
+	fs2.Rm("gone", true)
+	if err := fs2.SyncBacking(); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gone")); !os.IsNotExist(err) {
+		t.Errorf("Expected gone to be removed from the disk, got %v", err)
+	}
+}
+
+func TestWriteBackIgnore(t *testing.T) {
+	// Set up test subject
+	backing := &mapBacking{MapFS: fstest.MapFS{"build/stale.o": {Data: []byte("stale")}}}
+	ignore, _ := NewIgnoreMatcher("build/", "*.tmp")
+	fs := NewFileSystemWithOptions(Options{Backing: backing, WriteBack: true, WriteBackIgnore: ignore})
+
+	// Ignored paths stay in memory, and what the backing store has there is left alone
+	fs.MkDir("src")
+	fs.MkFile("~/src/main.c")
+	fs.MkFile("~/src/scratch.tmp")
+	fs.MkDir("build")
+	fs.MkFile("~/build/main.o")
+	fs.Rm("~/build/stale.o", false)
+	if err := fs.SyncBacking(); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	for name, expected := range map[string]bool{"src/main.c": true, "src/scratch.tmp": false, "build/main.o": false, "build/stale.o": true} {
+		if _, ok := backing.MapFS[name]; ok != expected {
+			t.Errorf("Expected %s to be written back: %t, got %v", name, expected, backing.MapFS)
+		}
+	}
+
+	// Moving a file out of the ignored paths writes it, and moving one into them removes it
+	fs.Rename("~/src/scratch.tmp", "notes.txt")
+	fs.Rename("~/src/main.c", "main.tmp")
+	if err := fs.SyncBacking(); err != nil {
+		t.Fatalf("Expected no errors but got %s", err)
+	}
+	for name, expected := range map[string]bool{"src/notes.txt": true, "src/main.c": false, "src/main.tmp": false} {
+		if _, ok := backing.MapFS[name]; ok != expected {
+			t.Errorf("Expected %s to be in the backing store: %t, got %v", name, expected, backing.MapFS)
+		}
+	}
+}
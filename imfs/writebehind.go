@@ -0,0 +1,72 @@
+package imfs
+
+import (
+	"github.com/bwent/in-memory-fs/internal/util"
+	"time"
+)
+
+// A write accepted by WriteFile in write-behind mode that hasn't been applied yet
+type pendingWrite struct {
+	file *util.File
+	data []byte
+	// When the write may be applied, according to `Options.Now`
+	due time.Time
+}
+
+// Queues a write to be applied once `Options.WriteBehindDelay` has passed. Writes are applied in
+// the order they were queued, so a write never becomes visible before an earlier one.
+func (fs *Filesystem) queueWrite(file *util.File, data []byte) {
+	due := fs.now().Add(fs.opts.WriteBehindDelay)
+	if n := len(fs.pendingWrites); n > 0 && due.Before(fs.pendingWrites[n-1].due) {
+		due = fs.pendingWrites[n-1].due
+	}
+	fs.pendingWrites = append(fs.pendingWrites, pendingWrite{file: file, data: data, due: due})
+}
+
+// Applies the queued writes that are due. Called at the start of every operation, so the
+// filesystem behaves as if a background worker applied them as they fell due, without another
+// goroutine ever touching the tree (the filesystem isn't safe for concurrent use). Failures are
+// kept for Sync to report, like errors from a real write-behind cache surfacing on fsync.
+func (fs *Filesystem) applyDueWrites() {
+	if len(fs.pendingWrites) == 0 {
+		return
+	}
+	now := fs.now()
+	for len(fs.pendingWrites) > 0 && !fs.pendingWrites[0].due.After(now) {
+		fs.applyPendingWrite()
+	}
+}
+
+// Applies the oldest queued write
+func (fs *Filesystem) applyPendingWrite() {
+	write := fs.pendingWrites[0]
+	fs.pendingWrites = fs.pendingWrites[1:]
+	if len(fs.pendingWrites) == 0 {
+		fs.pendingWrites = nil
+	}
+	if err := fs.applyWrite(write.file, write.data); err != nil && fs.writeBehindErr == nil {
+		fs.writeBehindErr = err
+	}
+}
+
+// Waits for every write queued in write-behind mode to be applied (see `Options.WriteBehind`),
+// whether or not it is due yet. Does nothing in the default mode, where writes are applied before
+// WriteFile returns.
+//
+// Returns:
+//
+//	error - the first error applying a queued write since the last call, if any
+func (fs *Filesystem) Sync() error {
+	defer fs.enter(OperationWrite, "")()
+	for len(fs.pendingWrites) > 0 {
+		fs.applyPendingWrite()
+	}
+	err := fs.writeBehindErr
+	fs.writeBehindErr = nil
+	return err
+}
+
+// Returns how many writes are queued in write-behind mode and not yet applied
+func (fs *Filesystem) PendingWrites() int {
+	return len(fs.pendingWrites)
+}
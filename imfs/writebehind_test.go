@@ -0,0 +1,66 @@
+// writebehind_test.go
+package imfs
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteBehind(t *testing.T) {
+	// Set up test subject
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fs := NewFileSystemWithOptions(Options{
+		WriteBehind:      true,
+		WriteBehindDelay: time.Second,
+		Now:              func() time.Time { return now },
+	})
+	fs.MkFile("file1")
+
+	// Writes return at once, but reads see the old contents until they are due
+	fs.WriteFile("file1", "hello")
+	fs.WriteFile("file1", " world")
+	res, err := fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "", t)
+	if fs.PendingWrites() != 2 {
+		t.Errorf("Expected 2 pending writes but got %d", fs.PendingWrites())
+	}
+
+	// Due writes are applied in order at the start of the next operation
+	now = now.Add(time.Second)
+	fs.WriteFile("file1", "!")
+	res, err = fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "hello world", t)
+	if fs.PendingWrites() != 1 {
+		t.Errorf("Expected 1 pending write but got %d", fs.PendingWrites())
+	}
+
+	// Sync applies everything, due or not
+	if err := fs.Sync(); err != nil {
+		t.Errorf("Expected no errors but got %s", err)
+	}
+	res, err = fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "hello world!", t)
+
+	// Missing files still fail at once
+	_, err = fs.WriteFile("missing", "data")
+	if err == nil || err.Error() != "File not found: missing (resolving missing from /)" {
+		t.Errorf("Expected error: File not found: missing (resolving missing from /) but got %v", err)
+	}
+
+	// Failures applying a write are reported by the next Sync, and queued writes are lost in a
+	// crash
+	small := NewFileSystemWithOptions(Options{WriteBehind: true, Capacity: 3 * NodeOverhead})
+	small.MkFile("file1")
+	small.WriteFile("file1", strings.Repeat("x", 3*NodeOverhead))
+	if err := small.Sync(); err != ErrNoSpace {
+		t.Errorf("Expected error: %s but got %v", ErrNoSpace, err)
+	}
+	if err := small.Sync(); err != nil {
+		t.Errorf("Expected the error to be reported once, got %v", err)
+	}
+	fs.WriteFile("file1", "lost")
+	fs.SimulateCrash()
+	res, err = fs.ReadFile("file1")
+	assertMatchesAndNoErrors(res, err, "hello world!", t)
+}
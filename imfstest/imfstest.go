@@ -0,0 +1,146 @@
+// Package imfstest provides assertions for tests that use an in-memory filesystem, e.g.
+//
+//	imfstest.AssertFileContent(t, fs, "~/docs/a.txt", "hello")
+//	imfstest.AssertTreeEquals(t, fs, map[string]string{
+//		"docs/a.txt": "hello",
+//		"empty/":     "",
+//	})
+//
+// Paths are resolved like Filesystem.Realpath: relative to the current directory, or from the
+// root when they start with "/" or "~". Failure messages include the whole tree (see Tree).
+package imfstest
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/imfs"
+	iofs "io/fs"
+	"sort"
+	"strings"
+)
+
+// The subset of testing.TB used by the assertions
+type TB interface {
+	Helper()
+	Errorf(format string, args ...any)
+	Fatalf(format string, args ...any)
+}
+
+// Checks that the file at path exists and has exactly the given contents. Symbolic links are
+// followed, and read filters don't apply.
+func AssertFileContent(t TB, fs *imfs.Filesystem, path string, want string) {
+	t.Helper()
+	resolved, err := fs.Realpath(path)
+	if err != nil {
+		t.Errorf("Expected %s to contain %q, but it does not exist: %s\n%s", path, want, err, Tree(fs))
+		return
+	}
+	file := fs.ToMapFS()[strings.TrimPrefix(resolved, "/")]
+	if file == nil || !file.Mode.IsRegular() {
+		t.Errorf("Expected %s to contain %q, but it is not a file\n%s", path, want, Tree(fs))
+		return
+	}
+	if got := string(file.Data); got != want {
+		t.Errorf("Expected %s to contain %q, got %q", path, want, got)
+	}
+}
+
+// Checks that the tree contains exactly the given entries. Keys are paths from the root (without
+// a leading "/") and values contents. Empty directories are listed with a trailing "/" and an
+// empty value, while other directories are implied by the paths inside them. Symbolic links are
+// listed with "-> " followed by their target as the value, e.g. {"link": "-> docs/a.txt"}. Pipes
+// and special nodes are listed like files, with their buffered data and kind respectively.
+func AssertTreeEquals(t TB, fs *imfs.Filesystem, want map[string]string) {
+	t.Helper()
+	got := treeMap(fs)
+
+	diffs := []string{}
+	for path, contents := range want {
+		actual, ok := got[path]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("missing %s", path))
+		case actual != contents:
+			diffs = append(diffs, fmt.Sprintf("%s: expected %q, got %q", path, contents, actual))
+		}
+	}
+	for path := range got {
+		if _, ok := want[path]; !ok {
+			diffs = append(diffs, fmt.Sprintf("unexpected %s", path))
+		}
+	}
+	if len(diffs) > 0 {
+		sort.Strings(diffs)
+		t.Errorf("Tree differs:\n  %s\n%s", strings.Join(diffs, "\n  "), Tree(fs))
+	}
+}
+
+// Returns the tree in the format used by AssertTreeEquals
+func treeMap(fs *imfs.Filesystem) map[string]string {
+	m := map[string]string{}
+	for path, file := range fs.ToMapFS() {
+		switch {
+		case file.Mode.IsDir():
+			m[path+"/"] = ""
+		case file.Mode&iofs.ModeSymlink != 0:
+			m[path] = "-> " + string(file.Data)
+		default:
+			m[path] = string(file.Data)
+		}
+	}
+	return m
+}
+
+// Stops the test unless something exists at path. Symbolic links are followed.
+func RequireExists(t TB, fs *imfs.Filesystem, path string) {
+	t.Helper()
+	if _, err := fs.Realpath(path); err != nil {
+		t.Fatalf("Expected %s to exist: %s\n%s", path, err, Tree(fs))
+	}
+}
+
+// Stops the test if something exists at path. Symbolic links are followed, so a link pointing at
+// nothing doesn't count.
+func RequireNotExists(t TB, fs *imfs.Filesystem, path string) {
+	t.Helper()
+	if resolved, err := fs.Realpath(path); err == nil {
+		t.Fatalf("Expected %s not to exist, but found %s\n%s", path, resolved, Tree(fs))
+	}
+}
+
+// Renders the tree like the `tree` command, with sizes and link targets, e.g.
+//
+//	/
+//	├── docs/
+//	│   └── a.txt (5 bytes)
+//	└── link -> docs/a.txt
+func Tree(fs *imfs.Filesystem) string {
+	var b strings.Builder
+	b.WriteString("/\n")
+	writeTree(&b, fs, "~", "")
+	return b.String()
+}
+
+func writeTree(b *strings.Builder, fs *imfs.Filesystem, path string, indent string) {
+	entries, err := fs.LsEntries(path)
+	if err != nil {
+		fmt.Fprintf(b, "%s└── (%s)\n", indent, err)
+		return
+	}
+	for i, entry := range entries {
+		branch, nextIndent := "├── ", indent+"│   "
+		if i == len(entries)-1 {
+			branch, nextIndent = "└── ", indent+"    "
+		}
+		switch entry.Type {
+		case imfs.EntryDir:
+			fmt.Fprintf(b, "%s%s%s/\n", indent, branch, entry.Name)
+			writeTree(b, fs, "~"+entry.Path, nextIndent)
+		case imfs.EntrySymlink:
+			fmt.Fprintf(b, "%s%s%s -> %s\n", indent, branch, entry.Name, entry.Target)
+		case imfs.EntryFile:
+			fmt.Fprintf(b, "%s%s%s (%d bytes)\n", indent, branch, entry.Name, entry.Size)
+		default:
+			fmt.Fprintf(b, "%s%s%s (%s)\n", indent, branch, entry.Name, entry.Type)
+		}
+	}
+}
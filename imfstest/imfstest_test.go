@@ -0,0 +1,107 @@
+// imfstest_test.go
+package imfstest
+
+import (
+	"fmt"
+	"github.com/bwent/in-memory-fs/imfs"
+	"strings"
+	"testing"
+)
+
+// Records failures instead of failing the test, so failing assertions can be tested
+type recorder struct {
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+func newFixture(t *testing.T) *imfs.Filesystem {
+	b := imfs.NewBuilder(imfs.Options{})
+	b.Dir("docs").File("a.txt", "hello")
+	b.Dir("empty")
+	b.Symlink("link", "docs/a.txt")
+	fs, err := b.Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestAssertFileContent(t *testing.T) {
+	fs := newFixture(t)
+	AssertFileContent(t, fs, "~/docs/a.txt", "hello")
+	AssertFileContent(t, fs, "link", "hello")
+
+	r := &recorder{}
+	AssertFileContent(r, fs, "docs/a.txt", "bye")
+	AssertFileContent(r, fs, "missing", "")
+	AssertFileContent(r, fs, "docs", "")
+	if len(r.errors) != 3 || r.errors[0] != `Expected docs/a.txt to contain "bye", got "hello"` ||
+		!strings.HasPrefix(r.errors[1], "Expected missing to contain \"\", but it does not exist") ||
+		!strings.HasPrefix(r.errors[2], "Expected docs to contain \"\", but it is not a file") {
+		t.Errorf("Unexpected failures: %q", r.errors)
+	}
+}
+
+func TestAssertTreeEquals(t *testing.T) {
+	fs := newFixture(t)
+	AssertTreeEquals(t, fs, map[string]string{
+		"docs/a.txt": "hello",
+		"empty/":     "",
+		"link":       "-> docs/a.txt",
+	})
+
+	r := &recorder{}
+	AssertTreeEquals(r, fs, map[string]string{
+		"docs/a.txt": "bye",
+		"docs/b.txt": "",
+		"link":       "-> docs/a.txt",
+	})
+	want := `Tree differs:
+  docs/a.txt: expected "bye", got "hello"
+  missing docs/b.txt
+  unexpected empty/
+`
+	if len(r.errors) != 1 || !strings.HasPrefix(r.errors[0], want) || r.fatal {
+		t.Errorf("Expected one failure starting with %q, got %q", want, r.errors)
+	}
+}
+
+func TestRequireExists(t *testing.T) {
+	fs := newFixture(t)
+	RequireExists(t, fs, "~/docs/a.txt")
+	RequireNotExists(t, fs, "~/docs/b.txt")
+
+	r := &recorder{}
+	RequireExists(r, fs, "~/docs/b.txt")
+	if !r.fatal || !strings.HasPrefix(r.errors[0], "Expected ~/docs/b.txt to exist") {
+		t.Errorf("Expected a fatal failure, got %q", r.errors)
+	}
+	r = &recorder{}
+	RequireNotExists(r, fs, "link")
+	if !r.fatal || !strings.HasPrefix(r.errors[0], "Expected link not to exist, but found /docs/a.txt") {
+		t.Errorf("Expected a fatal failure, got %q", r.errors)
+	}
+}
+
+func TestTree(t *testing.T) {
+	want := `/
+├── docs/
+│   └── a.txt (5 bytes)
+├── empty/
+└── link -> docs/a.txt
+`
+	if got := Tree(newFixture(t)); got != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, got)
+	}
+}
@@ -0,0 +1,29 @@
+package util
+
+import "sync"
+
+// How many nodes are allocated at once
+const nodeSlabSize = 256
+
+// Hands out nodes from slabs of nodeSlabSize, so building a tree of millions of nodes makes a
+// few thousand allocations rather than millions, which keeps the heap compact and gives the
+// garbage collector far fewer objects to track. The trade-off is that a slab stays in memory as
+// long as any of its nodes is referenced, so removed nodes are only reclaimed once their whole
+// slab is unused. Nodes are never recycled by hand, since removed nodes may still be referenced,
+// e.g. by open handles.
+var nodeArena struct {
+	sync.Mutex
+	slab []File
+}
+
+// Returns a new zeroed node
+func allocFile() *File {
+	nodeArena.Lock()
+	defer nodeArena.Unlock()
+	if len(nodeArena.slab) == 0 {
+		nodeArena.slab = make([]File, nodeSlabSize)
+	}
+	f := &nodeArena.slab[0]
+	nodeArena.slab = nodeArena.slab[1:]
+	return f
+}
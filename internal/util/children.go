@@ -0,0 +1,307 @@
+package util
+
+import (
+	"sort"
+)
+
+// Up to this many children are kept in a sorted slice rather than a map. Most directories are
+// small, and a short slice is both smaller and about as fast to search as a map.
+const smallTableSize = 8
+
+// The children of a directory, keyed by name. Without sharding this is a single map (or, for
+// small directories, a sorted slice). With sharding (see SetShardSize), a map that grows past the
+// shard size bursts into buckets keyed by the next byte of the names, recursively, so no map ever
+// holds more than shardSize entries. This keeps inserts and lookups flat for directories with
+// millions of entries (no giant map to grow), and lets listings be produced in order one bucket
+// at a time instead of sorting every name.
+//
+// Files and empty directories have no table at all: every method but put accepts a nil table.
+type childTable struct {
+	// While the table is a leaf (buckets is nil): its children, in a slice sorted by name while
+	// there are at most smallTableSize of them, then in a map
+	list    []childEntry
+	entries map[string]*File
+	// Once burst, the tables for the names continuing with each byte. An array rather than a map
+	// since lookups in long runs of shared prefixes go through one table per byte
+	buckets *[256]*childTable
+	// Once burst, the child whose name ends exactly at this depth, if any
+	exact     *File
+	exactName string
+	// The number of children in this table and its buckets
+	size int
+}
+
+type childEntry struct {
+	name string
+	file *File
+}
+
+func newChildTable() *childTable {
+	return &childTable{}
+}
+
+// Returns the child with the given name, or nil. depth is the length of the prefix shared by
+// every name in this table.
+func (t *childTable) get(name string, depth int) *File {
+	if t == nil {
+		return nil
+	}
+	for t.buckets != nil {
+		if len(name) == depth {
+			return t.exact
+		}
+		t = t.buckets[name[depth]]
+		if t == nil {
+			return nil
+		}
+		depth++
+	}
+	if t.entries != nil {
+		return t.entries[name]
+	}
+	if i, found := t.search(name); found {
+		return t.list[i].file
+	}
+	return nil
+}
+
+// Returns the index of name in the sorted list, or where it would be inserted
+func (t *childTable) search(name string) (int, bool) {
+	i := sort.Search(len(t.list), func(i int) bool { return t.list[i].name >= name })
+	return i, i < len(t.list) && t.list[i].name == name
+}
+
+// Adds or replaces a child, bursting tables that grow past shardSize (if positive). Returns true
+// if the child is new.
+func (t *childTable) put(name string, file *File, depth int, shardSize int) bool {
+	if t.buckets == nil {
+		added := t.putLeaf(name, file)
+		if added {
+			t.size++
+			if shardSize > 0 && t.size > shardSize {
+				t.burst(depth, shardSize)
+			}
+		}
+		return added
+	}
+
+	if len(name) == depth {
+		added := t.exact == nil
+		t.exact, t.exactName = file, name
+		if added {
+			t.size++
+		}
+		return added
+	}
+	bucket := t.buckets[name[depth]]
+	if bucket == nil {
+		bucket = newChildTable()
+		t.buckets[name[depth]] = bucket
+	}
+	added := bucket.put(name, file, depth+1, shardSize)
+	if added {
+		t.size++
+	}
+	return added
+}
+
+// Adds or replaces a child of a leaf, moving the list into a map once it outgrows
+// smallTableSize. Returns true if the child is new.
+func (t *childTable) putLeaf(name string, file *File) bool {
+	if t.entries != nil {
+		_, exists := t.entries[name]
+		t.entries[name] = file
+		return !exists
+	}
+
+	i, found := t.search(name)
+	if found {
+		t.list[i].file = file
+		return false
+	}
+	if len(t.list) < smallTableSize {
+		t.list = append(t.list, childEntry{})
+		copy(t.list[i+1:], t.list[i:])
+		t.list[i] = childEntry{name, file}
+		return true
+	}
+	t.entries = make(map[string]*File, len(t.list)+1)
+	for _, entry := range t.list {
+		t.entries[entry.name] = entry.file
+	}
+	t.entries[name] = file
+	t.list = nil
+	return true
+}
+
+// Moves the entries into buckets keyed by the byte after the shared prefix
+func (t *childTable) burst(depth int, shardSize int) {
+	children := []childEntry{}
+	t.each(func(name string, file *File) {
+		children = append(children, childEntry{name, file})
+	})
+	*t = childTable{buckets: &[256]*childTable{}}
+	for _, child := range children {
+		t.put(child.name, child.file, depth, shardSize)
+	}
+}
+
+// Moves the entries of a leaf back into a sorted list. Only done once the map has shrunk well
+// below smallTableSize, so a directory hovering around the threshold doesn't convert every time.
+func (t *childTable) shrink() {
+	t.list = make([]childEntry, 0, smallTableSize)
+	for name, f := range t.entries {
+		t.list = append(t.list, childEntry{name, f})
+	}
+	sort.Slice(t.list, func(i, j int) bool { return t.list[i].name < t.list[j].name })
+	t.entries = nil
+}
+
+// Removes a child, returning true if it existed. Emptied buckets are dropped.
+func (t *childTable) remove(name string, depth int) bool {
+	if t == nil {
+		return false
+	}
+	if t.buckets == nil {
+		if t.entries != nil {
+			if _, exists := t.entries[name]; !exists {
+				return false
+			}
+			delete(t.entries, name)
+			if len(t.entries) <= smallTableSize/2 {
+				t.shrink()
+			}
+		} else {
+			i, found := t.search(name)
+			if !found {
+				return false
+			}
+			t.list = append(t.list[:i], t.list[i+1:]...)
+		}
+		t.size--
+		return true
+	}
+
+	if len(name) == depth {
+		if t.exact == nil {
+			return false
+		}
+		t.exact, t.exactName = nil, ""
+		t.size--
+		return true
+	}
+	bucket := t.buckets[name[depth]]
+	if bucket == nil || !bucket.remove(name, depth+1) {
+		return false
+	}
+	if bucket.size == 0 {
+		t.buckets[name[depth]] = nil
+	}
+	t.size--
+	return true
+}
+
+// Calls visit for each child in name order until it returns false, skipping names up to and
+// including after when bounded. Only one bucket's names are sorted at a time. Returns false if
+// visit stopped the iteration. visit must not add or remove children.
+func (t *childTable) rangeSorted(after string, bounded bool, depth int, visit func(name string, f *File) bool) bool {
+	if t == nil {
+		return true
+	}
+	if t.buckets == nil {
+		if t.entries == nil {
+			start := 0
+			if bounded {
+				start = sort.Search(len(t.list), func(i int) bool { return t.list[i].name > after })
+			}
+			for _, entry := range t.list[start:] {
+				if !visit(entry.name, entry.file) {
+					return false
+				}
+			}
+			return true
+		}
+
+		names := make([]string, 0, len(t.entries))
+		for name := range t.entries {
+			if !bounded || name > after {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !visit(name, t.entries[name]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// While bounded, this table's prefix equals after[:depth], so the exact child (named by the
+	// prefix itself) sorts before or equal to after
+	if t.exact != nil && !bounded && !visit(t.exactName, t.exact) {
+		return false
+	}
+	for i, bucket := range t.buckets {
+		if bucket == nil {
+			continue
+		}
+		b := byte(i)
+		stillBounded := bounded && depth < len(after) && b == after[depth]
+		if bounded && depth < len(after) && b < after[depth] {
+			continue
+		}
+		if !bucket.rangeSorted(after, stillBounded, depth+1, visit) {
+			return false
+		}
+	}
+	return true
+}
+
+// Calls visit for every child, in no particular order
+func (t *childTable) each(visit func(name string, f *File)) {
+	if t == nil {
+		return
+	}
+	for _, entry := range t.list {
+		visit(entry.name, entry.file)
+	}
+	for name, f := range t.entries {
+		visit(name, f)
+	}
+	if t.exact != nil {
+		visit(t.exactName, t.exact)
+	}
+	if t.buckets != nil {
+		for _, bucket := range t.buckets {
+			if bucket != nil {
+				bucket.each(visit)
+			}
+		}
+	}
+}
+
+// Returns the number of children
+func (t *childTable) len() int {
+	if t == nil {
+		return 0
+	}
+	return t.size
+}
+
+// Returns how many leaves (slices or maps) back the table, counting each bucket
+func (t *childTable) shards() int {
+	if t == nil {
+		return 0
+	}
+	if t.buckets == nil {
+		return 1
+	}
+	n := 0
+	for _, bucket := range t.buckets {
+		if bucket != nil {
+			n += bucket.shards()
+		}
+	}
+	return n
+}
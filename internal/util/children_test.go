@@ -0,0 +1,228 @@
+// children_test.go
+package util
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// Names sharing long prefixes, prefixes of each other, and bytes above 0x7f, to exercise bursting
+var shardTestNames = []string{
+	"a", "ab", "abc", "abcd", "abd", "b", "ba", "object-0001", "object-0002", "object-0010",
+	"object-0100", "object-1000", "object-", "z", "\xffx", "\xff", "A", "0", "00", "000",
+}
+
+func newShardedDir(shardSize int, names []string) *File {
+	root := NewFile("/", true, nil)
+	root.SetShardSize(shardSize)
+	for _, name := range names {
+		root.UpsertChild(name, NewFile(name, false, root))
+	}
+	return root
+}
+
+func TestShardedChildren(t *testing.T) {
+	sorted := append([]string{}, shardTestNames...)
+	sort.Strings(sorted)
+
+	for _, shardSize := range []int{0, 1, 2, 3, 1000} {
+		root := newShardedDir(shardSize, shardTestNames)
+		if got := root.GetChildrenNames(); fmt.Sprint(got) != fmt.Sprint(sorted) {
+			t.Errorf("Shard size %d: expected %v, got %v", shardSize, sorted, got)
+		}
+		if root.NumChildren() != len(sorted) {
+			t.Errorf("Shard size %d: expected %d children, got %d", shardSize, len(sorted), root.NumChildren())
+		}
+		if shards := root.NumShards(); (shardSize == 0 || shardSize == 1000) != (shards == 1) {
+			t.Errorf("Shard size %d: unexpected number of shards %d", shardSize, shards)
+		}
+		for _, name := range shardTestNames {
+			if child := root.GetChildByName(name); child == nil || child.GetName() != name {
+				t.Errorf("Shard size %d: expected to find %q", shardSize, name)
+			}
+		}
+		if root.GetChildByName("abcde") != nil || root.GetChildByName("object-000") != nil {
+			t.Errorf("Shard size %d: found a child that doesn't exist", shardSize)
+		}
+
+		// Replacing doesn't change the count, removing does, and missing names are ignored
+		root.UpsertChild("ab", NewFile("ab", true, root))
+		root.RemoveChild("abc")
+		root.RemoveChild("abc")
+		root.RemoveChild("missing")
+		if root.NumChildren() != len(sorted)-1 || !root.GetChildByName("ab").IsDirectory() || root.GetChildByName("abc") != nil {
+			t.Errorf("Shard size %d: expected ab to be replaced and abc removed, got %v", shardSize, root.GetChildrenNames())
+		}
+
+		clone := root.Clone(nil)
+		if fmt.Sprint(clone.GetChildrenNames()) != fmt.Sprint(root.GetChildrenNames()) || clone.shardSize != shardSize {
+			t.Errorf("Shard size %d: expected the clone to have the same children and shard size", shardSize)
+		}
+		if NewFile("sub", true, root).shardSize != shardSize {
+			t.Errorf("Shard size %d: expected subdirectories to inherit it", shardSize)
+		}
+	}
+}
+
+func TestRangeChildrenAfter(t *testing.T) {
+	sorted := append([]string{}, shardTestNames...)
+	sort.Strings(sorted)
+
+	for _, shardSize := range []int{0, 1, 2, 1000} {
+		root := newShardedDir(shardSize, shardTestNames)
+		for _, after := range append([]string{"", "abc", "abcc", "object-00", "object-0001", "zz"}, sorted...) {
+			expected := []string{}
+			for _, name := range sorted {
+				if name > after {
+					expected = append(expected, name)
+				}
+			}
+			got := []string{}
+			root.RangeChildrenAfter(after, func(child *File) bool {
+				got = append(got, child.GetName())
+				return true
+			})
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Errorf("Shard size %d, after %q: expected %v, got %v", shardSize, after, expected, got)
+			}
+		}
+
+		// Paging stops when visit returns false
+		page := []string{}
+		root.RangeChildrenAfter("b", func(child *File) bool {
+			page = append(page, child.GetName())
+			return len(page) < 2
+		})
+		if fmt.Sprint(page) != "[ba object-]" {
+			t.Errorf("Shard size %d: expected the page [ba object-], got %v", shardSize, page)
+		}
+	}
+}
+
+func TestShardedChildrenRandomized(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	root := newShardedDir(8, nil)
+	expected := map[string]bool{}
+	for i := 0; i < 5000; i++ {
+		name := fmt.Sprintf("%x", rng.Intn(2000))
+		if rng.Intn(3) == 0 {
+			root.RemoveChild(name)
+			delete(expected, name)
+		} else {
+			root.UpsertChild(name, NewFile(name, false, root))
+			expected[name] = true
+		}
+	}
+
+	names := []string{}
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if got := root.GetChildrenNames(); fmt.Sprint(got) != fmt.Sprint(names) || root.NumChildren() != len(names) {
+		t.Errorf("Expected %d children in order, got %d", len(names), len(got))
+	}
+}
+
+// Benchmarks comparing a single map (shard size 0) with sharded storage for a large directory.
+// Inserts and lookups cost about the same; sharding avoids growing one giant map (and the latency
+// spikes when it rehashes), and makes listing a page from the middle of the directory cost one
+// bucket rather than sorting every name.
+const benchmarkDirSize = 200000
+
+func benchmarkShardSizes(b *testing.B, run func(b *testing.B, shardSize int)) {
+	for _, shardSize := range []int{0, 1024} {
+		b.Run(fmt.Sprintf("shard=%d", shardSize), func(b *testing.B) {
+			run(b, shardSize)
+		})
+	}
+}
+
+func benchmarkNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("object-%08d", i)
+	}
+	return names
+}
+
+func BenchmarkUpsertChild(b *testing.B) {
+	names := benchmarkNames(benchmarkDirSize)
+	benchmarkShardSizes(b, func(b *testing.B, shardSize int) {
+		root := newShardedDir(shardSize, nil)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if i%benchmarkDirSize == 0 {
+				root = newShardedDir(shardSize, nil)
+			}
+			root.UpsertChild(names[i%benchmarkDirSize], root)
+		}
+	})
+}
+
+func BenchmarkGetChildByName(b *testing.B) {
+	names := benchmarkNames(benchmarkDirSize)
+	benchmarkShardSizes(b, func(b *testing.B, shardSize int) {
+		root := newShardedDir(shardSize, names)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			root.GetChildByName(names[i%benchmarkDirSize])
+		}
+	})
+}
+
+func BenchmarkListPage(b *testing.B) {
+	names := benchmarkNames(benchmarkDirSize)
+	benchmarkShardSizes(b, func(b *testing.B, shardSize int) {
+		root := newShardedDir(shardSize, names)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			count := 0
+			root.RangeChildrenAfter(names[benchmarkDirSize/2], func(*File) bool {
+				count++
+				return count < 100
+			})
+		}
+	})
+}
+
+func TestFoldedChildren(t *testing.T) {
+	for _, shardSize := range []int{0, 2} {
+		// Set up test subject
+		root := NewFile("/", true, nil)
+		root.SetShardSize(shardSize)
+		root.SetFoldNames(true)
+		for _, name := range []string{"b.txt", "README.md", "Docs", "a.TXT"} {
+			root.UpsertChild(name, NewFile(name, name == "Docs", root))
+		}
+		docs := root.GetChildByName("docs")
+
+		// Any case finds a child, which keeps its own name, and listings are in folded order
+		if docs == nil || docs.GetName() != "Docs" || root.GetChildByName("readme.MD") == nil {
+			t.Errorf("With shard size %d, expected lookups to ignore case", shardSize)
+		}
+		if names := fmt.Sprint(root.GetChildrenNames()); names != "[a.TXT b.txt Docs README.md]" {
+			t.Errorf("With shard size %d, expected [a.TXT b.txt Docs README.md] but got %s", shardSize, names)
+		}
+		after := []string{}
+		root.RangeChildrenAfter("B.TXT", func(child *File) bool {
+			after = append(after, child.GetName())
+			return true
+		})
+		if fmt.Sprint(after) != "[Docs README.md]" {
+			t.Errorf("With shard size %d, expected [Docs README.md] after B.TXT but got %v", shardSize, after)
+		}
+
+		// Subdirectories and clones fold too, and removing takes any case
+		docs.UpsertChild("Guide", NewFile("Guide", false, docs))
+		if root.Clone(nil).GetChildByName("DOCS").GetChildByName("guide") == nil {
+			t.Errorf("With shard size %d, expected clones and subdirectories to ignore case", shardSize)
+		}
+		root.RemoveChild("B.TXT")
+		if root.GetChildByName("b.txt") != nil || root.NumChildren() != 3 {
+			t.Errorf("With shard size %d, expected b.txt to be removed but got %v", shardSize, root.GetChildrenNames())
+		}
+	}
+}
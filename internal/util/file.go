@@ -0,0 +1,569 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Limit the number of bytes that can be written to any file to 2M bytes, or ~2MB
+const MaxFileSize int = 2000000
+
+// Limit the size of the string that can be returned when reading a file to 2000 chars
+const MaxFileReadSize int = 2000
+
+// The permission bits given to new directories and files
+const (
+	DefaultDirMode  os.FileMode = 0755
+	DefaultFileMode os.FileMode = 0644
+)
+
+// The kind of a file that isn't a directory
+type FileKind int
+
+const (
+	KindRegular FileKind = iota
+	// A named pipe: reads consume the data that was written
+	KindFifo
+	// Like /dev/null: reads return nothing and writes are discarded
+	KindNull
+	// Like /dev/zero: reads return an endless stream of zeros and writes are discarded
+	KindZero
+	// Like /dev/urandom: reads return endless random data and writes are discarded
+	KindRandom
+	// A symbolic link, whose contents are the path it points to
+	KindSymlink
+	// A file whose contents are fetched from a URL when read. What's stored is the URL, and the
+	// file is virtual: the filesystem sets a generator fetching it
+	KindRemote
+)
+
+var fileKindNames = map[FileKind]string{
+	KindRegular: "regular",
+	KindFifo:    "fifo",
+	KindNull:    "null",
+	KindZero:    "zero",
+	KindRandom:  "random",
+	KindSymlink: "symlink",
+	KindRemote:  "remote",
+}
+
+func (k FileKind) String() string {
+	return fileKindNames[k]
+}
+
+// Returns the kind with the given name (see FileKind.String), or false if there is none
+func ParseFileKind(name string) (FileKind, bool) {
+	for kind, kindName := range fileKindNames {
+		if kindName == name {
+			return kind, true
+		}
+	}
+	return KindRegular, false
+}
+
+// Returns true for device-like kinds, whose contents are generated rather than stored
+func (k FileKind) IsSpecial() bool {
+	return k == KindNull || k == KindZero || k == KindRandom
+}
+
+// Stores information about a File or Directory object. This is the storage behind every Node;
+// prefer the typed views returned by Node, AsDir, AsRegularFile and AsSymlink, which only allow
+// the operations that make sense for each type.
+//
+// Trees can hold millions of nodes, so File is kept small: children are only allocated once a
+// directory has some, rarely used state lives in fileExtras, and nodes come from slabs (see
+// arena.go). Fields are ordered to avoid padding.
+type File struct {
+	name     string
+	contents []byte
+	// nil until the first child is added (see children.go)
+	children *childTable
+	parent   *File
+	// nil unless the file is virtual, has holes, its content type was detected or its access time
+	// recorded
+	extras *fileExtras
+	// The owner, which like the permission bits is only recorded, never enforced
+	owner string
+	// The filesystem generation at which this file was last created or modified
+	generation uint64
+	modTime    time.Time
+	kind       FileKind
+	// If positive, the children are sharded into buckets of at most this many entries (see
+	// SetShardSize). Inherited by new subdirectories
+	shardSize   int
+	mode        os.FileMode
+	isDirectory bool
+	// If set, the children are keyed by their case-folded name (see SetFoldNames). Inherited by
+	// new subdirectories
+	foldNames bool
+}
+
+// State that only some files need, kept out of File to keep every node small
+type fileExtras struct {
+	// Cached content type, valid as long as the generation hasn't changed since it was detected
+	contentType           string
+	contentTypeGeneration uint64
+	// For virtual files, generates the contents on every read and (optionally) receives writes
+	generator func() []byte
+	setter    func([]byte) error
+	// When the contents were last read, if that is tracked (see GetAccessTime)
+	accessTime time.Time
+	// The ranges of the contents that were never written, in order (see Holes)
+	holes []Hole
+}
+
+// A range of a file's contents that was never written, e.g. left by growing it, and reads as zeros
+type Hole struct {
+	Offset int
+	Length int
+}
+
+// Returns the file's extras, allocating them if needed
+func (f *File) ensureExtras() *fileExtras {
+	if f.extras == nil {
+		f.extras = &fileExtras{}
+	}
+	return f.extras
+}
+
+// Returns the generator of a virtual file, or nil
+func (f *File) generator() func() []byte {
+	if f.extras == nil {
+		return nil
+	}
+	return f.extras.generator
+}
+
+// NewFile creates a new File instance with the given name, isDir flag, and parent file.
+func NewFile(name string, isDir bool, parent *File) *File {
+	mode := DefaultFileMode
+	if isDir {
+		mode = DefaultDirMode
+	}
+	f := allocFile()
+	*f = File{
+		name:        intern(name),
+		isDirectory: isDir,
+		contents:    []byte{},
+		parent:      parent,
+		mode:        mode,
+	}
+	if parent != nil {
+		f.shardSize = parent.shardSize
+		f.foldNames = parent.foldNames
+	}
+	return f
+}
+
+// Simple Getters
+func (f *File) GetName() string {
+	return f.name
+}
+
+func (f *File) IsDirectory() bool {
+	return f.isDirectory
+}
+
+// Returns a copy of the children sorted by name, so callers can't modify the tree through it
+func (f *File) Children() []*File {
+	children := make([]*File, 0, f.children.len())
+	f.children.rangeSorted("", false, 0, func(_ string, child *File) bool {
+		children = append(children, child)
+		return true
+	})
+	countVisits(f, len(children))
+	return children
+}
+
+// Calls visit for each child in name order until it returns false. The children are copied
+// first, so visit may add or remove children.
+func (f *File) RangeChildren(visit func(*File) bool) {
+	for _, child := range f.Children() {
+		if !visit(child) {
+			return
+		}
+	}
+}
+
+// Calls visit for each child whose name sorts after the given one, in name order, until it
+// returns false, e.g. to page through a huge directory. Unlike RangeChildren nothing is copied up
+// front (with sharding, only one bucket's names are sorted at a time), so visit must not add or
+// remove children.
+func (f *File) RangeChildrenAfter(after string, visit func(*File) bool) {
+	visited := 0
+	f.children.rangeSorted(f.ChildKey(after), true, 0, func(_ string, child *File) bool {
+		visited++
+		return visit(child)
+	})
+	countVisits(f, visited)
+}
+
+func (f *File) NumChildren() int {
+	return f.children.len()
+}
+
+// Returns the names of the children in alphabetical order (of their folded names, with
+// SetFoldNames)
+func (f *File) GetChildrenNames() []string {
+	childrenNames := make([]string, 0, f.children.len())
+	f.children.rangeSorted("", false, 0, func(name string, child *File) bool {
+		if f.foldNames {
+			// The keys are folded, but names are listed as they were given
+			name = child.name
+		}
+		childrenNames = append(childrenNames, name)
+		return true
+	})
+	return childrenNames
+}
+
+// Makes the directory shard its children into buckets of at most size entries keyed by name
+// prefix once it has more than that many, which keeps inserts and lookups flat for directories
+// with millions of entries. Subdirectories created afterwards inherit the setting. 0 disables
+// sharding for children added from then on.
+func (f *File) SetShardSize(size int) {
+	f.shardSize = size
+}
+
+// Makes the directory look up its children regardless of letter case, like the filesystems of
+// macOS and Windows: they are keyed by their case-folded name, so "README.md" and "readme.md"
+// name the same child, while each child keeps the name it was given. Set it before adding
+// children; subdirectories created afterwards inherit the setting.
+func (f *File) SetFoldNames(fold bool) {
+	f.foldNames = fold
+}
+
+// Returns the key a child with the given name is stored under: the name itself, or its
+// case-folded form with SetFoldNames. Two names are taken to be the same child's if their keys
+// are equal.
+func (f *File) ChildKey(name string) string {
+	if !f.foldNames {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+// Returns how many maps back the children: none without children, 1 unless they are sharded
+func (f *File) NumShards() int {
+	return f.children.shards()
+}
+
+func (f *File) GetChildByName(name string) *File {
+	child := f.children.get(f.ChildKey(name), 0)
+	if child != nil {
+		countVisits(f, 1)
+	}
+	return child
+}
+
+func (f *File) GetParent() *File {
+	return f.parent
+}
+
+func (f *File) GetContents() []byte {
+	if generator := f.generator(); generator != nil {
+		return generator()
+	}
+	return f.contents
+}
+
+// Returns the contents without copying them. The slice has no spare capacity, so appending to it
+// never writes into the file's storage, and since writes to the file always copy or append past
+// the end, the bytes it holds never change. Callers must not modify them.
+func (f *File) ContentsView() []byte {
+	contents := f.GetContents()
+	return contents[:len(contents):len(contents)]
+}
+
+func (f *File) GetKind() FileKind {
+	return f.kind
+}
+
+func (f *File) IsFifo() bool {
+	return f.kind == KindFifo
+}
+
+func (f *File) IsVirtual() bool {
+	return f.generator() != nil
+}
+
+// Returns the URL of a remote file (see KindRemote), or "" for any other file
+func (f *File) RemoteURL() string {
+	if f.kind != KindRemote {
+		return ""
+	}
+	return string(f.contents)
+}
+
+func (f *File) GetMode() os.FileMode {
+	return f.mode
+}
+
+func (f *File) GetOwner() string {
+	return f.owner
+}
+
+func (f *File) GetGeneration() uint64 {
+	return f.generation
+}
+
+func (f *File) GetModTime() time.Time {
+	return f.modTime
+}
+
+// Returns when the contents were last read, or the modification time if that was never recorded
+func (f *File) GetAccessTime() time.Time {
+	if f.extras == nil || f.extras.accessTime.IsZero() {
+		return f.modTime
+	}
+	return f.extras.accessTime
+}
+
+// Returns the holes recorded with SetHoles, in order. Replacing the contents forgets them, so
+// callers that only change part of a file set them again afterwards.
+func (f *File) Holes() []Hole {
+	if f.extras == nil {
+		return nil
+	}
+	return f.extras.holes
+}
+
+// Returns the cached content type, or false if it was never detected or the file changed since
+func (f *File) GetCachedContentType() (string, bool) {
+	if f.extras == nil || f.extras.contentType == "" || f.extras.contentTypeGeneration != f.generation {
+		return "", false
+	}
+	return f.extras.contentType, true
+}
+
+// Reads the contents of a file into a string, cutting off after `MaxFileReadSize` chars
+func (f *File) ReadFileContents() string {
+	return FormatFileContents(f.GetContents())
+}
+
+// Converts file contents into a string, cutting off after `MaxFileReadSize` chars
+func FormatFileContents(contents []byte) string {
+	str := string(contents)
+	if len(str) > MaxFileReadSize {
+		strSpl := strings.SplitAfterN(str, ",", MaxFileReadSize)
+		str = fmt.Sprintf("%s ...[trunated contents after %d chars]", strSpl[0], MaxFileReadSize)
+	}
+	return str
+}
+
+// Returns the full path name of a given file (e.g.'/Users/bwent/test1')
+func (f *File) GetFullPathName(root *File) string {
+	return getFullPathNameHelper(f, root)
+}
+
+// Write methods
+
+// Adds or replaces a child. Panics if f isn't a directory, since that would corrupt the tree
+func (f *File) UpsertChild(name string, file *File) {
+	if !f.isDirectory {
+		panic(fmt.Sprintf("cannot add %s to %s: not a directory", name, f.name))
+	}
+	if file == nil {
+		f.RemoveChild(name)
+		return
+	}
+	if f.children == nil {
+		f.children = newChildTable()
+	}
+	// Key the child by its own (interned) name when they match, rather than holding another copy
+	if name = f.ChildKey(name); name == file.name {
+		name = file.name
+	} else {
+		name = intern(name)
+	}
+	f.children.put(name, file, 0, f.shardSize)
+}
+
+// Removes a child if it exists, dropping the children table once the directory is empty
+func (f *File) RemoveChild(name string) {
+	if f.children.remove(f.ChildKey(name), 0) && f.children.len() == 0 {
+		f.children = nil
+	}
+}
+
+func (f *File) SetParent(parent *File) {
+	f.parent = parent
+}
+
+func (f *File) SetName(name string) {
+	f.name = intern(name)
+}
+
+func (f *File) SetKind(kind FileKind) {
+	f.kind = kind
+}
+
+// Removes and returns up to n bytes from the start of the contents, as when reading from a pipe
+func (f *File) Drain(n int) []byte {
+	if n > len(f.contents) {
+		n = len(f.contents)
+	}
+	drained := append([]byte{}, f.contents[:n]...)
+	f.contents = f.contents[n:]
+	return drained
+}
+
+// Identifies the storage backing the contents (by its first element), so files sharing storage
+// can be told apart from files with equal contents, and returns how many bytes it holds. Returns
+// nil for files with no storage, or that don't store their contents.
+func (f *File) ContentsBlock() (*byte, int) {
+	if f.isDirectory || f.generator() != nil || f.kind.IsSpecial() || cap(f.contents) == 0 {
+		return nil, 0
+	}
+	return &f.contents[:cap(f.contents)][0], cap(f.contents)
+}
+
+// Makes the file use data, which must be equal to its contents, as their storage. Used to share
+// one copy of identical contents between files: since writes never modify contents in place, but
+// always copy or append past the end, sharing is safe. Returns false (and keeps the contents) if
+// data isn't equal to them.
+func (f *File) ShareContents(data []byte) bool {
+	if _, size := f.ContentsBlock(); size == 0 || !bytes.Equal(f.contents, data) {
+		return false
+	}
+	f.contents = data[:len(data):len(data)]
+	return true
+}
+
+// Sets the permission bits; any other bits are ignored
+func (f *File) SetMode(mode os.FileMode) {
+	f.mode = mode.Perm()
+}
+
+func (f *File) SetOwner(owner string) {
+	f.owner = owner
+}
+
+func (f *File) SetGeneration(generation uint64) {
+	f.generation = generation
+}
+
+func (f *File) SetModTime(modTime time.Time) {
+	f.modTime = modTime
+}
+
+func (f *File) SetAccessTime(accessTime time.Time) {
+	f.ensureExtras().accessTime = accessTime
+}
+
+// Caches the content type for the current generation of the file
+func (f *File) SetCachedContentType(contentType string) {
+	extras := f.ensureExtras()
+	extras.contentType = contentType
+	extras.contentTypeGeneration = f.generation
+}
+
+// Records which ranges of the contents were never written. The slice is kept, not copied, so it
+// mustn't be modified afterwards.
+func (f *File) SetHoles(holes []Hole) {
+	if len(holes) == 0 && f.extras == nil {
+		return
+	}
+	f.ensureExtras().holes = holes
+}
+
+// Makes the file virtual: reads call the generator instead of returning stored contents, and
+// writes are passed to the setter (or rejected, if the setter is nil)
+func (f *File) SetVirtual(generator func() []byte, setter func([]byte) error) {
+	extras := f.ensureExtras()
+	extras.generator = generator
+	extras.setter = setter
+}
+
+// Replaces the contents of a file with a copy of the given data
+// Returns an error if the file is a directory or the data exceeds `MaxFileSize`
+func (f *File) SetContents(data []byte) error {
+	if f.isDirectory {
+		return fmt.Errorf("File %s is a directory; cannot write", f.name)
+	}
+	if f.generator() != nil {
+		return f.writeVirtual(data)
+	}
+	if f.kind.IsSpecial() {
+		// Special files discard everything written to them
+		return nil
+	}
+	if len(data) > MaxFileSize {
+		return fmt.Errorf("Exceeded max file size: size=%d, max=%d", len(data), MaxFileSize)
+	}
+	f.contents = append([]byte{}, data...)
+	if f.extras != nil {
+		f.extras.holes = nil
+	}
+	return nil
+}
+
+// Writes the specified data (represented as a byte slice) to a file
+// Returns an error if the file is a directory or symbolic link, or the newData + exisitng contents
+// exceeds `MaxFileSize`
+func (f *File) WriteFileData(data []byte) error {
+	if f.isDirectory {
+		return fmt.Errorf("File %s is a directory; cannot write", f.name)
+	}
+	if f.kind == KindSymlink {
+		return fmt.Errorf("File %s is a symbolic link; cannot write", f.name)
+	}
+	if f.generator() != nil {
+		return f.writeVirtual(data)
+	}
+	if f.kind.IsSpecial() {
+		// Special files discard everything written to them
+		return nil
+	}
+	totalSize := len(f.contents) + len(data)
+	if totalSize > MaxFileSize {
+		return fmt.Errorf("Exceeded max file size: size=%d, max=%d", totalSize, MaxFileSize)
+	}
+	f.contents = append(f.contents, data...)
+	return nil
+}
+
+// Passes written data to the setter of a virtual file
+func (f *File) writeVirtual(data []byte) error {
+	if f.extras.setter == nil {
+		return fmt.Errorf("Virtual file %s is read-only", f.name)
+	}
+	return f.extras.setter(data)
+}
+
+// Returns a deep copy of the file and all of its children, attached to the given parent.
+// Contents are shared copy-on-write: the copied slices have no spare capacity, so the next
+// write to either file reallocates instead of modifying the shared bytes.
+func (f *File) Clone(parent *File) *File {
+	clone := NewFile(f.name, f.isDirectory, parent)
+	clone.contents = f.contents[:len(f.contents):len(f.contents)]
+	clone.generation = f.generation
+	clone.kind = f.kind
+	clone.mode = f.mode
+	clone.owner = f.owner
+	clone.modTime = f.modTime
+	if f.extras != nil {
+		extras := *f.extras
+		clone.extras = &extras
+	}
+	clone.shardSize = f.shardSize
+	clone.foldNames = f.foldNames
+	f.children.each(func(name string, child *File) {
+		clone.UpsertChild(name, child.Clone(clone))
+	})
+	return clone
+}
+
+// Helper function to get the full path name of a file by recursively traversing up the tree
+func getFullPathNameHelper(curr *File, start *File) string {
+	if curr == start || curr.parent == nil {
+		// Root directory or nil - base case
+		return ""
+	}
+
+	parent := curr.parent
+	return getFullPathNameHelper(parent, start) + "/" + curr.name
+}
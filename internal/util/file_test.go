@@ -0,0 +1,136 @@
+// file_test.go
+package util
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestChildren(t *testing.T) {
+	// Set up test subject
+	root := NewFile("/", true, nil)
+	for _, name := range []string{"c", "a", "b"} {
+		root.UpsertChild(name, NewFile(name, false, root))
+	}
+
+	// Children are sorted, and changing the copy doesn't change the tree
+	children := root.Children()
+	if len(children) != 3 || children[0].GetName() != "a" || children[2].GetName() != "c" {
+		t.Errorf("Expected children a, b, c but got %v", root.GetChildrenNames())
+	}
+	children[0] = nil
+	if root.GetChildByName("a") == nil {
+		t.Errorf("Expected modifying the copy to leave the tree alone")
+	}
+
+	// Ranging stops when visit returns false, and may remove children as it goes
+	visited := []string{}
+	root.RangeChildren(func(child *File) bool {
+		visited = append(visited, child.GetName())
+		root.RemoveChild(child.GetName())
+		return child.GetName() != "b"
+	})
+	if len(visited) != 2 || root.NumChildren() != 1 || root.GetChildByName("c") == nil {
+		t.Errorf("Expected to visit and remove a and b only but visited %v, leaving %v", visited, root.GetChildrenNames())
+	}
+}
+
+func TestChildrenStorage(t *testing.T) {
+	// Files and empty directories have no children table
+	root := NewFile("/", true, nil)
+	if root.children != nil || NewFile("file", false, root).children != nil {
+		t.Errorf("Expected no children table before the first child is added")
+	}
+
+	// Small directories use a sorted slice, larger ones a map, and shrinking goes back to a slice
+	names := []string{}
+	for i := 0; i < 2*smallTableSize; i++ {
+		name := fmt.Sprintf("%02d", 2*smallTableSize-i)
+		names = append(names, name)
+		root.UpsertChild(name, NewFile(name, false, root))
+		if inMap := root.children.entries != nil; inMap != (i >= smallTableSize) {
+			t.Errorf("With %d children, expected them in a map: %t", i+1, !inMap)
+		}
+	}
+	for i, name := range names {
+		root.RemoveChild(name)
+		left := len(names) - i - 1
+		if left > 0 && root.GetChildrenNames()[0] != names[len(names)-1] {
+			t.Errorf("With %d children, expected them to stay sorted but got %v", left, root.GetChildrenNames())
+		}
+		if left <= smallTableSize/2 && left > 0 && root.children.entries != nil {
+			t.Errorf("With %d children, expected them back in a slice", left)
+		}
+	}
+
+	// Removing the last child drops the table
+	if root.children != nil || root.NumChildren() != 0 || root.NumShards() != 0 {
+		t.Errorf("Expected no children table after removing every child")
+	}
+}
+
+func TestShareContents(t *testing.T) {
+	root := NewFile("/", true, nil)
+	a := NewFile("a", false, root)
+	b := NewFile("b", false, root)
+	a.SetContents([]byte("hello"))
+	b.SetContents([]byte("hello"))
+
+	if !b.ShareContents(a.GetContents()) || b.ShareContents([]byte("other")) {
+		t.Errorf("Expected only equal contents to be shared")
+	}
+	blockA, _ := a.ContentsBlock()
+	blockB, size := b.ContentsBlock()
+	if blockA != blockB || size != len("hello") {
+		t.Errorf("Expected a and b to share one block")
+	}
+
+	// Writing to one copies rather than modifying the shared block
+	b.WriteFileData([]byte(" world"))
+	if string(a.GetContents()) != "hello" || string(b.GetContents()) != "hello world" {
+		t.Errorf("Expected writes to leave shared contents alone, got %q and %q", a.GetContents(), b.GetContents())
+	}
+	if block, _ := root.ContentsBlock(); block != nil {
+		t.Errorf("Expected directories to have no contents block")
+	}
+}
+
+func TestInternedNames(t *testing.T) {
+	// Nodes with the same name share it, even when it was sliced from different paths
+	root := NewFile("/", true, nil)
+	a := NewFile(strings.Split("a/index.js", "/")[1], false, root)
+	b := NewFile(strings.Split("b/index.js", "/")[1], false, root)
+	if a.GetName() != "index.js" || unsafe.StringData(a.GetName()) != unsafe.StringData(b.GetName()) {
+		t.Errorf("Expected both nodes to share the name index.js")
+	}
+
+	// Renaming interns too, and long names are left alone
+	b.SetName(fmt.Sprint("index", ".js"))
+	if unsafe.StringData(a.GetName()) != unsafe.StringData(b.GetName()) {
+		t.Errorf("Expected the renamed node to share the name index.js")
+	}
+	long := strings.Repeat("x", maxInternedLength+1)
+	if c := NewFile(long, false, root); unsafe.StringData(c.GetName()) != unsafe.StringData(long) {
+		t.Errorf("Expected a name longer than %d bytes not to be interned", maxInternedLength)
+	}
+}
+
+// Builds a directory of 1000 files, reporting the memory used per node
+func BenchmarkBuildTree(b *testing.B) {
+	names := make([]string, 1000)
+	for i := range names {
+		names[i] = fmt.Sprintf("file-%04d", i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root := NewFile("/", true, nil)
+		for _, name := range names {
+			dir := NewFile(name, true, root)
+			root.UpsertChild(name, dir)
+			dir.UpsertChild(name, NewFile(name, false, dir))
+		}
+	}
+}
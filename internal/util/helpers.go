@@ -1,10 +1,32 @@
 package util
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
 
+// Returned by WalkToEndOfPath when an element of the path isn't a directory in the tree
+var ErrDirNotFound = errors.New("Directory not found")
+
+// A failure to resolve one element of a path
+type ResolveError struct {
+	// Why the element couldn't be resolved, e.g. ErrDirNotFound
+	Err error
+	// The element that couldn't be resolved
+	Segment string
+	// The directory resolution started from
+	Start *File
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Err, e.Segment)
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
 // Splits a string into slice of strings separated by "/"
 func SplitPath(path string) []string {
 	var paths = []string{}
@@ -17,6 +39,11 @@ func SplitPath(path string) []string {
 	return paths
 }
 
+// Joins path elements into an absolute path (e.g. ["a", "b"] becomes "/a/b")
+func JoinPath(pathSplit []string) string {
+	return "/" + strings.Join(pathSplit, "/")
+}
+
 // Check if a file exists in the diven directory. "isDir" is used to specify whether we should
 // check if it's a file or directory
 func ExistsInCurrentDir(dir *File, name string, isDir bool) bool {
@@ -25,18 +52,27 @@ func ExistsInCurrentDir(dir *File, name string, isDir bool) bool {
 
 // Recursively traverse the directory tree until we reach the root directory,
 // adding the current directory names to a list as we go
-func PwdRecursion(dirs *[]string, curr *File) {
+func PwdRecursion(dirs *[]string, curr *File, root *File) {
 	parent := curr.GetParent()
-	if parent == nil {
+	if curr == root || parent == nil {
 		// root directory - base case
 		*dirs = []string{""}
 		return
 	}
 
-	PwdRecursion(dirs, parent)
+	PwdRecursion(dirs, parent, root)
 	*dirs = append(*dirs, curr.GetName())
 }
 
+// Applies f to every element of the slice, returning the results in the same order
+func Map[T any, U any](data []T, f func(T) U) []U {
+	result := make([]U, 0, len(data))
+	for _, d := range data {
+		result = append(result, f(d))
+	}
+	return result
+}
+
 // Convert a slice of Files into a string slice, using the filename
 func FileSliceToString(data []*File, root *File) []string {
 	allMatches := []string{}
@@ -46,15 +82,15 @@ func FileSliceToString(data []*File, root *File) []string {
 	return allMatches
 }
 
-// Breadth-first serach implementation used for searching files within the filesystem
-// Uses a map
-func BFS(node *File, target string) []*File {
+// Breadth-first serach implementation used for searching files within the filesystem, returning
+// the nodes whose names match. Uses a map
+func BFS(node *File, match func(name string) bool) []*File {
 	if node == nil {
 		return nil
 	}
 
 	// Keep track of all nodes we've already visited (optimization)
-	visited := make(map[string]bool)
+	visited := make(map[*File]bool)
 
 	// Use a queue for inspecting nodes
 	queue := queue{node}
@@ -64,62 +100,74 @@ func BFS(node *File, target string) []*File {
 		// Take the next node off the queue
 		next, _ := queue.PopFront()
 		// If we've already seen it, skip
-		if visited[next.GetName()] {
+		if visited[next] {
 			continue
 		}
-		visited[next.GetName()] = true
+		visited[next] = true
 
-		if next.GetName() == target {
+		if match(next.GetName()) {
 			// Found a match, so add it to the result
 			result = append(result, next)
 		}
 
 		// Add all the child nodes to the queue for inspection
-		for _, child := range next.GetChildren() {
+		next.RangeChildren(func(child *File) bool {
 			queue.PushBack(child)
-		}
+			return true
+		})
 	}
 
 	// Empty result indicates none found
 	return result
 }
 
-// Recursively remove files depth-first down to the leaf nodes
-func RmRecursion(curr *File) {
+// Recursively removes a file and all of its descendants, post-order (children before their
+// parents). Before each node is detached, "removed" is called with it (if not nil) so that any
+// state kept about it can be cleaned up. Returns the number of nodes removed.
+func RmRecursion(curr *File, removed func(*File)) int {
 	if curr == nil || curr.GetParent() == nil {
 		// base case
-		return
+		return 0
 	}
 
-	delete(curr.GetParent().GetChildren(), curr.GetName())
-	for _, c := range curr.GetChildren() {
+	count := 0
+	curr.RangeChildren(func(c *File) bool {
 		// loop through all children nodes and remove subdirectories recursively
-		RmRecursion(c)
+		count += RmRecursion(c, removed)
+		return true
+	})
+
+	if removed != nil {
+		removed(curr)
 	}
+	curr.GetParent().RemoveChild(curr.GetName())
+	return count + 1
 }
 
-// Traverse from the current directory to the specified path, using an absolute or relative path
+// Traverse from the current directory to the specified path, using an absolute or relative path.
+// Fails with a *ResolveError naming the first element that isn't a directory.
 func WalkToEndOfPath(pathSplit []string, currentDirectory *File, root *File) (*File, error) {
 	wd := currentDirectory
 
 	// If the path name starts with "~", this is an absolute path - start from the root
 	// Else start from the current working directory
-	if pathSplit[0] == "~" {
+	if len(pathSplit) > 0 && pathSplit[0] == "~" {
 		wd = root
 		pathSplit = pathSplit[1:]
 	}
+	start := wd
 
 	for _, name := range pathSplit {
 		if name == ".." {
 			// If we see ".." we're trying to navigate one directory up in the tree
 			// Set the current directory to its parent
-			if wd.GetParent() != nil {
+			if wd != root && wd.GetParent() != nil {
 				wd = wd.GetParent()
 			} else {
 				// This means we're already at the root, so we shouldn't need to do anything
 			}
 		} else if !ExistsInCurrentDir(wd, name, true) {
-			return nil, fmt.Errorf("Directory not found: %s", name)
+			return nil, &ResolveError{Err: ErrDirNotFound, Segment: name, Start: start}
 		} else {
 			// Advance to the child node by name
 			wd = wd.GetChildByName(name)
@@ -128,6 +176,29 @@ func WalkToEndOfPath(pathSplit []string, currentDirectory *File, root *File) (*F
 	return wd, nil
 }
 
+// Returns the file or directory at the given path relative to "start", or nil if any part of the
+// path doesn't exist. Unlike WalkToEndOfPath, the final element may be a file.
+func LookupPath(start *File, path string) *File {
+	curr := start
+	for _, name := range SplitPath(path) {
+		curr = curr.GetChildByName(name)
+		if curr == nil {
+			return nil
+		}
+	}
+	return curr
+}
+
+// Returns true if "ancestor" is "f" itself or one of its parents
+func IsAncestor(ancestor *File, f *File) bool {
+	for curr := f; curr != nil; curr = curr.GetParent() {
+		if curr == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
 // Convert a slice of strings to a byte slice
 func StringSliceToByteSlice(strSlice []string) []byte {
 	var byteSlice []byte
@@ -150,3 +221,13 @@ func ModifyNameToHandleCollisions(name string) string {
 	}
 	return name
 }
+
+// Visits the node and all of its descendants depth-first, parents before children. Children are
+// visited in alphabetical order so that the traversal is deterministic.
+func WalkTree(node *File, visit func(*File)) {
+	visit(node)
+
+	for _, child := range node.Children() {
+		WalkTree(child, visit)
+	}
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"strings"
+	"sync"
+)
+
+// Names longer than this aren't interned, since long names are rarely repeated
+const maxInternedLength = 64
+
+// Once this many names are interned, new ones are no longer added, so the table can't grow
+// without bound. Names interned by then (usually the common ones, like "index.js" or
+// ".gitignore") keep being shared.
+const maxInternedNames = 1 << 16
+
+// The names shared between nodes. Trees imported from real projects repeat the same names
+// thousands of times, so storing each once saves memory, and stops a node's name from keeping
+// alive the whole path it was split from. Comparing two interned names is also quick, since
+// equal strings with the same data are recognized without comparing their bytes.
+var internedNames struct {
+	sync.RWMutex
+	table map[string]string
+}
+
+// Returns a string equal to s, shared with every other node of that name when possible
+func intern(s string) string {
+	if len(s) == 0 || len(s) > maxInternedLength {
+		return s
+	}
+	internedNames.RLock()
+	shared, ok := internedNames.table[s]
+	internedNames.RUnlock()
+	if ok {
+		return shared
+	}
+
+	internedNames.Lock()
+	defer internedNames.Unlock()
+	if shared, ok := internedNames.table[s]; ok {
+		return shared
+	}
+	if internedNames.table == nil {
+		internedNames.table = make(map[string]string)
+	}
+	if len(internedNames.table) >= maxInternedNames {
+		return s
+	}
+	// Copy the name, so the table doesn't keep a larger string it was sliced from alive
+	s = strings.Clone(s)
+	internedNames.table[s] = s
+	return s
+}
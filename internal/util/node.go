@@ -0,0 +1,138 @@
+package util
+
+import (
+	"time"
+)
+
+// Behaviour shared by every node in the tree, whatever its type. Use File.Node to get the
+// concrete type (Dir, RegularFile or Symlink) of a node, so that only the operations that make
+// sense for it are available.
+type Node interface {
+	GetName() string
+	GetParent() *File
+	GetFullPathName(root *File) string
+	GetGeneration() uint64
+	GetModTime() time.Time
+	// Returns the underlying storage, for code that still works with *File directly
+	File() *File
+}
+
+// The storage and methods shared by every node type
+type node struct {
+	f *File
+}
+
+func (n node) GetName() string                   { return n.f.GetName() }
+func (n node) GetParent() *File                  { return n.f.GetParent() }
+func (n node) GetFullPathName(root *File) string { return n.f.GetFullPathName(root) }
+func (n node) GetGeneration() uint64             { return n.f.GetGeneration() }
+func (n node) GetModTime() time.Time             { return n.f.GetModTime() }
+func (n node) File() *File                       { return n.f }
+
+// A directory, which has children but no contents
+type Dir struct {
+	node
+}
+
+// A file, which has contents but no children. Pipes and special nodes are regular files with a
+// different kind.
+type RegularFile struct {
+	node
+}
+
+// A symbolic link, which stores the path it points to
+type Symlink struct {
+	node
+}
+
+// Creates a new, empty directory
+func NewDir(name string, parent *File) Dir {
+	return Dir{node{NewFile(name, true, parent)}}
+}
+
+// Creates a new, empty regular file
+func NewRegularFile(name string, parent *File) RegularFile {
+	return RegularFile{node{NewFile(name, false, parent)}}
+}
+
+// Creates a new symbolic link pointing at target. The target doesn't have to exist.
+func NewSymlink(name string, target string, parent *File) Symlink {
+	f := NewFile(name, false, parent)
+	f.kind = KindSymlink
+	f.contents = []byte(target)
+	return Symlink{node{f}}
+}
+
+// Returns the node as its concrete type: a Dir, RegularFile or Symlink
+func (f *File) Node() Node {
+	if f.isDirectory {
+		return Dir{node{f}}
+	}
+	if f.kind == KindSymlink {
+		return Symlink{node{f}}
+	}
+	return RegularFile{node{f}}
+}
+
+// Returns the node as a directory, or false if it isn't one
+func (f *File) AsDir() (Dir, bool) {
+	d, ok := f.Node().(Dir)
+	return d, ok
+}
+
+// Returns the node as a regular file, or false if it is a directory or symbolic link
+func (f *File) AsRegularFile() (RegularFile, bool) {
+	r, ok := f.Node().(RegularFile)
+	return r, ok
+}
+
+// Returns the node as a symbolic link, or false if it isn't one
+func (f *File) AsSymlink() (Symlink, bool) {
+	s, ok := f.Node().(Symlink)
+	return s, ok
+}
+
+func (f *File) IsSymlink() bool {
+	return f.kind == KindSymlink
+}
+
+// Directory methods
+func (d Dir) Child(name string) *File {
+	return d.f.GetChildByName(name)
+}
+
+func (d Dir) ChildNames() []string {
+	return d.f.GetChildrenNames()
+}
+
+func (d Dir) UpsertChild(name string, file *File) {
+	d.f.UpsertChild(name, file)
+}
+
+func (d Dir) RemoveChild(name string) {
+	d.f.RemoveChild(name)
+}
+
+// Regular file methods
+func (r RegularFile) Kind() FileKind {
+	return r.f.GetKind()
+}
+
+func (r RegularFile) Contents() []byte {
+	return r.f.GetContents()
+}
+
+// Appends data to the contents (see File.WriteFileData)
+func (r RegularFile) Write(data []byte) error {
+	return r.f.WriteFileData(data)
+}
+
+// Replaces the contents (see File.SetContents)
+func (r RegularFile) SetContents(data []byte) error {
+	return r.f.SetContents(data)
+}
+
+// Symbolic link methods
+func (s Symlink) Target() string {
+	return string(s.f.contents)
+}
@@ -0,0 +1,600 @@
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// A minimal reader and writer for the SQLite database file format
+// (https://www.sqlite.org/fileformat.html), covering what's needed to store rowid tables: no
+// indexes, no free pages and UTF-8 text only. Files written here open in the sqlite3 shell (and
+// pass its integrity_check), and files modified there can be read back as long as they stay
+// within those limits.
+
+// The page size of written databases
+const sqlitePageSize = 4096
+
+const sqliteMagic = "SQLite format 3\x00"
+
+// Page types of table b-trees
+const (
+	sqliteInteriorPage byte = 0x05
+	sqliteLeafPage     byte = 0x0d
+)
+
+// A rowid table. Values are nil, int64, float64, string or []byte.
+type SQLiteTable struct {
+	Name string
+	// The CREATE TABLE statement
+	Schema string
+	Rows   []SQLiteRow
+}
+
+// A row of a rowid table. A column declared INTEGER PRIMARY KEY is an alias for the rowid, and is
+// stored as nil in Values.
+type SQLiteRow struct {
+	ID     int64
+	Values []any
+}
+
+// Writes a database holding the given tables. The rows of each table must be sorted by ID.
+//
+// Parameters:
+//
+//	w (io.Writer) - where to write the database
+//	tables ([]*SQLiteTable) - the tables to store
+//
+// Returns:
+//
+//	error - an error if a value has an unsupported type, the rows aren't sorted or writing fails
+func WriteSQLite(w io.Writer, tables []*SQLiteTable) error {
+	p := &sqlitePager{pages: [][]byte{make([]byte, sqlitePageSize)}}
+	schema := []SQLiteRow{}
+	for i, table := range tables {
+		cells := make([]sqliteCell, len(table.Rows))
+		for j, row := range table.Rows {
+			if j > 0 && row.ID <= table.Rows[j-1].ID {
+				return fmt.Errorf("Rows of table %s aren't sorted by ID", table.Name)
+			}
+			payload, err := encodeSQLiteRecord(row.Values)
+			if err != nil {
+				return fmt.Errorf("Table %s: %s", table.Name, err)
+			}
+			cells[j] = p.leafCell(row.ID, payload)
+		}
+		root := p.buildTree(cells, 0)
+		schema = append(schema, SQLiteRow{ID: int64(i + 1), Values: []any{"table", table.Name, table.Name, int64(root), table.Schema}})
+	}
+
+	// The schema table is rooted on page 1, after the database header
+	cells := make([]sqliteCell, len(schema))
+	for i, row := range schema {
+		payload, _ := encodeSQLiteRecord(row.Values)
+		cells[i] = p.leafCell(row.ID, payload)
+	}
+	p.buildTree(cells, 1)
+
+	header := p.pages[0][:100]
+	copy(header, sqliteMagic)
+	binary.BigEndian.PutUint16(header[16:], sqlitePageSize)
+	// File format versions (legacy, i.e. rollback journal) and payload fractions
+	header[18], header[19] = 1, 1
+	header[21], header[22], header[23] = 64, 32, 32
+	// File change counter, database size and the change counter the size is valid for
+	binary.BigEndian.PutUint32(header[24:], 1)
+	binary.BigEndian.PutUint32(header[28:], uint32(len(p.pages)))
+	binary.BigEndian.PutUint32(header[92:], 1)
+	// Schema cookie, schema format and text encoding (UTF-8)
+	binary.BigEndian.PutUint32(header[40:], 1)
+	binary.BigEndian.PutUint32(header[44:], 4)
+	binary.BigEndian.PutUint32(header[56:], 1)
+	binary.BigEndian.PutUint32(header[96:], 3045000)
+
+	for _, page := range p.pages {
+		if _, err := w.Write(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Allocates the pages of a database being written
+type sqlitePager struct {
+	pages [][]byte
+}
+
+// A cell of a b-tree page, with the largest rowid it covers
+type sqliteCell struct {
+	id   int64
+	data []byte
+}
+
+// Returns a new page and its number
+func (p *sqlitePager) alloc() ([]byte, int) {
+	page := make([]byte, sqlitePageSize)
+	p.pages = append(p.pages, page)
+	return page, len(p.pages)
+}
+
+// Returns a leaf cell for a row, moving the end of a large payload to overflow pages
+func (p *sqlitePager) leafCell(id int64, payload []byte) sqliteCell {
+	data := putSQLiteVarint(nil, uint64(len(payload)))
+	data = putSQLiteVarint(data, uint64(id))
+	local := sqliteLocalPayload(len(payload), sqlitePageSize)
+	data = append(data, payload[:local]...)
+	if local == len(payload) {
+		return sqliteCell{id, data}
+	}
+
+	rest := payload[local:]
+	page, number := p.alloc()
+	data = binary.BigEndian.AppendUint32(data, uint32(number))
+	for {
+		n := copy(page[4:], rest)
+		rest = rest[n:]
+		if len(rest) == 0 {
+			return sqliteCell{id, data}
+		}
+		next, number := p.alloc()
+		binary.BigEndian.PutUint32(page, uint32(number))
+		page = next
+	}
+}
+
+// Builds a table b-tree from leaf cells sorted by rowid, returning its root page. The root is
+// put on page 1 (after the database header) if root is 1, and on a new page otherwise.
+func (p *sqlitePager) buildTree(cells []sqliteCell, root int) int {
+	offset := 0
+	if root == 1 {
+		offset = 100
+	}
+	kind := sqliteLeafPage
+	for {
+		groups := packSQLiteCells(cells, offset, kind)
+		if len(groups) == 1 {
+			page, number := p.pages[0], 1
+			if root != 1 {
+				page, number = p.alloc()
+			}
+			writeSQLitePage(page, offset, kind, groups[0])
+			return number
+		}
+
+		// Each page of this level becomes a child of the level above, keyed by the largest rowid
+		// below it
+		cells = make([]sqliteCell, len(groups))
+		for i, group := range groups {
+			page, number := p.alloc()
+			writeSQLitePage(page, 0, kind, group)
+			data := binary.BigEndian.AppendUint32(nil, uint32(number))
+			cells[i] = sqliteCell{group.last, putSQLiteVarint(data, uint64(group.last))}
+		}
+		kind = sqliteInteriorPage
+	}
+}
+
+// The cells of one page. On interior pages the last child has no cell of its own: its page
+// number is the right pointer.
+type sqliteGroup struct {
+	cells []sqliteCell
+	right uint32
+	last  int64
+}
+
+// Splits cells into pages, filling each as far as it goes
+func packSQLiteCells(cells []sqliteCell, offset int, kind byte) []sqliteGroup {
+	headerSize := 8
+	if kind == sqliteInteriorPage {
+		headerSize = 12
+	}
+	capacity := sqlitePageSize - offset - headerSize
+	lists := [][]sqliteCell{{}}
+	used := 0
+	for _, cell := range cells {
+		current := lists[len(lists)-1]
+		if used+len(cell.data)+2 > capacity && len(current) > 0 {
+			lists = append(lists, []sqliteCell{})
+			used = 0
+		}
+		lists[len(lists)-1] = append(lists[len(lists)-1], cell)
+		used += len(cell.data) + 2
+	}
+	// An interior page needs at least two children, so a lone last child takes one from the
+	// page before it (which has room to spare, having lost a cell)
+	if n := len(lists); kind == sqliteInteriorPage && n > 1 && len(lists[n-1]) == 1 {
+		prev := lists[n-2]
+		lists[n-1] = append([]sqliteCell{prev[len(prev)-1]}, lists[n-1]...)
+		lists[n-2] = prev[:len(prev)-1]
+	}
+
+	groups := make([]sqliteGroup, len(lists))
+	for i, list := range lists {
+		if len(list) == 0 {
+			continue
+		}
+		groups[i] = sqliteGroup{cells: list, last: list[len(list)-1].id}
+		if kind == sqliteInteriorPage {
+			groups[i].right = binary.BigEndian.Uint32(list[len(list)-1].data)
+			groups[i].cells = list[:len(list)-1]
+		}
+	}
+	return groups
+}
+
+// Writes a b-tree page: the header at offset, then the cell pointers, with the cells packed at
+// the end of the page
+func writeSQLitePage(page []byte, offset int, kind byte, group sqliteGroup) {
+	headerSize := 8
+	if kind == sqliteInteriorPage {
+		headerSize = 12
+		binary.BigEndian.PutUint32(page[offset+8:], group.right)
+	}
+	page[offset] = kind
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(group.cells)))
+	top := len(page)
+	for i, cell := range group.cells {
+		top -= len(cell.data)
+		copy(page[top:], cell.data)
+		binary.BigEndian.PutUint16(page[offset+headerSize+2*i:], uint16(top))
+	}
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(top))
+}
+
+// Returns how much of a payload of the given size is stored in its table leaf cell, the rest
+// going to overflow pages
+func sqliteLocalPayload(size int, usable int) int {
+	maxLocal := usable - 35
+	if size <= maxLocal {
+		return size
+	}
+	minLocal := (usable-12)*32/255 - 23
+	local := minLocal + (size-minLocal)%(usable-4)
+	if local > maxLocal {
+		return minLocal
+	}
+	return local
+}
+
+// Encodes values as a record: a header of serial types, then the values
+func encodeSQLiteRecord(values []any) ([]byte, error) {
+	types := []byte{}
+	body := []byte{}
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			types = putSQLiteVarint(types, 0)
+		case int64:
+			serialType, size := sqliteIntType(v)
+			types = putSQLiteVarint(types, serialType)
+			for i := size - 1; i >= 0; i-- {
+				body = append(body, byte(v>>(8*i)))
+			}
+		case float64:
+			types = putSQLiteVarint(types, 7)
+			body = binary.BigEndian.AppendUint64(body, math.Float64bits(v))
+		case string:
+			types = putSQLiteVarint(types, uint64(13+2*len(v)))
+			body = append(body, v...)
+		case []byte:
+			types = putSQLiteVarint(types, uint64(12+2*len(v)))
+			body = append(body, v...)
+		default:
+			return nil, fmt.Errorf("Unsupported value type %T", value)
+		}
+	}
+	// The header size counts itself
+	size := len(types) + 1
+	if len(putSQLiteVarint(nil, uint64(size))) > 1 {
+		size = len(types) + len(putSQLiteVarint(nil, uint64(len(types)+2)))
+	}
+	record := putSQLiteVarint(nil, uint64(size))
+	record = append(record, types...)
+	return append(record, body...), nil
+}
+
+// Returns the serial type storing an integer and its size in bytes
+func sqliteIntType(v int64) (uint64, int) {
+	switch {
+	case v == 0:
+		return 8, 0
+	case v == 1:
+		return 9, 0
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return 1, 1
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return 2, 2
+	case v >= -1<<23 && v < 1<<23:
+		return 3, 3
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return 4, 4
+	case v >= -1<<47 && v < 1<<47:
+		return 5, 6
+	default:
+		return 6, 8
+	}
+}
+
+// Appends a SQLite varint: big-endian groups of 7 bits, with the high bit set on all but the
+// last, and a full byte in the ninth position
+func putSQLiteVarint(buf []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var b [9]byte
+		b[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			b[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(buf, b[:]...)
+	}
+	var b [8]byte
+	n := 0
+	for {
+		b[n] = byte(v & 0x7f)
+		n++
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		c := b[i]
+		if i > 0 {
+			c |= 0x80
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+// Reads a SQLite varint, returning it and its length, which is 0 if buf is too short
+func sqliteVarint(buf []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8 && i < len(buf); i++ {
+		v = v<<7 | uint64(buf[i]&0x7f)
+		if buf[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	if len(buf) < 9 {
+		return 0, 0
+	}
+	return v<<8 | uint64(buf[8]), 9
+}
+
+var errSQLiteCorrupt = errors.New("Malformed SQLite database")
+
+// Reads the tables of a database, keyed by name. Indexes, views and triggers are ignored.
+//
+// Parameters:
+//
+//	data ([]byte) - the database file
+//
+// Returns:
+//
+//	map[string]*SQLiteTable - the tables, with their rows sorted by ID
+//	error - an error if the data isn't a SQLite database or uses unsupported features
+func ReadSQLite(data []byte) (map[string]*SQLiteTable, error) {
+	if len(data) < 100 || string(data[:len(sqliteMagic)]) != sqliteMagic {
+		return nil, errors.New("Not a SQLite database")
+	}
+	pageSize := int(binary.BigEndian.Uint16(data[16:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || len(data)%pageSize != 0 {
+		return nil, fmt.Errorf("%w: invalid page size %d", errSQLiteCorrupt, pageSize)
+	}
+	if encoding := binary.BigEndian.Uint32(data[56:]); encoding > 1 {
+		return nil, fmt.Errorf("Unsupported SQLite text encoding %d; only UTF-8 is supported", encoding)
+	}
+	r := &sqliteReader{data: data, pageSize: pageSize, usable: pageSize - int(data[20])}
+
+	schema, err := r.readTree(1)
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string]*SQLiteTable)
+	for _, row := range schema {
+		if len(row.Values) < 5 {
+			return nil, fmt.Errorf("%w: invalid schema row", errSQLiteCorrupt)
+		}
+		kind, _ := row.Values[0].(string)
+		name, _ := row.Values[1].(string)
+		root, _ := row.Values[3].(int64)
+		sql, _ := row.Values[4].(string)
+		// Virtual tables and views have no root page
+		if kind != "table" || root == 0 {
+			continue
+		}
+		rows, err := r.readTree(int(root))
+		if err != nil {
+			return nil, fmt.Errorf("Table %s: %w", name, err)
+		}
+		tables[name] = &SQLiteTable{Name: name, Schema: sql, Rows: rows}
+	}
+	return tables, nil
+}
+
+type sqliteReader struct {
+	data     []byte
+	pageSize int
+	usable   int
+}
+
+// Returns the page with the given number
+func (r *sqliteReader) page(number int) ([]byte, error) {
+	if number < 1 || number*r.pageSize > len(r.data) {
+		return nil, fmt.Errorf("%w: page %d out of range", errSQLiteCorrupt, number)
+	}
+	return r.data[(number-1)*r.pageSize : number*r.pageSize], nil
+}
+
+// Reads the rows of the table b-tree rooted at the given page, in rowid order
+func (r *sqliteReader) readTree(root int) ([]SQLiteRow, error) {
+	rows := []SQLiteRow{}
+	// Each page belongs to a single b-tree node, so a page seen twice is a cycle, or pages shared
+	// between subtrees, which would otherwise be read over and over
+	visited := map[int]bool{}
+	var visit func(number int, depth int) error
+	visit = func(number int, depth int) error {
+		// Even a huge table is only a few levels deep; anything deeper is a cycle
+		if depth > 64 {
+			return fmt.Errorf("%w: b-tree too deep", errSQLiteCorrupt)
+		}
+		if visited[number] {
+			return fmt.Errorf("%w: page %d is used twice", errSQLiteCorrupt, number)
+		}
+		visited[number] = true
+		page, err := r.page(number)
+		if err != nil {
+			return err
+		}
+		offset := 0
+		if number == 1 {
+			offset = 100
+		}
+		kind := page[offset]
+		count := int(binary.BigEndian.Uint16(page[offset+3:]))
+		headerSize := 8
+		if kind == sqliteInteriorPage {
+			headerSize = 12
+		} else if kind != sqliteLeafPage {
+			return fmt.Errorf("%w: page %d is not a table b-tree page", errSQLiteCorrupt, number)
+		}
+		if offset+headerSize+2*count > len(page) {
+			return fmt.Errorf("%w: too many cells on page %d", errSQLiteCorrupt, number)
+		}
+
+		for i := 0; i < count; i++ {
+			start := int(binary.BigEndian.Uint16(page[offset+headerSize+2*i:]))
+			if start >= r.usable {
+				return fmt.Errorf("%w: cell out of range on page %d", errSQLiteCorrupt, number)
+			}
+			cell := page[start:r.usable]
+			if kind == sqliteInteriorPage {
+				if len(cell) < 4 {
+					return fmt.Errorf("%w: truncated cell on page %d", errSQLiteCorrupt, number)
+				}
+				if err := visit(int(binary.BigEndian.Uint32(cell)), depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			row, err := r.readCell(cell)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+		if kind == sqliteInteriorPage {
+			return visit(int(binary.BigEndian.Uint32(page[offset+8:])), depth+1)
+		}
+		return nil
+	}
+	if err := visit(root, 0); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Reads a table leaf cell, following its overflow pages
+func (r *sqliteReader) readCell(cell []byte) (SQLiteRow, error) {
+	size, n := sqliteVarint(cell)
+	id, m := sqliteVarint(cell[n:])
+	if n == 0 || m == 0 || size > uint64(len(r.data)) {
+		return SQLiteRow{}, fmt.Errorf("%w: invalid cell", errSQLiteCorrupt)
+	}
+	cell = cell[n+m:]
+	local := sqliteLocalPayload(int(size), r.usable)
+	if local > len(cell) {
+		return SQLiteRow{}, fmt.Errorf("%w: truncated cell", errSQLiteCorrupt)
+	}
+	payload := append([]byte{}, cell[:local]...)
+	if local < int(size) {
+		if len(cell) < local+4 {
+			return SQLiteRow{}, fmt.Errorf("%w: truncated cell", errSQLiteCorrupt)
+		}
+		next := int(binary.BigEndian.Uint32(cell[local:]))
+		for len(payload) < int(size) {
+			page, err := r.page(next)
+			if err != nil {
+				return SQLiteRow{}, err
+			}
+			chunk := page[4:r.usable]
+			if remaining := int(size) - len(payload); len(chunk) > remaining {
+				chunk = chunk[:remaining]
+			}
+			payload = append(payload, chunk...)
+			next = int(binary.BigEndian.Uint32(page))
+		}
+	}
+	values, err := decodeSQLiteRecord(payload)
+	if err != nil {
+		return SQLiteRow{}, err
+	}
+	return SQLiteRow{ID: int64(id), Values: values}, nil
+}
+
+// Decodes a record into its values
+func decodeSQLiteRecord(record []byte) ([]any, error) {
+	headerSize, n := sqliteVarint(record)
+	if n == 0 || headerSize < uint64(n) || headerSize > uint64(len(record)) {
+		return nil, fmt.Errorf("%w: invalid record header", errSQLiteCorrupt)
+	}
+	header, body := record[n:headerSize], record[headerSize:]
+	values := []any{}
+	for len(header) > 0 {
+		serialType, n := sqliteVarint(header)
+		if n == 0 {
+			return nil, fmt.Errorf("%w: invalid record header", errSQLiteCorrupt)
+		}
+		header = header[n:]
+
+		var size uint64
+		switch {
+		case serialType >= 1 && serialType <= 4:
+			size = serialType
+		case serialType == 5:
+			size = 6
+		case serialType == 6 || serialType == 7:
+			size = 8
+		case serialType >= 12:
+			size = (serialType - 12) / 2
+		case serialType == 10 || serialType == 11:
+			return nil, fmt.Errorf("%w: reserved serial type %d", errSQLiteCorrupt, serialType)
+		}
+		// Compared before converting, so a huge length can't wrap around to a negative int
+		if size > uint64(len(body)) {
+			return nil, fmt.Errorf("%w: truncated record", errSQLiteCorrupt)
+		}
+		field := body[:size]
+		body = body[size:]
+
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType == 8:
+			values = append(values, int64(0))
+		case serialType == 9:
+			values = append(values, int64(1))
+		case serialType == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(field)))
+		case serialType <= 6:
+			// Sign-extend the big-endian integer
+			v := int64(int8(field[0]))
+			for _, b := range field[1:] {
+				v = v<<8 | int64(b)
+			}
+			values = append(values, v)
+		case serialType%2 == 0:
+			values = append(values, append([]byte{}, field...))
+		default:
+			values = append(values, string(field))
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,29 @@
+// sqlite_test.go
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzReadSQLite(f *testing.F) {
+	// Seed with a valid database, with a row big enough to need overflow pages
+	var buf bytes.Buffer
+	err := WriteSQLite(&buf, []*SQLiteTable{{
+		Name:   "t",
+		Schema: "CREATE TABLE t(id INTEGER PRIMARY KEY, name TEXT, data BLOB)",
+		Rows: []SQLiteRow{
+			{ID: 1, Values: []any{nil, "a", []byte("hello")}},
+			{ID: 2, Values: []any{nil, "b", bytes.Repeat([]byte("x"), 3*sqlitePageSize)}},
+		},
+	}})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes())
+
+	// Malformed databases are reported as errors, never panics
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ReadSQLite(data)
+	})
+}
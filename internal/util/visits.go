@@ -0,0 +1,75 @@
+package util
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// The trees whose node visits are being counted, by root (see CountVisits)
+var visitCounters struct {
+	sync.RWMutex
+	byRoot map[*File]*visitCounter
+}
+
+// How many counts are running, so lookups and listings skip the bookkeeping when there are none
+var countingVisits atomic.Int32
+
+// The visits counted for one tree, shared by the counts running for it
+type visitCounter struct {
+	visits atomic.Uint64
+	users  int
+}
+
+// Counts n children of f as visited, if the tree f belongs to is being counted
+func countVisits(f *File, n int) {
+	if countingVisits.Load() == 0 || n == 0 {
+		return
+	}
+	for f.parent != nil {
+		f = f.parent
+	}
+	visitCounters.RLock()
+	counter := visitCounters.byRoot[f]
+	visitCounters.RUnlock()
+	if counter != nil {
+		counter.visits.Add(uint64(n))
+	}
+}
+
+// Starts counting the nodes visited in the tree under root: every child returned by
+// GetChildByName or Children (and therefore by the walks built on them). Other trees aren't
+// counted, and nothing is counted while no count is running. Counts may overlap, e.g. when
+// nested.
+//
+// Parameters:
+//
+//	root (*File) - the root of the tree, which has no parent
+//
+// Returns:
+//
+//	func() uint64 - stops the count and returns how many nodes were visited since it started
+func CountVisits(root *File) func() uint64 {
+	visitCounters.Lock()
+	defer visitCounters.Unlock()
+	if visitCounters.byRoot == nil {
+		visitCounters.byRoot = make(map[*File]*visitCounter)
+	}
+	counter := visitCounters.byRoot[root]
+	if counter == nil {
+		counter = &visitCounter{}
+		visitCounters.byRoot[root] = counter
+	}
+	counter.users++
+	countingVisits.Add(1)
+	start := counter.visits.Load()
+	return func() uint64 {
+		visitCounters.Lock()
+		defer visitCounters.Unlock()
+		counter.users--
+		if counter.users == 0 {
+			delete(visitCounters.byRoot, root)
+		}
+		countingVisits.Add(-1)
+		return counter.visits.Load() - start
+	}
+}
@@ -0,0 +1,460 @@
+// Package osshim lets applications switch between the real filesystem and an in-memory one with a
+// single injection point. Code that would call os and filepath functions directly calls them on
+// an FS instead:
+//
+//	type App struct {
+//		FS osshim.FS
+//	}
+//
+//	app := App{FS: osshim.OS{}}                               // in production
+//	app := App{FS: osshim.NewMemory(imfs.NewFileSystem())}    // in tests
+//
+// Both implementations return errors like the os package does: a *fs.PathError wrapping a
+// syscall.Errno, so checks such as errors.Is(err, fs.ErrNotExist) work the same on either.
+package osshim
+
+import (
+	"github.com/bwent/in-memory-fs/imfs"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The os and filepath functions an application can call through a shim
+type FS interface {
+	// Opens a file for reading, like os.Open
+	Open(name string) (File, error)
+	// Reads a whole file, like os.ReadFile
+	ReadFile(name string) ([]byte, error)
+	// Replaces the contents of a file, creating it with perm if it doesn't exist, like os.WriteFile
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	// Creates a directory and any missing parents with perm, like os.MkdirAll
+	MkdirAll(path string, perm os.FileMode) error
+	// Removes a file or empty directory, like os.Remove
+	Remove(name string) error
+	// Describes a file, following symbolic links, like os.Stat
+	Stat(name string) (os.FileInfo, error)
+	// Calls fn for every file and directory in a tree in lexical order, like filepath.Walk
+	Walk(root string, fn filepath.WalkFunc) error
+}
+
+// A file opened for reading. *os.File implements it.
+type File interface {
+	io.Reader
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+// An FS using the real filesystem through the os and filepath packages
+type OS struct{}
+
+func (OS) Open(name string) (File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		// So the interface isn't a non-nil File holding a nil *os.File
+		return nil, err
+	}
+	return f, nil
+}
+
+func (OS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (OS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (OS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (OS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OS) Walk(root string, fn filepath.WalkFunc) error {
+	return filepath.Walk(root, fn)
+}
+
+// An FS backed by an in-memory filesystem. Paths starting with "/" (or "~") are resolved from the
+// filesystem's root, others from its current directory, and may use "\" as a separator on any
+// platform. Operations run through the filesystem itself, so its hooks, journal, capacity and
+// other options apply to them.
+//
+// Some operations briefly change the filesystem's current directory with PushDir and PopDir, so
+// CdPrevious may return to a directory an operation used. Like the filesystem, a Memory isn't
+// safe for concurrent use.
+type Memory struct {
+	fs *imfs.Filesystem
+}
+
+// Creates an FS backed by the in-memory filesystem
+//
+// Parameters:
+//
+//	fs (*imfs.Filesystem) - the filesystem to use
+//
+// Returns:
+//
+//	*Memory - the shim
+func NewMemory(fs *imfs.Filesystem) *Memory {
+	return &Memory{fs: fs}
+}
+
+// Returns the filesystem backing the shim, e.g. to inspect it in a test
+func (m *Memory) Filesystem() *imfs.Filesystem {
+	return m.fs
+}
+
+func (m *Memory) Open(name string) (File, error) {
+	p := memPath(name)
+	entry, err := m.fs.Stat(p)
+	if err != nil {
+		return nil, pathError("open", name, syscall.ENOENT)
+	}
+	f := &memFile{name: name, info: newFileInfo(name, entry)}
+	if entry.Type == imfs.EntryDir {
+		return f, nil
+	}
+	err = m.inDir(imfs.Dirname(entry.Path), func() error {
+		handle, err := m.fs.Open(entry.Name)
+		f.handle = handle
+		return err
+	})
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return f, nil
+}
+
+func (m *Memory) ReadFile(name string) ([]byte, error) {
+	f, err := m.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (m *Memory) WriteFile(name string, data []byte, perm os.FileMode) error {
+	p := memPath(name)
+	entry, err := m.fs.Stat(p)
+	if err == nil {
+		// Existing files keep their permissions, like with os.WriteFile
+		if entry.Type == imfs.EntryDir {
+			return pathError("open", name, syscall.EISDIR)
+		}
+		if err := m.fs.Truncate(p, 0); err != nil {
+			return pathError("open", name, err)
+		}
+	} else {
+		dir, err := m.fs.Stat(path.Dir(p))
+		if err != nil {
+			return pathError("open", name, syscall.ENOENT)
+		}
+		if dir.Type != imfs.EntryDir {
+			return pathError("open", name, syscall.ENOTDIR)
+		}
+		if _, err := m.lstat(p); err == nil {
+			// A symbolic link to a missing file
+			return pathError("open", name, syscall.ENOENT)
+		}
+		entry = imfs.DirEntry{Name: path.Base(p), Path: strings.TrimSuffix(dir.Path, "/") + "/" + path.Base(p)}
+		err = m.inDir(dir.Path, func() error {
+			_, err := m.fs.MkFile(entry.Name)
+			return err
+		})
+		if err != nil {
+			return pathError("open", name, err)
+		}
+		if err := m.chmodCreated(entry.Path, perm); err != nil {
+			return pathError("chmod", name, err)
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	err = m.inDir(imfs.Dirname(entry.Path), func() error {
+		_, err := m.fs.WriteFile(entry.Name, string(data))
+		return err
+	})
+	if err != nil {
+		return pathError("write", name, err)
+	}
+	return nil
+}
+
+func (m *Memory) MkdirAll(name string, perm os.FileMode) error {
+	p := memPath(name)
+	if entry, err := m.fs.Stat(p); err == nil {
+		if entry.Type == imfs.EntryDir {
+			return nil
+		}
+		return pathError("mkdir", name, syscall.ENOTDIR)
+	}
+
+	// Create the missing directories from the deepest existing one down
+	missing := []string{}
+	existing := p
+	for {
+		if _, err := m.fs.Stat(existing); err == nil {
+			break
+		}
+		missing = append(missing, path.Base(existing))
+		existing = path.Dir(existing)
+	}
+	dir, err := m.fs.Stat(existing)
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+	if dir.Type != imfs.EntryDir {
+		return pathError("mkdir", name, syscall.ENOTDIR)
+	}
+	curr := strings.TrimSuffix(dir.Path, "/")
+	for i := len(missing) - 1; i >= 0; i-- {
+		curr += "/" + missing[i]
+		if _, err := m.fs.MkDir("~" + curr); err != nil {
+			return pathError("mkdir", name, err)
+		}
+		if err := m.chmodCreated(curr, perm); err != nil {
+			return pathError("chmod", name, err)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Remove(name string) error {
+	entry, err := m.lstat(memPath(name))
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	if strings.Trim(entry.Path, "/") == "" {
+		return pathError("remove", name, syscall.EBUSY)
+	}
+	if entry.Type == imfs.EntryDir {
+		children, err := m.fs.LsEntries("~" + entry.Path)
+		if err != nil {
+			return pathError("remove", name, err)
+		}
+		if len(children) > 0 {
+			return pathError("remove", name, syscall.ENOTEMPTY)
+		}
+	}
+	err = m.inDir(imfs.Dirname(entry.Path), func() error {
+		_, err := m.fs.Rm(entry.Name, false)
+		return err
+	})
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	return nil
+}
+
+func (m *Memory) Stat(name string) (os.FileInfo, error) {
+	entry, err := m.fs.Stat(memPath(name))
+	if err != nil {
+		return nil, pathError("stat", name, syscall.ENOENT)
+	}
+	return newFileInfo(name, entry), nil
+}
+
+// Walks the tree like filepath.Walk: symbolic links are reported but not followed, and fn may
+// return filepath.SkipDir or filepath.SkipAll
+func (m *Memory) Walk(root string, fn filepath.WalkFunc) error {
+	entry, err := m.lstat(memPath(root))
+	if err != nil {
+		err = fn(root, nil, pathError("lstat", root, err))
+	} else {
+		err = m.walk(root, entry, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// Implements Walk, mirroring filepath.Walk's handling of SkipDir
+func (m *Memory) walk(name string, entry imfs.DirEntry, fn filepath.WalkFunc) error {
+	info := newFileInfo(name, entry)
+	if entry.Type != imfs.EntryDir {
+		return fn(name, info, nil)
+	}
+	children, err := m.fs.LsEntries("~" + entry.Path)
+	if err != nil {
+		err = pathError("open", name, err)
+	}
+	if err := fn(name, info, err); err != nil || children == nil {
+		return err
+	}
+	for _, child := range children {
+		if err := m.walk(filepath.Join(name, child.Name), child, fn); err != nil {
+			if child.Type != imfs.EntryDir || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Describes the last element of a path without following it if it's a symbolic link, like
+// os.Lstat
+func (m *Memory) lstat(p string) (imfs.DirEntry, error) {
+	base := path.Base(p)
+	if base == "/" || base == "." || base == ".." || base == "~" {
+		return m.fs.Stat(p)
+	}
+	dir, err := m.fs.Stat(path.Dir(p))
+	if err != nil {
+		return imfs.DirEntry{}, syscall.ENOENT
+	}
+	if dir.Type != imfs.EntryDir {
+		return imfs.DirEntry{}, syscall.ENOTDIR
+	}
+	children, err := m.fs.LsEntries("~" + dir.Path)
+	if err != nil {
+		return imfs.DirEntry{}, err
+	}
+	for _, child := range children {
+		if child.Name == base {
+			return child, nil
+		}
+	}
+	return imfs.DirEntry{}, syscall.ENOENT
+}
+
+// Gives a file or directory that was just created the requested permissions, unless it already
+// has them. The umask isn't applied.
+func (m *Memory) chmodCreated(p string, perm os.FileMode) error {
+	entry, err := m.fs.Stat(p)
+	if err != nil || entry.Mode.Perm() == perm.Perm() {
+		return err
+	}
+	return m.fs.Chmod(p, perm.Perm(), false)
+}
+
+// Runs f with the directory at the absolute path as the current directory, since some of the
+// filesystem's operations only take names
+func (m *Memory) inDir(dir string, f func() error) error {
+	if _, err := m.fs.PushDir("~" + dir); err != nil {
+		return err
+	}
+	defer m.fs.PopDir()
+	return f()
+}
+
+// Converts a path as the application passes it to one the filesystem resolves
+func memPath(name string) string {
+	p := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	switch {
+	case p == ".":
+		return ""
+	case strings.HasPrefix(p, "~"):
+		return "/" + strings.TrimLeft(strings.TrimPrefix(p, "~"), "/")
+	}
+	return p
+}
+
+func pathError(op string, name string, err error) error {
+	return &iofs.PathError{Op: op, Path: name, Err: err}
+}
+
+// An open file of a Memory shim. Directories have no handle; reading them fails like it does on
+// Linux.
+type memFile struct {
+	name   string
+	info   os.FileInfo
+	handle *imfs.FileHandle
+	closed bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	switch {
+	case f.closed:
+		return 0, pathError("read", f.name, os.ErrClosed)
+	case f.handle == nil:
+		return 0, pathError("read", f.name, syscall.EISDIR)
+	}
+	n, err := f.handle.Read(p)
+	if err != nil && err != io.EOF {
+		err = pathError("read", f.name, err)
+	}
+	return n, err
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return pathError("close", f.name, os.ErrClosed)
+	}
+	f.closed = true
+	if f.handle != nil {
+		return f.handle.Close()
+	}
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	if f.closed {
+		return nil, pathError("stat", f.name, os.ErrClosed)
+	}
+	return f.info, nil
+}
+
+// Describes a DirEntry as an os.FileInfo
+type fileInfo struct {
+	name  string
+	entry imfs.DirEntry
+}
+
+// Names the entry after the last element of the path it was looked up with, like os.Stat does
+func newFileInfo(name string, entry imfs.DirEntry) fileInfo {
+	return fileInfo{name: filepath.Base(name), entry: entry}
+}
+
+func (i fileInfo) Name() string {
+	return i.name
+}
+
+func (i fileInfo) Size() int64 {
+	return int64(i.entry.Size)
+}
+
+func (i fileInfo) Mode() os.FileMode {
+	mode := i.entry.Mode.Perm()
+	switch i.entry.Type {
+	case imfs.EntryDir:
+		mode |= os.ModeDir
+	case imfs.EntrySymlink:
+		mode |= os.ModeSymlink
+	case imfs.EntryFifo:
+		mode |= os.ModeNamedPipe
+	case imfs.EntryDevice:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	}
+	return mode
+}
+
+func (i fileInfo) ModTime() time.Time {
+	return i.entry.ModTime
+}
+
+func (i fileInfo) IsDir() bool {
+	return i.entry.Type == imfs.EntryDir
+}
+
+// Returns the imfs.DirEntry describing the file
+func (i fileInfo) Sys() any {
+	return i.entry
+}
+
+var _ FS = OS{}
+var _ FS = (*Memory)(nil)
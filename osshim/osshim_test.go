@@ -0,0 +1,206 @@
+// osshim_test.go
+package osshim
+
+import (
+	"errors"
+	"github.com/bwent/in-memory-fs/imfs"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+// Runs the same calls against both implementations, which must behave alike
+func TestImplementationsAgree(t *testing.T) {
+	t.Run("OS", func(t *testing.T) {
+		testFS(t, OS{}, t.TempDir())
+	})
+	t.Run("Memory", func(t *testing.T) {
+		testFS(t, NewMemory(imfs.NewFileSystem()), "/base")
+	})
+}
+
+func testFS(t *testing.T, fsys FS, base string) {
+	join := func(elem ...string) string {
+		return filepath.Join(append([]string{base}, elem...)...)
+	}
+	if err := fsys.MkdirAll(join("a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.MkdirAll(join("a", "b"), 0755); err != nil {
+		t.Fatalf("Expected MkdirAll of an existing directory to succeed, got %s", err)
+	}
+
+	// WriteFile creates files and replaces their contents
+	file := join("a", "b", "c.txt")
+	if err := fsys.WriteFile(file, []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile(file, []byte("hi"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := fsys.ReadFile(file)
+	assertMatchesAndNoErrors(string(data), err, "hi", t)
+	if err := fsys.WriteFile(join("a", "d.txt"), []byte("d"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := fsys.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "c.txt" || info.Size() != 2 || info.IsDir() || info.Mode() != 0644 {
+		t.Errorf("Unexpected stat: name=%s size=%d mode=%s", info.Name(), info.Size(), info.Mode())
+	}
+	info, err = fsys.Stat(join("a"))
+	if err != nil || !info.IsDir() || info.Mode()&os.ModeDir == 0 {
+		t.Errorf("Expected a directory, got %v (%v)", info, err)
+	}
+
+	f, err := fsys.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = io.ReadAll(f)
+	assertMatchesAndNoErrors(string(data), err, "hi", t)
+	if info, err := f.Stat(); err != nil || info.Size() != 2 {
+		t.Errorf("Expected the open file's size to be 2, got %v (%v)", info, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Errors can be checked the same way on both
+	if _, err := fsys.Open(join("missing")); !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("Expected Open to fail with ErrNotExist, got %v", err)
+	}
+	if _, err := fsys.Stat(join("missing")); !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("Expected Stat to fail with ErrNotExist, got %v", err)
+	}
+	if err := fsys.WriteFile(join("missing", "x"), nil, 0644); !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("Expected WriteFile to fail with ErrNotExist, got %v", err)
+	}
+	if err := fsys.MkdirAll(join("a", "d.txt", "e"), 0755); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("Expected MkdirAll to fail with ENOTDIR, got %v", err)
+	}
+	if _, err := fsys.ReadFile(join("a")); !errors.Is(err, syscall.EISDIR) {
+		t.Errorf("Expected ReadFile to fail with EISDIR, got %v", err)
+	}
+	if err := fsys.Remove(join("a", "b")); !errors.Is(err, syscall.ENOTEMPTY) && !errors.Is(err, syscall.EEXIST) {
+		t.Errorf("Expected Remove to fail with ENOTEMPTY, got %v", err)
+	}
+	var pathErr *iofs.PathError
+	if err := fsys.Remove(join("missing")); !errors.As(err, &pathErr) || !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("Expected Remove to fail with a *PathError, got %v", err)
+	}
+
+	// Walk visits everything in lexical order and honors SkipDir
+	visited := []string{}
+	err = fsys.Walk(base, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(base, path)
+		visited = append(visited, filepath.ToSlash(rel))
+		return nil
+	})
+	assertMatchesAndNoErrors(visited, err, []string{".", "a", "a/b", "a/b/c.txt", "a/d.txt"}, t)
+	visited = visited[:0]
+	err = fsys.Walk(base, func(path string, info os.FileInfo, err error) error {
+		if info.IsDir() && info.Name() == "b" {
+			return filepath.SkipDir
+		}
+		rel, _ := filepath.Rel(base, path)
+		visited = append(visited, filepath.ToSlash(rel))
+		return nil
+	})
+	assertMatchesAndNoErrors(visited, err, []string{".", "a", "a/d.txt"}, t)
+
+	if err := fsys.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Remove(join("a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat(join("a", "b")); !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("Expected the directory to be removed, got %v", err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	fs := imfs.NewFileSystem()
+	fs.MkDir("docs")
+	fs.Cd("docs")
+	fs.MkFile("a.txt")
+	fs.WriteFile("a.txt", "hello")
+	fs.Symlink("a.txt", "link")
+	shim := NewMemory(fs)
+
+	// Relative paths start at the current directory, which operations leave alone
+	data, err := shim.ReadFile("link")
+	assertMatchesAndNoErrors(string(data), err, "hello", t)
+	if err := shim.WriteFile(`..\notes.txt`, []byte("note"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assertMatchesAndNoErrors(fs.Pwd(), nil, "/docs", t)
+	data, err = shim.ReadFile("~/notes.txt")
+	assertMatchesAndNoErrors(string(data), err, "note", t)
+	info, err := shim.Stat("/notes.txt")
+	if err != nil || info.Mode() != 0600 {
+		t.Fatalf("Expected mode 0600, got %v (%v)", info, err)
+	}
+	if entry, ok := info.Sys().(imfs.DirEntry); !ok || entry.Path != "/notes.txt" {
+		t.Errorf("Expected Sys to return the DirEntry, got %#v", info.Sys())
+	}
+
+	// Writing through a link writes its target
+	if err := shim.WriteFile("link", []byte("bye"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := fs.ReadFile("a.txt")
+	assertMatchesAndNoErrors(res, err, "bye", t)
+
+	// Walk reports links without following them, and Remove removes the link itself
+	modes := map[string]os.FileMode{}
+	err = shim.Walk("/docs", func(path string, info os.FileInfo, err error) error {
+		modes[filepath.ToSlash(path)] = info.Mode().Type()
+		return err
+	})
+	assertMatchesAndNoErrors(modes, err, map[string]os.FileMode{"/docs": os.ModeDir, "/docs/a.txt": 0, "/docs/link": os.ModeSymlink}, t)
+	if err := shim.Remove("link"); err != nil {
+		t.Fatal(err)
+	}
+	res, err = fs.Ls()
+	assertMatchesAndNoErrors(res, err, "a.txt", t)
+
+	// Operations run through the filesystem, so hooks can fail them
+	fs.Use(failingHook{})
+	if err := shim.WriteFile("a.txt", []byte("x"), 0644); err == nil || err.Error() != "write a.txt: Injected failure" {
+		t.Errorf("Expected the hook to fail the write, got %v", err)
+	}
+}
+
+// Fails every write of data
+type failingHook struct{}
+
+func (failingHook) Before(event *imfs.OperationEvent) error {
+	if event.Op == imfs.OperationWrite && len(event.Data) > 0 {
+		return errors.New("Injected failure")
+	}
+	return nil
+}
+
+func (failingHook) After(event *imfs.OperationEvent) {}
+
+func assertMatchesAndNoErrors(res any, err error, expected any, t *testing.T) {
+	t.Helper()
+	if err != nil {
+		t.Errorf("Expected no errors but got %s", err)
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("Expected %v but was %v", expected, res)
+	}
+}
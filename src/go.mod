@@ -1,3 +0,0 @@
-module in-memory-fs/src
-
-go 1.20
@@ -1,3 +0,0 @@
-module in-memory-fs/src/util
-
-go 1.20